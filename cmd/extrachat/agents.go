@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"ExtraChat/internal/chatbot"
+	"ExtraChat/internal/config"
+)
+
+const agentsUsage = "usage: extrachat agents --agent <persona> --agent <persona> [flags] <task>"
+
+// agentList collects repeated --agent flags
+type agentList []string
+
+// String is empty: loadConfig sets explicit flags again from their String
+// value, and the agents are already collected by then
+func (a *agentList) String() string { return "" }
+
+func (a *agentList) Set(spec string) error {
+	if spec != "" {
+		*a = append(*a, spec)
+	}
+	return nil
+}
+
+// agentsOptions are the flags "extrachat agents" takes on top of the chat
+// flags
+type agentsOptions struct {
+	agents    agentList
+	moderator string
+	turns     int
+	stop      string
+}
+
+// define registers the agents flags
+func (o *agentsOptions) define(fs *flag.FlagSet) {
+	fs.Var(&o.agents, "agent", "Persona taking part, as name or name=model with an alias, backend or backend/model (repeat for each agent)")
+	fs.StringVar(&o.moderator, "moderator", "", "Persona that decides after each round whether the task is done, as name or name=model")
+	fs.IntVar(&o.turns, "turns", 6, "Most agent replies")
+	fs.StringVar(&o.stop, "stop", "[DONE]", "Phrase that ends the conversation when an agent or the moderator says it")
+}
+
+// runAgents handles "extrachat agents", where personas take turns on a task
+func runAgents(args []string, envFileVars []config.EnvFileVar) error {
+	var opts agentsOptions
+	var fs *flag.FlagSet
+	cfg, err := loadConfig(args, flag.ExitOnError, func(f *flag.FlagSet) {
+		fs = f
+		opts.define(f)
+	})
+	if err != nil {
+		return err
+	}
+	cfg.EnvFileVars = envFileVars
+	task := strings.TrimSpace(strings.Join(fs.Args(), " "))
+	switch {
+	case task == "" || len(opts.agents) < 2:
+		return errors.New(agentsUsage)
+	case opts.turns < 1:
+		return errors.New("--turns must be positive")
+	case strings.TrimSpace(opts.stop) == "":
+		return errors.New("--stop must not be empty")
+	}
+
+	bot, err := chatbot.NewChatBot(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to initialize chatbot: %w", err)
+	}
+	defer bot.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return bot.RunAgents(ctx, os.Stdout, os.Stderr, chatbot.AgentOptions{
+		Task:      task,
+		Agents:    opts.agents,
+		Moderator: opts.moderator,
+		Turns:     opts.turns,
+		Stop:      opts.stop,
+	})
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"ExtraChat/internal/config"
+	"ExtraChat/internal/keyring"
+)
+
+const authUsage = "usage: extrachat auth set|delete <backend> | extrachat auth status"
+
+// runAuth handles "extrachat auth", which manages API keys in the OS keyring
+func runAuth(args []string) error {
+	if len(args) == 1 && args[0] == "status" {
+		return authStatus()
+	}
+	if len(args) != 2 {
+		return errors.New(authUsage)
+	}
+
+	backend := args[1]
+	if _, ok := config.APIKeyEnvVars[backend]; !ok {
+		return fmt.Errorf("backend %q does not take an API key", backend)
+	}
+
+	switch args[0] {
+	case "set":
+		key, err := readSecret(fmt.Sprintf("API key for %s: ", backend))
+		if err != nil {
+			return err
+		}
+		if key == "" {
+			return fmt.Errorf("no API key entered")
+		}
+		if err := keyring.Set(backend, key); err != nil {
+			return err
+		}
+		fmt.Printf("Stored the %s API key in the keyring\n", backend)
+	case "delete":
+		if err := keyring.Delete(backend); err != nil {
+			return err
+		}
+		fmt.Printf("Removed the %s API key from the keyring\n", backend)
+	default:
+		return errors.New(authUsage)
+	}
+	return nil
+}
+
+// authStatus reports where each backend's API key comes from, without
+// printing the keys
+func authStatus() error {
+	backends := make([]string, 0, len(config.APIKeyEnvVars))
+	for backend := range config.APIKeyEnvVars {
+		backends = append(backends, backend)
+	}
+	sort.Strings(backends)
+
+	for _, backend := range backends {
+		envVar := config.APIKeyEnvVars[backend]
+		source := "not set"
+		if os.Getenv(envVar) != "" {
+			source = "environment (" + envVar + ")"
+		} else if _, err := keyring.Get(backend); err == nil {
+			source = "keyring"
+		} else if !errors.Is(err, keyring.ErrNotFound) {
+			source = "keyring unavailable: " + err.Error()
+		}
+		fmt.Printf("%-10s %s\n", backend, source)
+	}
+	return nil
+}
+
+// readSecret reads one line from stdin, hiding the input when stdin is a
+// terminal. Piped input (echo "$KEY" | extrachat auth set openai) works too.
+func readSecret(prompt string) (string, error) {
+	info, err := os.Stdin.Stat()
+	terminal := err == nil && info.Mode()&os.ModeCharDevice != 0
+	if terminal {
+		fmt.Fprint(os.Stderr, prompt)
+		if setEcho(false) == nil {
+			defer func() {
+				setEcho(true)
+				fmt.Fprintln(os.Stderr)
+			}()
+		}
+	}
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("failed to read API key: %w", err)
+	}
+	return strings.TrimSpace(line), nil
+}
+
+// setEcho turns terminal echo on or off with stty; where stty isn't
+// available the key is read with echo on
+func setEcho(on bool) error {
+	mode := "-echo"
+	if on {
+		mode = "echo"
+	}
+	cmd := exec.Command("stty", mode)
+	cmd.Stdin = os.Stdin
+	return cmd.Run()
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"ExtraChat/internal/chatbot"
+	"ExtraChat/internal/config"
+)
+
+const batchUsage = "usage: extrachat batch [flags] --in prompts.jsonl --out results.jsonl"
+
+// batchOptions are the flags "extrachat batch" takes on top of the chat flags
+type batchOptions struct {
+	in          string
+	out         string
+	concurrency int
+	retries     int
+	rateLimit   int
+
+	messageBatches bool
+	pollInterval   time.Duration
+}
+
+// define registers the batch flags
+func (o *batchOptions) define(fs *flag.FlagSet) {
+	fs.StringVar(&o.in, "in", "", "JSONL file of prompts to run")
+	fs.StringVar(&o.out, "out", "", "JSONL file the results are appended to; a rerun skips the prompts it has results for")
+	fs.IntVar(&o.concurrency, "concurrency", 4, "Prompts sent at once")
+	fs.IntVar(&o.retries, "retries", 3, "Retries of a prompt after a rate limit, timeout, server or network error")
+	fs.IntVar(&o.rateLimit, "rate-limit", 0, "Most requests per minute across all workers (0 for no limit)")
+	fs.BoolVar(&o.messageBatches, "message-batches", false, "Submit the prompts to Anthropic's Message Batches API at half the price, and wait for the results")
+	fs.DurationVar(&o.pollInterval, "poll-interval", 30*time.Second, "How often to check on a message batch")
+}
+
+// runBatch handles "extrachat batch", which runs a file of prompts through
+// the configured backend
+func runBatch(args []string, envFileVars []config.EnvFileVar) error {
+	var opts batchOptions
+	cfg, err := loadConfig(args, flag.ExitOnError, opts.define)
+	if err != nil {
+		return err
+	}
+	cfg.EnvFileVars = envFileVars
+	switch {
+	case opts.in == "" || opts.out == "":
+		return errors.New(batchUsage)
+	case opts.concurrency < 1:
+		return errors.New("--concurrency must be positive")
+	case opts.retries < 0 || opts.rateLimit < 0:
+		return errors.New("--retries and --rate-limit must be at least 0")
+	case opts.pollInterval <= 0:
+		return errors.New("--poll-interval must be positive")
+	}
+
+	bot, err := chatbot.NewChatBot(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to initialize chatbot: %w", err)
+	}
+	defer bot.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return bot.Batch(ctx, os.Stderr, chatbot.BatchOptions{
+		In:          opts.in,
+		Out:         opts.out,
+		Concurrency: opts.concurrency,
+		Retries:     opts.retries,
+		RateLimit:   opts.rateLimit,
+
+		MessageBatches: opts.messageBatches,
+		PollInterval:   opts.pollInterval,
+	})
+}
@@ -0,0 +1,677 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"ExtraChat/internal/chatbot"
+	"ExtraChat/internal/config"
+	"ExtraChat/internal/dataset"
+	"ExtraChat/internal/mcp"
+	"ExtraChat/internal/review"
+)
+
+const completionUsage = "usage: extrachat completion bash|zsh|fish"
+
+// completionCommand is the command the scripts complete and call back into
+// for backends and session IDs
+const completionCommand = "extrachat"
+
+// subcommands are the first arguments main handles itself
+var subcommands = []struct{ name, help string }{
+	{"selftest", "Check the whole pipeline against local stubs"},
+	{"auth", "Manage API keys in the OS keyring"},
+	{"usage", "Report token usage and cost across sessions"},
+	{"completion", "Print a shell completion script"},
+	{"serve", "Serve sessions over a REST API"},
+	{"batch", "Run a JSONL file of prompts through the backend"},
+	{"run", "Run a pipeline of templated prompts"},
+	{"agents", "Have personas take turns on a task"},
+	{"replay", "Re-run a session's prompts on another backend"},
+	{"export", "Write sessions as a fine-tuning dataset"},
+	{"git", "Write a commit message or pull request description"},
+	{"review", "Review source files or a diff and report findings"},
+	{"eval", "Score a suite of prompts with assertions across models"},
+	{"ingest", "Embed documents for retrieval (/rag)"},
+	{"kb", "Manage named knowledge collections"},
+}
+
+// fileArgs are the subcommands with flags of their own that also take a
+// file after them, with what the file is
+var fileArgs = map[string]string{"run": "pipeline", "eval": "suite", "review": "source"}
+
+// sessionArgs are the subcommands with flags of their own that also take a
+// session ID after them
+var sessionArgs = map[string]bool{"replay": true, "export": true}
+
+// actionArgs are the subcommands with flags of their own that take one of
+// a set of actions first
+var actionArgs = map[string][]string{"git": chatbot.GitModes}
+
+// valueKind says how a flag's value is completed
+type valueKind int
+
+const (
+	valueNone    valueKind = iota // Boolean flag, takes no value
+	valueText                     // Free text, nothing to complete
+	valueBackend                  // Backend or model alias, listed live
+	valueSession                  // Session ID, listed live from the database
+	valuePersona                  // Persona, listed live from the config file and the presets
+	valueFile
+	valueDir
+	valueWords // One of a fixed set of words
+)
+
+// flagValueKinds are the flags whose values can be completed
+var flagValueKinds = map[string]valueKind{
+	"backend":            valueBackend,
+	"summarizer-backend": valueBackend,
+	"judge":              valueBackend,
+	"session-id":         valueSession,
+	"agent":              valuePersona,
+	"moderator":          valuePersona,
+	"config":             valueFile,
+	"db-path":            valueFile,
+	"file":               valueFile,
+	"audit-log":          valueFile,
+	"mcp-config":         valueFile,
+	"mcp-local":          valueFile,
+	"mock-fixtures":      valueFile,
+	"in":                 valueFile,
+	"out":                valueFile,
+	"pipeline":           valueFile,
+	"log-dir":            valueDir,
+	"backup-dir":         valueDir,
+	"sandbox-root":       valueDir,
+	"record":             valueDir,
+	"replay":             valueDir,
+	"repo":               valueDir,
+	"log-level":          valueWords,
+	"mcp-log-level":      valueWords,
+	"output":             valueWords,
+	"embed-backend":      valueWords,
+	"rerank":             valueWords,
+	"format":             valueWords,
+	"tools":              valueWords,
+	"fail-on":            valueWords,
+}
+
+// flagWords are the values of valueWords flags
+var flagWords = map[string][]string{
+	"log-level":     {"debug", "info", "warn", "error"},
+	"mcp-log-level": mcp.LogLevels,
+	"output":        {config.OutputText, config.OutputJSON},
+	"embed-backend": config.EmbedBackends,
+	"rerank":        config.Rerankers,
+	"format":        dataset.Formats,
+	"tools":         chatbot.ExportTools,
+	"fail-on":       review.Severities,
+}
+
+// flagSpec describes a command-line flag for the completion scripts
+type flagSpec struct {
+	name  string
+	usage string
+	kind  valueKind
+	words []string
+}
+
+// option returns the flag as typed: --name, or -p for one-letter flags
+func (f flagSpec) option() string {
+	if len(f.name) == 1 {
+		return "-" + f.name
+	}
+	return "--" + f.name
+}
+
+// flagSpecs lists the chat flags in alphabetical order
+func flagSpecs() []flagSpec {
+	var cfg config.Config
+	var raw rawFlags
+	return specsOf(func(fs *flag.FlagSet) { defineFlags(fs, &cfg, &raw) })
+}
+
+// ownFlagSpecs lists, by subcommand, the flags serve, batch, run, agents,
+// replay, export, git, review and eval take on top of the chat flags
+func ownFlagSpecs() map[string][]flagSpec {
+	var serve serveOptions
+	var batch batchOptions
+	var run runOptions
+	var agents agentsOptions
+	var replay replayOptions
+	var export exportOptions
+	var gitOpts gitOptions
+	var reviewOpts reviewOptions
+	var evalOpts evalOptions
+	return map[string][]flagSpec{
+		"serve":  specsOf(serve.define),
+		"batch":  specsOf(batch.define),
+		"run":    specsOf(run.define),
+		"agents": specsOf(agents.define),
+		"replay": specsOf(replay.define),
+		"export": specsOf(export.define),
+		"git":    specsOf(gitOpts.define),
+		"review": specsOf(reviewOpts.define),
+		"eval":   specsOf(evalOpts.define),
+	}
+}
+
+// specsOf describes the flags define registers
+func specsOf(define func(fs *flag.FlagSet)) []flagSpec {
+	fs := flag.NewFlagSet(completionCommand, flag.ContinueOnError)
+	define(fs)
+
+	var specs []flagSpec
+	fs.VisitAll(func(f *flag.Flag) {
+		spec := flagSpec{name: f.Name, usage: f.Usage, kind: valueText}
+		if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() {
+			spec.kind = valueNone
+		} else if kind, ok := flagValueKinds[f.Name]; ok {
+			spec.kind = kind
+			spec.words = flagWords[f.Name]
+		}
+		specs = append(specs, spec)
+	})
+	return specs
+}
+
+// runCompletion handles "extrachat completion", which prints a completion
+// script for the given shell. The scripts call "extrachat completion list"
+// to complete backends and session IDs with the current config and database.
+func runCompletion(args []string) error {
+	if len(args) >= 2 && args[0] == "list" {
+		return listCompletions(os.Stdout, args[1], args[2:])
+	}
+	if len(args) != 1 {
+		return errors.New(completionUsage)
+	}
+
+	switch args[0] {
+	case "bash":
+		writeBashCompletion(os.Stdout, flagSpecs(), ownFlagSpecs())
+	case "zsh":
+		writeZshCompletion(os.Stdout, flagSpecs(), ownFlagSpecs())
+	case "fish":
+		writeFishCompletion(os.Stdout, flagSpecs(), ownFlagSpecs())
+	default:
+		return fmt.Errorf("unsupported shell %q (%s)", args[0], completionUsage)
+	}
+	return nil
+}
+
+// listCompletions prints the backends and model aliases, the session IDs or
+// the personas, one per line. args may hold --config and --db-path from the command line
+// being completed.
+func listCompletions(w io.Writer, what string, args []string) error {
+	cfg, err := loadConfig(args, flag.ContinueOnError)
+
+	var values []string
+	switch what {
+	case "backends":
+		// A broken config file still leaves the backends to complete
+		values = append(values, config.Backends...)
+		if err == nil {
+			for alias := range cfg.Aliases {
+				values = append(values, alias)
+			}
+		}
+		sort.Strings(values)
+	case "sessions":
+		if err != nil {
+			return err
+		}
+		if values, err = chatbot.SessionIDs(cfg.DBPath); err != nil {
+			return err
+		}
+	case "personas":
+		if err != nil {
+			return err
+		}
+		values = cfg.PersonaNames()
+	default:
+		return fmt.Errorf("unknown completion list %q (expected backends, sessions or personas)", what)
+	}
+
+	for _, value := range values {
+		fmt.Fprintln(w, value)
+	}
+	return nil
+}
+
+// flagAlternatives returns the bash case pattern matching a flag with one or
+// two dashes
+func flagAlternatives(name string) string {
+	return "--" + name + "|-" + name
+}
+
+// bashReply returns the bash that completes the value of a flag
+func bashReply(spec flagSpec) string {
+	switch spec.kind {
+	case valueBackend:
+		return fmt.Sprintf(`COMPREPLY=($(compgen -W "$(__%s_list backends)" -- "$cur")); return`, completionCommand)
+	case valueSession:
+		return fmt.Sprintf(`COMPREPLY=($(compgen -W "$(__%s_list sessions)" -- "$cur")); return`, completionCommand)
+	case valuePersona:
+		return fmt.Sprintf(`COMPREPLY=($(compgen -W "$(__%s_list personas)" -- "$cur")); return`, completionCommand)
+	case valueFile:
+		return `COMPREPLY=($(compgen -f -- "$cur")); return`
+	case valueDir:
+		return `COMPREPLY=($(compgen -d -- "$cur")); return`
+	case valueWords:
+		return fmt.Sprintf(`COMPREPLY=($(compgen -W "%s" -- "$cur")); return`, strings.Join(spec.words, " "))
+	}
+	return "return"
+}
+
+func writeBashCompletion(w io.Writer, specs []flagSpec, own map[string][]flagSpec) {
+	var names, options []string
+	for _, s := range subcommands {
+		names = append(names, s.name)
+	}
+	for _, spec := range specs {
+		options = append(options, spec.option())
+	}
+
+	// serve, batch, run, agents, replay and eval take the chat flags, plus their own
+	var ownCases strings.Builder
+	for _, s := range subcommands {
+		if len(own[s.name]) == 0 {
+			continue
+		}
+		var ownOptions []string
+		fmt.Fprintf(&ownCases, "    %s)\n", s.name)
+		if actions, ok := actionArgs[s.name]; ok {
+			fmt.Fprintf(&ownCases, "        if [[ $COMP_CWORD -eq 2 ]]; then\n            COMPREPLY=($(compgen -W \"%s\" -- \"$cur\"))\n            return\n        fi\n", strings.Join(actions, " "))
+		}
+		fmt.Fprintf(&ownCases, "        case \"$prev\" in\n")
+		for _, spec := range own[s.name] {
+			ownOptions = append(ownOptions, spec.option())
+			if spec.kind != valueNone {
+				fmt.Fprintf(&ownCases, "        %s) %s ;;\n", flagAlternatives(spec.name), bashReply(spec))
+			}
+		}
+		fmt.Fprintf(&ownCases, "        esac\n")
+		if _, ok := fileArgs[s.name]; ok {
+			fmt.Fprint(&ownCases, "        if [[ $cur != -* && $prev != -* ]]; then\n            COMPREPLY=($(compgen -f -- \"$cur\"))\n            return\n        fi\n")
+		}
+		if sessionArgs[s.name] {
+			fmt.Fprintf(&ownCases, "        if [[ $cur != -* && $prev != -* ]]; then\n            COMPREPLY=($(compgen -W \"$(__%s_list sessions)\" -- \"$cur\"))\n            return\n        fi\n", completionCommand)
+		}
+		fmt.Fprintf(&ownCases, "        extra=\"%s\"\n        ;;\n", strings.Join(ownOptions, " "))
+	}
+
+	fmt.Fprintf(w, `# bash completion for %[1]s
+# Load it with: source <(%[1]s completion bash)
+
+# The --config and --db-path given so far, for the live lists
+__%[1]s_config_args() {
+    local i
+    for ((i = 1; i < COMP_CWORD - 1; i++)); do
+        case "${COMP_WORDS[i]}" in
+        %[2]s|%[3]s) printf '%%s\n' "${COMP_WORDS[i]}" "${COMP_WORDS[i+1]}" ;;
+        esac
+    done
+}
+
+__%[1]s_list() {
+    local -a config_args
+    mapfile -t config_args < <(__%[1]s_config_args)
+    %[1]s completion list "$1" "${config_args[@]}" 2>/dev/null
+}
+
+_%[1]s() {
+    local cur="${COMP_WORDS[COMP_CWORD]}" prev="${COMP_WORDS[COMP_CWORD-1]}" extra=""
+    COMPREPLY=()
+
+    if [[ $COMP_CWORD -eq 1 && $cur != -* ]]; then
+        COMPREPLY=($(compgen -W "%[4]s" -- "$cur"))
+        return
+    fi
+    case "${COMP_WORDS[1]}" in
+    selftest)
+        return
+        ;;
+    auth)
+        if [[ $COMP_CWORD -eq 2 ]]; then
+            COMPREPLY=($(compgen -W "set delete status" -- "$cur"))
+        elif [[ $COMP_CWORD -eq 3 && $prev != status ]]; then
+            COMPREPLY=($(compgen -W "%[5]s" -- "$cur"))
+        fi
+        return
+        ;;
+    usage)
+        case "$prev" in
+        %[3]s) COMPREPLY=($(compgen -f -- "$cur")) ;;
+        --since|-since) ;;
+        *) COMPREPLY=($(compgen -W "--since --db-path" -- "$cur")) ;;
+        esac
+        return
+        ;;
+    completion)
+        [[ $COMP_CWORD -eq 2 ]] && COMPREPLY=($(compgen -W "bash zsh fish" -- "$cur"))
+        return
+        ;;
+%[6]s    ingest)
+        # The chat flags, then the documents
+        if [[ $cur != -* && $prev != -* ]]; then
+            COMPREPLY=($(compgen -f -- "$cur"))
+            return
+        fi
+        ;;
+    kb)
+        if [[ $COMP_CWORD -eq 2 ]]; then
+            COMPREPLY=($(compgen -W "create add list stats rerank delete" -- "$cur"))
+            return
+        fi
+        if [[ ${COMP_WORDS[2]} != add ]]; then
+            case "$prev" in
+            %[3]s) COMPREPLY=($(compgen -f -- "$cur")) ;;
+            *) [[ $cur == -* ]] && COMPREPLY=($(compgen -W "--db-path" -- "$cur")) ;;
+            esac
+            return
+        fi
+        # kb add takes the chat flags, then the collection and documents
+        if [[ $cur != -* && $prev != -* ]]; then
+            COMPREPLY=($(compgen -f -- "$cur"))
+            return
+        fi
+        ;;
+    esac
+
+    case "$prev" in
+`, completionCommand, flagAlternatives("config"), flagAlternatives("db-path"),
+		strings.Join(names, " "), strings.Join(apiKeyBackends(), " "),
+		ownCases.String())
+
+	for _, spec := range specs {
+		if spec.kind != valueNone {
+			fmt.Fprintf(w, "    %s) %s ;;\n", flagAlternatives(spec.name), bashReply(spec))
+		}
+	}
+
+	fmt.Fprintf(w, `    esac
+    COMPREPLY=($(compgen -W "%[2]s $extra" -- "$cur"))
+}
+
+complete -o filenames -F _%[1]s %[1]s
+`, completionCommand, strings.Join(options, " "))
+}
+
+// zshQuote escapes an _arguments description for a single-quoted word
+func zshQuote(s string) string {
+	return strings.NewReplacer(`'`, `'\''`, `[`, `\[`, `]`, `\]`).Replace(s)
+}
+
+// zshAction returns the _arguments action that completes the value of a flag
+func zshAction(spec flagSpec) string {
+	switch spec.kind {
+	case valueText:
+		return ":value: "
+	case valueBackend:
+		return fmt.Sprintf(":backend:__%s_backends", completionCommand)
+	case valueSession:
+		return fmt.Sprintf(":session:__%s_sessions", completionCommand)
+	case valuePersona:
+		return fmt.Sprintf(":persona:__%s_personas", completionCommand)
+	case valueFile:
+		return ":file:_files"
+	case valueDir:
+		return ":directory:_files -/"
+	case valueWords:
+		return fmt.Sprintf(":value:(%s)", strings.Join(spec.words, " "))
+	}
+	return ""
+}
+
+func writeZshCompletion(w io.Writer, specs []flagSpec, own map[string][]flagSpec) {
+	fmt.Fprintf(w, `#compdef %[1]s
+# zsh completion for %[1]s
+# Load it with: source <(%[1]s completion zsh)
+# or save it as _%[1]s in a directory on $fpath
+
+# The --config and --db-path given so far, for the live lists
+__%[1]s_config_args() {
+    local i
+    reply=()
+    for ((i = 2; i < CURRENT - 1; i++)); do
+        case $words[i] in
+        (%[2]s|%[3]s) reply+=("$words[i]" "$words[i+1]") ;;
+        esac
+    done
+}
+
+__%[1]s_backends() {
+    local -a reply backends
+    __%[1]s_config_args
+    backends=(${(f)"$(%[1]s completion list backends "${reply[@]}" 2>/dev/null)"})
+    _describe -t backends 'backend' backends
+}
+
+__%[1]s_sessions() {
+    local -a reply sessions
+    __%[1]s_config_args
+    sessions=(${(f)"$(%[1]s completion list sessions "${reply[@]}" 2>/dev/null)"})
+    _describe -t sessions 'session' sessions
+}
+
+__%[1]s_personas() {
+    local -a reply personas
+    __%[1]s_config_args
+    personas=(${(f)"$(%[1]s completion list personas "${reply[@]}" 2>/dev/null)"})
+    _describe -t personas 'persona' personas
+}
+
+_%[1]s() {
+    local -a extra
+    if (( CURRENT == 2 )) && [[ $words[2] != -* ]]; then
+        local -a subcommands=(
+`, completionCommand, flagAlternatives("config"), flagAlternatives("db-path"))
+	for _, s := range subcommands {
+		fmt.Fprintf(w, "            '%s:%s'\n", s.name, zshQuote(s.help))
+	}
+	fmt.Fprintf(w, `        )
+        _describe -t commands 'command' subcommands
+        return
+    fi
+    case $words[2] in
+    (selftest)
+        return
+        ;;
+    (auth)
+        if (( CURRENT == 3 )); then
+            _values 'action' set delete status
+        elif (( CURRENT == 4 )) && [[ $words[3] != status ]]; then
+            _values 'backend' %[1]s
+        fi
+        return
+        ;;
+    (usage)
+        shift words
+        (( CURRENT-- ))
+        _arguments \
+            '--since[Report window, e.g. 30d, 12h or 0 for all time]:window: ' \
+            '--db-path[Path to the SQLite database]:database:_files'
+        return
+        ;;
+    (completion)
+        (( CURRENT == 3 )) && _values 'shell' bash zsh fish
+        return
+        ;;
+`, strings.Join(apiKeyBackends(), " "))
+	// serve, batch, run, agents, replay and eval take the chat flags, plus their own
+	for _, s := range subcommands {
+		if len(own[s.name]) == 0 {
+			continue
+		}
+		if actions, ok := actionArgs[s.name]; ok {
+			fmt.Fprintf(w, "    (%s)\n        if (( CURRENT == 3 )); then\n            _values 'action' %s\n            return\n        fi\n        shift 2 words\n        (( CURRENT -= 2 ))\n        extra=(\n", s.name, strings.Join(actions, " "))
+		} else {
+			fmt.Fprintf(w, "    (%s)\n        shift words\n        (( CURRENT-- ))\n        extra=(\n", s.name)
+		}
+		for _, spec := range own[s.name] {
+			fmt.Fprintf(w, "            '%s[%s]%s'\n", spec.option(), zshQuote(spec.usage), zshAction(spec))
+		}
+		if what, ok := fileArgs[s.name]; ok {
+			fmt.Fprintf(w, "            '*:%s:_files'\n", what)
+		}
+		if sessionArgs[s.name] {
+			fmt.Fprintf(w, "            ':session:__%s_sessions'\n", completionCommand)
+		}
+		fmt.Fprint(w, "        )\n        ;;\n")
+	}
+	fmt.Fprint(w, `    (ingest)
+        # The chat flags, then the documents
+        shift words
+        (( CURRENT-- ))
+        extra=('*:document:_files')
+        ;;
+    (kb)
+        if (( CURRENT == 3 )); then
+            _values 'action' create add list stats rerank delete
+            return
+        fi
+        if [[ $words[3] != add ]]; then
+            shift 2 words
+            (( CURRENT -= 2 ))
+            _arguments '--db-path[Path to the SQLite database]:database:_files' '*:collection: '
+            return
+        fi
+        # kb add takes the chat flags, then the collection and documents
+        shift 2 words
+        (( CURRENT -= 2 ))
+        extra=('*:document:_files')
+        ;;
+    esac
+
+    _arguments "${extra[@]}" \
+`)
+
+	for i, spec := range specs {
+		end := " \\"
+		if i == len(specs)-1 {
+			end = ""
+		}
+		fmt.Fprintf(w, "        '%s[%s]%s'%s\n", spec.option(), zshQuote(spec.usage), zshAction(spec), end)
+	}
+
+	fmt.Fprintf(w, `}
+
+if [[ $funcstack[1] == _%[1]s ]]; then
+    _%[1]s "$@"
+else
+    compdef _%[1]s %[1]s
+fi
+`, completionCommand)
+}
+
+// fishQuote escapes s for a single-quoted fish word
+func fishQuote(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s)
+}
+
+// fishValues returns the complete options that complete the value of a flag
+func fishValues(spec flagSpec) string {
+	switch spec.kind {
+	case valueText:
+		return " -x"
+	case valueBackend:
+		return fmt.Sprintf(" -x -a '(__%s_list backends)'", completionCommand)
+	case valueSession:
+		return fmt.Sprintf(" -x -a '(__%s_list sessions)'", completionCommand)
+	case valuePersona:
+		return fmt.Sprintf(" -x -a '(__%s_list personas)'", completionCommand)
+	case valueFile:
+		return " -r -F"
+	case valueDir:
+		return " -x -a '(__fish_complete_directories)'"
+	case valueWords:
+		return fmt.Sprintf(" -x -a '%s'", strings.Join(spec.words, " "))
+	}
+	return ""
+}
+
+func writeFishCompletion(w io.Writer, specs []flagSpec, own map[string][]flagSpec) {
+	// serve, batch, run, agents, replay, eval, ingest and kb add take the chat flags too
+	var names []string
+	for _, s := range subcommands {
+		if len(own[s.name]) == 0 && s.name != "ingest" && s.name != "kb" {
+			names = append(names, s.name)
+		}
+	}
+
+	fmt.Fprintf(w, `# fish completion for %[1]s
+# Load it with: %[1]s completion fish | source
+# or save it as ~/.config/fish/completions/%[1]s.fish
+
+# The --config and --db-path given so far, for the live lists
+function __%[1]s_config_args
+    set -l tokens (commandline -opc)
+    for i in (seq 2 (math (count $tokens) - 1))
+        switch $tokens[$i]
+            case --config -config --db-path -db-path
+                echo $tokens[$i]
+                echo $tokens[(math $i + 1)]
+        end
+    end
+end
+
+function __%[1]s_list
+    %[1]s completion list $argv[1] (__%[1]s_config_args) 2>/dev/null
+end
+
+complete -c %[1]s -f
+`, completionCommand)
+
+	for _, s := range subcommands {
+		fmt.Fprintf(w, "complete -c %s -n __fish_use_subcommand -a %s -d '%s'\n", completionCommand, s.name, fishQuote(s.help))
+	}
+	fmt.Fprintf(w, `complete -c %[1]s -n '__fish_seen_subcommand_from auth; and not __fish_seen_subcommand_from set delete status' -a 'set delete status'
+complete -c %[1]s -n '__fish_seen_subcommand_from auth; and __fish_seen_subcommand_from set delete' -a '%[2]s'
+complete -c %[1]s -n '__fish_seen_subcommand_from usage' -l since -x -d 'Report window, e.g. 30d, 12h or 0 for all time'
+complete -c %[1]s -n '__fish_seen_subcommand_from usage' -l db-path -r -F -d 'Path to the SQLite database'
+complete -c %[1]s -n '__fish_seen_subcommand_from completion' -a 'bash zsh fish'
+complete -c %[1]s -n '__fish_seen_subcommand_from ingest' -F
+complete -c %[1]s -n '__fish_seen_subcommand_from kb; and not __fish_seen_subcommand_from create add list stats rerank delete' -a 'create add list stats rerank delete'
+complete -c %[1]s -n '__fish_seen_subcommand_from kb; and __fish_seen_subcommand_from add' -F
+complete -c %[1]s -n '__fish_seen_subcommand_from kb; and __fish_seen_subcommand_from create list stats rerank delete' -l db-path -r -F -d 'Path to the SQLite database'
+`, completionCommand, strings.Join(apiKeyBackends(), " "))
+	for _, s := range subcommands {
+		if actions, ok := actionArgs[s.name]; ok {
+			words := strings.Join(actions, " ")
+			fmt.Fprintf(w, "complete -c %[1]s -n '__fish_seen_subcommand_from %[2]s; and not __fish_seen_subcommand_from %[3]s' -a '%[3]s'\n", completionCommand, s.name, words)
+		}
+		if _, ok := fileArgs[s.name]; ok {
+			fmt.Fprintf(w, "complete -c %s -n '__fish_seen_subcommand_from %s' -F\n", completionCommand, s.name)
+		}
+		if sessionArgs[s.name] {
+			fmt.Fprintf(w, "complete -c %[1]s -n '__fish_seen_subcommand_from %[2]s' -a '(__%[1]s_list sessions)'\n", completionCommand, s.name)
+		}
+		for _, spec := range own[s.name] {
+			fmt.Fprintf(w, "complete -c %s -n '__fish_seen_subcommand_from %s' -l %s%s -d '%s'\n", completionCommand, s.name, spec.name, fishValues(spec), fishQuote(spec.usage))
+		}
+	}
+
+	chat := fmt.Sprintf("'not __fish_seen_subcommand_from %s'", strings.Join(names, " "))
+	for _, spec := range specs {
+		option := "-l " + spec.name
+		if len(spec.name) == 1 {
+			option = "-o " + spec.name
+		}
+		fmt.Fprintf(w, "complete -c %s -n %s %s%s -d '%s'\n", completionCommand, chat, option, fishValues(spec), fishQuote(spec.usage))
+	}
+}
+
+// apiKeyBackends returns the backends "extrachat auth" manages, sorted
+func apiKeyBackends() []string {
+	backends := make([]string, 0, len(config.APIKeyEnvVars))
+	for backend := range config.APIKeyEnvVars {
+		backends = append(backends, backend)
+	}
+	sort.Strings(backends)
+	return backends
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"ExtraChat/internal/chatbot"
+	"ExtraChat/internal/config"
+	"ExtraChat/internal/eval"
+)
+
+const evalUsage = "usage: extrachat eval [flags] <suite.yaml>"
+
+// evalOptions are the flags "extrachat eval" takes on top of the chat flags
+type evalOptions struct {
+	backends string
+}
+
+// define registers the eval flags
+func (o *evalOptions) define(fs *flag.FlagSet) {
+	fs.StringVar(&o.backends, "backends", "", "Comma-separated models to run the suite on, as aliases, backends or backend/model (default: the suite's backends, or --backend)")
+}
+
+// runEvalSuite handles "extrachat eval", which runs a suite of prompts with
+// assertions across models and scores them. Flags may come before or after
+// the file.
+func runEvalSuite(args []string, envFileVars []config.EnvFileVar) error {
+	var opts evalOptions
+	var fs *flag.FlagSet
+	define := func(f *flag.FlagSet) {
+		fs = f
+		opts.define(f)
+	}
+	cfg, err := loadConfig(args, flag.ExitOnError, define)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() > 1 {
+		// Parse again with the flags after the file moved in front of it
+		parsed := len(args) - fs.NArg()
+		reordered := append(append(args[:parsed:parsed], fs.Args()[1:]...), fs.Arg(0))
+		if cfg, err = loadConfig(reordered, flag.ExitOnError, define); err != nil {
+			return err
+		}
+	}
+	if fs.NArg() != 1 {
+		return errors.New(evalUsage)
+	}
+	cfg.EnvFileVars = envFileVars
+
+	suite, err := eval.Load(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	var targets []string
+	for _, ref := range strings.Split(opts.backends, ",") {
+		if ref = strings.TrimSpace(ref); ref != "" {
+			targets = append(targets, ref)
+		}
+	}
+
+	bot, err := chatbot.NewChatBot(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to initialize chatbot: %w", err)
+	}
+	defer bot.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return bot.RunEval(ctx, os.Stdout, os.Stderr, suite, targets)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"ExtraChat/internal/chatbot"
+	"ExtraChat/internal/config"
+	"ExtraChat/internal/dataset"
+)
+
+const exportUsage = "usage: extrachat export [flags] --format sharegpt|openai-ft <session-id>... | --all"
+
+// exportOptions are the flags "extrachat export" takes on top of the chat
+// flags
+type exportOptions struct {
+	format   string
+	tools    string
+	roles    string
+	out      string
+	all      bool
+	noSystem bool
+}
+
+// define registers the export flags
+func (o *exportOptions) define(fs *flag.FlagSet) {
+	fs.StringVar(&o.format, "format", dataset.FormatShareGPT, "Dataset format: "+strings.Join(dataset.Formats, " or "))
+	fs.StringVar(&o.tools, "tools", chatbot.ExportToolsOmit, "Tool calls: omit, or include them with their results from the audit log")
+	fs.StringVar(&o.roles, "roles", "", "Role names overriding the format's, as role=name,... for roles "+strings.Join(dataset.SourceRoles, ", "))
+	fs.StringVar(&o.out, "out", "", "JSONL file to write instead of stdout")
+	fs.BoolVar(&o.all, "all", false, "Export every session")
+	fs.BoolVar(&o.noSystem, "no-system", false, "Leave out system prompts")
+}
+
+// runExport handles "extrachat export", which writes saved sessions as a
+// fine-tuning dataset. Flags may come before, between or after the session
+// IDs.
+func runExport(args []string, envFileVars []config.EnvFileVar) error {
+	var opts exportOptions
+	var fs *flag.FlagSet
+	define := func(f *flag.FlagSet) {
+		fs = f
+		opts.define(f)
+	}
+	var ids []string
+	for {
+		cfg, err := loadConfig(args, flag.ExitOnError, define)
+		if err != nil {
+			return err
+		}
+		rest := fs.Args()
+		next := 0
+		for next < len(rest) && !strings.HasPrefix(rest[next], "-") {
+			next++
+		}
+		ids = append(ids, rest[:next]...)
+		if next < len(rest) {
+			// Parse again from the flags after these session IDs
+			parsed := len(args) - len(rest)
+			args = append(args[:parsed:parsed], rest[next:]...)
+			continue
+		}
+		cfg.EnvFileVars = envFileVars
+		return export(cfg, opts, ids)
+	}
+}
+
+func export(cfg config.Config, opts exportOptions, ids []string) error {
+	if opts.all == (len(ids) > 0) {
+		return errors.New(exportUsage)
+	}
+	if cfg.SessionID != "" {
+		return errors.New("give the sessions to export as arguments, not with --session-id")
+	}
+	roles, err := dataset.ParseRoles(opts.roles)
+	if err != nil {
+		return err
+	}
+
+	bot, err := chatbot.NewChatBot(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to initialize chatbot: %w", err)
+	}
+	defer bot.Close()
+
+	var out io.Writer = os.Stdout
+	if opts.out != "" {
+		f, err := os.Create(opts.out)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", opts.out, err)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return bot.RunExport(ctx, out, os.Stderr, chatbot.ExportOptions{
+		SessionIDs: ids,
+		All:        opts.all,
+		Format:     opts.format,
+		Roles:      roles,
+		Tools:      opts.tools,
+		NoSystem:   opts.noSystem,
+	})
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"ExtraChat/internal/config"
+	"ExtraChat/internal/mcp"
+)
+
+// loadConfig builds the configuration from defaults, the config file,
+// EXTRACHAT_* environment variables and the command-line flags in args. It
+// runs at startup and again whenever the config file is reloaded. Subcommands
+// declare their own flags with extra.
+func loadConfig(args []string, errorHandling flag.ErrorHandling, extra ...func(fs *flag.FlagSet)) (config.Config, error) {
+	fs := flag.NewFlagSet(os.Args[0], errorHandling)
+
+	// Flag defaults come from config.Default; the config file is layered on
+	// top of them below, and explicitly set flags win over both
+	cfg := config.Default()
+	def := config.Default()
+	var raw rawFlags
+	defineFlags(fs, &cfg, &raw)
+	for _, define := range extra {
+		define(fs)
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return cfg, err
+	}
+
+	// Precedence: flags > EXTRACHAT_* environment > config file > defaults
+	explicit := make(map[string]string)
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = f.Value.String()
+	})
+	if _, ok := explicit["config"]; !ok {
+		raw.configFile = os.Getenv(config.EnvVarName("config"))
+	}
+	loaded, err := config.LoadFile(def, raw.configFile)
+	if err != nil {
+		return cfg, fmt.Errorf("failed to load config: %w", err)
+	}
+	cfg = loaded
+	var envErr error
+	fs.VisitAll(func(f *flag.Flag) {
+		value, ok := os.LookupEnv(config.EnvVarName(f.Name))
+		if !ok || f.Name == "config" || envErr != nil {
+			return
+		}
+		if err := fs.Set(f.Name, value); err != nil {
+			envErr = fmt.Errorf("invalid %s: %w", config.EnvVarName(f.Name), err)
+		}
+	})
+	if envErr != nil {
+		return cfg, envErr
+	}
+	for name, value := range explicit {
+		if err := fs.Set(name, value); err != nil {
+			return cfg, fmt.Errorf("invalid --%s: %w", name, err)
+		}
+	}
+
+	// --backend may name a model alias from the config file
+	if backendName, model, ok := cfg.ResolveAlias(cfg.Backend); ok {
+		cfg.Backend = backendName
+		cfg.SetModel(backendName, model)
+	}
+	if !config.ValidBackend(cfg.Backend) {
+		return cfg, fmt.Errorf("unknown backend: %s", cfg.Backend)
+	}
+
+	if cfg.SummarizerBackend != "" && !config.ValidBackend(cfg.SummarizerBackend) {
+		return cfg, fmt.Errorf("unknown summarizer backend: %s", cfg.SummarizerBackend)
+	}
+
+	if cfg.RecordDir != "" && cfg.ReplayDir != "" {
+		return cfg, fmt.Errorf("--record and --replay cannot be combined")
+	}
+
+	if cfg.MockLatency < 0 {
+		return cfg, fmt.Errorf("--mock-latency must not be negative")
+	}
+	if cfg.MockErrorPercent < 0 || cfg.MockErrorPercent > 100 {
+		return cfg, fmt.Errorf("--mock-error-percent must be from 0 to 100")
+	}
+
+	if cfg.HTTPTimeout < 0 || cfg.HTTPDialTimeout < 0 || cfg.HTTPTLSTimeout < 0 || cfg.HTTPHeaderTimeout < 0 || cfg.HTTPIdleTimeout < 0 {
+		return cfg, fmt.Errorf("--http-timeout, --http-dial-timeout, --http-tls-timeout, --http-header-timeout and --http-idle-timeout must not be negative")
+	}
+	if cfg.HTTPMaxIdleConns < 0 {
+		return cfg, fmt.Errorf("--http-max-idle-conns must not be negative")
+	}
+
+	if !config.ValidEmbedBackend(cfg.EmbedBackend) {
+		return cfg, fmt.Errorf("unknown embedding backend: %s (expected ollama or openai)", cfg.EmbedBackend)
+	}
+	if cfg.RAGTopK <= 0 || cfg.ChunkSize <= 0 {
+		return cfg, fmt.Errorf("--rag-top-k and --chunk-size must be positive")
+	}
+	if cfg.ChunkOverlap < 0 || cfg.ChunkOverlap >= cfg.ChunkSize {
+		return cfg, fmt.Errorf("--chunk-overlap must be at least 0 and less than --chunk-size")
+	}
+	if !config.ValidReranker(cfg.Rerank) {
+		return cfg, fmt.Errorf("unknown reranker: %s (expected %s)", cfg.Rerank, strings.Join(config.Rerankers, ", "))
+	}
+	if cfg.RerankCandidates <= 0 {
+		return cfg, fmt.Errorf("--rerank-candidates must be positive")
+	}
+
+	if cfg.RouterEnabled && len(cfg.RouterRules) == 0 {
+		return cfg, fmt.Errorf("--route needs rules under router in the config file")
+	}
+	if cfg.BestOfJudge != "" {
+		if _, _, err := cfg.ResolveRouteModel(cfg.BestOfJudge); err != nil {
+			return cfg, fmt.Errorf("invalid judge: %w", err)
+		}
+	}
+
+	if cfg.FetchMaxSize <= 0 {
+		return cfg, fmt.Errorf("--fetch-max-kb must be positive")
+	}
+
+	if cfg.AuditMaxSize < 0 || cfg.AuditMaxBackups < 0 || cfg.AuditMaxAge < 0 {
+		return cfg, fmt.Errorf("audit log rotation settings must not be negative")
+	}
+
+	if cfg.Output != config.OutputText && cfg.Output != config.OutputJSON {
+		return cfg, fmt.Errorf("unknown output format: %s (expected text or json)", cfg.Output)
+	}
+
+	if cfg.TUI && (cfg.Plain || cfg.Output == config.OutputJSON || cfg.Prompt != "") {
+		return cfg, fmt.Errorf("--tui can't be combined with --plain, --output json or --prompt")
+	}
+
+	if cfg.PageSize < 0 {
+		return cfg, fmt.Errorf("--page-size must not be negative")
+	}
+
+	if cfg.ContextMaxTokens <= 0 {
+		return cfg, fmt.Errorf("--context-max-tokens must be positive")
+	}
+
+	if _, err := config.ParseLogLevel(cfg.LogLevel); err != nil {
+		return cfg, err
+	}
+
+	if cfg.MCPStartupConcurrency <= 0 {
+		return cfg, fmt.Errorf("--mcp-startup-concurrency must be positive")
+	}
+	if cfg.MCPStartupTimeout <= 0 {
+		return cfg, fmt.Errorf("--mcp-startup-timeout must be positive")
+	}
+
+	if cfg.MCPLogLevel != "" && !mcp.ValidLogLevel(cfg.MCPLogLevel) {
+		return cfg, fmt.Errorf("unknown MCP log level: %s", cfg.MCPLogLevel)
+	}
+
+	if raw.noTelemetry {
+		cfg.TelemetryEnabled = false
+	}
+
+	if cfg.MCPConfigFile != "" || len(cfg.MCPServers) > 0 || cfg.BuiltinTools {
+		cfg.MCPEnabled = true
+	}
+
+	// Parse comma-separated MCP servers
+	if raw.mcpLocalServers != "" {
+		cfg.MCPLocalServers = strings.Split(raw.mcpLocalServers, ",")
+	}
+	if raw.mcpRemoteServers != "" {
+		cfg.MCPRemoteServers = strings.Split(raw.mcpRemoteServers, ",")
+	}
+	if raw.contextFiles != "" {
+		cfg.ContextFiles = strings.Split(raw.contextFiles, ",")
+	}
+	if raw.toolAutoApprove != "" {
+		cfg.ToolAutoApprove = strings.Split(raw.toolAutoApprove, ",")
+	}
+	if raw.stopSequences != "" {
+		cfg.StopSequences = strings.Split(raw.stopSequences, ",")
+		if err := config.ValidStopSequences(cfg.StopSequences); err != nil {
+			return cfg, fmt.Errorf("--stop-sequences: %w", err)
+		}
+	}
+	if raw.fetchAllow != "" {
+		cfg.FetchAllowedDomains = strings.Split(raw.fetchAllow, ",")
+	}
+	if raw.toolTimeouts != "" {
+		timeouts, err := config.ParseToolTimeouts(raw.toolTimeouts)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid --tool-timeouts: %w", err)
+		}
+		cfg.ToolTimeouts = timeouts
+	}
+
+	if raw.toolTiers != "" {
+		tiers, err := config.ParseToolTiers(raw.toolTiers)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid --tool-tiers: %w", err)
+		}
+		cfg.ToolTiers = tiers
+	}
+
+	if raw.tierPolicies != "" {
+		policies, err := config.ParseTierPolicies(raw.tierPolicies)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid --tier-policies: %w", err)
+		}
+		cfg.TierPolicies = policies
+	}
+
+	return cfg, nil
+}
+
+// rawFlags holds flags that are converted before they are stored in the
+// config, and flags that are not settings at all
+type rawFlags struct {
+	configFile       string
+	mcpLocalServers  string
+	mcpRemoteServers string
+	toolAutoApprove  string
+	toolTimeouts     string
+	toolTiers        string
+	tierPolicies     string
+	fetchAllow       string
+	stopSequences    string
+	noTelemetry      bool
+	contextFiles     string
+}
+
+// defineFlags declares the command-line flags on fs, bound to cfg and raw
+func defineFlags(fs *flag.FlagSet, cfg *config.Config, raw *rawFlags) {
+	def := config.Default()
+
+	fs.StringVar(&raw.configFile, "config", "", "Config file (default: ~/.config/extrachat/config.yaml if it exists)")
+	fs.StringVar(&cfg.Backend, "backend", def.Backend, "LLM backend (ollama|anthropic|grok|openai|mock) or a model alias from the config file")
+	fs.StringVar(&cfg.SessionID, "session-id", "", "Load existing session by ID")
+	fs.StringVar(&cfg.Prompt, "prompt", "", "Send this prompt, print the reply and exit; piped stdin is sent as context")
+	fs.StringVar(&cfg.Prompt, "p", "", "Shorthand for --prompt")
+	fs.StringVar(&raw.contextFiles, "file", "", "Comma-separated files to send as context with the first prompt")
+	fs.IntVar(&cfg.ContextMaxTokens, "context-max-tokens", def.ContextMaxTokens, "Maximum estimated tokens of context from --file and stdin")
+	fs.BoolVar(&cfg.Debug, "debug", false, "Enable debug logging (same as --log-level debug)")
+	fs.StringVar(&cfg.LogLevel, "log-level", def.LogLevel, "Application log level (debug|info|warn|error)")
+	fs.BoolVar(&cfg.SkipStartupChecks, "skip-startup-checks", false, "Don't check the backend's API key, endpoint and model at startup")
+	fs.StringVar(&cfg.RecordDir, "record", "", "Record backend HTTP traffic to sanitized cassettes in this directory")
+	fs.StringVar(&cfg.ReplayDir, "replay", "", "Replay backend HTTP traffic from the cassettes in this directory instead of sending it")
+	fs.BoolVar(&cfg.Plain, "plain", false, "Plain append-only output (no colors, spinners, markdown or streaming re-renders)")
+	fs.BoolVar(&cfg.TUI, "tui", false, "Full-screen interface with a session sidebar, scrollable conversation and status bar")
+	fs.StringVar(&cfg.Output, "output", def.Output, "Output format: text, or json for one record per turn on stdout (everything else goes to stderr)")
+	fs.DurationVar(&cfg.NotifyAfter, "notify-after", def.NotifyAfter, "Show a desktop notification when a reply or /async job takes longer than this (0 disables)")
+	fs.StringVar(&cfg.OllamaModel, "ollama-model", def.OllamaModel, "Ollama model specification (format: model:version)")
+	fs.StringVar(&cfg.AnthropicModel, "anthropic-model", def.AnthropicModel, "Anthropic model ID")
+	fs.StringVar(&cfg.GrokModel, "grok-model", def.GrokModel, "Grok model ID")
+	fs.StringVar(&cfg.OpenAIModel, "openai-model", def.OpenAIModel, "OpenAI model ID")
+	fs.StringVar(&cfg.MockModel, "mock-model", def.MockModel, "Model name the mock backend reports")
+	fs.StringVar(&raw.stopSequences, "stop-sequences", "", "Comma-separated sequences that end a reply, at most 4 (default: none)")
+	fs.StringVar(&cfg.OllamaURL, "ollama-url", def.OllamaURL, "Ollama API base URL")
+	fs.StringVar(&cfg.AnthropicURL, "anthropic-url", def.AnthropicURL, "Anthropic API base URL")
+	fs.StringVar(&cfg.GrokURL, "grok-url", def.GrokURL, "Grok API base URL")
+	fs.StringVar(&cfg.OpenAIURL, "openai-url", def.OpenAIURL, "OpenAI API base URL")
+	fs.StringVar(&cfg.CohereURL, "cohere-url", def.CohereURL, "Cohere rerank API base URL")
+	fs.StringVar(&cfg.VoyageURL, "voyage-url", def.VoyageURL, "Voyage AI rerank API base URL")
+
+	// Mock backend flags
+	fs.StringVar(&cfg.MockFixtures, "mock-fixtures", "", "YAML file of canned and scripted replies for the mock backend (default: echo the prompt)")
+	fs.DurationVar(&cfg.MockLatency, "mock-latency", 0, "Delay before each mock backend reply")
+	fs.IntVar(&cfg.MockErrorPercent, "mock-error-percent", 0, "Percentage of mock backend requests failing with a 503")
+
+	// HTTP connection flags
+	fs.DurationVar(&cfg.HTTPTimeout, "http-timeout", def.HTTPTimeout, "Overall timeout of an API request that isn't streamed (0 disables)")
+	fs.DurationVar(&cfg.HTTPDialTimeout, "http-dial-timeout", def.HTTPDialTimeout, "Timeout for opening a connection to an API")
+	fs.DurationVar(&cfg.HTTPTLSTimeout, "http-tls-timeout", def.HTTPTLSTimeout, "Timeout for the TLS handshake with an API")
+	fs.DurationVar(&cfg.HTTPHeaderTimeout, "http-header-timeout", def.HTTPHeaderTimeout, "Timeout for an API's response headers, streamed replies included (default: --http-timeout)")
+	fs.DurationVar(&cfg.HTTPIdleTimeout, "http-idle-timeout", def.HTTPIdleTimeout, "How long an idle keep-alive connection stays open")
+	fs.IntVar(&cfg.HTTPMaxIdleConns, "http-max-idle-conns", def.HTTPMaxIdleConns, "Idle keep-alive connections kept per API host")
+
+	// Storage flags
+	fs.StringVar(&cfg.DBPath, "db-path", def.DBPath, "SQLite database file")
+	fs.IntVar(&cfg.PageSize, "page-size", def.PageSize, "Most recent messages loaded with a session; older ones are read on demand (0 loads all)")
+	fs.StringVar(&cfg.LogDir, "log-dir", def.LogDir, "Directory for logs, traces and metrics")
+	fs.StringVar(&cfg.PprofAddr, "pprof-addr", "", "Serve net/http/pprof on this address, e.g. localhost:6060 (disabled if empty)")
+	fs.BoolVar(&raw.noTelemetry, "no-telemetry", false, "Don't set up tracing and metrics (faster startup, no trace or metric files)")
+	fs.BoolVar(&cfg.CacheEnabled, "cache", def.CacheEnabled, "Reuse responses for identical conversations")
+	fs.DurationVar(&cfg.CacheTTL, "cache-ttl", def.CacheTTL, "How long a cached response stays valid (0 never expires)")
+
+	// Background job flags
+	fs.StringVar(&cfg.SummarizerBackend, "summarizer-backend", "", "Backend for background jobs like titling and summarization (default: interactive backend)")
+	fs.StringVar(&cfg.SummarizerModel, "summarizer-model", "", "Model for background jobs (default: the summarizer backend's model)")
+	fs.BoolVar(&cfg.AutoTitle, "auto-title", false, "Generate a session title after the first exchange")
+
+	// Routing flags
+	fs.BoolVar(&cfg.RouterEnabled, "route", false, "Send each prompt to the cheapest adequate model of the router rules in the config file")
+
+	// Best-of-N flags
+	fs.StringVar(&cfg.BestOfJudge, "judge", "", "Model that picks the best of the /bestof replies, as an alias, backend or backend/model (default: you pick)")
+	fs.BoolVar(&cfg.SecretScan, "secret-scan", false, "Look for API keys, private keys and card numbers in prompts to cloud backends and offer to redact them")
+
+	// Retrieval flags
+	fs.BoolVar(&cfg.RAGEnabled, "rag", false, "Send the ingested document chunks most relevant to each prompt with it")
+	fs.StringVar(&cfg.EmbedBackend, "embed-backend", def.EmbedBackend, "Backend computing embeddings for ingest and retrieval (ollama|openai)")
+	fs.StringVar(&cfg.EmbedModel, "embed-model", "", "Embedding model (default: nomic-embed-text on ollama, text-embedding-3-small on openai)")
+	fs.IntVar(&cfg.RAGTopK, "rag-top-k", def.RAGTopK, "Document chunks sent with each prompt")
+	fs.IntVar(&cfg.ChunkSize, "chunk-size", def.ChunkSize, "Characters per document chunk when ingesting")
+	fs.IntVar(&cfg.ChunkOverlap, "chunk-overlap", def.ChunkOverlap, "Characters repeated between consecutive chunks when ingesting")
+	fs.StringVar(&cfg.Rerank, "rerank", def.Rerank, "Re-rank retrieved chunks before sending the best (off|llm|cohere|voyage)")
+	fs.StringVar(&cfg.RerankModel, "rerank-model", "", "Rerank API model (default: rerank-v3.5 on cohere, rerank-2 on voyage)")
+	fs.IntVar(&cfg.RerankCandidates, "rerank-candidates", def.RerankCandidates, "Chunks vector search finds for the reranker to choose from")
+
+	// Web fetch flags
+	fs.StringVar(&raw.fetchAllow, "fetch-allow", "", "Comma-separated domains /fetch and fetch_url may download from, with their subdomains (default: any)")
+	fs.IntVar(&cfg.FetchMaxSize, "fetch-max-kb", def.FetchMaxSize, "Largest page /fetch and fetch_url download, in KB")
+	fs.BoolVar(&cfg.FetchAllowPrivate, "fetch-allow-private", false, "Let /fetch and fetch_url download from loopback, private and link-local addresses")
+
+	// Backup flags
+	fs.StringVar(&cfg.BackupDir, "backup-dir", "", "Directory for nightly database snapshots (disabled if empty)")
+	fs.IntVar(&cfg.BackupRetention, "backup-retention", def.BackupRetention, "Number of database snapshots to keep")
+	fs.StringVar(&cfg.BackupTime, "backup-time", def.BackupTime, "Local time of day for the nightly snapshot (HH:MM)")
+
+	// Audit log flags
+	fs.StringVar(&cfg.AuditLog, "audit-log", "", "JSONL file recording every prompt, response and tool call (disabled if empty)")
+	fs.IntVar(&cfg.AuditMaxSize, "audit-max-size", def.AuditMaxSize, "Size in MB at which the audit log is rotated")
+	fs.IntVar(&cfg.AuditMaxBackups, "audit-max-backups", def.AuditMaxBackups, "Rotated audit logs to keep (0 keeps all)")
+	fs.IntVar(&cfg.AuditMaxAge, "audit-max-age", def.AuditMaxAge, "Days to keep rotated audit logs (0 keeps them forever)")
+
+	// MCP flags
+	fs.BoolVar(&cfg.MCPEnabled, "mcp-enabled", false, "Enable MCP tool support")
+	fs.StringVar(&cfg.MCPConfigFile, "mcp-config", "", "MCP server config file (JSON or YAML with an mcpServers section); implies --mcp-enabled")
+	fs.StringVar(&raw.mcpLocalServers, "mcp-local", "", "Comma-separated paths to Python MCP servers (legacy, see --mcp-config)")
+	fs.StringVar(&raw.mcpRemoteServers, "mcp-remote", "", "Comma-separated URLs to remote MCP servers")
+	fs.IntVar(&cfg.MaxToolIterations, "max-tool-iterations", def.MaxToolIterations, "Maximum rounds of tool calls per turn")
+	fs.DurationVar(&cfg.ToolTimeout, "tool-timeout", def.ToolTimeout, "Timeout for a single MCP tool call")
+	fs.IntVar(&cfg.MCPStartupConcurrency, "mcp-startup-concurrency", def.MCPStartupConcurrency, "MCP servers initialized at once during startup")
+	fs.DurationVar(&cfg.MCPStartupTimeout, "mcp-startup-timeout", def.MCPStartupTimeout, "Overall deadline for initializing the MCP servers; servers still pending are skipped")
+	fs.StringVar(&raw.toolTimeouts, "tool-timeouts", "", "Comma-separated per-tool timeout overrides (e.g. build=10m,search=15s)")
+	fs.StringVar(&raw.toolTiers, "tool-tiers", "", "Comma-separated permission tiers of tools, overriding their servers' annotations (e.g. search=read,deploy=destructive)")
+	fs.StringVar(&raw.tierPolicies, "tier-policies", "", "Comma-separated policies of the tool tiers: allow, confirm or deny (e.g. read=allow,destructive=deny; default: confirm)")
+	fs.BoolVar(&cfg.BuiltinTools, "builtin-tools", false, "Enable the built-in read_file, write_file, run_command and fetch_url tools")
+	fs.StringVar(&cfg.SandboxRoot, "sandbox-root", def.SandboxRoot, "Directory the built-in file and command tools are confined to")
+	fs.StringVar(&cfg.MCPLogLevel, "mcp-log-level", "", "Minimum level of MCP server log messages (debug|info|notice|warning|error|critical|alert|emergency)")
+	fs.StringVar(&raw.toolAutoApprove, "tool-auto-approve", "", "Comma-separated MCP tool names that run without confirmation (\"*\" for all)")
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"ExtraChat/internal/config"
+)
+
+// isolateConfig keeps loadConfig away from the user's config file and
+// EXTRACHAT_* variables
+func isolateConfig(t *testing.T) {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	for _, name := range []string{"config", "backend", "ollama-model", "log-level"} {
+		t.Setenv(config.EnvVarName(name), "")
+		os.Unsetenv(config.EnvVarName(name))
+	}
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	isolateConfig(t)
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	file := "backend: openai\nmodels:\n  ollama: from-file:1\n  grok: from-file:2\ndebug: true\n"
+	if err := os.WriteFile(path, []byte(file), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(config.EnvVarName("ollama-model"), "from-env:1")
+	t.Setenv(config.EnvVarName("log-level"), "warn")
+
+	cfg, err := loadConfig([]string{"--config", path, "--log-level", "error"}, flag.ContinueOnError)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	def := config.Default()
+	tests := []struct {
+		setting   string
+		got, want string
+	}{
+		{"backend (file over default)", cfg.Backend, "openai"},
+		{"grok model (file over default)", cfg.GrokModel, "from-file:2"},
+		{"ollama model (environment over file)", cfg.OllamaModel, "from-env:1"},
+		{"log level (flag over environment)", cfg.LogLevel, "error"},
+		{"anthropic model (default)", cfg.AnthropicModel, def.AnthropicModel},
+		{"config file", cfg.ConfigFile, path},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.setting, tt.got, tt.want)
+		}
+	}
+	if !cfg.Debug {
+		t.Errorf("debug from the file was lost")
+	}
+}
+
+func TestLoadConfigFromEnvironment(t *testing.T) {
+	isolateConfig(t)
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("backend: grok\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// EXTRACHAT_CONFIG names the file when --config doesn't
+	t.Setenv(config.EnvVarName("config"), path)
+
+	cfg, err := loadConfig(nil, flag.ContinueOnError)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Backend != "grok" || cfg.ConfigFile != path {
+		t.Errorf("backend %q from %q, want grok from %q", cfg.Backend, cfg.ConfigFile, path)
+	}
+}
+
+func TestLoadConfigRejectsInvalidEnvironment(t *testing.T) {
+	isolateConfig(t)
+	t.Setenv(config.EnvVarName("tool-timeout"), "soon")
+	if _, err := loadConfig(nil, flag.ContinueOnError); err == nil {
+		t.Fatal("loadConfig accepted an invalid EXTRACHAT_TOOL_TIMEOUT")
+	}
+}
+
+func TestLoadConfigRejectsTUIWithLineOutput(t *testing.T) {
+	isolateConfig(t)
+	for _, args := range [][]string{
+		{"--tui", "--plain"},
+		{"--tui", "--output", "json"},
+		{"--tui", "--prompt", "hi"},
+	} {
+		if _, err := loadConfig(args, flag.ContinueOnError); err == nil {
+			t.Errorf("loadConfig accepted %q", args)
+		}
+	}
+	if _, err := loadConfig([]string{"--tui"}, flag.ContinueOnError); err != nil {
+		t.Errorf("loadConfig rejected --tui: %v", err)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"slices"
+	"syscall"
+
+	"ExtraChat/internal/chatbot"
+	"ExtraChat/internal/config"
+)
+
+const gitUsage = "usage: extrachat git commit-msg|pr-desc [flags]"
+
+// gitOptions are the flags "extrachat git" takes on top of the chat flags
+type gitOptions struct {
+	repo     string
+	base     string
+	hint     string
+	pipeline string
+	apply    bool
+}
+
+// define registers the git flags
+func (o *gitOptions) define(fs *flag.FlagSet) {
+	fs.StringVar(&o.repo, "repo", "", "Repository directory (default: the working directory)")
+	fs.StringVar(&o.base, "base", "", "pr-desc: branch the pull request merges into (default: origin's default branch, main or master)")
+	fs.StringVar(&o.hint, "hint", "", "Tell the model about the change, such as why it was made")
+	fs.StringVar(&o.pipeline, "pipeline", "", "Pipeline file to use instead of the built-in template; it gets the same variables")
+	fs.BoolVar(&o.apply, "apply", false, "commit-msg: commit the staged changes with the message; pr-desc: set the title and body of the branch's pull request with gh")
+}
+
+// runGit handles "extrachat git", which writes a conventional commit message
+// for the staged changes or a pull request description of the current
+// branch
+func runGit(args []string, envFileVars []config.EnvFileVar) error {
+	if len(args) == 0 || !slices.Contains(chatbot.GitModes, args[0]) {
+		return errors.New(gitUsage)
+	}
+	var opts gitOptions
+	var fs *flag.FlagSet
+	cfg, err := loadConfig(args[1:], flag.ExitOnError, func(f *flag.FlagSet) {
+		fs = f
+		opts.define(f)
+	})
+	if err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return errors.New(gitUsage)
+	}
+	if opts.base != "" && args[0] != chatbot.GitPRDesc {
+		return errors.New("--base applies to pr-desc")
+	}
+	cfg.EnvFileVars = envFileVars
+
+	bot, err := chatbot.NewChatBot(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to initialize chatbot: %w", err)
+	}
+	defer bot.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return bot.RunGit(ctx, os.Stdout, os.Stderr, chatbot.GitOptions{
+		Mode:     args[0],
+		Dir:      opts.repo,
+		Base:     opts.base,
+		Hint:     opts.hint,
+		Pipeline: opts.pipeline,
+		Apply:    opts.apply,
+	})
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"ExtraChat/internal/chatbot"
+	"ExtraChat/internal/config"
+)
+
+const ingestUsage = "usage: extrachat ingest [flags] <path|dir|glob>..."
+
+// runIngest handles "extrachat ingest", which chunks and embeds documents
+// for retrieval. It takes the chat flags, so --embed-backend, --chunk-size
+// and the like apply; they go before the paths.
+func runIngest(args []string, envFileVars []config.EnvFileVar) error {
+	return ingest(args, envFileVars, false)
+}
+
+// ingest embeds the documents named by the arguments left after the flags.
+// With intoCollection, the first of them names the collection to add the
+// documents to.
+func ingest(args []string, envFileVars []config.EnvFileVar, intoCollection bool) error {
+	usage := ingestUsage
+	if intoCollection {
+		usage = kbAddUsage
+	}
+
+	var fs *flag.FlagSet
+	cfg, err := loadConfig(args, flag.ExitOnError, func(f *flag.FlagSet) { fs = f })
+	if err != nil {
+		return err
+	}
+	cfg.EnvFileVars = envFileVars
+	patterns, collection := fs.Args(), ""
+	if intoCollection && len(patterns) > 0 {
+		collection, patterns = patterns[0], patterns[1:]
+	}
+	if len(patterns) == 0 {
+		return errors.New(usage)
+	}
+
+	bot, err := chatbot.NewChatBot(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to initialize chatbot: %w", err)
+	}
+	defer bot.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return bot.Ingest(ctx, os.Stdout, patterns, collection)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"os"
+
+	"ExtraChat/internal/chatbot"
+	"ExtraChat/internal/config"
+)
+
+const (
+	kbUsage    = "usage: extrachat kb create|stats|delete <collection> | extrachat kb list | extrachat kb rerank <collection> <off|llm|cohere|voyage|default> | extrachat kb add [flags] <collection> <path|dir|glob>..."
+	kbAddUsage = "usage: extrachat kb add [flags] <collection> <path|dir|glob>..."
+)
+
+// runKB handles "extrachat kb", which manages named knowledge collections.
+// "kb add" ingests like "extrachat ingest" and takes the same flags.
+func runKB(args []string, envFileVars []config.EnvFileVar) error {
+	if len(args) == 0 {
+		return errors.New(kbUsage)
+	}
+	if args[0] == "add" {
+		return ingest(args[1:], envFileVars, true)
+	}
+
+	// The database path follows the usual precedence of config file and env
+	cfg, err := loadConfig([]string{}, flag.ContinueOnError)
+	if err != nil {
+		return err
+	}
+
+	fs := flag.NewFlagSet("kb "+args[0], flag.ContinueOnError)
+	dbPath := fs.String("db-path", cfg.DBPath, "Path to the SQLite database")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	switch {
+	case args[0] == "list" && fs.NArg() == 0:
+	case (args[0] == "create" || args[0] == "stats" || args[0] == "delete") && fs.NArg() == 1:
+	case args[0] == "rerank" && fs.NArg() == 2:
+	default:
+		return errors.New(kbUsage)
+	}
+	return chatbot.RunKnowledgeBase(os.Stdout, *dbPath, args[0], fs.Args())
+}
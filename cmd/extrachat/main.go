@@ -8,41 +8,220 @@ import (
 
 	"ExtraChat/internal/chatbot"
 	"ExtraChat/internal/config"
+	"ExtraChat/internal/mcp"
 )
 
 func main() {
-	var cfg config.Config
-	var mcpLocalServers string
-	var mcpRemoteServers string
+	// A sandboxed MCP server starts as this executable, which confines
+	// itself and execs the server
+	mcp.SandboxMain()
 
-	flag.StringVar(&cfg.Backend, "backend", config.BackendOllama, "LLM backend (ollama|anthropic|grok|openai)")
-	flag.StringVar(&cfg.SessionID, "session-id", "", "Load existing session by ID")
-	flag.BoolVar(&cfg.Debug, "debug", false, "Enable debug logging")
-	flag.StringVar(&cfg.OllamaModel, "ollama-model", "llama3:latest", "Ollama model specification (format: model:version)")
+	// Per-project and per-user .env files; the real environment wins
+	envFileVars, err := config.LoadDotEnv(config.DotEnvPaths()...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: skipped .env file: %v\n", err)
+	}
+	var ignored []string
+	for _, v := range envFileVars {
+		if v.Ignored {
+			ignored = append(ignored, v.Name)
+		}
+	}
+	if len(ignored) > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: ignored %s from ./.env, which may only set API keys; use ~/.extrachat/.env or the environment\n",
+			strings.Join(ignored, ", "))
+	}
+
+	// "extrachat selftest" verifies the whole pipeline against local stubs
+	if len(os.Args) > 1 && os.Args[1] == "selftest" {
+		if err := chatbot.RunSelfTest(os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "Selftest failed: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// "extrachat auth" manages API keys in the OS keyring
+	if len(os.Args) > 1 && os.Args[1] == "auth" {
+		if err := runAuth(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// "extrachat usage" reports token usage and cost across sessions
+	if len(os.Args) > 1 && os.Args[1] == "usage" {
+		if err := runUsage(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// "extrachat completion" prints a shell completion script
+	if len(os.Args) > 1 && os.Args[1] == "completion" {
+		if err := runCompletion(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
 
-	// MCP flags
-	flag.BoolVar(&cfg.MCPEnabled, "mcp-enabled", false, "Enable MCP tool support")
-	flag.StringVar(&mcpLocalServers, "mcp-local", "", "Comma-separated paths to Python MCP servers")
-	flag.StringVar(&mcpRemoteServers, "mcp-remote", "", "Comma-separated URLs to remote MCP servers")
+	// "extrachat serve" exposes sessions over a REST API
+	if len(os.Args) > 1 && os.Args[1] == "serve" {
+		if err := runServe(os.Args[2:], envFileVars); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// "extrachat ingest" embeds documents for retrieval
+	if len(os.Args) > 1 && os.Args[1] == "ingest" {
+		if err := runIngest(os.Args[2:], envFileVars); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// "extrachat batch" runs a file of prompts through the backend
+	if len(os.Args) > 1 && os.Args[1] == "batch" {
+		if err := runBatch(os.Args[2:], envFileVars); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// "extrachat run" runs a pipeline of templated prompts
+	if len(os.Args) > 1 && os.Args[1] == "run" {
+		if err := runPipeline(os.Args[2:], envFileVars); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// "extrachat agents" has personas take turns on a task
+	if len(os.Args) > 1 && os.Args[1] == "agents" {
+		if err := runAgents(os.Args[2:], envFileVars); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
 
-	flag.Parse()
+	// "extrachat replay" re-runs a session's user turns on another backend
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		if err := runReplay(os.Args[2:], envFileVars); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
 
-	// Parse comma-separated MCP servers
-	if mcpLocalServers != "" {
-		cfg.MCPLocalServers = strings.Split(mcpLocalServers, ",")
+	// "extrachat export" writes sessions as a fine-tuning dataset
+	if len(os.Args) > 1 && os.Args[1] == "export" {
+		if err := runExport(os.Args[2:], envFileVars); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
 	}
-	if mcpRemoteServers != "" {
-		cfg.MCPRemoteServers = strings.Split(mcpRemoteServers, ",")
+
+	// "extrachat git" writes commit messages and pull request descriptions
+	if len(os.Args) > 1 && os.Args[1] == "git" {
+		if err := runGit(os.Args[2:], envFileVars); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
 	}
 
+	// "extrachat review" reviews source files or a diff
+	if len(os.Args) > 1 && os.Args[1] == "review" {
+		if err := runReview(os.Args[2:], envFileVars); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// "extrachat eval" scores a suite of prompts across models
+	if len(os.Args) > 1 && os.Args[1] == "eval" {
+		if err := runEvalSuite(os.Args[2:], envFileVars); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// "extrachat kb" manages named collections of ingested documents
+	if len(os.Args) > 1 && os.Args[1] == "kb" {
+		if err := runKB(os.Args[2:], envFileVars); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	cfg, err := loadConfig(os.Args[1:], flag.ExitOnError)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	cfg.EnvFileVars = envFileVars
+
 	bot, err := chatbot.NewChatBot(cfg)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to initialize chatbot: %v\n", err)
 		os.Exit(1)
 	}
 
-	if err := bot.Run(); err != nil {
+	// The config file is re-read on SIGHUP or when it changes
+	bot.SetConfigLoader(func() (config.Config, error) {
+		return loadConfig(os.Args[1:], flag.ContinueOnError)
+	})
+
+	if err := attachContext(bot, cfg); err != nil {
+		bot.Close()
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
+
+	if cfg.Prompt != "" {
+		if err := bot.RunOnce(cfg.Prompt); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	run := bot.Run
+	if cfg.TUI {
+		run = bot.RunTUI
+	}
+	if err := run(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// attachContext reads the --file context and, when it's piped into a one-shot
+// prompt, stdin
+func attachContext(bot *chatbot.ChatBot, cfg config.Config) error {
+	for _, path := range cfg.ContextFiles {
+		if err := bot.AttachFile(path); err != nil {
+			return err
+		}
+	}
+	if cfg.Prompt == "" {
+		return nil
+	}
+	if info, err := os.Stdin.Stat(); err == nil && info.Mode()&os.ModeCharDevice == 0 {
+		return bot.Attach("stdin", os.Stdin)
+	}
+	return nil
 }
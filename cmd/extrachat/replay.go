@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"ExtraChat/internal/chatbot"
+	"ExtraChat/internal/config"
+)
+
+const replayUsage = "usage: extrachat replay <session-id> --backend <backend> [flags]"
+
+// replayOptions are the flags "extrachat replay" takes on top of the chat
+// flags
+type replayOptions struct {
+	originalHistory bool
+	width           int
+}
+
+// define registers the replay flags
+func (o *replayOptions) define(fs *flag.FlagSet) {
+	fs.BoolVar(&o.originalHistory, "original-history", false, "Send the original replies as history, so each turn differs only in its own reply")
+	fs.IntVar(&o.width, "width", 160, "Width of the side-by-side report")
+}
+
+// runReplay handles "extrachat replay", which sends the user turns of a
+// saved session to another backend and compares the replies. Flags may come
+// before or after the session ID.
+func runReplay(args []string, envFileVars []config.EnvFileVar) error {
+	var opts replayOptions
+	var fs *flag.FlagSet
+	define := func(f *flag.FlagSet) {
+		fs = f
+		opts.define(f)
+	}
+	cfg, err := loadConfig(args, flag.ExitOnError, define)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() > 1 {
+		// Parse again with the flags after the session ID moved in front of it
+		parsed := len(args) - fs.NArg()
+		reordered := append(append(args[:parsed:parsed], fs.Args()[1:]...), fs.Arg(0))
+		if cfg, err = loadConfig(reordered, flag.ExitOnError, define); err != nil {
+			return err
+		}
+	}
+	if fs.NArg() != 1 {
+		return errors.New(replayUsage)
+	}
+	if cfg.SessionID != "" {
+		return errors.New("give the session to replay as the argument, not with --session-id")
+	}
+	cfg.EnvFileVars = envFileVars
+
+	bot, err := chatbot.NewChatBot(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to initialize chatbot: %w", err)
+	}
+	defer bot.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return bot.RunReplay(ctx, os.Stdout, os.Stderr, chatbot.ReplayOptions{
+		SessionID:       fs.Arg(0),
+		Backend:         cfg.Backend,
+		OriginalHistory: opts.originalHistory,
+		Width:           opts.width,
+	})
+}
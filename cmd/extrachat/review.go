@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"ExtraChat/internal/chatbot"
+	"ExtraChat/internal/config"
+	"ExtraChat/internal/review"
+)
+
+const reviewUsage = "usage: extrachat review [flags] <file|dir|glob|file.diff|->..."
+
+// reviewOptions are the flags "extrachat review" takes on top of the chat
+// flags
+type reviewOptions struct {
+	focus       string
+	pipeline    string
+	chunkLines  int
+	concurrency int
+	failOn      string
+}
+
+// define registers the review flags
+func (o *reviewOptions) define(fs *flag.FlagSet) {
+	fs.StringVar(&o.focus, "focus", "", "Tell the model what to look for, such as security or error handling")
+	fs.StringVar(&o.pipeline, "pipeline", "", "Pipeline file to use instead of the built-in template; it gets the same variables")
+	fs.IntVar(&o.chunkLines, "chunk-lines", 300, "Most lines of a file or diff reviewed in one request")
+	fs.IntVar(&o.concurrency, "concurrency", 4, "Chunks reviewed at once")
+	fs.StringVar(&o.failOn, "fail-on", "", "Exit with an error when a finding is at least this severe: "+strings.Join(review.Severities, ", "))
+}
+
+// runReview handles "extrachat review", which reviews source files or a
+// unified diff and reports the findings by file and line. Flags may come
+// before, between or after the paths.
+func runReview(args []string, envFileVars []config.EnvFileVar) error {
+	var opts reviewOptions
+	var fs *flag.FlagSet
+	define := func(f *flag.FlagSet) {
+		fs = f
+		opts.define(f)
+	}
+	var paths []string
+	for {
+		cfg, err := loadConfig(args, flag.ExitOnError, define)
+		if err != nil {
+			return err
+		}
+		rest := fs.Args()
+		next := 0
+		for next < len(rest) && (rest[next] == "-" || !strings.HasPrefix(rest[next], "-")) {
+			next++
+		}
+		paths = append(paths, rest[:next]...)
+		if next < len(rest) {
+			// Parse again from the flags after these paths
+			parsed := len(args) - len(rest)
+			args = append(args[:parsed:parsed], rest[next:]...)
+			continue
+		}
+		cfg.EnvFileVars = envFileVars
+		return reviewPaths(cfg, opts, paths)
+	}
+}
+
+func reviewPaths(cfg config.Config, opts reviewOptions, paths []string) error {
+	if len(paths) == 0 {
+		return errors.New(reviewUsage)
+	}
+	if opts.failOn != "" && !review.ValidSeverity(opts.failOn) {
+		return fmt.Errorf("invalid --fail-on %q (expected %s)", opts.failOn, strings.Join(review.Severities, ", "))
+	}
+	if opts.chunkLines < 1 || opts.concurrency < 1 {
+		return errors.New("--chunk-lines and --concurrency must be at least 1")
+	}
+
+	bot, err := chatbot.NewChatBot(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to initialize chatbot: %w", err)
+	}
+	defer bot.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return bot.RunReview(ctx, os.Stdout, os.Stderr, chatbot.ReviewOptions{
+		Paths:       paths,
+		Stdin:       os.Stdin,
+		Focus:       opts.focus,
+		Pipeline:    opts.pipeline,
+		ChunkLines:  opts.chunkLines,
+		Concurrency: opts.concurrency,
+		FailOn:      opts.failOn,
+	})
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"ExtraChat/internal/chatbot"
+	"ExtraChat/internal/config"
+	"ExtraChat/internal/pipeline"
+)
+
+const pipelineUsage = "usage: extrachat run [flags] <pipeline.yaml> [--var name=value]..."
+
+// pipelineVars collects repeated --var name=value flags
+type pipelineVars map[string]string
+
+// String is empty: loadConfig sets explicit flags again from their String
+// value, and the variables are already collected by then
+func (v pipelineVars) String() string { return "" }
+
+func (v pipelineVars) Set(arg string) error {
+	if arg == "" {
+		return nil
+	}
+	name, value, err := pipeline.ParseVar(arg)
+	if err != nil {
+		return err
+	}
+	v[name] = value
+	return nil
+}
+
+// runOptions are the flags "extrachat run" takes on top of the chat flags
+type runOptions struct {
+	vars pipelineVars
+}
+
+// define registers the run flags
+func (o *runOptions) define(fs *flag.FlagSet) {
+	o.vars = make(pipelineVars)
+	fs.Var(o.vars, "var", "Pipeline variable as name=value (repeatable)")
+}
+
+// runPipeline handles "extrachat run", which runs a pipeline file. Flags may
+// come before or after the file.
+func runPipeline(args []string, envFileVars []config.EnvFileVar) error {
+	var opts runOptions
+	var fs *flag.FlagSet
+	define := func(f *flag.FlagSet) {
+		fs = f
+		opts.define(f)
+	}
+	cfg, err := loadConfig(args, flag.ExitOnError, define)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() > 1 {
+		// Parse again with the flags after the file moved in front of it
+		parsed := len(args) - fs.NArg()
+		reordered := append(append(args[:parsed:parsed], fs.Args()[1:]...), fs.Arg(0))
+		if cfg, err = loadConfig(reordered, flag.ExitOnError, define); err != nil {
+			return err
+		}
+	}
+	if fs.NArg() != 1 {
+		return errors.New(pipelineUsage)
+	}
+	cfg.EnvFileVars = envFileVars
+
+	p, err := pipeline.Load(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	bot, err := chatbot.NewChatBot(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to initialize chatbot: %w", err)
+	}
+	defer bot.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return bot.RunPipeline(ctx, os.Stdout, os.Stderr, p, opts.vars)
+}
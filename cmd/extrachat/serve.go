@@ -0,0 +1,42 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"ExtraChat/internal/chatbot"
+	"ExtraChat/internal/config"
+)
+
+// serveOptions are the flags "extrachat serve" takes on top of the chat flags
+type serveOptions struct {
+	addr  string
+	token string
+}
+
+// define registers the serve flags; EXTRACHAT_ADDR and EXTRACHAT_TOKEN set
+// them like any other flag
+func (o *serveOptions) define(fs *flag.FlagSet) {
+	fs.StringVar(&o.addr, "addr", "localhost:8080", "Address the API server listens on")
+	fs.StringVar(&o.token, "token", "", "Operator bearer token with access to all sessions (recommended off localhost)")
+}
+
+// runServe handles "extrachat serve", which exposes sessions over a REST API
+func runServe(args []string, envFileVars []config.EnvFileVar) error {
+	var opts serveOptions
+	cfg, err := loadConfig(args, flag.ExitOnError, opts.define)
+	if err != nil {
+		return err
+	}
+	cfg.EnvFileVars = envFileVars
+
+	bot, err := chatbot.NewChatBot(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to initialize chatbot: %w", err)
+	}
+	bot.SetConfigLoader(func() (config.Config, error) {
+		var reloaded serveOptions
+		return loadConfig(args, flag.ContinueOnError, reloaded.define)
+	})
+	return bot.Serve(opts.addr, opts.token)
+}
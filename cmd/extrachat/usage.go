@@ -0,0 +1,31 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	"ExtraChat/internal/chatbot"
+)
+
+// runUsage handles "extrachat usage", a token and cost report across all
+// sessions
+func runUsage(args []string) error {
+	// The database path follows the usual precedence of config file and env
+	cfg, err := loadConfig([]string{}, flag.ContinueOnError)
+	if err != nil {
+		return err
+	}
+
+	fs := flag.NewFlagSet("usage", flag.ContinueOnError)
+	since := fs.String("since", "30d", "Report window, e.g. 30d, 12h or 0 for all time")
+	dbPath := fs.String("db-path", cfg.DBPath, "Path to the SQLite database")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	window, err := chatbot.ParseSince(*since)
+	if err != nil {
+		return err
+	}
+	return chatbot.RunUsageReport(os.Stdout, *dbPath, window)
+}
@@ -0,0 +1,89 @@
+// Command mcp-testserver is a reference MCP server for testing MCP setups:
+// its tools echo, wait and fail as configured, over stdio or Streamable
+// HTTP.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+
+	"ExtraChat/internal/mcptest"
+)
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	fs := flag.NewFlagSet("mcp-testserver", flag.ContinueOnError)
+	transport := fs.String("transport", "stdio", "Transport to serve: stdio or http")
+	addr := fs.String("addr", "127.0.0.1:8931", "Listen address of the http transport")
+	configPath := fs.String("config", "", "YAML file of tools, latencies and failures (default: built-in tools)")
+	latency := fs.Duration("latency", 0, "Delay before every response, overriding the config file")
+	verbose := fs.Bool("verbose", false, "Log every request to stderr")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return errors.New("usage: mcp-testserver [--transport stdio|http] [--addr host:port] [--config file] [--latency d] [--verbose]")
+	}
+
+	// Logs go to stderr; stdout carries the protocol on stdio
+	level := slog.LevelInfo
+	if *verbose {
+		level = slog.LevelDebug
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+
+	cfg := mcptest.DefaultConfig()
+	if *configPath != "" {
+		var err error
+		if cfg, err = mcptest.LoadConfig(*configPath); err != nil {
+			return err
+		}
+	}
+	server, err := mcptest.New(cfg, logger)
+	if err != nil {
+		return err
+	}
+	if *latency > 0 {
+		server.SetLatency(*latency)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	switch *transport {
+	case "stdio":
+		err := server.ServeStdio(ctx, os.Stdin, os.Stdout)
+		if errors.Is(err, context.Canceled) {
+			return nil
+		}
+		return err
+	case "http":
+		httpServer := &http.Server{Addr: *addr, Handler: server.Handler(), ReadHeaderTimeout: 10 * time.Second}
+		go func() {
+			<-ctx.Done()
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			httpServer.Shutdown(shutdownCtx)
+		}()
+		logger.Info("serving MCP over Streamable HTTP", "url", "http://"+*addr+"/mcp")
+		if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			return fmt.Errorf("failed to serve: %w", err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown transport %q (use stdio or http)", *transport)
+	}
+}
@@ -0,0 +1,158 @@
+// Package audit writes the prompt/response audit log for compliance review:
+// one JSON object per line, rotated independently of the operational logs
+package audit
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	lumberjack "gopkg.in/natefinch/lumberjack.v2"
+)
+
+// Entry types
+const (
+	TypePrompt   = "prompt"
+	TypeResponse = "response"
+	TypeToolCall = "tool_call"
+)
+
+// Rotation controls when the audit log is rotated and how long old files
+// are kept; zero MaxBackups and MaxAgeDays keep every file
+type Rotation struct {
+	MaxSizeMB  int
+	MaxBackups int
+	MaxAgeDays int
+}
+
+// Entry is one line of the audit log
+type Entry struct {
+	Time      time.Time `json:"time"`
+	Type      string    `json:"type"`
+	SessionID string    `json:"session_id"`
+	Backend   string    `json:"backend,omitempty"`
+	Model     string    `json:"model,omitempty"`
+	Job       string    `json:"job,omitempty"` // Background job (e.g. "title"); empty for chat turns
+
+	// Prompts and responses
+	Content string `json:"content,omitempty"`
+	Cached  bool   `json:"cached,omitempty"`
+
+	// Tool calls
+	Server     string                 `json:"server,omitempty"`
+	Tool       string                 `json:"tool,omitempty"`
+	Arguments  map[string]interface{} `json:"arguments,omitempty"`
+	Result     interface{}            `json:"result,omitempty"`
+	DurationMs int64                  `json:"duration_ms,omitempty"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// Log appends entries to a rotated JSONL file. It is safe for concurrent use.
+type Log struct {
+	mu  sync.Mutex
+	out *lumberjack.Logger
+	enc *json.Encoder
+}
+
+// Open opens (or creates) the audit log at path. New files are only
+// readable by the owner since they hold full prompts and tool output.
+func Open(path string, rotation Rotation) (*Log, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create audit log directory: %w", err)
+	}
+	out := &lumberjack.Logger{
+		Filename:   path,
+		MaxSize:    rotation.MaxSizeMB,
+		MaxBackups: rotation.MaxBackups,
+		MaxAge:     rotation.MaxAgeDays,
+		Compress:   true,
+	}
+	return &Log{out: out, enc: json.NewEncoder(out)}, nil
+}
+
+// Write appends an entry, stamping it with the current time if unset
+func (l *Log) Write(entry Entry) error {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.enc.Encode(entry); err != nil {
+		return fmt.Errorf("failed to write audit entry: %w", err)
+	}
+	return nil
+}
+
+// Close closes the current log file
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.out.Close()
+}
+
+// Read calls fn with each entry of the log at path, oldest first, starting
+// with the rotated backups lumberjack keeps next to it. A missing log has no
+// entries; lines that aren't entries are skipped.
+func Read(path string, fn func(Entry) error) error {
+	ext := filepath.Ext(path)
+	backups, err := filepath.Glob(strings.TrimSuffix(path, ext) + "-*" + ext + "*")
+	if err != nil {
+		return fmt.Errorf("failed to list audit log backups: %w", err)
+	}
+	// Backup names end in their rotation time, so they sort oldest first
+	sort.Strings(backups)
+	for _, file := range append(backups, path) {
+		if err := readFile(file, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readFile(path string, fn func(Entry) error) error {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+	scanner := bufio.NewScanner(r)
+	// Tool results can make for long lines
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var entry Entry
+		if json.Unmarshal(scanner.Bytes(), &entry) != nil {
+			continue
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return nil
+}
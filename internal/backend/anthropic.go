@@ -1,29 +1,35 @@
 package backend
 
+import "encoding/json"
+
 // AnthropicRequest represents the request body for Anthropic API
 type AnthropicRequest struct {
-	Model     string                   `json:"model"`
-	MaxTokens int                      `json:"max_tokens"`
-	Messages  []AnthropicMessage       `json:"messages"`
-	Tools     []AnthropicTool          `json:"tools,omitempty"`
+	Model     string            `json:"model"`
+	MaxTokens int               `json:"max_tokens"`
+	System    string            `json:"system,omitempty"`
+	Messages  []json.RawMessage `json:"messages"` // Encoded AnthropicMessages
+	Tools     []AnthropicTool   `json:"tools,omitempty"`
+	Stream    bool              `json:"stream,omitempty"`
+
+	StopSequences []string `json:"stop_sequences,omitempty"`
 }
 
 // AnthropicMessage represents a message in the conversation
 type AnthropicMessage struct {
-	Role    string                 `json:"role"`
-	Content interface{}            `json:"content"` // Can be string or []AnthropicContent
+	Role    string      `json:"role"`
+	Content interface{} `json:"content"` // Can be string or []AnthropicContent
 }
 
 // AnthropicContent represents different content types (text, tool_use, tool_result)
 type AnthropicContent struct {
-	Type       string                 `json:"type"`
-	Text       string                 `json:"text,omitempty"`
-	ID         string                 `json:"id,omitempty"`          // For tool_use
-	Name       string                 `json:"name,omitempty"`        // For tool_use
-	Input      map[string]interface{} `json:"input,omitempty"`       // For tool_use
-	ToolUseID  string                 `json:"tool_use_id,omitempty"` // For tool_result
-	Content    interface{}            `json:"content,omitempty"`     // For tool_result (string or array)
-	IsError    bool                   `json:"is_error,omitempty"`    // For tool_result
+	Type      string                 `json:"type"`
+	Text      string                 `json:"text,omitempty"`
+	ID        string                 `json:"id,omitempty"`          // For tool_use
+	Name      string                 `json:"name,omitempty"`        // For tool_use
+	Input     map[string]interface{} `json:"input,omitempty"`       // For tool_use
+	ToolUseID string                 `json:"tool_use_id,omitempty"` // For tool_result
+	Content   interface{}            `json:"content,omitempty"`     // For tool_result (string or array)
+	IsError   bool                   `json:"is_error,omitempty"`    // For tool_result
 }
 
 // AnthropicTool represents a tool definition
@@ -44,3 +50,80 @@ type AnthropicResponse struct {
 	StopSequence string                 `json:"stop_sequence"`
 	Usage        map[string]interface{} `json:"usage"`
 }
+
+// AnthropicStreamEvent is one server-sent event of a streamed Messages API
+// response; which fields are set depends on Type
+type AnthropicStreamEvent struct {
+	Type         string            `json:"type"`
+	Message      AnthropicResponse `json:"message"`       // message_start
+	Index        int               `json:"index"`         // content_block_*
+	ContentBlock AnthropicContent  `json:"content_block"` // content_block_start
+	Delta        struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`         // text_delta
+		PartialJSON string `json:"partial_json"` // input_json_delta
+		StopReason  string `json:"stop_reason"`  // message_delta
+	} `json:"delta"`
+	Usage map[string]interface{} `json:"usage"` // message_delta
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// AnthropicBatchRequest represents the request body for creating a
+// Message Batch
+type AnthropicBatchRequest struct {
+	Requests []AnthropicBatchItem `json:"requests"`
+}
+
+// AnthropicBatchItem is one request of a Message Batch; CustomID matches
+// it to its result
+type AnthropicBatchItem struct {
+	CustomID string           `json:"custom_id"`
+	Params   AnthropicRequest `json:"params"`
+}
+
+// AnthropicBatch represents a Message Batch and how far it has got
+type AnthropicBatch struct {
+	ID               string `json:"id"`
+	ProcessingStatus string `json:"processing_status"` // in_progress, canceling or ended
+	RequestCounts    struct {
+		Processing int `json:"processing"`
+		Succeeded  int `json:"succeeded"`
+		Errored    int `json:"errored"`
+		Canceled   int `json:"canceled"`
+		Expired    int `json:"expired"`
+	} `json:"request_counts"`
+	ResultsURL string `json:"results_url"` // Set once the batch has ended
+}
+
+// AnthropicBatchResult is one line of a Message Batch's results
+type AnthropicBatchResult struct {
+	CustomID string `json:"custom_id"`
+	Result   struct {
+		Type    string            `json:"type"` // succeeded, errored, canceled or expired
+		Message AnthropicResponse `json:"message"`
+		Error   struct {
+			Error struct {
+				Type    string `json:"type"`
+				Message string `json:"message"`
+			} `json:"error"`
+		} `json:"error"`
+	} `json:"result"`
+}
+
+// AnthropicModelsResponse represents a page of the response from
+// /v1/models; LastID is the after_id of the next page
+type AnthropicModelsResponse struct {
+	Data    []AnthropicModel `json:"data"`
+	HasMore bool             `json:"has_more"`
+	LastID  string           `json:"last_id"`
+}
+
+// AnthropicModel is a model the Anthropic API offers
+type AnthropicModel struct {
+	ID          string `json:"id"`
+	DisplayName string `json:"display_name"`
+	CreatedAt   string `json:"created_at"`
+}
@@ -1,10 +1,18 @@
 package backend
 
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
 // OllamaRequest represents the request body for Ollama API
 type OllamaRequest struct {
-	Model    string              `json:"model"`
-	Messages []map[string]string `json:"messages"`
-	Stream   bool                `json:"stream"`
+	Model     string                 `json:"model"`
+	Messages  []json.RawMessage      `json:"messages"` // Encoded role/content objects
+	Stream    bool                   `json:"stream"`
+	Options   map[string]interface{} `json:"options,omitempty"`    // Generation options such as num_ctx and temperature
+	KeepAlive interface{}            `json:"keep_alive,omitempty"` // Duration string or seconds
 }
 
 // OllamaResponse represents the response from Ollama API
@@ -15,7 +23,10 @@ type OllamaResponse struct {
 		Role    string `json:"role"`
 		Content string `json:"content"`
 	} `json:"message"`
-	Done bool `json:"done"`
+	Done            bool   `json:"done"`
+	PromptEvalCount int64  `json:"prompt_eval_count"` // Prompt tokens
+	EvalCount       int64  `json:"eval_count"`        // Generated tokens
+	Error           string `json:"error,omitempty"`   // Set on a failed streamed response
 }
 
 // OllamaTagsResponse represents the response from Ollama /api/tags endpoint
@@ -30,3 +41,74 @@ type OllamaModel struct {
 	Size       int64  `json:"size"`
 	Digest     string `json:"digest"`
 }
+
+// OllamaEmbedRequest represents the request body for Ollama /api/embed
+type OllamaEmbedRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+// OllamaEmbedResponse represents the response from Ollama /api/embed, one
+// embedding per input
+type OllamaEmbedResponse struct {
+	Model           string      `json:"model"`
+	Embeddings      [][]float32 `json:"embeddings"`
+	PromptEvalCount int64       `json:"prompt_eval_count"`
+}
+
+// OllamaPullRequest represents the request body for Ollama /api/pull
+type OllamaPullRequest struct {
+	Model  string `json:"model"`
+	Stream bool   `json:"stream"`
+}
+
+// OllamaPullProgress is one line of a streamed /api/pull response. Layers
+// are reported as "pulling <digest>" with their byte counts; other steps
+// only have a status.
+type OllamaPullProgress struct {
+	Status    string `json:"status"`
+	Digest    string `json:"digest,omitempty"`
+	Total     int64  `json:"total,omitempty"`
+	Completed int64  `json:"completed,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// OllamaShowRequest represents the request body for Ollama /api/show
+type OllamaShowRequest struct {
+	Model string `json:"model"`
+}
+
+// OllamaShowResponse represents the response from Ollama /api/show
+type OllamaShowResponse struct {
+	Parameters string `json:"parameters"` // Modelfile PARAMETER lines, e.g. "num_ctx 4096"
+	Template   string `json:"template"`
+	Details    struct {
+		Format            string `json:"format"`
+		Family            string `json:"family"`
+		ParameterSize     string `json:"parameter_size"`
+		QuantizationLevel string `json:"quantization_level"`
+	} `json:"details"`
+	ModelInfo    map[string]interface{} `json:"model_info"` // GGUF metadata keyed like "llama.context_length"
+	Capabilities []string               `json:"capabilities"`
+}
+
+// ContextLength returns the context length the model was trained with, 0
+// when the metadata doesn't say
+func (r OllamaShowResponse) ContextLength() int {
+	arch, _ := r.ModelInfo["general.architecture"].(string)
+	n, _ := r.ModelInfo[arch+".context_length"].(float64)
+	return int(n)
+}
+
+// NumCtx returns the num_ctx the model's Modelfile sets, 0 when it sets
+// none
+func (r OllamaShowResponse) NumCtx() int {
+	for _, line := range strings.Split(r.Parameters, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == "num_ctx" {
+			n, _ := strconv.Atoi(fields[1])
+			return n
+		}
+	}
+	return 0
+}
@@ -1,24 +1,94 @@
 package backend
 
+import "encoding/json"
+
 // OpenAIRequest represents the request body for OpenAI-compatible APIs
 type OpenAIRequest struct {
-	Model    string              `json:"model"`
-	Messages []map[string]string `json:"messages"`
+	Model         string               `json:"model"`
+	Messages      []json.RawMessage    `json:"messages"` // Encoded role/content objects
+	Stream        bool                 `json:"stream,omitempty"`
+	StreamOptions *OpenAIStreamOptions `json:"stream_options,omitempty"`
+	Stop          []string             `json:"stop,omitempty"`
+}
+
+// OpenAIStreamOptions asks a streamed response to end with the token usage
+type OpenAIStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
 }
 
 // OpenAIResponse represents the response from OpenAI-compatible APIs
 type OpenAIResponse struct {
+	ID      string                 `json:"id"`
+	Object  string                 `json:"object"`
+	Created int64                  `json:"created"`
+	Model   string                 `json:"model"`
+	Choices []OpenAIChoice         `json:"choices"`
+	Usage   map[string]interface{} `json:"usage"`
+}
+
+// OpenAIChoice is a completion in a response, or its next piece in a
+// streamed chunk (Delta instead of Message)
+type OpenAIChoice struct {
+	Index        int           `json:"index"`
+	Message      OpenAIMessage `json:"message"`
+	Delta        OpenAIMessage `json:"delta"`
+	FinishReason string        `json:"finish_reason"`
+}
+
+// OpenAIMessage is the role and content of a completion
+type OpenAIMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// OpenAIEmbeddingRequest represents the request body for /v1/embeddings
+type OpenAIEmbeddingRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+// OpenAIEmbeddingResponse represents the response from /v1/embeddings
+type OpenAIEmbeddingResponse struct {
+	Model string                 `json:"model"`
+	Data  []OpenAIEmbedding      `json:"data"`
+	Usage map[string]interface{} `json:"usage"`
+}
+
+// OpenAIEmbedding is the embedding of the input at Index
+type OpenAIEmbedding struct {
+	Index     int       `json:"index"`
+	Embedding []float32 `json:"embedding"`
+}
+
+// OpenAIModerationRequest represents the request body for OpenAI's
+// /v1/moderations
+type OpenAIModerationRequest struct {
+	Model string `json:"model"`
+	Input string `json:"input"`
+}
+
+// OpenAIModerationResponse represents the response from OpenAI's
+// /v1/moderations, one result per input
+type OpenAIModerationResponse struct {
+	Results []OpenAIModerationResult `json:"results"`
+}
+
+// OpenAIModerationResult tells whether an input was flagged, and for which
+// categories
+type OpenAIModerationResult struct {
+	Flagged    bool            `json:"flagged"`
+	Categories map[string]bool `json:"categories"`
+}
+
+// OpenAIModelsResponse represents the response from /v1/models of OpenAI
+// and of the OpenAI-compatible Grok API
+type OpenAIModelsResponse struct {
+	Data []OpenAIModel `json:"data"`
+}
+
+// OpenAIModel is a model an OpenAI-compatible API offers
+type OpenAIModel struct {
 	ID      string `json:"id"`
-	Object  string `json:"object"`
 	Created int64  `json:"created"`
-	Model   string `json:"model"`
-	Choices []struct {
-		Index   int `json:"index"`
-		Message struct {
-			Role    string `json:"role"`
-			Content string `json:"content"`
-		} `json:"message"`
-		FinishReason string `json:"finish_reason"`
-	} `json:"choices"`
-	Usage map[string]interface{} `json:"usage"`
+	OwnedBy string `json:"owned_by"`
 }
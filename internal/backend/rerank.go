@@ -0,0 +1,35 @@
+package backend
+
+// CohereRerankRequest represents the request body for Cohere's /v2/rerank
+type CohereRerankRequest struct {
+	Model     string   `json:"model"`
+	Query     string   `json:"query"`
+	Documents []string `json:"documents"`
+	TopN      int      `json:"top_n,omitempty"`
+}
+
+// CohereRerankResponse represents the response from Cohere's /v2/rerank,
+// best result first
+type CohereRerankResponse struct {
+	Results []RerankResult `json:"results"`
+}
+
+// VoyageRerankRequest represents the request body for Voyage AI's /v1/rerank
+type VoyageRerankRequest struct {
+	Model     string   `json:"model"`
+	Query     string   `json:"query"`
+	Documents []string `json:"documents"`
+	TopK      int      `json:"top_k,omitempty"`
+}
+
+// VoyageRerankResponse represents the response from Voyage AI's /v1/rerank,
+// best result first
+type VoyageRerankResponse struct {
+	Data []RerankResult `json:"data"`
+}
+
+// RerankResult is the relevance of the document at Index to the query
+type RerankResult struct {
+	Index          int     `json:"index"`
+	RelevanceScore float64 `json:"relevance_score"`
+}
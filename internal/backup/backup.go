@@ -0,0 +1,202 @@
+package backup
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"ExtraChat/internal/clock"
+)
+
+// Snapshot files are named chatbot-<timestamp>.db so they sort by age
+const (
+	snapshotPrefix = "chatbot-"
+	snapshotSuffix = ".db"
+	snapshotLayout = "20060102-150405"
+)
+
+// Snapshot writes a consistent copy of db into dir and verifies it. The copy
+// only gets its final name once it passed the integrity check.
+func Snapshot(ctx context.Context, db *sql.DB, dir string, now time.Time) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	path := filepath.Join(dir, snapshotPrefix+now.Format(snapshotLayout)+snapshotSuffix)
+	tmpPath := path + ".tmp"
+	os.Remove(tmpPath)
+
+	// VACUUM INTO produces a compact, transactionally consistent copy
+	if _, err := db.ExecContext(ctx, "VACUUM INTO ?", tmpPath); err != nil {
+		os.Remove(tmpPath)
+		return "", fmt.Errorf("failed to snapshot database: %w", err)
+	}
+
+	if err := Verify(ctx, tmpPath); err != nil {
+		os.Remove(tmpPath)
+		return "", err
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return "", fmt.Errorf("failed to finalize snapshot: %w", err)
+	}
+	return path, nil
+}
+
+// Verify runs SQLite's integrity check against a snapshot file
+func Verify(ctx context.Context, path string) error {
+	db, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return fmt.Errorf("failed to open snapshot: %w", err)
+	}
+	defer db.Close()
+
+	var result string
+	if err := db.QueryRowContext(ctx, "PRAGMA integrity_check").Scan(&result); err != nil {
+		return fmt.Errorf("failed to verify snapshot: %w", err)
+	}
+	if result != "ok" {
+		return fmt.Errorf("snapshot %s failed integrity check: %s", path, result)
+	}
+	return nil
+}
+
+// List returns the snapshots in dir, oldest first
+func List(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read backup directory: %w", err)
+	}
+
+	var snapshots []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.Type().IsRegular() && strings.HasPrefix(name, snapshotPrefix) && strings.HasSuffix(name, snapshotSuffix) {
+			snapshots = append(snapshots, filepath.Join(dir, name))
+		}
+	}
+	sort.Strings(snapshots)
+	return snapshots, nil
+}
+
+// Prune deletes all but the newest keep snapshots in dir, returning the
+// removed paths
+func Prune(dir string, keep int) ([]string, error) {
+	snapshots, err := List(dir)
+	if err != nil {
+		return nil, err
+	}
+	if keep < 1 {
+		keep = 1
+	}
+	if len(snapshots) <= keep {
+		return nil, nil
+	}
+
+	var removed []string
+	for _, path := range snapshots[:len(snapshots)-keep] {
+		if err := os.Remove(path); err != nil {
+			return removed, fmt.Errorf("failed to remove old snapshot: %w", err)
+		}
+		removed = append(removed, path)
+	}
+	return removed, nil
+}
+
+// ParseTimeOfDay parses a daily schedule time in 24-hour "HH:MM" form
+func ParseTimeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q (expected HH:MM)", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Scheduler takes a verified snapshot once a day and rotates old ones
+type Scheduler struct {
+	db        *sql.DB
+	dir       string
+	retention int
+	at        time.Duration // Offset from local midnight
+	logger    *slog.Logger
+	clock     clock.Clock
+}
+
+// NewScheduler creates a scheduler that snapshots db into dir every day at
+// the given time of day, keeping the newest retention snapshots. c times
+// the runs; nil uses the wall clock.
+func NewScheduler(db *sql.DB, dir string, retention int, at time.Duration, logger *slog.Logger, c clock.Clock) *Scheduler {
+	return &Scheduler{
+		db:        db,
+		dir:       dir,
+		retention: retention,
+		at:        at,
+		logger:    logger,
+		clock:     clock.Or(c),
+	}
+}
+
+// Dir returns the directory snapshots are written to
+func (s *Scheduler) Dir() string {
+	return s.dir
+}
+
+// Run takes a snapshot at the scheduled time each day until ctx is done
+func (s *Scheduler) Run(ctx context.Context) {
+	for {
+		now := s.clock.Now()
+		next := s.nextRun(now)
+		s.logger.Info("next database backup scheduled", "at", next, "dir", s.dir)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.clock.After(next.Sub(now)):
+		}
+
+		if _, err := s.RunOnce(ctx); err != nil {
+			s.logger.Error("scheduled database backup failed", "error", err)
+		}
+	}
+}
+
+// RunOnce takes a snapshot now and prunes old ones
+func (s *Scheduler) RunOnce(ctx context.Context) (string, error) {
+	start := s.clock.Now()
+	path, err := Snapshot(ctx, s.db, s.dir, start)
+	if err != nil {
+		return "", err
+	}
+	s.logger.Info("database backup written", "path", path, "duration", s.clock.Now().Sub(start))
+
+	removed, err := Prune(s.dir, s.retention)
+	if err != nil {
+		return path, fmt.Errorf("backup written but rotation failed: %w", err)
+	}
+	for _, old := range removed {
+		s.logger.Info("removed old database backup", "path", old)
+	}
+	return path, nil
+}
+
+// nextRun returns the first scheduled time strictly after now
+func (s *Scheduler) nextRun(now time.Time) time.Time {
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	next := midnight.Add(s.at)
+	if !next.After(now) {
+		next = midnight.AddDate(0, 0, 1).Add(s.at)
+	}
+	return next
+}
@@ -0,0 +1,82 @@
+package backup
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ExtraChat/internal/clock"
+)
+
+func TestNextRun(t *testing.T) {
+	s := NewScheduler(nil, "", 1, 3*time.Hour, slog.New(slog.NewTextHandler(io.Discard, nil)), nil)
+	day := time.Date(2026, time.March, 10, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		now, want time.Time
+	}{
+		{day.Add(time.Hour), day.Add(3 * time.Hour)},
+		{day.Add(3 * time.Hour), day.AddDate(0, 0, 1).Add(3 * time.Hour)},
+		{day.Add(23 * time.Hour), day.AddDate(0, 0, 1).Add(3 * time.Hour)},
+	}
+	for _, tt := range tests {
+		if got := s.nextRun(tt.now); !got.Equal(tt.want) {
+			t.Errorf("nextRun(%v) = %v, want %v", tt.now, got, tt.want)
+		}
+	}
+}
+
+func TestSchedulerRunsDailyAndPrunes(t *testing.T) {
+	dir := t.TempDir()
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "chatbot.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec("CREATE TABLE notes (text TEXT); INSERT INTO notes VALUES ('kept')"); err != nil {
+		t.Fatal(err)
+	}
+
+	clk := clock.NewFake(time.Date(2026, time.March, 10, 1, 0, 0, 0, time.Local))
+	backups := filepath.Join(dir, "backups")
+	s := NewScheduler(db, backups, 2, 3*time.Hour, slog.New(slog.NewTextHandler(io.Discard, nil)), clk)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.Run(ctx)
+	}()
+
+	// Three nights: the first wait is until 03:00, then a day each
+	for night, want := range []time.Duration{2 * time.Hour, 24 * time.Hour, 24 * time.Hour} {
+		clk.BlockUntil(1)
+		if wait := clk.Pending()[0]; wait != want {
+			t.Fatalf("night %d: waited %s, want %s", night+1, wait, want)
+		}
+		clk.Advance(want)
+	}
+	// The third snapshot is written once the scheduler waits again
+	clk.BlockUntil(1)
+	cancel()
+	<-done
+
+	snapshots, err := List(backups)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != 2 {
+		t.Fatalf("kept %d snapshots, want 2: %v", len(snapshots), snapshots)
+	}
+	if want := "chatbot-20260312-030000.db"; filepath.Base(snapshots[1]) != want {
+		t.Errorf("newest snapshot %s, want %s", filepath.Base(snapshots[1]), want)
+	}
+	for _, path := range snapshots {
+		if err := Verify(context.Background(), path); err != nil {
+			t.Error(err)
+		}
+	}
+}
@@ -0,0 +1,329 @@
+package chatbot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+
+	"ExtraChat/internal/cache"
+	"ExtraChat/internal/config"
+	"ExtraChat/internal/session"
+)
+
+// AgentOptions controls a multi-agent conversation
+type AgentOptions struct {
+	Task      string   // What the agents work on; the first message of the transcript
+	Agents    []string // Personas taking turns in order, each as name or name=model
+	Moderator string   // Persona that decides after each round whether to stop; empty for none
+	Turns     int      // Most agent replies
+	Stop      string   // Phrase with which an agent or the moderator ends the conversation
+}
+
+// moderatorSpeaker is the speaker of the moderator's messages in the
+// transcript
+const moderatorSpeaker = "moderator"
+
+// agentInstructions is appended to each agent's persona system prompt
+const agentInstructions = "You are %s, working with %s on the task the user gives. " +
+	"Take turns: build on, question or correct what the others said (their messages start with their names), " +
+	"and keep each reply short. When the task is complete, end your reply with %s."
+
+// moderatorInstructions is appended to the moderator's persona system prompt
+const moderatorInstructions = "You moderate a conversation between %s working on a task. " +
+	"Reply with %s alone if the task is complete or the conversation is going nowhere; " +
+	"otherwise give them one or two sentences of direction for the next round."
+
+// moderatorPrompt shows the moderator the task and the conversation so far
+const moderatorPrompt = "Task: %s\n\nConversation so far:\n%s"
+
+// agent is a persona taking part in a conversation
+type agent struct {
+	name   string
+	target llmTarget
+}
+
+// agentsRecord is the JSON written for a conversation with --output json
+type agentsRecord struct {
+	SessionID string            `json:"session_id"`
+	Task      string            `json:"task"`
+	Turns     []agentTurnRecord `json:"turns"`
+	Stopped   string            `json:"stopped"` // Why the conversation ended
+	Error     string            `json:"error,omitempty"`
+	LatencyMS int64             `json:"latency_ms"`
+	TraceID   string            `json:"trace_id"`
+}
+
+// agentTurnRecord is a reply of an agent or the moderator
+type agentTurnRecord struct {
+	Speaker   string    `json:"speaker"`
+	Backend   string    `json:"backend"`
+	Model     string    `json:"model"`
+	Response  string    `json:"response"`
+	Cached    bool      `json:"cached"`
+	Usage     turnUsage `json:"usage"`
+	LatencyMS int64     `json:"latency_ms"`
+}
+
+// RunAgents has the personas of opts take turns on a task until one of them
+// or the moderator says the stop phrase, or opts.Turns replies are in. The
+// transcript is saved as a new session, which becomes the current one, after
+// every reply. Replies go to out as they come, or with JSON output a record
+// of the whole conversation; the outcome and the session ID go to progress.
+func (cb *ChatBot) RunAgents(ctx context.Context, out, progress io.Writer, opts AgentOptions) error {
+	if len(opts.Agents) < 2 {
+		return errors.New("a conversation needs at least two agents")
+	}
+	agents := make([]agent, len(opts.Agents))
+	names := make([]string, len(opts.Agents))
+	for i, spec := range opts.Agents {
+		a, err := cb.resolveAgent(spec)
+		if err != nil {
+			return err
+		}
+		for _, name := range names[:i] {
+			if name == a.name {
+				return fmt.Errorf("agent %s is listed twice", a.name)
+			}
+		}
+		if a.name == moderatorSpeaker {
+			return fmt.Errorf("%s is the speaker name of the moderator and cannot be an agent", moderatorSpeaker)
+		}
+		agents[i], names[i] = a, a.name
+	}
+	for i := range agents {
+		others := make([]string, 0, len(names)-1)
+		others = append(append(others, names[:i]...), names[i+1:]...)
+		agents[i].target.System += "\n\n" + fmt.Sprintf(agentInstructions, names[i], strings.Join(others, ", "), opts.Stop)
+	}
+	var moderator *agent
+	if opts.Moderator != "" {
+		m, err := cb.resolveAgent(opts.Moderator)
+		if err != nil {
+			return err
+		}
+		m.target.System += "\n\n" + fmt.Sprintf(moderatorInstructions, strings.Join(names, ", "), opts.Stop)
+		moderator = &m
+	}
+
+	cb.mu.Lock()
+	sess := cb.newSession()
+	sess.Backend = agents[0].target.Backend
+	sess.Title = previewText(strings.Join(names, ", ")+": "+opts.Task, maxTitleLength)
+	sess.AddMessage("user", opts.Task)
+	cb.session = sess
+	cb.mu.Unlock()
+	if err := cb.saveSession(); err != nil {
+		return err
+	}
+	if _, err := cb.db.Exec("UPDATE sessions SET title = ? WHERE id = ?", sess.Title, sess.ID); err != nil {
+		cb.logger.Warn("failed to save session title", "session_id", sess.ID, "error", err)
+	}
+
+	ctx, span := cb.tracer.Start(ctx, "agents")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("session_id", sess.ID),
+		attribute.StringSlice("agents", names),
+		attribute.Int("max_turns", opts.Turns),
+	)
+	record := agentsRecord{SessionID: sess.ID, Task: opts.Task, TraceID: span.SpanContext().TraceID().String()}
+	jsonOutput := cb.cfg().Output == config.OutputJSON
+	start := time.Now()
+
+	// say records a reply in the transcript and shows it
+	say := func(a agent, role string, result agentTurnRecord) error {
+		record.Turns = append(record.Turns, result)
+		cb.mu.Lock()
+		cb.session.AddMessage(role, result.Response)
+		cb.session.Messages[len(cb.session.Messages)-1].Speaker = result.Speaker
+		cb.mu.Unlock()
+		if !jsonOutput {
+			fmt.Fprintf(out, "[%s] %s %s\n%s\n\n", result.Speaker, a.target.Backend, a.target.Model, result.Response)
+		}
+		return cb.saveSession()
+	}
+
+	record.Stopped = fmt.Sprintf("reached %d turns", opts.Turns)
+	var runErr error
+	for turn := 0; turn < opts.Turns; turn++ {
+		a := agents[turn%len(agents)]
+		cb.mu.Lock()
+		view := agentView(cb.session.Messages, a.name)
+		cb.mu.Unlock()
+		result, err := cb.agentTurn(ctx, a, view, turn+1)
+		if err != nil {
+			runErr = fmt.Errorf("agent %s: %w", a.name, err)
+			break
+		}
+		if runErr = say(a, "assistant", result); runErr != nil {
+			break
+		}
+		if strings.Contains(result.Response, opts.Stop) {
+			record.Stopped = fmt.Sprintf("%s said %s", a.name, opts.Stop)
+			break
+		}
+
+		// The moderator steps in after each round but the last
+		if moderator == nil || (turn+1)%len(agents) != 0 || turn+1 == opts.Turns {
+			continue
+		}
+		cb.mu.Lock()
+		transcript := formatTranscript(cb.session.Messages[1:])
+		cb.mu.Unlock()
+		prompt := []session.Message{{Role: "user", Content: fmt.Sprintf(moderatorPrompt, opts.Task, transcript)}}
+		result, err = cb.agentTurn(ctx, *moderator, prompt, 0)
+		if err != nil {
+			runErr = fmt.Errorf("moderator %s: %w", moderator.name, err)
+			break
+		}
+		result.Speaker = moderatorSpeaker
+		if runErr = say(*moderator, "user", result); runErr != nil {
+			break
+		}
+		if strings.Contains(result.Response, opts.Stop) {
+			record.Stopped = "the moderator said " + opts.Stop
+			break
+		}
+	}
+	record.LatencyMS = time.Since(start).Milliseconds()
+	if runErr != nil {
+		span.RecordError(runErr)
+		span.SetStatus(codes.Error, runErr.Error())
+		record.Error = runErr.Error()
+		record.Stopped = "failed"
+	}
+	span.SetAttributes(attribute.String("stopped", record.Stopped))
+	cb.logger.Info("agents finished", "session_id", sess.ID, "turns", len(record.Turns), "stopped", record.Stopped, "error", record.Error)
+
+	if jsonOutput {
+		enc := json.NewEncoder(out)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(record); err != nil {
+			return fmt.Errorf("failed to write agents record: %w", err)
+		}
+		return runErr
+	}
+	if runErr == nil {
+		fmt.Fprintf(progress, "Stopped: %s\n", record.Stopped)
+	}
+	fmt.Fprintf(progress, "Session: %s (continue it with --session-id %s)\n", sess.ID, sess.ID)
+	fmt.Fprintf(progress, "Trace: %s\n", record.TraceID)
+	return runErr
+}
+
+// agentTurn sends one reply of an agent, or of the moderator when turn is 0,
+// as a single turn without tools
+func (cb *ChatBot) agentTurn(ctx context.Context, a agent, messages []session.Message, turn int) (agentTurnRecord, error) {
+	// recordUsage adds each request's tokens to the turn record
+	usage := &turnRecord{}
+	ctx = context.WithValue(ctx, turnRecordKey{}, usage)
+	ctx, span := cb.tracer.Start(ctx, "agent_turn")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("agent", a.name),
+		attribute.Bool("moderator", turn == 0),
+		attribute.Int("turn", turn),
+		attribute.String("backend", a.target.Backend),
+		attribute.String("model", a.target.Model),
+	)
+
+	result := agentTurnRecord{Speaker: a.name, Backend: a.target.Backend, Model: a.target.Model}
+	start := time.Now()
+
+	keyMessages := append([]session.Message{{Role: "system", Content: a.target.System}}, messages...)
+	cacheKey := cache.GenerateCacheKey(keyMessages)
+	if cached, ok := cb.checkCache(cacheKey); ok {
+		span.SetAttributes(attribute.Bool("cache_hit", true))
+		result.Response, result.Cached = cached, true
+		result.LatencyMS = time.Since(start).Milliseconds()
+		return result, nil
+	}
+
+	cb.mu.Lock()
+	sessionID := cb.session.ID
+	cb.mu.Unlock()
+	cb.auditPrompt(sessionID, a.target, "agents", messages[len(messages)-1].Content)
+	response, err := cb.callBackend(ctx, a.target, messages)
+	cb.turnStats.record(ctx, a.target, time.Since(start), err)
+	cb.auditResponse(sessionID, a.target, "agents", response, false, err)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return result, err
+	}
+	cb.storeCache(cacheKey, response)
+
+	result.Response = response
+	result.Usage = usage.Usage
+	result.LatencyMS = time.Since(start).Milliseconds()
+	span.SetAttributes(
+		attribute.Int64("prompt_tokens", usage.Usage.PromptTokens),
+		attribute.Int64("completion_tokens", usage.Usage.CompletionTokens),
+	)
+	return result, nil
+}
+
+// resolveAgent looks up the persona of an agent given as name or
+// name=model, where model is an alias, a backend or backend/model and
+// replaces the persona's preferred model
+func (cb *ChatBot) resolveAgent(spec string) (agent, error) {
+	name, ref, _ := strings.Cut(spec, "=")
+	persona, ok := cb.cfg().Persona(name)
+	if !ok {
+		return agent{}, fmt.Errorf("unknown persona %s (available: %s)", name, strings.Join(cb.cfg().PersonaNames(), ", "))
+	}
+	if ref == "" {
+		ref = persona.Model
+	}
+
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	target := llmTarget{Backend: cb.session.Backend, System: persona.System}
+	switch {
+	case ref == "":
+	case config.ValidBackend(ref):
+		target.Backend = ref
+	default:
+		backendName, model, err := cb.cfg().ResolveModelRef(ref)
+		if err != nil {
+			return agent{}, fmt.Errorf("agent %s: %w", name, err)
+		}
+		target.Backend, target.Model = backendName, model
+	}
+	if target.Model == "" {
+		target.Model = cb.modelFor(target.Backend)
+	}
+	return agent{name: name, target: target}, nil
+}
+
+// agentView returns the transcript as the agent called name sees it: its
+// own replies as the assistant's, and the task and the other speakers'
+// messages, prefixed with their names, as the user's
+func agentView(transcript []session.Message, name string) []session.Message {
+	var view []session.Message
+	for _, msg := range transcript {
+		role, content := "user", msg.Content
+		switch msg.Speaker {
+		case name:
+			role = "assistant"
+		case "":
+		default:
+			content = msg.Speaker + ": " + msg.Content
+		}
+		// Backends expect the roles to alternate
+		if n := len(view); n > 0 && view[n-1].Role == role {
+			view[n-1].Content += "\n\n" + content
+			continue
+		}
+		view = append(view, session.Message{Role: role, Content: content})
+	}
+	return view
+}
@@ -0,0 +1,123 @@
+package chatbot
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"unicode/utf8"
+
+	"ExtraChat/internal/config"
+)
+
+// bytesPerToken estimates tokens from size for the context guard
+const bytesPerToken = 4
+
+// attachment is a file or piped input sent as context with the next prompt
+type attachment struct {
+	name    string
+	content string
+}
+
+// Attach reads r as context named name, to be prepended to the next prompt.
+// Binary content, and context above the configured token limit in total,
+// are rejected.
+func (cb *ChatBot) Attach(name string, r io.Reader) error {
+	cb.mu.Lock()
+	limit := cb.contextLimit()
+	budget := int64(limit) * bytesPerToken
+	for _, a := range cb.attachments {
+		budget -= int64(len(a.content))
+	}
+	cb.mu.Unlock()
+
+	data, err := io.ReadAll(io.LimitReader(r, budget+1))
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	if int64(len(data)) > budget {
+		return fmt.Errorf("%s exceeds the context limit of about %d tokens (see --context-max-tokens)", name, limit)
+	}
+	if !utf8.Valid(data) || bytes.IndexByte(data, 0) >= 0 {
+		return fmt.Errorf("%s does not look like text", name)
+	}
+
+	cb.mu.Lock()
+	cb.attachments = append(cb.attachments, attachment{name: name, content: string(data)})
+	cb.mu.Unlock()
+	cb.logger.Info("context attached", "name", name, "bytes", len(data))
+	return nil
+}
+
+// AttachFile reads the file at path as context for the next prompt
+func (cb *ChatBot) AttachFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open context file: %w", err)
+	}
+	defer f.Close()
+	return cb.Attach(path, f)
+}
+
+// withAttachments prepends the pending context to prompt and clears it
+func (cb *ChatBot) withAttachments(prompt string) string {
+	cb.mu.Lock()
+	pending := cb.attachments
+	cb.attachments = nil
+	cb.mu.Unlock()
+	if len(pending) == 0 {
+		return prompt
+	}
+
+	var b strings.Builder
+	for _, a := range pending {
+		fmt.Fprintf(&b, "<context name=%q>\n%s", a.name, a.content)
+		if !strings.HasSuffix(a.content, "\n") {
+			b.WriteString("\n")
+		}
+		b.WriteString("</context>\n\n")
+	}
+	b.WriteString(prompt)
+	return b.String()
+}
+
+// printAttachments lists the context waiting to be sent with the first prompt
+func (cb *ChatBot) printAttachments() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	for _, a := range cb.attachments {
+		fmt.Printf("Context: %s (%s, sent with your first message)\n", a.name, formatBytes(uint64(len(a.content))))
+	}
+}
+
+// RunOnce sends prompt with any attached context, prints the reply and
+// returns without starting the REPL. Ctrl+C or SIGTERM cancels the request.
+func (cb *ChatBot) RunOnce(prompt string) error {
+	defer cb.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Keep stdout for the reply, or its JSON record, alone
+	cb.progress = newProgressDisplay(os.Stderr, cb.cfg().Plain || !isTerminal(os.Stderr))
+	if cb.cfg().Output == config.OutputJSON {
+		cb.useJSONOutput()
+	}
+
+	response, err := cb.runTurn(ctx, prompt)
+	if err != nil {
+		return err
+	}
+	if cb.records == nil {
+		fmt.Println(response)
+	}
+
+	if err := cb.saveSession(); err != nil {
+		return fmt.Errorf("failed to save session: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package chatbot
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"ExtraChat/internal/audit"
+	"ExtraChat/internal/guard"
+)
+
+// toolCallEntry is one row of the tool call audit trail
+type toolCallEntry struct {
+	Server     string
+	Tool       string
+	Arguments  string
+	ResultHash string
+	Duration   time.Duration
+	Error      string
+	Timestamp  time.Time
+}
+
+// hashResult returns the SHA-256 of a tool result's JSON encoding, so the
+// audit trail can show whether two calls returned the same thing without
+// storing potentially large or sensitive output
+func hashResult(result interface{}) string {
+	if result == nil {
+		return ""
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// recordToolCall persists a tool call in the audit trail of the current
+// session. Failures are logged rather than returned so auditing never
+// breaks a turn.
+func (cb *ChatBot) recordToolCall(server, tool string, args map[string]interface{}, result interface{}, duration time.Duration, callErr error) {
+	arguments, err := json.Marshal(args)
+	if err != nil {
+		arguments = []byte(fmt.Sprintf("%v", args))
+	}
+	var errText string
+	if callErr != nil {
+		errText = callErr.Error()
+	}
+
+	cb.mu.Lock()
+	sessionID := cb.session.ID
+	cb.mu.Unlock()
+
+	_, err = cb.db.Exec(
+		"INSERT INTO tool_calls (session_id, server, tool, arguments, result_hash, duration_ms, error, timestamp) VALUES (?, ?, ?, ?, NULLIF(?, ''), ?, NULLIF(?, ''), ?)",
+		sessionID, server, tool, string(arguments), hashResult(result), duration.Milliseconds(), errText, time.Now(),
+	)
+	if err != nil {
+		cb.logger.Warn("failed to record tool call", "tool", tool, "server", server, "error", err)
+	}
+}
+
+// loadToolCalls returns the last limit tool calls of a session, oldest first
+func (cb *ChatBot) loadToolCalls(sessionID string, limit int) ([]toolCallEntry, error) {
+	rows, err := cb.db.Query(
+		`SELECT server, tool, arguments, COALESCE(result_hash, ''), duration_ms, COALESCE(error, ''), timestamp
+		FROM (SELECT * FROM tool_calls WHERE session_id = ? ORDER BY id DESC LIMIT ?)
+		ORDER BY id`,
+		sessionID, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tool calls: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []toolCallEntry
+	for rows.Next() {
+		var entry toolCallEntry
+		var durationMS int64
+		if err := rows.Scan(&entry.Server, &entry.Tool, &entry.Arguments, &entry.ResultHash, &durationMS, &entry.Error, &entry.Timestamp); err != nil {
+			return nil, fmt.Errorf("failed to scan tool call: %w", err)
+		}
+		entry.Duration = time.Duration(durationMS) * time.Millisecond
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// handleToolLogCommand handles /tool-log [n], listing the last n tool calls
+// made in the current session
+func (cb *ChatBot) handleToolLogCommand(args []string) error {
+	limit := 20
+	if len(args) > 0 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n <= 0 {
+			return fmt.Errorf("usage: /tool-log [count]")
+		}
+		limit = n
+	}
+
+	cb.mu.Lock()
+	sessionID := cb.session.ID
+	cb.mu.Unlock()
+
+	entries, err := cb.loadToolCalls(sessionID, limit)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		fmt.Println("No tool calls in this session yet.")
+		return nil
+	}
+
+	fmt.Println()
+	for _, entry := range entries {
+		status := "ok"
+		if entry.Error != "" {
+			status = "error"
+		}
+		fmt.Printf("%s %s on %s [%s, %s]\n",
+			entry.Timestamp.Format("2006-01-02 15:04:05"), entry.Tool, entry.Server, status, formatSpanDuration(entry.Duration))
+		fmt.Printf("   Args:   %s\n", previewText(entry.Arguments, 100))
+		if entry.ResultHash != "" {
+			fmt.Printf("   Result: sha256:%s\n", entry.ResultHash[:16])
+		}
+		if entry.Error != "" {
+			fmt.Printf("   Error:  %s\n", previewText(entry.Error, 100))
+		}
+	}
+	fmt.Println()
+	return nil
+}
+
+// writeAudit appends an entry to the audit log, if enabled. Failures are
+// logged rather than returned so auditing never breaks a turn.
+func (cb *ChatBot) writeAudit(entry audit.Entry) {
+	if cb.audit == nil {
+		return
+	}
+	if err := cb.audit.Write(entry); err != nil {
+		cb.logger.Warn("failed to write audit log", "type", entry.Type, "error", err)
+	}
+}
+
+// auditPrompt records a prompt as sent to a backend, secrets redacted as
+// sendToBackend does; job names the background
+// job, empty for chat turns
+func (cb *ChatBot) auditPrompt(sessionID string, target llmTarget, job, prompt string) {
+	cb.writeAudit(audit.Entry{
+		Type:      audit.TypePrompt,
+		SessionID: sessionID,
+		Backend:   target.Backend,
+		Model:     target.Model,
+		Job:       job,
+		Content:   guard.Redact(prompt, cb.unsentSecrets(target, prompt)),
+	})
+}
+
+// auditResponse records a backend's reply, or the error in its place
+func (cb *ChatBot) auditResponse(sessionID string, target llmTarget, job, response string, cached bool, respErr error) {
+	entry := audit.Entry{
+		Type:      audit.TypeResponse,
+		SessionID: sessionID,
+		Backend:   target.Backend,
+		Model:     target.Model,
+		Job:       job,
+		Content:   response,
+		Cached:    cached,
+	}
+	if respErr != nil {
+		entry.Error = respErr.Error()
+	}
+	cb.writeAudit(entry)
+}
+
+// auditToolCall records a tool call with its full arguments and result,
+// which the tool_calls table only keeps as a hash
+func (cb *ChatBot) auditToolCall(server, tool string, args map[string]interface{}, result interface{}, duration time.Duration, callErr error) {
+	if cb.audit == nil {
+		return
+	}
+
+	cb.mu.Lock()
+	sessionID := cb.session.ID
+	cb.mu.Unlock()
+
+	entry := audit.Entry{
+		Type:       audit.TypeToolCall,
+		SessionID:  sessionID,
+		Server:     server,
+		Tool:       tool,
+		Arguments:  args,
+		Result:     result,
+		DurationMs: duration.Milliseconds(),
+	}
+	if callErr != nil {
+		entry.Error = callErr.Error()
+	}
+	cb.writeAudit(entry)
+}
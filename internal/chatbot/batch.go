@@ -0,0 +1,451 @@
+package chatbot
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+
+	"ExtraChat/internal/clock"
+	"ExtraChat/internal/session"
+)
+
+// BatchOptions controls a batch run
+type BatchOptions struct {
+	In          string // JSONL file of prompts
+	Out         string // JSONL file the results are appended to
+	Concurrency int    // Prompts in flight at once
+	Retries     int    // Retries of a prompt after a retryable failure
+	RateLimit   int    // Requests per minute across all workers; 0 for no limit
+
+	// MessageBatches submits the prompts to Anthropic's Message Batches API
+	// instead, at half the price, and polls every PollInterval until the
+	// results are in
+	MessageBatches bool
+	PollInterval   time.Duration
+}
+
+// Backoff between retries of a batch prompt: doubling from batchBackoffBase,
+// at most batchBackoffMax, plus up to half again of jitter
+const (
+	batchBackoffBase = time.Second
+	batchBackoffMax  = 30 * time.Second
+)
+
+// batchLineMax caps the length of a line of the input or output file
+const batchLineMax = 16 << 20
+
+// batchPrompt is a line of the input file
+type batchPrompt struct {
+	ID     string `json:"id"`               // Defaults to line-N
+	Prompt string `json:"prompt"`           // Required
+	System string `json:"system,omitempty"` // Replaces the persona's system prompt
+}
+
+// batchResult is the line written to the output file for each prompt
+type batchResult struct {
+	ID        string    `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+	Response  string    `json:"response"`
+	Error     string    `json:"error,omitempty"`
+	Backend   string    `json:"backend"`
+	Model     string    `json:"model"`
+	Cached    bool      `json:"cached"`
+	Usage     turnUsage `json:"usage"`
+	Attempts  int       `json:"attempts"`
+	LatencyMS int64     `json:"latency_ms"`
+}
+
+// Batch sends every prompt of opts.In to the session's backend and appends
+// a result line per prompt to opts.Out, in the order they finish. Prompts
+// are stateless single turns without tools. A result already in opts.Out
+// without an error is not sent again, so an interrupted or crashed run
+// resumes where it stopped and a finished one retries only its failures.
+// Progress goes to progress.
+func (cb *ChatBot) Batch(ctx context.Context, progress io.Writer, opts BatchOptions) error {
+	prompts, err := readBatchPrompts(opts.In)
+	if err != nil {
+		return err
+	}
+	done, err := loadBatchResults(opts.Out)
+	if err != nil {
+		return err
+	}
+
+	var pending []batchPrompt
+	for _, p := range prompts {
+		if !done[p.ID] {
+			pending = append(pending, p)
+		}
+	}
+	skipped := len(prompts) - len(pending)
+
+	out, err := os.OpenFile(opts.Out, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open results file: %w", err)
+	}
+	defer out.Close()
+
+	cb.logger.Info("batch started", "in", opts.In, "out", opts.Out, "prompts", len(prompts), "pending", len(pending), "concurrency", opts.Concurrency, "rate_limit", opts.RateLimit, "message_batches", opts.MessageBatches)
+	if skipped > 0 {
+		fmt.Fprintf(progress, "Resuming: %d of %d prompts already have results in %s\n", skipped, len(prompts), opts.Out)
+	}
+
+	var failed int
+	if opts.MessageBatches {
+		failed, err = cb.runMessageBatches(ctx, progress, opts, pending, out)
+	} else {
+		failed, err = cb.runBatchWorkers(ctx, progress, opts, pending, out)
+	}
+	if err != nil {
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		return fmt.Errorf("failed to write results file: %w", err)
+	}
+	if ctx.Err() != nil {
+		return fmt.Errorf("batch interrupted (run it again to resume): %w", ctx.Err())
+	}
+
+	fmt.Fprintf(progress, "%d prompts: %d succeeded, %d failed, %d already done; results in %s\n",
+		len(prompts), len(pending)-failed, failed, skipped, opts.Out)
+	cb.logger.Info("batch finished", "prompts", len(prompts), "failed", failed, "skipped", skipped)
+	if failed > 0 {
+		return fmt.Errorf("%d of %d prompts failed (run the batch again to retry them)", failed, len(pending))
+	}
+	return nil
+}
+
+// runBatchWorkers sends the pending prompts from opts.Concurrency workers
+// and appends their results to out, returning how many failed
+func (cb *ChatBot) runBatchWorkers(ctx context.Context, progress io.Writer, opts BatchOptions, pending []batchPrompt, out io.Writer) (int, error) {
+	var pacer *batchPacer
+	if opts.RateLimit > 0 {
+		pacer = &batchPacer{interval: time.Minute / time.Duration(opts.RateLimit), clock: cb.clock}
+	}
+	report := newBatchProgress(progress, len(pending), cb.cfg().Plain || !isOSTerminal(progress))
+
+	var (
+		writeMu  sync.Mutex
+		writeErr error
+		failed   int
+	)
+	jobs := make(chan batchPrompt)
+	var wg sync.WaitGroup
+	for range min(max(opts.Concurrency, 1), max(len(pending), 1)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for p := range jobs {
+				result := cb.runBatchPrompt(ctx, p, opts.Retries, pacer)
+				// An interrupted prompt has no result; the next run sends it
+				if ctx.Err() != nil {
+					continue
+				}
+				line, err := json.Marshal(result)
+				writeMu.Lock()
+				if err == nil {
+					_, err = out.Write(append(line, '\n'))
+				}
+				if err != nil && writeErr == nil {
+					writeErr = fmt.Errorf("failed to write result: %w", err)
+				}
+				if result.Error != "" {
+					failed++
+				}
+				report.add(result.Error != "")
+				writeMu.Unlock()
+			}
+		}()
+	}
+
+feed:
+	for _, p := range pending {
+		select {
+		case jobs <- p:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	report.finish()
+
+	return failed, writeErr
+}
+
+// runBatchPrompt sends one prompt, retrying retryable failures up to
+// retries times with exponential backoff
+func (cb *ChatBot) runBatchPrompt(ctx context.Context, p batchPrompt, retries int, pacer *batchPacer) (result batchResult) {
+	sessionID, target := cb.batchTarget(p)
+
+	// recordUsage adds each request's tokens to the record
+	record := &turnRecord{}
+	ctx = context.WithValue(ctx, turnRecordKey{}, record)
+	ctx, span := cb.tracer.Start(ctx, "batch_prompt")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("id", p.ID),
+		attribute.String("backend", target.Backend),
+		attribute.String("model", target.Model),
+	)
+
+	result = batchResult{ID: p.ID, Timestamp: time.Now(), Backend: target.Backend, Model: target.Model}
+	start := time.Now()
+	defer func() {
+		result.LatencyMS = time.Since(start).Milliseconds()
+		result.Usage = record.Usage
+	}()
+
+	messages := []session.Message{{Role: "user", Content: p.Prompt}}
+	cacheKey := batchCacheKey(p, target)
+	if cached, ok := cb.checkCache(cacheKey); ok {
+		span.SetAttributes(attribute.Bool("cache_hit", true))
+		result.Response, result.Cached = cached, true
+		return result
+	}
+
+	cb.auditPrompt(sessionID, target, "batch", p.Prompt)
+	var response string
+	var err error
+	for {
+		result.Attempts++
+		if err = pacer.wait(ctx); err != nil {
+			break
+		}
+		attemptStart := time.Now()
+		response, err = cb.callBackend(ctx, target, messages)
+		cb.turnStats.record(ctx, target, time.Since(attemptStart), err)
+		if err == nil || result.Attempts > retries || ctx.Err() != nil || !retryable(err) {
+			break
+		}
+
+		delay := batchBackoff(result.Attempts)
+		cb.logger.Warn("batch prompt failed, retrying", "id", p.ID, "attempt", result.Attempts, "delay", delay, "error", err)
+		select {
+		case <-cb.clock.After(delay):
+		case <-ctx.Done():
+		}
+	}
+	cb.auditResponse(sessionID, target, "batch", response, false, err)
+	span.SetAttributes(attribute.Int("attempts", result.Attempts))
+
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		cb.logger.Error("batch prompt failed", "id", p.ID, "attempts", result.Attempts, "error", err)
+		result.Error = err.Error()
+		return result
+	}
+	cb.storeCache(cacheKey, response)
+	result.Response = response
+	return result
+}
+
+// batchTarget returns the session and the target a batch prompt is sent to
+func (cb *ChatBot) batchTarget(p batchPrompt) (string, llmTarget) {
+	cb.mu.Lock()
+	sessionID := cb.session.ID
+	target := llmTarget{
+		Backend: cb.session.Backend,
+		Model:   cb.sessionModel(cb.session),
+		System:  cb.systemPrompt(),
+	}
+	cb.mu.Unlock()
+	if p.System != "" {
+		target.System = p.System
+	}
+	return sessionID, target
+}
+
+// retryable reports whether a failed request may succeed when sent again:
+// rate limits, timeouts, server errors and network failures
+func retryable(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == http.StatusTooManyRequests ||
+			apiErr.StatusCode == http.StatusRequestTimeout ||
+			apiErr.StatusCode >= http.StatusInternalServerError
+	}
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr)
+}
+
+// batchBackoff returns the wait before retrying after the given attempt
+func batchBackoff(attempt int) time.Duration {
+	delay := batchBackoffMax
+	if attempt < 6 {
+		delay = min(batchBackoffBase<<(attempt-1), batchBackoffMax)
+	}
+	return delay + rand.N(delay/2+1)
+}
+
+// batchPacer spaces requests evenly, across all workers, to stay under a
+// rate limit. A nil pacer does not wait.
+type batchPacer struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+	clock    clock.Clock
+}
+
+// wait blocks until the next request may be sent
+func (p *batchPacer) wait(ctx context.Context) error {
+	if p == nil {
+		return ctx.Err()
+	}
+	p.mu.Lock()
+	now := p.clock.Now()
+	at := now
+	if p.next.After(at) {
+		at = p.next
+	}
+	p.next = at.Add(p.interval)
+	p.mu.Unlock()
+
+	select {
+	case <-p.clock.After(at.Sub(now)):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// readBatchPrompts reads the prompts of a JSONL input file; blank lines are
+// skipped
+func readBatchPrompts(path string) ([]batchPrompt, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open prompts file: %w", err)
+	}
+	defer f.Close()
+
+	var prompts []batchPrompt
+	seen := make(map[string]int)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, batchLineMax)
+	for n := 1; scanner.Scan(); n++ {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var p batchPrompt
+		if err := json.Unmarshal(line, &p); err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", path, n, err)
+		}
+		if p.Prompt == "" {
+			return nil, fmt.Errorf("%s line %d: no prompt", path, n)
+		}
+		if p.ID == "" {
+			p.ID = fmt.Sprintf("line-%d", n)
+		}
+		if first, ok := seen[p.ID]; ok {
+			return nil, fmt.Errorf("%s line %d: id %q is already used on line %d", path, n, p.ID, first)
+		}
+		seen[p.ID] = n
+		prompts = append(prompts, p)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read prompts file: %w", err)
+	}
+	return prompts, nil
+}
+
+// loadBatchResults returns the ids the results file already has a
+// successful result for; a later line for an id supersedes an earlier one.
+// A last line cut short by a crash is truncated away.
+func loadBatchResults(path string) (map[string]bool, error) {
+	done := make(map[string]bool)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return done, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read results file: %w", err)
+	}
+
+	if end := bytes.LastIndexByte(data, '\n') + 1; end < len(data) {
+		if err := os.Truncate(path, int64(end)); err != nil {
+			return nil, fmt.Errorf("failed to truncate partial result: %w", err)
+		}
+		data = data[:end]
+	}
+
+	for n, line := range bytes.Split(data, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		var r batchResult
+		if err := json.Unmarshal(line, &r); err != nil || r.ID == "" {
+			return nil, fmt.Errorf("%s line %d is not a batch result", path, n+1)
+		}
+		done[r.ID] = r.Error == ""
+	}
+	return done, nil
+}
+
+// batchProgress reports finished prompts: a line rewritten in place on a
+// terminal, otherwise a line every tenth of the batch
+type batchProgress struct {
+	w       io.Writer
+	plain   bool
+	total   int
+	done    int
+	failed  int
+	started time.Time
+	shown   int // Tenths reported so far, for plain output
+}
+
+func newBatchProgress(w io.Writer, total int, plain bool) *batchProgress {
+	return &batchProgress{w: w, plain: plain, total: total, started: time.Now()}
+}
+
+// add counts a finished prompt
+func (p *batchProgress) add(failed bool) {
+	p.done++
+	if failed {
+		p.failed++
+	}
+	if p.plain {
+		if tenths := p.done * 10 / p.total; tenths > p.shown {
+			p.shown = tenths
+			fmt.Fprintln(p.w, p.line())
+		}
+		return
+	}
+	fmt.Fprintf(p.w, "\r\033[K%s", p.line())
+}
+
+// finish ends the line rewritten in place
+func (p *batchProgress) finish() {
+	if !p.plain && p.done > 0 {
+		fmt.Fprintln(p.w)
+	}
+}
+
+func (p *batchProgress) line() string {
+	rate := float64(p.done) / max(time.Since(p.started).Seconds(), 0.001)
+	return fmt.Sprintf("%d/%d prompts (%d%%), %d failed, %.1f/s", p.done, p.total, p.done*100/p.total, p.failed, rate)
+}
+
+// isOSTerminal reports whether w is a terminal
+func isOSTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	return ok && isTerminal(f)
+}
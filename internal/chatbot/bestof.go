@@ -0,0 +1,338 @@
+package chatbot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+
+	"ExtraChat/internal/config"
+	"ExtraChat/internal/pricing"
+	"ExtraChat/internal/session"
+)
+
+// maxBestOf bounds the replies /bestof asks for
+const maxBestOf = 8
+
+// judgeInstructions is the judge's system prompt for /bestof
+const judgeInstructions = "You compare candidate replies to a prompt and pick the best one: the most correct, " +
+	"complete and clear. Answer with the number of the best reply and nothing else."
+
+// replyNumber finds the reply number in the judge's answer
+var replyNumber = regexp.MustCompile(`\d+`)
+
+// bestOfSample is one of the replies /bestof asked for
+type bestOfSample struct {
+	Response string
+	Usage    turnUsage
+	Latency  time.Duration
+	Cost     float64
+	Priced   bool // Cost is known
+	Err      error
+}
+
+// bestOfResult is the outcome of a best-of-N request
+type bestOfResult struct {
+	Target   llmTarget
+	Samples  []bestOfSample
+	Selected int // Index of the reply the judge picked, or of the only successful one; -1 otherwise
+
+	Judge      llmTarget // Empty without a judge
+	JudgeUsage turnUsage
+	JudgeErr   error // Why the judge didn't pick a reply
+	Cost       float64
+	Priced     bool // Cost is known for every request
+}
+
+// handleBestOfCommand handles /bestof <n> <prompt>: the prompt is sent n
+// times, and the judge model, or else the user, picks the reply kept in the
+// session
+func (cb *ChatBot) handleBestOfCommand(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: /bestof <n> <prompt>")
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 2 || n > maxBestOf {
+		return fmt.Errorf("n must be a number from 2 to %d", maxBestOf)
+	}
+	prompt, err := cb.screenSecrets(strings.Join(args[1:], " "))
+	if err != nil {
+		return err
+	}
+
+	cb.mu.Lock()
+	sessionID := cb.session.ID
+	cb.mu.Unlock()
+	unlock, err := cb.locks.TryAcquire(sessionID)
+	if err != nil {
+		return fmt.Errorf("session %s: %w", sessionID, err)
+	}
+	defer unlock()
+
+	ctx, done := cb.interruptible(context.Background())
+	result, err := cb.bestOf(ctx, n, prompt)
+	done()
+	if errors.Is(err, context.Canceled) {
+		fmt.Println("Request cancelled.")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Println()
+	for i, sample := range result.Samples {
+		if sample.Err != nil {
+			fmt.Printf("Reply %d of %d failed: %v\n\n", i+1, n, sample.Err)
+			continue
+		}
+		fmt.Printf("Reply %d of %d (%d tokens, %s, %s):\n%s\n\n", i+1, n, sample.Usage.CompletionTokens,
+			sample.Latency.Round(time.Millisecond), formatCost(sample.Cost, sample.Priced), sample.Response)
+	}
+
+	selected, how := result.Selected, "the only reply that succeeded"
+	if result.Judge.Backend != "" {
+		how = "picked by the judge, " + result.Judge.Backend + " " + result.Judge.Model
+	}
+	switch {
+	case selected >= 0:
+	case result.JudgeErr != nil:
+		fmt.Printf("The judge did not pick a reply: %v\n", result.JudgeErr)
+		fallthrough
+	default:
+		selected, how = cb.pickReply(result.Samples)
+	}
+	chosen := result.Samples[selected]
+
+	var extra string
+	if result.Priced && chosen.Priced {
+		extra = fmt.Sprintf(", $%.4f more than the selected reply alone", result.Cost-chosen.Cost)
+	}
+	fmt.Printf("Selected reply %d (%s)\n", selected+1, how)
+	fmt.Printf("Cost: %s for %d replies", formatCost(result.Cost, result.Priced), n)
+	if result.Judge.Backend != "" {
+		fmt.Print(" and the judge")
+	}
+	fmt.Printf("%s\n\n", extra)
+
+	cb.mu.Lock()
+	cb.session.AddMessage("user", prompt)
+	cb.session.AddMessage("assistant", chosen.Response)
+	cb.mu.Unlock()
+	if err := cb.saveSession(); err != nil {
+		cb.logger.Error("failed to save session", "error", err)
+	}
+	cb.logger.Info("best of n", "session_id", sessionID, "n", n, "backend", result.Target.Backend, "model", result.Target.Model,
+		"selected", selected+1, "judge", result.Judge.Backend, "cost_usd", result.Cost)
+	return nil
+}
+
+// pickReply asks the user which of the replies to keep; without an
+// interactive input the first reply is kept
+func (cb *ChatBot) pickReply(samples []bestOfSample) (int, string) {
+	first := 0
+	for first < len(samples)-1 && samples[first].Err != nil {
+		first++
+	}
+	if cb.input == nil {
+		return first, "first reply, no judge configured"
+	}
+	for {
+		line, err := cb.readLine(fmt.Sprintf("Keep which reply? [1-%d, Enter for %d]: ", len(samples), first+1))
+		if err != nil {
+			fmt.Println()
+			return first, "first reply"
+		}
+		choice := strings.TrimSpace(line)
+		if choice == "" {
+			return first, "your pick"
+		}
+		if i, err := strconv.Atoi(choice); err == nil && i >= 1 && i <= len(samples) && samples[i-1].Err == nil {
+			return i - 1, "your pick"
+		}
+		fmt.Printf("No reply [%s]\n", choice)
+	}
+}
+
+// bestOf asks for n replies to prompt after the conversation so far and,
+// with a judge configured, has it pick the best. The session is not changed.
+// It fails only when every reply failed.
+func (cb *ChatBot) bestOf(ctx context.Context, n int, prompt string) (*bestOfResult, error) {
+	cb.mu.Lock()
+	sessionID := cb.session.ID
+	messages := make([]session.Message, len(cb.session.Messages), len(cb.session.Messages)+1)
+	copy(messages, cb.session.Messages)
+	// The replies are compared as text, so they are sent without tools
+	target := llmTarget{
+		Backend: cb.session.Backend,
+		Model:   cb.sessionModel(cb.session),
+		System:  cb.systemPrompt(),
+	}
+	judgeRef := cb.cfg().BestOfJudge
+	var judge llmTarget
+	var judgeErr error
+	if judgeRef != "" {
+		judge.Backend, judge.Model, judgeErr = cb.cfg().ResolveRouteModel(judgeRef)
+		if judgeErr == nil && judge.Model == "" {
+			judge.Model = cb.modelFor(judge.Backend)
+		}
+		judge.System = judgeInstructions
+	}
+	table := pricing.NewTable(cb.cfg().Pricing)
+	cb.mu.Unlock()
+	if judgeErr != nil {
+		return nil, fmt.Errorf("invalid judge: %w", judgeErr)
+	}
+	messages = append(messages, session.Message{Role: "user", Content: prompt})
+
+	ctx, span := cb.tracer.Start(ctx, "best_of")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("session_id", sessionID),
+		attribute.String("backend", target.Backend),
+		attribute.String("model", target.Model),
+		attribute.Int("n", n),
+	)
+	cb.mu.Lock()
+	cb.lastTraceID = span.SpanContext().TraceID()
+	cb.mu.Unlock()
+
+	result := &bestOfResult{Target: target, Selected: -1, Priced: true}
+	_, waited := cb.progress.start(fmt.Sprintf("waiting for %d replies from %s", n, target.Backend))
+	result.Samples = cb.sampleReplies(ctx, sessionID, target, messages, n)
+	waited()
+
+	succeeded := 0
+	var failed error
+	for i := range result.Samples {
+		sample := &result.Samples[i]
+		if sample.Err != nil {
+			failed = sample.Err
+			continue
+		}
+		succeeded++
+		result.Selected = i
+		sample.Cost, sample.Priced = requestCost(table, target, sample.Usage)
+		result.Cost += sample.Cost
+		result.Priced = result.Priced && sample.Priced
+	}
+	switch {
+	case succeeded == 0:
+		span.RecordError(failed)
+		span.SetStatus(codes.Error, failed.Error())
+		return nil, failed
+	case succeeded > 1:
+		// Only a choice needs judging
+		result.Selected = -1
+	}
+
+	if judge.Backend != "" && succeeded > 1 {
+		result.Judge = judge
+		_, waited := cb.progress.start("waiting for the judge")
+		result.Selected, result.JudgeUsage, result.JudgeErr = cb.judgeReplies(ctx, sessionID, judge, prompt, result.Samples)
+		waited()
+		cost, priced := requestCost(table, judge, result.JudgeUsage)
+		result.Cost += cost
+		result.Priced = result.Priced && priced
+		if result.JudgeErr != nil {
+			cb.logger.Warn("judge did not pick a reply", "backend", judge.Backend, "model", judge.Model, "error", result.JudgeErr)
+		}
+	}
+	span.SetAttributes(attribute.Int("selected", result.Selected+1), attribute.Float64("cost_usd", result.Cost))
+	return result, nil
+}
+
+// sampleReplies sends the same messages n times, bypassing the response
+// cache so the replies can differ. Ollama serves one request at a time by
+// default, so its replies are asked for in turn; the cloud backends get
+// them in parallel.
+func (cb *ChatBot) sampleReplies(ctx context.Context, sessionID string, target llmTarget, messages []session.Message, n int) []bestOfSample {
+	prompt := messages[len(messages)-1].Content
+	samples := make([]bestOfSample, n)
+	sample := func(i int) {
+		usage := &turnRecord{}
+		ctx := context.WithValue(ctx, turnRecordKey{}, usage)
+		cb.auditPrompt(sessionID, target, "bestof", prompt)
+		start := time.Now()
+		response, err := cb.callBackend(ctx, target, messages)
+		latency := time.Since(start)
+		cb.turnStats.record(ctx, target, latency, err)
+		cb.auditResponse(sessionID, target, "bestof", response, false, err)
+		samples[i] = bestOfSample{Response: response, Usage: usage.Usage, Latency: latency, Err: err}
+	}
+
+	if target.Backend == config.BackendOllama {
+		for i := range samples {
+			sample(i)
+		}
+		return samples
+	}
+	var wg sync.WaitGroup
+	for i := range samples {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sample(i)
+		}(i)
+	}
+	wg.Wait()
+	return samples
+}
+
+// judgeReplies asks the judge which of the successful replies is best and
+// returns its index
+func (cb *ChatBot) judgeReplies(ctx context.Context, sessionID string, judge llmTarget, prompt string, samples []bestOfSample) (int, turnUsage, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Prompt:\n%s\n", prompt)
+	for i, sample := range samples {
+		if sample.Err == nil {
+			fmt.Fprintf(&b, "\nReply %d:\n%s\n", i+1, sample.Response)
+		}
+	}
+	b.WriteString("\nWhich reply is best? Answer with its number.")
+
+	usage := &turnRecord{}
+	ctx = context.WithValue(ctx, turnRecordKey{}, usage)
+	cb.auditPrompt(sessionID, judge, "bestof", b.String())
+	start := time.Now()
+	// The judge only sees the prompt and replies, which passed the guardrails
+	answer, err := cb.sendToBackend(ctx, judge, []session.Message{{Role: "user", Content: b.String()}})
+	cb.turnStats.record(ctx, judge, time.Since(start), err)
+	cb.auditResponse(sessionID, judge, "bestof", answer, false, err)
+	if err != nil {
+		return -1, usage.Usage, err
+	}
+
+	// The first number that names a successful reply is the pick
+	for _, match := range replyNumber.FindAllString(answer, -1) {
+		i, err := strconv.Atoi(match)
+		if err == nil && i >= 1 && i <= len(samples) && samples[i-1].Err == nil {
+			return i - 1, usage.Usage, nil
+		}
+	}
+	return -1, usage.Usage, fmt.Errorf("no reply number in the answer %q", previewText(answer, 80))
+}
+
+// requestCost estimates the cost of the requests behind usage
+func requestCost(table *pricing.Table, target llmTarget, usage turnUsage) (float64, bool) {
+	price, ok := table.Lookup(target.Backend, target.Model)
+	if !ok {
+		return 0, false
+	}
+	return price.Cost(usage.PromptTokens, usage.CompletionTokens), true
+}
+
+// formatCost renders a cost, or "cost unknown" for a model without a price
+func formatCost(cost float64, priced bool) string {
+	if !priced {
+		return "cost unknown"
+	}
+	return fmt.Sprintf("$%.4f", cost)
+}
@@ -0,0 +1,374 @@
+package chatbot
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"ExtraChat/internal/session"
+)
+
+// branchNode is a session in a fork tree
+type branchNode struct {
+	ID       string
+	Title    string
+	ForkSeq  int
+	Children []*branchNode
+}
+
+// newSessionID returns an unused session ID based on the current time
+func (cb *ChatBot) newSessionID() string {
+	base := fmt.Sprintf("session_%d", time.Now().Unix())
+	id := base
+	for n := 2; ; n++ {
+		var exists int
+		err := cb.db.QueryRow("SELECT COUNT(*) FROM sessions WHERE id = ?", id).Scan(&exists)
+		if err != nil {
+			cb.logger.Warn("failed to check session ID", "session_id", id, "error", err)
+		}
+		if exists == 0 && (cb.session == nil || cb.session.ID != id) {
+			return id
+		}
+		id = fmt.Sprintf("%s_%d", base, n)
+	}
+}
+
+// forkSession saves the current session and continues in a new branch that
+// shares its first atSeq messages; atSeq <= 0 forks at the latest message
+func (cb *ChatBot) forkSession(atSeq int) (*session.Session, error) {
+	if err := cb.saveSession(); err != nil {
+		return nil, fmt.Errorf("failed to save current session: %w", err)
+	}
+
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	parent := cb.session
+	if atSeq <= 0 && len(parent.Messages) > 0 {
+		atSeq = parent.Messages[len(parent.Messages)-1].Seq
+	}
+
+	fork := &session.Session{
+		ID:         cb.newSessionID(),
+		StartTime:  time.Now(),
+		Backend:    parent.Backend,
+		Model:      parent.Model,
+		Persona:    parent.Persona,
+		ParentID:   parent.ID,
+		ForkSeq:    atSeq,
+		Tenant:     parent.Tenant,
+		Documents:  parent.Documents,
+		Collection: parent.Collection,
+		Messages:   []session.Message{},
+	}
+	for _, event := range parent.Events {
+		if event.Seq <= atSeq {
+			fork.Events = append(fork.Events, event)
+		}
+	}
+
+	// A fork before the loaded page needs the earlier messages too
+	messages := parent.Messages
+	if parent.Older > 0 && len(messages) > 0 && atSeq < messages[0].Seq {
+		earlier, err := cb.loadMessages(parent.ID, 0, parent.Older)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(earlier, messages...)
+	}
+
+	found := atSeq == 0
+	for _, msg := range messages {
+		if msg.Seq > atSeq {
+			break
+		}
+		if msg.Seq == atSeq {
+			found = true
+		}
+		// Copies get their own identity; seq keeps the shared prefix aligned
+		msg.ID = session.NewUUIDv7()
+		fork.Messages = append(fork.Messages, msg)
+	}
+	if !found {
+		return nil, fmt.Errorf("no message #%d in session %s", atSeq, parent.ID)
+	}
+
+	cb.session = fork
+	cb.logger.Info("forked session", "session_id", fork.ID, "parent_id", parent.ID, "fork_seq", atSeq)
+	return fork, nil
+}
+
+// loadBranchTree loads the fork tree containing sessionID, returning its root
+// and the tree's sessions in display order
+func (cb *ChatBot) loadBranchTree(sessionID string) (*branchNode, []*branchNode, error) {
+	// Walk up to the root of the tree
+	rootID := sessionID
+	for {
+		var parentID string
+		err := cb.db.QueryRow("SELECT COALESCE(parent_id, '') FROM sessions WHERE id = ?", rootID).Scan(&parentID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load session %s: %w", rootID, err)
+		}
+		if parentID == "" {
+			break
+		}
+		rootID = parentID
+	}
+
+	root := &branchNode{ID: rootID}
+	if err := cb.db.QueryRow("SELECT COALESCE(title, '') FROM sessions WHERE id = ?", rootID).Scan(&root.Title); err != nil {
+		return nil, nil, fmt.Errorf("failed to load session %s: %w", rootID, err)
+	}
+
+	var order []*branchNode
+	var walk func(node *branchNode) error
+	walk = func(node *branchNode) error {
+		order = append(order, node)
+
+		rows, err := cb.db.Query(
+			"SELECT id, COALESCE(title, ''), COALESCE(fork_seq, 0) FROM sessions WHERE parent_id = ? ORDER BY fork_seq, start_time",
+			node.ID,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to load branches of %s: %w", node.ID, err)
+		}
+		for rows.Next() {
+			child := &branchNode{}
+			if err := rows.Scan(&child.ID, &child.Title, &child.ForkSeq); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan branch: %w", err)
+			}
+			node.Children = append(node.Children, child)
+		}
+		rows.Close()
+
+		for _, child := range node.Children {
+			if err := walk(child); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := walk(root); err != nil {
+		return nil, nil, err
+	}
+	return root, order, nil
+}
+
+// printBranchTree prints a fork tree with numbers usable by /branch. Plain
+// mode draws the tree with ASCII, which screen readers handle better.
+func printBranchTree(root *branchNode, order []*branchNode, currentID string, plain bool) {
+	index := make(map[*branchNode]int, len(order))
+	for i, node := range order {
+		index[node] = i + 1
+	}
+
+	label := func(node *branchNode) string {
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "[%d] %s", index[node], node.ID)
+		if node.ForkSeq > 0 {
+			fmt.Fprintf(&sb, " @ msg %d", node.ForkSeq)
+		}
+		if node.Title != "" {
+			fmt.Fprintf(&sb, " %q", node.Title)
+		}
+		if node.ID == currentID {
+			sb.WriteString(" (current)")
+		}
+		return sb.String()
+	}
+
+	for _, line := range branchTreeLines(root, plain, label) {
+		fmt.Println(line)
+	}
+}
+
+// branchTreeLines draws a fork tree, a line for each session in the order
+// of loadBranchTree, labelled by label
+func branchTreeLines(root *branchNode, plain bool, label func(*branchNode) string) []string {
+	lines := []string{label(root)}
+	var walk func(node *branchNode, prefix string)
+	walk = func(node *branchNode, prefix string) {
+		for i, child := range node.Children {
+			connector, indent := "├── ", "│   "
+			if plain {
+				connector, indent = "|-- ", "|   "
+			}
+			if i == len(node.Children)-1 {
+				connector, indent = "└── ", "    "
+				if plain {
+					connector = "`-- "
+				}
+			}
+			lines = append(lines, prefix+connector+label(child))
+			walk(child, prefix+indent)
+		}
+	}
+	walk(root, "")
+	return lines
+}
+
+// handleForkCommand handles /fork [message-number]
+func (cb *ChatBot) handleForkCommand(args []string) error {
+	atSeq := 0
+	if len(args) > 0 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 0 {
+			return fmt.Errorf("usage: /fork [message-number]")
+		}
+		atSeq = n
+	}
+
+	fork, err := cb.forkSession(atSeq)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Forked %s after message %d into new branch %s\n", fork.ParentID, fork.ForkSeq, fork.ID)
+	return nil
+}
+
+// handleBranchesCommand handles /branches
+func (cb *ChatBot) handleBranchesCommand() error {
+	if err := cb.saveSession(); err != nil {
+		return fmt.Errorf("failed to save current session: %w", err)
+	}
+
+	cb.mu.Lock()
+	currentID := cb.session.ID
+	cb.mu.Unlock()
+
+	root, order, err := cb.loadBranchTree(currentID)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println()
+	printBranchTree(root, order, currentID, cb.cfg().Plain)
+	fmt.Println()
+	return nil
+}
+
+// handleBranchCommand handles /branch <number|session-id>, switching to
+// another branch of the current session's fork tree
+func (cb *ChatBot) handleBranchCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: /branch <number|session-id> (see /branches)")
+	}
+
+	if err := cb.saveSession(); err != nil {
+		return fmt.Errorf("failed to save current session: %w", err)
+	}
+
+	cb.mu.Lock()
+	currentID := cb.session.ID
+	cb.mu.Unlock()
+
+	_, order, err := cb.loadBranchTree(currentID)
+	if err != nil {
+		return err
+	}
+	targetID, err := branchTarget(order, args[0])
+	if err != nil {
+		return err
+	}
+
+	sess, err := cb.loadSession(targetID)
+	if err != nil {
+		return err
+	}
+
+	cb.mu.Lock()
+	cb.session = sess
+	cb.mu.Unlock()
+
+	fmt.Printf("Switched to branch %s (%d messages)\n", sess.ID, sess.Older+len(sess.Messages))
+	return nil
+}
+
+// branchTarget returns the session of a fork tree that arg names by its
+// number in /branches or its ID; other sessions are not branches of it
+func branchTarget(order []*branchNode, arg string) (string, error) {
+	if n, err := strconv.Atoi(arg); err == nil {
+		if n < 1 || n > len(order) {
+			return "", fmt.Errorf("no branch [%d]; see /branches", n)
+		}
+		return order[n-1].ID, nil
+	}
+	for _, node := range order {
+		if node.ID == arg {
+			return node.ID, nil
+		}
+	}
+	return "", fmt.Errorf("%s is not a branch of this session; see /branches", arg)
+}
+
+// handleHistoryCommand handles /history [n], listing the last n messages
+// of the current session with their message numbers
+func (cb *ChatBot) handleHistoryCommand(args []string) error {
+	limit := 20
+	if len(args) > 0 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n <= 0 {
+			return fmt.Errorf("usage: /history [count]")
+		}
+		limit = n
+	}
+
+	cb.mu.Lock()
+	sessionID, older := cb.session.ID, cb.session.Older
+	events := cb.session.Events
+	messages := cb.session.Messages
+	if len(messages) > limit {
+		messages = messages[len(messages)-limit:]
+	}
+	messages = append([]session.Message(nil), messages...)
+	cb.mu.Unlock()
+
+	// Messages before the loaded page are read from the database
+	if n := min(limit-len(messages), older); n > 0 {
+		earlier, err := cb.loadMessages(sessionID, older-n, n)
+		if err != nil {
+			return err
+		}
+		messages = append(earlier, messages...)
+	}
+
+	if len(messages) == 0 {
+		fmt.Println("No messages in this session yet.")
+		return nil
+	}
+
+	// Events are shown between the messages they happened between
+	for len(events) > 0 && events[0].Seq < messages[0].Seq-1 {
+		events = events[1:]
+	}
+	fmt.Println()
+	for _, msg := range messages {
+		for len(events) > 0 && events[0].Seq < msg.Seq {
+			printEvent(events[0])
+			events = events[1:]
+		}
+		truncated := ""
+		if msg.Truncated {
+			truncated = " [truncated]"
+		}
+		fmt.Printf("#%d %s: %s%s\n", msg.Seq, msg.Author(), previewText(msg.Content, 100), truncated)
+	}
+	for _, event := range events {
+		printEvent(event)
+	}
+	fmt.Println()
+	return nil
+}
+
+// previewText shortens text to a single line of at most n runes
+func previewText(text string, n int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	runes := []rune(text)
+	if len(runes) > n {
+		return string(runes[:n-3]) + "..."
+	}
+	return text
+}
@@ -0,0 +1,49 @@
+package chatbot
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBranchTarget(t *testing.T) {
+	order := []*branchNode{{ID: "session_1"}, {ID: "session_2"}, {ID: "session_3"}}
+	tests := []struct {
+		arg, want, wantErr string
+	}{
+		{"2", "session_2", ""},
+		{"session_3", "session_3", ""},
+		{"0", "", "no branch [0]"},
+		{"4", "", "no branch [4]"},
+		{"session_9", "", "session_9 is not a branch of this session"},
+	}
+	for _, tt := range tests {
+		got, err := branchTarget(order, tt.arg)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("branchTarget(%q) = %q, %v, want error %q", tt.arg, got, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("branchTarget(%q) = %q, %v, want %q", tt.arg, got, err, tt.want)
+		}
+	}
+}
+
+func TestBranchTreeLines(t *testing.T) {
+	leaf := &branchNode{ID: "session_3"}
+	root := &branchNode{ID: "session_1", Children: []*branchNode{
+		{ID: "session_2", Children: []*branchNode{leaf}},
+		{ID: "session_4"},
+	}}
+	got := branchTreeLines(root, false, func(node *branchNode) string { return node.ID })
+	want := []string{
+		"session_1",
+		"├── session_2",
+		"│   └── session_3",
+		"└── session_4",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("branchTreeLines =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -1,62 +1,168 @@
 package chatbot
 
 import (
-	"bufio"
-	"bytes"
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
+	"ExtraChat/internal/audit"
 	"ExtraChat/internal/backend"
+	"ExtraChat/internal/backup"
 	"ExtraChat/internal/cache"
+	"ExtraChat/internal/clock"
 	"ExtraChat/internal/config"
+	"ExtraChat/internal/guard"
+	"ExtraChat/internal/lineedit"
 	"ExtraChat/internal/mcp"
+	"ExtraChat/internal/mock"
+	"ExtraChat/internal/native"
+	"ExtraChat/internal/rag"
 	"ExtraChat/internal/session"
 	"ExtraChat/internal/telemetry"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/trace"
 )
 
 // ChatBot represents the main application
 type ChatBot struct {
-	config     config.Config
-	db         *sql.DB
-	cache      sync.Map
-	logger     *slog.Logger
-	tracer     trace.Tracer
-	meter      metric.Meter
-	httpClient *http.Client
-	session    *session.Session
-	mu         sync.Mutex
+	config    atomic.Pointer[config.Config] // Replaced whole, never changed in place; see cfg and updateConfig
+	db        *sql.DB
+	cache     *sync.Map
+	logger    *slog.Logger
+	tracer    trace.Tracer
+	meter     metric.Meter
+	httpPools map[string]*httpPool // Keep-alive connections by backend; see httpClient
+	clock     clock.Clock          // Times backoffs, pacing and mock latency
+	history   *conversationCache   // Encoded messages reused by the next turn's request
+	session   *session.Session
+	locks     *session.Locks // Per-session turn locks
+	mu        sync.Mutex
+
+	shutdownTelemetry func()    // Flushes spans and metrics
+	closeOnce         sync.Once // Close runs once, from /quit or a signal
+
+	spanRecorder *telemetry.SpanRecorder // Recent spans for /trace
+	lastTraceID  trace.TraceID           // Trace of the most recent turn
+	cancelTurn   context.CancelFunc      // Aborts the REPL turn in flight; nil at the prompt
+
+	input         *lineedit.Editor // Interactive input, shared by the REPL and tool confirmations
+	tui           *terminalUI      // The full-screen interface of --tui; nil in the REPL
+	confirmMu     sync.Mutex       // Serializes tool confirmation prompts
+	approvedTools map[string]bool  // Tools approved with "always" in this run, by toolKey
+	sentSecrets   map[string]bool  // Secrets the user chose to send as is
+
+	titlePending bool           // A title background job is running
+	turnJobs     sync.WaitGroup // Saves and titling after turns, awaited by the API server
+	jobs         *jobRunner     // Prompts queued with /async
+	notifier     Notifier       // Desktop notifications of slow replies; nil uses the platform's
+
+	attachments []attachment // Context sent with the next prompt (--file, stdin)
+
+	progress *progressDisplay // Status line for backend requests and running tool calls
+
+	turnStats *turnStats // Turn latency and outcomes for /stats; nil if metrics failed to set up
+	pprofAddr string     // Address the pprof endpoint listens on; empty when disabled
+
+	backups *backup.Scheduler // Nightly database snapshots; nil when disabled
+	audit   *audit.Log        // Prompt/response audit log; nil when disabled
+	records *json.Encoder     // Turn records on stdout with --output json; nil otherwise
+
+	modelInfo  *modelInfoCache // Ollama model metadata, for context windows
+	modelLists *modelListCache // Models the backends offer, for /list-models
+
+	mock         *mock.Backend // Offline backend, built on first use; guarded by mu
+	mockSettings mockSettings  // Settings mock was built from
+
+	loadConfig func() (config.Config, error) // Rebuilds the config for hot reload; nil disables it
+	reloadMu   sync.Mutex                    // Serializes config reloads
 
 	// MCP support
-	mcpRegistry *mcp.ClientRegistry // Registry of MCP clients
-	mcpTools    []mcp.Tool           // Available tools from all MCP servers
+	mcpRegistry *mcp.ClientRegistry         // Registry of MCP clients
+	mcpTools    []mcp.Tool                  // Available tools from all MCP servers
+	mcpMu       sync.RWMutex                // Guards mcpTools, refreshed on server notifications
+	mcpHealth   *mcpHealth                  // Health checks and per-server stats
+	mcpServers  map[string]mcp.ServerConfig // Definitions of the connected servers, for reloads
+	mcpOptions  []mcp.Option                // Transport, clock and launcher of the MCP clients
+}
+
+// cfg returns the current configuration. Reloads and settings replace it
+// rather than change it, so it is safe to read without cb.mu while they
+// run, and must never be modified.
+func (cb *ChatBot) cfg() *config.Config {
+	return cb.config.Load()
+}
+
+// updateConfig replaces the configuration with a copy that change was
+// applied to; callers must hold cb.mu, which serializes the writers
+func (cb *ChatBot) updateConfig(change func(c *config.Config)) {
+	next := *cb.config.Load()
+	change(&next)
+	cb.config.Store(&next)
+}
+
+// llmTarget identifies where a request is sent
+type llmTarget struct {
+	Backend string
+	Model   string
+	Tools   bool   // Offer MCP tools to the model
+	System  string // System prompt; empty sends none
+}
+
+// Dependencies are the ChatBot's connections to the outside world; zero
+// fields use the real ones. Tests inject fakes to simulate timeouts, retries
+// and failing MCP server processes deterministically.
+type Dependencies struct {
+	Transport http.RoundTripper // Sends backend API and remote MCP requests
+	Clock     clock.Clock       // Times retry backoffs, rate limit pacing and mock latency
+	Launcher  mcp.Launcher      // Starts stdio MCP servers
+	Notifier  Notifier          // Shows desktop notifications
 }
 
 // NewChatBot creates a new ChatBot instance
 func NewChatBot(cfg config.Config) (*ChatBot, error) {
-	logger, err := telemetry.InitLogger()
+	return NewChatBotWith(cfg, Dependencies{})
+}
+
+// NewChatBotWith creates a ChatBot with injected dependencies
+func NewChatBotWith(cfg config.Config, deps Dependencies) (*ChatBot, error) {
+	logger, err := telemetry.InitLogger(cfg.LogDir, cfg.SlogLevel())
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize logger: %w", err)
 	}
 
 	ctx := context.Background()
-	tracer, meter, _, err := telemetry.InitTelemetry(ctx)
-	if err != nil {
-		return nil, fmt.Errorf("failed to initialize telemetry: %w", err)
+	spanRecorder := telemetry.NewSpanRecorder(maxRecordedTraces)
+	var tracer trace.Tracer
+	var meter metric.Meter
+	var shutdownTelemetry func()
+	if cfg.TelemetryEnabled {
+		tracer, meter, shutdownTelemetry, err = telemetry.InitTelemetry(ctx, cfg.LogDir, spanRecorder)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize telemetry: %w", err)
+		}
+	} else {
+		tracer, meter, shutdownTelemetry = telemetry.NoopTelemetry()
 	}
 
-	db, err := telemetry.InitDB()
+	db, err := telemetry.InitDB(cfg.DBPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize database: %w", err)
 	}
@@ -64,14 +170,78 @@ func NewChatBot(cfg config.Config) (*ChatBot, error) {
 	if cfg.Debug {
 		logger.Info("Debug mode enabled")
 	}
+	for _, v := range cfg.EnvFileVars {
+		// Values are never logged; they are usually API keys
+		logger.Debug("environment variable from .env file", "file", v.File, "name", v.Name, "value", "[redacted]", "skipped", v.Skipped, "ignored", v.Ignored)
+	}
+
+	pools, err := newHTTPPools(cfg, deps.Transport, meter)
+	if err != nil {
+		return nil, err
+	}
 
 	cb := &ChatBot{
-		config:     cfg,
-		db:         db,
-		logger:     logger,
-		tracer:     tracer,
-		meter:      meter,
-		httpClient: &http.Client{Timeout: 60 * time.Second},
+		db:        db,
+		cache:     &sync.Map{},
+		logger:    logger,
+		tracer:    tracer,
+		meter:     meter,
+		httpPools: pools,
+		clock:     clock.Or(deps.Clock),
+		notifier:  deps.Notifier,
+		history:   newConversationCache(),
+		locks:     session.NewLocks(),
+		jobs:      newJobRunner(),
+
+		shutdownTelemetry: shutdownTelemetry,
+
+		spanRecorder:  spanRecorder,
+		approvedTools: make(map[string]bool),
+		sentSecrets:   make(map[string]bool),
+		modelInfo:     newModelInfoCache(),
+		modelLists:    newModelListCache(),
+		progress:      newProgressDisplay(os.Stdout, cfg.Plain || !isTerminal(os.Stdout)),
+	}
+	cb.config.Store(&cfg)
+	if deps.Transport != nil {
+		cb.mcpOptions = append(cb.mcpOptions, mcp.WithTransport(deps.Transport))
+	}
+	if deps.Clock != nil {
+		cb.mcpOptions = append(cb.mcpOptions, mcp.WithClock(deps.Clock))
+	}
+	if deps.Launcher != nil {
+		cb.mcpOptions = append(cb.mcpOptions, mcp.WithLauncher(deps.Launcher))
+	}
+
+	if cfg.RecordDir != "" || cfg.ReplayDir != "" {
+		if err := cb.setupVCR(); err != nil {
+			return nil, err
+		}
+	}
+
+	stats, err := newTurnStats(meter)
+	if err != nil {
+		logger.Warn("failed to set up turn metrics", "error", err)
+	}
+	cb.turnStats = stats
+
+	if cfg.BackupDir != "" {
+		at, err := backup.ParseTimeOfDay(cfg.BackupTime)
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure backups: %w", err)
+		}
+		cb.backups = backup.NewScheduler(db, cfg.BackupDir, cfg.BackupRetention, at, logger, cb.clock)
+	}
+
+	if cfg.AuditLog != "" {
+		cb.audit, err = audit.Open(cfg.AuditLog, audit.Rotation{
+			MaxSizeMB:  cfg.AuditMaxSize,
+			MaxBackups: cfg.AuditMaxBackups,
+			MaxAgeDays: cfg.AuditMaxAge,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to open audit log: %w", err)
+		}
 	}
 
 	if cfg.SessionID != "" {
@@ -89,7 +259,11 @@ func NewChatBot(cfg config.Config) (*ChatBot, error) {
 
 	// Initialize MCP if enabled
 	if cfg.MCPEnabled {
-		if err := cb.initializeMCP(); err != nil {
+		servers, err := mcpServerConfigs(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load MCP servers: %w", err)
+		}
+		if err := cb.initializeMCP(servers); err != nil {
 			logger.Warn("failed to initialize MCP, continuing without MCP support", "error", err)
 		}
 	}
@@ -99,31 +273,94 @@ func NewChatBot(cfg config.Config) (*ChatBot, error) {
 
 // newSession creates a new session
 func (cb *ChatBot) newSession() *session.Session {
-	sessionID := fmt.Sprintf("session_%d", time.Now().Unix())
+	sessionID := cb.newSessionID()
 	sess := &session.Session{
 		ID:        sessionID,
 		StartTime: time.Now(),
-		Backend:   cb.config.Backend,
+		Backend:   cb.cfg().Backend,
 		Messages:  []session.Message{},
 	}
-	cb.logger.Info("created new session", "session_id", sessionID, "backend", cb.config.Backend)
+	cb.logger.Info("created new session", "session_id", sessionID, "backend", cb.cfg().Backend)
 	return sess
 }
 
-// loadSession loads a session from the database
+// loadSession loads a session from the database with its most recent page
+// of messages
 func (cb *ChatBot) loadSession(sessionID string) (*session.Session, error) {
+	return cb.loadSessionPage(sessionID, cb.cfg().PageSize)
+}
+
+// loadSessionPage loads a session with its last limit messages, counting
+// the rest in Older; limit <= 0 loads every message
+func (cb *ChatBot) loadSessionPage(sessionID string, limit int) (*session.Session, error) {
 	var backend string
 	var startTime time.Time
-
-	err := cb.db.QueryRow("SELECT backend, start_time FROM sessions WHERE id = ?", sessionID).
-		Scan(&backend, &startTime)
+	var version int
+	var title string
+	var persona string
+	var summary string
+	var parentID string
+	var forkSeq int
+	var tenant string
+	var documents, collection string
+	var events string
+	var model string
+
+	err := cb.db.QueryRow(
+		"SELECT backend, start_time, version, COALESCE(title, ''), COALESCE(persona, ''), COALESCE(summary, ''), COALESCE(parent_id, ''), COALESCE(fork_seq, 0), COALESCE(tenant, ''), COALESCE(documents, ''), COALESCE(collection, ''), COALESCE(events, ''), COALESCE(model, '') FROM sessions WHERE id = ?",
+		sessionID,
+	).Scan(&backend, &startTime, &version, &title, &persona, &summary, &parentID, &forkSeq, &tenant, &documents, &collection, &events, &model)
 	if err != nil {
 		return nil, fmt.Errorf("session not found: %w", err)
 	}
+	sessionEvents, err := decodeEvents(events)
+	if err != nil {
+		cb.logger.Warn("ignoring unreadable session events", "session_id", sessionID, "error", err)
+	}
+
+	// Long sessions keep only their most recent page in memory
+	older := 0
+	if limit > 0 {
+		var count int
+		if err := cb.db.QueryRow("SELECT COUNT(*) FROM messages WHERE session_id = ?", sessionID).Scan(&count); err != nil {
+			return nil, fmt.Errorf("failed to count messages: %w", err)
+		}
+		older = max(count-limit, 0)
+	}
+	messages, err := cb.loadMessages(sessionID, older, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return &session.Session{
+		ID:         sessionID,
+		StartTime:  startTime,
+		Backend:    backend,
+		Model:      model,
+		Title:      title,
+		Persona:    persona,
+		Summary:    summary,
+		ParentID:   parentID,
+		ForkSeq:    forkSeq,
+		Tenant:     tenant,
+		Documents:  splitDocuments(documents),
+		Collection: collection,
+		Version:    version,
+		Older:      older,
+		Events:     sessionEvents,
+		Messages:   messages,
+	}, nil
+}
 
+// loadMessages loads up to limit messages of a session in order, skipping
+// the first offset; limit <= 0 loads the rest
+func (cb *ChatBot) loadMessages(sessionID string, offset, limit int) ([]session.Message, error) {
+	if limit <= 0 {
+		limit = -1 // No limit for SQLite
+	}
 	rows, err := cb.db.Query(
-		"SELECT role, content, timestamp FROM messages WHERE session_id = ? ORDER BY timestamp",
-		sessionID,
+		"SELECT uuid, seq, role, content, timestamp, COALESCE(citations, ''), COALESCE(speaker, ''), COALESCE(route, ''), COALESCE(truncated, 0) FROM messages WHERE session_id = ? ORDER BY seq, id LIMIT ? OFFSET ?",
+		sessionID, limit, offset,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load messages: %w", err)
@@ -133,18 +370,22 @@ func (cb *ChatBot) loadSession(sessionID string) (*session.Session, error) {
 	messages := []session.Message{}
 	for rows.Next() {
 		var msg session.Message
-		if err := rows.Scan(&msg.Role, &msg.Content, &msg.Timestamp); err != nil {
+		var citations, route string
+		if err := rows.Scan(&msg.ID, &msg.Seq, &msg.Role, &msg.Content, &msg.Timestamp, &citations, &msg.Speaker, &route, &msg.Truncated); err != nil {
 			return nil, fmt.Errorf("failed to scan message: %w", err)
 		}
+		if msg.Citations, err = decodeCitations(citations); err != nil {
+			cb.logger.Warn("ignoring unreadable citations", "message", msg.ID, "error", err)
+		}
+		if msg.Route, err = decodeRoute(route); err != nil {
+			cb.logger.Warn("ignoring unreadable routing decision", "message", msg.ID, "error", err)
+		}
 		messages = append(messages, msg)
 	}
-
-	return &session.Session{
-		ID:        sessionID,
-		StartTime: startTime,
-		Backend:   backend,
-		Messages:  messages,
-	}, nil
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to load messages: %w", err)
+	}
+	return messages, nil
 }
 
 // saveSession saves the current session to the database
@@ -158,18 +399,53 @@ func (cb *ChatBot) saveSession() error {
 	}
 	defer tx.Rollback()
 
-	_, err = tx.Exec(
-		"INSERT OR REPLACE INTO sessions (id, start_time, backend) VALUES (?, ?, ?)",
-		cb.session.ID, cb.session.StartTime, cb.session.Backend,
+	events, err := encodeEvents(cb.session.Events)
+	if err != nil {
+		cb.logger.Warn("failed to save session events", "session_id", cb.session.ID, "error", err)
+	}
+
+	// Optimistic concurrency: the write only succeeds if nobody else has saved
+	// this session since we loaded it
+	res, err := tx.Exec(
+		"UPDATE sessions SET backend = ?, model = NULLIF(?, ''), persona = NULLIF(?, ''), documents = NULLIF(?, ''), collection = NULLIF(?, ''), events = NULLIF(?, ''), version = version + 1 WHERE id = ? AND version = ?",
+		cb.session.Backend, cb.session.Model, cb.session.Persona, joinDocuments(cb.session.Documents), cb.session.Collection, events, cb.session.ID, cb.session.Version,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to save session: %w", err)
 	}
+	if updated, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to save session: %w", err)
+	} else if updated == 0 {
+		var exists int
+		if err := tx.QueryRow("SELECT COUNT(*) FROM sessions WHERE id = ?", cb.session.ID).Scan(&exists); err != nil {
+			return fmt.Errorf("failed to save session: %w", err)
+		}
+		if exists > 0 {
+			return fmt.Errorf("failed to save session %s: %w", cb.session.ID, session.ErrVersionConflict)
+		}
+		_, err = tx.Exec(
+			"INSERT INTO sessions (id, start_time, backend, model, persona, version, parent_id, fork_seq, tenant, documents, collection, events) VALUES (?, ?, ?, NULLIF(?, ''), NULLIF(?, ''), ?, NULLIF(?, ''), ?, NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''))",
+			cb.session.ID, cb.session.StartTime, cb.session.Backend, cb.session.Model, cb.session.Persona, cb.session.Version+1,
+			cb.session.ParentID, cb.session.ForkSeq, cb.session.Tenant, joinDocuments(cb.session.Documents), cb.session.Collection, events,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to save session: %w", err)
+		}
+	}
 
+	// Messages already persisted by an earlier save are skipped by UUID
 	for _, msg := range cb.session.Messages {
+		citations, err := encodeCitations(msg.Citations)
+		if err != nil {
+			cb.logger.Warn("failed to save citations", "message", msg.ID, "error", err)
+		}
+		route, err := encodeRoute(msg.Route)
+		if err != nil {
+			cb.logger.Warn("failed to save routing decision", "message", msg.ID, "error", err)
+		}
 		_, err = tx.Exec(
-			"INSERT INTO messages (session_id, role, content, timestamp) VALUES (?, ?, ?, ?)",
-			cb.session.ID, msg.Role, msg.Content, msg.Timestamp,
+			"INSERT OR IGNORE INTO messages (uuid, session_id, seq, role, content, timestamp, citations, speaker, route, truncated) VALUES (?, ?, ?, ?, ?, ?, NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, 0))",
+			msg.ID, cb.session.ID, msg.Seq, msg.Role, msg.Content, msg.Timestamp, citations, msg.Speaker, route, msg.Truncated,
 		)
 		if err != nil {
 			cb.logger.Warn("failed to save message", "error", err)
@@ -179,15 +455,23 @@ func (cb *ChatBot) saveSession() error {
 	if err := tx.Commit(); err != nil {
 		return fmt.Errorf("failed to commit transaction: %w", err)
 	}
+	cb.session.Version++
 
-	cb.logger.Info("session saved", "session_id", cb.session.ID, "message_count", len(cb.session.Messages))
+	cb.logger.Info("session saved", "session_id", cb.session.ID, "message_count", len(cb.session.Messages), "version", cb.session.Version)
 	return nil
 }
 
 // checkCache checks if a response is cached
 func (cb *ChatBot) checkCache(cacheKey string) (string, bool) {
+	if !cb.cfg().CacheEnabled {
+		return "", false
+	}
 	if val, ok := cb.cache.Load(cacheKey); ok {
 		cached := val.(cache.CachedResponse)
+		if cb.cfg().CacheTTL > 0 && time.Since(cached.Timestamp) > cb.cfg().CacheTTL {
+			cb.cache.Delete(cacheKey)
+			return "", false
+		}
 		cb.logger.Info("cache hit", "key", cacheKey[:16])
 		return cached.Response, true
 	}
@@ -196,6 +480,9 @@ func (cb *ChatBot) checkCache(cacheKey string) (string, bool) {
 
 // storeCache stores a response in cache
 func (cb *ChatBot) storeCache(cacheKey, response string) {
+	if !cb.cfg().CacheEnabled {
+		return
+	}
 	cb.cache.Store(cacheKey, cache.CachedResponse{
 		Response:  response,
 		Timestamp: time.Now(),
@@ -226,8 +513,9 @@ func (cb *ChatBot) recordMetrics(ctx context.Context, usage map[string]interface
 
 // convertMCPToolsToAnthropic converts MCP tools to Anthropic tool format
 func (cb *ChatBot) convertMCPToolsToAnthropic() []backend.AnthropicTool {
-	tools := make([]backend.AnthropicTool, len(cb.mcpTools))
-	for i, mcpTool := range cb.mcpTools {
+	mcpTools := cb.getMCPTools()
+	tools := make([]backend.AnthropicTool, len(mcpTools))
+	for i, mcpTool := range mcpTools {
 		tools[i] = backend.AnthropicTool{
 			Name:        mcpTool.Name,
 			Description: mcpTool.Description,
@@ -238,70 +526,76 @@ func (cb *ChatBot) convertMCPToolsToAnthropic() []backend.AnthropicTool {
 }
 
 // callAnthropic calls the Anthropic API
-func (cb *ChatBot) callAnthropic(ctx context.Context, messages []session.Message) (string, error) {
+func (cb *ChatBot) callAnthropic(ctx context.Context, target llmTarget, messages []session.Message) (string, error) {
 	ctx, span := cb.tracer.Start(ctx, "anthropic_api_call")
 	defer span.End()
 
 	start := time.Now()
 
-	apiKey := os.Getenv("ANTHROPIC_API_KEY")
+	apiKey := cb.cfg().APIKey(config.BackendAnthropic)
 	if apiKey == "" {
-		return "", fmt.Errorf("ANTHROPIC_API_KEY not set")
+		return "", fmt.Errorf("ANTHROPIC_API_KEY not set (or store a key with: extrachat auth set anthropic)")
 	}
 
 	// Convert session messages to Anthropic message format
-	reqMessages := make([]backend.AnthropicMessage, len(messages))
-	for i, msg := range messages {
-		reqMessages[i] = backend.AnthropicMessage{
-			Role:    msg.Role,
-			Content: msg.Content,
-		}
+	target.System, messages, _ = shapeHistory(anthropicFormat, target.System, messages)
+	reqMessages, err := cb.history.appendMessages(nil, anthropicFormat, messages)
+	if err != nil {
+		return "", err
 	}
 
 	// Build request with tools if MCP is enabled
 	reqBody := backend.AnthropicRequest{
-		Model:     "claude-sonnet-4-20250514",
+		Model:     target.Model,
 		MaxTokens: 1024,
+		System:    target.System,
 		Messages:  reqMessages,
+
+		StopSequences: cb.stopSequences(ctx),
 	}
 
 	// Add MCP tools if available
-	if cb.config.MCPEnabled && len(cb.mcpTools) > 0 {
+	if target.Tools && cb.cfg().MCPEnabled && len(cb.getMCPTools()) > 0 {
 		reqBody.Tools = cb.convertMCPToolsToAnthropic()
 	}
 
-	jsonData, err := json.Marshal(reqBody)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal request: %w", err)
-	}
+	// API clients get the reply as it is generated
+	emit := turnEventsFrom(ctx)
+	reqBody.Stream = emit != nil
 
-	req, err := http.NewRequestWithContext(ctx, "POST", "https://api.anthropic.com/v1/messages", bytes.NewBuffer(jsonData))
+	req, release, err := newJSONRequest(ctx, cb.endpoint(config.BackendAnthropic, "/v1/messages"), reqBody)
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+		return "", err
 	}
+	defer release()
 
 	req.Header.Set("x-api-key", apiKey)
 	req.Header.Set("anthropic-version", "2023-06-01")
-	req.Header.Set("content-type", "application/json")
 
-	resp, err := cb.httpClient.Do(req)
+	resp, err := cb.httpClient(config.BackendAnthropic, emit != nil).Do(req)
 	if err != nil {
 		return "", fmt.Errorf("failed to send request: %w", err)
 	}
 	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("failed to read response: %w", err)
-	}
+	var apiResp backend.AnthropicResponse
+	if emit != nil && resp.StatusCode == http.StatusOK {
+		if apiResp, err = readAnthropicStream(resp.Body, emit); err != nil {
+			return "", fmt.Errorf("failed to read response stream: %w", err)
+		}
+	} else {
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return "", fmt.Errorf("failed to read response: %w", err)
+		}
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("API error: %s - %s", resp.Status, string(body))
-	}
+		if resp.StatusCode != http.StatusOK {
+			return "", newAPIError("API error", resp, body)
+		}
 
-	var apiResp backend.AnthropicResponse
-	if err := json.Unmarshal(body, &apiResp); err != nil {
-		return "", fmt.Errorf("failed to unmarshal response: %w", err)
+		if err := json.Unmarshal(body, &apiResp); err != nil {
+			return "", fmt.Errorf("failed to unmarshal response: %w", err)
+		}
 	}
 
 	duration := time.Since(start)
@@ -314,10 +608,11 @@ func (cb *ChatBot) callAnthropic(ctx context.Context, messages []session.Message
 	}
 
 	cb.recordMetrics(ctx, apiResp.Usage)
+	cb.recordUsage(ctx, target, apiResp.Usage)
 
 	// Handle tool use
 	if apiResp.StopReason == "tool_use" {
-		return cb.handleAnthropicToolUse(ctx, messages, apiResp)
+		return cb.handleAnthropicToolUse(ctx, target, reqMessages, apiResp)
 	}
 
 	// Extract text response
@@ -330,57 +625,73 @@ func (cb *ChatBot) callAnthropic(ctx context.Context, messages []session.Message
 	return "", fmt.Errorf("empty response from Anthropic")
 }
 
+// chatMessages converts session messages to the role/content format of the
+// Ollama and OpenAI-compatible APIs, led by the system prompt if there is one
+func (cb *ChatBot) chatMessages(target llmTarget, messages []session.Message) ([]json.RawMessage, error) {
+	_, messages, _ = shapeHistory(chatFormat, target.System, messages)
+	reqMessages := make([]json.RawMessage, 0, len(messages)+1)
+	if target.System != "" {
+		system, err := chatFormat.encode("system", target.System)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode system prompt: %w", err)
+		}
+		reqMessages = append(reqMessages, system)
+	}
+	return cb.history.appendMessages(reqMessages, chatFormat, messages)
+}
+
 // callOllama calls the Ollama API
-func (cb *ChatBot) callOllama(ctx context.Context, messages []session.Message) (string, error) {
+func (cb *ChatBot) callOllama(ctx context.Context, target llmTarget, messages []session.Message) (string, error) {
 	ctx, span := cb.tracer.Start(ctx, "ollama_api_call")
 	defer span.End()
 
 	start := time.Now()
 
-	reqMessages := make([]map[string]string, len(messages))
-	for i, msg := range messages {
-		reqMessages[i] = map[string]string{
-			"role":    msg.Role,
-			"content": msg.Content,
-		}
+	reqMessages, err := cb.chatMessages(target, messages)
+	if err != nil {
+		return "", err
 	}
 
+	// API clients get the reply as it is generated
+	emit := turnEventsFrom(ctx)
 	reqBody := backend.OllamaRequest{
-		Model:    cb.config.OllamaModel,
-		Messages: reqMessages,
-		Stream:   false,
-	}
-
-	jsonData, err := json.Marshal(reqBody)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal request: %w", err)
+		Model:     target.Model,
+		Messages:  reqMessages,
+		Stream:    emit != nil,
+		Options:   cb.ollamaOptions(ctx),
+		KeepAlive: cb.cfg().OllamaOptions.KeepAliveValue(),
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", "http://localhost:11434/api/chat", bytes.NewBuffer(jsonData))
+	req, release, err := newJSONRequest(ctx, cb.endpoint(config.BackendOllama, "/api/chat"), reqBody)
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+		return "", err
 	}
+	defer release()
 
-	req.Header.Set("content-type", "application/json")
-
-	resp, err := cb.httpClient.Do(req)
+	resp, err := cb.httpClient(config.BackendOllama, emit != nil).Do(req)
 	if err != nil {
 		return "", fmt.Errorf("failed to send request: %w", err)
 	}
 	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("failed to read response: %w", err)
-	}
+	var apiResp backend.OllamaResponse
+	if emit != nil && resp.StatusCode == http.StatusOK {
+		if apiResp, err = readOllamaStream(resp.Body, emit); err != nil {
+			return "", fmt.Errorf("failed to read response stream: %w", err)
+		}
+	} else {
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return "", fmt.Errorf("failed to read response: %w", err)
+		}
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("API error: %s - %s", resp.Status, string(body))
-	}
+		if resp.StatusCode != http.StatusOK {
+			return "", newAPIError("API error", resp, body)
+		}
 
-	var apiResp backend.OllamaResponse
-	if err := json.Unmarshal(body, &apiResp); err != nil {
-		return "", fmt.Errorf("failed to unmarshal response: %w", err)
+		if err := json.Unmarshal(body, &apiResp); err != nil {
+			return "", fmt.Errorf("failed to unmarshal response: %w", err)
+		}
 	}
 
 	duration := time.Since(start)
@@ -392,65 +703,78 @@ func (cb *ChatBot) callOllama(ctx context.Context, messages []session.Message) (
 		histogram.Record(ctx, float64(duration.Milliseconds()))
 	}
 
+	usage := map[string]interface{}{
+		"prompt_tokens":     float64(apiResp.PromptEvalCount),
+		"completion_tokens": float64(apiResp.EvalCount),
+	}
+	cb.recordMetrics(ctx, usage)
+	cb.recordUsage(ctx, target, usage)
+
 	return apiResp.Message.Content, nil
 }
 
 // callGrok calls the Grok API
-func (cb *ChatBot) callGrok(ctx context.Context, messages []session.Message) (string, error) {
+func (cb *ChatBot) callGrok(ctx context.Context, target llmTarget, messages []session.Message) (string, error) {
 	ctx, span := cb.tracer.Start(ctx, "grok_api_call")
 	defer span.End()
 
 	start := time.Now()
 
-	apiKey := os.Getenv("GROK_API_KEY")
+	apiKey := cb.cfg().APIKey(config.BackendGrok)
 	if apiKey == "" {
-		return "", fmt.Errorf("GROK_API_KEY not set")
+		return "", fmt.Errorf("GROK_API_KEY not set (or store a key with: extrachat auth set grok)")
 	}
 
-	reqMessages := make([]map[string]string, len(messages))
-	for i, msg := range messages {
-		reqMessages[i] = map[string]string{
-			"role":    msg.Role,
-			"content": msg.Content,
-		}
+	reqMessages, err := cb.chatMessages(target, messages)
+	if err != nil {
+		return "", err
 	}
 
 	reqBody := backend.OpenAIRequest{
-		Model:    "grok-1",
+		Model:    target.Model,
 		Messages: reqMessages,
+		Stop:     cb.stopSequences(ctx),
 	}
 
-	jsonData, err := json.Marshal(reqBody)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal request: %w", err)
+	// API clients get the reply as it is generated
+	emit := turnEventsFrom(ctx)
+	if emit != nil {
+		reqBody.Stream = true
+		reqBody.StreamOptions = &backend.OpenAIStreamOptions{IncludeUsage: true}
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", "https://api.grok.x.ai/v1/chat/completions", bytes.NewBuffer(jsonData))
+	req, release, err := newJSONRequest(ctx, cb.endpoint(config.BackendGrok, "/v1/chat/completions"), reqBody)
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+		return "", err
 	}
+	defer release()
 
 	req.Header.Set("Authorization", "Bearer "+apiKey)
-	req.Header.Set("content-type", "application/json")
 
-	resp, err := cb.httpClient.Do(req)
+	resp, err := cb.httpClient(config.BackendGrok, emit != nil).Do(req)
 	if err != nil {
 		return "", fmt.Errorf("failed to send request: %w", err)
 	}
 	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("failed to read response: %w", err)
-	}
+	var apiResp backend.OpenAIResponse
+	if emit != nil && resp.StatusCode == http.StatusOK {
+		if apiResp, err = readOpenAIStream(resp.Body, emit); err != nil {
+			return "", fmt.Errorf("failed to read response stream: %w", err)
+		}
+	} else {
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return "", fmt.Errorf("failed to read response: %w", err)
+		}
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("API error: %s - %s", resp.Status, string(body))
-	}
+		if resp.StatusCode != http.StatusOK {
+			return "", newAPIError("API error", resp, body)
+		}
 
-	var apiResp backend.OpenAIResponse
-	if err := json.Unmarshal(body, &apiResp); err != nil {
-		return "", fmt.Errorf("failed to unmarshal response: %w", err)
+		if err := json.Unmarshal(body, &apiResp); err != nil {
+			return "", fmt.Errorf("failed to unmarshal response: %w", err)
+		}
 	}
 
 	duration := time.Since(start)
@@ -463,6 +787,7 @@ func (cb *ChatBot) callGrok(ctx context.Context, messages []session.Message) (st
 	}
 
 	cb.recordMetrics(ctx, apiResp.Usage)
+	cb.recordUsage(ctx, target, apiResp.Usage)
 
 	if len(apiResp.Choices) > 0 {
 		return apiResp.Choices[0].Message.Content, nil
@@ -472,61 +797,67 @@ func (cb *ChatBot) callGrok(ctx context.Context, messages []session.Message) (st
 }
 
 // callOpenAI calls the OpenAI API
-func (cb *ChatBot) callOpenAI(ctx context.Context, messages []session.Message) (string, error) {
+func (cb *ChatBot) callOpenAI(ctx context.Context, target llmTarget, messages []session.Message) (string, error) {
 	ctx, span := cb.tracer.Start(ctx, "openai_api_call")
 	defer span.End()
 
 	start := time.Now()
 
-	apiKey := os.Getenv("OPENAI_API_KEY")
+	apiKey := cb.cfg().APIKey(config.BackendOpenAI)
 	if apiKey == "" {
-		return "", fmt.Errorf("OPENAI_API_KEY not set")
+		return "", fmt.Errorf("OPENAI_API_KEY not set (or store a key with: extrachat auth set openai)")
 	}
 
-	reqMessages := make([]map[string]string, len(messages))
-	for i, msg := range messages {
-		reqMessages[i] = map[string]string{
-			"role":    msg.Role,
-			"content": msg.Content,
-		}
+	reqMessages, err := cb.chatMessages(target, messages)
+	if err != nil {
+		return "", err
 	}
 
 	reqBody := backend.OpenAIRequest{
-		Model:    "gpt-3.5-turbo",
+		Model:    target.Model,
 		Messages: reqMessages,
+		Stop:     cb.stopSequences(ctx),
 	}
 
-	jsonData, err := json.Marshal(reqBody)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal request: %w", err)
+	// API clients get the reply as it is generated
+	emit := turnEventsFrom(ctx)
+	if emit != nil {
+		reqBody.Stream = true
+		reqBody.StreamOptions = &backend.OpenAIStreamOptions{IncludeUsage: true}
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", "https://api.openai.com/v1/chat/completions", bytes.NewBuffer(jsonData))
+	req, release, err := newJSONRequest(ctx, cb.endpoint(config.BackendOpenAI, "/v1/chat/completions"), reqBody)
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+		return "", err
 	}
+	defer release()
 
 	req.Header.Set("Authorization", "Bearer "+apiKey)
-	req.Header.Set("content-type", "application/json")
 
-	resp, err := cb.httpClient.Do(req)
+	resp, err := cb.httpClient(config.BackendOpenAI, emit != nil).Do(req)
 	if err != nil {
 		return "", fmt.Errorf("failed to send request: %w", err)
 	}
 	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("failed to read response: %w", err)
-	}
+	var apiResp backend.OpenAIResponse
+	if emit != nil && resp.StatusCode == http.StatusOK {
+		if apiResp, err = readOpenAIStream(resp.Body, emit); err != nil {
+			return "", fmt.Errorf("failed to read response stream: %w", err)
+		}
+	} else {
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return "", fmt.Errorf("failed to read response: %w", err)
+		}
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("API error: %s - %s", resp.Status, string(body))
-	}
+		if resp.StatusCode != http.StatusOK {
+			return "", newAPIError("API error", resp, body)
+		}
 
-	var apiResp backend.OpenAIResponse
-	if err := json.Unmarshal(body, &apiResp); err != nil {
-		return "", fmt.Errorf("failed to unmarshal response: %w", err)
+		if err := json.Unmarshal(body, &apiResp); err != nil {
+			return "", fmt.Errorf("failed to unmarshal response: %w", err)
+		}
 	}
 
 	duration := time.Since(start)
@@ -539,6 +870,7 @@ func (cb *ChatBot) callOpenAI(ctx context.Context, messages []session.Message) (
 	}
 
 	cb.recordMetrics(ctx, apiResp.Usage)
+	cb.recordUsage(ctx, target, apiResp.Usage)
 
 	if len(apiResp.Choices) > 0 {
 		return apiResp.Choices[0].Message.Content, nil
@@ -549,12 +881,12 @@ func (cb *ChatBot) callOpenAI(ctx context.Context, messages []session.Message) (
 
 // listOllamaModels fetches the list of available Ollama models
 func (cb *ChatBot) listOllamaModels(ctx context.Context) ([]backend.OllamaModel, error) {
-	req, err := http.NewRequestWithContext(ctx, "GET", "http://localhost:11434/api/tags", nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", cb.endpoint(config.BackendOllama, "/api/tags"), nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	resp, err := cb.httpClient.Do(req)
+	resp, err := cb.httpClient(config.BackendOllama, false).Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to send request (is Ollama running?): %w", err)
 	}
@@ -566,7 +898,7 @@ func (cb *ChatBot) listOllamaModels(ctx context.Context) ([]backend.OllamaModel,
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API error: %s - %s", resp.Status, string(body))
+		return nil, newAPIError("API error", resp, body)
 	}
 
 	var tagsResp backend.OllamaTagsResponse
@@ -577,244 +909,475 @@ func (cb *ChatBot) listOllamaModels(ctx context.Context) ([]backend.OllamaModel,
 	return tagsResp.Models, nil
 }
 
-// sendMessage sends a message to the current backend
-func (cb *ChatBot) sendMessage(ctx context.Context, userMessage string) (string, error) {
+// sessionModel returns the model the turns of a session use: its own, picked
+// by a persona or model alias, or else its backend's configured one; callers
+// must hold cb.mu
+func (cb *ChatBot) sessionModel(sess *session.Session) string {
+	if sess.Model != "" {
+		return sess.Model
+	}
+	return cb.modelFor(sess.Backend)
+}
+
+// modelFor returns the configured model for a backend; callers must hold cb.mu
+func (cb *ChatBot) modelFor(backendName string) string {
+	switch backendName {
+	case config.BackendOllama:
+		return cb.cfg().OllamaModel
+	case config.BackendAnthropic:
+		return cb.cfg().AnthropicModel
+	case config.BackendGrok:
+		return cb.cfg().GrokModel
+	case config.BackendOpenAI:
+		return cb.cfg().OpenAIModel
+	case config.BackendMock:
+		return cb.cfg().MockModel
+	}
+	return ""
+}
+
+// endpoint returns the URL of an API path on a backend, honoring configured
+// base URLs
+func (cb *ChatBot) endpoint(backendName, path string) string {
+	var base, fallback string
+	switch backendName {
+	case config.BackendAnthropic:
+		base, fallback = cb.cfg().AnthropicURL, config.DefaultAnthropicURL
+	case config.BackendGrok:
+		base, fallback = cb.cfg().GrokURL, config.DefaultGrokURL
+	case config.BackendOpenAI:
+		base, fallback = cb.cfg().OpenAIURL, config.DefaultOpenAIURL
+	case config.RerankCohere:
+		base, fallback = cb.cfg().CohereURL, config.DefaultCohereURL
+	case config.RerankVoyage:
+		base, fallback = cb.cfg().VoyageURL, config.DefaultVoyageURL
+	default:
+		base, fallback = cb.cfg().OllamaURL, config.DefaultOllamaURL
+	}
+	if base == "" {
+		base = fallback
+	}
+	return strings.TrimSuffix(base, "/") + path
+}
+
+// callBackend sends the conversation to the target backend and returns the
+// reply. The guardrails check the prompt before it is sent and the reply
+// before it is returned; a streamed reply is held back until it passed.
+func (cb *ChatBot) callBackend(ctx context.Context, target llmTarget, messages []session.Message) (string, error) {
 	cb.mu.Lock()
-	cb.session.Messages = append(cb.session.Messages, session.Message{
-		Role:      "user",
-		Content:   userMessage,
-		Timestamp: time.Now(),
-	})
-	messages := make([]session.Message, len(cb.session.Messages))
-	copy(messages, cb.session.Messages)
-	backend := cb.session.Backend
+	input, output, err := cb.contentFilters()
 	cb.mu.Unlock()
-
-	cacheKey := cache.GenerateCacheKey(messages)
-	if cached, ok := cb.checkCache(cacheKey); ok {
-		cb.mu.Lock()
-		cb.session.Messages = append(cb.session.Messages, session.Message{
-			Role:      "assistant",
-			Content:   cached,
-			Timestamp: time.Now(),
-		})
-		cb.mu.Unlock()
-		return cached, nil
+	if err != nil {
+		return "", err
+	}
+	if n := len(messages); n > 0 && messages[n-1].Role == "user" {
+		if err := cb.guardContent(ctx, input, target, messages[n-1].Content); err != nil {
+			return "", err
+		}
+	}
+	if !output.Enabled() {
+		return cb.sendStoppable(ctx, target, messages)
 	}
 
-	var response string
-	var err error
+	ctx, release := holdTokens(ctx)
+	response, err := cb.sendStoppable(ctx, target, messages)
+	var stopped *stoppedError
+	if errors.As(err, &stopped) {
+		// The part of a stopped reply is checked although the turn is cancelled
+		response, ctx = stopped.partial, context.WithoutCancel(ctx)
+	} else if err != nil {
+		return "", err
+	}
+	if err := cb.guardContent(ctx, output, target, response); err != nil {
+		return "", err
+	}
+	release()
+	return response, err
+}
 
-	switch backend {
+// sendToBackend sends the conversation to the target backend, without the
+// guardrails, and returns the reply. Every request to a backend passes
+// here, so secrets are redacted here for the backend it resolved to.
+func (cb *ChatBot) sendToBackend(ctx context.Context, target llmTarget, messages []session.Message) (string, error) {
+	target, messages = cb.redactOutgoing(target, messages)
+	switch target.Backend {
 	case config.BackendOllama:
-		response, err = cb.callOllama(ctx, messages)
+		return cb.callOllama(ctx, target, messages)
 	case config.BackendAnthropic:
-		response, err = cb.callAnthropic(ctx, messages)
+		return cb.callAnthropic(ctx, target, messages)
 	case config.BackendGrok:
-		response, err = cb.callGrok(ctx, messages)
+		return cb.callGrok(ctx, target, messages)
 	case config.BackendOpenAI:
-		response, err = cb.callOpenAI(ctx, messages)
+		return cb.callOpenAI(ctx, target, messages)
+	case config.BackendMock:
+		return cb.callMock(ctx, target, messages)
 	default:
-		return "", fmt.Errorf("unknown backend: %s", backend)
+		return "", fmt.Errorf("unknown backend: %s", target.Backend)
 	}
+}
 
+// sendMessage sends a message to the current backend
+func (cb *ChatBot) sendMessage(ctx context.Context, userMessage string) (string, error) {
+	// Only one turn may run against a session at a time, otherwise two
+	// clients could interleave their user/assistant messages
+	cb.mu.Lock()
+	sessionID := cb.session.ID
+	cb.mu.Unlock()
+	unlock, err := cb.locks.TryAcquire(sessionID)
 	if err != nil {
-		return "", err
+		return "", fmt.Errorf("session %s: %w", sessionID, err)
 	}
-
-	cb.storeCache(cacheKey, response)
+	defer unlock()
 
 	cb.mu.Lock()
-	cb.session.Messages = append(cb.session.Messages, session.Message{
-		Role:      "assistant",
-		Content:   response,
-		Timestamp: time.Now(),
-	})
+	prompt := cb.session.AddMessage("user", userMessage)
+	// Messages are only ever appended, so a view clipped to the current
+	// length stays valid without copying the history
+	messages := slices.Clip(cb.session.Messages)
+	target := llmTarget{
+		Backend: cb.session.Backend,
+		Model:   cb.sessionModel(cb.session),
+		Tools:   true,
+		System:  cb.systemPrompt(),
+	}
+	retrieval, routing := cb.cfg().RAGEnabled, cb.cfg().RouterEnabled
+	documents, collection := cb.session.Documents, cb.session.Collection
+	post := cb.replyPostProcessors()
 	cb.mu.Unlock()
 
-	go func() {
-		if err := cb.saveSession(); err != nil {
-			cb.logger.Error("failed to save session", "error", err)
-		}
-	}()
+	var route *session.Route
+	if routing {
+		target, route = cb.routeTarget(ctx, userMessage, target)
+	}
 
-	return response, nil
-}
+	// Every turn gets a root span so backend and tool spans share one trace
+	ctx, span := cb.tracer.Start(ctx, "chat_turn", trace.WithAttributes(
+		attribute.String("session_id", sessionID),
+		attribute.String("backend", target.Backend),
+		attribute.String("model", target.Model),
+	))
+	defer span.End()
 
-// handleCommand handles special commands
-func (cb *ChatBot) handleCommand(cmd string) (bool, error) {
-	parts := strings.Fields(cmd)
-	if len(parts) == 0 {
-		return false, nil
-	}
+	cb.mu.Lock()
+	cb.lastTraceID = span.SpanContext().TraceID()
+	cb.mu.Unlock()
 
-	switch parts[0] {
-	case "/quit", "/exit":
-		return true, nil
+	if route != nil {
+		span.SetAttributes(
+			attribute.String("route_rule", route.Rule),
+			attribute.String("route_reason", route.Reason),
+		)
+	}
 
-	case "/new-session":
-		if err := cb.saveSession(); err != nil {
-			cb.logger.Error("failed to save current session", "error", err)
-		}
-		cb.session = cb.newSession()
-		fmt.Println("Started new session:", cb.session.ID)
-		return false, nil
+	record := turnRecordFrom(ctx)
+	if record != nil {
+		record.Backend, record.Model = target.Backend, target.Model
+		record.Route = route
+		record.TraceID = span.SpanContext().TraceID().String()
+	}
 
-	case "/switch":
-		if len(parts) < 2 {
-			return false, fmt.Errorf("usage: /switch <backend> (ollama|anthropic|grok|openai)")
-		}
-		backendName := parts[1]
-		switch backendName {
-		case config.BackendOllama, config.BackendAnthropic, config.BackendGrok, config.BackendOpenAI:
-			cb.mu.Lock()
-			cb.session.Backend = backendName
-			cb.mu.Unlock()
-			fmt.Printf("Switched to %s backend\n", backendName)
-		default:
-			return false, fmt.Errorf("unknown backend: %s", backendName)
-		}
-		return false, nil
+	// A collection bound with /kb use is searched with the documents loaded
+	// into this session; otherwise /rag on searches every ingested document
+	var matches []rag.Match
+	switch {
+	case collection != "":
+		target.System, matches = cb.withRetrieval(ctx, target.System, userMessage, rag.Scope{Paths: documents, Collection: collection})
+	case retrieval:
+		target.System, matches = cb.withRetrieval(ctx, target.System, userMessage, rag.Scope{})
+	case len(documents) > 0:
+		target.System, matches = cb.withRetrieval(ctx, target.System, userMessage, rag.Scope{Paths: documents})
+	}
 
-	case "/list-ollama-models":
-		ctx := context.Background()
-		models, err := cb.listOllamaModels(ctx)
-		if err != nil {
-			return false, fmt.Errorf("failed to list Ollama models: %w", err)
-		}
-		fmt.Println("\nAvailable Ollama models:")
-		for i, model := range models {
-			sizeGB := float64(model.Size) / (1024 * 1024 * 1024)
-			current := ""
-			if model.Name == cb.config.OllamaModel {
-				current = " (current)"
+	// addReply appends the sources the reply cites to it and stores it
+	addReply := func(reply string, truncated bool) string {
+		citations := cite(reply, matches)
+		if sources := formatCitations(citations); sources != "" {
+			if emit := turnEventsFrom(ctx); emit != nil {
+				emitToken(emit, sources)
 			}
-			fmt.Printf("%d. %s - %.2f GB%s\n", i+1, model.Name, sizeGB, current)
+			reply += sources
 		}
-		fmt.Println()
-		return false, nil
-
-	case "/set-ollama-model":
-		if len(parts) < 2 {
-			return false, fmt.Errorf("usage: /set-ollama-model <model:version>")
+		if record != nil {
+			record.Citations = citations
 		}
-		modelName := parts[1]
 		cb.mu.Lock()
-		cb.config.OllamaModel = modelName
+		cb.session.AddMessage("assistant", reply)
+		cb.session.Messages[len(cb.session.Messages)-1].Citations = citations
+		cb.session.Messages[len(cb.session.Messages)-1].Route = route
+		cb.session.Messages[len(cb.session.Messages)-1].Truncated = truncated
 		cb.mu.Unlock()
-		fmt.Printf("Ollama model set to: %s\n", modelName)
-		return false, nil
+		return reply
+	}
+
+	cb.auditPrompt(sessionID, target, "", userMessage)
 
-	case "/mcp-list":
-		if !cb.config.MCPEnabled || cb.mcpRegistry == nil {
-			fmt.Println("MCP is not enabled. Use --mcp-enabled flag to enable.")
-			return false, nil
+	// A persona changes the reply, so its system prompt is part of the key
+	keyMessages := messages
+	if target.System != "" {
+		keyMessages = append([]session.Message{{Role: "system", Content: target.System}}, messages...)
+	}
+	cacheKey := cache.GenerateCacheKey(keyMessages)
+	if cached, ok := cb.checkCache(cacheKey); ok {
+		span.SetAttributes(attribute.Bool("cache_hit", true))
+		if record != nil {
+			record.Cached = true
 		}
-		if len(cb.mcpTools) == 0 {
-			fmt.Println("No MCP tools available.")
-			return false, nil
+		if emit := turnEventsFrom(ctx); emit != nil {
+			emitToken(emit, cached)
 		}
-		fmt.Println("\nAvailable MCP Tools:")
-		for i, tool := range cb.mcpTools {
-			fmt.Printf("%d. %s (%s)\n", i+1, tool.Name, tool.ServerName)
-			fmt.Printf("   %s\n", tool.Description)
+		cb.auditResponse(sessionID, target, "", cached, true, nil)
+		return addReply(cb.postProcess(ctx, cached, post), false), nil
+	}
+
+	start := time.Now()
+	_, waited := cb.progress.start("waiting for " + target.Backend)
+	response, err := cb.callBackend(ctx, target, messages)
+	waited()
+	cb.turnStats.record(ctx, target, time.Since(start), err)
+	var stopped *stoppedError
+	if errors.As(err, &stopped) {
+		response = stopped.partial
+	}
+	cb.auditResponse(sessionID, target, "", response, false, err)
+	if err != nil && stopped == nil {
+		var violation *guard.Violation
+		if errors.As(err, &violation) && violation.Subject == guard.Prompt {
+			// A blocked prompt must not go out later as part of the history
+			cb.mu.Lock()
+			if n := len(cb.session.Messages); n > 0 && cb.session.Messages[n-1].ID == prompt.ID {
+				// Clipped, so the next message can't overwrite it in earlier views
+				cb.session.Messages = slices.Clip(cb.session.Messages[:n-1])
+			}
+			cb.mu.Unlock()
 		}
-		fmt.Println()
-		return false, nil
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return "", err
+	}
 
-	case "/mcp-servers":
-		if !cb.config.MCPEnabled || cb.mcpRegistry == nil {
-			fmt.Println("MCP is not enabled. Use --mcp-enabled flag to enable.")
-			return false, nil
+	// A stopped reply is kept as far as it got, but isn't cached as the answer
+	if stopped != nil {
+		span.SetAttributes(attribute.Bool("truncated", true))
+		if record != nil {
+			record.Truncated = true
 		}
-		clients := cb.mcpRegistry.All()
-		if len(clients) == 0 {
-			fmt.Println("No MCP servers connected.")
-			return false, nil
+	} else {
+		// The raw reply is cached, so changed post-processors apply to hits
+		cb.storeCache(cacheKey, response)
+		response = cb.postProcess(ctx, response, post)
+	}
+	response = addReply(response, stopped != nil)
+
+	cb.turnJobs.Add(1)
+	go func() {
+		defer cb.turnJobs.Done()
+		if err := cb.saveSession(); err != nil {
+			cb.logger.Error("failed to save session", "error", err)
+			return
 		}
-		fmt.Println("\nConnected MCP Servers:")
-		for i, client := range clients {
-			fmt.Printf("%d. %s\n", i+1, client.Name())
+		if cb.cfg().AutoTitle {
+			cb.maybeGenerateTitle(context.Background())
 		}
-		fmt.Printf("\nTotal: %d servers, %d tools\n\n", len(clients), len(cb.mcpTools))
-		return false, nil
+	}()
 
-	case "/mcp-reload":
-		if !cb.config.MCPEnabled || cb.mcpRegistry == nil {
-			fmt.Println("MCP is not enabled. Use --mcp-enabled flag to enable.")
-			return false, nil
+	if stopped != nil {
+		return response, stopped
+	}
+	return response, nil
+}
+
+// Close stops MCP servers, flushes telemetry and closes the database. It is
+// safe to call more than once.
+func (cb *ChatBot) Close() {
+	cb.closeOnce.Do(func() {
+		// Unfinished /async jobs are recorded as cancelled while the database is open
+		cb.jobs.stop()
+		if cb.mcpRegistry != nil {
+			if err := cb.mcpRegistry.Close(); err != nil {
+				cb.logger.Warn("failed to close MCP clients", "error", err)
+			}
 		}
-		ctx := context.Background()
-		if err := cb.refreshMCPTools(ctx); err != nil {
-			return false, fmt.Errorf("failed to reload MCP tools: %w", err)
+		for _, pool := range cb.httpPools {
+			pool.closeIdle()
 		}
-		fmt.Printf("Reloaded MCP tools. Total: %d tools from %d servers\n", len(cb.mcpTools), cb.mcpRegistry.Count())
-		return false, nil
+		cb.logger.Info("chatbot shut down", "session_id", cb.session.ID)
+		if cb.audit != nil {
+			if err := cb.audit.Close(); err != nil {
+				cb.logger.Warn("failed to close audit log", "error", err)
+			}
+		}
+		if cb.shutdownTelemetry != nil {
+			cb.shutdownTelemetry()
+		}
+		if err := cb.db.Close(); err != nil {
+			cb.logger.Warn("failed to close database", "error", err)
+		}
+	})
+}
 
-	case "/help":
-		fmt.Println("Available commands:")
-		fmt.Println("  /quit, /exit              - Exit the chatbot")
-		fmt.Println("  /new-session              - Start a new chat session")
-		fmt.Println("  /switch <backend>         - Switch LLM backend (ollama|anthropic|grok|openai)")
-		fmt.Println("  /list-ollama-models       - List available Ollama models")
-		fmt.Println("  /set-ollama-model <model> - Set Ollama model (e.g., llama3:latest)")
-		if cb.config.MCPEnabled {
-			fmt.Println("  /mcp-list                 - List all available MCP tools")
-			fmt.Println("  /mcp-servers              - Show connected MCP servers")
-			fmt.Println("  /mcp-reload               - Reload tools from MCP servers")
-		}
-		fmt.Println("  /help                     - Show this help message")
-		return false, nil
+// handleSignals shuts down cleanly on SIGINT or SIGTERM: in-flight requests
+// are cancelled, the session is saved and Close runs before the process exits.
+// A SIGINT while a turn is running only aborts that turn.
+func (cb *ChatBot) handleSignals(signals <-chan os.Signal, cancel context.CancelFunc) {
+	var sig os.Signal
+	for sig = range signals {
+		if sig != os.Interrupt || !cb.interruptTurn() {
+			break
+		}
+	}
+	cb.logger.Info("received signal, shutting down", "signal", sig.String())
+	fmt.Println()
 
-	default:
-		return false, nil
+	cancel()
+	exitCode := 0
+	if err := cb.saveSession(); err != nil {
+		cb.logger.Error("failed to save session on shutdown", "error", err)
+		exitCode = 1
+	}
+	cb.Close()
+
+	fmt.Println("Goodbye!")
+	os.Exit(exitCode)
+}
+
+// interruptTurn cancels the turn in flight, reporting false if there is none.
+// The turn is forgotten, so a second Ctrl+C before it unwinds exits.
+func (cb *ChatBot) interruptTurn() bool {
+	cb.mu.Lock()
+	cancel := cb.cancelTurn
+	cb.cancelTurn = nil
+	cb.mu.Unlock()
+	if cancel == nil {
+		return false
+	}
+
+	cb.logger.Info("turn cancelled by user")
+	fmt.Println("\nCancelling request (press Ctrl+C again to exit)...")
+	cancel()
+	return true
+}
+
+// interruptible returns a context that Ctrl+C cancels instead of exiting, as
+// for a turn, and the function that ends it
+func (cb *ChatBot) interruptible(ctx context.Context) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	cb.mu.Lock()
+	cb.cancelTurn = cancel
+	cb.mu.Unlock()
+	return ctx, func() {
+		cb.mu.Lock()
+		cb.cancelTurn = nil
+		cb.mu.Unlock()
+		cancel()
+	}
+}
+
+// historyFileName is the REPL input history, kept in the home directory
+const historyFileName = ".extrachat_history"
+
+// historyPath returns the file the REPL input history persists to
+func historyPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate home directory: %w", err)
+	}
+	return filepath.Join(home, historyFileName), nil
+}
+
+// sessionBanner describes a session as the REPL starts in it
+func sessionBanner(sess *session.Session) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Session: %s\n", sess.ID)
+	if sess.Title != "" {
+		fmt.Fprintf(&b, "Title: %s\n", sess.Title)
+	}
+	if sess.Persona != "" {
+		fmt.Fprintf(&b, "Persona: %s\n", sess.Persona)
+	}
+	if sess.Summary != "" {
+		fmt.Fprintf(&b, "Summary: %s\n", previewText(sess.Summary, 100))
+	}
+	for _, path := range sess.Documents {
+		fmt.Fprintf(&b, "Document: %s\n", path)
+	}
+	if sess.Collection != "" {
+		fmt.Fprintf(&b, "Collection: %s\n", sess.Collection)
+	}
+	fmt.Fprintf(&b, "Backend: %s\n", sess.Backend)
+	return b.String()
+}
+
+// openInput sets up the interactive input with completion and the
+// persisted history. Plain output reads lines as typed, without redrawing.
+func (cb *ChatBot) openInput() {
+	cb.input = lineedit.New(os.Stdin, os.Stdout)
+	if cb.cfg().Plain {
+		cb.input.DisableEditing()
+	}
+	cb.input.SetCompleter(cb.complete)
+	if path, err := historyPath(); err != nil {
+		cb.logger.Warn("input history disabled", "error", err)
+	} else if err := cb.input.LoadHistory(path); err != nil {
+		cb.logger.Warn("failed to load input history", "path", path, "error", err)
 	}
 }
 
 // Run starts the chat bot
 func (cb *ChatBot) Run() error {
-	defer cb.db.Close()
+	defer cb.Close()
+
+	if cb.cfg().Output == config.OutputJSON {
+		cb.useJSONOutput()
+	}
 
 	fmt.Println("=== Go Chatbot ===")
-	fmt.Printf("Session: %s\n", cb.session.ID)
-	fmt.Printf("Backend: %s\n", cb.session.Backend)
-	fmt.Println("Type /help for commands, /quit to exit")
-	fmt.Println()
+	fmt.Print(sessionBanner(cb.session))
 
-	scanner := bufio.NewScanner(os.Stdin)
-	ctx := context.Background()
+	cb.openInput()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
-	for {
-		fmt.Print("You: ")
-		if !scanner.Scan() {
-			break
+	if !cb.cfg().SkipStartupChecks {
+		cb.reportPreflight(ctx)
+	}
+	if cb.cfg().PprofAddr != "" {
+		addr, err := telemetry.StartPprof(ctx, cb.cfg().PprofAddr, cb.logger)
+		if err != nil {
+			return fmt.Errorf("failed to start pprof server: %w", err)
 		}
+		cb.pprofAddr = addr
+		fmt.Printf("pprof: http://%s/debug/pprof/\n", addr)
+	}
+	cb.printAttachments()
+	cb.warnShadowedCommands(*cb.cfg())
+	fmt.Println("Type /help for commands, /quit to exit")
+	fmt.Println()
 
-		input := strings.TrimSpace(scanner.Text())
-		if input == "" {
-			continue
-		}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	go cb.handleSignals(signals, cancel)
 
-		if strings.HasPrefix(input, "/") {
-			shouldQuit, err := cb.handleCommand(input)
-			if err != nil {
-				fmt.Printf("Error: %v\n", err)
-				cb.logger.Error("command error", "error", err)
-			}
-			if shouldQuit {
+	cb.startBackground(ctx)
+
+	for {
+		raw, err := cb.input.ReadLine("You: ")
+		if errors.Is(err, lineedit.ErrInterrupt) {
+			// Ctrl+C discards a typed line and quits at an empty prompt
+			if raw == "" {
 				break
 			}
 			continue
 		}
-
-		response, err := cb.sendMessage(ctx, input)
 		if err != nil {
-			fmt.Printf("Error: %v\n", err)
-			cb.logger.Error("failed to send message", "error", err)
-			continue
+			break
+		}
+		if err := cb.input.AddHistory(raw); err != nil {
+			cb.logger.Warn("failed to save input history", "error", err)
+		}
+		if cb.handleLine(ctx, raw) {
+			break
 		}
-
-		fmt.Printf("Bot: %s\n\n", response)
 	}
 
 	if err := cb.saveSession(); err != nil {
@@ -826,254 +1389,735 @@ func (cb *ChatBot) Run() error {
 	return nil
 }
 
-// handleAnthropicToolUse handles tool use responses from Anthropic
-func (cb *ChatBot) handleAnthropicToolUse(ctx context.Context, messages []session.Message, apiResp backend.AnthropicResponse) (string, error) {
-	cb.logger.Info("handling tool use", "tools_count", len(apiResp.Content))
+// handleLine runs a line typed at the prompt, reporting whether it quits
+func (cb *ChatBot) handleLine(ctx context.Context, raw string) bool {
+	// Ctrl+K opens the quick switcher; TrimSpace would strip the key
+	if strings.ContainsRune(raw, quickSwitchKey) {
+		query := strings.TrimSpace(strings.ReplaceAll(raw, string(quickSwitchKey), ""))
+		if err := cb.handleQuickSwitch(query); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			cb.logger.Error("command error", "error", err)
+		}
+		return false
+	}
 
-	// Extract tool use requests and invoke them
-	toolResults := []backend.AnthropicContent{}
-	var assistantContent []backend.AnthropicContent
+	input := strings.TrimSpace(raw)
+	if input == "" {
+		return false
+	}
 
-	// First, collect the assistant's response (which includes tool_use blocks)
-	assistantContent = apiResp.Content
+	// User-defined commands run as several lines; a failing one stops the rest
+	lines, err := cb.expandInput(input)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		cb.logger.Error("command error", "error", err)
+		return false
+	}
+	for _, line := range lines {
+		quit, err := cb.processInput(ctx, line)
+		if quit {
+			return true
+		}
+		if err != nil {
+			break
+		}
+	}
+	return false
+}
 
-	// Process each content block
-	for _, content := range apiResp.Content {
-		if content.Type == "tool_use" {
-			cb.logger.Info("invoking MCP tool", "tool", content.Name, "id", content.ID)
+// startBackground starts the jobs that run until ctx is done: nightly
+// backups, MCP health checks and config reloads
+func (cb *ChatBot) startBackground(ctx context.Context) {
+	if cb.backups != nil {
+		go cb.backups.Run(ctx)
+	}
+	if cb.mcpHealth != nil {
+		go cb.runMCPHealthChecks(ctx)
+	}
+	if cb.loadConfig != nil {
+		go cb.watchConfig(ctx)
+	}
+}
+
+// processInput runs one line of input: a command, or a message sent as a
+// turn that Ctrl+C cancels. Errors are reported to the user before they are
+// returned, and only stop the rest of a user-defined command.
+func (cb *ChatBot) processInput(ctx context.Context, input string) (bool, error) {
+	if strings.HasPrefix(input, "/") {
+		result, err := cb.handleCommand(input)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			cb.logger.Error("command error", "error", err)
+			return false, err
+		}
+		if result.quit || result.send == "" {
+			return result.quit, nil
+		}
+		input = result.send
+	}
+
+	// Esc or /stop typed while the reply is generated stops it, keeping what
+	// the model wrote so far; the reply is streamed for that, and printed
+	// once it is done
+	turnCtx, done := cb.interruptible(ctx)
+	turnCtx, stop := context.WithCancelCause(turnCtx)
+	unwatch := cb.watchTurn(stop)
+	start := time.Now()
+	response, err := cb.runTurn(withTurnEvents(turnCtx, cb.turnEvents()), input)
+	unwatch()
+	stop(nil)
+	done()
+	elapsed := time.Since(start)
+
+	if errors.Is(err, errStopped) && response != "" {
+		cb.showReply(response + " [stopped]")
+		cb.logger.Info("reply stopped", "chars", len(response))
+		return false, nil
+	}
+	if err != nil && errors.Is(err, context.Canceled) && ctx.Err() == nil {
+		fmt.Println("Request cancelled.")
+		fmt.Println()
+		cb.logger.Info("request cancelled", "error", err)
+		return false, err
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		cb.logger.Error("failed to send message", "error", err)
+		cb.notifySlow(elapsed, "Reply failed", err.Error())
+		return false, err
+	}
+
+	cb.showReply(response)
+	cb.notifySlow(elapsed, "Reply ready", response)
+	return false, nil
+}
+
+// watchTurn makes Esc or a typed /stop stop the turn in flight with
+// errStopped, until the returned function is called
+func (cb *ChatBot) watchTurn(stop context.CancelCauseFunc) func() {
+	if cb.tui != nil {
+		return cb.tui.watch(stop)
+	}
+	return cb.input.Watch(func() { stop(errStopped) }, func(line string) {
+		if strings.TrimSpace(line) == "/stop" {
+			stop(errStopped)
+		}
+	})
+}
+
+// turnEvents returns where the events of a turn typed at the prompt go.
+// The REPL prints the whole reply at the end, but the reply is streamed
+// all the same, so a stopped one keeps what the model wrote.
+func (cb *ChatBot) turnEvents() func(turnEvent) {
+	if cb.tui != nil {
+		return cb.tui.showEvent
+	}
+	return func(turnEvent) {}
+}
+
+// showReply shows a finished reply
+func (cb *ChatBot) showReply(reply string) {
+	if cb.tui != nil {
+		cb.tui.finishReply(reply)
+		return
+	}
+	fmt.Printf("Bot: %s\n\n", reply)
+}
+
+// readLine asks the user for a line of input, on the input line of the TUI
+// while it runs. Callers check cb.input first, as without one there is
+// nobody to ask.
+func (cb *ChatBot) readLine(prompt string) (string, error) {
+	if cb.tui != nil {
+		return cb.tui.ask(prompt)
+	}
+	return cb.input.ReadLine(prompt)
+}
+
+// handleAnthropicToolUse handles tool use responses from Anthropic, running
+// the requested tools and feeding their results back until the model answers.
+// The loop stops gracefully after MaxToolIterations rounds or when the model
+// keeps repeating an identical tool call.
+func (cb *ChatBot) handleAnthropicToolUse(ctx context.Context, target llmTarget, reqMessages []json.RawMessage, apiResp backend.AnthropicResponse) (string, error) {
+	maxIterations := cb.cfg().MaxToolIterations
+	if maxIterations <= 0 {
+		maxIterations = config.DefaultMaxToolIterations
+	}
+	callCounts := make(map[string]int) // Identical calls seen this turn
+
+	for iteration := 1; apiResp.StopReason == "tool_use"; iteration++ {
+		cb.logger.Info("handling tool use", "tools_count", len(apiResp.Content), "iteration", iteration)
+
+		if iteration > maxIterations {
+			cb.logger.Warn("tool iteration limit reached", "limit", maxIterations)
+			trace.SpanFromContext(ctx).AddEvent("tool_iteration_limit_reached")
+			return fmt.Sprintf("I stopped after %d rounds of tool calls without reaching a final answer. "+
+				"You can ask me to continue, or raise the limit with --max-tool-iterations.", maxIterations), nil
+		}
+
+		// Extract tool use requests
+		toolUses := []backend.AnthropicContent{}
+		for _, content := range apiResp.Content {
+			if content.Type == "tool_use" {
+				toolUses = append(toolUses, content)
+			}
+		}
+
+		if len(toolUses) == 0 {
+			return "", fmt.Errorf("tool_use stop reason but no tool_use blocks found")
+		}
 
-			// Call the MCP tool
-			result, err := cb.invokeMCPTool(ctx, content.Name, content.Input)
+		// A model stuck in a loop keeps issuing the same call with the same input
+		for _, content := range toolUses {
+			signature := toolCallSignature(content)
+			callCounts[signature]++
+			if callCounts[signature] >= maxIdenticalToolCalls {
+				cb.logger.Warn("repeated identical tool call detected", "tool", content.Name, "count", callCounts[signature])
+				trace.SpanFromContext(ctx).AddEvent("tool_loop_detected", trace.WithAttributes(
+					attribute.String("tool", content.Name),
+				))
+				return fmt.Sprintf("I stopped because the tool %s was requested %d times with identical arguments, "+
+					"which looks like a loop. Please rephrase or give me more guidance.", content.Name, callCounts[signature]), nil
+			}
+		}
 
-			var toolResult backend.AnthropicContent
+		// Invoke all requested tools concurrently; MCP clients multiplex requests
+		// over a single connection, and results keep the order of the tool_use blocks
+		toolResults := make([]backend.AnthropicContent, len(toolUses))
+		var wg sync.WaitGroup
+		for i, content := range toolUses {
+			wg.Add(1)
+			go func(i int, content backend.AnthropicContent) {
+				defer wg.Done()
+				toolResults[i] = cb.runToolUse(ctx, content)
+			}(i, content)
+		}
+		wg.Wait()
+
+		// Add the assistant's message with tool_use blocks, then the tool results
+		for _, msg := range []backend.AnthropicMessage{
+			{Role: "assistant", Content: apiResp.Content},
+			{Role: "user", Content: toolResults},
+		} {
+			data, err := json.Marshal(msg)
 			if err != nil {
-				// Tool invocation failed
-				cb.logger.Error("tool invocation failed", "tool", content.Name, "error", err)
-				toolResult = backend.AnthropicContent{
-					Type:      "tool_result",
-					ToolUseID: content.ID,
-					Content:   fmt.Sprintf("Error: %v", err),
-					IsError:   true,
-				}
-			} else {
-				// Tool invocation succeeded
-				// Convert result to string for simplicity
-				resultStr, err := json.Marshal(result)
-				if err != nil {
-					resultStr = []byte(fmt.Sprintf("%v", result))
-				}
-				toolResult = backend.AnthropicContent{
-					Type:      "tool_result",
-					ToolUseID: content.ID,
-					Content:   string(resultStr),
-				}
+				return "", fmt.Errorf("failed to encode tool results: %w", err)
 			}
-			toolResults = append(toolResults, toolResult)
+			reqMessages = append(reqMessages, data)
 		}
-	}
 
-	if len(toolResults) == 0 {
-		return "", fmt.Errorf("tool_use stop reason but no tool_use blocks found")
+		followUpResp, err := cb.sendAnthropicFollowUp(ctx, target, reqMessages)
+		if err != nil {
+			return "", err
+		}
+		apiResp = followUpResp
 	}
 
-	// Build a new request with the assistant's response and tool results
-	// Convert existing messages to Anthropic format
-	reqMessages := make([]backend.AnthropicMessage, len(messages))
-	for i, msg := range messages {
-		reqMessages[i] = backend.AnthropicMessage{
-			Role:    msg.Role,
-			Content: msg.Content,
+	// Extract final text response
+	for _, content := range apiResp.Content {
+		if content.Type == "text" {
+			return content.Text, nil
 		}
 	}
 
-	// Add the assistant's message with tool_use blocks
-	reqMessages = append(reqMessages, backend.AnthropicMessage{
-		Role:    "assistant",
-		Content: assistantContent,
-	})
+	return "", fmt.Errorf("empty response after tool use")
+}
 
-	// Add the user's message with tool results
-	reqMessages = append(reqMessages, backend.AnthropicMessage{
-		Role:    "user",
-		Content: toolResults,
-	})
+// maxIdenticalToolCalls is how many times a turn may issue the same tool call
+// with the same input before it is treated as a loop
+const maxIdenticalToolCalls = 3
+
+// toolCallSignature identifies a tool call by name and input; json.Marshal
+// sorts map keys, so equal inputs produce equal signatures
+func toolCallSignature(content backend.AnthropicContent) string {
+	input, err := json.Marshal(content.Input)
+	if err != nil {
+		input = []byte(fmt.Sprintf("%v", content.Input))
+	}
+	return content.Name + "\x00" + string(input)
+}
+
+// sendAnthropicFollowUp sends the conversation including tool results back to Anthropic
+func (cb *ChatBot) sendAnthropicFollowUp(ctx context.Context, target llmTarget, reqMessages []json.RawMessage) (backend.AnthropicResponse, error) {
+	var followUpResp backend.AnthropicResponse
 
 	// Make another API call with tool results
-	apiKey := os.Getenv("ANTHROPIC_API_KEY")
+	apiKey := cb.cfg().APIKey(config.BackendAnthropic)
 	if apiKey == "" {
-		return "", fmt.Errorf("ANTHROPIC_API_KEY not set")
+		return followUpResp, fmt.Errorf("ANTHROPIC_API_KEY not set (or store a key with: extrachat auth set anthropic)")
 	}
 
 	reqBody := backend.AnthropicRequest{
-		Model:     "claude-sonnet-4-20250514",
+		Model:     target.Model,
 		MaxTokens: 1024,
+		System:    target.System,
 		Messages:  reqMessages,
 		Tools:     cb.convertMCPToolsToAnthropic(),
-	}
 
-	jsonData, err := json.Marshal(reqBody)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal follow-up request: %w", err)
+		StopSequences: cb.stopSequences(ctx),
 	}
+	emit := turnEventsFrom(ctx)
+	reqBody.Stream = emit != nil
 
-	req, err := http.NewRequestWithContext(ctx, "POST", "https://api.anthropic.com/v1/messages", bytes.NewBuffer(jsonData))
+	req, release, err := newJSONRequest(ctx, cb.endpoint(config.BackendAnthropic, "/v1/messages"), reqBody)
 	if err != nil {
-		return "", fmt.Errorf("failed to create follow-up request: %w", err)
+		return followUpResp, fmt.Errorf("follow-up request: %w", err)
 	}
+	defer release()
 
 	req.Header.Set("x-api-key", apiKey)
 	req.Header.Set("anthropic-version", "2023-06-01")
-	req.Header.Set("content-type", "application/json")
 
-	resp, err := cb.httpClient.Do(req)
+	resp, err := cb.httpClient(config.BackendAnthropic, emit != nil).Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to send follow-up request: %w", err)
+		return followUpResp, fmt.Errorf("failed to send follow-up request: %w", err)
 	}
 	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("failed to read follow-up response: %w", err)
-	}
+	if emit != nil && resp.StatusCode == http.StatusOK {
+		if followUpResp, err = readAnthropicStream(resp.Body, emit); err != nil {
+			return followUpResp, fmt.Errorf("failed to read follow-up response stream: %w", err)
+		}
+	} else {
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return followUpResp, fmt.Errorf("failed to read follow-up response: %w", err)
+		}
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("API error on follow-up: %s - %s", resp.Status, string(body))
-	}
+		if resp.StatusCode != http.StatusOK {
+			return followUpResp, newAPIError("API error on follow-up", resp, body)
+		}
 
-	var followUpResp backend.AnthropicResponse
-	if err := json.Unmarshal(body, &followUpResp); err != nil {
-		return "", fmt.Errorf("failed to unmarshal follow-up response: %w", err)
+		if err := json.Unmarshal(body, &followUpResp); err != nil {
+			return followUpResp, fmt.Errorf("failed to unmarshal follow-up response: %w", err)
+		}
 	}
 
 	cb.recordMetrics(ctx, followUpResp.Usage)
+	cb.recordUsage(ctx, target, followUpResp.Usage)
+	return followUpResp, nil
+}
 
-	// Check if we need to handle more tool use (recursive)
-	if followUpResp.StopReason == "tool_use" {
-		// Recursive tool use - update messages and call again
-		// Add assistant's tool use message to our history
-		messages = append(messages, session.Message{
-			Role:      "assistant",
-			Content:   "[Tool use in progress]",
-			Timestamp: time.Now(),
-		})
-		// Add tool results to history
-		messages = append(messages, session.Message{
-			Role:      "user",
-			Content:   "[Tool results]",
-			Timestamp: time.Now(),
-		})
-		return cb.handleAnthropicToolUse(ctx, messages, followUpResp)
+// runToolUse invokes the MCP tool for a tool_use block and builds its tool_result
+func (cb *ChatBot) runToolUse(ctx context.Context, content backend.AnthropicContent) backend.AnthropicContent {
+	cb.logger.Info("invoking MCP tool", "tool", content.Name, "id", content.ID)
+
+	ctx, span := cb.tracer.Start(ctx, "tool_call", trace.WithAttributes(
+		attribute.String("tool", content.Name),
+	))
+	defer span.End()
+
+	emit := turnEventsFrom(ctx)
+	if emit != nil {
+		emit(turnEvent{Type: "tool_call", ToolID: content.ID, Tool: content.Name, Input: content.Input})
 	}
 
-	// Extract final text response
-	for _, content := range followUpResp.Content {
-		if content.Type == "text" {
-			return content.Text, nil
+	// Call the MCP tool
+	result, err := cb.invokeMCPTool(ctx, content.Name, content.Input)
+	if err != nil {
+		// Tool invocation failed
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		cb.logger.Error("tool invocation failed", "tool", content.Name, "error", err)
+		if emit != nil {
+			emit(turnEvent{Type: "tool_result", ToolID: content.ID, Tool: content.Name, Result: err.Error(), IsError: true})
+		}
+		return backend.AnthropicContent{
+			Type:      "tool_result",
+			ToolUseID: content.ID,
+			Content:   fmt.Sprintf("Error: %v", err),
+			IsError:   true,
 		}
 	}
 
-	return "", fmt.Errorf("empty response after tool use")
+	// Tool invocation succeeded
+	// Convert result to string for simplicity
+	resultStr, err := json.Marshal(result)
+	if err != nil {
+		resultStr = []byte(fmt.Sprintf("%v", result))
+	}
+	if emit != nil {
+		emit(turnEvent{Type: "tool_result", ToolID: content.ID, Tool: content.Name, Result: string(resultStr)})
+	}
+	return backend.AnthropicContent{
+		Type:      "tool_result",
+		ToolUseID: content.ID,
+		Content:   string(resultStr),
+	}
 }
 
 // initializeMCP sets up MCP clients based on config
-func (cb *ChatBot) initializeMCP() error {
+func (cb *ChatBot) initializeMCP(servers []mcp.ServerConfig) error {
 	ctx := context.Background()
 	cb.mcpRegistry = mcp.NewClientRegistry()
 
-	// Initialize local Python MCP servers
-	for _, scriptPath := range cb.config.MCPLocalServers {
-		client, err := mcp.NewStdioClient(scriptPath, scriptPath, cb.logger)
-		if err != nil {
-			cb.logger.Warn("failed to create stdio MCP client", "script", scriptPath, "error", err)
+	health, err := newMCPHealth(cb.meter)
+	if err != nil {
+		cb.logger.Warn("failed to set up MCP health metrics", "error", err)
+	}
+	cb.mcpHealth = health
+
+	cb.mcpServers = make(map[string]mcp.ServerConfig, len(servers))
+	for i, client := range cb.connectMCPServers(ctx, servers) {
+		if client == nil {
 			continue
 		}
+		server := servers[i]
+		cb.mcpRegistry.Register(server.Name, client)
+		cb.mcpServers[server.Name] = server
+		cb.logger.Info("registered MCP server", "server", server.Name, "remote", server.IsRemote())
+	}
 
-		if err := client.Initialize(ctx); err != nil {
-			cb.logger.Warn("failed to initialize stdio MCP client", "script", scriptPath, "error", err)
-			client.Close()
-			continue
+	if cb.cfg().BuiltinTools {
+		client, err := native.NewClient(cb.cfg().SandboxRoot, cb.fetchClient(), cb.fetchLimits, cb.logger)
+		if err != nil {
+			cb.logger.Warn("failed to create built-in tools", "error", err)
+		} else {
+			cb.mcpRegistry.Register(native.ServerName, client)
 		}
+	}
 
-		cb.mcpRegistry.Register(scriptPath, client)
-		cb.logger.Info("registered local MCP server", "script", scriptPath)
+	// Refresh tools from all MCP servers
+	if err := cb.refreshMCPTools(ctx); err != nil {
+		return fmt.Errorf("failed to refresh MCP tools: %w", err)
 	}
 
-	// Initialize remote MCP servers
-	for _, serverURL := range cb.config.MCPRemoteServers {
-		var client mcp.MCPClient
-		var err error
+	cb.logger.Info("MCP initialized", "servers", cb.mcpRegistry.Count(), "tools", len(cb.getMCPTools()))
+	return nil
+}
 
-		// Determine protocol based on URL prefix
-		if strings.HasPrefix(serverURL, "ws://") || strings.HasPrefix(serverURL, "wss://") {
-			client, err = mcp.NewWebSocketClient(serverURL, serverURL, cb.logger)
-		} else {
-			client, err = mcp.NewHTTPClient(serverURL, serverURL, cb.logger)
-		}
+// connectMCPServer creates and initializes the client for one server
+func (cb *ChatBot) connectMCPServer(ctx context.Context, server mcp.ServerConfig) (mcp.MCPClient, error) {
+	var client mcp.MCPClient
+	var err error
 
+	opts := cb.mcpOptions
+	if server.TLS != nil {
+		tlsConfig, err := server.TLS.ClientConfig()
 		if err != nil {
-			cb.logger.Warn("failed to create remote MCP client", "url", serverURL, "error", err)
-			continue
+			return nil, fmt.Errorf("invalid TLS settings: %w", err)
 		}
-
-		if err := client.Initialize(ctx); err != nil {
-			cb.logger.Warn("failed to initialize remote MCP client", "url", serverURL, "error", err)
-			client.Close()
-			continue
+		if server.TLS.InsecureSkipVerify {
+			cb.logger.Warn("MCP server certificate chain is not verified, only its pinned fingerprint", "server", server.Name)
 		}
+		opts = append(slices.Clip(opts), mcp.WithTLS(tlsConfig))
+	}
 
-		cb.mcpRegistry.Register(serverURL, client)
-		cb.logger.Info("registered remote MCP server", "url", serverURL)
+	switch server.TransportType() {
+	case mcp.TransportStdio:
+		client, err = mcp.NewStdioClient(server, cb.logger, opts...)
+	case mcp.TransportWebSocket:
+		client, err = mcp.NewWebSocketClient(server.Name, server.URL, cb.logger, opts...)
+	case mcp.TransportSSE:
+		client, err = mcp.NewSSEClient(server.Name, server.URL, cb.logger, opts...)
+	default:
+		client, err = mcp.NewHTTPClient(server.Name, server.URL, cb.logger, opts...)
 	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create MCP client: %w", err)
+	}
+	client.SetNotificationHandler(cb.handleMCPNotification)
 
-	// Refresh tools from all MCP servers
-	if err := cb.refreshMCPTools(ctx); err != nil {
-		return fmt.Errorf("failed to refresh MCP tools: %w", err)
+	if err := client.Initialize(ctx); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to initialize MCP client: %w", err)
 	}
 
-	cb.logger.Info("MCP initialized", "servers", cb.mcpRegistry.Count(), "tools", len(cb.mcpTools))
-	return nil
+	if cb.cfg().MCPLogLevel != "" {
+		if _, err := cb.setMCPLogLevel(ctx, client, cb.cfg().MCPLogLevel); err != nil {
+			cb.logger.Warn("failed to set MCP server log level", "server", server.Name, "error", err)
+		}
+	}
+	return client, nil
 }
 
-// refreshMCPTools fetches all available tools from MCP servers
-func (cb *ChatBot) refreshMCPTools(ctx context.Context) error {
-	cb.mcpTools = []mcp.Tool{}
+// connectMCPServers connects to the servers concurrently, at most
+// MCPStartupConcurrency at a time, and returns their clients in the order of
+// servers, nil for those that failed. Servers still initializing at the
+// startup deadline are logged and skipped; their clients are closed if they
+// come up later.
+func (cb *ChatBot) connectMCPServers(ctx context.Context, servers []mcp.ServerConfig) []mcp.MCPClient {
+	timeout := cb.cfg().MCPStartupTimeout
+	if timeout <= 0 {
+		timeout = config.DefaultMCPStartupTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	type result struct {
+		index  int
+		client mcp.MCPClient
+		err    error
+	}
+	results := make(chan result, len(servers))
+	slots := make(chan struct{}, max(cb.cfg().MCPStartupConcurrency, 1))
+	for i, server := range servers {
+		go func() {
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+			case <-ctx.Done():
+				results <- result{index: i, err: ctx.Err()}
+				return
+			}
+			client, err := cb.connectMCPServer(ctx, server)
+			results <- result{index: i, client: client, err: err}
+		}()
+	}
+
+	start := cb.clock.Now()
+	clients := make([]mcp.MCPClient, len(servers))
+	pending := make(map[string]bool, len(servers))
+	for _, server := range servers {
+		pending[server.Name] = true
+	}
+	for len(pending) > 0 {
+		select {
+		case r := <-results:
+			server := servers[r.index]
+			delete(pending, server.Name)
+			if r.err != nil {
+				cb.logger.Warn("failed to connect MCP server", "server", server.Name, "error", r.err)
+				continue
+			}
+			clients[r.index] = r.client
+			cb.logger.Debug("connected MCP server", "server", server.Name, "elapsed", cb.clock.Now().Sub(start), "pending", len(pending))
+		case <-ctx.Done():
+			names := make([]string, 0, len(pending))
+			for name := range pending {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			cb.logger.Warn("MCP servers did not start before the startup deadline, continuing without them", "timeout", timeout, "pending", names)
+
+			// Close whatever still comes up after the deadline
+			go func(remaining int) {
+				for ; remaining > 0; remaining-- {
+					if r := <-results; r.client != nil {
+						r.client.Close()
+					}
+				}
+			}(len(pending))
+			return clients
+		}
+	}
+	return clients
+}
 
-	for _, client := range cb.mcpRegistry.All() {
-		tools, err := client.ListTools(ctx)
+// mcpServerConfigs collects the servers from the main config file, the MCP
+// config file and the legacy --mcp-local/--mcp-remote flags
+func mcpServerConfigs(cfg config.Config) ([]mcp.ServerConfig, error) {
+	servers := append([]mcp.ServerConfig(nil), cfg.MCPServers...)
+	if cfg.MCPConfigFile != "" {
+		loaded, err := mcp.LoadServerConfigs(cfg.MCPConfigFile)
 		if err != nil {
-			cb.logger.Warn("failed to list tools from MCP server", "server", client.Name(), "error", err)
-			continue
+			return nil, err
 		}
+		servers = append(servers, loaded...)
+	}
+
+	for _, spec := range cfg.MCPLocalServers {
+		server, err := mcp.LegacyLocalServer(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --mcp-local entry %q: %w", spec, err)
+		}
+		servers = append(servers, server)
+	}
+	for _, url := range cfg.MCPRemoteServers {
+		servers = append(servers, mcp.LegacyRemoteServer(url))
+	}
 
-		cb.mcpTools = append(cb.mcpTools, tools...)
-		cb.logger.Info("loaded tools from MCP server", "server", client.Name(), "count", len(tools))
+	seen := make(map[string]bool, len(servers))
+	if cfg.BuiltinTools {
+		seen[native.ServerName] = true // Reserved for the built-in tools
+	}
+	for _, server := range servers {
+		if seen[server.Name] {
+			return nil, fmt.Errorf("duplicate MCP server name %q", server.Name)
+		}
+		seen[server.Name] = true
 	}
+	return servers, nil
+}
+
+// refreshMCPTools fetches all available tools from MCP servers, listing
+// up to MCPStartupConcurrency servers at a time
+func (cb *ChatBot) refreshMCPTools(ctx context.Context) error {
+	clients := cb.mcpRegistry.All()
+	listed := make([][]mcp.Tool, len(clients))
+	slots := make(chan struct{}, max(cb.cfg().MCPStartupConcurrency, 1))
+	var wg sync.WaitGroup
+	for i, client := range clients {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			listCtx, span := cb.tracer.Start(ctx, "mcp_list_tools", trace.WithAttributes(
+				attribute.String("server", client.Name()),
+			))
+			defer span.End()
+			tools, err := client.ListTools(listCtx)
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+				cb.logger.Warn("failed to list tools from MCP server", "server", client.Name(), "error", err)
+				return
+			}
+			span.SetAttributes(attribute.Int("tools", len(tools)))
+			listed[i] = tools
+			cb.logger.Info("loaded tools from MCP server", "server", client.Name(), "count", len(tools))
+		}()
+	}
+	wg.Wait()
+
+	// The model calls tools by name alone, so of two servers' tools of one
+	// name only the first server's is offered
+	allTools := []mcp.Tool{}
+	providers := make(map[string]string)
+	for _, tools := range listed {
+		for _, tool := range tools {
+			if server, ok := providers[tool.Name]; ok {
+				cb.logger.Warn("MCP tool name collision, keeping the first server's tool", "tool", tool.Name, "kept", server, "dropped", tool.ServerName)
+				continue
+			}
+			providers[tool.Name] = tool.ServerName
+			allTools = append(allTools, tool)
+		}
+	}
+
+	cb.mcpMu.Lock()
+	cb.mcpTools = allTools
+	cb.mcpMu.Unlock()
 
 	return nil
 }
 
+// getMCPTools returns a snapshot of the currently available MCP tools
+func (cb *ChatBot) getMCPTools() []mcp.Tool {
+	cb.mcpMu.RLock()
+	defer cb.mcpMu.RUnlock()
+	return cb.mcpTools
+}
+
+// handleMCPNotification reacts to notifications pushed by MCP servers
+func (cb *ChatBot) handleMCPNotification(serverName string, notification mcp.JSONRPCNotification) {
+	switch notification.Method {
+	case mcp.NotificationToolsListChanged:
+		cb.logger.Info("MCP server tool list changed, refreshing tools", "server", serverName)
+		if err := cb.refreshMCPTools(context.Background()); err != nil {
+			cb.logger.Warn("failed to refresh MCP tools", "server", serverName, "error", err)
+		}
+	case mcp.NotificationProgress:
+		var params mcp.ProgressParams
+		if err := json.Unmarshal(notification.Params, &params); err != nil {
+			cb.logger.Warn("invalid MCP progress notification", "server", serverName, "error", err)
+			return
+		}
+		cb.progress.update(params)
+	case mcp.NotificationMessage:
+		var params mcp.LoggingMessageParams
+		if err := json.Unmarshal(notification.Params, &params); err != nil {
+			cb.logger.Warn("invalid MCP log notification", "server", serverName, "error", err)
+			return
+		}
+		cb.logMCPMessage(serverName, params)
+	default:
+		cb.logger.Debug("ignoring MCP notification", "server", serverName, "method", notification.Method)
+	}
+}
+
+// toolKey identifies a tool across servers, which may name tools alike
+func toolKey(serverName, toolName string) string {
+	return serverName + "/" + toolName
+}
+
+// findMCPTool returns the offered tool of a name with the server it came
+// from; refreshMCPTools keeps the names unique
+func (cb *ChatBot) findMCPTool(toolName string) (mcp.Tool, mcp.MCPClient, error) {
+	for _, tool := range cb.getMCPTools() {
+		if tool.Name != toolName {
+			continue
+		}
+		client, ok := cb.mcpRegistry.Get(tool.ServerName)
+		if !ok {
+			return tool, nil, fmt.Errorf("server %s not found for tool %s", tool.ServerName, toolName)
+		}
+		return tool, client, nil
+	}
+	return mcp.Tool{}, nil, fmt.Errorf("tool %s not found", toolName)
+}
+
 // invokeMCPTool calls an MCP tool and returns the result
-func (cb *ChatBot) invokeMCPTool(ctx context.Context, toolName string, args map[string]interface{}) (interface{}, error) {
-	// Find which server provides this tool
-	var targetClient mcp.MCPClient
-	for _, tool := range cb.mcpTools {
-		if tool.Name == toolName {
-			client, ok := cb.mcpRegistry.Get(tool.ServerName)
-			if !ok {
-				return nil, fmt.Errorf("server %s not found for tool %s", tool.ServerName, toolName)
-			}
-			targetClient = client
+func (cb *ChatBot) invokeMCPTool(ctx context.Context, toolName string, args map[string]interface{}) (result interface{}, err error) {
+	targetTool, targetClient, err := cb.findMCPTool(toolName)
+	if err != nil {
+		return nil, err
+	}
+
+	// Every call the model makes is audited, including rejected ones
+	var duration time.Duration
+	defer func() {
+		cb.recordToolCall(targetClient.Name(), toolName, args, result, duration, err)
+		cb.auditToolCall(targetClient.Name(), toolName, args, result, duration, err)
+	}()
+
+	// Don't send the server (or ask the user about) arguments the tool can't
+	// accept; the violations go back to the model so it can correct the call
+	if err := mcp.ValidateArguments(targetTool.InputSchema, args); err != nil {
+		cb.logger.Warn("tool arguments failed schema validation", "tool", toolName, "server", targetClient.Name(), "error", err)
+		return nil, fmt.Errorf("invalid arguments for tool %s: %w", toolName, err)
+	}
+
+	// The tier's policy decides whether the user is asked; a denied tier
+	// can't be auto-approved, and shell commands are always confirmed
+	tier := cb.toolTier(targetTool)
+	switch cb.cfg().PolicyForTier(tier) {
+	case config.PolicyDeny:
+		cb.logger.Warn("tool call denied by tier policy", "tool", toolName, "server", targetClient.Name(), "tier", tier)
+		return nil, fmt.Errorf("tool %s is %s and %s tools are denied", toolName, tier, tier)
+	case config.PolicyAllow:
+		if toolName != native.RunCommandTool {
+			cb.logger.Info("tool call allowed by tier policy", "tool", toolName, "server", targetClient.Name(), "tier", tier)
 			break
 		}
+		fallthrough
+	default:
+		// Never run a tool the model picked without the user's consent
+		if !cb.confirmToolCall(toolName, targetClient.Name(), tier, args) {
+			return nil, errToolDenied
+		}
 	}
 
-	if targetClient == nil {
-		return nil, fmt.Errorf("tool %s not found", toolName)
-	}
+	// Bound the call so one hung server can't stall the turn; the timeout
+	// starts after confirmation so the user's think time isn't counted
+	timeout := cb.cfg().TimeoutForTool(toolName)
+	callCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// The span's trace context goes to the server in the request's _meta
+	callCtx, span := cb.tracer.Start(callCtx, "mcp_call_tool", trace.WithAttributes(
+		attribute.String("server", targetClient.Name()),
+		attribute.String("tool", toolName),
+	))
+	defer span.End()
 
-	// Call the tool
-	result, err := targetClient.CallTool(ctx, toolName, args)
+	// Servers that support it report progress against this token
+	token, done := cb.progress.start(toolName)
+	start := time.Now()
+	result, err = targetClient.CallTool(mcp.WithProgressToken(callCtx, token), toolName, args)
+	duration = time.Since(start)
+	done()
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	cb.mcpHealth.record(ctx, targetClient.Name(), "call", duration, err)
 	if err != nil {
+		if errors.Is(callCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil {
+			cb.logger.Warn("MCP tool timed out", "tool", toolName, "server", targetClient.Name(), "timeout", timeout)
+			return nil, fmt.Errorf("tool %s timed out after %s", toolName, timeout)
+		}
 		return nil, fmt.Errorf("failed to call tool %s: %w", toolName, err)
 	}
 
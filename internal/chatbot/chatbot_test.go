@@ -0,0 +1,181 @@
+package chatbot
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"ExtraChat/internal/clock"
+	"ExtraChat/internal/config"
+)
+
+// roundTripFunc fakes the backend APIs
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// jsonResponse answers a request with status and a JSON body
+func jsonResponse(req *http.Request, status int, body string) *http.Response {
+	return &http.Response{
+		StatusCode: status,
+		Status:     http.StatusText(status),
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    req,
+	}
+}
+
+// newTestChatBot creates a ChatBot on the Ollama backend with its database
+// and logs in a temporary directory, without telemetry or MCP servers
+func newTestChatBot(t *testing.T, deps Dependencies) *ChatBot {
+	t.Helper()
+	dir := t.TempDir()
+	cfg := config.Default()
+	cfg.DBPath = filepath.Join(dir, "chatbot.db")
+	cfg.LogDir = filepath.Join(dir, "logs")
+	cfg.TelemetryEnabled = false
+	cfg.MCPEnabled = false
+	cfg.OllamaURL = "http://ollama.test"
+
+	cb, err := NewChatBotWith(cfg, deps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(cb.Close)
+	return cb
+}
+
+// advanceWhenWaiting waits for the code under test to wait on clk, checks
+// the wait is within [lo, hi] and lets it pass
+func advanceWhenWaiting(t *testing.T, clk *clock.Fake, lo, hi time.Duration) {
+	t.Helper()
+	clk.BlockUntil(1)
+	wait := clk.Pending()[0]
+	if wait < lo || wait > hi {
+		t.Errorf("waited %s, want %s to %s", wait, lo, hi)
+	}
+	clk.Advance(wait)
+}
+
+func TestBatchPromptRetriesWithBackoff(t *testing.T) {
+	clk := clock.NewFake(time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC))
+	var mu sync.Mutex
+	calls := 0
+	transport := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		if calls <= 2 {
+			return jsonResponse(req, http.StatusServiceUnavailable, `{"error":"overloaded"}`), nil
+		}
+		return jsonResponse(req, http.StatusOK, `{"message":{"role":"assistant","content":"pong"},"done":true}`), nil
+	})
+	cb := newTestChatBot(t, Dependencies{Transport: transport, Clock: clk})
+
+	results := make(chan batchResult, 1)
+	go func() {
+		results <- cb.runBatchPrompt(context.Background(), batchPrompt{ID: "p1", Prompt: "ping"}, 3, nil)
+	}()
+
+	// Doubling backoff from a second, plus up to half again of jitter
+	advanceWhenWaiting(t, clk, batchBackoffBase, batchBackoffBase*3/2)
+	advanceWhenWaiting(t, clk, 2*batchBackoffBase, 3*batchBackoffBase)
+
+	result := <-results
+	if result.Error != "" || result.Response != "pong" {
+		t.Fatalf("result %+v, want pong", result)
+	}
+	if result.Attempts != 3 || calls != 3 {
+		t.Errorf("%d attempts and %d requests, want 3", result.Attempts, calls)
+	}
+}
+
+func TestBatchPromptGivesUp(t *testing.T) {
+	clk := clock.NewFake(time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC))
+	tests := []struct {
+		name     string
+		status   int
+		err      error
+		attempts int
+	}{
+		{"retryable until out of retries", http.StatusTooManyRequests, nil, 2},
+		{"client error", http.StatusBadRequest, nil, 1},
+		{"cancelled", 0, context.Canceled, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+				if tt.err != nil {
+					return nil, tt.err
+				}
+				return jsonResponse(req, tt.status, `{"error":"no"}`), nil
+			})
+			cb := newTestChatBot(t, Dependencies{Transport: transport, Clock: clk})
+
+			results := make(chan batchResult, 1)
+			go func() {
+				results <- cb.runBatchPrompt(context.Background(), batchPrompt{ID: "p1", Prompt: "ping"}, 1, nil)
+			}()
+			for i := 1; i < tt.attempts; i++ {
+				advanceWhenWaiting(t, clk, 0, batchBackoffMax*3/2)
+			}
+			result := <-results
+			if result.Error == "" || result.Attempts != tt.attempts {
+				t.Errorf("result %+v, want an error after %d attempts", result, tt.attempts)
+			}
+		})
+	}
+}
+
+func TestBatchPacerSpacesRequests(t *testing.T) {
+	clk := clock.NewFake(time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC))
+	pacer := &batchPacer{interval: 10 * time.Second, clock: clk}
+
+	// The first request goes at once
+	if err := pacer.wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 2)
+	go func() { done <- pacer.wait(context.Background()) }()
+	advanceWhenWaiting(t, clk, 10*time.Second, 10*time.Second)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	// A cancelled wait returns without the clock moving
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() { done <- pacer.wait(ctx) }()
+	clk.BlockUntil(1)
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("wait = %v, want context.Canceled", err)
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&apiError{StatusCode: http.StatusTooManyRequests}, true},
+		{&apiError{StatusCode: http.StatusRequestTimeout}, true},
+		{&apiError{StatusCode: http.StatusBadGateway}, true},
+		{&apiError{StatusCode: http.StatusUnauthorized}, false},
+		{context.DeadlineExceeded, true},
+		{context.Canceled, false},
+		{errors.New("malformed reply"), false},
+	}
+	for _, tt := range tests {
+		if got := retryable(tt.err); got != tt.want {
+			t.Errorf("retryable(%v) = %t, want %t", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package chatbot
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"ExtraChat/internal/rag"
+	"ExtraChat/internal/session"
+)
+
+// citationPattern matches citation markers like [2] or [1, 3] in a reply
+var citationPattern = regexp.MustCompile(`\[(\d+(?:\s*,\s*\d+)*)\]`)
+
+// cite returns the citations of a reply to a prompt that was sent with
+// matches, numbered as in the excerpts. Only the excerpts the reply marks are
+// cited; a reply without any marker cites them all, since they were all in
+// front of the model.
+func cite(reply string, matches []rag.Match) []session.Citation {
+	if len(matches) == 0 {
+		return nil
+	}
+
+	cited := make(map[int]bool)
+	for _, m := range citationPattern.FindAllStringSubmatch(reply, -1) {
+		for _, field := range strings.Split(m[1], ",") {
+			n, err := strconv.Atoi(strings.TrimSpace(field))
+			if err == nil && n >= 1 && n <= len(matches) {
+				cited[n] = true
+			}
+		}
+	}
+
+	var citations []session.Citation
+	for i, m := range matches {
+		if len(cited) > 0 && !cited[i+1] {
+			continue
+		}
+		citations = append(citations, session.Citation{
+			N:     i + 1,
+			Path:  m.Path,
+			Chunk: m.Seq,
+			Start: m.Start,
+			End:   m.End,
+			Score: m.Score,
+		})
+	}
+	return citations
+}
+
+// formatCitations renders citations as the sources section appended to a
+// reply
+func formatCitations(citations []session.Citation) string {
+	if len(citations) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("\n\nSources:")
+	for _, c := range citations {
+		fmt.Fprintf(&b, "\n[%d] %s, part %d", c.N, c.Path, c.Chunk)
+		if c.End > 0 {
+			fmt.Fprintf(&b, " (characters %d-%d)", c.Start, c.End)
+		}
+	}
+	return b.String()
+}
+
+// encodeCitations formats a message's citations for the database; messages
+// without citations store NULL
+func encodeCitations(citations []session.Citation) (string, error) {
+	if len(citations) == 0 {
+		return "", nil
+	}
+	data, err := json.Marshal(citations)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode citations: %w", err)
+	}
+	return string(data), nil
+}
+
+// decodeCitations parses the citations column of a message
+func decodeCitations(s string) ([]session.Citation, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var citations []session.Citation
+	if err := json.Unmarshal([]byte(s), &citations); err != nil {
+		return nil, fmt.Errorf("failed to decode citations: %w", err)
+	}
+	return citations, nil
+}
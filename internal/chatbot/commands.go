@@ -0,0 +1,493 @@
+package chatbot
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"ExtraChat/internal/config"
+	"ExtraChat/internal/mcp"
+)
+
+// maxCommandDepth bounds how deeply user commands may expand into each other
+const maxCommandDepth = 5
+
+// commandResult tells the REPL what to do after a command
+type commandResult struct {
+	quit bool   // Exit the chatbot
+	send string // Send this text as the next message
+}
+
+// command is a built-in REPL command
+type command struct {
+	name    string
+	aliases []string
+	usage   string // Left column of /help
+	help    string
+
+	// enabled hides the command from /help and completion; nil means always
+	enabled  func(cb *ChatBot) bool
+	run      func(cb *ChatBot, args []string) (commandResult, error)
+	complete func(cb *ChatBot, args []string) []string
+}
+
+// builtinCommands is the command registry, in /help order. It is filled in
+// init because /help reads it.
+var builtinCommands []command
+
+func init() {
+	mcpEnabled := func(cb *ChatBot) bool { return cb.cfg().MCPEnabled }
+
+	builtinCommands = []command{
+		{name: "/quit", aliases: []string{"/exit"}, usage: "/quit, /exit", help: "Exit the chatbot",
+			run: func(*ChatBot, []string) (commandResult, error) { return commandResult{quit: true}, nil }},
+		{name: "/new-session", usage: "/new-session", help: "Start a new chat session",
+			run: action((*ChatBot).handleNewSessionCommand)},
+		{name: "/switch", usage: "/switch <backend|alias>", help: "Switch LLM backend (ollama|anthropic|grok|openai|mock) or to a model alias",
+			run: withArgs((*ChatBot).handleSwitchCommand), complete: firstArg(switchTargets)},
+		{name: "/persona", usage: "/persona [name|off]", help: "List personas, or set this session's system prompt preset",
+			run: withArgs((*ChatBot).handlePersonaCommand), complete: firstArg(func(cb *ChatBot) []string {
+				cb.mu.Lock()
+				defer cb.mu.Unlock()
+				return append(cb.cfg().PersonaNames(), "off")
+			})},
+		{name: "/route", usage: "/route [on|off|test <prompt>]", help: "Show the router rules and last decision, switch routing, or see where a prompt would go",
+			run: withArgs((*ChatBot).handleRouteCommand), complete: firstArg(fixed("on", "off", "test"))},
+		{name: "/list-models", usage: "/list-models [backend|all] [refresh]", help: "List the models of the current backend, or of another or all, marking chat models",
+			run: withArgs((*ChatBot).handleListModelsCommand), complete: firstArg(fixed(append(modelListBackends, "all", "refresh")...))},
+		{name: "/list-ollama-models", usage: "/list-ollama-models", help: "List available Ollama models",
+			run: action((*ChatBot).handleListOllamaModelsCommand)},
+		{name: "/model-info", usage: "/model-info [model]", help: "Show an Ollama model's size, quantization, context window and template",
+			run: withArgs((*ChatBot).handleModelInfoCommand)},
+		{name: "/pull-model", usage: "/pull-model <model>", help: "Download a model into Ollama, showing its progress",
+			run: withArgs((*ChatBot).handlePullModelCommand)},
+		{name: "/set-ollama-model", usage: "/set-ollama-model <model>", help: "Set Ollama model (e.g., llama3:latest)",
+			run: withArgs((*ChatBot).handleSetOllamaModelCommand)},
+		{name: "/mcp-list", usage: "/mcp-list", help: "List all available MCP tools", enabled: mcpEnabled,
+			run: action((*ChatBot).handleMCPListCommand)},
+		{name: "/mcp-servers", usage: "/mcp-servers", help: "Show connected MCP servers", enabled: mcpEnabled,
+			run: action((*ChatBot).handleMCPServersCommand)},
+		{name: "/mcp-status", usage: "/mcp-status", help: "Check MCP server health and show recent stats", enabled: mcpEnabled,
+			run: action((*ChatBot).handleMCPStatusCommand)},
+		{name: "/mcp-reload", usage: "/mcp-reload", help: "Reload tools from MCP servers", enabled: mcpEnabled,
+			run: action((*ChatBot).handleMCPReloadCommand)},
+		{name: "/mcp-log-level", usage: "/mcp-log-level <level>", help: "Set the level of log messages MCP servers send", enabled: mcpEnabled,
+			run: withArgs((*ChatBot).handleMCPLogLevelCommand), complete: firstArg(fixed(mcp.LogLevels...))},
+		{name: "/tool-log", usage: "/tool-log [n]", help: "Show the last n tool calls of this session", enabled: mcpEnabled,
+			run: withArgs((*ChatBot).handleToolLogCommand)},
+		{name: "/history", usage: "/history [n]", help: "Show the last n messages with their numbers",
+			run: withArgs((*ChatBot).handleHistoryCommand)},
+		{name: "/search", usage: "/search <regex>", help: "Show the messages of this session that match, with their numbers",
+			run: withArgs((*ChatBot).handleSearchCommand)},
+		{name: "/summarize", usage: "/summarize [save]", help: "Summarize this session (save stores the summary and a title with it)",
+			run: withArgs((*ChatBot).handleSummarizeCommand), complete: firstArg(fixed("save"))},
+		{name: "/rag", usage: "/rag [on|off]", help: "Show ingested documents, or switch sending relevant chunks with prompts",
+			run: withArgs((*ChatBot).handleRAGCommand), complete: firstArg(fixed("on", "off"))},
+		{name: "/kb", usage: "/kb [use <collection>|off]", help: "List knowledge collections, or bind one to this session for retrieval",
+			run: withArgs((*ChatBot).handleKBCommand), complete: completeKBArgs},
+		{name: "/load", usage: "/load <file>", help: "Load a PDF, DOCX or text file into this session, whole or for retrieval",
+			run: withArgs((*ChatBot).handleLoadCommand)},
+		{name: "/fetch", usage: "/fetch <url>", help: "Send a web page's readable text as context with the next message",
+			run: withArgs((*ChatBot).handleFetchCommand)},
+		{name: "/bestof", usage: "/bestof <n> <prompt>", help: "Ask for n replies to a prompt and keep the best, picked by the judge model or by you",
+			run: withArgs((*ChatBot).handleBestOfCommand)},
+		{name: "/async", usage: "/async <prompt>", help: "Send a prompt in the background and keep chatting; /job shows the reply",
+			run: withArgs((*ChatBot).handleAsyncCommand)},
+		{name: "/jobs", usage: "/jobs", help: "List this session's background jobs",
+			run: action((*ChatBot).handleJobsCommand)},
+		{name: "/job", usage: "/job <id>", help: "Show a background job and its reply",
+			run: withArgs((*ChatBot).handleJobCommand), complete: firstArg((*ChatBot).jobIDs)},
+		{name: "/fork", usage: "/fork [n]", help: "Continue in a new branch after message n (default: latest)",
+			run: withArgs((*ChatBot).handleForkCommand)},
+		{name: "/branches", usage: "/branches", help: "Show the fork tree of the current session",
+			run: action((*ChatBot).handleBranchesCommand)},
+		{name: "/branch", usage: "/branch <n|session-id>", help: "Switch to another branch",
+			run: withArgs((*ChatBot).handleBranchCommand), complete: firstArg((*ChatBot).sessionIDs)},
+		{name: "/trace", usage: "/trace [tree]", help: "Show the trace ID (and span tree) of the last turn",
+			run: withArgs((*ChatBot).handleTraceCommand), complete: firstArg(fixed("tree"))},
+		{name: "/usage", usage: "/usage [all]", help: "Show token counts of this session (or all sessions) per backend and model",
+			run: withArgs((*ChatBot).handleUsageCommand), complete: firstArg(fixed("all"))},
+		{name: "/cost", usage: "/cost", help: "Show token usage and estimated cost of this session",
+			run: action((*ChatBot).handleCostCommand)},
+		{name: "/stats", usage: "/stats", help: "Show p50/p95 turn latency and error classes since startup",
+			run: action((*ChatBot).handleStatsCommand)},
+		{name: "/stop", usage: "/stop, Esc", help: "While a reply is generated, stop it and keep what was written",
+			run: action((*ChatBot).handleStopCommand)},
+		{name: "/editor", usage: "/editor [text]", help: "Compose the next message in $EDITOR (pre-filled with text)",
+			run: (*ChatBot).handleEditorCommand},
+		{name: "/copy", usage: "/copy [code]", help: "Copy the last response (or its last code block) to the clipboard",
+			run: withArgs((*ChatBot).handleCopyCommand), complete: firstArg(fixed("code"))},
+		{name: "/favorite", usage: "/favorite [tag ...]", help: "Pin the current session to the quick switcher",
+			run: withArgs((*ChatBot).handleFavoriteCommand)},
+		{name: "/unfavorite", usage: "/unfavorite", help: "Unpin the current session",
+			run: action((*ChatBot).handleUnfavoriteCommand)},
+		{name: "/quick", usage: "/quick [query], Ctrl+K", help: "Fuzzy-search favorites and switch to one",
+			run: func(cb *ChatBot, args []string) (commandResult, error) {
+				return commandResult{}, cb.handleQuickSwitch(strings.Join(args, " "))
+			}},
+		{name: "/backup", usage: "/backup", help: "Snapshot the database now",
+			enabled: func(cb *ChatBot) bool { return cb.backups != nil },
+			run:     action((*ChatBot).handleBackupCommand)},
+		{name: "/config", usage: "/config show [prefix]", help: "Show the current settings; /config set [--save] <key> <value> changes one (--save writes it to the config file)",
+			run: withArgs((*ChatBot).handleConfigCommand), complete: completeConfigArgs},
+		{name: "/diag", usage: "/diag", help: "Show goroutines, memory and MCP connection state",
+			run: action((*ChatBot).handleDiagCommand)},
+		{name: "/debug", usage: "/debug [on|off]", help: "Show the log level, or switch debug logging on or off",
+			run: withArgs((*ChatBot).handleDebugCommand), complete: firstArg(fixed("on", "off"))},
+		{name: "/help", usage: "/help", help: "Show this help message",
+			run: action((*ChatBot).handleHelpCommand)},
+	}
+}
+
+// action adapts a command handler without arguments
+func action(handler func(cb *ChatBot) error) func(*ChatBot, []string) (commandResult, error) {
+	return func(cb *ChatBot, _ []string) (commandResult, error) {
+		return commandResult{}, handler(cb)
+	}
+}
+
+// withArgs adapts a command handler taking the command's arguments
+func withArgs(handler func(cb *ChatBot, args []string) error) func(*ChatBot, []string) (commandResult, error) {
+	return func(cb *ChatBot, args []string) (commandResult, error) {
+		return commandResult{}, handler(cb, args)
+	}
+}
+
+// firstArg completes only the first argument of a command with options
+func firstArg(options func(cb *ChatBot) []string) func(*ChatBot, []string) []string {
+	return func(cb *ChatBot, args []string) []string {
+		if len(args) > 0 {
+			return nil
+		}
+		return options(cb)
+	}
+}
+
+// fixed returns the same options regardless of state
+func fixed(options ...string) func(*ChatBot) []string {
+	return func(*ChatBot) []string { return options }
+}
+
+// lookupCommand finds a built-in command by name or alias
+func lookupCommand(name string) (command, bool) {
+	for _, c := range builtinCommands {
+		if c.name == name {
+			return c, true
+		}
+		for _, alias := range c.aliases {
+			if alias == name {
+				return c, true
+			}
+		}
+	}
+	return command{}, false
+}
+
+// available reports whether the command is usable with the current setup
+func (c command) available(cb *ChatBot) bool {
+	return c.enabled == nil || c.enabled(cb)
+}
+
+// handleCommand runs a built-in command line
+func (cb *ChatBot) handleCommand(line string) (commandResult, error) {
+	parts := strings.Fields(line)
+	if len(parts) == 0 {
+		return commandResult{}, nil
+	}
+	c, ok := lookupCommand(parts[0])
+	if !ok {
+		return commandResult{}, cb.unknownCommandError(parts[0])
+	}
+	return c.run(cb, parts[1:])
+}
+
+// userCommands returns the user-defined commands from the config file,
+// keyed with their slash. Names taken by built-in commands are left out.
+func (cb *ChatBot) userCommands() map[string]config.CommandSteps {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	commands := make(map[string]config.CommandSteps, len(cb.cfg().Commands))
+	for name, steps := range cb.cfg().Commands {
+		if _, builtin := lookupCommand("/" + name); !builtin {
+			commands["/"+name] = steps
+		}
+	}
+	return commands
+}
+
+// warnShadowedCommands logs user-defined commands that are ignored because a
+// built-in command has the same name
+func (cb *ChatBot) warnShadowedCommands(cfg config.Config) {
+	for name := range cfg.Commands {
+		if _, builtin := lookupCommand("/" + name); builtin {
+			cb.logger.Warn("user command has the name of a built-in command and is ignored", "command", "/"+name)
+		}
+	}
+}
+
+// placeholderPattern matches the argument references of user command steps
+var placeholderPattern = regexp.MustCompile(`\$(\*|[1-9])`)
+
+// expandInput turns a line of input into the lines to run. A user-defined
+// command becomes its steps, expanded in turn; other input is kept as is.
+func (cb *ChatBot) expandInput(input string) ([]string, error) {
+	return cb.expandUserCommand(cb.userCommands(), input, 0)
+}
+
+func (cb *ChatBot) expandUserCommand(commands map[string]config.CommandSteps, input string, depth int) ([]string, error) {
+	parts := strings.Fields(input)
+	if len(parts) == 0 || !strings.HasPrefix(input, "/") {
+		return []string{input}, nil
+	}
+	steps, ok := commands[parts[0]]
+	if !ok {
+		return []string{input}, nil
+	}
+	if depth >= maxCommandDepth {
+		return nil, fmt.Errorf("%s: user commands nest more than %d levels deep, do they call each other?", parts[0], maxCommandDepth)
+	}
+
+	lines, err := substituteArgs(parts[0], steps, parts[1:])
+	if err != nil {
+		return nil, err
+	}
+	var expanded []string
+	for _, line := range lines {
+		more, err := cb.expandUserCommand(commands, line, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		expanded = append(expanded, more...)
+	}
+	return expanded, nil
+}
+
+// substituteArgs fills $1..$9 and $* in the steps of a user command. An
+// alias without placeholders passes its arguments on at the end instead.
+func substituteArgs(name string, steps config.CommandSteps, args []string) ([]string, error) {
+	placeholders := false
+	for _, step := range steps {
+		placeholders = placeholders || placeholderPattern.MatchString(step)
+	}
+	if !placeholders {
+		if len(args) == 0 {
+			return steps, nil
+		}
+		if len(steps) > 1 {
+			return nil, fmt.Errorf("%s takes no arguments", name)
+		}
+		return []string{steps[0] + " " + strings.Join(args, " ")}, nil
+	}
+
+	lines := make([]string, 0, len(steps))
+	for _, step := range steps {
+		lines = append(lines, placeholderPattern.ReplaceAllStringFunc(step, func(ref string) string {
+			if ref == "$*" {
+				return strings.Join(args, " ")
+			}
+			n, _ := strconv.Atoi(ref[1:])
+			if n > len(args) {
+				return ""
+			}
+			return args[n-1]
+		}))
+	}
+	return lines, nil
+}
+
+// handleHelpCommand handles /help
+func (cb *ChatBot) handleHelpCommand() error {
+	fmt.Println("Available commands:")
+	for _, c := range builtinCommands {
+		if c.available(cb) {
+			fmt.Printf("  %-25s - %s\n", c.usage, c.help)
+		}
+	}
+
+	user := cb.userCommands()
+	if len(user) > 0 {
+		names := make([]string, 0, len(user))
+		for name := range user {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fmt.Println("User commands (from the config file):")
+		for _, name := range names {
+			fmt.Printf("  %-25s - %s\n", name, strings.Join(user[name], "; "))
+		}
+	}
+	fmt.Println("Press Tab to complete commands, backends, session IDs, settings and MCP tool names.")
+	return nil
+}
+
+// handleNewSessionCommand handles /new-session
+func (cb *ChatBot) handleNewSessionCommand() error {
+	if err := cb.saveSession(); err != nil {
+		cb.logger.Error("failed to save current session", "error", err)
+	}
+	cb.session = cb.newSession()
+	fmt.Println("Started new session:", cb.session.ID)
+	return nil
+}
+
+// handleSwitchCommand handles /switch <backend|alias>
+func (cb *ChatBot) handleSwitchCommand(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("usage: /switch <backend|alias> (ollama|anthropic|grok|openai|mock)")
+	}
+	cb.mu.Lock()
+	fromBackend, fromModel := cb.session.Backend, cb.sessionModel(cb.session)
+	backendName, model, err := cb.switchBackend(cb.session, args[0])
+	if err != nil {
+		cb.mu.Unlock()
+		return err
+	}
+
+	// The history stays as stored and is converted on every request; the
+	// switch is recorded where it happened
+	converted := recordSwitch(cb.session, fromBackend, fromModel, backendName, model)
+	cb.mu.Unlock()
+	fmt.Printf("Switched to %s backend with model %s\n", backendName, model)
+	if converted != "" {
+		fmt.Printf("History converted for %s: %s\n", backendName, converted)
+	}
+	return nil
+}
+
+// switchTargets returns the backends and model aliases /switch accepts
+func switchTargets(cb *ChatBot) []string {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	options := append([]string(nil), config.Backends...)
+	for alias := range cb.cfg().Aliases {
+		options = append(options, alias)
+	}
+	return options
+}
+
+// handleListOllamaModelsCommand handles /list-ollama-models
+func (cb *ChatBot) handleListOllamaModelsCommand() error {
+	models, err := cb.listOllamaModels(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to list Ollama models: %w", err)
+	}
+	fmt.Println("\nAvailable Ollama models:")
+	for i, model := range models {
+		sizeGB := float64(model.Size) / (1024 * 1024 * 1024)
+		current := ""
+		if model.Name == cb.cfg().OllamaModel {
+			current = " (current)"
+		}
+		fmt.Printf("%d. %s - %.2f GB%s\n", i+1, model.Name, sizeGB, current)
+	}
+	fmt.Println()
+	return nil
+}
+
+// handleSetOllamaModelCommand handles /set-ollama-model <model>
+func (cb *ChatBot) handleSetOllamaModelCommand(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("usage: /set-ollama-model <model:version>")
+	}
+	modelName := args[0]
+	cb.mu.Lock()
+	cb.updateConfig(func(c *config.Config) { c.OllamaModel = modelName })
+	cb.mu.Unlock()
+	fmt.Printf("Ollama model set to: %s\n", modelName)
+	cb.learnContextWindow(modelName)
+	return nil
+}
+
+// mcpAvailable reports whether MCP is running, telling the user otherwise
+func (cb *ChatBot) mcpAvailable() bool {
+	if !cb.cfg().MCPEnabled || cb.mcpRegistry == nil {
+		fmt.Println("MCP is not enabled. Use --mcp-enabled flag to enable.")
+		return false
+	}
+	return true
+}
+
+// handleMCPListCommand handles /mcp-list
+func (cb *ChatBot) handleMCPListCommand() error {
+	if !cb.mcpAvailable() {
+		return nil
+	}
+	mcpTools := cb.getMCPTools()
+	if len(mcpTools) == 0 {
+		fmt.Println("No MCP tools available.")
+		return nil
+	}
+	fmt.Println("\nAvailable MCP Tools:")
+	for i, tool := range mcpTools {
+		tier := cb.toolTier(tool)
+		fmt.Printf("%d. %s (%s) [%s: %s]\n", i+1, tool.Name, tool.ServerName, tier, cb.cfg().PolicyForTier(tier))
+		fmt.Printf("   %s\n", tool.Description)
+	}
+	fmt.Println()
+	return nil
+}
+
+// handleMCPServersCommand handles /mcp-servers
+func (cb *ChatBot) handleMCPServersCommand() error {
+	if !cb.mcpAvailable() {
+		return nil
+	}
+	clients := cb.mcpRegistry.All()
+	if len(clients) == 0 {
+		fmt.Println("No MCP servers connected.")
+		return nil
+	}
+	fmt.Println("\nConnected MCP Servers:")
+	for i, client := range clients {
+		fmt.Printf("%d. %s\n", i+1, client.Name())
+	}
+	fmt.Printf("\nTotal: %d servers, %d tools\n\n", len(clients), len(cb.getMCPTools()))
+	return nil
+}
+
+// handleMCPReloadCommand handles /mcp-reload
+func (cb *ChatBot) handleMCPReloadCommand() error {
+	if !cb.mcpAvailable() {
+		return nil
+	}
+	if err := cb.refreshMCPTools(context.Background()); err != nil {
+		return fmt.Errorf("failed to reload MCP tools: %w", err)
+	}
+	fmt.Printf("Reloaded MCP tools. Total: %d tools from %d servers\n", len(cb.getMCPTools()), cb.mcpRegistry.Count())
+	return nil
+}
+
+// handleBackupCommand handles /backup
+func (cb *ChatBot) handleBackupCommand() error {
+	if cb.backups == nil {
+		fmt.Println("Backups are not enabled. Use --backup-dir to enable.")
+		return nil
+	}
+	path, err := cb.backups.RunOnce(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to back up database: %w", err)
+	}
+	fmt.Printf("Database backed up to %s\n", path)
+	return nil
+}
+
+// completeConfigArgs completes /config show|set and the setting keys
+func completeConfigArgs(_ *ChatBot, args []string) []string {
+	switch {
+	case len(args) == 0:
+		return []string{"show", "set"}
+	case len(args) == 1 || (len(args) == 2 && args[1] == "--save"):
+		var keys []string
+		for _, setting := range config.Settings() {
+			keys = append(keys, setting.Key)
+		}
+		if args[0] == "set" && len(args) == 1 {
+			keys = append(keys, "--save")
+		}
+		return keys
+	}
+	return nil
+}
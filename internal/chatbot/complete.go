@@ -0,0 +1,152 @@
+package chatbot
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+)
+
+// availableCommands returns the commands usable with the current setup,
+// including user-defined ones
+func (cb *ChatBot) availableCommands() []string {
+	var available []string
+	for _, c := range builtinCommands {
+		if c.available(cb) {
+			available = append(available, c.name)
+			available = append(available, c.aliases...)
+		}
+	}
+	for name := range cb.userCommands() {
+		available = append(available, name)
+	}
+	return available
+}
+
+// complete is the REPL's Tab completion: commands, their arguments (backends,
+// session IDs, settings, ...) and, in chat input, MCP tool names
+func (cb *ChatBot) complete(line string) []string {
+	fields := strings.Fields(line)
+	word := ""
+	if len(fields) > 0 && !strings.HasSuffix(line, " ") {
+		word = fields[len(fields)-1]
+		fields = fields[:len(fields)-1]
+	}
+
+	var options []string
+	switch {
+	case len(fields) == 0 && strings.HasPrefix(word, "/"):
+		options = cb.availableCommands()
+	case !strings.HasPrefix(line, "/"):
+		// Tool names only for a started word, not every blank
+		if word == "" {
+			return nil
+		}
+		for _, tool := range cb.getMCPTools() {
+			options = append(options, tool.Name)
+		}
+	default:
+		options = cb.completeArgs(fields[0], fields[1:])
+	}
+
+	var matches []string
+	for _, option := range options {
+		if strings.HasPrefix(option, word) {
+			matches = append(matches, option)
+		}
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+// completeArgs returns the values a command accepts after args
+func (cb *ChatBot) completeArgs(name string, args []string) []string {
+	c, ok := lookupCommand(name)
+	if !ok || c.complete == nil {
+		return nil
+	}
+	return c.complete(cb, args)
+}
+
+// sessionIDs returns the IDs of all stored sessions. Errors only mean no
+// completions, so they are logged.
+func (cb *ChatBot) sessionIDs() []string {
+	ids, err := querySessionIDs(cb.db)
+	if err != nil {
+		cb.logger.Warn("failed to list sessions for completion", "error", err)
+		return nil
+	}
+	return ids
+}
+
+// SessionIDs returns the IDs of the sessions in the database at dbPath, most
+// recent first, for shell completion. A missing database has no sessions
+// and is not created.
+func SessionIDs(dbPath string) ([]string, error) {
+	if _, err := os.Stat(dbPath); errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	db, err := sql.Open("sqlite3", "file:"+dbPath+"?mode=ro")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+	return querySessionIDs(db)
+}
+
+// querySessionIDs lists the session IDs in db, most recent first
+func querySessionIDs(db *sql.DB) ([]string, error) {
+	rows, err := db.Query("SELECT id FROM sessions ORDER BY start_time DESC")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to list sessions: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// unknownCommandError reports a mistyped command with the closest match
+func (cb *ChatBot) unknownCommandError(name string) error {
+	best, bestDistance := "", 3 // Suggest only within two edits
+	for _, command := range cb.availableCommands() {
+		if d := editDistance(name, command); d < bestDistance {
+			best, bestDistance = command, d
+		}
+	}
+	if best != "" {
+		return fmt.Errorf("unknown command %s, did you mean %s? (see /help)", name, best)
+	}
+	return fmt.Errorf("unknown command %s (see /help)", name)
+}
+
+// editDistance returns the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,89 @@
+package chatbot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"ExtraChat/internal/mcp"
+	"ExtraChat/internal/native"
+)
+
+// errToolDenied is returned when the user declines a tool call
+var errToolDenied = errors.New("the user denied this tool call")
+
+// confirmToolCall asks the user whether a tool may run, unless the tool is on
+// the auto-approve list or this server's tool was approved with "always"
+// earlier in this run.
+// Prompts are serialized because tools of one turn are invoked concurrently.
+func (cb *ChatBot) confirmToolCall(toolName, serverName, tier string, args map[string]interface{}) bool {
+	cb.confirmMu.Lock()
+	defer cb.confirmMu.Unlock()
+
+	if cb.toolAutoApproved(serverName, toolName) {
+		cb.logger.Info("tool call auto-approved", "tool", toolName, "server", serverName)
+		return true
+	}
+
+	// Without an interactive input there is nobody to ask
+	if cb.input == nil {
+		cb.logger.Warn("tool call denied, no interactive input", "tool", toolName, "server", serverName)
+		return false
+	}
+
+	argsJSON, err := json.MarshalIndent(args, "", "  ")
+	if err != nil {
+		argsJSON = []byte(fmt.Sprintf("%v", args))
+	}
+
+	// Keep running tools' progress off the prompt line
+	defer cb.progress.suspend()()
+
+	fmt.Printf("\nTool call requested: %s (server: %s, tier: %s)\n", toolName, serverName, tier)
+	fmt.Printf("Arguments:\n%s\n", argsJSON)
+	answer, err := cb.readLine("Allow? [y/N/a=always for this tool]: ")
+	if err != nil {
+		fmt.Println()
+		cb.logger.Warn("tool call denied, input closed", "tool", toolName, "server", serverName)
+		return false
+	}
+
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		cb.logger.Info("tool call approved", "tool", toolName, "server", serverName)
+		return true
+	case "a", "always":
+		cb.approvedTools[toolKey(serverName, toolName)] = true
+		cb.logger.Info("tool call approved for this run", "tool", toolName, "server", serverName)
+		return true
+	default:
+		fmt.Println("Tool call denied.")
+		cb.logger.Info("tool call denied by user", "tool", toolName, "server", serverName)
+		return false
+	}
+}
+
+// toolAutoApproved reports whether a tool may run without asking; callers
+// must hold cb.confirmMu
+func (cb *ChatBot) toolAutoApproved(serverName, toolName string) bool {
+	if cb.approvedTools[toolKey(serverName, toolName)] {
+		return true
+	}
+	for _, name := range cb.cfg().ToolAutoApprove {
+		// Shell commands must be approved by name, never by wildcard
+		if name == toolName || (name == "*" && toolName != native.RunCommandTool) {
+			return true
+		}
+	}
+	return false
+}
+
+// toolTier returns the permission tier of a tool: the configured one, or
+// else the one its annotations imply
+func (cb *ChatBot) toolTier(tool mcp.Tool) string {
+	if tier, ok := cb.cfg().ToolTiers[tool.Name]; ok {
+		return tier
+	}
+	return tool.Tier()
+}
@@ -0,0 +1,206 @@
+package chatbot
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"ExtraChat/internal/backend"
+	"ExtraChat/internal/session"
+)
+
+// messageFormat is how a backend's chat API expects a plain message
+type messageFormat int
+
+const (
+	chatFormat      messageFormat = iota // Role/content objects of the Ollama and OpenAI-compatible APIs
+	anthropicFormat                      // Anthropic messages
+)
+
+// chatMessage is a message of the Ollama and OpenAI-compatible APIs. The
+// fields are in the order json.Marshal writes the keys of a map, which the
+// requests used before.
+type chatMessage struct {
+	Content string `json:"content"`
+	Role    string `json:"role"`
+}
+
+// encode returns the JSON of one message in the format
+func (f messageFormat) encode(role, content string) (json.RawMessage, error) {
+	if f == anthropicFormat {
+		return json.Marshal(backend.AnthropicMessage{Role: role, Content: content})
+	}
+	return json.Marshal(chatMessage{Role: role, Content: content})
+}
+
+// conversationCacheSize is how many conversations keep their encoding
+// between turns
+const conversationCacheSize = 64
+
+// conversationCache keeps the JSON of recent conversations between turns,
+// so a turn encodes only the messages added since the previous one instead
+// of the whole history. A conversation is found by its first message and
+// reused up to the first message that changed; the least recently used is
+// dropped beyond conversationCacheSize.
+type conversationCache struct {
+	mu      sync.Mutex
+	entries map[conversationKey]*list.Element
+	recent  *list.List // Of *encodedConversation, most recently used first
+}
+
+type conversationKey struct {
+	format  messageFormat
+	firstID string
+}
+
+type encodedConversation struct {
+	key      conversationKey
+	messages []encodedMessage
+}
+
+// encodedMessage is a message with its JSON; role and content are kept to
+// notice a message that changed since it was encoded
+type encodedMessage struct {
+	id      string
+	role    string
+	content string
+	json    json.RawMessage
+}
+
+func newConversationCache() *conversationCache {
+	return &conversationCache{
+		entries: make(map[conversationKey]*list.Element),
+		recent:  list.New(),
+	}
+}
+
+// appendMessages appends the JSON of messages in the format to dst.
+// Messages without an ID, such as a prompt that isn't part of the session,
+// are encoded every time, as are all messages when c is nil.
+func (c *conversationCache) appendMessages(dst []json.RawMessage, format messageFormat, messages []session.Message) ([]json.RawMessage, error) {
+	cached := 0
+	if c != nil && len(messages) > 0 && messages[0].ID != "" {
+		c.mu.Lock()
+		conv := c.get(conversationKey{format: format, firstID: messages[0].ID})
+		for i, msg := range messages {
+			if msg.ID == "" {
+				break
+			}
+			if i < len(conv.messages) {
+				if prev := conv.messages[i]; prev.id == msg.ID && prev.role == msg.Role && prev.content == msg.Content {
+					dst = append(dst, prev.json)
+					cached++
+					continue
+				}
+				conv.messages = conv.messages[:i]
+			}
+			data, err := format.encode(msg.Role, msg.Content)
+			if err != nil {
+				c.mu.Unlock()
+				return nil, fmt.Errorf("failed to encode message: %w", err)
+			}
+			conv.messages = append(conv.messages, encodedMessage{id: msg.ID, role: msg.Role, content: msg.Content, json: data})
+			dst = append(dst, data)
+			cached++
+		}
+		c.mu.Unlock()
+	}
+
+	for _, msg := range messages[cached:] {
+		data, err := format.encode(msg.Role, msg.Content)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode message: %w", err)
+		}
+		dst = append(dst, data)
+	}
+	return dst, nil
+}
+
+// get returns the conversation of key, adding it if needed; callers must
+// hold c.mu
+func (c *conversationCache) get(key conversationKey) *encodedConversation {
+	if elem, ok := c.entries[key]; ok {
+		c.recent.MoveToFront(elem)
+		return elem.Value.(*encodedConversation)
+	}
+	conv := &encodedConversation{key: key}
+	c.entries[key] = c.recent.PushFront(conv)
+	if c.recent.Len() > conversationCacheSize {
+		oldest := c.recent.Back()
+		c.recent.Remove(oldest)
+		delete(c.entries, oldest.Value.(*encodedConversation).key)
+	}
+	return conv
+}
+
+// maxPooledRequestSize bounds the request buffers kept for reuse, so one
+// huge request doesn't pin its memory
+const maxPooledRequestSize = 16 << 20
+
+// requestBuffers holds the buffers request bodies are encoded into
+var requestBuffers = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+// requestBuffer is an encoded request body shared by the request and its
+// retries. It returns to the pool once the caller and every body reading it
+// released it.
+type requestBuffer struct {
+	buf  *bytes.Buffer
+	refs atomic.Int32
+}
+
+func (b *requestBuffer) release() {
+	if b.refs.Add(-1) == 0 && b.buf.Cap() <= maxPooledRequestSize {
+		requestBuffers.Put(b.buf)
+	}
+}
+
+// body returns a reader of the encoded request that releases the buffer
+// when it is closed
+func (b *requestBuffer) body() io.ReadCloser {
+	b.refs.Add(1)
+	return &requestBody{Reader: bytes.NewReader(b.buf.Bytes()), release: b.release}
+}
+
+type requestBody struct {
+	*bytes.Reader
+	once    sync.Once
+	release func()
+}
+
+func (r *requestBody) Close() error {
+	r.once.Do(r.release)
+	return nil
+}
+
+// newJSONRequest creates a POST request of v encoded into a pooled buffer.
+// Call release once the response has been read.
+func newJSONRequest(ctx context.Context, url string, v interface{}) (req *http.Request, release func(), err error) {
+	buf := requestBuffers.Get().(*bytes.Buffer)
+	buf.Reset()
+	if err := json.NewEncoder(buf).Encode(v); err != nil {
+		requestBuffers.Put(buf)
+		return nil, nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	buf.Truncate(buf.Len() - 1) // The newline Encode ends with
+
+	req, err = http.NewRequestWithContext(ctx, "POST", url, nil)
+	if err != nil {
+		requestBuffers.Put(buf)
+		return nil, nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	shared := &requestBuffer{buf: buf}
+	shared.refs.Store(1) // The caller's
+	req.Body = shared.body()
+	req.ContentLength = int64(buf.Len())
+	req.GetBody = func() (io.ReadCloser, error) { return shared.body(), nil }
+	req.Header.Set("content-type", "application/json")
+	return req, shared.release, nil
+}
@@ -0,0 +1,60 @@
+package chatbot
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"ExtraChat/internal/clipboard"
+)
+
+// codeBlockPattern matches a fenced Markdown code block, capturing its body
+var codeBlockPattern = regexp.MustCompile("(?ms)^[ \t]*```[^\n]*\n(.*?)^[ \t]*```")
+
+// handleCopyCommand handles /copy [code]: the last assistant response, or
+// the last code block in it, goes to the system clipboard
+func (cb *ChatBot) handleCopyCommand(args []string) error {
+	cb.mu.Lock()
+	var last string
+	for i := len(cb.session.Messages) - 1; i >= 0; i-- {
+		if cb.session.Messages[i].Role == "assistant" {
+			last = cb.session.Messages[i].Content
+			break
+		}
+	}
+	cb.mu.Unlock()
+	if last == "" {
+		return fmt.Errorf("no response to copy yet")
+	}
+
+	text, what := last, "last response"
+	if len(args) > 0 {
+		if args[0] != "code" {
+			return fmt.Errorf("usage: /copy [code]")
+		}
+		blocks := codeBlockPattern.FindAllStringSubmatch(last, -1)
+		if len(blocks) == 0 {
+			return fmt.Errorf("the last response has no code block")
+		}
+		text, what = strings.TrimSuffix(blocks[len(blocks)-1][1], "\n"), "last code block"
+	}
+
+	// The OSC 52 fallback only makes sense when a terminal will read it
+	var terminal io.Writer
+	if isTerminal(os.Stdout) {
+		terminal = os.Stdout
+	}
+	method, err := clipboard.Copy(text, terminal)
+	if err != nil {
+		return err
+	}
+	cb.logger.Debug("copied to clipboard", "what", what, "method", method, "bytes", len(text))
+	lines := "1 line"
+	if n := strings.Count(text, "\n") + 1; n > 1 {
+		lines = fmt.Sprintf("%d lines", n)
+	}
+	fmt.Printf("Copied %s (%s) to the clipboard via %s\n", what, lines, method)
+	return nil
+}
@@ -0,0 +1,171 @@
+package chatbot
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"ExtraChat/internal/pricing"
+	"ExtraChat/internal/telemetry"
+)
+
+// costSummary aggregates LLM requests for one backend and model
+type costSummary struct {
+	Backend      string
+	Model        string
+	Requests     int64
+	InputTokens  int64
+	OutputTokens int64
+	Cost         float64
+	Unpriced     int64 // Requests whose model has no known price
+}
+
+// recordCost persists the token usage and estimated cost of one LLM request,
+// at the batch price for results of a Message Batch. Failures are logged,
+// never returned.
+func (cb *ChatBot) recordCost(ctx context.Context, sessionID string, target llmTarget, input, output int64) {
+	cb.mu.Lock()
+	table := pricing.NewTable(cb.cfg().Pricing)
+	cb.mu.Unlock()
+
+	var cost interface{} // NULL when the model has no known price
+	if price, ok := table.Lookup(target.Backend, target.Model); ok {
+		if ctx.Value(batchPricedKey{}) != nil {
+			price = price.Batch()
+		}
+		cost = price.Cost(input, output)
+	}
+
+	_, err := cb.db.Exec(
+		"INSERT INTO llm_requests (session_id, backend, model, input_tokens, output_tokens, cost_usd, timestamp) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		sessionID, target.Backend, target.Model, input, output, cost, time.Now(),
+	)
+	if err != nil {
+		cb.logger.Warn("failed to record LLM request cost", "backend", target.Backend, "model", target.Model, "error", err)
+	}
+}
+
+// loadCostSummaries aggregates LLM requests per backend and model, filtered
+// by session (if sessionID is set) and by time (if since is non-zero)
+func loadCostSummaries(db *sql.DB, sessionID string, since time.Time) ([]costSummary, error) {
+	query := `SELECT backend, model, COUNT(*), SUM(input_tokens), SUM(output_tokens),
+		COALESCE(SUM(cost_usd), 0), SUM(CASE WHEN cost_usd IS NULL THEN 1 ELSE 0 END)
+		FROM llm_requests WHERE 1 = 1`
+	var args []interface{}
+	if sessionID != "" {
+		query += " AND session_id = ?"
+		args = append(args, sessionID)
+	}
+	if !since.IsZero() {
+		query += " AND timestamp >= ?"
+		args = append(args, since)
+	}
+	query += " GROUP BY backend, model ORDER BY backend, model"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query LLM requests: %w", err)
+	}
+	defer rows.Close()
+
+	var summaries []costSummary
+	for rows.Next() {
+		var s costSummary
+		if err := rows.Scan(&s.Backend, &s.Model, &s.Requests, &s.InputTokens, &s.OutputTokens, &s.Cost, &s.Unpriced); err != nil {
+			return nil, fmt.Errorf("failed to scan LLM requests: %w", err)
+		}
+		summaries = append(summaries, s)
+	}
+	return summaries, rows.Err()
+}
+
+// printCostSummaries writes a per-model cost table with a total line
+func printCostSummaries(w io.Writer, summaries []costSummary) {
+	if len(summaries) == 0 {
+		fmt.Fprintln(w, "No LLM requests recorded.")
+		return
+	}
+
+	var total costSummary
+	unpriced := false
+	fmt.Fprintf(w, "%-10s %-32s %8s %12s %12s %10s\n", "BACKEND", "MODEL", "REQUESTS", "INPUT", "OUTPUT", "COST")
+	for _, s := range summaries {
+		cost := fmt.Sprintf("$%.4f", s.Cost)
+		if s.Unpriced > 0 {
+			cost += "*"
+			unpriced = true
+		}
+		fmt.Fprintf(w, "%-10s %-32s %8d %12d %12d %10s\n", s.Backend, s.Model, s.Requests, s.InputTokens, s.OutputTokens, cost)
+		total.Requests += s.Requests
+		total.InputTokens += s.InputTokens
+		total.OutputTokens += s.OutputTokens
+		total.Cost += s.Cost
+	}
+	fmt.Fprintf(w, "%-10s %-32s %8d %12d %12d %10s\n", "total", "", total.Requests, total.InputTokens, total.OutputTokens, fmt.Sprintf("$%.4f", total.Cost))
+	if unpriced {
+		fmt.Fprintln(w, "* Some requests used a model without a known price; add it under pricing in the config file.")
+	}
+}
+
+// handleCostCommand handles /cost, the estimated cost of the current session
+func (cb *ChatBot) handleCostCommand() error {
+	cb.mu.Lock()
+	sessionID := cb.session.ID
+	cb.mu.Unlock()
+
+	summaries, err := loadCostSummaries(cb.db, sessionID, time.Time{})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("\nEstimated cost of session %s:\n", sessionID)
+	printCostSummaries(os.Stdout, summaries)
+	fmt.Println()
+	return nil
+}
+
+// ParseSince parses a report window such as "30d", "12h" or "90m"
+func ParseSince(spec string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(spec, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid duration %q", spec)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(spec)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid duration %q", spec)
+	}
+	return d, nil
+}
+
+// RunUsageReport prints token usage and estimated cost across all sessions
+// in the database at dbPath, for requests within the last since (all time
+// if zero)
+func RunUsageReport(w io.Writer, dbPath string, since time.Duration) error {
+	db, err := telemetry.InitDB(dbPath)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	var from time.Time
+	if since > 0 {
+		from = time.Now().Add(-since)
+		fmt.Fprintf(w, "Usage since %s:\n", from.Format("2006-01-02 15:04"))
+	} else {
+		fmt.Fprintln(w, "Usage, all time:")
+	}
+
+	summaries, err := loadCostSummaries(db, "", from)
+	if err != nil {
+		return err
+	}
+	printCostSummaries(w, summaries)
+	return nil
+}
@@ -0,0 +1,72 @@
+package chatbot
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"time"
+)
+
+// startTime is when the process started, for /diag
+var startTime = time.Now()
+
+// handleDiagCommand handles /diag: goroutines, memory and the state of every
+// MCP connection, for debugging hangs
+func (cb *ChatBot) handleDiagCommand() error {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	fmt.Println("\nRuntime:")
+	fmt.Printf("  Uptime:     %s\n", time.Since(startTime).Round(time.Second))
+	fmt.Printf("  Goroutines: %d\n", runtime.NumGoroutine())
+	fmt.Printf("  Heap:       %s in use, %s allocated, %d objects\n", formatBytes(mem.HeapInuse), formatBytes(mem.HeapAlloc), mem.HeapObjects)
+	fmt.Printf("  Memory:     %s from the OS, %s stacks\n", formatBytes(mem.Sys), formatBytes(mem.StackInuse))
+	fmt.Printf("  GC:         %d cycles, %s total pause\n", mem.NumGC, time.Duration(mem.PauseTotalNs).Round(time.Microsecond))
+	if cb.cfg().PprofAddr != "" {
+		fmt.Printf("  pprof:      http://%s/debug/pprof/\n", cb.pprofAddr)
+	}
+
+	if cb.mcpRegistry == nil {
+		fmt.Println()
+		return nil
+	}
+	clients := cb.mcpRegistry.All()
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i].Name() < clients[j].Name()
+	})
+
+	fmt.Printf("\nMCP connections (%d):\n", len(clients))
+	for _, client := range clients {
+		d := client.Diagnostics()
+		state := "open"
+		if d.Closed {
+			state = "closed"
+		} else if d.Err != "" {
+			state = "failed"
+		}
+		fmt.Printf("  %s [%s, %s] %d pending\n", client.Name(), d.Transport, state, d.Pending)
+		fmt.Printf("    Target:  %s\n", d.Target)
+		if d.PID != 0 {
+			fmt.Printf("    PID:     %d (%s framing)\n", d.PID, d.Framing)
+		}
+		if d.Err != "" {
+			fmt.Printf("    Error:   %s\n", previewText(d.Err, 100))
+		}
+	}
+	fmt.Println()
+	return nil
+}
+
+// formatBytes formats a byte count with a binary unit
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,79 @@
+package chatbot
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// editorCommand returns the user's editor: $VISUAL, then $EDITOR, then the
+// platform default. The value may include arguments, e.g. "code --wait".
+func editorCommand() []string {
+	for _, env := range []string{"VISUAL", "EDITOR"} {
+		if fields := strings.Fields(os.Getenv(env)); len(fields) > 0 {
+			return fields
+		}
+	}
+	if runtime.GOOS == "windows" {
+		return []string{"notepad"}
+	}
+	return []string{"vi"}
+}
+
+// composeInEditor opens the user's editor on a temporary file holding
+// initial and returns the saved contents, trimmed. An empty result means
+// nothing should be sent.
+func (cb *ChatBot) composeInEditor(initial string) (string, error) {
+	f, err := os.CreateTemp("", "extrachat-*.md")
+	if err != nil {
+		return "", fmt.Errorf("failed to create message file: %w", err)
+	}
+	path := f.Name()
+	defer os.Remove(path)
+
+	if initial != "" {
+		_, err = f.WriteString(initial + "\n")
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to write message file: %w", err)
+	}
+
+	if cb.tui != nil {
+		defer cb.tui.suspend()()
+	}
+	editor := editorCommand()
+	cmd := exec.Command(editor[0], append(editor[1:], path)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cb.logger.Debug("opening editor", "editor", strings.Join(editor, " "), "path", path)
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("editor %s failed: %w", editor[0], err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read message file: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// handleEditorCommand handles /editor [text]: the composed message is sent
+// as the next turn
+func (cb *ChatBot) handleEditorCommand(args []string) (commandResult, error) {
+	composed, err := cb.composeInEditor(strings.Join(args, " "))
+	if err != nil {
+		return commandResult{}, err
+	}
+	if composed == "" {
+		fmt.Println("Empty message, nothing sent.")
+		return commandResult{}, nil
+	}
+	fmt.Printf("Sending %d characters from the editor.\n", len([]rune(composed)))
+	return commandResult{send: composed}, nil
+}
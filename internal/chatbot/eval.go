@@ -0,0 +1,363 @@
+package chatbot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+
+	"ExtraChat/internal/config"
+	"ExtraChat/internal/eval"
+	"ExtraChat/internal/pricing"
+	"ExtraChat/internal/session"
+)
+
+// rubricInstructions is the judge's system prompt for rubric assertions
+const rubricInstructions = "You grade a reply to a prompt against a rubric. Score how well the reply meets the rubric " +
+	"from 0 (not at all) to 10 (fully). Answer with the score on the first line and one sentence of reasoning on the second."
+
+// rubricPrompt shows the judge the rubric, the prompt and the reply
+const rubricPrompt = "Rubric: %s\n\nPrompt:\n%s\n\nReply:\n%s"
+
+// evalRecord is the report of a suite run, written as is with --output json
+type evalRecord struct {
+	Suite      string             `json:"suite"`
+	Targets    []evalTargetRecord `json:"targets"`
+	Judge      *evalModel         `json:"judge,omitempty"` // nil without rubrics
+	JudgeUsage turnUsage          `json:"judge_usage"`
+	Passed     int                `json:"passed"` // Cases passed, over all targets
+	Failed     int                `json:"failed"`
+	LatencyMS  int64              `json:"latency_ms"`
+	TraceID    string             `json:"trace_id"`
+}
+
+// evalModel is a backend and model of a suite run
+type evalModel struct {
+	Backend string `json:"backend"`
+	Model   string `json:"model"`
+}
+
+// evalTargetRecord is how a model did on the suite
+type evalTargetRecord struct {
+	evalModel
+	Passed    int              `json:"passed"`
+	Score     float64          `json:"score"` // Mean of the case scores, from 0 to 1
+	Usage     turnUsage        `json:"usage"`
+	CostUSD   *float64         `json:"cost_usd,omitempty"` // nil if the model has no price
+	LatencyMS int64            `json:"latency_ms"`
+	Cases     []evalCaseRecord `json:"cases"`
+}
+
+// evalCaseRecord is how a model did on a case
+type evalCaseRecord struct {
+	Case      string        `json:"case"`
+	Prompt    string        `json:"prompt"`
+	Response  string        `json:"response"`
+	Error     string        `json:"error,omitempty"`
+	Passed    bool          `json:"passed"`
+	Score     float64       `json:"score"`
+	Results   []eval.Result `json:"results"`
+	Usage     turnUsage     `json:"usage"`
+	LatencyMS int64         `json:"latency_ms"`
+}
+
+// RunEval runs every case of the suite on each of targets, model refs given
+// as aliases, backends or backend/model, or else on the suite's backends or
+// the configured one. A scored report goes to out, as Markdown or with JSON
+// output as a record; each case's outcome goes to progress as it finishes.
+// It fails if any case failed, after writing the report.
+func (cb *ChatBot) RunEval(ctx context.Context, out, progress io.Writer, suite *eval.Suite, targets []string) error {
+	record, err := cb.runEval(ctx, progress, suite, targets)
+	if err != nil {
+		return err
+	}
+
+	if cb.cfg().Output == config.OutputJSON {
+		enc := json.NewEncoder(out)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(record); err != nil {
+			return fmt.Errorf("failed to write eval record: %w", err)
+		}
+	} else {
+		writeEvalReport(out, record)
+	}
+	fmt.Fprintf(progress, "Trace: %s\n", record.TraceID)
+	if record.Failed > 0 {
+		return fmt.Errorf("%d of %d cases failed", record.Failed, record.Passed+record.Failed)
+	}
+	return nil
+}
+
+// runEval runs the suite and scores the replies. Cases are single turns
+// without tools that bypass the response cache, so every run measures the
+// models as they are.
+func (cb *ChatBot) runEval(ctx context.Context, progress io.Writer, suite *eval.Suite, refs []string) (*evalRecord, error) {
+	if len(refs) == 0 {
+		refs = suite.Backends
+	}
+	cb.mu.Lock()
+	if len(refs) == 0 {
+		refs = []string{cb.session.Backend}
+	}
+	var targets []llmTarget
+	var resolveErr error
+	for _, ref := range refs {
+		target, err := cb.resolveEvalModel(ref)
+		if err != nil {
+			resolveErr = fmt.Errorf("model %s: %w", ref, err)
+			break
+		}
+		targets = append(targets, target)
+	}
+	judgeRef := suite.Judge
+	if judgeRef == "" {
+		judgeRef = cb.session.Backend
+	}
+	judge, judgeErr := cb.resolveEvalModel(judgeRef)
+	judge.System = rubricInstructions
+	table := pricing.NewTable(cb.cfg().Pricing)
+	sessionID := cb.session.ID
+	cb.mu.Unlock()
+	if resolveErr != nil {
+		return nil, resolveErr
+	}
+	for _, target := range targets {
+		if err := allowBackend(ctx, target.Backend); err != nil {
+			return nil, err
+		}
+	}
+
+	rubrics := false
+	for _, c := range suite.Cases {
+		for _, a := range c.Assert {
+			rubrics = rubrics || a.Kind() == eval.KindRubric
+		}
+	}
+	if rubrics && judgeErr != nil {
+		return nil, fmt.Errorf("invalid judge: %w", judgeErr)
+	}
+
+	ctx, span := cb.tracer.Start(ctx, "eval")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("suite", suite.Name),
+		attribute.Int("cases", len(suite.Cases)),
+		attribute.Int("targets", len(targets)),
+	)
+	record := &evalRecord{Suite: suite.Name, TraceID: span.SpanContext().TraceID().String()}
+	if rubrics {
+		record.Judge = &evalModel{Backend: judge.Backend, Model: judge.Model}
+	}
+	start := time.Now()
+
+	// scoreRubric has the judge score a reply, adding its tokens to the record
+	scoreRubric := func(ctx context.Context, rubric, prompt, reply string) (int, string, error) {
+		score, reason, usage, err := cb.judgeRubric(ctx, sessionID, judge, rubric, prompt, reply)
+		record.JudgeUsage.Requests += usage.Requests
+		record.JudgeUsage.PromptTokens += usage.PromptTokens
+		record.JudgeUsage.CompletionTokens += usage.CompletionTokens
+		return score, reason, err
+	}
+
+	total := len(targets) * len(suite.Cases)
+	for _, target := range targets {
+		result := evalTargetRecord{evalModel: evalModel{Backend: target.Backend, Model: target.Model}}
+		for _, c := range suite.Cases {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			caseResult := cb.runEvalCase(ctx, sessionID, target, c, scoreRubric)
+			result.Cases = append(result.Cases, caseResult)
+			result.Score += caseResult.Score / float64(len(suite.Cases))
+			result.Usage.Requests += caseResult.Usage.Requests
+			result.Usage.PromptTokens += caseResult.Usage.PromptTokens
+			result.Usage.CompletionTokens += caseResult.Usage.CompletionTokens
+			result.LatencyMS += caseResult.LatencyMS
+
+			outcome := "passed"
+			if caseResult.Passed {
+				result.Passed++
+				record.Passed++
+			} else {
+				outcome = "failed"
+				record.Failed++
+			}
+			fmt.Fprintf(progress, "[%d/%d] %s %s: %s %s, score %.0f%%\n", record.Passed+record.Failed, total,
+				target.Backend, target.Model, c.Name, outcome, caseResult.Score*100)
+		}
+		if cost, ok := requestCost(table, target, result.Usage); ok {
+			result.CostUSD = &cost
+		}
+		record.Targets = append(record.Targets, result)
+	}
+	record.LatencyMS = time.Since(start).Milliseconds()
+
+	span.SetAttributes(attribute.Int("passed", record.Passed), attribute.Int("failed", record.Failed))
+	if record.Failed > 0 {
+		span.SetStatus(codes.Error, fmt.Sprintf("%d cases failed", record.Failed))
+	}
+	cb.logger.Info("eval finished", "suite", suite.Name, "targets", len(targets), "cases", len(suite.Cases),
+		"passed", record.Passed, "failed", record.Failed, "latency_ms", record.LatencyMS)
+	return record, nil
+}
+
+// resolveEvalModel returns the target of a model ref: an alias, a backend
+// with its configured model or backend/model; callers hold cb.mu
+func (cb *ChatBot) resolveEvalModel(ref string) (llmTarget, error) {
+	backendName, model, err := cb.cfg().ResolveRouteModel(ref)
+	if err != nil {
+		return llmTarget{}, err
+	}
+	if model == "" {
+		model = cb.modelFor(backendName)
+	}
+	return llmTarget{Backend: backendName, Model: model}, nil
+}
+
+// runEvalCase sends a case's prompt to target and checks the reply
+func (cb *ChatBot) runEvalCase(ctx context.Context, sessionID string, target llmTarget, c *eval.Case, judge eval.Judge) evalCaseRecord {
+	// recordUsage adds each request's tokens to the turn record
+	usage := &turnRecord{}
+	ctx = context.WithValue(ctx, turnRecordKey{}, usage)
+	ctx, span := cb.tracer.Start(ctx, "eval_case")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("case", c.Name),
+		attribute.String("backend", target.Backend),
+		attribute.String("model", target.Model),
+	)
+
+	result := evalCaseRecord{Case: c.Name, Prompt: c.Prompt}
+	target.System = c.System
+	cb.auditPrompt(sessionID, target, "eval", c.Prompt)
+	start := time.Now()
+	response, err := cb.callBackend(ctx, target, []session.Message{{Role: "user", Content: c.Prompt}})
+	latency := time.Since(start)
+	cb.turnStats.record(ctx, target, latency, err)
+	cb.auditResponse(sessionID, target, "eval", response, false, err)
+	result.Usage = usage.Usage
+	result.LatencyMS = latency.Milliseconds()
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		cb.logger.Warn("eval case failed", "case", c.Name, "backend", target.Backend, "model", target.Model, "error", err)
+		result.Error = err.Error()
+		return result
+	}
+
+	result.Response = response
+	result.Results = c.Check(ctx, response, judge)
+	result.Score, result.Passed = c.Score(result.Results)
+	span.SetAttributes(
+		attribute.Bool("passed", result.Passed),
+		attribute.Float64("score", result.Score),
+		attribute.Int64("prompt_tokens", usage.Usage.PromptTokens),
+		attribute.Int64("completion_tokens", usage.Usage.CompletionTokens),
+	)
+	return result
+}
+
+// judgeRubric has the judge score a reply against a rubric from 0 to
+// eval.MaxScore
+func (cb *ChatBot) judgeRubric(ctx context.Context, sessionID string, judge llmTarget, rubric, prompt, reply string) (int, string, turnUsage, error) {
+	usage := &turnRecord{}
+	ctx = context.WithValue(ctx, turnRecordKey{}, usage)
+	request := fmt.Sprintf(rubricPrompt, rubric, prompt, reply)
+	cb.auditPrompt(sessionID, judge, "eval", request)
+	start := time.Now()
+	// The judge only sees the prompt and a reply, which passed the guardrails
+	answer, err := cb.sendToBackend(ctx, judge, []session.Message{{Role: "user", Content: request}})
+	cb.turnStats.record(ctx, judge, time.Since(start), err)
+	cb.auditResponse(sessionID, judge, "eval", answer, false, err)
+	if err != nil {
+		return 0, "", usage.Usage, err
+	}
+
+	// The first number on the scale is the score; the rest is the reasoning
+	for _, loc := range replyNumber.FindAllStringIndex(answer, -1) {
+		score, err := strconv.Atoi(answer[loc[0]:loc[1]])
+		if err == nil && score >= 0 && score <= eval.MaxScore {
+			reason := strings.TrimLeft(answer[loc[1]:], " /0123456789.:,-\n")
+			return score, previewText(reason, 200), usage.Usage, nil
+		}
+	}
+	return 0, "", usage.Usage, fmt.Errorf("no score in the answer %q", previewText(answer, 80))
+}
+
+// writeEvalReport writes the report of a suite run as Markdown: a table of
+// how each model did, then each case with the failed assertions and replies
+func writeEvalReport(w io.Writer, record *evalRecord) {
+	cases := 0
+	if len(record.Targets) > 0 {
+		cases = len(record.Targets[0].Cases)
+	}
+	fmt.Fprintf(w, "# Eval: %s\n\n", record.Suite)
+	fmt.Fprintf(w, "%d cases on %d models", cases, len(record.Targets))
+	if record.Judge != nil {
+		fmt.Fprintf(w, ", rubrics scored by %s %s (%d prompt and %d completion tokens)", record.Judge.Backend, record.Judge.Model,
+			record.JudgeUsage.PromptTokens, record.JudgeUsage.CompletionTokens)
+	}
+	fmt.Fprintf(w, ".\n\n")
+
+	fmt.Fprintln(w, "| Model | Passed | Score | Tokens | Latency | Cost |")
+	fmt.Fprintln(w, "|-------|--------|-------|--------|---------|------|")
+	for _, t := range record.Targets {
+		cost := "unknown"
+		if t.CostUSD != nil {
+			cost = fmt.Sprintf("$%.4f", *t.CostUSD)
+		}
+		fmt.Fprintf(w, "| %s %s | %d/%d | %.0f%% | %d | %s | %s |\n", t.Backend, t.Model, t.Passed, len(t.Cases), t.Score*100,
+			t.Usage.PromptTokens+t.Usage.CompletionTokens, time.Duration(t.LatencyMS)*time.Millisecond, cost)
+	}
+
+	for i := 0; i < cases; i++ {
+		first := record.Targets[0].Cases[i]
+		fmt.Fprintf(w, "\n## %s\n\n", first.Case)
+		fmt.Fprintf(w, "> %s\n\n", strings.ReplaceAll(strings.TrimSpace(first.Prompt), "\n", "\n> "))
+		fmt.Fprintln(w, "| Model | Result | Score | Failed assertions |")
+		fmt.Fprintln(w, "|-------|--------|-------|-------------------|")
+		var failed []evalTargetRecord
+		for _, t := range record.Targets {
+			c := t.Cases[i]
+			outcome, problems := "pass", failedAssertions(c)
+			if !c.Passed {
+				outcome = "**FAIL**"
+				failed = append(failed, t)
+			}
+			fmt.Fprintf(w, "| %s %s | %s | %.0f%% | %s |\n", t.Backend, t.Model, outcome, c.Score*100, markdownCell(problems))
+		}
+		for _, t := range failed {
+			c := t.Cases[i]
+			if c.Error != "" {
+				continue
+			}
+			fmt.Fprintf(w, "\n<details><summary>Reply of %s %s</summary>\n\n```\n%s\n```\n\n</details>\n", t.Backend, t.Model,
+				strings.ReplaceAll(strings.TrimSpace(c.Response), "```", "'''"))
+		}
+	}
+}
+
+// failedAssertions lists why a case failed
+func failedAssertions(c evalCaseRecord) string {
+	if c.Error != "" {
+		return "error: " + c.Error
+	}
+	var problems []string
+	for _, r := range c.Results {
+		if !r.Passed {
+			problems = append(problems, r.Assertion+": "+r.Detail)
+		}
+	}
+	return strings.Join(problems, "; ")
+}
+
+// markdownCell makes text safe for a Markdown table cell
+func markdownCell(text string) string {
+	return strings.ReplaceAll(strings.Join(strings.Fields(text), " "), "|", `\|`)
+}
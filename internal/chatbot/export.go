@@ -0,0 +1,266 @@
+package chatbot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"ExtraChat/internal/audit"
+	"ExtraChat/internal/dataset"
+	"ExtraChat/internal/session"
+)
+
+// How tool calls are exported
+const (
+	ExportToolsOmit    = "omit"    // Only the text of the conversation
+	ExportToolsInclude = "include" // Tool calls and their results before the reply
+)
+
+// ExportTools lists the tool call handling options of an export
+var ExportTools = []string{ExportToolsOmit, ExportToolsInclude}
+
+// ExportOptions controls an export of sessions as a fine-tuning dataset
+type ExportOptions struct {
+	SessionIDs []string          // Sessions to export, in order
+	All        bool              // Export every session instead, oldest first
+	Format     string            // dataset.FormatShareGPT or dataset.FormatOpenAIFT
+	Roles      map[string]string // Overrides of the format's role names
+	Tools      string            // ExportToolsOmit or ExportToolsInclude
+	NoSystem   bool              // Leave out the persona's system prompt
+}
+
+// exportStats counts what an export wrote and left out
+type exportStats struct {
+	exported       int
+	skipped        int
+	toolCalls      int
+	missingResults int
+}
+
+// RunExport writes sessions as a fine-tuning dataset to out, one JSON line
+// per session. Stopped replies are left out with their prompt, as are
+// prompts that got no reply; a session left with no reply is skipped. With
+// tools included, results come from the audit log, since the database only
+// keeps their hash. Skipped sessions and a summary go to progress.
+func (cb *ChatBot) RunExport(ctx context.Context, out, progress io.Writer, opts ExportOptions) error {
+	if !dataset.ValidFormat(opts.Format) {
+		return fmt.Errorf("unknown format %q (want %s)", opts.Format, strings.Join(dataset.Formats, " or "))
+	}
+	if opts.Tools != ExportToolsOmit && opts.Tools != ExportToolsInclude {
+		return fmt.Errorf("unknown tool handling %q (want %s)", opts.Tools, strings.Join(ExportTools, " or "))
+	}
+	ids := opts.SessionIDs
+	if opts.All {
+		all, err := querySessionIDs(cb.db)
+		if err != nil {
+			return err
+		}
+		// Listed most recent first
+		ids = make([]string, len(all))
+		for i, id := range all {
+			ids[len(all)-1-i] = id
+		}
+	}
+	if len(ids) == 0 {
+		return errors.New("no sessions to export")
+	}
+
+	ctx, span := cb.tracer.Start(ctx, "export")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("format", opts.Format),
+		attribute.String("tools", opts.Tools),
+		attribute.Int("sessions", len(ids)),
+	)
+
+	var results map[string][]audit.Entry
+	if opts.Tools == ExportToolsInclude {
+		var err error
+		if results, err = cb.auditedToolResults(); err != nil {
+			return err
+		}
+	}
+	w, err := dataset.NewWriter(out, opts.Format, opts.Roles)
+	if err != nil {
+		return err
+	}
+
+	var stats exportStats
+	for _, id := range ids {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		conv, err := cb.exportConversation(id, opts, results, &stats)
+		if err != nil {
+			return err
+		}
+		if conv == nil {
+			stats.skipped++
+			fmt.Fprintf(progress, "Skipped session %s: no completed replies\n", id)
+			continue
+		}
+		if err := w.Write(*conv); err != nil {
+			return err
+		}
+		stats.exported++
+	}
+
+	span.SetAttributes(attribute.Int("exported", stats.exported), attribute.Int("skipped", stats.skipped))
+	fmt.Fprintf(progress, "Exported %d of %d sessions as %s", stats.exported, len(ids), opts.Format)
+	if opts.Tools == ExportToolsInclude {
+		fmt.Fprintf(progress, " with %d tool calls", stats.toolCalls)
+	}
+	fmt.Fprintln(progress)
+	if stats.missingResults > 0 {
+		fmt.Fprintf(progress, "%d tool results were not in the audit log and are exported empty\n", stats.missingResults)
+	}
+	return nil
+}
+
+// exportConversation converts a session into dataset turns, or returns nil
+// if it has no completed reply
+func (cb *ChatBot) exportConversation(id string, opts ExportOptions, results map[string][]audit.Entry, stats *exportStats) (*dataset.Conversation, error) {
+	// Every message is exported, however long the session
+	sess, err := cb.loadSessionPage(id, 0)
+	if err != nil {
+		return nil, err
+	}
+	var calls []toolCallEntry
+	if opts.Tools == ExportToolsInclude {
+		// A negative limit is no limit to SQLite
+		if calls, err = cb.loadToolCalls(sess.ID, -1); err != nil {
+			return nil, err
+		}
+	}
+
+	conv := &dataset.Conversation{ID: sess.ID}
+	if !opts.NoSystem && sess.Persona != "" {
+		cb.mu.Lock()
+		persona, ok := cb.cfg().Persona(sess.Persona)
+		cb.mu.Unlock()
+		if ok && persona.System != "" {
+			conv.Turns = append(conv.Turns, dataset.Turn{Role: dataset.RoleSystem, Content: persona.System})
+		} else if !ok {
+			cb.logger.Warn("session persona is not defined, exporting no system prompt", "session_id", sess.ID, "persona", sess.Persona)
+		}
+	}
+
+	replies := 0
+	var prompt *session.Message
+	for i := range sess.Messages {
+		msg := &sess.Messages[i]
+		switch msg.Role {
+		case "system":
+			if !opts.NoSystem {
+				conv.Turns = append(conv.Turns, dataset.Turn{Role: dataset.RoleSystem, Content: msg.Content})
+			}
+		case "user":
+			// A prompt followed by another one got no reply
+			prompt = msg
+		case "assistant":
+			// The tool calls made for this reply come before it
+			var pending []toolCallEntry
+			for len(calls) > 0 && !calls[0].Timestamp.After(msg.Timestamp) {
+				pending = append(pending, calls[0])
+				calls = calls[1:]
+			}
+			if msg.Truncated {
+				prompt = nil
+				continue
+			}
+			if prompt != nil {
+				conv.Turns = append(conv.Turns, dataset.Turn{Role: dataset.RoleUser, Content: prompt.Content})
+				prompt = nil
+			} else if replies == 0 {
+				// Datasets start with a prompt
+				continue
+			}
+			conv.Turns = append(conv.Turns, exportToolTurns(sess.ID, pending, results, stats)...)
+			conv.Turns = append(conv.Turns, dataset.Turn{Role: dataset.RoleAssistant, Content: msg.Content})
+			replies++
+		}
+	}
+	if replies == 0 {
+		return nil, nil
+	}
+	return conv, nil
+}
+
+// exportToolTurns turns tool calls into a call turn and a result turn
+// each, the results matched from the audit log in the order they were made
+func exportToolTurns(sessionID string, calls []toolCallEntry, results map[string][]audit.Entry, stats *exportStats) []dataset.Turn {
+	var turns []dataset.Turn
+	for _, call := range calls {
+		stats.toolCalls++
+		callID := fmt.Sprintf("call_%d", stats.toolCalls)
+		var args map[string]interface{}
+		if err := json.Unmarshal([]byte(call.Arguments), &args); err != nil {
+			args = map[string]interface{}{}
+		}
+		turns = append(turns, dataset.Turn{Role: dataset.RoleToolCall, CallID: callID, Tool: call.Tool, Arguments: args})
+
+		// Failed calls are exported the way the model saw them
+		content := ""
+		if call.Error != "" {
+			content = "Error: " + call.Error
+		}
+		key := toolResultKey(sessionID, call.Server, call.Tool, call.Arguments)
+		if queue := results[key]; len(queue) > 0 {
+			if call.Error == "" {
+				content = toolResultContent(queue[0].Result)
+			}
+			results[key] = queue[1:]
+		} else if call.Error == "" {
+			stats.missingResults++
+		}
+		turns = append(turns, dataset.Turn{Role: dataset.RoleToolResult, CallID: callID, Content: content})
+	}
+	return turns
+}
+
+// auditedToolResults reads the tool calls of the audit log, keyed by
+// toolResultKey in the order they were made. Without an audit log there are
+// none.
+func (cb *ChatBot) auditedToolResults() (map[string][]audit.Entry, error) {
+	results := make(map[string][]audit.Entry)
+	if cb.cfg().AuditLog == "" {
+		return results, nil
+	}
+	err := audit.Read(cb.cfg().AuditLog, func(entry audit.Entry) error {
+		if entry.Type != audit.TypeToolCall {
+			return nil
+		}
+		arguments, err := json.Marshal(entry.Arguments)
+		if err != nil {
+			return nil
+		}
+		key := toolResultKey(entry.SessionID, entry.Server, entry.Tool, string(arguments))
+		results[key] = append(results[key], entry)
+		return nil
+	})
+	return results, err
+}
+
+// toolResultKey identifies a tool call in both the database and the audit
+// log, which share no ID. Arguments are the JSON encoding, whose keys are
+// sorted.
+func toolResultKey(sessionID, server, tool, arguments string) string {
+	if arguments == "" || arguments == "null" {
+		arguments = "{}"
+	}
+	return strings.Join([]string{sessionID, server, tool, arguments}, "\x00")
+}
+
+// toolResultContent is a tool result as runToolUse sends it to the model
+func toolResultContent(result interface{}) string {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Sprintf("%v", result)
+	}
+	return string(data)
+}
@@ -0,0 +1,270 @@
+package chatbot
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// quickSwitchKey is the byte a terminal sends for Ctrl+K; a line containing
+// it opens the quick switcher with the rest of the line as the query
+const quickSwitchKey = '\v'
+
+// maxQuickSwitchMatches limits how many favorites the quick switcher lists
+const maxQuickSwitchMatches = 10
+
+// favoriteSession is a favorited session as listed by the quick switcher
+type favoriteSession struct {
+	ID        string
+	Title     string
+	Tags      []string
+	StartTime time.Time
+}
+
+// searchText is the text the quick switcher matches a query against
+func (f favoriteSession) searchText() string {
+	fields := append([]string{f.Title, f.ID}, f.Tags...)
+	return strings.Join(fields, " ")
+}
+
+// label describes the favorite on a single line
+func (f favoriteSession) label() string {
+	var sb strings.Builder
+	sb.WriteString(f.ID)
+	if f.Title != "" {
+		fmt.Fprintf(&sb, " %q", f.Title)
+	}
+	if len(f.Tags) > 0 {
+		fmt.Fprintf(&sb, " [%s]", strings.Join(f.Tags, ", "))
+	}
+	return sb.String()
+}
+
+// splitTags parses a stored comma-separated tag list
+func splitTags(tags string) []string {
+	var out []string
+	for _, tag := range strings.Split(tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			out = append(out, tag)
+		}
+	}
+	return out
+}
+
+// mergeTags adds new tags to an existing list, keeping the original order
+func mergeTags(existing, added []string) []string {
+	seen := make(map[string]bool, len(existing))
+	for _, tag := range existing {
+		seen[tag] = true
+	}
+	for _, tag := range added {
+		tag = strings.ToLower(strings.Trim(tag, "#,"))
+		if tag != "" && !seen[tag] {
+			seen[tag] = true
+			existing = append(existing, tag)
+		}
+	}
+	return existing
+}
+
+// handleFavoriteCommand handles /favorite [tag ...], pinning the current
+// session to the quick switcher and optionally tagging it
+func (cb *ChatBot) handleFavoriteCommand(args []string) error {
+	if err := cb.saveSession(); err != nil {
+		return fmt.Errorf("failed to save current session: %w", err)
+	}
+
+	cb.mu.Lock()
+	sessionID := cb.session.ID
+	cb.mu.Unlock()
+
+	var stored string
+	if err := cb.db.QueryRow("SELECT COALESCE(tags, '') FROM sessions WHERE id = ?", sessionID).Scan(&stored); err != nil {
+		return fmt.Errorf("failed to load session %s: %w", sessionID, err)
+	}
+	tags := mergeTags(splitTags(stored), args)
+
+	if _, err := cb.db.Exec(
+		"UPDATE sessions SET favorite = 1, tags = NULLIF(?, '') WHERE id = ?",
+		strings.Join(tags, ","), sessionID,
+	); err != nil {
+		return fmt.Errorf("failed to favorite session: %w", err)
+	}
+
+	cb.logger.Info("favorited session", "session_id", sessionID, "tags", tags)
+	if len(tags) > 0 {
+		fmt.Printf("Added %s to favorites [%s]\n", sessionID, strings.Join(tags, ", "))
+	} else {
+		fmt.Printf("Added %s to favorites\n", sessionID)
+	}
+	return nil
+}
+
+// handleUnfavoriteCommand handles /unfavorite
+func (cb *ChatBot) handleUnfavoriteCommand() error {
+	cb.mu.Lock()
+	sessionID := cb.session.ID
+	cb.mu.Unlock()
+
+	if _, err := cb.db.Exec("UPDATE sessions SET favorite = 0 WHERE id = ?", sessionID); err != nil {
+		return fmt.Errorf("failed to unfavorite session: %w", err)
+	}
+
+	cb.logger.Info("unfavorited session", "session_id", sessionID)
+	fmt.Printf("Removed %s from favorites\n", sessionID)
+	return nil
+}
+
+// loadFavorites returns favorited sessions, most recent first
+func (cb *ChatBot) loadFavorites() ([]favoriteSession, error) {
+	rows, err := cb.db.Query(
+		"SELECT id, COALESCE(title, ''), COALESCE(tags, ''), start_time FROM sessions WHERE favorite = 1 ORDER BY start_time DESC",
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load favorites: %w", err)
+	}
+	defer rows.Close()
+
+	var favorites []favoriteSession
+	for rows.Next() {
+		var fav favoriteSession
+		var tags string
+		if err := rows.Scan(&fav.ID, &fav.Title, &tags, &fav.StartTime); err != nil {
+			return nil, fmt.Errorf("failed to scan favorite: %w", err)
+		}
+		fav.Tags = splitTags(tags)
+		favorites = append(favorites, fav)
+	}
+	return favorites, rows.Err()
+}
+
+// fuzzyScore reports whether every rune of query appears in text in order,
+// scoring consecutive runs and matches at word starts higher
+func fuzzyScore(query, text string) (int, bool) {
+	q := []rune(strings.ToLower(strings.Join(strings.Fields(query), "")))
+	t := []rune(strings.ToLower(text))
+	if len(q) == 0 {
+		return 0, true
+	}
+
+	score, qi, last := 0, 0, -2
+	for ti := 0; ti < len(t) && qi < len(q); ti++ {
+		if t[ti] != q[qi] {
+			continue
+		}
+		score++
+		if ti == last+1 {
+			score += 2
+		}
+		if ti == 0 || !unicode.IsLetter(t[ti-1]) && !unicode.IsDigit(t[ti-1]) {
+			score += 3
+		}
+		last = ti
+		qi++
+	}
+	return score, qi == len(q)
+}
+
+// matchFavorites ranks favorites by how well they match query
+func matchFavorites(favorites []favoriteSession, query string) []favoriteSession {
+	type scored struct {
+		fav   favoriteSession
+		score int
+	}
+
+	var matches []scored
+	for _, fav := range favorites {
+		if score, ok := fuzzyScore(query, fav.searchText()); ok {
+			matches = append(matches, scored{fav, score})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].score > matches[j].score
+	})
+
+	out := make([]favoriteSession, len(matches))
+	for i, m := range matches {
+		out[i] = m.fav
+	}
+	return out
+}
+
+// handleQuickSwitch opens the quick switcher (/quick or Ctrl+K): it lists the
+// favorites matching query and loads the chosen one in place
+func (cb *ChatBot) handleQuickSwitch(query string) error {
+	favorites, err := cb.loadFavorites()
+	if err != nil {
+		return err
+	}
+	if len(favorites) == 0 {
+		fmt.Println("No favorite sessions yet. Use /favorite to pin the current one.")
+		return nil
+	}
+
+	matches := matchFavorites(favorites, query)
+	if len(matches) == 0 {
+		fmt.Printf("No favorites match %q\n", query)
+		return nil
+	}
+	if len(matches) > maxQuickSwitchMatches {
+		matches = matches[:maxQuickSwitchMatches]
+	}
+
+	cb.mu.Lock()
+	currentID := cb.session.ID
+	cb.mu.Unlock()
+
+	// A query that narrows the list to one session jumps straight to it
+	target := matches[0]
+	if len(matches) > 1 || query == "" {
+		fmt.Println()
+		for i, fav := range matches {
+			current := ""
+			if fav.ID == currentID {
+				current = " (current)"
+			}
+			fmt.Printf("[%d] %s%s\n", i+1, fav.label(), current)
+		}
+		if cb.input == nil {
+			return nil
+		}
+		line, err := cb.readLine(fmt.Sprintf("Switch to [1-%d, Enter to cancel]: ", len(matches)))
+		if err != nil {
+			fmt.Println()
+			return nil
+		}
+		choice := strings.TrimSpace(line)
+		if choice == "" {
+			return nil
+		}
+		n, err := strconv.Atoi(choice)
+		if err != nil || n < 1 || n > len(matches) {
+			return fmt.Errorf("no favorite [%s]", choice)
+		}
+		target = matches[n-1]
+	}
+
+	if target.ID == currentID {
+		fmt.Printf("Already in %s\n", target.ID)
+		return nil
+	}
+
+	if err := cb.saveSession(); err != nil {
+		return fmt.Errorf("failed to save current session: %w", err)
+	}
+	sess, err := cb.loadSession(target.ID)
+	if err != nil {
+		return err
+	}
+
+	cb.mu.Lock()
+	cb.session = sess
+	cb.mu.Unlock()
+
+	cb.logger.Info("quick-switched session", "session_id", sess.ID, "from", currentID)
+	fmt.Printf("Switched to %s (%d messages)\n", target.label(), sess.Older+len(sess.Messages))
+	return nil
+}
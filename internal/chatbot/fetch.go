@@ -0,0 +1,120 @@
+package chatbot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"ExtraChat/internal/web"
+)
+
+// truncatedNote ends a page that was cut to fit the limits
+const truncatedNote = "\n[page truncated]"
+
+// fetchLimits returns the current fetch allowlist, size limit and whether
+// private addresses may be fetched
+func (cb *ChatBot) fetchLimits() web.Limits {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return web.Limits{
+		AllowedDomains: cb.cfg().FetchAllowedDomains,
+		MaxBytes:       int64(cb.cfg().FetchMaxSize) << 10,
+		AllowPrivate:   cb.cfg().FetchAllowPrivate,
+	}
+}
+
+// fetchClient returns the client of web page fetches; web.Fetch bounds
+// their time itself
+func (cb *ChatBot) fetchClient() *http.Client {
+	return cb.httpClient(fetchPool, true)
+}
+
+// fetchPage downloads a page within the fetch limits, through the fetch
+// pool like other requests, so its transport, proxy and recording apply
+func (cb *ChatBot) fetchPage(ctx context.Context, rawURL string) (*web.Page, error) {
+	ctx, span := cb.tracer.Start(ctx, "fetch")
+	defer span.End()
+
+	page, err := web.Fetch(ctx, cb.fetchClient(), rawURL, cb.fetchLimits())
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	span.SetAttributes(
+		attribute.String("url", page.URL),
+		attribute.Int("status", page.Status),
+		attribute.Int("bytes", len(page.Text)),
+		attribute.Bool("truncated", page.Truncated),
+	)
+	return page, nil
+}
+
+// handleFetchCommand handles /fetch <url>: the page's readable text is sent
+// as context with the next message, cut to what is left of the context limit
+func (cb *ChatBot) handleFetchCommand(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: /fetch <url>")
+	}
+
+	ctx, done := cb.interruptible(context.Background())
+	_, waited := cb.progress.start("fetching " + args[0])
+	page, err := cb.fetchPage(ctx, args[0])
+	waited()
+	done()
+	if errors.Is(err, context.Canceled) {
+		fmt.Println("Fetch cancelled.")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if page.Status >= 400 {
+		return fmt.Errorf("%s returned HTTP %d", page.URL, page.Status)
+	}
+	if strings.TrimSpace(page.Text) == "" {
+		return fmt.Errorf("%s has no readable text", page.URL)
+	}
+
+	cb.mu.Lock()
+	budget := cb.contextLimit() * bytesPerToken
+	for _, a := range cb.attachments {
+		budget -= len(a.content)
+	}
+	cb.mu.Unlock()
+
+	text := page.Text
+	truncated := page.Truncated || len(text) > budget
+	if truncated {
+		room := budget - len(truncatedNote)
+		if room <= 0 {
+			return fmt.Errorf("no context space left for %s (see --context-max-tokens)", page.URL)
+		}
+		if len(text) > room {
+			// Cut on a character boundary
+			for room > 0 && !utf8.RuneStart(text[room]) {
+				room--
+			}
+			text = text[:room]
+		}
+		text += truncatedNote
+	}
+	if err := cb.Attach(page.URL, strings.NewReader(text)); err != nil {
+		return err
+	}
+
+	title := page.Title
+	if title == "" {
+		title = page.URL
+	}
+	fmt.Printf("Fetched %s (%s, about %d tokens); it is sent with your next message\n", title, formatBytes(uint64(len(text))), len(text)/bytesPerToken)
+	if truncated {
+		fmt.Println("The page was cut to fit the fetch and context limits.")
+	}
+	cb.logger.Info("page fetched", "url", page.URL, "status", page.Status, "bytes", len(text), "truncated", truncated)
+	return nil
+}
@@ -0,0 +1,265 @@
+package chatbot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+
+	"ExtraChat/internal/config"
+	"ExtraChat/internal/git"
+	"ExtraChat/internal/pipeline"
+)
+
+// What "extrachat git" writes
+const (
+	GitCommitMsg = "commit-msg" // A commit message for the staged changes
+	GitPRDesc    = "pr-desc"    // A pull request description of the branch
+)
+
+// GitModes lists what "extrachat git" writes
+var GitModes = []string{GitCommitMsg, GitPRDesc}
+
+// commitMsgPrompt is the built-in template of commit messages
+const commitMsgPrompt = `Write a commit message for the staged changes below, following Conventional Commits:
+
+- A subject line "<type>(<scope>): <summary>", where type is one of feat, fix, docs, style, refactor, perf, test, build, ci or chore, the scope is optional, and the summary is in the imperative mood, lower case, without a period, in at most 72 characters
+- "!" after the type or scope, and a "BREAKING CHANGE: " footer, only if the change breaks compatibility
+- Unless the subject says it all, a blank line and a body wrapped at 72 columns explaining what changed and why
+{{if .hint}}
+About the change: {{.hint}}
+{{end}}
+Reply with the commit message only, without code fences or commentary.
+{{if .branch}}
+Branch: {{.branch}}
+{{end}}
+Files changed:
+{{.stat}}
+Diff:
+{{.diff}}`
+
+// prDescPrompt is the built-in template of pull request descriptions
+const prDescPrompt = `Write a pull request description for the changes of the branch below.
+
+Start with a title of at most 72 characters in the Conventional Commits form "<type>(<scope>): <summary>" on the first line, without a heading marker. Then a blank line and a Markdown body:
+
+- Open with one or two sentences saying what the change does and why
+- A "## Changes" section with one bullet per notable change
+- A "## Testing" section with how the change can be verified, only if the diff shows tests or the commits mention them
+- Keep it under 250 words, and don't restate the list of files
+{{if .hint}}
+About the change: {{.hint}}
+{{end}}
+Reply with the title and body only, without commentary.
+
+Branch: {{.branch}} into {{.base}}
+
+Commits:
+{{.commits}}
+
+Files changed:
+{{.stat}}
+Diff:
+{{.diff}}`
+
+// gitSystem is the system prompt of the built-in templates
+const gitSystem = "You are a senior software engineer who writes clear, accurate commit messages and pull request descriptions. " +
+	"Describe only what the diff shows; never invent motivation, issue numbers or test results."
+
+// GitOptions controls "extrachat git"
+type GitOptions struct {
+	Mode     string // GitCommitMsg or GitPRDesc
+	Dir      string // Repository; empty for the working directory
+	Base     string // Branch a pull request is compared with; empty for the default branch
+	Hint     string // Told to the model, such as why the change was made
+	Pipeline string // Pipeline file replacing the built-in template; empty uses it
+	Apply    bool   // Commit with the message, or set the pull request's title and body
+}
+
+// RunGit writes a commit message for the staged changes, or a pull request
+// description of the current branch, with the built-in template or a
+// pipeline given the same variables. The message goes to out, or with JSON
+// output the pipeline's record; progress gets each step's backend and
+// timing. With SecretScan, secrets in the diff are replaced with markers
+// before it is sent. With Apply, the staged changes are committed with the
+// message, or the branch's pull request gets the description.
+func (cb *ChatBot) RunGit(ctx context.Context, out, progress io.Writer, opts GitOptions) error {
+	var p *pipeline.Pipeline
+	var err error
+	if opts.Pipeline != "" {
+		p, err = pipeline.Load(opts.Pipeline)
+	} else {
+		p, err = gitPipeline(opts.Mode)
+	}
+	if err != nil {
+		return err
+	}
+
+	ctx, span := cb.tracer.Start(ctx, "git_message")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("mode", opts.Mode),
+		attribute.Bool("apply", opts.Apply),
+	)
+	fail := func(err error) error {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	var changes *git.Changes
+	if opts.Mode == GitPRDesc {
+		changes, err = git.Branch(ctx, opts.Dir, opts.Base)
+	} else {
+		changes, err = git.Staged(ctx, opts.Dir)
+	}
+	if err != nil {
+		return fail(err)
+	}
+	cb.mu.Lock()
+	budget := cb.cfg().ContextMaxTokens * bytesPerToken
+	cb.mu.Unlock()
+	diff, cut := fitDiff(changes.Diff, budget)
+	if cut {
+		fmt.Fprintln(progress, "The diff is longer than --context-max-tokens; the model sees its start and the list of files changed")
+	}
+	if cb.scansPipeline(p) {
+		var found string
+		if diff, found = cb.redactSecrets(diff); found != "" {
+			fmt.Fprintf(progress, "The diff contains %s, replaced with a marker before it is sent\n", found)
+		}
+	}
+	span.SetAttributes(
+		attribute.String("branch", changes.Branch),
+		attribute.String("base", changes.Base),
+		attribute.Int("commits", len(changes.Commits)),
+		attribute.Int("diff_bytes", len(changes.Diff)),
+		attribute.Bool("diff_cut", cut),
+	)
+
+	var commits []string
+	for _, subject := range changes.Commits {
+		commits = append(commits, "- "+subject)
+	}
+	record, err := cb.runPipeline(ctx, progress, p, map[string]string{
+		"diff":    diff,
+		"stat":    changes.Stat,
+		"branch":  changes.Branch,
+		"base":    changes.Base,
+		"commits": strings.Join(commits, "\n"),
+		"hint":    opts.Hint,
+	})
+	if record == nil {
+		return fail(err)
+	}
+	if cb.cfg().Output == config.OutputJSON {
+		enc := json.NewEncoder(out)
+		enc.SetEscapeHTML(false)
+		if encodeErr := enc.Encode(record); encodeErr != nil {
+			return fmt.Errorf("failed to write pipeline record: %w", encodeErr)
+		}
+	} else {
+		fmt.Fprintf(progress, "Trace: %s\n", record.TraceID)
+	}
+	if err != nil {
+		return fail(err)
+	}
+	message := strings.TrimSpace(record.Response)
+	if message == "" {
+		return fail(fmt.Errorf("the model wrote an empty %s", opts.Mode))
+	}
+	if cb.cfg().Output != config.OutputJSON {
+		fmt.Fprintln(out, message)
+	}
+	if !opts.Apply {
+		return nil
+	}
+
+	var applied string
+	if opts.Mode == GitPRDesc {
+		title, body := splitTitle(message)
+		applied, err = git.EditPullRequest(ctx, opts.Dir, title, body)
+	} else {
+		applied, err = git.Commit(ctx, opts.Dir, message+"\n")
+	}
+	if err != nil {
+		return fail(err)
+	}
+	fmt.Fprint(progress, applied)
+	cb.logger.Info("git message applied", "mode", opts.Mode, "branch", changes.Branch)
+	return nil
+}
+
+// gitPipeline returns the built-in template of a mode as a one-step
+// pipeline. The hint and branch are optional.
+func gitPipeline(mode string) (*pipeline.Pipeline, error) {
+	defaults := map[string]string{"hint": "", "branch": ""}
+	switch mode {
+	case GitCommitMsg:
+		// Models like to fence the message; it is never code
+		return pipeline.New(mode, defaults, &pipeline.Step{
+			Name:   "message",
+			System: gitSystem,
+			Prompt: commitMsgPrompt,
+			Post:   []config.PostProcessor{{Kind: config.PostTrimFences}},
+		})
+	case GitPRDesc:
+		return pipeline.New(mode, defaults, &pipeline.Step{Name: "description", System: gitSystem, Prompt: prDescPrompt})
+	}
+	return nil, fmt.Errorf("unknown git mode %q (expected %s)", mode, strings.Join(GitModes, " or "))
+}
+
+// fitDiff cuts a unified diff to about budget bytes, keeping whole files
+// from the start and noting what was left out, and reports whether it was
+// cut. A first file longer than the budget is cut at a line.
+func fitDiff(diff string, budget int) (string, bool) {
+	if len(diff) <= budget {
+		return diff, false
+	}
+	var files []string
+	for _, part := range strings.SplitAfter(diff, "\ndiff --git ") {
+		if len(files) > 0 {
+			part = "diff --git " + part
+		}
+		files = append(files, strings.TrimSuffix(part, "diff --git "))
+	}
+
+	var b strings.Builder
+	kept := 0
+	for _, file := range files {
+		if b.Len()+len(file) > budget {
+			break
+		}
+		b.WriteString(file)
+		kept++
+	}
+	if kept == 0 {
+		cut := files[0][:budget]
+		if i := strings.LastIndexByte(cut, '\n'); i > 0 {
+			cut = cut[:i+1]
+		}
+		b.WriteString(cut)
+		b.WriteString("[rest of the file's diff left out]\n")
+		kept = 1
+	}
+	switch omitted := len(files) - kept; {
+	case omitted == 1:
+		b.WriteString("[diff of 1 more file left out; see the files changed]\n")
+	case omitted > 1:
+		fmt.Fprintf(&b, "[diffs of %d more files left out; see the files changed]\n", omitted)
+	}
+	return b.String(), true
+}
+
+// splitTitle splits a pull request description into its first line, the
+// title, and the rest, the body
+func splitTitle(description string) (string, string) {
+	title, body, _ := strings.Cut(description, "\n")
+	title = strings.TrimSpace(strings.TrimLeft(title, "# "))
+	title = strings.TrimPrefix(title, "Title: ")
+	return title, strings.TrimSpace(body)
+}
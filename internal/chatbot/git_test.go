@@ -0,0 +1,17 @@
+package chatbot
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFitDiffKeepsWholeFiles(t *testing.T) {
+	diff := "diff --git a/a b/a\n+" + strings.Repeat("a", 40) + "\ndiff --git a/b b/b\n+b\n"
+	cut, ok := fitDiff(diff, 60)
+	if !ok || !strings.HasPrefix(cut, "diff --git a/a") || !strings.Contains(cut, "1 more file left out") {
+		t.Errorf("fitDiff = %q, %v", cut, ok)
+	}
+	if whole, ok := fitDiff(diff, len(diff)); ok || whole != diff {
+		t.Errorf("a diff within the budget was cut to %q", whole)
+	}
+}
@@ -0,0 +1,112 @@
+package chatbot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"ExtraChat/internal/backend"
+	"ExtraChat/internal/config"
+	"ExtraChat/internal/guard"
+)
+
+// contentFilters compiles the guardrails on prompts and on replies; callers
+// hold cb.mu
+func (cb *ChatBot) contentFilters() (*guard.Filter, *guard.Filter, error) {
+	input, err := guard.New(guard.Prompt, cb.cfg().InputFilter, cb.moderate)
+	if err != nil {
+		return nil, nil, fmt.Errorf("guardrails: input: %w", err)
+	}
+	output, err := guard.New(guard.Reply, cb.cfg().OutputFilter, cb.moderate)
+	if err != nil {
+		return nil, nil, fmt.Errorf("guardrails: output: %w", err)
+	}
+	return input, output, nil
+}
+
+// guardContent checks text against a filter; a violation is logged and
+// noted on the current span before it is returned
+func (cb *ChatBot) guardContent(ctx context.Context, filter *guard.Filter, target llmTarget, text string) error {
+	err := filter.Check(ctx, text)
+	var violation *guard.Violation
+	if errors.As(err, &violation) {
+		cb.logger.Warn("guardrail violation", "subject", violation.Subject, "check", violation.Check,
+			"detail", violation.Detail, "backend", target.Backend, "model", target.Model)
+		trace.SpanFromContext(ctx).AddEvent("guardrail_violation", trace.WithAttributes(
+			attribute.String("subject", violation.Subject),
+			attribute.String("check", violation.Check),
+			attribute.String("detail", violation.Detail),
+		))
+	}
+	return err
+}
+
+// moderate asks the OpenAI moderation API about text and returns the
+// categories it was flagged for
+func (cb *ChatBot) moderate(ctx context.Context, text string) ([]string, error) {
+	apiKey := cb.cfg().APIKey(config.BackendOpenAI)
+	if apiKey == "" {
+		return nil, fmt.Errorf("%s not set (or store a key with: extrachat auth set openai)", config.APIKeyEnvVars[config.BackendOpenAI])
+	}
+	cb.mu.Lock()
+	model := cb.cfg().ModerationModel
+	url := cb.endpoint(config.BackendOpenAI, "/v1/moderations")
+	cb.mu.Unlock()
+	if model == "" {
+		model = config.DefaultModerationModel
+	}
+
+	var apiResp backend.OpenAIModerationResponse
+	reqBody := backend.OpenAIModerationRequest{Model: model, Input: text}
+	if err := cb.postJSON(ctx, "moderation", url, apiKey, reqBody, &apiResp); err != nil {
+		return nil, err
+	}
+	var categories []string
+	for _, result := range apiResp.Results {
+		if !result.Flagged {
+			continue
+		}
+		for category, flagged := range result.Categories {
+			if flagged {
+				categories = append(categories, category)
+			}
+		}
+		if len(categories) == 0 {
+			categories = append(categories, "unspecified content")
+		}
+	}
+	sort.Strings(categories)
+	return categories, nil
+}
+
+// holdTokens keeps the streamed tokens of the turn ctx belongs to from its
+// event sink until release is called, so a reply the guardrails block is
+// never shown. Tool events still go out as they happen.
+func holdTokens(ctx context.Context) (context.Context, func()) {
+	emit := turnEventsFrom(ctx)
+	if emit == nil {
+		return ctx, func() {}
+	}
+	var mu sync.Mutex
+	var held strings.Builder
+	ctx = withTurnEvents(ctx, func(event turnEvent) {
+		if event.Type != "token" {
+			emit(event)
+			return
+		}
+		mu.Lock()
+		held.WriteString(event.Text)
+		mu.Unlock()
+	})
+	return ctx, func() {
+		mu.Lock()
+		defer mu.Unlock()
+		emitToken(emit, held.String())
+	}
+}
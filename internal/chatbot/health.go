@@ -0,0 +1,262 @@
+package chatbot
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"ExtraChat/internal/mcp"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// MCP health check settings
+const (
+	mcpHealthInterval = 30 * time.Second // Time between background pings
+	mcpHealthTimeout  = 5 * time.Second  // A ping slower than this counts as a failure
+	mcpStatsWindow    = 20               // Recent pings/calls kept per server
+)
+
+// healthSample is the outcome of one ping or tool call
+type healthSample struct {
+	kind    string // "ping" or "call"
+	latency time.Duration
+	failed  bool
+}
+
+// serverHealth is the recent health of one MCP server
+type serverHealth struct {
+	up          bool
+	lastLatency time.Duration
+	lastError   string
+	lastErrorAt time.Time
+	samples     []healthSample // Most recent last, at most mcpStatsWindow
+}
+
+// mcpHealth tracks MCP server health and exports it as OTel metrics
+type mcpHealth struct {
+	mu      sync.Mutex
+	servers map[string]*serverHealth
+
+	pingDuration metric.Float64Histogram
+	callDuration metric.Float64Histogram
+	errors       metric.Int64Counter
+}
+
+// newMCPHealth creates the health tracker and registers its instruments
+func newMCPHealth(meter metric.Meter) (*mcpHealth, error) {
+	h := &mcpHealth{servers: make(map[string]*serverHealth)}
+
+	var err error
+	h.pingDuration, err = meter.Float64Histogram(
+		"mcp.ping.duration",
+		metric.WithDescription("MCP server ping round-trip time in milliseconds"),
+		metric.WithUnit("ms"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ping histogram: %w", err)
+	}
+	h.callDuration, err = meter.Float64Histogram(
+		"mcp.tool_call.duration",
+		metric.WithDescription("MCP tool call duration in milliseconds"),
+		metric.WithUnit("ms"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create tool call histogram: %w", err)
+	}
+	h.errors, err = meter.Int64Counter(
+		"mcp.errors",
+		metric.WithDescription("Failed MCP pings and tool calls"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create error counter: %w", err)
+	}
+
+	_, err = meter.Int64ObservableGauge(
+		"mcp.server.up",
+		metric.WithDescription("1 if the MCP server answered its last health check, 0 otherwise"),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+			for name, server := range h.servers {
+				up := int64(0)
+				if server.up {
+					up = 1
+				}
+				o.Observe(up, metric.WithAttributes(attribute.String("server", name)))
+			}
+			return nil
+		}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create server up gauge: %w", err)
+	}
+
+	return h, nil
+}
+
+// server returns the entry for a server, creating it; callers hold h.mu
+func (h *mcpHealth) server(name string) *serverHealth {
+	server, ok := h.servers[name]
+	if !ok {
+		server = &serverHealth{up: true}
+		h.servers[name] = server
+	}
+	return server
+}
+
+// record stores the outcome of a ping or tool call and updates the metrics
+func (h *mcpHealth) record(ctx context.Context, serverName, kind string, latency time.Duration, err error) {
+	if h == nil {
+		return
+	}
+
+	attrs := metric.WithAttributes(attribute.String("server", serverName))
+	ms := float64(latency.Microseconds()) / 1000
+	if kind == "ping" {
+		h.pingDuration.Record(ctx, ms, attrs)
+	} else {
+		h.callDuration.Record(ctx, ms, attrs)
+	}
+	if err != nil {
+		h.errors.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("server", serverName),
+			attribute.String("kind", kind),
+		))
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	server := h.server(serverName)
+	server.samples = append(server.samples, healthSample{kind: kind, latency: latency, failed: err != nil})
+	if len(server.samples) > mcpStatsWindow {
+		server.samples = server.samples[len(server.samples)-mcpStatsWindow:]
+	}
+	if err != nil {
+		server.lastError = err.Error()
+		server.lastErrorAt = time.Now()
+	}
+	if kind == "ping" {
+		server.up = err == nil
+		server.lastLatency = latency
+	}
+}
+
+// snapshot returns a copy of a server's health
+func (h *mcpHealth) snapshot(serverName string) serverHealth {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	server := *h.server(serverName)
+	server.samples = append([]healthSample(nil), server.samples...)
+	return server
+}
+
+// checkMCPHealth pings every MCP server once
+func (cb *ChatBot) checkMCPHealth(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, client := range cb.mcpRegistry.All() {
+		wg.Add(1)
+		go func(client mcp.MCPClient) {
+			defer wg.Done()
+
+			pingCtx, cancel := context.WithTimeout(ctx, mcpHealthTimeout)
+			defer cancel()
+
+			start := time.Now()
+			err := client.Ping(pingCtx)
+			cb.mcpHealth.record(ctx, client.Name(), "ping", time.Since(start), err)
+			if err != nil {
+				cb.logger.Warn("MCP health check failed", "server", client.Name(), "error", err)
+			}
+		}(client)
+	}
+	wg.Wait()
+}
+
+// runMCPHealthChecks pings MCP servers periodically until ctx is done
+func (cb *ChatBot) runMCPHealthChecks(ctx context.Context) {
+	ticker := time.NewTicker(mcpHealthInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			cb.checkMCPHealth(ctx)
+		}
+	}
+}
+
+// handleMCPStatusCommand handles /mcp-status: it checks every server now and
+// shows its connection state, protocol, tool count and recent stats
+func (cb *ChatBot) handleMCPStatusCommand() error {
+	if !cb.cfg().MCPEnabled || cb.mcpRegistry == nil || cb.mcpHealth == nil {
+		fmt.Println("MCP is not enabled. Use --mcp-enabled flag to enable.")
+		return nil
+	}
+
+	clients := cb.mcpRegistry.All()
+	if len(clients) == 0 {
+		fmt.Println("No MCP servers connected.")
+		return nil
+	}
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i].Name() < clients[j].Name()
+	})
+
+	cb.checkMCPHealth(context.Background())
+
+	toolCounts := make(map[string]int)
+	for _, tool := range cb.getMCPTools() {
+		toolCounts[tool.ServerName]++
+	}
+
+	fmt.Println("\nMCP Server Status:")
+	for i, client := range clients {
+		health := cb.mcpHealth.snapshot(client.Name())
+		info := client.ServerInfo()
+
+		state := "up"
+		if !health.up {
+			state = "DOWN"
+		}
+		fmt.Printf("%d. %s [%s]\n", i+1, client.Name(), state)
+		if info.ServerInfo.Name != "" {
+			fmt.Printf("   Server:   %s %s (protocol %s)\n", info.ServerInfo.Name, info.ServerInfo.Version, info.ProtocolVersion)
+		}
+		fmt.Printf("   Tools:    %d\n", toolCounts[client.Name()])
+		fmt.Printf("   Ping:     %s\n", formatSpanDuration(health.lastLatency))
+
+		var pings, calls, failures int
+		var total, max time.Duration
+		for _, sample := range health.samples {
+			if sample.kind == "ping" {
+				pings++
+			} else {
+				calls++
+			}
+			if sample.failed {
+				failures++
+			}
+			total += sample.latency
+			if sample.latency > max {
+				max = sample.latency
+			}
+		}
+		if n := len(health.samples); n > 0 {
+			fmt.Printf("   Recent:   %d pings, %d tool calls, %d errors; avg %s, max %s\n",
+				pings, calls, failures, formatSpanDuration(total/time.Duration(n)), formatSpanDuration(max))
+		}
+		if health.lastError != "" {
+			fmt.Printf("   Last err: %s (%s ago)\n", previewText(health.lastError, 100), time.Since(health.lastErrorAt).Round(time.Second))
+		}
+	}
+	fmt.Println()
+	return nil
+}
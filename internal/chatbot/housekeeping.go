@@ -0,0 +1,141 @@
+package chatbot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"ExtraChat/internal/session"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// titlePrompt asks for a short session title
+const titlePrompt = "Write a short title (at most 6 words) for the following conversation. Reply with the title only, without quotes or punctuation at the end.\n\n%s"
+
+// maxTitleLength caps stored session titles, in runes
+const maxTitleLength = 80
+
+// housekeepingTarget returns where background jobs are sent: the dedicated
+// summarizer backend and model when configured, otherwise the interactive
+// ones. Background jobs are never offered MCP tools. The model router isn't
+// one of them: it classifies prompts locally without asking a model.
+func (cb *ChatBot) housekeepingTarget() llmTarget {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	backendName := cb.cfg().SummarizerBackend
+	if backendName == "" {
+		backendName = cb.session.Backend
+	}
+
+	model := cb.cfg().SummarizerModel
+	switch {
+	case model != "":
+	case backendName == cb.session.Backend:
+		model = cb.sessionModel(cb.session)
+	default:
+		model = cb.modelFor(backendName)
+	}
+
+	return llmTarget{Backend: backendName, Model: model}
+}
+
+// runHousekeeping sends a background job prompt (titling, summarization, ...)
+// to the housekeeping target and returns the reply
+func (cb *ChatBot) runHousekeeping(ctx context.Context, job string, prompt string) (string, error) {
+	target := cb.housekeepingTarget()
+
+	ctx, span := cb.tracer.Start(ctx, "housekeeping_job")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("job", job),
+		attribute.String("backend", target.Backend),
+		attribute.String("model", target.Model),
+	)
+
+	cb.logger.Info("running background job", "job", job, "backend", target.Backend, "model", target.Model)
+
+	cb.mu.Lock()
+	sessionID := cb.session.ID
+	cb.mu.Unlock()
+	cb.auditPrompt(sessionID, target, job, prompt)
+
+	// The prompt is built from the conversation, so it may quote secrets;
+	// sendToBackend redacts them for the housekeeping backend
+	messages := []session.Message{{Role: "user", Content: prompt}}
+	response, err := cb.sendToBackend(ctx, target, messages)
+	cb.auditResponse(sessionID, target, job, response, false, err)
+	if err != nil {
+		return "", fmt.Errorf("%s job failed: %w", job, err)
+	}
+	return response, nil
+}
+
+// maybeGenerateTitle titles the current session from its first exchange
+func (cb *ChatBot) maybeGenerateTitle(ctx context.Context) {
+	cb.mu.Lock()
+	// A session loaded without its first exchange is past titling
+	if cb.session.Title != "" || cb.titlePending || cb.session.Older > 0 || len(cb.session.Messages) < 2 {
+		cb.mu.Unlock()
+		return
+	}
+	cb.titlePending = true
+	sessionID := cb.session.ID
+	transcript := formatTranscript(cb.session.Messages[:2])
+	cb.mu.Unlock()
+
+	defer func() {
+		cb.mu.Lock()
+		cb.titlePending = false
+		cb.mu.Unlock()
+	}()
+
+	reply, err := cb.runHousekeeping(ctx, "title", fmt.Sprintf(titlePrompt, transcript))
+	if err != nil {
+		cb.logger.Warn("failed to generate session title", "session_id", sessionID, "error", err)
+		return
+	}
+
+	title := cleanTitle(reply)
+	if title == "" {
+		return
+	}
+
+	if _, err := cb.db.Exec("UPDATE sessions SET title = ? WHERE id = ?", title, sessionID); err != nil {
+		cb.logger.Warn("failed to save session title", "session_id", sessionID, "error", err)
+		return
+	}
+
+	cb.mu.Lock()
+	if cb.session.ID == sessionID {
+		cb.session.Title = title
+	}
+	cb.mu.Unlock()
+
+	cb.logger.Info("generated session title", "session_id", sessionID, "title", title)
+}
+
+// formatTranscript renders messages as "role: content" lines for prompts,
+// naming the speaker instead of the role where there is one
+func formatTranscript(messages []session.Message) string {
+	var sb strings.Builder
+	for _, msg := range messages {
+		fmt.Fprintf(&sb, "%s: %s\n", msg.Author(), msg.Content)
+	}
+	return sb.String()
+}
+
+// cleanTitle reduces a model reply to a single-line title
+func cleanTitle(reply string) string {
+	title := strings.TrimSpace(reply)
+	if i := strings.IndexByte(title, '\n'); i >= 0 {
+		title = title[:i]
+	}
+	title = strings.Trim(title, "\"'`* ")
+	title = strings.TrimRight(title, ".")
+	if runes := []rune(title); len(runes) > maxTitleLength {
+		title = strings.TrimSpace(string(runes[:maxTitleLength]))
+	}
+	return title
+}
@@ -0,0 +1,34 @@
+package chatbot
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestCleanTitle(t *testing.T) {
+	tests := []struct {
+		reply string
+		want  string
+	}{
+		{"  \"Go Channels Explained.\"  ", "Go Channels Explained"},
+		{"**Title**\nSome explanation", "Title"},
+		{"`Debugging...`", "Debugging"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := cleanTitle(tt.reply); got != tt.want {
+			t.Errorf("cleanTitle(%q) = %q, want %q", tt.reply, got, tt.want)
+		}
+	}
+}
+
+func TestCleanTitleCutsOnRunes(t *testing.T) {
+	title := cleanTitle(strings.Repeat("é", maxTitleLength+10))
+	if !utf8.ValidString(title) {
+		t.Fatalf("cleanTitle split a rune: %q", title)
+	}
+	if n := utf8.RuneCountInString(title); n != maxTitleLength {
+		t.Errorf("cleanTitle kept %d runes, want %d", n, maxTitleLength)
+	}
+}
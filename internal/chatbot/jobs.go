@@ -0,0 +1,335 @@
+package chatbot
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+
+	"ExtraChat/internal/cache"
+	"ExtraChat/internal/session"
+)
+
+// Statuses of a job in the jobs table
+const (
+	jobQueued    = "queued"
+	jobRunning   = "running"
+	jobDone      = "done"
+	jobFailed    = "failed"
+	jobCancelled = "cancelled"
+)
+
+// maxRunningJobs bounds how many /async prompts run at once; the others
+// wait queued
+const maxRunningJobs = 2
+
+// jobListLimit caps the jobs /jobs lists
+const jobListLimit = 20
+
+// jobRunner runs the prompts queued with /async in the background
+type jobRunner struct {
+	ctx    context.Context // Cancelled by Close, which interrupts the jobs
+	cancel context.CancelFunc
+	slots  chan struct{} // Held by each running job
+	wg     sync.WaitGroup
+}
+
+func newJobRunner() *jobRunner {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &jobRunner{ctx: ctx, cancel: cancel, slots: make(chan struct{}, maxRunningJobs)}
+}
+
+// stop cancels the jobs not yet finished and waits until they have recorded
+// that they were cancelled
+func (r *jobRunner) stop() {
+	r.cancel()
+	r.wg.Wait()
+}
+
+// notify tells the user about a finished job, unless the chatbot is
+// shutting down
+func (r *jobRunner) notify(format string, args ...interface{}) {
+	if r.ctx.Err() == nil {
+		fmt.Printf(format, args...)
+	}
+}
+
+// asyncJob is a row of the jobs table
+type asyncJob struct {
+	ID         int64
+	SessionID  string
+	Prompt     string
+	Backend    string
+	Model      string
+	Status     string
+	Response   string
+	Error      string
+	CreatedAt  time.Time
+	StartedAt  time.Time // Zero while queued
+	FinishedAt time.Time // Zero until done, failed or cancelled
+}
+
+// handleAsyncCommand handles /async <prompt>: the prompt is sent with the
+// conversation so far in the background, and /job shows the reply
+func (cb *ChatBot) handleAsyncCommand(args []string) error {
+	prompt := strings.Join(args, " ")
+	if prompt == "" {
+		return fmt.Errorf("usage: /async <prompt>")
+	}
+	// Screened now: nobody is there to answer once the job runs
+	prompt, err := cb.screenSecrets(prompt)
+	if err != nil {
+		return err
+	}
+
+	cb.mu.Lock()
+	sessionID := cb.session.ID
+	messages := make([]session.Message, len(cb.session.Messages), len(cb.session.Messages)+1)
+	copy(messages, cb.session.Messages)
+	target := llmTarget{
+		Backend: cb.session.Backend,
+		Model:   cb.sessionModel(cb.session),
+		System:  cb.systemPrompt(),
+	}
+	cb.mu.Unlock()
+	messages = append(messages, session.Message{Role: "user", Content: prompt})
+
+	res, err := cb.db.Exec(
+		"INSERT INTO jobs (session_id, prompt, backend, model, status, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+		sessionID, prompt, target.Backend, target.Model, jobQueued, time.Now(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to queue job: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to queue job: %w", err)
+	}
+
+	cb.jobs.wg.Add(1)
+	go cb.runAsyncJob(id, sessionID, target, messages)
+
+	cb.logger.Info("job queued", "job_id", id, "session_id", sessionID, "backend", target.Backend, "model", target.Model)
+	fmt.Printf("Queued job %d on %s; /job %d shows the result\n", id, target.Backend, id)
+	return nil
+}
+
+// runAsyncJob waits for a free slot, sends the job's prompt and stores the
+// reply or error. A notice is printed when it finishes.
+func (cb *ChatBot) runAsyncJob(id int64, sessionID string, target llmTarget, messages []session.Message) {
+	defer cb.jobs.wg.Done()
+	ctx := cb.jobs.ctx
+
+	select {
+	case cb.jobs.slots <- struct{}{}:
+		defer func() { <-cb.jobs.slots }()
+	case <-ctx.Done():
+		cb.finishJob(id, jobCancelled, "", ctx.Err())
+		return
+	}
+	started := time.Now()
+	if _, err := cb.db.Exec("UPDATE jobs SET status = ?, started_at = ? WHERE id = ?", jobRunning, started, id); err != nil {
+		cb.logger.Warn("failed to update job", "job_id", id, "error", err)
+	}
+
+	ctx, span := cb.tracer.Start(ctx, "async_job")
+	defer span.End()
+	span.SetAttributes(
+		attribute.Int64("job_id", id),
+		attribute.String("session_id", sessionID),
+		attribute.String("backend", target.Backend),
+		attribute.String("model", target.Model),
+	)
+
+	keyMessages := messages
+	if target.System != "" {
+		keyMessages = append([]session.Message{{Role: "system", Content: target.System}}, messages...)
+	}
+	cacheKey := cache.GenerateCacheKey(keyMessages)
+	response, cached := cb.checkCache(cacheKey)
+	var err error
+	if cached {
+		span.SetAttributes(attribute.Bool("cache_hit", true))
+	} else {
+		prompt := messages[len(messages)-1].Content
+		cb.auditPrompt(sessionID, target, "async", prompt)
+		start := time.Now()
+		response, err = cb.callBackend(ctx, target, messages)
+		cb.turnStats.record(ctx, target, time.Since(start), err)
+		cb.auditResponse(sessionID, target, "async", response, false, err)
+	}
+
+	switch {
+	case err != nil && ctx.Err() != nil:
+		cb.finishJob(id, jobCancelled, "", err)
+		return
+	case err != nil:
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		cb.logger.Error("job failed", "job_id", id, "error", err)
+		cb.finishJob(id, jobFailed, "", err)
+		cb.jobs.notify("\nJob %d failed: %v\n", id, err)
+		cb.notifySlow(time.Since(started), fmt.Sprintf("Job %d failed", id), err.Error())
+		return
+	}
+	if !cached {
+		cb.storeCache(cacheKey, response)
+	}
+	cb.finishJob(id, jobDone, response, nil)
+	cb.logger.Info("job finished", "job_id", id, "cached", cached)
+	cb.jobs.notify("\nJob %d finished; /job %d shows the result\n", id, id)
+	cb.notifySlow(time.Since(started), fmt.Sprintf("Job %d finished", id), response)
+}
+
+// finishJob stores the outcome of a job
+func (cb *ChatBot) finishJob(id int64, status, response string, jobErr error) {
+	var errText sql.NullString
+	if jobErr != nil {
+		errText = sql.NullString{String: jobErr.Error(), Valid: true}
+	}
+	if _, err := cb.db.Exec(
+		"UPDATE jobs SET status = ?, response = ?, error = ?, finished_at = ? WHERE id = ?",
+		status, response, errText, time.Now(), id,
+	); err != nil {
+		cb.logger.Warn("failed to update job", "job_id", id, "error", err)
+	}
+}
+
+// jobColumns are the columns scanJob reads, in order
+const jobColumns = `id, session_id, prompt, backend, model, status, COALESCE(response, ''), COALESCE(error, ''),
+	created_at, started_at, finished_at`
+
+// scanJob reads a row selected with jobColumns
+func scanJob(row interface{ Scan(...interface{}) error }) (asyncJob, error) {
+	var job asyncJob
+	var started, finished sql.NullTime
+	err := row.Scan(&job.ID, &job.SessionID, &job.Prompt, &job.Backend, &job.Model, &job.Status,
+		&job.Response, &job.Error, &job.CreatedAt, &started, &finished)
+	job.StartedAt, job.FinishedAt = started.Time, finished.Time
+	return job, err
+}
+
+// loadJobs returns the latest jobs of a session, newest first
+func (cb *ChatBot) loadJobs(sessionID string, limit int) ([]asyncJob, error) {
+	rows, err := cb.db.Query("SELECT "+jobColumns+" FROM jobs WHERE session_id = ? ORDER BY id DESC LIMIT ?", sessionID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []asyncJob
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan job: %w", err)
+		}
+		jobs = append(jobs, job)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query jobs: %w", err)
+	}
+	return jobs, nil
+}
+
+// duration is how long the job has run, or ran
+func (job asyncJob) duration() time.Duration {
+	switch {
+	case job.StartedAt.IsZero():
+		return 0
+	case job.FinishedAt.IsZero():
+		return time.Since(job.StartedAt)
+	}
+	return job.FinishedAt.Sub(job.StartedAt)
+}
+
+// handleJobsCommand handles /jobs, which lists this session's jobs
+func (cb *ChatBot) handleJobsCommand() error {
+	cb.mu.Lock()
+	sessionID := cb.session.ID
+	cb.mu.Unlock()
+
+	jobs, err := cb.loadJobs(sessionID, jobListLimit)
+	if err != nil {
+		return err
+	}
+	if len(jobs) == 0 {
+		fmt.Println("No jobs in this session yet. Queue one with: /async <prompt>")
+		return nil
+	}
+
+	fmt.Println()
+	for _, job := range jobs {
+		status := job.Status
+		if d := job.duration(); d > 0 {
+			status += ", " + formatSpanDuration(d)
+		}
+		fmt.Printf("%d. %s on %s [%s]\n", job.ID, job.CreatedAt.Format("2006-01-02 15:04:05"), job.Backend, status)
+		fmt.Printf("   Prompt: %s\n", previewText(job.Prompt, 100))
+		if job.Error != "" {
+			fmt.Printf("   Error:  %s\n", previewText(job.Error, 100))
+		}
+	}
+	fmt.Println()
+	return nil
+}
+
+// handleJobCommand handles /job <id>, which shows a job and its result
+func (cb *ChatBot) handleJobCommand(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: /job <id>")
+	}
+	id, err := strconv.ParseInt(strings.TrimPrefix(args[0], "#"), 10, 64)
+	if err != nil {
+		return fmt.Errorf("usage: /job <id>")
+	}
+
+	job, err := scanJob(cb.db.QueryRow("SELECT "+jobColumns+" FROM jobs WHERE id = ?", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("no job %d (see /jobs)", id)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to look up job: %w", err)
+	}
+
+	fmt.Printf("\nJob %d [%s]\n", job.ID, job.Status)
+	fmt.Printf("Backend: %s (%s)\n", job.Backend, job.Model)
+	fmt.Printf("Queued:  %s\n", job.CreatedAt.Format("2006-01-02 15:04:05"))
+	if d := job.duration(); d > 0 {
+		fmt.Printf("Ran:     %s\n", formatSpanDuration(d))
+	}
+	fmt.Printf("Prompt:  %s\n", job.Prompt)
+	switch job.Status {
+	case jobDone:
+		fmt.Printf("\nBot: %s\n\n", job.Response)
+	case jobQueued, jobRunning:
+		fmt.Println("\nNot finished yet.")
+		fmt.Println()
+	default:
+		fmt.Printf("Error:   %s\n\n", job.Error)
+	}
+	return nil
+}
+
+// jobIDs lists this session's latest job IDs for /job completion
+func (cb *ChatBot) jobIDs() []string {
+	cb.mu.Lock()
+	sessionID := cb.session.ID
+	cb.mu.Unlock()
+
+	jobs, err := cb.loadJobs(sessionID, jobListLimit)
+	if err != nil {
+		return nil
+	}
+	ids := make([]string, len(jobs))
+	for i, job := range jobs {
+		ids[i] = strconv.FormatInt(job.ID, 10)
+	}
+	return ids
+}
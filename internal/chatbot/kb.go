@@ -0,0 +1,210 @@
+package chatbot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"ExtraChat/internal/config"
+	"ExtraChat/internal/rag"
+	"ExtraChat/internal/telemetry"
+)
+
+// rerankDefault clears a collection's reranker, so the configured one applies
+const rerankDefault = "default"
+
+// RunKnowledgeBase runs an "extrachat kb" action on the collections in the
+// database at dbPath: create, list, stats, rerank or delete, with the
+// action's arguments. Documents are added with ChatBot.Ingest, which needs
+// the embeddings backend.
+func RunKnowledgeBase(w io.Writer, dbPath, action string, args []string) error {
+	db, err := telemetry.InitDB(dbPath)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	store := rag.NewStore(db)
+	name := ""
+	if len(args) > 0 {
+		name = args[0]
+	}
+	switch action {
+	case "create":
+		if err := store.CreateCollection(ctx, name); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "Created collection %s. Add documents with: extrachat kb add %s <path|dir|glob>\n", name, name)
+	case "list":
+		collections, err := store.Collections(ctx)
+		if err != nil {
+			return err
+		}
+		printCollections(w, collections, "")
+	case "stats":
+		documents, err := store.CollectionDocuments(ctx, name)
+		if err != nil {
+			return err
+		}
+		printCollectionDocuments(w, name, documents)
+	case "rerank":
+		reranker := args[1]
+		if reranker != rerankDefault && !config.ValidReranker(reranker) {
+			return fmt.Errorf("unknown reranker %q (expected %s or %s)", reranker, strings.Join(config.Rerankers, ", "), rerankDefault)
+		}
+		if reranker == rerankDefault {
+			reranker = ""
+		}
+		if err := store.SetCollectionRerank(ctx, name, reranker); err != nil {
+			return err
+		}
+		if reranker == "" {
+			fmt.Fprintf(w, "Searches of collection %s are re-ranked as configured (rag.rerank)\n", name)
+		} else {
+			fmt.Fprintf(w, "Searches of collection %s are re-ranked with %s\n", name, reranker)
+		}
+	case "delete":
+		deleted, err := store.DeleteCollection(ctx, name)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "Deleted collection %s and %d documents no other collection holds\n", name, deleted)
+	default:
+		return fmt.Errorf("unknown kb action %q", action)
+	}
+	return nil
+}
+
+// printCollections lists collections, marking the one bound to the session
+func printCollections(w io.Writer, collections []rag.Collection, bound string) {
+	if len(collections) == 0 {
+		fmt.Fprintln(w, "No collections. Create one with: extrachat kb create <name>")
+		return
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "  COLLECTION\tDOCUMENTS\tCHUNKS\tRERANK\tCREATED")
+	for _, c := range collections {
+		marker := " "
+		if c.Name == bound {
+			marker = "*"
+		}
+		reranker := c.Rerank
+		if reranker == "" {
+			reranker = rerankDefault
+		}
+		fmt.Fprintf(tw, "%s %s\t%d\t%d\t%s\t%s\n", marker, c.Name, c.Documents, c.Chunks, reranker, c.CreatedAt.Local().Format("2006-01-02 15:04"))
+	}
+	tw.Flush()
+}
+
+// printCollectionDocuments lists the documents of a collection with totals
+// per embedding model
+func printCollectionDocuments(w io.Writer, name string, documents []rag.DocumentInfo) {
+	if len(documents) == 0 {
+		fmt.Fprintf(w, "Collection %s is empty. Add documents with: extrachat kb add %s <path|dir|glob>\n", name, name)
+		return
+	}
+
+	chunks := make(map[string]int)
+	var models []string
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "DOCUMENT\tCHUNKS\tMODEL\tINGESTED")
+	for _, d := range documents {
+		if _, ok := chunks[d.Model]; !ok {
+			models = append(models, d.Model)
+		}
+		chunks[d.Model] += d.Chunks
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\n", d.Path, d.Chunks, d.Model, d.IngestedAt.Local().Format("2006-01-02 15:04"))
+	}
+	tw.Flush()
+
+	fmt.Fprintf(w, "\nCollection %s: %d documents\n", name, len(documents))
+	for _, model := range models {
+		fmt.Fprintf(w, "  %d chunks embedded with %s\n", chunks[model], model)
+	}
+}
+
+// handleKBCommand handles /kb [use <collection>|off]: without arguments it
+// lists the collections, otherwise it binds a collection to the session or
+// unbinds it. The bound collection is searched on every message.
+func (cb *ChatBot) handleKBCommand(args []string) error {
+	store := rag.NewStore(cb.db)
+	ctx := context.Background()
+
+	cb.mu.Lock()
+	bound := cb.session.Collection
+	cb.mu.Unlock()
+
+	switch {
+	case len(args) == 0:
+		collections, err := store.Collections(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Println()
+		printCollections(os.Stdout, collections, bound)
+		if bound == "" {
+			fmt.Println("\nNo collection is bound to this session. Bind one with: /kb use <collection>")
+		} else {
+			fmt.Printf("\nCollection %s is searched on every message of this session\n", bound)
+		}
+		return nil
+	case len(args) == 1 && args[0] == "off":
+		if bound == "" {
+			fmt.Println("No collection is bound to this session")
+			return nil
+		}
+		cb.mu.Lock()
+		cb.session.Collection = ""
+		cb.mu.Unlock()
+		cb.logger.Info("collection unbound", "collection", bound)
+		fmt.Printf("Collection %s is no longer searched\n", bound)
+		return nil
+	case len(args) == 2 && args[0] == "use":
+		name := args[1]
+		documents, err := store.CollectionDocuments(ctx, name)
+		if errors.Is(err, rag.ErrNoCollection) {
+			return fmt.Errorf("no collection %s (see /kb for the list)", name)
+		}
+		if err != nil {
+			return err
+		}
+		cb.mu.Lock()
+		cb.session.Collection = name
+		cb.mu.Unlock()
+		cb.logger.Info("collection bound", "collection", name, "documents", len(documents))
+		fmt.Printf("Collection %s (%d documents) is searched on every message of this session\n", name, len(documents))
+		return nil
+	}
+	return fmt.Errorf("usage: /kb [use <collection>|off]")
+}
+
+// collectionNames lists the collections for completion
+func (cb *ChatBot) collectionNames() []string {
+	collections, err := rag.NewStore(cb.db).Collections(context.Background())
+	if err != nil {
+		cb.logger.Warn("failed to list collections for completion", "error", err)
+		return nil
+	}
+	names := make([]string, len(collections))
+	for i, c := range collections {
+		names[i] = c.Name
+	}
+	return names
+}
+
+// completeKBArgs completes /kb use with collection names
+func completeKBArgs(cb *ChatBot, args []string) []string {
+	switch {
+	case len(args) == 0:
+		return []string{"use", "off"}
+	case len(args) == 1 && args[0] == "use":
+		return cb.collectionNames()
+	}
+	return nil
+}
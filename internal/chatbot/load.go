@@ -0,0 +1,107 @@
+package chatbot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"ExtraChat/internal/extract"
+	"ExtraChat/internal/rag"
+)
+
+// handleLoadCommand handles /load <file>: a document that fits the context
+// limit is sent in full with the next message, a larger one is embedded and
+// its relevant chunks are sent with every message of the session. Without
+// an argument it lists the documents loaded into the session.
+func (cb *ChatBot) handleLoadCommand(args []string) error {
+	if len(args) == 0 {
+		cb.mu.Lock()
+		documents := cb.session.Documents
+		cb.mu.Unlock()
+		if len(documents) == 0 {
+			fmt.Println("No documents loaded into this session. Usage: /load <file.pdf|docx|md|txt>")
+			return nil
+		}
+		fmt.Println("\nDocuments searched on every message of this session:")
+		for _, path := range documents {
+			fmt.Printf("  %s\n", path)
+		}
+		return nil
+	}
+
+	// Paths may contain spaces
+	path := strings.Join(args, " ")
+	_, text, err := readDocument(path)
+	if errors.Is(err, extract.ErrNotText) {
+		return fmt.Errorf("%s is not a text, PDF or DOCX file", path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load %s: %w", path, err)
+	}
+
+	cb.mu.Lock()
+	budget := cb.contextLimit() * bytesPerToken
+	for _, a := range cb.attachments {
+		budget -= len(a.content)
+	}
+	model, size, overlap := cb.cfg().EmbeddingModel(), cb.cfg().ChunkSize, cb.cfg().ChunkOverlap
+	cb.mu.Unlock()
+
+	tokens := len(text) / bytesPerToken
+	if len(text) <= budget {
+		if err := cb.Attach(path, strings.NewReader(text)); err != nil {
+			return err
+		}
+		fmt.Printf("Loaded %s (about %d tokens); it is sent in full with your next message\n", path, tokens)
+		return nil
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("failed to resolve path: %w", err)
+	}
+	ctx, done := cb.interruptible(context.Background())
+	_, waited := cb.progress.start("embedding " + filepath.Base(path))
+	chunks, _, err := cb.ingestFile(ctx, rag.NewStore(cb.db), path, model, size, overlap)
+	waited()
+	done()
+	if errors.Is(err, context.Canceled) {
+		fmt.Println("Load cancelled.")
+		return nil
+	}
+	if err != nil && !errors.Is(err, errUnchanged) {
+		return fmt.Errorf("failed to embed %s: %w", path, err)
+	}
+
+	cb.mu.Lock()
+	if !slices.Contains(cb.session.Documents, abs) {
+		cb.session.Documents = append(slices.Clip(cb.session.Documents), abs)
+	}
+	cb.mu.Unlock()
+	cb.logger.Info("document loaded for retrieval", "path", abs, "chunks", chunks, "tokens", tokens)
+
+	if chunks > 0 {
+		fmt.Printf("Loaded %s (about %d tokens, %d chunks)\n", path, tokens, chunks)
+	} else {
+		fmt.Printf("Loaded %s (about %d tokens, already embedded)\n", path, tokens)
+	}
+	fmt.Println("It is too large to send whole, so the parts relevant to each message are sent with it in this session.")
+	return nil
+}
+
+// splitDocuments parses the documents column of a session
+func splitDocuments(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+// joinDocuments formats a session's documents for the database, one path
+// per line
+func joinDocuments(paths []string) string {
+	return strings.Join(paths, "\n")
+}
@@ -0,0 +1,74 @@
+package chatbot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"ExtraChat/internal/mcp"
+)
+
+// logMCPMessage routes a notifications/message from a server into our
+// structured log, keeping the server's level and logger name
+func (cb *ChatBot) logMCPMessage(serverName string, params mcp.LoggingMessageParams) {
+	// Data is any JSON value; log strings as text and everything else as JSON
+	var message string
+	if err := json.Unmarshal(params.Data, &message); err != nil {
+		message = string(params.Data)
+	}
+
+	attrs := []interface{}{"server", serverName, "mcp_level", params.Level}
+	if params.Logger != "" {
+		attrs = append(attrs, "logger", params.Logger)
+	}
+	cb.logger.Log(context.Background(), mcp.SlogLevel(params.Level), "MCP server log: "+message, attrs...)
+}
+
+// setMCPLogLevel asks a server to send log notifications at level and above.
+// Servers that don't advertise the logging capability are skipped.
+func (cb *ChatBot) setMCPLogLevel(ctx context.Context, client mcp.MCPClient, level string) (bool, error) {
+	if client.ServerInfo().Capabilities.Logging == nil {
+		return false, nil
+	}
+	if err := client.SetLogLevel(ctx, level); err != nil {
+		return false, err
+	}
+	cb.logger.Info("set MCP server log level", "server", client.Name(), "level", level)
+	return true, nil
+}
+
+// handleMCPLogLevelCommand handles /mcp-log-level <level>, changing the log
+// level of every connected server that supports logging
+func (cb *ChatBot) handleMCPLogLevelCommand(args []string) error {
+	if !cb.cfg().MCPEnabled || cb.mcpRegistry == nil {
+		fmt.Println("MCP is not enabled. Use --mcp-enabled flag to enable.")
+		return nil
+	}
+	if len(args) != 1 || !mcp.ValidLogLevel(args[0]) {
+		return fmt.Errorf("usage: /mcp-log-level <%s>", strings.Join(mcp.LogLevels, "|"))
+	}
+	level := args[0]
+
+	clients := cb.mcpRegistry.All()
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i].Name() < clients[j].Name()
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), mcpHealthTimeout)
+	defer cancel()
+
+	for _, client := range clients {
+		ok, err := cb.setMCPLogLevel(ctx, client, level)
+		switch {
+		case err != nil:
+			fmt.Printf("%s: failed: %v\n", client.Name(), err)
+		case ok:
+			fmt.Printf("%s: log level set to %s\n", client.Name(), level)
+		default:
+			fmt.Printf("%s: logging not supported\n", client.Name())
+		}
+	}
+	return nil
+}
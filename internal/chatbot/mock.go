@@ -0,0 +1,152 @@
+package chatbot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"ExtraChat/internal/backend"
+	"ExtraChat/internal/mock"
+	"ExtraChat/internal/session"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// mockSettings are the settings the mock backend is built from; it is
+// rebuilt, losing its place in the script, when a reload changes them
+type mockSettings struct {
+	fixtures     string
+	latency      time.Duration
+	errorPercent int
+}
+
+// mockBackend returns the mock backend for the current settings
+func (cb *ChatBot) mockBackend() (*mock.Backend, error) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	settings := mockSettings{cb.cfg().MockFixtures, cb.cfg().MockLatency, cb.cfg().MockErrorPercent}
+	if cb.mock != nil && cb.mockSettings == settings {
+		return cb.mock, nil
+	}
+	m, err := mock.New(settings.fixtures, settings.latency, settings.errorPercent)
+	if err != nil {
+		return nil, err
+	}
+	cb.mock, cb.mockSettings = m, settings
+	return m, nil
+}
+
+// callMock answers from the mock backend's fixtures, or echoes the prompt.
+// A rule naming a tool calls it through MCP like a model would, and
+// failures look like failed API responses to /stats and batch retries.
+func (cb *ChatBot) callMock(ctx context.Context, target llmTarget, messages []session.Message) (string, error) {
+	ctx, span := cb.tracer.Start(ctx, "mock_api_call")
+	defer span.End()
+
+	m, err := cb.mockBackend()
+	if err != nil {
+		return "", err
+	}
+	var prompt string
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "user" {
+			prompt = messages[i].Content
+			break
+		}
+	}
+
+	turn, err := m.Respond(prompt, target.Model)
+	if turn != nil && turn.Latency > 0 {
+		select {
+		case <-cb.clock.After(turn.Latency):
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+	var failure *mock.Failure
+	if errors.As(err, &failure) {
+		span.SetAttributes(attribute.Int("status", failure.Status))
+		return "", &apiError{
+			op:         "mock error",
+			StatusCode: failure.Status,
+			Status:     fmt.Sprintf("%d %s", failure.Status, http.StatusText(failure.Status)),
+			Body:       failure.Message,
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var result string
+	if turn.Tool != "" {
+		if target.Tools && cb.cfg().MCPEnabled {
+			span.SetAttributes(attribute.String("tool", turn.Tool))
+			content := cb.runToolUse(ctx, backend.AnthropicContent{
+				Type:  "tool_use",
+				ID:    fmt.Sprintf("mock_%d", time.Now().UnixNano()),
+				Name:  turn.Tool,
+				Input: turn.Arguments,
+			})
+			result = toolResultText(content)
+		} else {
+			cb.logger.Debug("mock tool call skipped, tools are off", "tool", turn.Tool)
+		}
+	}
+	reply, err := turn.Reply(result)
+	if err != nil {
+		return "", err
+	}
+
+	reply = cutAtStop(reply, cb.stopSequences(ctx))
+
+	if emit := turnEventsFrom(ctx); emit != nil {
+		for _, word := range strings.SplitAfter(reply, " ") {
+			if err := ctx.Err(); err != nil {
+				return "", err
+			}
+			emitToken(emit, word)
+		}
+	}
+
+	var promptBytes int
+	for _, msg := range messages {
+		promptBytes += len(msg.Content)
+	}
+	usage := map[string]interface{}{
+		"prompt_tokens":     float64((len(target.System) + promptBytes) / bytesPerToken),
+		"completion_tokens": float64(len(reply) / bytesPerToken),
+	}
+	cb.recordMetrics(ctx, usage)
+	cb.recordUsage(ctx, target, usage)
+
+	return reply, nil
+}
+
+// toolResultText returns the text of a tool result for the mock backend's
+// replies: the text items of an MCP result, or the raw result
+func toolResultText(content backend.AnthropicContent) string {
+	raw, _ := content.Content.(string)
+	var result struct {
+		Content []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"content"`
+	}
+	if json.Unmarshal([]byte(raw), &result) != nil {
+		return raw
+	}
+	var texts []string
+	for _, item := range result.Content {
+		if item.Type == "text" {
+			texts = append(texts, item.Text)
+		}
+	}
+	if len(texts) == 0 {
+		return raw
+	}
+	return strings.Join(texts, "\n")
+}
@@ -0,0 +1,153 @@
+package chatbot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"ExtraChat/internal/backend"
+	"ExtraChat/internal/config"
+)
+
+// modelInfoCache keeps /api/show results by Ollama model, so the context
+// window of the session's model is known without asking on every prompt.
+// It is shared by the sessions of the API server.
+type modelInfoCache struct {
+	mu     sync.Mutex
+	models map[string]backend.OllamaShowResponse
+}
+
+func newModelInfoCache() *modelInfoCache {
+	return &modelInfoCache{models: make(map[string]backend.OllamaShowResponse)}
+}
+
+func (c *modelInfoCache) get(model string) (backend.OllamaShowResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	info, ok := c.models[model]
+	return info, ok
+}
+
+func (c *modelInfoCache) put(model string, info backend.OllamaShowResponse) {
+	c.mu.Lock()
+	c.models[model] = info
+	c.mu.Unlock()
+}
+
+// showOllamaModel fetches a model's metadata from Ollama's /api/show and
+// caches it
+func (cb *ChatBot) showOllamaModel(ctx context.Context, model string) (backend.OllamaShowResponse, error) {
+	var info backend.OllamaShowResponse
+	if err := cb.postJSON(ctx, "Ollama", cb.endpoint(config.BackendOllama, "/api/show"), "", backend.OllamaShowRequest{Model: model}, &info); err != nil {
+		return info, err
+	}
+	cb.modelInfo.put(model, info)
+	return info, nil
+}
+
+// learnContextWindow fetches the metadata of an Ollama model in the
+// background of a command, so later prompts are held to its context window.
+// Failures only mean the window stays unknown.
+func (cb *ChatBot) learnContextWindow(model string) {
+	ctx, cancel := context.WithTimeout(context.Background(), preflightTimeout)
+	defer cancel()
+	if _, err := cb.showOllamaModel(ctx, model); err != nil {
+		cb.logger.Warn("failed to fetch Ollama model info", "model", model, "error", err)
+	}
+}
+
+// contextWindow returns how many tokens of context a model sees per
+// request, with where the number comes from: the configured num_ctx, the
+// model's Modelfile, or the length it was trained with. It is 0 when
+// unknown.
+func contextWindow(info backend.OllamaShowResponse, numCtx int) (int, string) {
+	switch {
+	case numCtx > 0:
+		return numCtx, "ollama.num_ctx"
+	case info.NumCtx() > 0:
+		return info.NumCtx(), "Modelfile num_ctx"
+	case info.ContextLength() > 0:
+		return info.ContextLength(), "trained context length"
+	}
+	return 0, ""
+}
+
+// contextLimit returns the most estimated tokens of context that may be
+// sent with a prompt: --context-max-tokens, and for an Ollama session with
+// a known model no more than three quarters of its context window, leaving
+// room for the conversation and the reply. Callers must hold cb.mu.
+func (cb *ChatBot) contextLimit() int {
+	limit := cb.cfg().ContextMaxTokens
+	if cb.session.Backend != config.BackendOllama {
+		return limit
+	}
+	info, ok := cb.modelInfo.get(cb.cfg().OllamaModel)
+	if !ok {
+		return limit
+	}
+	if window, _ := contextWindow(info, cb.cfg().OllamaOptions.NumCtx); window > 0 {
+		limit = min(limit, window*3/4)
+	}
+	return limit
+}
+
+// handleModelInfoCommand handles /model-info [name]: the metadata of an
+// Ollama model, the current one by default
+func (cb *ChatBot) handleModelInfoCommand(args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("usage: /model-info [model]")
+	}
+	cb.mu.Lock()
+	model := cb.cfg().OllamaModel
+	numCtx := cb.cfg().OllamaOptions.NumCtx
+	cb.mu.Unlock()
+	if len(args) == 1 {
+		model = args[0]
+	}
+
+	ctx, done := cb.interruptible(context.Background())
+	defer done()
+	info, err := cb.showOllamaModel(ctx, model)
+	if err != nil {
+		return fmt.Errorf("failed to get info on %s: %w", model, err)
+	}
+
+	fmt.Printf("\nModel: %s\n", model)
+	details := info.Details
+	for _, field := range []struct{ name, value string }{
+		{"Family", details.Family},
+		{"Parameters", details.ParameterSize},
+		{"Quantization", details.QuantizationLevel},
+		{"Format", details.Format},
+	} {
+		if field.value != "" {
+			fmt.Printf("%-15s %s\n", field.name+":", field.value)
+		}
+	}
+	if trained := info.ContextLength(); trained > 0 {
+		fmt.Printf("%-15s %d tokens\n", "Trained with:", trained)
+	}
+	if window, source := contextWindow(info, numCtx); window > 0 {
+		fmt.Printf("%-15s %d tokens (%s)\n", "Context window:", window, source)
+	}
+	if len(info.Capabilities) > 0 {
+		fmt.Printf("%-15s %s\n", "Capabilities:", strings.Join(info.Capabilities, ", "))
+	}
+	if info.Template != "" {
+		fmt.Println("Template:")
+		for _, line := range strings.Split(strings.TrimRight(info.Template, "\n"), "\n") {
+			fmt.Printf("  %s\n", line)
+		}
+	}
+
+	cb.mu.Lock()
+	current := cb.session.Backend == config.BackendOllama && model == cb.cfg().OllamaModel
+	limit := cb.contextLimit()
+	cb.mu.Unlock()
+	if current {
+		fmt.Printf("\nContext sent with a prompt is limited to about %d tokens.\n", limit)
+	}
+	fmt.Println()
+	return nil
+}
@@ -0,0 +1,268 @@
+package chatbot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"ExtraChat/internal/backend"
+	"ExtraChat/internal/config"
+)
+
+// modelListTTL is how long a backend's model list is reused before it is
+// fetched again
+const modelListTTL = 10 * time.Minute
+
+// remoteModel is a model a backend offers
+type remoteModel struct {
+	ID   string
+	Name string // Display name, when the API has one
+	Size int64  // Bytes on disk, for Ollama models
+	Chat bool   // Takes chat prompts, unlike embedding, audio or image models
+}
+
+// modelListCache keeps the model lists of backends for modelListTTL. It is
+// shared by the sessions of the API server.
+type modelListCache struct {
+	mu    sync.Mutex
+	lists map[string]modelList
+}
+
+type modelList struct {
+	models  []remoteModel
+	fetched time.Time
+}
+
+func newModelListCache() *modelListCache {
+	return &modelListCache{lists: make(map[string]modelList)}
+}
+
+func (c *modelListCache) get(backendName string, now time.Time) ([]remoteModel, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	list, ok := c.lists[backendName]
+	if !ok || now.Sub(list.fetched) >= modelListTTL {
+		return nil, false
+	}
+	return list.models, true
+}
+
+func (c *modelListCache) put(backendName string, models []remoteModel, now time.Time) {
+	c.mu.Lock()
+	c.lists[backendName] = modelList{models: models, fetched: now}
+	c.mu.Unlock()
+}
+
+// listModels returns the models a backend offers, sorted by ID, from the
+// cache unless refresh is set
+func (cb *ChatBot) listModels(ctx context.Context, backendName string, refresh bool) ([]remoteModel, error) {
+	if !refresh {
+		if models, ok := cb.modelLists.get(backendName, cb.clock.Now()); ok {
+			return models, nil
+		}
+	}
+
+	var models []remoteModel
+	var err error
+	switch backendName {
+	case config.BackendOllama:
+		models, err = cb.listOllamaRemoteModels(ctx)
+	case config.BackendAnthropic:
+		models, err = cb.listAnthropicModels(ctx)
+	case config.BackendOpenAI, config.BackendGrok:
+		models, err = cb.listOpenAIModels(ctx, backendName)
+	default:
+		return nil, fmt.Errorf("the %s backend has no model list", backendName)
+	}
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(models, func(a, b remoteModel) int { return strings.Compare(a.ID, b.ID) })
+	cb.modelLists.put(backendName, models, cb.clock.Now())
+	return models, nil
+}
+
+// listOllamaRemoteModels lists the models pulled into Ollama. Those whose
+// /api/show capabilities are known are chat models if they do completion;
+// the others unless their name says they embed.
+func (cb *ChatBot) listOllamaRemoteModels(ctx context.Context) ([]remoteModel, error) {
+	tags, err := cb.listOllamaModels(ctx)
+	if err != nil {
+		return nil, err
+	}
+	models := make([]remoteModel, 0, len(tags))
+	for _, tag := range tags {
+		chat := !strings.Contains(tag.Name, "embed")
+		if info, ok := cb.modelInfo.get(tag.Name); ok && len(info.Capabilities) > 0 {
+			chat = slices.Contains(info.Capabilities, "completion")
+		}
+		models = append(models, remoteModel{ID: tag.Name, Size: tag.Size, Chat: chat})
+	}
+	return models, nil
+}
+
+// listAnthropicModels lists the Anthropic models, following the pages of
+// /v1/models. They all take chat prompts.
+func (cb *ChatBot) listAnthropicModels(ctx context.Context) ([]remoteModel, error) {
+	apiKey := cb.cfg().APIKey(config.BackendAnthropic)
+	if apiKey == "" {
+		return nil, fmt.Errorf("ANTHROPIC_API_KEY not set (or store a key with: extrachat auth set anthropic)")
+	}
+	header := http.Header{}
+	header.Set("x-api-key", apiKey)
+	header.Set("anthropic-version", "2023-06-01")
+
+	var models []remoteModel
+	query := url.Values{"limit": {"1000"}}
+	for {
+		var page backend.AnthropicModelsResponse
+		if err := cb.getJSON(ctx, config.BackendAnthropic, "/v1/models?"+query.Encode(), header, &page); err != nil {
+			return nil, err
+		}
+		for _, m := range page.Data {
+			models = append(models, remoteModel{ID: m.ID, Name: m.DisplayName, Chat: true})
+		}
+		if !page.HasMore || page.LastID == "" {
+			return models, nil
+		}
+		query.Set("after_id", page.LastID)
+	}
+}
+
+// listOpenAIModels lists the models of OpenAI or Grok. Neither says what a
+// model is for, so chat models are told apart by name.
+func (cb *ChatBot) listOpenAIModels(ctx context.Context, backendName string) ([]remoteModel, error) {
+	apiKey := cb.cfg().APIKey(backendName)
+	if apiKey == "" {
+		return nil, fmt.Errorf("%s_API_KEY not set (or store a key with: extrachat auth set %s)", strings.ToUpper(backendName), backendName)
+	}
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+apiKey)
+
+	var list backend.OpenAIModelsResponse
+	if err := cb.getJSON(ctx, backendName, "/v1/models", header, &list); err != nil {
+		return nil, err
+	}
+	models := make([]remoteModel, 0, len(list.Data))
+	for _, m := range list.Data {
+		models = append(models, remoteModel{ID: m.ID, Chat: openAIChatModel(m.ID)})
+	}
+	return models, nil
+}
+
+// nonChatModelWords mark OpenAI and Grok models that don't take chat
+// prompts
+var nonChatModelWords = []string{"embed", "whisper", "tts", "transcribe", "dall-e", "image", "moderation", "davinci", "babbage", "realtime", "search"}
+
+// openAIChatModel guesses from its name whether an OpenAI or Grok model
+// takes chat prompts
+func openAIChatModel(id string) bool {
+	for _, word := range nonChatModelWords {
+		if strings.Contains(id, word) {
+			return false
+		}
+	}
+	return true
+}
+
+// getJSON sends a GET request for path to a backend's API and decodes the
+// JSON response
+func (cb *ChatBot) getJSON(ctx context.Context, backendName, path string, header http.Header, apiResp interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", cb.endpoint(backendName, path), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	resp, err := cb.httpClient(backendName, false).Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return newAPIError("API error", resp, body)
+	}
+	if err := json.Unmarshal(body, apiResp); err != nil {
+		return fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	return nil
+}
+
+// handleListModelsCommand handles /list-models [backend|all] [refresh]: the
+// models of the session's backend, or of another or every one
+func (cb *ChatBot) handleListModelsCommand(args []string) error {
+	refresh := len(args) > 0 && args[len(args)-1] == "refresh"
+	if refresh {
+		args = args[:len(args)-1]
+	}
+	if len(args) > 1 {
+		return fmt.Errorf("usage: /list-models [backend|all] [refresh]")
+	}
+
+	cb.mu.Lock()
+	backends := []string{cb.session.Backend}
+	cb.mu.Unlock()
+	if len(args) == 1 {
+		switch {
+		case args[0] == "all":
+			backends = modelListBackends
+		case slices.Contains(modelListBackends, args[0]):
+			backends = args[:1]
+		default:
+			return fmt.Errorf("unknown backend %q (one of: %s, all)", args[0], strings.Join(modelListBackends, ", "))
+		}
+	}
+
+	ctx, done := cb.interruptible(context.Background())
+	defer done()
+	for _, backendName := range backends {
+		models, err := cb.listModels(ctx, backendName, refresh)
+		if err != nil {
+			if len(backends) == 1 {
+				return fmt.Errorf("failed to list %s models: %w", backendName, err)
+			}
+			fmt.Printf("\n%s: %v\n", backendName, err)
+			continue
+		}
+
+		cb.mu.Lock()
+		current := cb.modelFor(backendName)
+		cb.mu.Unlock()
+		fmt.Printf("\n%s models (%d):\n", backendName, len(models))
+		for _, m := range models {
+			line := "  " + m.ID
+			if m.Name != "" && m.Name != m.ID {
+				line += " - " + m.Name
+			}
+			if m.Size > 0 {
+				line += fmt.Sprintf(" - %.2f GB", float64(m.Size)/(1024*1024*1024))
+			}
+			if !m.Chat {
+				line += " [not chat]"
+			}
+			if m.ID == current {
+				line += " (current)"
+			}
+			fmt.Println(line)
+		}
+	}
+	fmt.Println()
+	return nil
+}
+
+// modelListBackends are the backends /list-models can ask
+var modelListBackends = []string{config.BackendOllama, config.BackendAnthropic, config.BackendOpenAI, config.BackendGrok}
@@ -0,0 +1,376 @@
+package chatbot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"ExtraChat/internal/backend"
+	"ExtraChat/internal/cache"
+	"ExtraChat/internal/config"
+	"ExtraChat/internal/session"
+)
+
+// messageBatchMax is the most requests the Message Batches API takes in
+// one batch; larger runs are submitted as several batches in turn
+const messageBatchMax = 100000
+
+// messageBatchState is the batch in flight, kept next to the results file
+// so that an interrupted run collects it instead of paying for its prompts
+// again
+type messageBatchState struct {
+	ID        string            `json:"id"`
+	Model     string            `json:"model"`
+	Prompts   map[string]string `json:"prompts"` // Prompt ids by custom_id
+	Submitted time.Time         `json:"submitted"`
+}
+
+// messageBatchStatePath returns where the batch in flight of a results
+// file is kept
+func messageBatchStatePath(out string) string {
+	return out + ".batch"
+}
+
+// batchWriter appends results to the results file, counting failures
+type batchWriter struct {
+	out    io.Writer
+	failed int
+	err    error // First write error
+}
+
+func (w *batchWriter) write(result batchResult) {
+	line, err := json.Marshal(result)
+	if err == nil {
+		_, err = w.out.Write(append(line, '\n'))
+	}
+	if err != nil && w.err == nil {
+		w.err = fmt.Errorf("failed to write result: %w", err)
+	}
+	if result.Error != "" {
+		w.failed++
+	}
+}
+
+// batchPricedKey marks the context of requests billed at the Message
+// Batches discount
+type batchPricedKey struct{}
+
+// runMessageBatches submits the pending prompts to Anthropic's Message
+// Batches API, waits for each batch to end and appends the results to out,
+// returning how many failed. A batch submitted by an interrupted run is
+// collected first.
+func (cb *ChatBot) runMessageBatches(ctx context.Context, progress io.Writer, opts BatchOptions, pending []batchPrompt, out io.Writer) (int, error) {
+	if _, target := cb.batchTarget(batchPrompt{}); target.Backend != config.BackendAnthropic {
+		return 0, fmt.Errorf("--message-batches needs the anthropic backend, not %s", target.Backend)
+	}
+
+	w := &batchWriter{out: out}
+	open := make(map[string]batchPrompt, len(pending)) // Prompts without a result yet
+	for _, p := range pending {
+		open[p.ID] = p
+	}
+
+	statePath := messageBatchStatePath(opts.Out)
+	state, err := loadMessageBatchState(statePath)
+	if err != nil {
+		return 0, err
+	}
+	if state != nil {
+		fmt.Fprintf(progress, "Collecting batch %s, submitted %s\n", state.ID, state.Submitted.Local().Format(time.DateTime))
+		if err := cb.collectMessageBatch(ctx, progress, opts, state, open, w); err != nil || ctx.Err() != nil {
+			return w.failed, interruption(ctx, err)
+		}
+		os.Remove(statePath)
+	}
+
+	// Cached replies are written right away; the others are submitted
+	var submit []batchPrompt
+	for _, p := range pending {
+		if _, ok := open[p.ID]; !ok {
+			continue
+		}
+		sessionID, target := cb.batchTarget(p)
+		if cached, ok := cb.checkCache(batchCacheKey(p, target)); ok {
+			cb.auditPrompt(sessionID, target, "batch", p.Prompt)
+			cb.auditResponse(sessionID, target, "batch", cached, true, nil)
+			w.write(batchResult{ID: p.ID, Timestamp: time.Now(), Response: cached, Backend: target.Backend, Model: target.Model, Cached: true})
+			continue
+		}
+		submit = append(submit, p)
+	}
+
+	for len(submit) > 0 {
+		chunk := submit[:min(len(submit), messageBatchMax)]
+		submit = submit[len(chunk):]
+
+		state, err := cb.createMessageBatch(ctx, chunk)
+		if err != nil {
+			return w.failed, interruption(ctx, err)
+		}
+		if err := saveMessageBatchState(statePath, state); err != nil {
+			return w.failed, err
+		}
+		fmt.Fprintf(progress, "Submitted %d prompts as batch %s\n", len(chunk), state.ID)
+		if err := cb.collectMessageBatch(ctx, progress, opts, state, open, w); err != nil || ctx.Err() != nil {
+			return w.failed, interruption(ctx, err)
+		}
+		os.Remove(statePath)
+	}
+	return w.failed, w.err
+}
+
+// interruption returns err unless ctx was cancelled, which Batch reports
+// itself
+func interruption(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+// batchCacheKey returns the response cache key of a batch prompt
+func batchCacheKey(p batchPrompt, target llmTarget) string {
+	messages := []session.Message{{Role: "user", Content: p.Prompt}}
+	if target.System != "" {
+		messages = append([]session.Message{{Role: "system", Content: target.System}}, messages...)
+	}
+	return cache.GenerateCacheKey(messages)
+}
+
+// createMessageBatch submits prompts as one Message Batch. Prompt ids may
+// be any string, so requests get custom_ids of their own.
+func (cb *ChatBot) createMessageBatch(ctx context.Context, prompts []batchPrompt) (*messageBatchState, error) {
+	state := &messageBatchState{Prompts: make(map[string]string, len(prompts)), Submitted: time.Now()}
+	var reqBody backend.AnthropicBatchRequest
+	for i, p := range prompts {
+		sessionID, target := cb.batchTarget(p)
+		message, err := anthropicFormat.encode("user", cb.redactFor(target, p.Prompt))
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode prompt %s: %w", p.ID, err)
+		}
+		customID := fmt.Sprintf("prompt-%d", i)
+		reqBody.Requests = append(reqBody.Requests, backend.AnthropicBatchItem{
+			CustomID: customID,
+			Params: backend.AnthropicRequest{
+				Model:     target.Model,
+				MaxTokens: 1024,
+				System:    cb.redactFor(target, target.System),
+				Messages:  []json.RawMessage{message},
+
+				StopSequences: cb.cfg().StopSequences,
+			},
+		})
+		state.Prompts[customID] = p.ID
+		state.Model = target.Model
+		cb.auditPrompt(sessionID, target, "batch", p.Prompt)
+	}
+
+	resp, err := cb.anthropicBatchRequest(ctx, "POST", cb.endpoint(config.BackendAnthropic, "/v1/messages/batches"), reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create message batch: %w", err)
+	}
+	defer resp.Body.Close()
+	var batch backend.AnthropicBatch
+	if err := json.NewDecoder(resp.Body).Decode(&batch); err != nil || batch.ID == "" {
+		return nil, fmt.Errorf("failed to read created message batch: %v", err)
+	}
+	state.ID = batch.ID
+	cb.logger.Info("message batch created", "id", batch.ID, "prompts", len(prompts))
+	return state, nil
+}
+
+// collectMessageBatch waits for a batch to end and writes the results of
+// its prompts that are still open
+func (cb *ChatBot) collectMessageBatch(ctx context.Context, progress io.Writer, opts BatchOptions, state *messageBatchState, open map[string]batchPrompt, w *batchWriter) error {
+	batch, err := cb.pollMessageBatch(ctx, progress, opts, state.ID)
+	if err != nil {
+		return err
+	}
+
+	url := batch.ResultsURL
+	if url == "" {
+		url = cb.endpoint(config.BackendAnthropic, "/v1/messages/batches/"+state.ID+"/results")
+	}
+	resp, err := cb.anthropicBatchRequest(ctx, "GET", url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to fetch results of batch %s: %w", state.ID, err)
+	}
+	defer resp.Body.Close()
+
+	latency := time.Since(state.Submitted).Milliseconds()
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var line backend.AnthropicBatchResult
+		if err := decoder.Decode(&line); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return fmt.Errorf("failed to read results of batch %s: %w", state.ID, err)
+		}
+		p, ok := open[state.Prompts[line.CustomID]]
+		if !ok {
+			continue // Already written, or no longer in the prompts file
+		}
+		delete(open, p.ID)
+
+		sessionID, target := cb.batchTarget(p)
+		target.Model = state.Model
+		result := batchResult{ID: p.ID, Timestamp: time.Now(), Backend: target.Backend, Model: target.Model, Attempts: 1, LatencyMS: latency}
+		var resultErr error
+		switch line.Result.Type {
+		case "succeeded":
+			record := &turnRecord{}
+			usageCtx := context.WithValue(context.WithValue(ctx, turnRecordKey{}, record), batchPricedKey{}, true)
+			cb.recordUsage(usageCtx, target, line.Result.Message.Usage)
+			result.Usage = record.Usage
+			for _, content := range line.Result.Message.Content {
+				if content.Type == "text" {
+					result.Response = content.Text
+					break
+				}
+			}
+			if result.Response == "" {
+				resultErr = fmt.Errorf("empty response from Anthropic")
+			}
+		case "errored":
+			e := line.Result.Error.Error
+			resultErr = fmt.Errorf("%s: %s", e.Type, e.Message)
+		default:
+			resultErr = fmt.Errorf("request %s", line.Result.Type) // canceled or expired
+		}
+
+		cb.auditResponse(sessionID, target, "batch", result.Response, false, resultErr)
+		if resultErr != nil {
+			result.Error = resultErr.Error()
+		} else {
+			cb.storeCache(batchCacheKey(p, target), result.Response)
+		}
+		w.write(result)
+	}
+	return w.err
+}
+
+// pollMessageBatch checks a batch every opts.PollInterval until it has
+// ended, reporting its counts whenever they change. Polls failing with a
+// retryable error are retried opts.Retries times in a row.
+func (cb *ChatBot) pollMessageBatch(ctx context.Context, progress io.Writer, opts BatchOptions, id string) (backend.AnthropicBatch, error) {
+	url := cb.endpoint(config.BackendAnthropic, "/v1/messages/batches/"+id)
+	var last string
+	failures := 0
+	for {
+		var batch backend.AnthropicBatch
+		resp, err := cb.anthropicBatchRequest(ctx, "GET", url, nil)
+		if err == nil {
+			err = json.NewDecoder(resp.Body).Decode(&batch)
+			resp.Body.Close()
+		}
+		switch {
+		case ctx.Err() != nil:
+			return batch, ctx.Err()
+		case err != nil:
+			failures++
+			if !retryable(err) || failures > opts.Retries {
+				return batch, fmt.Errorf("failed to check batch %s (run it again to resume): %w", id, err)
+			}
+			cb.logger.Warn("message batch poll failed, retrying", "id", id, "error", err)
+		default:
+			failures = 0
+			c := batch.RequestCounts
+			status := fmt.Sprintf("Batch %s %s: %d of %d done (%d succeeded, %d errored, %d canceled, %d expired)",
+				id, batch.ProcessingStatus, c.Succeeded+c.Errored+c.Canceled+c.Expired,
+				c.Processing+c.Succeeded+c.Errored+c.Canceled+c.Expired, c.Succeeded, c.Errored, c.Canceled, c.Expired)
+			if status != last {
+				fmt.Fprintln(progress, status)
+				last = status
+			}
+			if batch.ProcessingStatus == "ended" {
+				return batch, nil
+			}
+		}
+
+		select {
+		case <-cb.clock.After(opts.PollInterval):
+		case <-ctx.Done():
+			return batch, ctx.Err()
+		}
+	}
+}
+
+// anthropicBatchRequest sends a request to the Message Batches API and
+// returns the response if it succeeded. Results can be large, so responses
+// are read without an overall timeout.
+func (cb *ChatBot) anthropicBatchRequest(ctx context.Context, method, url string, reqBody interface{}) (*http.Response, error) {
+	apiKey := cb.cfg().APIKey(config.BackendAnthropic)
+	if apiKey == "" {
+		return nil, fmt.Errorf("ANTHROPIC_API_KEY not set (or store a key with: extrachat auth set anthropic)")
+	}
+
+	var body io.Reader
+	if reqBody != nil {
+		data, err := json.Marshal(reqBody)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal request: %w", err)
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if reqBody != nil {
+		req.Header.Set("content-type", "application/json")
+	}
+	req.Header.Set("x-api-key", apiKey)
+	req.Header.Set("anthropic-version", "2023-06-01")
+
+	resp, err := cb.httpClient(config.BackendAnthropic, true).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		return nil, newAPIError("Message Batches API error", resp, data)
+	}
+	return resp, nil
+}
+
+// loadMessageBatchState reads the batch in flight of a results file, nil
+// when there is none
+func loadMessageBatchState(path string) (*messageBatchState, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read batch state: %w", err)
+	}
+	var state messageBatchState
+	if err := json.Unmarshal(data, &state); err != nil || state.ID == "" {
+		return nil, fmt.Errorf("%s is not a message batch state file", path)
+	}
+	return &state, nil
+}
+
+// saveMessageBatchState records the batch in flight, atomically so a crash
+// can't leave half a file
+func saveMessageBatchState(path string, state *messageBatchState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to encode batch state: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write batch state: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write batch state: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package chatbot
+
+import (
+	"io"
+	"os"
+	"time"
+
+	"ExtraChat/internal/notify"
+)
+
+// notifyPreviewLength caps the reply text shown in a notification
+const notifyPreviewLength = 120
+
+// Notifier shows a desktop notification and returns the method used
+type Notifier func(title, body string) (string, error)
+
+// sendNotification shows a notification with the platform's tool, or the
+// terminal escape when stdout is a terminal
+func sendNotification(title, body string) (string, error) {
+	var terminal io.Writer
+	if isTerminal(os.Stdout) {
+		terminal = os.Stdout
+	}
+	return notify.Send(title, body, terminal)
+}
+
+// notifySlow shows a desktop notification about something that finished
+// after elapsed, if that is at least the configured threshold, so a slow
+// reply can be left to finish in the background. The notification is shown
+// in the background; a failure is only logged.
+func (cb *ChatBot) notifySlow(elapsed time.Duration, title, body string) {
+	cb.mu.Lock()
+	after := cb.cfg().NotifyAfter
+	cb.mu.Unlock()
+	if after <= 0 || elapsed < after {
+		return
+	}
+
+	send := cb.notifier
+	if send == nil {
+		send = sendNotification
+	}
+	body = previewText(body, notifyPreviewLength)
+	go func() {
+		method, err := send(title, body)
+		if err != nil {
+			cb.logger.Warn("failed to show notification", "title", title, "error", err)
+			return
+		}
+		cb.logger.Debug("notification shown", "title", title, "method", method, "elapsed_ms", elapsed.Milliseconds())
+	}()
+}
@@ -0,0 +1,42 @@
+package chatbot
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"ExtraChat/internal/config"
+)
+
+func TestNotifySlow(t *testing.T) {
+	shown := make(chan string, 4)
+	cb := newTestChatBot(t, Dependencies{Notifier: func(title, body string) (string, error) {
+		shown <- title + ": " + body
+		return "test", nil
+	}})
+	setNotifyAfter := func(after time.Duration) {
+		cb.mu.Lock()
+		cb.updateConfig(func(c *config.Config) { c.NotifyAfter = after })
+		cb.mu.Unlock()
+	}
+
+	// Disabled, then under the threshold: no notification
+	setNotifyAfter(0)
+	cb.notifySlow(time.Hour, "Reply ready", "disabled")
+	setNotifyAfter(30 * time.Second)
+	cb.notifySlow(29*time.Second, "Reply ready", "too fast")
+	cb.notifySlow(31*time.Second, "Reply ready", "a reply\nthat took "+strings.Repeat("long ", 40))
+	select {
+	case got := <-shown:
+		if !strings.HasPrefix(got, "Reply ready: a reply that took long") || !strings.HasSuffix(got, "...") {
+			t.Errorf("notification %q", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no notification of the slow reply")
+	}
+	select {
+	case got := <-shown:
+		t.Errorf("second notification %q", got)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
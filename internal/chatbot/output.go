@@ -0,0 +1,102 @@
+package chatbot
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"time"
+
+	"ExtraChat/internal/session"
+)
+
+// turnRecord is the JSON line written for each turn with --output json
+type turnRecord struct {
+	Timestamp time.Time          `json:"timestamp"`
+	SessionID string             `json:"session_id"`
+	Prompt    string             `json:"prompt"`
+	Context   []string           `json:"context,omitempty"`   // Names of the files or stdin sent along
+	Sources   []string           `json:"sources,omitempty"`   // Document chunks retrieved for the prompt, as path#part
+	Citations []session.Citation `json:"citations,omitempty"` // Retrieved chunks the response cites
+	Route     *session.Route     `json:"route,omitempty"`     // The model router's decision, with --route
+	Response  string             `json:"response"`
+	Error     string             `json:"error,omitempty"`
+	Backend   string             `json:"backend"`
+	Model     string             `json:"model"`
+	Cached    bool               `json:"cached"`
+	Truncated bool               `json:"truncated,omitempty"` // The reply was stopped before it was complete
+	Usage     turnUsage          `json:"usage"`
+	LatencyMS int64              `json:"latency_ms"`
+	TraceID   string             `json:"trace_id,omitempty"`
+}
+
+// turnUsage sums the token counts of the LLM requests of a turn, tool call
+// rounds included
+type turnUsage struct {
+	Requests         int64 `json:"requests"`
+	PromptTokens     int64 `json:"prompt_tokens"`
+	CompletionTokens int64 `json:"completion_tokens"`
+}
+
+// turnRecordKey is the context key for the record of the turn in flight
+type turnRecordKey struct{}
+
+// turnRecordFrom returns the record of the turn ctx belongs to, or nil
+// outside of a recorded turn (background jobs, the selftest)
+func turnRecordFrom(ctx context.Context) *turnRecord {
+	record, _ := ctx.Value(turnRecordKey{}).(*turnRecord)
+	return record
+}
+
+// useJSONOutput reserves stdout for turn records: the prompt, banner,
+// command output and progress display move to stderr
+func (cb *ChatBot) useJSONOutput() {
+	cb.records = json.NewEncoder(os.Stdout)
+	cb.records.SetEscapeHTML(false)
+	os.Stdout = os.Stderr
+	cb.progress = newProgressDisplay(os.Stderr, cb.cfg().Plain || !isTerminal(os.Stderr))
+}
+
+// runTurn sends prompt with any pending context and, with JSON output,
+// writes the turn's record, failed turns included
+func (cb *ChatBot) runTurn(ctx context.Context, prompt string) (string, error) {
+	if cb.records == nil {
+		outgoing, err := cb.screenSecrets(cb.withAttachments(prompt))
+		if err != nil {
+			return "", err
+		}
+		return cb.sendMessage(ctx, outgoing)
+	}
+
+	record, err := cb.recordTurn(ctx, prompt)
+	if encodeErr := cb.records.Encode(record); encodeErr != nil {
+		cb.logger.Error("failed to write turn record", "error", encodeErr)
+	}
+	return record.Response, err
+}
+
+// recordTurn sends prompt with any pending context and returns the turn's
+// record, which also describes a failed turn
+func (cb *ChatBot) recordTurn(ctx context.Context, prompt string) (*turnRecord, error) {
+	record := &turnRecord{Timestamp: time.Now(), Prompt: prompt}
+	cb.mu.Lock()
+	record.SessionID = cb.session.ID
+	for _, a := range cb.attachments {
+		record.Context = append(record.Context, a.name)
+	}
+	cb.mu.Unlock()
+
+	outgoing, err := cb.screenSecrets(cb.withAttachments(prompt))
+	if err != nil {
+		record.Error = err.Error()
+		return record, err
+	}
+
+	start := time.Now()
+	response, err := cb.sendMessage(context.WithValue(ctx, turnRecordKey{}, record), outgoing)
+	record.LatencyMS = time.Since(start).Milliseconds()
+	record.Response = response
+	if err != nil && !record.Truncated {
+		record.Error = err.Error()
+	}
+	return record, err
+}
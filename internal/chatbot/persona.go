@@ -0,0 +1,74 @@
+package chatbot
+
+import (
+	"fmt"
+	"strings"
+)
+
+// systemPrompt returns the system prompt of the session's persona; callers
+// hold cb.mu
+func (cb *ChatBot) systemPrompt() string {
+	if cb.session.Persona == "" {
+		return ""
+	}
+	persona, ok := cb.cfg().Persona(cb.session.Persona)
+	if !ok {
+		cb.logger.Warn("session persona is not defined, sending no system prompt", "persona", cb.session.Persona)
+		return ""
+	}
+	return persona.System
+}
+
+// handlePersonaCommand handles /persona [name|off]: without arguments it lists
+// the personas, otherwise it sets or clears the session's persona and
+// switches to the persona's preferred model
+func (cb *ChatBot) handlePersonaCommand(args []string) error {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if len(args) == 0 {
+		fmt.Println("\nPersonas:")
+		for _, name := range cb.cfg().PersonaNames() {
+			persona, _ := cb.cfg().Persona(name)
+			marker := "  "
+			if name == cb.session.Persona {
+				marker = "* "
+			}
+			model := ""
+			if persona.Model != "" {
+				model = " [" + persona.Model + "]"
+			}
+			fmt.Printf("%s%-16s %s%s\n", marker, name, previewText(persona.System, 60), model)
+		}
+		if cb.session.Persona == "" {
+			fmt.Println("No persona set; use /persona <name>.")
+		}
+		fmt.Println()
+		return nil
+	}
+
+	name := args[0]
+	if name == "off" {
+		cb.session.Persona = ""
+		cb.logger.Info("persona cleared", "session_id", cb.session.ID)
+		fmt.Println("Persona cleared; no system prompt is sent.")
+		return nil
+	}
+
+	persona, ok := cb.cfg().Persona(name)
+	if !ok {
+		return fmt.Errorf("unknown persona %s (available: %s)", name, strings.Join(cb.cfg().PersonaNames(), ", "))
+	}
+	if persona.Model != "" {
+		backendName, model, err := cb.cfg().ResolveModelRef(persona.Model)
+		if err != nil {
+			return fmt.Errorf("persona %s: %w", name, err)
+		}
+		cb.session.Backend, cb.session.Model = backendName, model
+		fmt.Printf("Switched to %s backend with model %s\n", backendName, model)
+	}
+	cb.session.Persona = name
+	cb.logger.Info("persona set", "session_id", cb.session.ID, "persona", name)
+	fmt.Printf("Persona: %s\n", name)
+	return nil
+}
@@ -0,0 +1,217 @@
+package chatbot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+
+	"ExtraChat/internal/cache"
+	"ExtraChat/internal/config"
+	"ExtraChat/internal/pipeline"
+	"ExtraChat/internal/postprocess"
+	"ExtraChat/internal/session"
+)
+
+// pipelineRecord is the JSON written for a pipeline run with --output json
+type pipelineRecord struct {
+	Pipeline  string               `json:"pipeline"`
+	Vars      map[string]string    `json:"vars"`
+	Steps     []pipelineStepRecord `json:"steps"`
+	Response  string               `json:"response"` // Reply of the last step
+	Error     string               `json:"error,omitempty"`
+	LatencyMS int64                `json:"latency_ms"`
+	TraceID   string               `json:"trace_id"`
+}
+
+// pipelineStepRecord is a finished step of a pipelineRecord
+type pipelineStepRecord struct {
+	Name      string    `json:"name"`
+	Backend   string    `json:"backend"`
+	Model     string    `json:"model"`
+	Prompt    string    `json:"prompt"`
+	Response  string    `json:"response"`
+	Cached    bool      `json:"cached"`
+	Usage     turnUsage `json:"usage"`
+	LatencyMS int64     `json:"latency_ms"`
+}
+
+// RunPipeline runs the steps of p in order, each rendered with the run's
+// variables and the replies of the steps before it, and writes the reply of
+// the last step to out, or with JSON output a record of every step. Each
+// step's backend, timing and token usage go to progress.
+func (cb *ChatBot) RunPipeline(ctx context.Context, out, progress io.Writer, p *pipeline.Pipeline, vars map[string]string) error {
+	record, runErr := cb.runPipeline(ctx, progress, p, vars)
+	if record == nil {
+		return runErr
+	}
+
+	if cb.cfg().Output == config.OutputJSON {
+		enc := json.NewEncoder(out)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(record); err != nil {
+			return fmt.Errorf("failed to write pipeline record: %w", err)
+		}
+		return runErr
+	}
+	fmt.Fprintf(progress, "Trace: %s\n", record.TraceID)
+	if runErr != nil {
+		return runErr
+	}
+	fmt.Fprintln(out, record.Response)
+	return nil
+}
+
+// runPipeline runs the steps of p and returns the record of the run, with
+// the error of the step that failed. The record is nil if the pipeline
+// failed its checks and nothing ran.
+func (cb *ChatBot) runPipeline(ctx context.Context, progress io.Writer, p *pipeline.Pipeline, vars map[string]string) (*pipelineRecord, error) {
+	values := p.Values(vars)
+	if err := p.Check(values); err != nil {
+		return nil, err
+	}
+	targets := make([]llmTarget, len(p.Steps))
+	for i, step := range p.Steps {
+		target, err := cb.stepTarget(step)
+		if err != nil {
+			return nil, fmt.Errorf("step %s: %w", step.Name, err)
+		}
+		targets[i] = target
+	}
+
+	ctx, span := cb.tracer.Start(ctx, "pipeline")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("pipeline", p.Name),
+		attribute.Int("steps", len(p.Steps)),
+	)
+	record := &pipelineRecord{Pipeline: p.Name, Vars: values, TraceID: span.SpanContext().TraceID().String()}
+	start := time.Now()
+
+	data := make(map[string]string, len(values)+len(p.Steps))
+	for name, value := range values {
+		data[name] = value
+	}
+	var runErr error
+	for i, step := range p.Steps {
+		result, err := cb.runPipelineStep(ctx, step, targets[i], data)
+		if err != nil {
+			runErr = fmt.Errorf("step %s: %w", step.Name, err)
+			break
+		}
+		record.Steps = append(record.Steps, result)
+		data[step.Name] = result.Response
+
+		cached := ""
+		if result.Cached {
+			cached = ", cached"
+		}
+		fmt.Fprintf(progress, "[%d/%d] %s: %s %s, %s, %d+%d tokens%s\n", i+1, len(p.Steps), step.Name, result.Backend, result.Model,
+			formatSpanDuration(time.Duration(result.LatencyMS)*time.Millisecond), result.Usage.PromptTokens, result.Usage.CompletionTokens, cached)
+	}
+	record.LatencyMS = time.Since(start).Milliseconds()
+	if runErr != nil {
+		span.RecordError(runErr)
+		span.SetStatus(codes.Error, runErr.Error())
+		record.Error = runErr.Error()
+	} else {
+		record.Response = record.Steps[len(record.Steps)-1].Response
+	}
+	cb.logger.Info("pipeline finished", "pipeline", p.Name, "steps", len(record.Steps), "latency_ms", record.LatencyMS, "error", record.Error)
+	return record, runErr
+}
+
+// runPipelineStep renders a step and sends it as a single turn without tools
+func (cb *ChatBot) runPipelineStep(ctx context.Context, step *pipeline.Step, target llmTarget, data map[string]string) (pipelineStepRecord, error) {
+	system, prompt, err := step.Render(data)
+	if err != nil {
+		return pipelineStepRecord{}, err
+	}
+	target.System = system
+
+	// recordUsage adds each request's tokens to the turn record
+	usage := &turnRecord{}
+	ctx = context.WithValue(ctx, turnRecordKey{}, usage)
+	ctx, span := cb.tracer.Start(ctx, "pipeline_step")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("step", step.Name),
+		attribute.String("backend", target.Backend),
+		attribute.String("model", target.Model),
+	)
+
+	result := pipelineStepRecord{Name: step.Name, Backend: target.Backend, Model: target.Model, Prompt: prompt}
+	start := time.Now()
+
+	messages := []session.Message{{Role: "user", Content: prompt}}
+	keyMessages := messages
+	if system != "" {
+		keyMessages = append([]session.Message{{Role: "system", Content: system}}, messages...)
+	}
+	cacheKey := cache.GenerateCacheKey(keyMessages)
+	if cached, ok := cb.checkCache(cacheKey); ok {
+		span.SetAttributes(attribute.Bool("cache_hit", true))
+		result.Cached = true
+		result.Response, err = postprocess.Apply(ctx, cached, step.Post)
+		result.LatencyMS = time.Since(start).Milliseconds()
+		return result, err
+	}
+
+	cb.mu.Lock()
+	sessionID := cb.session.ID
+	cb.mu.Unlock()
+	cb.auditPrompt(sessionID, target, "pipeline", prompt)
+	response, err := cb.callBackend(ctx, target, messages)
+	cb.turnStats.record(ctx, target, time.Since(start), err)
+	cb.auditResponse(sessionID, target, "pipeline", response, false, err)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return result, err
+	}
+	cb.storeCache(cacheKey, response)
+
+	// A step whose reply can't be post-processed fails, since the steps after
+	// it expect the processed reply
+	result.Response, err = postprocess.Apply(ctx, response, step.Post)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	result.Usage = usage.Usage
+	result.LatencyMS = time.Since(start).Milliseconds()
+	span.SetAttributes(
+		attribute.Int64("prompt_tokens", usage.Usage.PromptTokens),
+		attribute.Int64("completion_tokens", usage.Usage.CompletionTokens),
+	)
+	return result, err
+}
+
+// stepTarget returns where a step is sent: its backend or model alias and
+// model, falling back to the configured backend and its model
+func (cb *ChatBot) stepTarget(step *pipeline.Step) (llmTarget, error) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	backendName, model := cb.session.Backend, ""
+	if step.Backend != "" {
+		if aliased, aliasModel, ok := cb.cfg().ResolveAlias(step.Backend); ok {
+			backendName, model = aliased, aliasModel
+		} else if config.ValidBackend(step.Backend) {
+			backendName = step.Backend
+		} else {
+			return llmTarget{}, fmt.Errorf("unknown backend or alias %q", step.Backend)
+		}
+	}
+	if step.Model != "" {
+		model = step.Model
+	}
+	if model == "" {
+		model = cb.modelFor(backendName)
+	}
+	return llmTarget{Backend: backendName, Model: model}, nil
+}
@@ -0,0 +1,39 @@
+package chatbot
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"ExtraChat/internal/config"
+	"ExtraChat/internal/postprocess"
+)
+
+// replyPostProcessors returns the post-processors of the session's persona;
+// callers hold cb.mu
+func (cb *ChatBot) replyPostProcessors() []config.PostProcessor {
+	if cb.session.Persona == "" {
+		return nil
+	}
+	persona, _ := cb.cfg().Persona(cb.session.Persona)
+	return persona.Post
+}
+
+// postProcess runs post-processors on a reply before it is shown and
+// stored. A failing one is logged and leaves the reply as it was before it,
+// so the turn still gets its reply.
+func (cb *ChatBot) postProcess(ctx context.Context, reply string, post []config.PostProcessor) string {
+	if len(post) == 0 {
+		return reply
+	}
+	ctx, span := cb.tracer.Start(ctx, "post_process")
+	defer span.End()
+	span.SetAttributes(attribute.Int("post_processors", len(post)))
+
+	processed, err := postprocess.Apply(ctx, reply, post)
+	if err != nil {
+		cb.logger.Warn("post-processing failed", "error", err)
+		span.RecordError(err)
+	}
+	return processed
+}
@@ -0,0 +1,124 @@
+package chatbot
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"ExtraChat/internal/config"
+)
+
+// preflightTimeout bounds the startup checks so an unreachable endpoint
+// doesn't hold up the prompt
+const preflightTimeout = 5 * time.Second
+
+// preflightProblem is a failed startup check with a remediation hint
+type preflightProblem struct {
+	problem string
+	hint    string
+}
+
+// preflight checks the prerequisites of a backend: an API key for hosted
+// backends, a reachable endpoint and, for Ollama, that the model is pulled.
+// The mock backend only needs its fixtures to load.
+func (cb *ChatBot) preflight(ctx context.Context, backendName string) []preflightProblem {
+	ctx, cancel := context.WithTimeout(ctx, preflightTimeout)
+	defer cancel()
+
+	switch backendName {
+	case config.BackendOllama:
+		return cb.preflightOllama(ctx)
+	case config.BackendMock:
+		return cb.preflightMock()
+	}
+
+	var problems []preflightProblem
+	if cb.cfg().APIKey(backendName) == "" {
+		envVar := config.APIKeyEnvVars[backendName]
+		problems = append(problems, preflightProblem{
+			problem: fmt.Sprintf("no API key for %s", backendName),
+			hint:    fmt.Sprintf("export %s, set api_keys.%s in the config file, or run: extrachat auth set %s", envVar, backendName, backendName),
+		})
+	}
+
+	// Any HTTP response means the endpoint is reachable; the key is only
+	// checked by real requests
+	url := cb.endpoint(backendName, "/")
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err == nil {
+		var resp *http.Response
+		if resp, err = cb.httpClient(backendName, false).Do(req); err == nil {
+			resp.Body.Close()
+		}
+	}
+	if err != nil {
+		problems = append(problems, preflightProblem{
+			problem: fmt.Sprintf("cannot reach %s at %s: %v", backendName, url, err),
+			hint:    fmt.Sprintf("check your network or proxy settings, or set --%s-url", backendName),
+		})
+	}
+	return problems
+}
+
+// preflightOllama checks that Ollama is running and has the configured model
+func (cb *ChatBot) preflightOllama(ctx context.Context) []preflightProblem {
+	models, err := cb.listOllamaModels(ctx)
+	if err != nil {
+		return []preflightProblem{{
+			problem: fmt.Sprintf("cannot reach Ollama at %s: %v", cb.endpoint(config.BackendOllama, ""), err),
+			hint:    "start it with: ollama serve (or point --ollama-url or OLLAMA_HOST at the right host)",
+		}}
+	}
+
+	want := cb.cfg().OllamaModel
+	if !strings.Contains(want, ":") {
+		want += ":latest"
+	}
+	names := make([]string, 0, len(models))
+	for _, model := range models {
+		if model.Name == want {
+			// Its context window bounds the context sent with prompts
+			if _, err := cb.showOllamaModel(ctx, cb.cfg().OllamaModel); err != nil {
+				cb.logger.Warn("failed to fetch Ollama model info", "model", cb.cfg().OllamaModel, "error", err)
+			}
+			return nil
+		}
+		names = append(names, model.Name)
+	}
+
+	hint := fmt.Sprintf("run /pull-model %s", cb.cfg().OllamaModel)
+	if len(names) > 0 {
+		hint += fmt.Sprintf(" (or use one of: %s)", strings.Join(names, ", "))
+	}
+	return []preflightProblem{{
+		problem: fmt.Sprintf("Ollama model %s is not installed", cb.cfg().OllamaModel),
+		hint:    hint,
+	}}
+}
+
+// preflightMock checks that the mock backend's fixture file loads
+func (cb *ChatBot) preflightMock() []preflightProblem {
+	if _, err := cb.mockBackend(); err != nil {
+		return []preflightProblem{{
+			problem: err.Error(),
+			hint:    "fix the file or point --mock-fixtures at another; without fixtures the mock backend echoes prompts",
+		}}
+	}
+	return nil
+}
+
+// reportPreflight runs the startup checks for the session's backend and
+// prints any problems; the chat still starts so /switch remains available
+func (cb *ChatBot) reportPreflight(ctx context.Context) {
+	if cb.cfg().ReplayDir != "" {
+		return // Nothing is sent while replaying cassettes
+	}
+	backendName := cb.session.Backend
+	for _, p := range cb.preflight(ctx, backendName) {
+		cb.logger.Warn("startup check failed", "backend", backendName, "problem", p.problem)
+		fmt.Printf("Warning: %s\n", p.problem)
+		fmt.Printf("  Hint: %s\n", p.hint)
+	}
+}
@@ -0,0 +1,229 @@
+package chatbot
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"ExtraChat/internal/mcp"
+)
+
+// Progress display settings
+const (
+	progressTick       = 100 * time.Millisecond // Spinner frame rate
+	progressDelay      = time.Second            // Requests and quiet tools finishing sooner never draw a spinner
+	progressBarWidth   = 20
+	plainProgressEvery = time.Second // Plain mode prints at most one line per tool this often
+)
+
+var spinnerFrames = []rune("⠋⠙⠹⠸⠼⠴⠦⠧⠇⠏")
+
+// toolProgress is the latest progress reported for one running tool call
+type toolProgress struct {
+	tool      string
+	started   time.Time
+	reported  bool // The server has sent at least one progress notification
+	progress  float64
+	total     float64
+	message   string
+	lastPrint time.Time // Plain mode throttle
+}
+
+// progressDisplay renders backend requests and running tool calls on a
+// single status line: a bar when a server reports a total, a spinner with the
+// elapsed time otherwise. Plain mode appends throttled text lines instead of
+// redrawing.
+type progressDisplay struct {
+	out   io.Writer
+	plain bool
+
+	mu        sync.Mutex
+	seq       int
+	active    map[string]*toolProgress
+	order     []string // Tokens in start order
+	frame     int
+	drawn     bool          // A status line is on screen
+	suspended int           // Prompts in progress; nothing is drawn while > 0
+	stop      chan struct{} // Stops the spinner ticker; nil when not running
+}
+
+// newProgressDisplay creates a display writing to out
+func newProgressDisplay(out io.Writer, plain bool) *progressDisplay {
+	return &progressDisplay{
+		out:    out,
+		plain:  plain,
+		active: make(map[string]*toolProgress),
+	}
+}
+
+// isTerminal reports whether f is a terminal, where the status line can be
+// redrawn in place
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// start registers a tool call or backend request and returns its progress token and a function
+// to call when the call finishes
+func (d *progressDisplay) start(tool string) (string, func()) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.seq++
+	token := fmt.Sprintf("%s-%d", tool, d.seq)
+	d.active[token] = &toolProgress{tool: tool, started: time.Now()}
+	d.order = append(d.order, token)
+
+	if !d.plain && d.stop == nil {
+		d.stop = make(chan struct{})
+		go d.tick(d.stop)
+	}
+
+	var once sync.Once
+	return token, func() { once.Do(func() { d.finish(token) }) }
+}
+
+// finish removes a tool call, clearing the status line after the last one
+func (d *progressDisplay) finish(token string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.active, token)
+	for i, t := range d.order {
+		if t == token {
+			d.order = append(d.order[:i], d.order[i+1:]...)
+			break
+		}
+	}
+
+	if len(d.order) > 0 {
+		d.redraw()
+		return
+	}
+	if d.stop != nil {
+		close(d.stop)
+		d.stop = nil
+	}
+	if d.drawn {
+		fmt.Fprint(d.out, "\r\033[K")
+		d.drawn = false
+	}
+}
+
+// suspend clears the status line and stops drawing until the returned
+// function is called, so interactive prompts aren't overwritten
+func (d *progressDisplay) suspend() func() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.suspended++
+	if d.drawn {
+		fmt.Fprint(d.out, "\r\033[K")
+		d.drawn = false
+	}
+	return func() {
+		d.mu.Lock()
+		d.suspended--
+		d.mu.Unlock()
+	}
+}
+
+// update applies a notifications/progress from a server
+func (d *progressDisplay) update(params mcp.ProgressParams) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	entry, ok := d.active[fmt.Sprint(params.ProgressToken)]
+	if !ok {
+		return // Late notification for a finished call
+	}
+	// Notifications are dispatched concurrently; never move backwards
+	if entry.reported && params.Progress < entry.progress {
+		return
+	}
+	entry.reported = true
+	entry.progress = params.Progress
+	entry.total = params.Total
+	entry.message = params.Message
+
+	if d.plain {
+		if time.Since(entry.lastPrint) >= plainProgressEvery {
+			entry.lastPrint = time.Now()
+			fmt.Fprintf(d.out, "[%s] %s\n", entry.tool, entry.describe())
+		}
+		return
+	}
+	d.redraw()
+}
+
+// tick advances the spinner until stop is closed
+func (d *progressDisplay) tick(stop chan struct{}) {
+	ticker := time.NewTicker(progressTick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			d.mu.Lock()
+			d.frame++
+			d.redraw()
+			d.mu.Unlock()
+		}
+	}
+}
+
+// redraw rewrites the status line; callers hold d.mu
+func (d *progressDisplay) redraw() {
+	if d.plain || d.suspended > 0 {
+		return
+	}
+
+	var parts []string
+	for _, token := range d.order {
+		entry := d.active[token]
+		if !entry.reported && time.Since(entry.started) < progressDelay {
+			continue
+		}
+		parts = append(parts, entry.render(d.frame))
+	}
+	if len(parts) == 0 {
+		return
+	}
+
+	fmt.Fprintf(d.out, "\r\033[K%s", strings.Join(parts, " | "))
+	d.drawn = true
+}
+
+// render formats the entry for the status line
+func (p *toolProgress) render(frame int) string {
+	if p.total > 0 {
+		filled := int(p.progress / p.total * progressBarWidth)
+		filled = max(0, min(filled, progressBarWidth))
+		bar := strings.Repeat("#", filled) + strings.Repeat("-", progressBarWidth-filled)
+		return fmt.Sprintf("%s [%s] %s", p.tool, bar, p.describe())
+	}
+	spinner := spinnerFrames[frame%len(spinnerFrames)]
+	if !p.reported {
+		return fmt.Sprintf("%c %s (%s)", spinner, p.tool, time.Since(p.started).Round(time.Second))
+	}
+	return fmt.Sprintf("%c %s %s", spinner, p.tool, p.describe())
+}
+
+// describe summarizes the progress as text
+func (p *toolProgress) describe() string {
+	var text string
+	if p.total > 0 {
+		text = fmt.Sprintf("%.0f%%", p.progress/p.total*100)
+	} else {
+		text = fmt.Sprintf("%g", p.progress)
+	}
+	if p.message != "" {
+		text += " " + previewText(p.message, 40)
+	}
+	return text
+}
@@ -0,0 +1,128 @@
+package chatbot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"ExtraChat/internal/backend"
+	"ExtraChat/internal/config"
+	"ExtraChat/internal/mcp"
+)
+
+// pullOllamaModel downloads a model into Ollama, calling report with each
+// progress line as it arrives
+func (cb *ChatBot) pullOllamaModel(ctx context.Context, model string, report func(backend.OllamaPullProgress)) error {
+	ctx, span := cb.tracer.Start(ctx, "ollama_pull")
+	defer span.End()
+
+	req, release, err := newJSONRequest(ctx, cb.endpoint(config.BackendOllama, "/api/pull"), backend.OllamaPullRequest{Model: model, Stream: true})
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	// Pulls take minutes, so they go through the client without a timeout
+	resp, err := cb.httpClient(config.BackendOllama, true).Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request (is Ollama running?): %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return newAPIError("API error", resp, body)
+	}
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var progress backend.OllamaPullProgress
+		if err := decoder.Decode(&progress); errors.Is(err, io.EOF) {
+			return fmt.Errorf("pull of %s ended without success", model)
+		} else if err != nil {
+			return fmt.Errorf("failed to read pull progress: %w", err)
+		}
+		if progress.Error != "" {
+			return fmt.Errorf("pull failed: %s", progress.Error)
+		}
+		report(progress)
+		if progress.Status == "success" {
+			return nil
+		}
+	}
+}
+
+// handlePullModelCommand handles /pull-model <model>: the model is pulled
+// into Ollama with a progress bar per layer, and the other steps are
+// printed as they happen. Ctrl+C cancels the pull.
+func (cb *ChatBot) handlePullModelCommand(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: /pull-model <model:version>")
+	}
+	model := args[0]
+
+	// Each layer gets its own entry because the display never moves a
+	// bar backwards
+	var layer string
+	var token string
+	var finish func()
+	endLayer := func() {
+		if finish != nil {
+			finish()
+			finish = nil
+		}
+	}
+	report := func(p backend.OllamaPullProgress) {
+		if p.Digest == "" || p.Total == 0 {
+			endLayer()
+			layer = ""
+			fmt.Println(p.Status)
+			return
+		}
+		if p.Digest != layer {
+			endLayer()
+			layer = p.Digest
+			token, finish = cb.progress.start("pulling " + shortDigest(p.Digest))
+		}
+		cb.progress.update(mcp.ProgressParams{
+			ProgressToken: token,
+			Progress:      float64(p.Completed),
+			Total:         float64(p.Total),
+			Message:       fmt.Sprintf("of %s", formatBytes(uint64(p.Total))),
+		})
+	}
+
+	ctx, done := cb.interruptible(context.Background())
+	err := cb.pullOllamaModel(ctx, model, report)
+	endLayer()
+	done()
+	if errors.Is(err, context.Canceled) {
+		fmt.Println("Pull cancelled.")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to pull %s: %w", model, err)
+	}
+
+	cb.mu.Lock()
+	current := cb.cfg().OllamaModel
+	cb.mu.Unlock()
+	if model != current {
+		fmt.Printf("Pulled %s. Use /set-ollama-model %s to chat with it.\n", model, model)
+	}
+	return nil
+}
+
+// shortDigest shortens a layer digest like "sha256:6a0746a1ec1a..." to
+// the 12 hex digits Ollama's own CLI shows
+func shortDigest(digest string) string {
+	digest = strings.TrimPrefix(digest, "sha256:")
+	if len(digest) > 12 {
+		return digest[:12]
+	}
+	return digest
+}
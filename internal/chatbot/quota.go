@@ -0,0 +1,265 @@
+package chatbot
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Quota windows of the API server
+const (
+	rateWindow  = time.Minute
+	dailyWindow = 24 * time.Hour
+)
+
+// Names of the limits in errors and metrics
+const (
+	limitRequestsPerMinute = "requests_per_minute"
+	limitRequestsPerDay    = "requests_per_day"
+	limitTokensPerDay      = "tokens_per_day"
+)
+
+// quotaError is a request over one of the tenant's limits, answered with
+// 429 and a Retry-After header
+type quotaError struct {
+	limit      string
+	used       int64
+	max        int64
+	retryAfter time.Duration
+}
+
+func (e *quotaError) Error() string {
+	return fmt.Sprintf("%s: %s quota of %d used up (%d); retry in %s", errQuotaExceeded, e.limit, e.max, e.used, e.retryAfter.Round(time.Second))
+}
+
+func (e *quotaError) Unwrap() error {
+	return errQuotaExceeded
+}
+
+// retryAfterSeconds is the Retry-After value of the error, rounded up to a
+// whole second
+func (e *quotaError) retryAfterSeconds() int64 {
+	return max(1, int64(math.Ceil(e.retryAfter.Seconds())))
+}
+
+// setRetryAfter adds the Retry-After header for a quota error
+func setRetryAfter(w http.ResponseWriter, err *quotaError) {
+	w.Header().Set("Retry-After", strconv.FormatInt(err.retryAfterSeconds(), 10))
+}
+
+// rateLimiter counts each tenant's API requests over a sliding minute
+type rateLimiter struct {
+	mu       sync.Mutex
+	requests map[string][]time.Time // Times of the requests in the window, oldest first
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{requests: make(map[string][]time.Time)}
+}
+
+// allow counts a request of a tenant allowed limit per minute, and returns
+// the requests in the window; when over the limit, the request is not
+// counted and the wait until the oldest one leaves the window is returned
+func (l *rateLimiter) allow(tenant string, limit int64, now time.Time) (int64, time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	times := l.requests[tenant]
+	expired := 0
+	for expired < len(times) && now.Sub(times[expired]) >= rateWindow {
+		expired++
+	}
+	times = times[expired:]
+
+	if int64(len(times)) >= limit {
+		l.requests[tenant] = times
+		// The limit may have been lowered by a reload, so more than one
+		// request may have to leave the window
+		oldest := times[int64(len(times))-limit]
+		return int64(len(times)), oldest.Add(rateWindow).Sub(now), false
+	}
+	l.requests[tenant] = append(times, now)
+	return int64(len(times)) + 1, 0, true
+}
+
+// quotaMetrics exports the tenants' quota usage and rejections as OTel
+// metrics
+type quotaMetrics struct {
+	mu    sync.Mutex
+	usage map[quotaKey]quotaUsage // Latest usage seen per tenant and limit
+
+	rejected metric.Int64Counter
+}
+
+// quotaKey identifies a limit of a tenant
+type quotaKey struct {
+	tenant string
+	limit  string
+}
+
+// quotaUsage is a tenant's usage of a limit when last checked
+type quotaUsage struct {
+	used int64
+	max  int64
+}
+
+// newQuotaMetrics creates the quota tracker and registers its instruments
+func newQuotaMetrics(meter metric.Meter) (*quotaMetrics, error) {
+	m := &quotaMetrics{usage: make(map[quotaKey]quotaUsage)}
+
+	var err error
+	m.rejected, err = meter.Int64Counter(
+		"api.quota.rejected",
+		metric.WithDescription("API requests rejected with 429, by tenant and limit"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create quota rejection counter: %w", err)
+	}
+
+	observe := func(value func(quotaUsage) int64) metric.Int64Callback {
+		return func(_ context.Context, o metric.Int64Observer) error {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			for key, usage := range m.usage {
+				o.Observe(value(usage), metric.WithAttributes(
+					attribute.String("tenant", key.tenant),
+					attribute.String("limit", key.limit),
+				))
+			}
+			return nil
+		}
+	}
+	_, err = meter.Int64ObservableGauge(
+		"api.quota.used",
+		metric.WithDescription("Tenant's usage of a quota in its current window, as of the last check"),
+		metric.WithInt64Callback(observe(func(u quotaUsage) int64 { return u.used })),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create quota usage gauge: %w", err)
+	}
+	_, err = meter.Int64ObservableGauge(
+		"api.quota.limit",
+		metric.WithDescription("Tenant's configured quota"),
+		metric.WithInt64Callback(observe(func(u quotaUsage) int64 { return u.max })),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create quota limit gauge: %w", err)
+	}
+
+	return m, nil
+}
+
+// record stores a tenant's usage of a limit, counting a rejection if it is
+// over the limit
+func (m *quotaMetrics) record(ctx context.Context, tenant, limit string, used, quota int64, rejected bool) {
+	m.mu.Lock()
+	m.usage[quotaKey{tenant, limit}] = quotaUsage{used: used, max: quota}
+	m.mu.Unlock()
+
+	if rejected {
+		m.rejected.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("tenant", tenant),
+			attribute.String("limit", limit),
+		))
+	}
+}
+
+// checkRate counts an API request of the client of ctx against its
+// requests per minute, failing with a quotaError over the limit
+func (s *apiServer) checkRate(ctx context.Context) error {
+	client := clientFrom(ctx)
+	if client == nil || client.tenant.Quota.RequestsPerMinute == 0 {
+		return nil
+	}
+
+	limit := client.tenant.Quota.RequestsPerMinute
+	used, retryAfter, ok := s.limiter.allow(client.name, limit, s.bot.clock.Now())
+	s.quotas.record(ctx, client.name, limitRequestsPerMinute, used, limit, !ok)
+	if !ok {
+		s.bot.logger.Warn("tenant over its rate limit", "tenant", client.name, "limit", limit)
+		return &quotaError{limit: limitRequestsPerMinute, used: used, max: limit, retryAfter: retryAfter}
+	}
+	return nil
+}
+
+// checkQuota fails with a quotaError once the client of ctx has used up its
+// LLM requests or tokens for the last 24 hours. It is checked before each
+// turn, so the turn that crosses the limit still completes.
+func (s *apiServer) checkQuota(ctx context.Context) error {
+	client := clientFrom(ctx)
+	if client == nil || (client.tenant.Quota.RequestsPerDay == 0 && client.tenant.Quota.TokensPerDay == 0) {
+		return nil
+	}
+
+	now := s.bot.clock.Now()
+	rows, err := s.bot.db.QueryContext(ctx,
+		`SELECT r.timestamp, COALESCE(r.input_tokens, 0) + COALESCE(r.output_tokens, 0)
+		FROM llm_requests r JOIN sessions s ON s.id = r.session_id
+		WHERE s.tenant = ? AND r.timestamp >= ? ORDER BY r.timestamp`,
+		client.name, now.Add(-dailyWindow),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to check usage quota: %w", err)
+	}
+	defer rows.Close()
+
+	type usage struct {
+		at     time.Time
+		tokens int64
+	}
+	var requests []usage
+	var tokens int64
+	for rows.Next() {
+		var u usage
+		if err := rows.Scan(&u.at, &u.tokens); err != nil {
+			return fmt.Errorf("failed to scan usage: %w", err)
+		}
+		requests = append(requests, u)
+		tokens += u.tokens
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to check usage quota: %w", err)
+	}
+
+	// retryAt returns when enough requests have left the window for the
+	// usage to drop below quota
+	retryAt := func(used, quota int64, size func(usage) int64) time.Duration {
+		for _, u := range requests {
+			used -= size(u)
+			if used < quota {
+				return u.at.Add(dailyWindow).Sub(now)
+			}
+		}
+		return dailyWindow
+	}
+
+	quota := client.tenant.Quota
+	checks := []struct {
+		limit string
+		used  int64
+		max   int64
+		size  func(usage) int64
+	}{
+		{limitRequestsPerDay, int64(len(requests)), quota.RequestsPerDay, func(usage) int64 { return 1 }},
+		{limitTokensPerDay, tokens, quota.TokensPerDay, func(u usage) int64 { return u.tokens }},
+	}
+	for _, check := range checks {
+		if check.max == 0 {
+			continue
+		}
+		over := check.used >= check.max
+		s.quotas.record(ctx, client.name, check.limit, check.used, check.max, over)
+		if over {
+			s.bot.logger.Warn("tenant over its quota", "tenant", client.name, "limit", check.limit, "used", check.used, "max", check.max)
+			return &quotaError{limit: check.limit, used: check.used, max: check.max, retryAfter: retryAt(check.used, check.max, check.size)}
+		}
+	}
+	return nil
+}
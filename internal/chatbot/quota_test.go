@@ -0,0 +1,53 @@
+package chatbot
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiterWindowRollover(t *testing.T) {
+	l := newRateLimiter()
+	start := time.Date(2026, time.January, 1, 12, 0, 0, 0, time.UTC)
+
+	for i, offset := range []time.Duration{0, 20 * time.Second, 40 * time.Second} {
+		used, _, ok := l.allow("acme", 3, start.Add(offset))
+		if !ok || used != int64(i+1) {
+			t.Fatalf("request %d: used %d, allowed %t", i+1, used, ok)
+		}
+	}
+
+	// Full until the first request leaves the window
+	used, retryAfter, ok := l.allow("acme", 3, start.Add(50*time.Second))
+	if ok || used != 3 || retryAfter != 10*time.Second {
+		t.Fatalf("over the limit: used %d, retry after %s, allowed %t", used, retryAfter, ok)
+	}
+	// Other tenants have their own window
+	if _, _, ok := l.allow("globex", 3, start.Add(50*time.Second)); !ok {
+		t.Fatal("another tenant was limited")
+	}
+
+	// A minute after the first request it has rolled out
+	used, _, ok = l.allow("acme", 3, start.Add(time.Minute))
+	if !ok || used != 3 {
+		t.Fatalf("after rollover: used %d, allowed %t", used, ok)
+	}
+	// Rejected requests weren't counted, so two more minutes later all expired
+	used, _, ok = l.allow("acme", 3, start.Add(3*time.Minute))
+	if !ok || used != 1 {
+		t.Fatalf("after the window emptied: used %d, allowed %t", used, ok)
+	}
+}
+
+func TestRateLimiterLoweredLimit(t *testing.T) {
+	l := newRateLimiter()
+	start := time.Date(2026, time.January, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 4; i++ {
+		l.allow("acme", 10, start.Add(time.Duration(i)*10*time.Second))
+	}
+
+	// Lowered to 2 by a reload: all but the newest request must leave first
+	used, retryAfter, ok := l.allow("acme", 2, start.Add(35*time.Second))
+	if ok || used != 4 || retryAfter != 45*time.Second {
+		t.Fatalf("used %d, retry after %s, allowed %t; want 4, 45s, false", used, retryAfter, ok)
+	}
+}
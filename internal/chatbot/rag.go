@@ -0,0 +1,471 @@
+package chatbot
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"ExtraChat/internal/backend"
+	"ExtraChat/internal/config"
+	"ExtraChat/internal/extract"
+	"ExtraChat/internal/rag"
+)
+
+// Ingestion limits
+const (
+	embedBatchSize = 32       // Chunks embedded per request
+	maxIngestSize  = 10 << 20 // Bytes; larger files are skipped
+)
+
+// Ingest embeds the documents matching patterns (paths, directories,
+// which are walked, or globs) into the document store, reporting each file
+// on out. Files unchanged since they were last ingested with the same
+// embedding model and chunking are skipped. With a collection, the files
+// are also added to it, unchanged ones included.
+func (cb *ChatBot) Ingest(ctx context.Context, out io.Writer, patterns []string, collection string) error {
+	store := rag.NewStore(cb.db)
+	if collection != "" {
+		if ok, err := store.HasCollection(ctx, collection); err != nil {
+			return err
+		} else if !ok {
+			return fmt.Errorf("%s: %w (create it with: extrachat kb create %s)", collection, rag.ErrNoCollection, collection)
+		}
+	}
+
+	paths, err := expandIngestPaths(patterns)
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("no files match %s", strings.Join(patterns, " "))
+	}
+
+	cb.mu.Lock()
+	model, size, overlap := cb.cfg().EmbeddingModel(), cb.cfg().ChunkSize, cb.cfg().ChunkOverlap
+	cb.mu.Unlock()
+
+	var ingested, unchanged, skipped, failed, chunks, embedded int
+	for _, path := range paths {
+		n, e, err := cb.ingestFile(ctx, store, path, model, size, overlap)
+		if collection != "" && (err == nil || errors.Is(err, errUnchanged)) {
+			if abs, absErr := filepath.Abs(path); absErr != nil {
+				err = absErr
+			} else if addErr := store.AddToCollection(ctx, collection, abs); addErr != nil {
+				err = addErr
+			}
+		}
+		switch {
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case errors.Is(err, errUnchanged):
+			unchanged++
+			fmt.Fprintf(out, "unchanged  %s\n", path)
+		case errors.Is(err, extract.ErrNotText):
+			skipped++
+			fmt.Fprintf(out, "skipped    %s (not a text, PDF or DOCX file)\n", path)
+		case err != nil:
+			failed++
+			fmt.Fprintf(out, "failed     %s: %v\n", path, err)
+			cb.logger.Error("failed to ingest document", "path", path, "error", err)
+		default:
+			ingested++
+			chunks += n
+			embedded += e
+			fmt.Fprintf(out, "ingested   %s (%d chunks, %d embedded)\n", path, n, e)
+		}
+	}
+
+	fmt.Fprintf(out, "%d ingested (%d chunks, %d embedded, %d reused), %d unchanged, %d skipped, %d failed; embedding model %s\n",
+		ingested, chunks, embedded, chunks-embedded, unchanged, skipped, failed, model)
+	if collection != "" {
+		fmt.Fprintf(out, "Collection %s: %d documents\n", collection, ingested+unchanged)
+	}
+	cb.logger.Info("documents ingested", "collection", collection, "ingested", ingested, "chunks", chunks, "embedded", embedded, "unchanged", unchanged, "skipped", skipped, "failed", failed, "model", model)
+	if failed > 0 {
+		return fmt.Errorf("%d of %d files failed to ingest", failed, len(paths))
+	}
+	return nil
+}
+
+// errUnchanged is returned by ingestFile for a document already ingested
+var errUnchanged = errors.New("document unchanged")
+
+// readDocument reads a file and returns its text
+func readDocument(path string) ([]byte, string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to stat file: %w", err)
+	}
+	if info.Size() > maxIngestSize {
+		return nil, "", fmt.Errorf("file is larger than %d MB", maxIngestSize>>20)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read file: %w", err)
+	}
+	text, err := extract.Text(path, data)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, text, nil
+}
+
+// ingestFile chunks and embeds one file and returns its number of chunks
+// and how many of them had to be embedded. Chunks whose text was embedded
+// with model before, in this document or another, reuse the stored vector.
+func (cb *ChatBot) ingestFile(ctx context.Context, store *rag.Store, path, model string, size, overlap int) (int, int, error) {
+	data, text, err := readDocument(path)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// Documents are keyed by absolute path, so ingesting again from another
+	// directory updates them; the hash covers the chunking too
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to resolve path: %w", err)
+	}
+	hash := fmt.Sprintf("%x/%d/%d", sha256.Sum256(data), size, overlap)
+	if same, err := store.Unchanged(ctx, abs, hash, model); err != nil {
+		return 0, 0, err
+	} else if same {
+		return 0, 0, errUnchanged
+	}
+
+	chunks := rag.Split(text, size, overlap)
+	hashes := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		hashes[i] = rag.ContentHash(chunk.Text)
+	}
+	cached, err := store.Vectors(ctx, model, hashes)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// Each new text is embedded once, however often it repeats
+	var texts, missing []string
+	for i, chunk := range chunks {
+		if _, ok := cached[hashes[i]]; !ok {
+			cached[hashes[i]] = nil
+			texts = append(texts, chunk.Text)
+			missing = append(missing, hashes[i])
+		}
+	}
+	if len(texts) > 0 {
+		embedded, err := cb.embed(ctx, texts)
+		if err != nil {
+			return 0, 0, err
+		}
+		for i, vector := range embedded {
+			cached[missing[i]] = vector
+		}
+	}
+
+	vectors := make([][]float32, len(chunks))
+	for i := range chunks {
+		vectors[i] = cached[hashes[i]]
+	}
+	if err := store.Replace(ctx, abs, hash, model, chunks, vectors); err != nil {
+		return 0, 0, err
+	}
+	return len(chunks), len(texts), nil
+}
+
+// expandIngestPaths turns ingest arguments into a sorted list of files.
+// Directories are walked, skipping hidden files and directories.
+func expandIngestPaths(patterns []string) ([]string, error) {
+	seen := make(map[string]bool)
+	var paths []string
+	add := func(path string) {
+		if !seen[path] {
+			seen[path] = true
+			paths = append(paths, path)
+		}
+	}
+
+	for _, pattern := range patterns {
+		matches := []string{pattern}
+		if strings.ContainsAny(pattern, "*?[") {
+			var err error
+			if matches, err = filepath.Glob(pattern); err != nil {
+				return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+			}
+		}
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil {
+				return nil, fmt.Errorf("failed to stat %s: %w", match, err)
+			}
+			if !info.IsDir() {
+				add(match)
+				continue
+			}
+			err = filepath.WalkDir(match, func(path string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				hidden := path != match && strings.HasPrefix(d.Name(), ".")
+				switch {
+				case hidden && d.IsDir():
+					return filepath.SkipDir
+				case !hidden && d.Type().IsRegular():
+					add(path)
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to walk %s: %w", match, err)
+			}
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// embed returns the embeddings of texts from the embedding backend, in
+// batches of embedBatchSize
+func (cb *ChatBot) embed(ctx context.Context, texts []string) ([][]float32, error) {
+	cb.mu.Lock()
+	backendName, model := cb.cfg().EmbedBackend, cb.cfg().EmbeddingModel()
+	cb.mu.Unlock()
+
+	ctx, span := cb.tracer.Start(ctx, "embed")
+	span.SetAttributes(
+		attribute.String("backend", backendName),
+		attribute.String("model", model),
+		attribute.Int("inputs", len(texts)),
+	)
+	defer span.End()
+
+	var vectors [][]float32
+	for start := 0; start < len(texts); start += embedBatchSize {
+		batch := texts[start:min(start+embedBatchSize, len(texts))]
+		var got [][]float32
+		var err error
+		if backendName == config.BackendOpenAI {
+			got, err = cb.embedOpenAI(ctx, model, batch)
+		} else {
+			got, err = cb.embedOllama(ctx, model, batch)
+		}
+		if err != nil {
+			span.RecordError(err)
+			return nil, err
+		}
+		if len(got) != len(batch) {
+			return nil, fmt.Errorf("expected %d embeddings from %s, got %d", len(batch), backendName, len(got))
+		}
+		vectors = append(vectors, got...)
+	}
+	return vectors, nil
+}
+
+// embedOllama embeds texts with Ollama's /api/embed
+func (cb *ChatBot) embedOllama(ctx context.Context, model string, texts []string) ([][]float32, error) {
+	var apiResp backend.OllamaEmbedResponse
+	reqBody := backend.OllamaEmbedRequest{Model: model, Input: texts}
+	if err := cb.postJSON(ctx, "embeddings", cb.endpoint(config.BackendOllama, "/api/embed"), "", reqBody, &apiResp); err != nil {
+		return nil, err
+	}
+	return apiResp.Embeddings, nil
+}
+
+// embedOpenAI embeds texts with OpenAI's /v1/embeddings
+func (cb *ChatBot) embedOpenAI(ctx context.Context, model string, texts []string) ([][]float32, error) {
+	apiKey := cb.cfg().APIKey(config.BackendOpenAI)
+	if apiKey == "" {
+		return nil, fmt.Errorf("OPENAI_API_KEY not set (or store a key with: extrachat auth set openai)")
+	}
+
+	var apiResp backend.OpenAIEmbeddingResponse
+	reqBody := backend.OpenAIEmbeddingRequest{Model: model, Input: texts}
+	if err := cb.postJSON(ctx, "embeddings", cb.endpoint(config.BackendOpenAI, "/v1/embeddings"), apiKey, reqBody, &apiResp); err != nil {
+		return nil, err
+	}
+
+	vectors := make([][]float32, len(texts))
+	for _, data := range apiResp.Data {
+		if data.Index < 0 || data.Index >= len(vectors) {
+			return nil, fmt.Errorf("embedding for unknown input %d", data.Index)
+		}
+		vectors[data.Index] = data.Embedding
+	}
+	return vectors, nil
+}
+
+// postJSON sends a request to an embeddings, rerank or moderation API and decodes the
+// response into apiResp; apiKey, when set, is sent as a bearer token
+func (cb *ChatBot) postJSON(ctx context.Context, api, url, apiKey string, reqBody, apiResp interface{}) error {
+	jsonData, err := json.Marshal(reqBody)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("content-type", "application/json")
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+
+	resp, err := cb.httpClient(apiPool, false).Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return newAPIError(api+" API error", resp, body)
+	}
+	if err := json.Unmarshal(body, apiResp); err != nil {
+		return fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	return nil
+}
+
+// retrieve returns the system prompt section with the ingested chunks most
+// relevant to prompt, and the chunks; both are empty when nothing has been
+// ingested with the embedding model. Only the documents in scope are
+// searched. With a reranker, vector search finds more candidates and the
+// reranker picks the best of them; if it fails, the vector order is kept.
+func (cb *ChatBot) retrieve(ctx context.Context, prompt string, scope rag.Scope) (string, []rag.Match, error) {
+	ctx, span := cb.tracer.Start(ctx, "retrieve")
+	defer span.End()
+
+	cb.mu.Lock()
+	model, topK, candidates := cb.cfg().EmbeddingModel(), cb.cfg().RAGTopK, cb.cfg().RerankCandidates
+	cb.mu.Unlock()
+	reranker := cb.reranker(ctx, scope)
+	if reranker == config.RerankOff || candidates < topK {
+		candidates = topK
+	}
+
+	store := rag.NewStore(cb.db)
+	if stats, err := store.Stats(ctx, model); err != nil || stats.Chunks == 0 {
+		return "", nil, err
+	}
+
+	vectors, err := cb.embed(ctx, []string{prompt})
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to embed prompt: %w", err)
+	}
+	matches, err := store.Search(ctx, model, vectors[0], candidates, scope)
+	if err != nil {
+		return "", nil, err
+	}
+	if reranker != config.RerankOff && len(matches) > 1 {
+		if ranked, err := cb.rerank(ctx, reranker, prompt, matches); err != nil {
+			cb.logger.Warn("re-ranking failed, keeping the vector search order", "reranker", reranker, "error", err)
+		} else {
+			matches = ranked
+		}
+	}
+	if len(matches) > topK {
+		matches = matches[:topK]
+	}
+	span.SetAttributes(attribute.String("reranker", reranker), attribute.Int("chunks", len(matches)))
+	if len(matches) == 0 {
+		return "", nil, nil
+	}
+
+	var b strings.Builder
+	b.WriteString("Excerpts from the user's documents follow. Use them when they are relevant to the question, and cite each one you use with its number in brackets, like [1], right after the statement it supports.")
+	for i, m := range matches {
+		fmt.Fprintf(&b, "\n\n[%d] %s (part %d):\n%s", i+1, m.Path, m.Seq, m.Content)
+	}
+	return b.String(), matches, nil
+}
+
+// withRetrieval adds the chunks of the documents in scope relevant to prompt
+// to a system prompt, and their sources to the turn's record. It also returns the chunks, numbered from 1 in the prompt, so the
+// reply's citations can be resolved. Retrieval failures are logged and the
+// prompt goes out without documents.
+func (cb *ChatBot) withRetrieval(ctx context.Context, system, prompt string, scope rag.Scope) (string, []rag.Match) {
+	excerpts, matches, err := cb.retrieve(ctx, prompt, scope)
+	if err != nil {
+		cb.logger.Warn("retrieval failed, sending the prompt without documents", "error", err)
+		return system, nil
+	}
+	if excerpts == "" {
+		return system, nil
+	}
+
+	cb.logger.Info("retrieved document chunks", "chunks", len(matches))
+	if record := turnRecordFrom(ctx); record != nil {
+		for _, m := range matches {
+			record.Sources = append(record.Sources, fmt.Sprintf("%s#%d", m.Path, m.Seq))
+		}
+	}
+	if system == "" {
+		return excerpts, matches
+	}
+	return system + "\n\n" + excerpts, matches
+}
+
+// handleRAGCommand handles /rag [on|off]: without arguments it shows what
+// has been ingested, otherwise it switches retrieval for this run
+func (cb *ChatBot) handleRAGCommand(args []string) error {
+	cb.mu.Lock()
+	enabled, model, topK := cb.cfg().RAGEnabled, cb.cfg().EmbeddingModel(), cb.cfg().RAGTopK
+	backendName, reranker, candidates := cb.cfg().EmbedBackend, cb.cfg().Rerank, cb.cfg().RerankCandidates
+	rerankModel := cb.cfg().RerankingModel(reranker)
+	cb.mu.Unlock()
+
+	if len(args) == 0 {
+		stats, err := rag.NewStore(cb.db).Stats(context.Background(), model)
+		if err != nil {
+			return err
+		}
+		state := "off"
+		if enabled {
+			state = "on"
+		}
+		fmt.Printf("\nRetrieval: %s (top %d chunks)\n", state, topK)
+		fmt.Printf("Embedding model: %s on %s\n", model, backendName)
+		switch reranker {
+		case config.RerankOff:
+			fmt.Println("Re-ranking: off")
+		case config.RerankLLM:
+			fmt.Printf("Re-ranking: llm (summarizer backend, best %d of %d chunks)\n", topK, candidates)
+		default:
+			fmt.Printf("Re-ranking: %s (%s, best %d of %d chunks)\n", reranker, rerankModel, topK, candidates)
+		}
+		fmt.Printf("Ingested: %d documents, %d chunks\n", stats.Documents, stats.Chunks)
+		if stats.Documents == 0 {
+			fmt.Println("Add documents with: extrachat ingest <path|glob>")
+		}
+		return nil
+	}
+
+	switch args[0] {
+	case "on":
+		enabled = true
+	case "off":
+		enabled = false
+	default:
+		return fmt.Errorf("usage: /rag [on|off]")
+	}
+	cb.mu.Lock()
+	cb.updateConfig(func(c *config.Config) { c.RAGEnabled = enabled })
+	cb.mu.Unlock()
+	cb.logger.Info("retrieval toggled", "enabled", enabled)
+	fmt.Printf("Retrieval %s\n", args[0])
+	return nil
+}
@@ -0,0 +1,199 @@
+package chatbot
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"ExtraChat/internal/config"
+	"ExtraChat/internal/mcp"
+	"ExtraChat/internal/telemetry"
+)
+
+// configPollInterval is how often the config files are checked for changes
+const configPollInterval = 2 * time.Second
+
+// fileStamp identifies a version of a file; the zero value means missing
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// SetConfigLoader enables hot reload: load rebuilds the configuration with
+// the same precedence as at startup, on SIGHUP or when a config file changes
+func (cb *ChatBot) SetConfigLoader(load func() (config.Config, error)) {
+	cb.loadConfig = load
+}
+
+// watchConfig reloads the configuration on SIGHUP and whenever the config
+// file or the MCP config file changes, until ctx is done
+func (cb *ChatBot) watchConfig(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	ticker := time.NewTicker(configPollInterval)
+	defer ticker.Stop()
+
+	stamps := cb.configFileStamps()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			cb.reloadConfig("SIGHUP")
+			stamps = cb.configFileStamps()
+		case <-ticker.C:
+			current := cb.configFileStamps()
+			if !reflect.DeepEqual(current, stamps) {
+				stamps = current
+				cb.reloadConfig("config file changed")
+			}
+		}
+	}
+}
+
+// configFileStamps returns the current version of each watched file. Without
+// a config file the default path is watched, so creating it takes effect.
+func (cb *ChatBot) configFileStamps() map[string]fileStamp {
+	cb.mu.Lock()
+	paths := []string{cb.cfg().ConfigFile, cb.cfg().MCPConfigFile}
+	cb.mu.Unlock()
+	if paths[0] == "" {
+		paths[0], _ = config.DefaultConfigPath()
+	}
+
+	stamps := make(map[string]fileStamp, len(paths))
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		var stamp fileStamp
+		if info, err := os.Stat(path); err == nil {
+			stamp = fileStamp{modTime: info.ModTime(), size: info.Size()}
+		}
+		stamps[path] = stamp
+	}
+	return stamps
+}
+
+// reloadConfig rebuilds the configuration and applies it to the running
+// chatbot. The current session, and any request in flight, are kept.
+func (cb *ChatBot) reloadConfig(reason string) {
+	cb.reloadMu.Lock()
+	defer cb.reloadMu.Unlock()
+
+	next, err := cb.loadConfig()
+	if err != nil {
+		cb.logger.Warn("config reload failed, keeping current settings", "reason", reason, "error", err)
+		fmt.Printf("\nConfig reload failed, keeping current settings: %v\n", err)
+		return
+	}
+
+	cb.mu.Lock()
+	current := *cb.cfg()
+	var pending []string
+	for _, setting := range config.Settings() {
+		if setting.Restart && setting.Format(next) != setting.Format(current) {
+			pending = append(pending, setting.Key)
+		}
+	}
+	config.KeepRestartSettings(&next, current)
+	cb.config.Store(&next)
+	cb.mu.Unlock()
+
+	cb.applyLiveChanges(current, next)
+
+	cb.logger.Info("config reloaded", "reason", reason, "restart_required", pending)
+	fmt.Printf("\nConfig reloaded (%s)\n", reason)
+	if len(pending) > 0 {
+		fmt.Printf("Restart to apply: %s\n", strings.Join(pending, ", "))
+	}
+}
+
+// applyLiveChanges brings running components in line with a changed
+// configuration: the application log level, MCP server definitions and their log level.
+// Everything else is read from cb.cfg() on each use.
+func (cb *ChatBot) applyLiveChanges(previous, next config.Config) {
+	if next.SlogLevel() != previous.SlogLevel() {
+		telemetry.SetLogLevel(next.SlogLevel())
+	}
+	cb.warnShadowedCommands(next)
+
+	if !next.MCPEnabled || cb.mcpRegistry == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	servers, err := mcpServerConfigs(next)
+	if err != nil {
+		cb.logger.Warn("failed to load MCP servers, keeping current ones", "error", err)
+		fmt.Printf("Failed to load MCP servers, keeping current ones: %v\n", err)
+		return
+	}
+	cb.syncMCPServers(ctx, servers)
+
+	if next.MCPLogLevel != previous.MCPLogLevel && next.MCPLogLevel != "" {
+		for _, client := range cb.mcpRegistry.All() {
+			if _, err := cb.setMCPLogLevel(ctx, client, next.MCPLogLevel); err != nil {
+				cb.logger.Warn("failed to set MCP server log level", "server", client.Name(), "error", err)
+			}
+		}
+	}
+}
+
+// syncMCPServers stops servers that were removed or changed and starts new
+// or changed ones; unchanged servers keep running
+func (cb *ChatBot) syncMCPServers(ctx context.Context, servers []mcp.ServerConfig) {
+	want := make(map[string]mcp.ServerConfig, len(servers))
+	for _, server := range servers {
+		want[server.Name] = server
+	}
+
+	var stopped, started []string
+	for name, running := range cb.mcpServers {
+		if server, ok := want[name]; ok && reflect.DeepEqual(server, running) {
+			continue
+		}
+		if client, ok := cb.mcpRegistry.Unregister(name); ok {
+			if err := client.Close(); err != nil {
+				cb.logger.Warn("failed to close MCP client", "server", name, "error", err)
+			}
+		}
+		delete(cb.mcpServers, name)
+		stopped = append(stopped, name)
+	}
+
+	var starting []mcp.ServerConfig
+	for _, server := range servers {
+		if _, ok := cb.mcpServers[server.Name]; !ok {
+			starting = append(starting, server)
+		}
+	}
+	for i, client := range cb.connectMCPServers(ctx, starting) {
+		if client == nil {
+			continue
+		}
+		server := starting[i]
+		cb.mcpRegistry.Register(server.Name, client)
+		cb.mcpServers[server.Name] = server
+		started = append(started, server.Name)
+	}
+
+	if len(stopped) == 0 && len(started) == 0 {
+		return
+	}
+	sort.Strings(stopped)
+	sort.Strings(started)
+	cb.logger.Info("MCP servers reloaded", "stopped", stopped, "started", started)
+	if err := cb.refreshMCPTools(ctx); err != nil {
+		cb.logger.Warn("failed to refresh MCP tools", "error", err)
+	}
+}
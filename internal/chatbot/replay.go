@@ -0,0 +1,381 @@
+package chatbot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+
+	"ExtraChat/internal/config"
+	"ExtraChat/internal/pricing"
+	"ExtraChat/internal/session"
+)
+
+// minReplayWidth is the narrowest side-by-side report
+const minReplayWidth = 40
+
+// ReplayOptions controls a session replay
+type ReplayOptions struct {
+	SessionID       string // Session whose user turns are replayed
+	Backend         string // Backend to replay them on, with its configured model
+	OriginalHistory bool   // Send the original replies as history instead of the replayed ones
+	Width           int    // Width of the side-by-side text report
+}
+
+// replayRecord is the outcome of a replay, written as is with --output json
+type replayRecord struct {
+	SessionID       string             `json:"session_id"`
+	OriginalBackend string             `json:"original_backend"`
+	Backend         string             `json:"backend"`
+	Model           string             `json:"model"`
+	Turns           []replayTurnRecord `json:"turns"`
+	Identical       int                `json:"identical"`
+	Changed         int                `json:"changed"`
+	Failed          int                `json:"failed"`
+	Usage           turnUsage          `json:"usage"`
+	CostUSD         *float64           `json:"cost_usd,omitempty"` // nil if the model has no price
+	LatencyMS       int64              `json:"latency_ms"`
+	TraceID         string             `json:"trace_id"`
+}
+
+// replayTurnRecord is a user turn with its original and replayed reply
+type replayTurnRecord struct {
+	Turn      int       `json:"turn"`
+	Prompt    string    `json:"prompt"`
+	Original  string    `json:"original"`
+	Response  string    `json:"response"`
+	Identical bool      `json:"identical"`
+	Error     string    `json:"error,omitempty"`
+	Usage     turnUsage `json:"usage"`
+	LatencyMS int64     `json:"latency_ms"`
+}
+
+// replayTurn is a user message of the replayed session and the replies it got
+type replayTurn struct {
+	prompt   string
+	original string
+}
+
+// RunReplay sends the user turns of a saved session again, one after the
+// other, to another backend and reports each original reply next to the new
+// one. The session is not changed. The report goes to out, or with JSON
+// output a record of the replay; the trace ID goes to progress. It fails if
+// any turn failed, after writing the report.
+func (cb *ChatBot) RunReplay(ctx context.Context, out, progress io.Writer, opts ReplayOptions) error {
+	record, err := cb.replay(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	if cb.cfg().Output == config.OutputJSON {
+		enc := json.NewEncoder(out)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(record); err != nil {
+			return fmt.Errorf("failed to write replay record: %w", err)
+		}
+	} else {
+		writeReplayReport(out, record, opts.Width)
+	}
+	fmt.Fprintf(progress, "Trace: %s\n", record.TraceID)
+	if record.Failed > 0 {
+		return fmt.Errorf("%d of %d turns failed", record.Failed, len(record.Turns))
+	}
+	return nil
+}
+
+// replay runs the user turns of opts.SessionID on opts.Backend. Turns are
+// sent without tools, so a replay has no side effects, and past the response
+// cache, so they really reach the backend. A failed turn keeps its original
+// reply in the history of the turns after it.
+func (cb *ChatBot) replay(ctx context.Context, opts ReplayOptions) (*replayRecord, error) {
+	if !config.ValidBackend(opts.Backend) {
+		return nil, fmt.Errorf("unknown backend %s", opts.Backend)
+	}
+	if err := allowBackend(ctx, opts.Backend); err != nil {
+		return nil, err
+	}
+	// Every turn is replayed, however long the session
+	sess, err := cb.loadSessionPage(opts.SessionID, 0)
+	if err != nil {
+		return nil, err
+	}
+	turns := replayTurns(sess.Messages)
+	if len(turns) == 0 {
+		return nil, fmt.Errorf("session %s has no user messages to replay", sess.ID)
+	}
+
+	cb.mu.Lock()
+	target := llmTarget{Backend: opts.Backend, Model: cb.modelFor(opts.Backend)}
+	if sess.Persona != "" {
+		if persona, ok := cb.cfg().Persona(sess.Persona); ok {
+			target.System = persona.System
+		} else {
+			cb.logger.Warn("session persona is not defined, sending no system prompt", "persona", sess.Persona)
+		}
+	}
+	table := pricing.NewTable(cb.cfg().Pricing)
+	cb.mu.Unlock()
+
+	ctx, span := cb.tracer.Start(ctx, "replay")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("session_id", sess.ID),
+		attribute.String("original_backend", sess.Backend),
+		attribute.String("backend", target.Backend),
+		attribute.String("model", target.Model),
+		attribute.Int("turns", len(turns)),
+		attribute.Bool("original_history", opts.OriginalHistory),
+	)
+	record := &replayRecord{
+		SessionID:       sess.ID,
+		OriginalBackend: sess.Backend,
+		Backend:         target.Backend,
+		Model:           target.Model,
+		TraceID:         span.SpanContext().TraceID().String(),
+	}
+	start := time.Now()
+
+	var history []session.Message
+	for i, turn := range turns {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		messages := append(history[:len(history):len(history)], session.Message{Role: "user", Content: turn.prompt})
+		result := cb.replayTurn(ctx, sess.ID, target, messages, i+1)
+		result.Original = turn.original
+		result.Identical = result.Error == "" && strings.TrimSpace(result.Response) == strings.TrimSpace(turn.original)
+		record.Turns = append(record.Turns, result)
+		record.Usage.Requests += result.Usage.Requests
+		record.Usage.PromptTokens += result.Usage.PromptTokens
+		record.Usage.CompletionTokens += result.Usage.CompletionTokens
+
+		reply := result.Response
+		switch {
+		case result.Error != "":
+			record.Failed++
+			reply = turn.original
+		case result.Identical:
+			record.Identical++
+		default:
+			record.Changed++
+		}
+		if opts.OriginalHistory {
+			reply = turn.original
+		}
+		history = append(messages, session.Message{Role: "assistant", Content: reply})
+	}
+	record.LatencyMS = time.Since(start).Milliseconds()
+	if cost, ok := requestCost(table, target, record.Usage); ok {
+		record.CostUSD = &cost
+	}
+
+	span.SetAttributes(
+		attribute.Int("identical", record.Identical),
+		attribute.Int("changed", record.Changed),
+		attribute.Int("failed", record.Failed),
+	)
+	if record.Failed > 0 {
+		span.SetStatus(codes.Error, fmt.Sprintf("%d turns failed", record.Failed))
+	}
+	cb.logger.Info("replay finished", "session_id", sess.ID, "backend", target.Backend, "model", target.Model,
+		"turns", len(turns), "identical", record.Identical, "changed", record.Changed, "failed", record.Failed)
+	return record, nil
+}
+
+// replayTurn sends one user turn of a replay
+func (cb *ChatBot) replayTurn(ctx context.Context, sessionID string, target llmTarget, messages []session.Message, turn int) replayTurnRecord {
+	// recordUsage adds each request's tokens to the turn record
+	usage := &turnRecord{}
+	ctx = context.WithValue(ctx, turnRecordKey{}, usage)
+	ctx, span := cb.tracer.Start(ctx, "replay_turn")
+	defer span.End()
+	span.SetAttributes(attribute.Int("turn", turn))
+
+	prompt := messages[len(messages)-1].Content
+	result := replayTurnRecord{Turn: turn, Prompt: prompt}
+	cb.auditPrompt(sessionID, target, "replay", prompt)
+	start := time.Now()
+	response, err := cb.callBackend(ctx, target, messages)
+	latency := time.Since(start)
+	cb.turnStats.record(ctx, target, latency, err)
+	cb.auditResponse(sessionID, target, "replay", response, false, err)
+	result.Usage = usage.Usage
+	result.LatencyMS = latency.Milliseconds()
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		cb.logger.Warn("replay turn failed", "session_id", sessionID, "turn", turn, "error", err)
+		result.Error = err.Error()
+		if errors.Is(err, context.Canceled) {
+			result.Error = "cancelled"
+		}
+		return result
+	}
+	result.Response = response
+	span.SetAttributes(
+		attribute.Int64("prompt_tokens", usage.Usage.PromptTokens),
+		attribute.Int64("completion_tokens", usage.Usage.CompletionTokens),
+	)
+	return result
+}
+
+// replayTurns pairs each user message of a conversation with the assistant
+// messages that answered it
+func replayTurns(messages []session.Message) []replayTurn {
+	var turns []replayTurn
+	for _, msg := range messages {
+		switch {
+		case msg.Role == "user":
+			turns = append(turns, replayTurn{prompt: msg.Content})
+		case msg.Role == "assistant" && len(turns) > 0:
+			last := &turns[len(turns)-1]
+			if last.original != "" {
+				last.original += "\n\n"
+			}
+			last.original += msg.Content
+		}
+	}
+	return turns
+}
+
+// writeReplayReport writes the replay as text: each prompt, then the
+// original and the new reply side by side in the style of diff -y, with
+// "|" marking changed lines, "<" lines only the original has and ">" lines
+// only the new reply has
+func writeReplayReport(w io.Writer, record *replayRecord, width int) {
+	if width < minReplayWidth {
+		width = minReplayWidth
+	}
+	column := (width - 3) / 2
+	original := "original (" + record.OriginalBackend + ")"
+	replayed := "replay (" + record.Backend + " " + record.Model + ")"
+
+	fmt.Fprintf(w, "Replay of %s: %d turns on %s %s\n", record.SessionID, len(record.Turns), record.Backend, record.Model)
+	for _, turn := range record.Turns {
+		fmt.Fprintf(w, "\n=== Turn %d ===\n", turn.Turn)
+		fmt.Fprintf(w, "Prompt: %s\n\n", turn.Prompt)
+		writeSideBySide(w, column, " ", original, replayed)
+		writeSideBySide(w, column, " ", strings.Repeat("-", column), strings.Repeat("-", column))
+		if turn.Error != "" {
+			writeSideBySide(w, column, "|", turn.Original, "error: "+turn.Error)
+			continue
+		}
+		for _, row := range diffLines(splitLines(turn.Original), splitLines(turn.Response)) {
+			writeSideBySide(w, column, row.marker, row.left, row.right)
+		}
+	}
+
+	cost := "cost unknown"
+	if record.CostUSD != nil {
+		cost = fmt.Sprintf("$%.4f", *record.CostUSD)
+	}
+	fmt.Fprintf(w, "\nSummary: %d turns, %d identical, %d changed, %d failed\n",
+		len(record.Turns), record.Identical, record.Changed, record.Failed)
+	fmt.Fprintf(w, "Replay: %d prompt and %d completion tokens, %s, %s\n", record.Usage.PromptTokens,
+		record.Usage.CompletionTokens, time.Duration(record.LatencyMS)*time.Millisecond, cost)
+}
+
+// writeSideBySide writes left and right in two columns, wrapping both at
+// the column width
+func writeSideBySide(w io.Writer, column int, marker, left, right string) {
+	l, r := wrapColumn(left, column), wrapColumn(right, column)
+	for i := 0; i < len(l) || i < len(r); i++ {
+		var a, b string
+		if i < len(l) {
+			a = l[i]
+		}
+		if i < len(r) {
+			b = r[i]
+		}
+		fmt.Fprintln(w, strings.TrimRight(fmt.Sprintf("%-*s %s %s", column, a, marker, b), " "))
+	}
+}
+
+// wrapColumn cuts s into pieces of at most width characters; an empty s is
+// one empty piece
+func wrapColumn(s string, width int) []string {
+	runes := []rune(strings.ReplaceAll(s, "\t", "    "))
+	if len(runes) == 0 {
+		return []string{""}
+	}
+	var pieces []string
+	for len(runes) > width {
+		pieces = append(pieces, string(runes[:width]))
+		runes = runes[width:]
+	}
+	return append(pieces, string(runes))
+}
+
+// splitLines splits a reply into lines, none for an empty reply
+func splitLines(s string) []string {
+	s = strings.TrimRight(s, "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+// diffRow is a line of a side-by-side diff
+type diffRow struct {
+	left, right string
+	marker      string // " " same, "|" changed, "<" left only, ">" right only
+}
+
+// diffLines lines up a and b on their longest common subsequence; lines
+// removed and added between two common lines are paired up as changed
+func diffLines(a, b []string) []diffRow {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var rows []diffRow
+	var removed, added []string
+	flush := func() {
+		for k := 0; k < len(removed) || k < len(added); k++ {
+			switch {
+			case k >= len(added):
+				rows = append(rows, diffRow{left: removed[k], marker: "<"})
+			case k >= len(removed):
+				rows = append(rows, diffRow{right: added[k], marker: ">"})
+			default:
+				rows = append(rows, diffRow{left: removed[k], right: added[k], marker: "|"})
+			}
+		}
+		removed, added = removed[:0], added[:0]
+	}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			flush()
+			rows = append(rows, diffRow{left: a[i], right: b[j], marker: " "})
+			i++
+			j++
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			removed = append(removed, a[i])
+			i++
+		default:
+			added = append(added, b[j])
+			j++
+		}
+	}
+	flush()
+	return rows
+}
@@ -0,0 +1,164 @@
+package chatbot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"ExtraChat/internal/backend"
+	"ExtraChat/internal/config"
+	"ExtraChat/internal/rag"
+)
+
+// rerankPrompt asks the summarizer backend to score retrieved passages
+const rerankPrompt = "Rate how relevant each passage below is to the query, from 0 (unrelated) to 10 (answers it). Reply with one line per passage in the form <passage number>: <score>, and nothing else.\n\nQuery: %s"
+
+// rerankScore matches a "<passage number>: <score>" line of the reply
+var rerankScore = regexp.MustCompile(`(?mi)^[ \t]*(?:passage[ \t]*)?\[?(\d+)\]?[ \t]*[:=-][ \t]*(\d+(?:\.\d+)?)`)
+
+// reranker returns the reranker for a search in scope: the bound
+// collection's own, if it has one, or the configured one
+func (cb *ChatBot) reranker(ctx context.Context, scope rag.Scope) string {
+	cb.mu.Lock()
+	reranker := cb.cfg().Rerank
+	cb.mu.Unlock()
+
+	if scope.Collection != "" {
+		own, err := rag.NewStore(cb.db).CollectionRerank(ctx, scope.Collection)
+		if err != nil {
+			cb.logger.Warn("failed to look up collection reranker", "collection", scope.Collection, "error", err)
+		} else if own != "" {
+			reranker = own
+		}
+	}
+	if reranker == "" {
+		return config.RerankOff
+	}
+	return reranker
+}
+
+// rerank orders matches by their relevance to query as judged by reranker,
+// best first. Matches the reranker gives no score keep their vector order
+// behind the scored ones.
+func (cb *ChatBot) rerank(ctx context.Context, reranker, query string, matches []rag.Match) ([]rag.Match, error) {
+	ctx, span := cb.tracer.Start(ctx, "rerank")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("reranker", reranker),
+		attribute.Int("candidates", len(matches)),
+	)
+
+	var scores map[int]float64
+	var err error
+	switch reranker {
+	case config.RerankLLM:
+		scores, err = cb.rerankLLM(ctx, query, matches)
+	case config.RerankCohere, config.RerankVoyage:
+		scores, err = cb.rerankAPI(ctx, reranker, query, matches)
+	default:
+		err = fmt.Errorf("unknown reranker %q", reranker)
+	}
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	indices := make([]int, len(matches))
+	for i := range indices {
+		indices[i] = i
+	}
+	sort.SliceStable(indices, func(a, b int) bool {
+		sa, oka := scores[indices[a]]
+		sb, okb := scores[indices[b]]
+		if oka != okb {
+			return oka
+		}
+		return sa > sb
+	})
+	ranked := make([]rag.Match, len(matches))
+	for i, index := range indices {
+		ranked[i] = matches[index]
+	}
+	span.SetAttributes(attribute.Int("scored", len(scores)))
+	return ranked, nil
+}
+
+// rerankLLM asks the summarizer backend to score each match and returns
+// the scores by match index
+func (cb *ChatBot) rerankLLM(ctx context.Context, query string, matches []rag.Match) (map[int]float64, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, rerankPrompt, query)
+	for i, m := range matches {
+		fmt.Fprintf(&b, "\n\nPassage %d:\n%s", i+1, m.Content)
+	}
+
+	// The scores are not part of the reply, so they must not stream into it
+	reply, err := cb.runHousekeeping(withTurnEvents(ctx, nil), "rerank", b.String())
+	if err != nil {
+		return nil, err
+	}
+
+	scores := make(map[int]float64)
+	for _, m := range rerankScore.FindAllStringSubmatch(reply, -1) {
+		n, err := strconv.Atoi(m[1])
+		if err != nil || n < 1 || n > len(matches) {
+			continue
+		}
+		if score, err := strconv.ParseFloat(m[2], 64); err == nil {
+			scores[n-1] = score
+		}
+	}
+	if len(scores) == 0 {
+		return nil, errors.New("the reranking reply has no scores")
+	}
+	return scores, nil
+}
+
+// rerankAPI scores the matches with the Cohere or Voyage AI rerank API and
+// returns the scores by match index
+func (cb *ChatBot) rerankAPI(ctx context.Context, provider, query string, matches []rag.Match) (map[int]float64, error) {
+	apiKey := cb.cfg().APIKey(provider)
+	if apiKey == "" {
+		return nil, fmt.Errorf("%s not set (or store a key with: extrachat auth set %s)", config.APIKeyEnvVars[provider], provider)
+	}
+	cb.mu.Lock()
+	model := cb.cfg().RerankingModel(provider)
+	cb.mu.Unlock()
+
+	documents := make([]string, len(matches))
+	for i, m := range matches {
+		documents[i] = m.Content
+	}
+
+	var results []backend.RerankResult
+	if provider == config.RerankVoyage {
+		var apiResp backend.VoyageRerankResponse
+		reqBody := backend.VoyageRerankRequest{Model: model, Query: query, Documents: documents}
+		if err := cb.postJSON(ctx, "rerank", cb.endpoint(provider, "/v1/rerank"), apiKey, reqBody, &apiResp); err != nil {
+			return nil, err
+		}
+		results = apiResp.Data
+	} else {
+		var apiResp backend.CohereRerankResponse
+		reqBody := backend.CohereRerankRequest{Model: model, Query: query, Documents: documents}
+		if err := cb.postJSON(ctx, "rerank", cb.endpoint(provider, "/v2/rerank"), apiKey, reqBody, &apiResp); err != nil {
+			return nil, err
+		}
+		results = apiResp.Results
+	}
+
+	scores := make(map[int]float64, len(results))
+	for _, r := range results {
+		if r.Index < 0 || r.Index >= len(matches) {
+			return nil, fmt.Errorf("rerank result for unknown document %d", r.Index)
+		}
+		scores[r.Index] = r.RelevanceScore
+	}
+	return scores, nil
+}
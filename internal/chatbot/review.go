@@ -0,0 +1,337 @@
+package chatbot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+
+	"ExtraChat/internal/config"
+	"ExtraChat/internal/pipeline"
+	"ExtraChat/internal/review"
+)
+
+// reviewPrompt is the built-in template of a chunk's review
+const reviewPrompt = `Review the {{if eq .kind "diff"}}changes to{{else}}code of{{end}} {{.file}} below, lines {{.lines}}. Each line starts with its line number{{if eq .kind "diff"}}; lines marked + were added and lines marked - were removed, and have no number{{end}}.
+
+Look for bugs, security problems, race conditions, mistakes in error handling and code that is misleading or hard to maintain{{if eq .kind "diff"}}, in the changed lines{{end}}. {{if .focus}}Focus on: {{.focus}}. {{end}}Don't report formatting, and leave out anything you aren't confident about.
+
+Reply with a JSON array only, one object per finding:
+[{"line": <first line>, "end_line": <last line, if several>, "severity": "error|warning|info", "message": "<the problem and why it matters>", "suggestion": "<how to fix it, if not obvious>"}]
+
+Use "error" for bugs, security holes and data loss, "warning" for likely mistakes and fragile code and "info" for style and simplifications. Reply with [] if nothing is worth reporting.
+
+{{.code}}`
+
+// reviewSystem is the system prompt of the built-in template
+const reviewSystem = "You are a meticulous senior engineer reviewing code. You report real problems precisely, with line numbers, and never invent issues."
+
+// ReviewOptions controls a code review
+type ReviewOptions struct {
+	Paths       []string  // Files, directories and globs; a .diff or .patch file, or - for Stdin, is read as a diff
+	Stdin       io.Reader // Read for the path -
+	Focus       string    // Told to the model, such as "security" or "error handling"
+	Pipeline    string    // Pipeline file replacing the built-in template; empty uses it
+	ChunkLines  int       // Most lines reviewed at once
+	Concurrency int       // Chunks reviewed at once
+	FailOn      string    // Fail when a finding is at least this severe; empty never fails on findings
+}
+
+// reviewRecord is the outcome of a review, written as is with --output json
+type reviewRecord struct {
+	Files     []reviewFileRecord `json:"files"` // Files with findings, sorted
+	Counts    map[string]int     `json:"counts"`
+	Chunks    int                `json:"chunks"`
+	Failed    []reviewFailure    `json:"failed,omitempty"`
+	Usage     turnUsage          `json:"usage"`
+	LatencyMS int64              `json:"latency_ms"`
+	TraceID   string             `json:"trace_id"`
+}
+
+// reviewFileRecord is the findings of a file, by line
+type reviewFileRecord struct {
+	File     string           `json:"file"`
+	Findings []review.Finding `json:"findings"`
+}
+
+// reviewFailure is a chunk whose review failed
+type reviewFailure struct {
+	File      string `json:"file"`
+	StartLine int    `json:"start_line"`
+	EndLine   int    `json:"end_line"`
+	Error     string `json:"error"`
+}
+
+// reviewResult is the outcome of one chunk
+type reviewResult struct {
+	findings []review.Finding
+	usage    turnUsage
+	err      error
+}
+
+// RunReview reviews source files or a unified diff in chunks of lines, each
+// sent with the built-in template or a pipeline given the same variables,
+// and writes the findings grouped by file and line to out, or with JSON
+// output a record of the review. Each chunk's outcome goes to progress.
+// With SecretScan, secrets in the chunks are replaced with markers before
+// any is sent. It fails if a chunk failed or, with FailOn, a finding is
+// severe enough, after writing the report.
+func (cb *ChatBot) RunReview(ctx context.Context, out, progress io.Writer, opts ReviewOptions) error {
+	var p *pipeline.Pipeline
+	var err error
+	if opts.Pipeline != "" {
+		p, err = pipeline.Load(opts.Pipeline)
+	} else {
+		p, err = pipeline.New("review", map[string]string{"focus": ""}, &pipeline.Step{
+			Name:   "findings",
+			System: reviewSystem,
+			Prompt: reviewPrompt,
+			Post:   []config.PostProcessor{{Kind: config.PostExtractJSON}},
+		})
+	}
+	if err != nil {
+		return err
+	}
+	chunks, err := reviewChunks(opts.Paths, opts.Stdin, max(opts.ChunkLines, 1))
+	if err != nil {
+		return err
+	}
+	if len(chunks) == 0 {
+		return errors.New("nothing to review: no text files or diff hunks found")
+	}
+	if cb.scansPipeline(p) {
+		for i, c := range chunks {
+			var found string
+			if chunks[i].Text, found = cb.redactSecrets(c.Text); found != "" {
+				fmt.Fprintf(progress, "%s:%d-%d contains %s, replaced with a marker before it is sent\n", c.File, c.StartLine, c.EndLine, found)
+			}
+		}
+	}
+
+	record, err := cb.review(ctx, progress, p, chunks, opts)
+	if err != nil {
+		return err
+	}
+	if cb.cfg().Output == config.OutputJSON {
+		enc := json.NewEncoder(out)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(record); err != nil {
+			return fmt.Errorf("failed to write review record: %w", err)
+		}
+	} else {
+		writeReviewReport(out, record)
+		fmt.Fprintf(progress, "Trace: %s\n", record.TraceID)
+	}
+
+	if len(record.Failed) > 0 {
+		return fmt.Errorf("%d of %d chunks failed", len(record.Failed), record.Chunks)
+	}
+	if opts.FailOn != "" {
+		failing := 0
+		for _, severity := range review.Severities {
+			if review.AtLeast(severity, opts.FailOn) {
+				failing += record.Counts[severity]
+			}
+		}
+		if failing > 0 {
+			return fmt.Errorf("%d findings at or above %s", failing, opts.FailOn)
+		}
+	}
+	return nil
+}
+
+// review sends the chunks from opts.Concurrency workers and collects the
+// findings
+func (cb *ChatBot) review(ctx context.Context, progress io.Writer, p *pipeline.Pipeline, chunks []review.Chunk, opts ReviewOptions) (*reviewRecord, error) {
+	// The variables are checked up front, so a pipeline missing one
+	// fails before anything is sent
+	if err := p.Check(p.Values(reviewVars(chunks[0], opts.Focus))); err != nil {
+		return nil, err
+	}
+
+	ctx, span := cb.tracer.Start(ctx, "review")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("pipeline", p.Name),
+		attribute.Int("chunks", len(chunks)),
+		attribute.String("kind", chunks[0].Kind),
+		attribute.Int("concurrency", opts.Concurrency),
+	)
+	record := &reviewRecord{Chunks: len(chunks), TraceID: span.SpanContext().TraceID().String()}
+	start := time.Now()
+
+	results := make([]reviewResult, len(chunks))
+	next := make(chan int)
+	var mu sync.Mutex // Serializes progress lines
+	var wg sync.WaitGroup
+	done := 0
+	for range min(max(opts.Concurrency, 1), len(chunks)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				results[i] = cb.reviewChunk(ctx, p, chunks[i], opts.Focus)
+				mu.Lock()
+				done++
+				c := chunks[i]
+				if err := results[i].err; err != nil {
+					fmt.Fprintf(progress, "[%d/%d] %s:%d-%d: failed: %v\n", done, len(chunks), c.File, c.StartLine, c.EndLine, err)
+				} else {
+					fmt.Fprintf(progress, "[%d/%d] %s:%d-%d: %d findings\n", done, len(chunks), c.File, c.StartLine, c.EndLine, len(results[i].findings))
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := range chunks {
+		select {
+		case next <- i:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	close(next)
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var findings []review.Finding
+	for i, result := range results {
+		record.Usage.Requests += result.usage.Requests
+		record.Usage.PromptTokens += result.usage.PromptTokens
+		record.Usage.CompletionTokens += result.usage.CompletionTokens
+		if result.err != nil {
+			c := chunks[i]
+			record.Failed = append(record.Failed, reviewFailure{File: c.File, StartLine: c.StartLine, EndLine: c.EndLine, Error: result.err.Error()})
+			continue
+		}
+		findings = append(findings, result.findings...)
+	}
+	review.Sort(findings)
+	for _, f := range findings {
+		if n := len(record.Files); n == 0 || record.Files[n-1].File != f.File {
+			record.Files = append(record.Files, reviewFileRecord{File: f.File})
+		}
+		last := &record.Files[len(record.Files)-1]
+		last.Findings = append(last.Findings, f)
+	}
+	record.Counts = review.Counts(findings)
+	record.LatencyMS = time.Since(start).Milliseconds()
+
+	span.SetAttributes(
+		attribute.Int("findings", len(findings)),
+		attribute.Int("failed", len(record.Failed)),
+	)
+	if len(record.Failed) > 0 {
+		span.SetStatus(codes.Error, fmt.Sprintf("%d chunks failed", len(record.Failed)))
+	}
+	cb.logger.Info("review finished", "chunks", len(chunks), "findings", len(findings), "failed", len(record.Failed),
+		"latency_ms", record.LatencyMS)
+	return record, nil
+}
+
+// reviewChunk sends one chunk and reads the findings of the reply
+func (cb *ChatBot) reviewChunk(ctx context.Context, p *pipeline.Pipeline, chunk review.Chunk, focus string) reviewResult {
+	record, err := cb.runPipeline(ctx, io.Discard, p, reviewVars(chunk, focus))
+	var result reviewResult
+	if record != nil {
+		for _, step := range record.Steps {
+			result.usage.Requests += step.Usage.Requests
+			result.usage.PromptTokens += step.Usage.PromptTokens
+			result.usage.CompletionTokens += step.Usage.CompletionTokens
+		}
+	}
+	if err != nil {
+		result.err = err
+		return result
+	}
+	result.findings, result.err = review.ParseFindings(record.Response, chunk)
+	return result
+}
+
+// reviewVars are the template variables of a chunk
+func reviewVars(chunk review.Chunk, focus string) map[string]string {
+	return map[string]string{
+		"file":  chunk.File,
+		"kind":  chunk.Kind,
+		"lines": fmt.Sprintf("%d-%d", chunk.StartLine, chunk.EndLine),
+		"code":  chunk.Text,
+		"focus": focus,
+	}
+}
+
+// reviewChunks reads the paths into chunks: diffs from .diff and .patch
+// files and from stdin for -, the files of directories and globs otherwise
+func reviewChunks(paths []string, stdin io.Reader, chunkLines int) ([]review.Chunk, error) {
+	var chunks []review.Chunk
+	var sources []string
+	for _, path := range paths {
+		ext := strings.ToLower(filepath.Ext(path))
+		if path != "-" && ext != ".diff" && ext != ".patch" {
+			sources = append(sources, path)
+			continue
+		}
+		var data []byte
+		var err error
+		if path == "-" {
+			data, err = io.ReadAll(stdin)
+		} else {
+			data, err = os.ReadFile(path)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read diff %s: %w", path, err)
+		}
+		diffChunks, err := review.DiffChunks(string(data), chunkLines)
+		if err != nil {
+			return nil, fmt.Errorf("diff %s: %w", path, err)
+		}
+		chunks = append(chunks, diffChunks...)
+	}
+
+	files, err := expandIngestPaths(sources)
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		chunks = append(chunks, review.FileChunks(path, data, chunkLines)...)
+	}
+	return chunks, nil
+}
+
+// writeReviewReport writes the findings grouped by file, then a summary
+func writeReviewReport(w io.Writer, record *reviewRecord) {
+	var findings []review.Finding
+	for _, file := range record.Files {
+		findings = append(findings, file.Findings...)
+	}
+	review.WriteText(w, findings)
+	if len(findings) > 0 {
+		fmt.Fprintln(w)
+	}
+
+	var counts []string
+	for _, severity := range review.Severities {
+		counts = append(counts, fmt.Sprintf("%d %s", record.Counts[severity], severity))
+	}
+	fmt.Fprintf(w, "%d findings in %d files (%s) from %d chunks", len(findings), len(record.Files), strings.Join(counts, ", "), record.Chunks)
+	if len(record.Failed) > 0 {
+		fmt.Fprintf(w, ", %d failed", len(record.Failed))
+	}
+	fmt.Fprintln(w)
+}
@@ -0,0 +1,238 @@
+package chatbot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"ExtraChat/internal/config"
+	"ExtraChat/internal/pricing"
+	"ExtraChat/internal/router"
+	"ExtraChat/internal/session"
+)
+
+// routeTarget picks where a prompt goes with the router rules: the first
+// rule the prompt matches sends it to its cheapest (or fastest) adequate
+// model. Without a matching rule or an adequate model the prompt stays on
+// target. The decision is returned for the reply's metadata.
+func (cb *ChatBot) routeTarget(ctx context.Context, prompt string, target llmTarget) (llmTarget, *session.Route) {
+	var tools []string
+	if cb.cfg().MCPEnabled {
+		for _, tool := range cb.getMCPTools() {
+			tools = append(tools, tool.Name)
+		}
+	}
+	class := router.Classify(prompt, tools)
+	route := &session.Route{Tokens: class.Tokens, Code: class.Code, Tools: class.Tools}
+
+	cb.mu.Lock()
+	rules := cb.cfg().RouterRules
+	i := router.Match(rules, class)
+	var candidates []router.Candidate
+	if i >= 0 {
+		route.Rule = rules[i].RuleName(i)
+		table := pricing.NewTable(cb.cfg().Pricing)
+		for _, ref := range rules[i].Models {
+			candidates = append(candidates, cb.routeCandidate(ctx, ref, class, table))
+		}
+	}
+	cb.mu.Unlock()
+
+	for _, c := range candidates {
+		if c.Skip != "" {
+			route.Skipped = append(route.Skipped, c.Ref+": "+c.Skip)
+		}
+	}
+	best, reason, ok := router.Pick(candidates, class, ruleAt(rules, i).Prefer)
+	switch {
+	case i < 0:
+		route.Reason = "no rule matched, kept the session's model"
+	case !ok:
+		route.Reason = "no adequate model, kept the session's model"
+	default:
+		target.Backend, target.Model = best.Backend, best.Model
+		route.Reason = reason
+	}
+	route.Backend, route.Model = target.Backend, target.Model
+
+	cb.logger.Info("routed prompt", "rule", route.Rule, "tokens", class.Tokens, "code", class.Code, "tools", class.Tools,
+		"backend", route.Backend, "model", route.Model, "reason", route.Reason, "skipped", route.Skipped)
+	return target, route
+}
+
+// routeCandidate describes a model of a rule and whether it can take the
+// prompt; callers hold cb.mu
+func (cb *ChatBot) routeCandidate(ctx context.Context, ref string, class router.Class, table *pricing.Table) router.Candidate {
+	c := router.Candidate{Ref: ref}
+	backendName, model, err := cb.cfg().ResolveRouteModel(ref)
+	if err != nil {
+		c.Skip = err.Error()
+		return c
+	}
+	if model == "" {
+		model = cb.modelFor(backendName)
+	}
+	c.Backend, c.Model = backendName, model
+	c.Price, c.Priced = table.Lookup(backendName, model)
+	c.Latency = cb.turnStats.median(backendName, model)
+
+	_, takesKey := config.APIKeyEnvVars[backendName]
+	switch {
+	// Only Anthropic requests carry the MCP tools; the mock backend calls
+	// the tools its fixtures name
+	case class.Tools && backendName != "anthropic" && backendName != config.BackendMock:
+		c.Skip = "no tool support"
+	case takesKey && cb.cfg().APIKey(backendName) == "":
+		c.Skip = "no API key"
+	case allowBackend(ctx, backendName) != nil:
+		c.Skip = "not allowed for this tenant"
+	}
+	return c
+}
+
+// ruleAt returns the i-th rule, or a zero rule if i is out of range
+func ruleAt(rules []config.RouteRule, i int) config.RouteRule {
+	if i < 0 || i >= len(rules) {
+		return config.RouteRule{}
+	}
+	return rules[i]
+}
+
+// encodeRoute serializes a routing decision for the route column
+func encodeRoute(route *session.Route) (string, error) {
+	if route == nil {
+		return "", nil
+	}
+	data, err := json.Marshal(route)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode routing decision: %w", err)
+	}
+	return string(data), nil
+}
+
+// decodeRoute parses the route column of a message
+func decodeRoute(s string) (*session.Route, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var route session.Route
+	if err := json.Unmarshal([]byte(s), &route); err != nil {
+		return nil, fmt.Errorf("failed to decode routing decision: %w", err)
+	}
+	return &route, nil
+}
+
+// printRoute shows a routing decision
+func printRoute(route *session.Route) {
+	var class []string
+	if route.Code {
+		class = append(class, "code")
+	}
+	if route.Tools {
+		class = append(class, "tools")
+	}
+	kind := "chat"
+	if len(class) > 0 {
+		kind = strings.Join(class, ", ")
+	}
+	rule := route.Rule
+	if rule == "" {
+		rule = "none"
+	}
+	fmt.Printf("Prompt: ~%d tokens, %s\n", route.Tokens, kind)
+	fmt.Printf("Rule:   %s\n", rule)
+	fmt.Printf("Model:  %s %s, %s\n", route.Backend, route.Model, route.Reason)
+	for _, skipped := range route.Skipped {
+		fmt.Printf("        skipped %s\n", skipped)
+	}
+}
+
+// describeRule renders a rule's conditions and models for /route
+func describeRule(rule config.RouteRule) string {
+	var conditions []string
+	if rule.Code != nil {
+		conditions = append(conditions, fmt.Sprintf("code=%t", *rule.Code))
+	}
+	if rule.Tools != nil {
+		conditions = append(conditions, fmt.Sprintf("tools=%t", *rule.Tools))
+	}
+	if rule.MinTokens > 0 {
+		conditions = append(conditions, fmt.Sprintf("tokens>=%d", rule.MinTokens))
+	}
+	if rule.MaxTokens > 0 {
+		conditions = append(conditions, fmt.Sprintf("tokens<=%d", rule.MaxTokens))
+	}
+	when := "any prompt"
+	if len(conditions) > 0 {
+		when = strings.Join(conditions, " ")
+	}
+	prefer := rule.Prefer
+	if prefer == "" {
+		prefer = config.PreferCost
+	}
+	return fmt.Sprintf("%s -> %s (by %s)", when, strings.Join(rule.Models, ", "), prefer)
+}
+
+// handleRouteCommand handles /route [on|off|test <prompt>]: without
+// arguments it shows the rules and the last decision of this session
+func (cb *ChatBot) handleRouteCommand(args []string) error {
+	if len(args) == 0 {
+		cb.mu.Lock()
+		enabled, rules := cb.cfg().RouterEnabled, cb.cfg().RouterRules
+		var last *session.Route
+		for i := len(cb.session.Messages) - 1; i >= 0 && last == nil; i-- {
+			last = cb.session.Messages[i].Route
+		}
+		cb.mu.Unlock()
+
+		state := "off"
+		if enabled {
+			state = "on"
+		}
+		fmt.Printf("\nRouting: %s\n", state)
+		if len(rules) == 0 {
+			fmt.Println("No rules; add them under router in the config file.")
+		}
+		for i, rule := range rules {
+			fmt.Printf("%d. %s: %s\n", i+1, rule.RuleName(i), describeRule(rule))
+		}
+		if last != nil {
+			fmt.Println("\nLast decision:")
+			printRoute(last)
+		}
+		fmt.Println()
+		return nil
+	}
+
+	switch args[0] {
+	case "on", "off":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: /route [on|off|test <prompt>]")
+		}
+		cb.mu.Lock()
+		if args[0] == "on" && len(cb.cfg().RouterRules) == 0 {
+			cb.mu.Unlock()
+			return fmt.Errorf("no router rules; add them under router in the config file")
+		}
+		cb.updateConfig(func(c *config.Config) { c.RouterEnabled = args[0] == "on" })
+		cb.mu.Unlock()
+		cb.logger.Info("routing toggled", "enabled", args[0] == "on")
+		fmt.Printf("Routing %s\n", args[0])
+		return nil
+	case "test":
+		prompt := strings.Join(args[1:], " ")
+		if prompt == "" {
+			return fmt.Errorf("usage: /route test <prompt>")
+		}
+		cb.mu.Lock()
+		target := llmTarget{Backend: cb.session.Backend, Model: cb.sessionModel(cb.session)}
+		cb.mu.Unlock()
+		_, route := cb.routeTarget(context.Background(), prompt, target)
+		fmt.Println()
+		printRoute(route)
+		fmt.Println()
+		return nil
+	}
+	return fmt.Errorf("usage: /route [on|off|test <prompt>]")
+}
@@ -0,0 +1,178 @@
+package chatbot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+
+	"ExtraChat/internal/config"
+	"ExtraChat/internal/cron"
+	"ExtraChat/internal/pipeline"
+	"ExtraChat/internal/sink"
+)
+
+// scheduledStep names the step of a prompt job, whose reply is delivered
+const scheduledStep = "reply"
+
+// runSchedule runs the scheduled jobs of the config at the start of each
+// minute they are due, until ctx is done. The jobs are read from the config
+// every minute, so a reload adds, changes or removes them. A job still
+// running when it is due again is skipped.
+func (cb *ChatBot) runSchedule(ctx context.Context) {
+	cb.mu.Lock()
+	jobs := cb.cfg().Schedule
+	cb.mu.Unlock()
+	now := cb.clock.Now()
+	for _, job := range jobs {
+		if schedule, err := cron.Parse(job.Cron); err == nil {
+			cb.logger.Info("job scheduled", "job", job.Name, "cron", job.Cron, "next", schedule.Next(now))
+		}
+	}
+
+	var mu sync.Mutex
+	running := make(map[string]bool)
+	for {
+		now := cb.clock.Now()
+		due := time.Date(now.Year(), now.Month(), now.Day(), now.Hour(), now.Minute()+1, 0, 0, now.Location())
+		select {
+		case <-ctx.Done():
+			return
+		case <-cb.clock.After(due.Sub(now)):
+		}
+
+		cb.mu.Lock()
+		jobs, sinks := cb.cfg().Schedule, cb.cfg().Sinks
+		cb.mu.Unlock()
+		for _, job := range jobs {
+			schedule, err := cron.Parse(job.Cron)
+			if err != nil || !schedule.Matches(due) {
+				continue
+			}
+			mu.Lock()
+			if running[job.Name] {
+				mu.Unlock()
+				cb.logger.Warn("scheduled job still running, skipping this run", "job", job.Name, "due", due)
+				continue
+			}
+			running[job.Name] = true
+			mu.Unlock()
+
+			go func(job config.ScheduledJob) {
+				defer func() {
+					mu.Lock()
+					delete(running, job.Name)
+					mu.Unlock()
+				}()
+				// Failures are logged and traced by the job
+				cb.runScheduledJob(ctx, job, sinks, due)
+			}(job)
+		}
+	}
+}
+
+// runScheduledJob runs a job that was due at due and delivers its reply to
+// each of its sinks. A failed run delivers nothing; a failed delivery
+// doesn't stop the others.
+func (cb *ChatBot) runScheduledJob(ctx context.Context, job config.ScheduledJob, sinks map[string]config.Sink, due time.Time) error {
+	ctx, span := cb.tracer.Start(ctx, "scheduled_job")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("job", job.Name),
+		attribute.String("cron", job.Cron),
+		attribute.StringSlice("sinks", job.Sinks),
+	)
+	start := cb.clock.Now()
+	cb.logger.Info("running scheduled job", "job", job.Name, "due", due)
+
+	reply, err := cb.scheduledReply(ctx, job, due)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		cb.logger.Error("scheduled job failed", "job", job.Name, "error", err)
+		return fmt.Errorf("job %s: %w", job.Name, err)
+	}
+
+	var errs []error
+	for _, name := range job.Sinks {
+		s, ok := sinks[name]
+		if !ok {
+			errs = append(errs, fmt.Errorf("unknown sink %q", name))
+			continue
+		}
+		if err := sink.Deliver(ctx, s, sink.Delivery{Job: job.Name, Time: due, Text: reply}); err != nil {
+			cb.logger.Error("scheduled job delivery failed", "job", job.Name, "sink", name, "error", err)
+			errs = append(errs, fmt.Errorf("sink %s: %w", name, err))
+		}
+	}
+	err = errors.Join(errs...)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.SetAttributes(attribute.Int("delivered", len(job.Sinks)-len(errs)))
+	cb.logger.Info("scheduled job finished", "job", job.Name, "latency_ms", cb.clock.Now().Sub(start).Milliseconds(),
+		"delivered", len(job.Sinks)-len(errs), "failed_deliveries", len(errs))
+	if err != nil {
+		return fmt.Errorf("job %s: %w", job.Name, err)
+	}
+	return nil
+}
+
+// scheduledReply runs a job's pipeline, or its prompt as a one-step
+// pipeline, and returns the reply of the last step. The templates get the
+// job's variables and the due date and time.
+func (cb *ChatBot) scheduledReply(ctx context.Context, job config.ScheduledJob, due time.Time) (string, error) {
+	var p *pipeline.Pipeline
+	var err error
+	if job.Pipeline != "" {
+		// Read on each run, so edits apply without a reload
+		p, err = pipeline.Load(job.Pipeline)
+	} else {
+		p, err = cb.promptPipeline(job)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	vars := map[string]string{
+		"job":     job.Name,
+		"date":    due.Format("2006-01-02"),
+		"time":    due.Format("15:04"),
+		"weekday": due.Weekday().String(),
+	}
+	for name, value := range job.Vars {
+		vars[name] = value
+	}
+	record, err := cb.runPipeline(ctx, io.Discard, p, vars)
+	if err != nil {
+		return "", err
+	}
+	return record.Response, nil
+}
+
+// promptPipeline wraps a prompt job in a pipeline of one step, with the
+// system prompt and post-processors of its persona
+func (cb *ChatBot) promptPipeline(job config.ScheduledJob) (*pipeline.Pipeline, error) {
+	step := &pipeline.Step{Name: scheduledStep, Backend: job.Backend, Prompt: job.Prompt}
+	if job.Persona != "" {
+		cb.mu.Lock()
+		persona, ok := cb.cfg().Persona(job.Persona)
+		cb.mu.Unlock()
+		if !ok {
+			return nil, fmt.Errorf("unknown persona %q", job.Persona)
+		}
+		if persona.System != "" {
+			// A quoted string, so the persona's text isn't read as a template
+			step.System = "{{" + strconv.Quote(persona.System) + "}}"
+		}
+		step.Post = persona.Post
+	}
+	return pipeline.New(job.Name, nil, step)
+}
@@ -0,0 +1,139 @@
+package chatbot
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"ExtraChat/internal/config"
+	"ExtraChat/internal/session"
+)
+
+// Search snippets: width in runes, and how much of it precedes the match
+const (
+	searchSnippetWidth  = 100
+	searchSnippetBefore = 30
+)
+
+// handleSearchCommand handles /search <regex>: it lists the messages of the
+// session matching the pattern with their numbers, matches highlighted.
+// Patterns without upper-case letters ignore case.
+func (cb *ChatBot) handleSearchCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: /search <regex>")
+	}
+	pattern := strings.Join(args, " ")
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return fmt.Errorf("invalid search pattern: %w", err)
+	}
+	if !strings.ContainsFunc(pattern, unicode.IsUpper) {
+		re = regexp.MustCompile("(?i)" + pattern)
+	}
+
+	cb.mu.Lock()
+	sessionID, older := cb.session.ID, cb.session.Older
+	messages := append([]session.Message(nil), cb.session.Messages...)
+	plain := cb.cfg().Plain
+	pageSize := cb.cfg().PageSize
+	cb.mu.Unlock()
+	if pageSize <= 0 {
+		pageSize = config.DefaultSessionPageSize
+	}
+
+	mark := func(s string) string { return "\x1b[1;7m" + s + "\x1b[0m" }
+	if plain || !isTerminal(os.Stdout) {
+		mark = func(s string) string { return ">>" + s + "<<" }
+	}
+
+	matched, total := 0, 0
+	search := func(messages []session.Message) {
+		for _, msg := range messages {
+			// Line breaks and runs of spaces count as one space, as in /history
+			text := strings.Join(strings.Fields(msg.Content), " ")
+			locs := nonEmptyMatches(re.FindAllStringIndex(text, -1))
+			if len(locs) == 0 {
+				continue
+			}
+			if matched == 0 {
+				fmt.Println()
+			}
+			matched++
+			total += len(locs)
+
+			more := ""
+			if len(locs) > 1 {
+				more = fmt.Sprintf(" (%d matches)", len(locs))
+			}
+			fmt.Printf("#%d %s: %s%s\n", msg.Seq, msg.Author(), searchSnippet(text, locs, mark), more)
+		}
+	}
+
+	// Messages before the loaded page are read a page at a time
+	for offset := 0; offset < older; offset += pageSize {
+		page, err := cb.loadMessages(sessionID, offset, min(pageSize, older-offset))
+		if err != nil {
+			return err
+		}
+		search(page)
+	}
+	search(messages)
+
+	if matched == 0 {
+		fmt.Printf("No messages match %s.\n", strings.Join(args, " "))
+		return nil
+	}
+	fmt.Printf("\n%d matches in %d of %d messages\n\n", total, matched, older+len(messages))
+	return nil
+}
+
+// nonEmptyMatches drops the empty matches of patterns like "x*"
+func nonEmptyMatches(locs [][]int) [][]int {
+	var kept [][]int
+	for _, loc := range locs {
+		if loc[0] < loc[1] {
+			kept = append(kept, loc)
+		}
+	}
+	return kept
+}
+
+// searchSnippet cuts text around its first match and marks the matches
+// within the cut
+func searchSnippet(text string, locs [][]int, mark func(string) string) string {
+	start := locs[0][0]
+	for i := 0; i < searchSnippetBefore && start > 0; i++ {
+		_, size := utf8.DecodeLastRuneInString(text[:start])
+		start -= size
+	}
+	end := start
+	for i := 0; i < searchSnippetWidth && end < len(text); i++ {
+		_, size := utf8.DecodeRuneInString(text[end:])
+		end += size
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("...")
+	}
+	pos := start
+	for _, loc := range locs {
+		if loc[0] >= end {
+			break
+		}
+		if loc[0] < pos {
+			continue
+		}
+		b.WriteString(text[pos:loc[0]])
+		b.WriteString(mark(text[loc[0]:min(loc[1], end)]))
+		pos = min(loc[1], end)
+	}
+	b.WriteString(text[pos:end])
+	if end < len(text) {
+		b.WriteString("...")
+	}
+	return b.String()
+}
@@ -0,0 +1,185 @@
+package chatbot
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"ExtraChat/internal/config"
+	"ExtraChat/internal/guard"
+	"ExtraChat/internal/pipeline"
+	"ExtraChat/internal/session"
+)
+
+// localBackends run on this machine, so prompts to them aren't scanned
+// for secrets
+var localBackends = map[string]bool{
+	config.BackendOllama: true,
+	config.BackendMock:   true,
+}
+
+// screenSecrets asks about the secrets in a prompt, attached context
+// included, before it is sent: the user chooses to send it redacted, as is,
+// or not at all; without an interactive input it is not sent. It asks
+// unless the prompt can only reach a local backend; sendToBackend redacts
+// what reaches a cloud backend all the same.
+func (cb *ChatBot) screenSecrets(prompt string) (string, error) {
+	cb.mu.Lock()
+	enabled := cb.cfg().SecretScan
+	local := localBackends[cb.session.Backend] && !cb.cfg().RouterEnabled
+	cb.mu.Unlock()
+	if !enabled || local {
+		return prompt, nil
+	}
+
+	secrets := guard.ScanSecrets(prompt)
+	if len(secrets) == 0 {
+		return prompt, nil
+	}
+	summary := secretSummary(secrets)
+	cb.logger.Warn("secrets found in prompt", "found", summary)
+
+	if cb.input == nil {
+		return "", fmt.Errorf("prompt not sent: it contains %s (see --secret-scan)", summary)
+	}
+	fmt.Printf("\nYour message contains %s:\n", summary)
+	for _, s := range secrets {
+		fmt.Printf("  %s: %s\n", s.Kind, maskSecret(prompt[s.Start:s.End]))
+	}
+	answer, err := cb.readLine("Redact before sending? [r=redact/s=send as is/N=don't send]: ")
+	if err != nil {
+		fmt.Println()
+		return "", fmt.Errorf("prompt not sent: it contains %s", summary)
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "r", "redact":
+		cb.logger.Info("secrets redacted from prompt", "found", summary)
+		return guard.Redact(prompt, secrets), nil
+	case "s", "send":
+		cb.logger.Warn("prompt sent with secrets by user choice", "found", summary)
+		cb.mu.Lock()
+		for _, s := range secrets {
+			cb.sentSecrets[prompt[s.Start:s.End]] = true
+		}
+		cb.mu.Unlock()
+		return prompt, nil
+	default:
+		return "", fmt.Errorf("prompt not sent: it contains %s", summary)
+	}
+}
+
+// unsentSecrets returns the secrets in text that must not reach target:
+// none with SecretScan off or for a local backend, and none the user chose
+// to send as is
+func (cb *ChatBot) unsentSecrets(target llmTarget, text string) []guard.Secret {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if !cb.cfg().SecretScan || localBackends[target.Backend] {
+		return nil
+	}
+	var unsent []guard.Secret
+	for _, s := range guard.ScanSecrets(text) {
+		if !cb.sentSecrets[text[s.Start:s.End]] {
+			unsent = append(unsent, s)
+		}
+	}
+	return unsent
+}
+
+// redactFor replaces the secrets in text that must not reach target with
+// markers
+func (cb *ChatBot) redactFor(target llmTarget, text string) string {
+	secrets := cb.unsentSecrets(target, text)
+	if len(secrets) == 0 {
+		return text
+	}
+	cb.logger.Warn("secrets redacted before sending", "backend", target.Backend, "found", secretSummary(secrets))
+	return guard.Redact(text, secrets)
+}
+
+// redactOutgoing redacts everything sent to target: the system prompt with
+// its retrieved passages and every message. messages is copied before a
+// change, as it may be a view of the session.
+func (cb *ChatBot) redactOutgoing(target llmTarget, messages []session.Message) (llmTarget, []session.Message) {
+	target.System = cb.redactFor(target, target.System)
+	copied := false
+	for i, m := range messages {
+		content := cb.redactFor(target, m.Content)
+		if content == m.Content {
+			continue
+		}
+		if !copied {
+			messages = append([]session.Message(nil), messages...)
+			copied = true
+		}
+		messages[i].Content = content
+	}
+	return target, messages
+}
+
+// scansPipeline reports whether what p sends is scanned for secrets: with
+// SecretScan on, unless every step runs on a local backend
+func (cb *ChatBot) scansPipeline(p *pipeline.Pipeline) bool {
+	if !cb.cfg().SecretScan {
+		return false
+	}
+	for _, step := range p.Steps {
+		if target, err := cb.stepTarget(step); err != nil || !localBackends[target.Backend] {
+			return true
+		}
+	}
+	return false
+}
+
+// redactSecrets replaces the secrets in text with markers, for commands
+// that send diffs or files with nobody to ask, and returns what it found,
+// as in secretSummary; empty when there was nothing to replace
+func (cb *ChatBot) redactSecrets(text string) (string, string) {
+	secrets := guard.ScanSecrets(text)
+	if len(secrets) == 0 {
+		return text, ""
+	}
+	summary := secretSummary(secrets)
+	cb.logger.Warn("secrets redacted", "found", summary)
+	return guard.Redact(text, secrets), summary
+}
+
+// secretSummary counts the secrets by kind, as in "2 OpenAI API keys and
+// an AWS access key"
+func secretSummary(secrets []guard.Secret) string {
+	counts := make(map[string]int)
+	for _, s := range secrets {
+		counts[s.Kind]++
+	}
+	kinds := make([]string, 0, len(counts))
+	for kind := range counts {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+
+	parts := make([]string, len(kinds))
+	for i, kind := range kinds {
+		if n := counts[kind]; n > 1 {
+			parts[i] = fmt.Sprintf("%d %ss", n, kind)
+		} else if strings.ContainsRune("AEIOUaeiou", rune(kind[0])) {
+			// The kinds are named so that the first letter picks the article
+			parts[i] = "an " + kind
+		} else {
+			parts[i] = "a " + kind
+		}
+	}
+	if len(parts) == 1 {
+		return parts[0]
+	}
+	return strings.Join(parts[:len(parts)-1], ", ") + " and " + parts[len(parts)-1]
+}
+
+// maskSecret shows enough of a secret to recognize it: its first and last
+// four characters of a single line
+func maskSecret(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if len(s) <= 12 {
+		return strings.Repeat("*", len(s))
+	}
+	return s[:4] + "..." + s[len(s)-4:]
+}
@@ -0,0 +1,102 @@
+package chatbot
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"ExtraChat/internal/config"
+	"ExtraChat/internal/session"
+)
+
+// capturingBackends answers OpenAI and Ollama requests with "ok" and
+// returns what was sent to each, by host
+func capturingBackends() (roundTripFunc, func(host string) string) {
+	var mu sync.Mutex
+	sent := make(map[string]string)
+	transport := func(req *http.Request) (*http.Response, error) {
+		body, _ := io.ReadAll(req.Body)
+		mu.Lock()
+		sent[req.URL.Host] += string(body)
+		mu.Unlock()
+		if req.URL.Host == "openai.test" {
+			return jsonResponse(req, http.StatusOK, `{"choices":[{"message":{"role":"assistant","content":"ok"},"finish_reason":"stop"}]}`), nil
+		}
+		return jsonResponse(req, http.StatusOK, `{"message":{"role":"assistant","content":"ok"},"done":true}`), nil
+	}
+	return transport, func(host string) string {
+		mu.Lock()
+		defer mu.Unlock()
+		return sent[host]
+	}
+}
+
+func TestSecretsRedactedForTheResolvedBackend(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "test")
+	transport, sent := capturingBackends()
+	cb := newTestChatBot(t, Dependencies{Transport: transport})
+	cb.mu.Lock()
+	// The session stays on Ollama; titles and summaries go to OpenAI
+	cb.updateConfig(func(c *config.Config) {
+		c.SecretScan = true
+		c.SummarizerBackend = config.BackendOpenAI
+		c.SummarizerModel = "gpt-4o-mini"
+		c.OpenAIURL = "http://openai.test"
+	})
+	cb.mu.Unlock()
+
+	key := "sk-" + strings.Repeat("x", 24)
+	if _, err := cb.runHousekeeping(context.Background(), "title", "User: my key is "+key); err != nil {
+		t.Fatal(err)
+	}
+	if body := sent("openai.test"); strings.Contains(body, key) || !strings.Contains(body, "[REDACTED OpenAI API key]") {
+		t.Errorf("title prompt sent as %s", body)
+	}
+
+	// Retrieved passages travel in the system prompt
+	openai := llmTarget{Backend: config.BackendOpenAI, Model: "gpt-4o", System: "Passage 1:\n" + key}
+	if _, err := cb.sendToBackend(context.Background(), openai, []session.Message{{Role: "user", Content: "hi"}}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(sent("openai.test"), key) {
+		t.Error("a retrieved secret was sent")
+	}
+
+	// Ollama runs locally, so its prompts are sent unchanged
+	ollama := llmTarget{Backend: config.BackendOllama, Model: "llama3"}
+	if _, err := cb.sendToBackend(context.Background(), ollama, []session.Message{{Role: "user", Content: key}}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(sent("ollama.test"), key) {
+		t.Error("a prompt to a local backend was redacted")
+	}
+}
+
+func TestSecretsSentAsIsByChoice(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "test")
+	transport, sent := capturingBackends()
+	cb := newTestChatBot(t, Dependencies{Transport: transport})
+	cb.mu.Lock()
+	cb.updateConfig(func(c *config.Config) {
+		c.SecretScan = true
+		c.OpenAIURL = "http://openai.test"
+	})
+	kept, other := "sk-"+strings.Repeat("k", 24), "sk-"+strings.Repeat("o", 24)
+	cb.sentSecrets[kept] = true
+	cb.mu.Unlock()
+
+	history := []session.Message{{Role: "user", Content: kept + " " + other}}
+	openai := llmTarget{Backend: config.BackendOpenAI, Model: "gpt-4o"}
+	if _, err := cb.sendToBackend(context.Background(), openai, history); err != nil {
+		t.Fatal(err)
+	}
+	if body := sent("openai.test"); !strings.Contains(body, kept) || strings.Contains(body, other) {
+		t.Errorf("sent %s, want only the chosen secret", body)
+	}
+	if history[0].Content != kept+" "+other {
+		t.Error("redacting changed the caller's messages")
+	}
+}
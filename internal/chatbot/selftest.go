@@ -0,0 +1,214 @@
+package chatbot
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"ExtraChat/internal/config"
+	"ExtraChat/internal/stub"
+)
+
+// selfTestStep is one check of the scripted selftest conversation
+type selfTestStep struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+// selfTest is a chatbot talking to the stub servers, with its database,
+// logs and files in dir. Steps run in order and share its session.
+type selfTest struct {
+	*ChatBot
+	stubs *stub.Server
+	dir   string
+}
+
+// selfTestEnv keeps real API keys from the stubs, which accept any: the
+// environment wins over the config for keys. Git runs without the user's
+// config, which could change the diffs, and commits as selftest.
+var selfTestEnv = map[string]string{
+	"ANTHROPIC_API_KEY": "selftest", "GROK_API_KEY": "selftest", "OPENAI_API_KEY": "selftest",
+	"COHERE_API_KEY": "selftest", "VOYAGE_API_KEY": "selftest",
+	"GIT_CONFIG_GLOBAL": os.DevNull, "GIT_CONFIG_NOSYSTEM": "1",
+	"GIT_AUTHOR_NAME": "selftest", "GIT_AUTHOR_EMAIL": "selftest@example.com",
+	"GIT_COMMITTER_NAME": "selftest", "GIT_COMMITTER_EMAIL": "selftest@example.com",
+}
+
+// RunSelfTest runs a scripted conversation against local stub servers,
+// reporting each step to out. It works in a temporary directory, so the
+// user's database and logs are untouched.
+func RunSelfTest(out io.Writer) error {
+	dir, err := os.MkdirTemp("", "extrachat-selftest-")
+	if err != nil {
+		return fmt.Errorf("failed to create selftest directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	defer setenv(selfTestEnv)()
+
+	stubs, err := stub.Start()
+	if err != nil {
+		return fmt.Errorf("failed to start stub server: %w", err)
+	}
+	defer stubs.Close()
+
+	st, err := newSelfTest(stubs, dir)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	ctx := context.Background()
+	steps := st.steps()
+	failed := 0
+	for _, step := range steps {
+		stepCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		err := step.run(stepCtx)
+		cancel()
+		if err != nil {
+			failed++
+			fmt.Fprintf(out, "FAIL  %s: %v\n", step.name, err)
+			st.logger.Error("selftest step failed", "step", step.name, "error", err)
+			continue
+		}
+		fmt.Fprintf(out, "ok    %s\n", step.name)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d selftest steps failed", failed, len(steps))
+	}
+	fmt.Fprintf(out, "selftest passed (%d steps)\n", len(steps))
+	return nil
+}
+
+// newSelfTest starts a chatbot on every backend and the MCP server of
+// stubs, keeping its files in dir
+func newSelfTest(stubs *stub.Server, dir string) (*selfTest, error) {
+	cfg := config.Default()
+	cfg.DBPath = filepath.Join(dir, config.DefaultDBPath)
+	cfg.LogDir = filepath.Join(dir, config.DefaultLogDir)
+	cfg.SandboxRoot = dir
+	cfg.OllamaModel = stub.Model
+	cfg.OllamaURL = stubs.URL()
+	cfg.AnthropicURL = stubs.URL()
+	cfg.GrokURL = stubs.URL()
+	cfg.OpenAIURL = stubs.URL()
+	cfg.CohereURL = stubs.URL()
+	cfg.VoyageURL = stubs.URL()
+	// The stubs are on loopback, which fetches may not reach by default
+	cfg.FetchAllowPrivate = true
+	cfg.MCPEnabled = true
+	cfg.MCPRemoteServers = []string{stubs.MCPURL()}
+	cfg.ToolAutoApprove = []string{"*"}
+	cfg.ToolTimeout = 10 * time.Second
+	// Exports read tool results back from the audit log
+	cfg.AuditLog = filepath.Join(dir, "audit.jsonl")
+
+	cb, err := NewChatBot(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start chatbot: %w", err)
+	}
+	return &selfTest{ChatBot: cb, stubs: stubs, dir: dir}, nil
+}
+
+// steps lists the checks in the order they run; later ones build on the
+// session and files of earlier ones
+func (st *selfTest) steps() []selfTestStep {
+	return []selfTestStep{
+		{"mcp tool discovery", st.checkToolDiscovery},
+		{"ollama model list", st.checkOllamaModels},
+		{"ollama model pull", st.checkOllamaPull},
+		{"ollama model info and context window", st.checkOllamaInfo},
+		{"remote model lists", st.checkRemoteModels},
+		{"ollama chat", st.checkChat(config.BackendOllama)},
+		{"openai chat", st.checkChat(config.BackendOpenAI)},
+		{"grok chat", st.checkChat(config.BackendGrok)},
+		{"anthropic chat", st.checkChat(config.BackendAnthropic)},
+		{"keep-alive connection reuse", st.checkKeepAlive},
+		{"anthropic tool use over streamed MCP response", st.checkToolUse},
+		{"config reload during a tool-using turn", st.checkReloadDuringTurn},
+		{"streamed replies and tool events", st.checkStreaming},
+		{"stop sequences and stopped replies", st.checkStopSequences},
+		{"mock backend fixtures, failures and tools", st.checkMockBackend},
+		{"recorded and replayed backend traffic", st.checkRecordReplay},
+		{"document ingestion and retrieval", st.checkIngest},
+		{"citations of retrieved chunks", st.checkCitations},
+		{"knowledge collections", st.checkCollections},
+		{"embedding reuse on re-ingest", st.checkEmbeddingReuse},
+		{"re-ranking of retrieved chunks", st.checkRerank},
+		{"web page fetch", st.checkFetch},
+		{"built-in tools within their limits", st.checkNativeTools},
+		{"batch run with resume", st.checkBatchResume},
+		{"batch run through message batches", st.checkMessageBatches},
+		{"pipeline across backends", st.checkPipeline},
+		{"git commit messages and pull request descriptions", st.checkGit},
+		{"code review of files and diffs", st.checkReview},
+		{"scheduled jobs and their sinks", st.checkSchedule},
+		{"eval suite across backends", st.checkEval},
+		{"model routing", st.checkRouting},
+		{"best of n with a judge", st.checkBestOf},
+		{"reply post-processing per persona", st.checkPostProcessing},
+		{"guardrails on prompts and replies", st.checkGuardrails},
+		{"secret scanning of every prompt sent", st.checkSecretScan},
+		{"session persistence", st.checkPersistence},
+		{"paged session loading", st.checkPagedLoading},
+		{"session replay on another backend", st.checkReplay},
+		{"fine-tuning dataset export", st.checkExport},
+		// Last, as the conversation becomes the current session
+		{"multi-agent conversation", st.checkAgents},
+	}
+}
+
+// path returns the path of a selftest file
+func (st *selfTest) path(elem ...string) string {
+	return filepath.Join(append([]string{st.dir}, elem...)...)
+}
+
+// chat switches backend and checks the reply quotes the message back
+func (st *selfTest) chat(ctx context.Context, backendName, message, want string) error {
+	st.mu.Lock()
+	st.session.Backend = backendName
+	st.mu.Unlock()
+
+	reply, err := st.sendMessage(ctx, message)
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(reply, want) {
+		return fmt.Errorf("unexpected reply %q", reply)
+	}
+	return nil
+}
+
+// checkChat greets the stub of a backend
+func (st *selfTest) checkChat(backendName string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		message := "hello " + backendName
+		return st.chat(ctx, backendName, message, message)
+	}
+}
+
+// setenv sets environment variables and returns a function restoring them
+func setenv(vars map[string]string) func() {
+	saved := make(map[string]*string, len(vars))
+	for name, value := range vars {
+		if old, ok := os.LookupEnv(name); ok {
+			saved[name] = &old
+		} else {
+			saved[name] = nil
+		}
+		os.Setenv(name, value)
+	}
+	return func() {
+		for name, old := range saved {
+			if old == nil {
+				os.Unsetenv(name)
+			} else {
+				os.Setenv(name, *old)
+			}
+		}
+	}
+}
@@ -0,0 +1,436 @@
+package chatbot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"ExtraChat/internal/backend"
+	"ExtraChat/internal/config"
+	"ExtraChat/internal/stub"
+	"ExtraChat/internal/vcr"
+)
+
+// checkToolDiscovery finds the stub MCP server's echo tool
+func (st *selfTest) checkToolDiscovery(ctx context.Context) error {
+	tools := st.getMCPTools()
+	if len(tools) != 1 || tools[0].Name != "echo" {
+		return fmt.Errorf("expected the stub echo tool, got %d tools", len(tools))
+	}
+	return nil
+}
+
+// checkOllamaModels lists the stub's Ollama model
+func (st *selfTest) checkOllamaModels(ctx context.Context) error {
+	models, err := st.listOllamaModels(ctx)
+	if err != nil {
+		return err
+	}
+	if len(models) != 1 || models[0].Name != stub.Model {
+		return fmt.Errorf("expected model %s, got %v", stub.Model, models)
+	}
+	return nil
+}
+
+// checkOllamaPull pulls a model with its progress, and fails to pull a missing one
+func (st *selfTest) checkOllamaPull(ctx context.Context) error {
+	var layers, steps int
+	err := st.pullOllamaModel(ctx, "stub:pulled", func(p backend.OllamaPullProgress) {
+		if p.Total > 0 && p.Completed == p.Total {
+			layers++
+		} else if p.Digest == "" {
+			steps++
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if layers != 2 || steps != 4 {
+		return fmt.Errorf("expected 2 layers and 4 steps, got %d and %d", layers, steps)
+	}
+	models, err := st.listOllamaModels(ctx)
+	if err != nil {
+		return err
+	}
+	if len(models) != 2 || models[1].Name != "stub:pulled" {
+		return fmt.Errorf("expected the pulled model to be listed, got %v", models)
+	}
+	if err := st.pullOllamaModel(ctx, "missing:model", func(backend.OllamaPullProgress) {}); err == nil || !strings.Contains(err.Error(), "file does not exist") {
+		return fmt.Errorf("expected the pull of a missing model to fail, got %v", err)
+	}
+	return nil
+}
+
+// checkOllamaInfo reads a model's details and holds attached context to its window
+func (st *selfTest) checkOllamaInfo(ctx context.Context) error {
+	if _, err := st.showOllamaModel(ctx, "stub:unknown"); err == nil {
+		return fmt.Errorf("expected an unknown model to fail")
+	}
+	info, err := st.showOllamaModel(ctx, stub.Model)
+	if err != nil {
+		return err
+	}
+	if info.Details.QuantizationLevel != "Q4_K_M" || info.ContextLength() != 8192 || info.NumCtx() != 4096 {
+		return fmt.Errorf("unexpected model info %+v", info)
+	}
+	// Forget the model again so later steps aren't held to its window
+	defer st.modelInfo.put(stub.Model, backend.OllamaShowResponse{})
+
+	st.mu.Lock()
+	st.session.Backend = config.BackendOllama
+	limit := st.contextLimit()
+	st.updateConfig(func(c *config.Config) { c.OllamaOptions.NumCtx = 16384 })
+	raised := st.contextLimit()
+	st.updateConfig(func(c *config.Config) { c.OllamaOptions.NumCtx = 0 })
+	st.mu.Unlock()
+	if limit != 3072 || raised != 12288 {
+		return fmt.Errorf("expected context limits of 3072 and 12288 tokens, got %d and %d", limit, raised)
+	}
+	if err := st.Attach("big.txt", strings.NewReader(strings.Repeat("word ", 3000))); err == nil {
+		return fmt.Errorf("expected context beyond the model's window to be rejected")
+	}
+	return nil
+}
+
+// checkRemoteModels lists Anthropic models across pages and OpenAI's chat models, then from the cache
+func (st *selfTest) checkRemoteModels(ctx context.Context) error {
+	models, err := st.listModels(ctx, config.BackendAnthropic, true)
+	if err != nil {
+		return err
+	}
+	var ids []string
+	for _, m := range models {
+		ids = append(ids, m.ID)
+	}
+	if want := []string{"claude-stub-1", "claude-stub-2"}; !slices.Equal(ids, want) || !models[0].Chat {
+		return fmt.Errorf("expected the Anthropic models %v across both pages, got %+v", want, models)
+	}
+
+	models, err = st.listModels(ctx, config.BackendOpenAI, true)
+	if err != nil {
+		return err
+	}
+	chat := make(map[string]bool)
+	for _, m := range models {
+		chat[m.ID] = m.Chat
+	}
+	if len(chat) != 3 || !chat["gpt-stub"] || chat["text-embedding-stub"] || chat["whisper-stub"] {
+		return fmt.Errorf("expected only gpt-stub to be a chat model, got %v", chat)
+	}
+	hits := st.stubs.Hits("/v1/models")
+	if _, err := st.listModels(ctx, config.BackendOpenAI, false); err != nil {
+		return err
+	}
+	if st.stubs.Hits("/v1/models") != hits {
+		return fmt.Errorf("expected the cached model list to be reused")
+	}
+	if _, err := st.listModels(ctx, config.BackendMock, false); err == nil {
+		return fmt.Errorf("expected listing the mock backend's models to fail")
+	}
+	return nil
+}
+
+// checkKeepAlive checks consecutive turns reuse a kept-alive connection
+func (st *selfTest) checkKeepAlive(ctx context.Context) error {
+	pool := st.httpPools[config.BackendOllama]
+	reused := pool.reused.Load()
+	for i := range 3 {
+		message := fmt.Sprintf("reuse %d", i)
+		if err := st.chat(ctx, config.BackendOllama, message, message); err != nil {
+			return err
+		}
+	}
+	if pool.reused.Load() < reused+2 {
+		return fmt.Errorf("expected the turns to reuse a connection, %d of 3 did", pool.reused.Load()-reused)
+	}
+	return nil
+}
+
+// checkToolUse runs an Anthropic turn that calls the stub's tool, answered over SSE
+func (st *selfTest) checkToolUse(ctx context.Context) error {
+	if err := st.chat(ctx, config.BackendAnthropic, "please use a tool", "echo: please use a tool"); err != nil {
+		return err
+	}
+	if st.stubs.Hits("tools/call") != 1 {
+		return fmt.Errorf("expected 1 MCP tool call, got %d", st.stubs.Hits("tools/call"))
+	}
+	return nil
+}
+
+// checkReloadDuringTurn replaces the config while a turn calls a tool
+func (st *selfTest) checkReloadDuringTurn(ctx context.Context) error {
+	// The turn reads the API key, tool policies and timeouts while
+	// the config is replaced; a race build catches unguarded reads
+	st.SetConfigLoader(func() (config.Config, error) {
+		next := *st.cfg()
+		next.ToolTimeout = 20 * time.Second
+		return next, nil
+	})
+	defer st.SetConfigLoader(nil)
+	reloaded := make(chan struct{})
+	go func() {
+		defer close(reloaded)
+		st.reloadConfig("selftest")
+	}()
+	err := st.chat(ctx, config.BackendAnthropic, "please use a tool again", "echo: please use a tool again")
+	<-reloaded
+	if err != nil {
+		return err
+	}
+	if st.cfg().ToolTimeout != 20*time.Second {
+		return fmt.Errorf("expected the reloaded tool timeout, got %s", st.cfg().ToolTimeout)
+	}
+	return nil
+}
+
+// checkStreaming checks each backend's streamed tokens add up to its reply, and the tool events of a turn
+func (st *selfTest) checkStreaming(ctx context.Context) error {
+	var mu sync.Mutex
+	var tokens strings.Builder
+	var tools []string
+	ctx = withTurnEvents(ctx, func(event turnEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		if event.Type == "token" {
+			tokens.WriteString(event.Text)
+		} else {
+			tools = append(tools, event.Type+" "+event.Tool)
+		}
+	})
+
+	// The streamed tokens must add up to the reply
+	for _, backendName := range config.Backends {
+		tokens.Reset()
+		st.mu.Lock()
+		st.session.Backend = backendName
+		st.mu.Unlock()
+		reply, err := st.sendMessage(ctx, "stream "+backendName)
+		if err != nil {
+			return fmt.Errorf("%s: %w", backendName, err)
+		}
+		if !strings.Contains(reply, "stream "+backendName) || tokens.String() != reply {
+			return fmt.Errorf("%s: streamed %q for reply %q", backendName, tokens.String(), reply)
+		}
+	}
+	if err := st.chat(ctx, config.BackendAnthropic, "stream a tool call", "echo: stream a tool call"); err != nil {
+		return err
+	}
+	if want := []string{"tool_call echo", "tool_result echo"}; !slices.Equal(tools, want) {
+		return fmt.Errorf("expected tool events %v, got %v", want, tools)
+	}
+	return nil
+}
+
+// checkStopSequences ends replies at stop sequences, and keeps a reply stopped mid-stream
+func (st *selfTest) checkStopSequences(ctx context.Context) error {
+	st.mu.Lock()
+	st.updateConfig(func(c *config.Config) { c.StopSequences = []string{" cut"} })
+	st.mu.Unlock()
+	defer func() {
+		st.mu.Lock()
+		st.updateConfig(func(c *config.Config) { c.StopSequences = nil })
+		st.mu.Unlock()
+	}()
+
+	// Every backend ends the reply at the configured sequence,
+	// unless the request brings its own
+	for _, backendName := range append(slices.Clone(config.Backends), config.BackendMock) {
+		if err := st.chat(ctx, backendName, "keep cut drop", "keep"); err != nil {
+			return fmt.Errorf("%s: %w", backendName, err)
+		}
+		st.mu.Lock()
+		reply := st.session.Messages[len(st.session.Messages)-1].Content
+		st.mu.Unlock()
+		if strings.Contains(reply, "drop") {
+			return fmt.Errorf("%s: reply %q goes past the stop sequence", backendName, reply)
+		}
+	}
+	reply, err := st.sendMessage(withStopSequences(ctx, []string{" drop"}), "keep cut drop")
+	if err != nil {
+		return err
+	}
+	if !strings.HasSuffix(reply, "keep cut") {
+		return fmt.Errorf("expected the request's stop sequence to apply, got %q", reply)
+	}
+
+	// A reply stopped mid-stream keeps what was streamed, marked
+	// as truncated; stopped before any token, the turn is cancelled
+	turnCtx, stop := context.WithCancelCause(ctx)
+	defer stop(nil)
+	var streamed int
+	turnCtx = withTurnEvents(turnCtx, func(event turnEvent) {
+		if streamed++; streamed == 2 {
+			stop(errStopped)
+		}
+	})
+	st.mu.Lock()
+	st.session.Backend = config.BackendMock
+	st.mu.Unlock()
+	reply, err = st.sendMessage(turnCtx, "one two three four five")
+	if !errors.Is(err, errStopped) || !strings.HasSuffix(reply, ": one ") {
+		return fmt.Errorf("expected the reply stopped after its first word, got %q, %v", reply, err)
+	}
+	st.mu.Lock()
+	last := st.session.Messages[len(st.session.Messages)-1]
+	st.mu.Unlock()
+	if !last.Truncated || last.Content != reply {
+		return fmt.Errorf("expected the partial reply kept as truncated, got %+v", last)
+	}
+	stopped, cancel := context.WithCancelCause(ctx)
+	cancel(errStopped)
+	if _, err := st.sendMessage(withTurnEvents(stopped, func(turnEvent) {}), "nothing yet"); errors.Is(err, errStopped) {
+		return fmt.Errorf("expected a turn stopped before its reply to be cancelled, got %v", err)
+	}
+	return nil
+}
+
+// checkMockBackend answers from the mock backend's rules and script, and fails as told
+func (st *selfTest) checkMockBackend(ctx context.Context) error {
+	fixtures := `rules:
+  - match: ^fail
+    error: overloaded
+    status: 429
+  - match: ^look up
+    tool: echo
+    arguments: {text: "{{.prompt}}"}
+    reply: "found {{.result}}"
+  - match: ^count
+    replies: [one, two]
+script: [first scripted, second scripted]
+default: done
+`
+	if err := os.WriteFile(st.path("mock.yaml"), []byte(fixtures), 0o644); err != nil {
+		return err
+	}
+	st.mu.Lock()
+	st.updateConfig(func(c *config.Config) { c.MockFixtures = st.path("mock.yaml") })
+	st.mu.Unlock()
+	defer func() {
+		st.mu.Lock()
+		st.updateConfig(func(c *config.Config) { c.MockFixtures, c.MockErrorPercent = "", 0 })
+		st.mu.Unlock()
+	}()
+
+	// Rules answer in turn, the script in order, then the default
+	for _, c := range [][2]string{
+		{"count", "one"}, {"count", "two"}, {"count", "two"},
+		{"hi", "first scripted"}, {"hi", "second scripted"}, {"hi", "done"},
+	} {
+		if err := st.chat(ctx, config.BackendMock, c[0], c[1]); err != nil {
+			return fmt.Errorf("%s: %w", c[0], err)
+		}
+	}
+	calls := st.stubs.Hits("tools/call")
+	if err := st.chat(ctx, config.BackendMock, "look up tides", "found echo: look up tides"); err != nil {
+		return err
+	}
+	if st.stubs.Hits("tools/call") != calls+1 {
+		return fmt.Errorf("expected the mock backend to call the echo tool")
+	}
+
+	// Scripted and injected failures look like API errors
+	if _, err := st.sendMessage(ctx, "fail now"); classifyOutcome(err) != outcomeRateLimited {
+		return fmt.Errorf("expected a rate limit error, got %v", err)
+	}
+	st.mu.Lock()
+	st.updateConfig(func(c *config.Config) { c.MockErrorPercent = 100 })
+	st.mu.Unlock()
+	_, err := st.sendMessage(ctx, "hi")
+	var apiErr *apiError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusServiceUnavailable {
+		return fmt.Errorf("expected an injected 503, got %v", err)
+	}
+	return nil
+}
+
+// checkRecordReplay records turns on each backend and replays them without the stubs
+func (st *selfTest) checkRecordReplay(ctx context.Context) error {
+	backends := []string{config.BackendOllama, config.BackendAnthropic, config.BackendGrok, config.BackendOpenAI}
+	st.mu.Lock()
+	saved, current := st.cfg(), st.session
+	transports := make(map[string]http.RoundTripper)
+	for name, pool := range st.httpPools {
+		transports[name] = pool.base
+	}
+	st.updateConfig(func(c *config.Config) { c.CacheEnabled = false }) // Every turn must reach the transport
+	st.mu.Unlock()
+	defer func() {
+		// The turns are saved in the background; finish before the next step writes
+		st.turnJobs.Wait()
+		st.mu.Lock()
+		st.config.Store(saved)
+		st.session = current
+		for name, pool := range st.httpPools {
+			pool.base = transports[name]
+		}
+		st.mu.Unlock()
+	}()
+
+	// converse runs the same turns in a new session through a recorder
+	converse := func(mode string) ([]string, error) {
+		recorder, err := vcr.New(mode, st.path("cassettes"), nil, []string{"selftest"})
+		if err != nil {
+			return nil, err
+		}
+		st.mu.Lock()
+		for name, pool := range st.httpPools {
+			pool.base = recorder.Wrap(transports[name])
+		}
+		st.session = st.newSession()
+		st.mu.Unlock()
+		var replies []string
+		for _, backendName := range backends {
+			st.mu.Lock()
+			st.session.Backend = backendName
+			st.mu.Unlock()
+			reply, err := st.sendMessage(ctx, "record "+backendName)
+			if err != nil {
+				return nil, fmt.Errorf("%s %s: %w", mode, backendName, err)
+			}
+			replies = append(replies, reply)
+		}
+		return replies, nil
+	}
+	recorded, err := converse(vcr.ModeRecord)
+	if err != nil {
+		return err
+	}
+
+	// Nothing may reach the stubs while replaying
+	st.mu.Lock()
+	st.cfg().OllamaURL, st.cfg().AnthropicURL, st.cfg().GrokURL, st.cfg().OpenAIURL =
+		"http://127.0.0.1:9", "http://127.0.0.1:9", "http://127.0.0.1:9", "http://127.0.0.1:9"
+	st.mu.Unlock()
+	replayed, err := converse(vcr.ModeReplay)
+	if err != nil {
+		return err
+	}
+	if !slices.Equal(recorded, replayed) {
+		return fmt.Errorf("replayed %q, recorded %q", replayed, recorded)
+	}
+
+	cassettes, err := filepath.Glob(st.path("cassettes", "*.json"))
+	if err != nil {
+		return err
+	}
+	if len(cassettes) != len(backends) {
+		return fmt.Errorf("expected %d cassettes, got %d", len(backends), len(cassettes))
+	}
+	for _, path := range cassettes {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if strings.Contains(string(data), "selftest") {
+			return fmt.Errorf("cassette %s contains the API key", path)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,363 @@
+package chatbot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"ExtraChat/internal/config"
+	"ExtraChat/internal/eval"
+	"ExtraChat/internal/pipeline"
+	"ExtraChat/internal/review"
+	"ExtraChat/internal/stub"
+)
+
+// checkBatchResume resumes a batch run cut short, keeping the results written before
+func (st *selfTest) checkBatchResume(ctx context.Context) error {
+	prompts := `{"id":"a","prompt":"first batch prompt"}` + "\n" +
+		`{"id":"b","prompt":"second batch prompt"}` + "\n" +
+		`{"prompt":"third batch prompt","system":"Answer briefly."}` + "\n"
+	if err := os.WriteFile(st.path("prompts.jsonl"), []byte(prompts), 0o644); err != nil {
+		return err
+	}
+	// A result from an earlier run, then one cut short by a crash
+	earlier := `{"id":"a","response":"done before"}` + "\n" + `{"id":"b","resp`
+	if err := os.WriteFile(st.path("results.jsonl"), []byte(earlier), 0o644); err != nil {
+		return err
+	}
+	opts := BatchOptions{In: st.path("prompts.jsonl"), Out: st.path("results.jsonl"), Concurrency: 2, Retries: 1}
+	if err := st.Batch(ctx, io.Discard, opts); err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(opts.Out)
+	if err != nil {
+		return err
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	var ids []string
+	for _, line := range lines {
+		var r batchResult
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			return fmt.Errorf("unreadable result %q: %w", line, err)
+		}
+		if r.ID != "a" && !strings.Contains(r.Response, "batch prompt") {
+			return fmt.Errorf("unexpected response for %s: %q", r.ID, r.Response)
+		}
+		ids = append(ids, r.ID)
+	}
+	slices.Sort(ids)
+	if want := []string{"a", "b", "line-3"}; !slices.Equal(ids, want) {
+		return fmt.Errorf("expected results for %v, got %v", want, ids)
+	}
+	return nil
+}
+
+// checkMessageBatches runs a batch through Anthropic's Message Batches API
+func (st *selfTest) checkMessageBatches(ctx context.Context) error {
+	prompts := `{"id":"ok","prompt":"a batched prompt"}` + "\n" +
+		`{"id":"bad","prompt":"a batch-error prompt"}` + "\n"
+	if err := os.WriteFile(st.path("mb-prompts.jsonl"), []byte(prompts), 0o644); err != nil {
+		return err
+	}
+	st.mu.Lock()
+	st.session.Backend = config.BackendAnthropic
+	st.mu.Unlock()
+	opts := BatchOptions{In: st.path("mb-prompts.jsonl"), Out: st.path("mb-results.jsonl"), Concurrency: 1, Retries: 1,
+		MessageBatches: true, PollInterval: 10 * time.Millisecond}
+	if err := st.Batch(ctx, io.Discard, opts); err == nil || !strings.Contains(err.Error(), "1 of 2 prompts failed") {
+		return fmt.Errorf("expected one failed prompt, got %v", err)
+	}
+	if _, err := os.Stat(messageBatchStatePath(opts.Out)); !os.IsNotExist(err) {
+		return fmt.Errorf("batch state left behind after the batch ended: %v", err)
+	}
+
+	data, err := os.ReadFile(opts.Out)
+	if err != nil {
+		return err
+	}
+	results := make(map[string]batchResult)
+	for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+		var r batchResult
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			return fmt.Errorf("unreadable result %q: %w", line, err)
+		}
+		results[r.ID] = r
+	}
+	if r := results["ok"]; !strings.Contains(r.Response, "a batched prompt") || r.Usage.CompletionTokens != 5 {
+		return fmt.Errorf("unexpected result for the batched prompt: %+v", r)
+	}
+	if r := results["bad"]; !strings.Contains(r.Error, "stub rejects this prompt") {
+		return fmt.Errorf("expected an errored result, got %+v", r)
+	}
+	return nil
+}
+
+// checkPipeline runs a two-step pipeline on two backends
+func (st *selfTest) checkPipeline(ctx context.Context) error {
+	definition := "steps:\n" +
+		"  - name: outline\n    backend: anthropic\n    prompt: Outline a talk about {{.topic}}.\n" +
+		"  - name: draft\n    backend: openai\n    prompt: \"Expand: {{.outline}}\"\n"
+	if err := os.WriteFile(st.path("pipeline.yaml"), []byte(definition), 0o644); err != nil {
+		return err
+	}
+	p, err := pipeline.Load(st.path("pipeline.yaml"))
+	if err != nil {
+		return err
+	}
+	if err := st.RunPipeline(ctx, io.Discard, io.Discard, p, nil); !errors.Is(err, pipeline.ErrMissingVar) {
+		return fmt.Errorf("expected a missing variable error, got %v", err)
+	}
+
+	var out strings.Builder
+	if err := st.RunPipeline(ctx, &out, io.Discard, p, map[string]string{"topic": "tides"}); err != nil {
+		return err
+	}
+	// The draft step quotes the outline step's reply, which quotes its prompt
+	if !strings.Contains(out.String(), "Expand: ") || !strings.Contains(out.String(), "Outline a talk about tides.") {
+		return fmt.Errorf("unexpected pipeline output %q", out.String())
+	}
+	return nil
+}
+
+// checkGit writes a commit message of staged changes and a pull request description of a branch
+func (st *selfTest) checkGit(ctx context.Context) error {
+	if _, err := exec.LookPath("git"); err != nil {
+		return nil // Nothing to check without git
+	}
+	// A repository of its own; selfTestEnv keeps the user's git config out
+	repo := st.path("repo")
+	git := func(args ...string) (string, error) {
+		out, err := exec.Command("git", append([]string{"-C", repo}, args...)...).CombinedOutput()
+		if err != nil {
+			return "", fmt.Errorf("git %s: %w: %s", args[0], err, out)
+		}
+		return string(out), nil
+	}
+	if err := os.MkdirAll(repo, 0o755); err != nil {
+		return err
+	}
+	if _, err := git("init", "--quiet", "--initial-branch=main"); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(repo, "tides.txt"), []byte("high\n"), 0o644); err != nil {
+		return err
+	}
+	if _, err := git("add", "tides.txt"); err != nil {
+		return err
+	}
+	st.mu.Lock()
+	st.session.Backend = config.BackendOllama
+	st.mu.Unlock()
+
+	// The stub quotes the prompt back as the message
+	var out strings.Builder
+	opts := GitOptions{Mode: GitCommitMsg, Dir: repo, Hint: "tide tables", Apply: true}
+	if err := st.RunGit(ctx, &out, io.Discard, opts); err != nil {
+		return err
+	}
+	if !strings.Contains(out.String(), "Conventional Commits") || !strings.Contains(out.String(), "About the change: tide tables") ||
+		!strings.Contains(out.String(), "+high") {
+		return fmt.Errorf("unexpected commit message %q", out.String())
+	}
+	if log, err := git("log", "--format=%B"); err != nil || !strings.Contains(log, "+high") {
+		return fmt.Errorf("expected a commit with the message, got %q (%v)", log, err)
+	}
+	if err := st.RunGit(ctx, io.Discard, io.Discard, opts); err == nil || !strings.Contains(err.Error(), "nothing is staged") {
+		return fmt.Errorf("expected nothing staged, got %v", err)
+	}
+
+	if _, err := git("checkout", "--quiet", "-b", "neap"); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(repo, "tides.txt"), []byte("high\nlow\n"), 0o644); err != nil {
+		return err
+	}
+	if _, err := git("commit", "--quiet", "-am", "add low tide"); err != nil {
+		return err
+	}
+	out.Reset()
+	if err := st.RunGit(ctx, &out, io.Discard, GitOptions{Mode: GitPRDesc, Dir: repo}); err != nil {
+		return err
+	}
+	if !strings.Contains(out.String(), "Branch: neap into main") || !strings.Contains(out.String(), "- add low tide") ||
+		!strings.Contains(out.String(), "+low") || strings.Contains(out.String(), "+high") {
+		return fmt.Errorf("unexpected pull request description %q", out.String())
+	}
+	return nil
+}
+
+// checkReview reviews files and a diff, as text and as a JSON record
+func (st *selfTest) checkReview(ctx context.Context) error {
+	if err := os.MkdirAll(st.path("src"), 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(st.path("src", "tides.go"), []byte("package tides\n\nconst High = 2\n"), 0o644); err != nil {
+		return err
+	}
+	// The stub quotes the prompt back, so the prompt is the reply
+	definition := "steps:\n" +
+		"  - name: findings\n" +
+		"    prompt: '[{\"line\": 3, \"severity\": \"Warning\", \"message\": \"{{.kind}} {{.lines}}\", \"suggestion\": \"name it\"}," +
+		" {\"line\": 99, \"severity\": \"odd\", \"message\": \"whole file\"}]'\n" +
+		"    post: [extract_json]\n"
+	if err := os.WriteFile(st.path("review.yaml"), []byte(definition), 0o644); err != nil {
+		return err
+	}
+	st.mu.Lock()
+	st.session.Backend = config.BackendOllama
+	st.mu.Unlock()
+
+	var out strings.Builder
+	opts := ReviewOptions{Paths: []string{st.path("src")}, Pipeline: st.path("review.yaml"), ChunkLines: 2, Concurrency: 2, FailOn: review.SeverityWarning}
+	err := st.RunReview(ctx, &out, io.Discard, opts)
+	if err == nil || !strings.Contains(err.Error(), "at or above warning") {
+		return fmt.Errorf("expected --fail-on to fail the review, got %v", err)
+	}
+	// Line 3 is in the second chunk only; the first's finding of it
+	// and both chunks' line 99 are kept for the whole file
+	report := out.String()
+	if !strings.HasPrefix(report, st.path("src", "tides.go")+"\n") || !strings.Contains(report, "  3         warning  file 3-3\n") ||
+		!strings.Contains(report, "> name it") || strings.Count(report, " info ") != 2 ||
+		!strings.Contains(report, "4 findings in 1 files (0 error, 2 warning, 2 info) from 2 chunks") {
+		return fmt.Errorf("unexpected review report %q", report)
+	}
+
+	diff := "diff --git a/tides.go b/tides.go\n--- a/tides.go\n+++ b/tides.go\n" +
+		"@@ -2,2 +2,2 @@\n \n-const High = 1\n+const High = 2\n"
+	st.mu.Lock()
+	output := st.cfg().Output
+	st.updateConfig(func(c *config.Config) { c.Output = config.OutputJSON })
+	st.mu.Unlock()
+	defer func() {
+		st.mu.Lock()
+		st.updateConfig(func(c *config.Config) { c.Output = output })
+		st.mu.Unlock()
+	}()
+	out.Reset()
+	opts = ReviewOptions{Paths: []string{"-"}, Stdin: strings.NewReader(diff), Pipeline: st.path("review.yaml"), ChunkLines: 100, Concurrency: 1}
+	if err := st.RunReview(ctx, &out, io.Discard, opts); err != nil {
+		return err
+	}
+	var record reviewRecord
+	if err := json.Unmarshal([]byte(out.String()), &record); err != nil {
+		return fmt.Errorf("review record: %w", err)
+	}
+	if len(record.Files) != 1 || len(record.Files[0].Findings) != 2 || record.Files[0].Findings[1].Message != "diff 2-3" ||
+		record.Counts[review.SeverityWarning] != 1 || record.Usage.Requests != 1 {
+		return fmt.Errorf("unexpected review record %s", out.String())
+	}
+	return nil
+}
+
+// checkSchedule runs scheduled jobs from a config file and delivers to a file and a webhook
+func (st *selfTest) checkSchedule(ctx context.Context) error {
+	var posted []string
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct{ Text, Job string }
+		json.NewDecoder(r.Body).Decode(&payload)
+		posted = append(posted, payload.Job+": "+payload.Text)
+	}))
+	defer webhook.Close()
+	definition := "schedule:\n" +
+		"  sinks:\n" +
+		"    notes: {file: notes/standup.md}\n" +
+		"    chat: {webhook: " + webhook.URL + "}\n" +
+		"  jobs:\n" +
+		"    - \"0 9 * * 1-5 pipeline:pipeline.yaml -> notes, chat\"\n" +
+		"    - name: reminder\n" +
+		"      cron: \"@weekly\"\n" +
+		"      prompt: \"Remind me on {{.weekday}} {{.date}} about {{.topic}}\"\n" +
+		"      vars: {topic: tides}\n" +
+		"      backend: mock\n" +
+		"      sinks: [notes]\n"
+	if err := os.WriteFile(st.path("schedule.yaml"), []byte(definition), 0o644); err != nil {
+		return err
+	}
+	loaded, err := config.LoadFile(config.Default(), st.path("schedule.yaml"))
+	if err != nil {
+		return err
+	}
+	jobs := loaded.Schedule
+	if len(jobs) != 2 || jobs[0].Name != "job 1" || jobs[0].Cron != "0 9 * * 1-5" || !slices.Equal(jobs[0].Sinks, []string{"notes", "chat"}) {
+		return fmt.Errorf("unexpected scheduled jobs %+v", jobs)
+	}
+	friday := time.Date(2026, 10, 16, 9, 0, 0, 0, time.Local)
+
+	// The pipeline needs a topic the job doesn't set, so it fails
+	// and delivers nothing
+	if err := st.runScheduledJob(ctx, jobs[0], loaded.Sinks, friday); !errors.Is(err, pipeline.ErrMissingVar) || len(posted) > 0 {
+		return fmt.Errorf("expected a missing variable error and no delivery, got %v", err)
+	}
+	jobs[0].Vars = map[string]string{"topic": "tides"}
+	if err := st.runScheduledJob(ctx, jobs[0], loaded.Sinks, friday); err != nil {
+		return err
+	}
+	if len(posted) != 1 || !strings.HasPrefix(posted[0], "job 1: ") || !strings.Contains(posted[0], "Outline a talk about tides.") {
+		return fmt.Errorf("unexpected webhook deliveries %q", posted)
+	}
+	if err := st.runScheduledJob(ctx, jobs[1], loaded.Sinks, friday); err != nil {
+		return err
+	}
+	notes, err := os.ReadFile(st.path("notes", "standup.md"))
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(string(notes), "## job 1, 2026-10-16 09:00") || !strings.Contains(string(notes), "Remind me on Friday 2026-10-16 about tides") {
+		return fmt.Errorf("unexpected file deliveries %q", notes)
+	}
+
+	jobs[1].Sinks = []string{"missing"}
+	if err := st.runScheduledJob(ctx, jobs[1], loaded.Sinks, friday); err == nil {
+		return fmt.Errorf("expected an unknown sink to fail the delivery")
+	}
+	return nil
+}
+
+// checkEval runs an eval suite with a judge on two backends
+func (st *selfTest) checkEval(ctx context.Context) error {
+	definition := "judge: ollama\ncases:\n" +
+		"  - name: json\n    prompt: 'Reply with {\"answer\": 42}'\n    assert:\n" +
+		"      - json_schema: {type: object, required: [answer], properties: {answer: {type: integer, maximum: 50}}}\n" +
+		"      - rubric: A correct reply scores 10\n" +
+		"  - name: model\n    prompt: Name your model\n    assert:\n" +
+		"      - contains: stub(gpt\n      - regex: (?i)ollama\n        not: true\n"
+	if err := os.WriteFile(st.path("suite.yaml"), []byte(definition), 0o644); err != nil {
+		return err
+	}
+	suite, err := eval.Load(st.path("suite.yaml"))
+	if err != nil {
+		return err
+	}
+	record, err := st.runEval(ctx, io.Discard, suite, []string{config.BackendOllama, config.BackendOpenAI})
+	if err != nil {
+		return err
+	}
+	// The stubs quote the prompt, and the judge's reply quotes the rubric's score
+	if record.Passed != 3 || record.Failed != 1 {
+		return fmt.Errorf("expected 3 passed and 1 failed case, got %d and %d", record.Passed, record.Failed)
+	}
+	failed := record.Targets[0].Cases[1]
+	if failed.Passed || failed.Score != 0.5 {
+		return fmt.Errorf("expected the model case to fail on ollama with half the score, got %+v", failed)
+	}
+	if got := record.Targets[1].Cases[0].Results[1].Detail; !strings.HasPrefix(got, "scored 10/10") {
+		return fmt.Errorf("unexpected rubric result %q", got)
+	}
+	var report strings.Builder
+	writeEvalReport(&report, record)
+	if !strings.Contains(report.String(), "| ollama "+stub.Model+" | 1/2 | 75% |") {
+		return fmt.Errorf("unexpected report %q", report.String())
+	}
+	return nil
+}
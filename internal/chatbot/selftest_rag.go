@@ -0,0 +1,302 @@
+package chatbot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"ExtraChat/internal/config"
+	"ExtraChat/internal/mcp"
+	"ExtraChat/internal/native"
+	"ExtraChat/internal/rag"
+	"ExtraChat/internal/web"
+)
+
+// checkIngest ingests documents, retrieves the best match first and skips unchanged ones
+func (st *selfTest) checkIngest(ctx context.Context) error {
+	docs := map[string]string{
+		"lighthouse.md": "The lighthouse keeper climbs the tower every evening to light the lamp.",
+		"bakery.md":     "The bakery opens at dawn and sells rye bread and cinnamon rolls.",
+	}
+	if err := os.MkdirAll(st.path("docs"), 0o755); err != nil {
+		return err
+	}
+	for name, text := range docs {
+		if err := os.WriteFile(st.path("docs", name), []byte(text), 0o644); err != nil {
+			return err
+		}
+	}
+	if err := st.Ingest(ctx, io.Discard, []string{st.path("docs")}, ""); err != nil {
+		return err
+	}
+
+	_, matches, err := st.retrieve(ctx, "when does the keeper light the lamp?", rag.Scope{})
+	if err != nil {
+		return err
+	}
+	if len(matches) != 2 || filepath.Base(matches[0].Path) != "lighthouse.md" {
+		return fmt.Errorf("expected lighthouse.md first, got %v", matches)
+	}
+
+	// Ingesting again leaves unchanged documents alone
+	var report strings.Builder
+	if err := st.Ingest(ctx, &report, []string{st.path("docs", "*.md")}, ""); err != nil {
+		return err
+	}
+	if !strings.Contains(report.String(), "0 ingested (0 chunks, 0 embedded, 0 reused), 2 unchanged") {
+		return fmt.Errorf("unexpected report on re-ingest: %q", report.String())
+	}
+	return nil
+}
+
+// checkCitations lists the retrieved chunks a reply cites under it
+func (st *selfTest) checkCitations(ctx context.Context) error {
+	st.mu.Lock()
+	st.updateConfig(func(c *config.Config) { c.RAGEnabled = true })
+	st.session.Backend = config.BackendOllama
+	st.mu.Unlock()
+	defer func() {
+		st.mu.Lock()
+		st.updateConfig(func(c *config.Config) { c.RAGEnabled = false })
+		st.mu.Unlock()
+	}()
+
+	// The stub quotes the message, so the reply cites excerpt 1
+	reply, err := st.sendMessage(ctx, "the keeper lights the lamp every evening [1]")
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(reply, "\n\nSources:\n[1] ") || !strings.Contains(reply, "lighthouse.md, part 1 (characters 0-") {
+		return fmt.Errorf("expected a source list citing lighthouse.md, got %q", reply)
+	}
+
+	st.mu.Lock()
+	last := st.session.Messages[len(st.session.Messages)-1]
+	st.mu.Unlock()
+	if len(last.Citations) != 1 || last.Citations[0].N != 1 || last.Citations[0].End == 0 {
+		return fmt.Errorf("expected one citation with offsets, got %+v", last.Citations)
+	}
+	return nil
+}
+
+// checkCollections keeps retrieval in a collection to its documents
+func (st *selfTest) checkCollections(ctx context.Context) error {
+	store := rag.NewStore(st.db)
+	if err := store.CreateCollection(ctx, "bakery"); err != nil {
+		return err
+	}
+	if err := st.Ingest(ctx, io.Discard, []string{st.path("docs", "bakery.md")}, "bakery"); err != nil {
+		return err
+	}
+
+	// A collection only searches its own documents
+	_, matches, err := st.retrieve(ctx, "when does the keeper light the lamp?", rag.Scope{Collection: "bakery"})
+	if err != nil {
+		return err
+	}
+	if len(matches) != 1 || filepath.Base(matches[0].Path) != "bakery.md" {
+		return fmt.Errorf("expected only bakery.md, got %v", matches)
+	}
+
+	deleted, err := store.DeleteCollection(ctx, "bakery")
+	if err != nil {
+		return err
+	}
+	if collections, err := store.Collections(ctx); err != nil || len(collections) != 0 || deleted != 1 {
+		return fmt.Errorf("expected the collection and its document deleted, got %d deleted and %v (%v)", deleted, collections, err)
+	}
+	return nil
+}
+
+// checkEmbeddingReuse embeds only the new chunks of an edited document
+func (st *selfTest) checkEmbeddingReuse(ctx context.Context) error {
+	// Small chunks, so each paragraph is one
+	st.mu.Lock()
+	size, overlap := st.cfg().ChunkSize, st.cfg().ChunkOverlap
+	st.updateConfig(func(c *config.Config) { c.ChunkSize, c.ChunkOverlap = 80, 0 })
+	st.mu.Unlock()
+	defer func() {
+		st.mu.Lock()
+		st.updateConfig(func(c *config.Config) { c.ChunkSize, c.ChunkOverlap = size, overlap })
+		st.mu.Unlock()
+	}()
+
+	path := st.path("docs", "ferry.md")
+	text := "The ferry leaves the harbor at nine every morning.\n\nTickets are sold on board and at the pier kiosk."
+	if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+		return err
+	}
+	if err := st.Ingest(ctx, io.Discard, []string{path}, ""); err != nil {
+		return err
+	}
+
+	// Only the new paragraph of the edited document is embedded
+	text += "\n\nIn winter the last crossing is at four in the afternoon."
+	if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+		return err
+	}
+	var report strings.Builder
+	if err := st.Ingest(ctx, &report, []string{path}, ""); err != nil {
+		return err
+	}
+	if !strings.Contains(report.String(), "1 ingested (3 chunks, 1 embedded, 2 reused)") {
+		return fmt.Errorf("unexpected report on re-ingest: %q", report.String())
+	}
+	return nil
+}
+
+// checkRerank re-ranks with Cohere, then a collection's own Voyage and LLM rerankers
+func (st *selfTest) checkRerank(ctx context.Context) error {
+	store := rag.NewStore(st.db)
+	if err := store.CreateCollection(ctx, "harbor"); err != nil {
+		return err
+	}
+	if err := st.Ingest(ctx, io.Discard, []string{st.path("docs")}, "harbor"); err != nil {
+		return err
+	}
+	st.mu.Lock()
+	st.updateConfig(func(c *config.Config) { c.Rerank = config.RerankCohere })
+	st.mu.Unlock()
+	defer func() {
+		st.mu.Lock()
+		st.updateConfig(func(c *config.Config) { c.Rerank = config.RerankOff })
+		st.mu.Unlock()
+	}()
+
+	query := "who sells rye bread at dawn?"
+	_, matches, err := st.retrieve(ctx, query, rag.Scope{})
+	if err != nil {
+		return err
+	}
+	if st.stubs.Hits("/v2/rerank") != 1 || len(matches) == 0 || filepath.Base(matches[0].Path) != "bakery.md" {
+		return fmt.Errorf("expected Cohere to rank bakery.md first, got %d requests and %v", st.stubs.Hits("/v2/rerank"), matches)
+	}
+
+	// A collection's own reranker wins over the configured one
+	if err := store.SetCollectionRerank(ctx, "harbor", config.RerankVoyage); err != nil {
+		return err
+	}
+	if _, _, err := st.retrieve(ctx, query, rag.Scope{Collection: "harbor"}); err != nil {
+		return err
+	}
+	if st.stubs.Hits("/v1/rerank") != 1 || st.stubs.Hits("/v2/rerank") != 1 {
+		return fmt.Errorf("expected the collection to use Voyage, got %d Voyage and %d Cohere requests", st.stubs.Hits("/v1/rerank"), st.stubs.Hits("/v2/rerank"))
+	}
+
+	// The stub LLM echoes instead of scoring, so the vector order stays
+	if err := store.SetCollectionRerank(ctx, "harbor", config.RerankLLM); err != nil {
+		return err
+	}
+	chats := st.stubs.Hits("/api/chat")
+	_, matches, err = st.retrieve(ctx, query, rag.Scope{Collection: "harbor"})
+	if err != nil {
+		return err
+	}
+	if st.stubs.Hits("/api/chat") != chats+1 || len(matches) == 0 || filepath.Base(matches[0].Path) != "bakery.md" {
+		return fmt.Errorf("expected a failed LLM re-ranking to keep the vector order, got %v", matches)
+	}
+	return nil
+}
+
+// checkFetch fetches a page's text, refusing hosts off the allowlist and private addresses
+func (st *selfTest) checkFetch(ctx context.Context) error {
+	page, err := st.fetchPage(ctx, st.stubs.URL()+"/page")
+	if err != nil {
+		return err
+	}
+	if page.Title != "Stub Harbor News" || !strings.Contains(page.Text, "The harbor reopened on Monday") {
+		return fmt.Errorf("unexpected page %q: %q", page.Title, page.Text)
+	}
+	if strings.Contains(page.Text, "cookies") || strings.Contains(page.Text, "Copyright") {
+		return fmt.Errorf("boilerplate left in page text: %q", page.Text)
+	}
+
+	// Hosts off the allowlist are refused before any request
+	st.mu.Lock()
+	st.updateConfig(func(c *config.Config) { c.FetchAllowedDomains = []string{"example.com"} })
+	st.mu.Unlock()
+	defer func() {
+		st.mu.Lock()
+		st.updateConfig(func(c *config.Config) { c.FetchAllowedDomains = nil })
+		st.mu.Unlock()
+	}()
+	if _, err := st.fetchPage(ctx, st.stubs.URL()+"/page"); !errors.Is(err, web.ErrNotAllowed) {
+		return fmt.Errorf("expected the allowlist to refuse the stub host, got %v", err)
+	}
+	if st.stubs.Hits("/page") != 1 {
+		return fmt.Errorf("expected 1 page request, got %d", st.stubs.Hits("/page"))
+	}
+
+	// So are private addresses, unless allowed, however they are named
+	st.mu.Lock()
+	st.updateConfig(func(c *config.Config) { c.FetchAllowedDomains, c.FetchAllowPrivate = nil, false })
+	st.mu.Unlock()
+	defer func() {
+		st.mu.Lock()
+		st.updateConfig(func(c *config.Config) { c.FetchAllowPrivate = true })
+		st.mu.Unlock()
+	}()
+	for _, host := range []string{"127.0.0.1", "localhost"} {
+		url := strings.Replace(st.stubs.URL(), "127.0.0.1", host, 1) + "/page"
+		if _, err := st.fetchPage(ctx, url); !errors.Is(err, web.ErrPrivateAddress) {
+			return fmt.Errorf("expected %s to be refused, got %v", url, err)
+		}
+	}
+	if st.stubs.Hits("/page") != 1 {
+		return fmt.Errorf("a private address was fetched")
+	}
+	if stats := st.httpPools[fetchPool]; stats.opened.Load()+stats.reused.Load() != 1 {
+		return fmt.Errorf("expected the page fetched through the fetch pool")
+	}
+	return nil
+}
+
+// checkNativeTools cuts run_command output at its limit and keeps fetch_url off loopback
+func (st *selfTest) checkNativeTools(ctx context.Context) error {
+	tools, err := native.NewClient(st.path("sandbox"), st.fetchClient(), st.fetchLimits, st.logger)
+	if err != nil {
+		return err
+	}
+	text := func(result interface{}) string {
+		if r, ok := result.(mcp.CallToolResult); ok && len(r.Content) == 1 {
+			return r.Content[0].Text
+		}
+		return ""
+	}
+
+	// Only what the model is shown of a command's output is kept
+	if _, err := exec.LookPath("sh"); err == nil {
+		result, err := tools.CallTool(ctx, native.RunCommandTool, map[string]interface{}{"command": "yes tide | head -c 4000000"})
+		if err != nil {
+			return err
+		}
+		if out := text(result); !strings.HasPrefix(out, "exit status 0\ntide\n") || !strings.HasSuffix(out, "\n[truncated]") || len(out) > 300*1024 {
+			return fmt.Errorf("expected the output cut at the limit, got %d bytes", len(out))
+		}
+	}
+
+	// Loopback is refused by address, and by name once resolved
+	st.mu.Lock()
+	st.updateConfig(func(c *config.Config) { c.FetchAllowPrivate = false })
+	st.mu.Unlock()
+	defer func() {
+		st.mu.Lock()
+		st.updateConfig(func(c *config.Config) { c.FetchAllowPrivate = true })
+		st.mu.Unlock()
+	}()
+	pages := st.stubs.Hits("/page")
+	for _, url := range []string{st.stubs.URL() + "/page", strings.Replace(st.stubs.URL(), "127.0.0.1", "localhost", 1) + "/page"} {
+		if _, err := tools.CallTool(ctx, "fetch_url", map[string]interface{}{"url": url}); !errors.Is(err, web.ErrPrivateAddress) {
+			return fmt.Errorf("expected fetch_url to refuse %s, got %v", url, err)
+		}
+	}
+	if st.stubs.Hits("/page") != pages {
+		return fmt.Errorf("a private address was fetched")
+	}
+	return nil
+}
@@ -0,0 +1,509 @@
+package chatbot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+
+	"ExtraChat/internal/config"
+	"ExtraChat/internal/dataset"
+	"ExtraChat/internal/guard"
+	"ExtraChat/internal/session"
+)
+
+// checkRouting routes prompts by the router rules without switching the session
+func (st *selfTest) checkRouting(ctx context.Context) error {
+	yes := true
+	st.mu.Lock()
+	st.updateConfig(func(c *config.Config) {
+		c.RouterEnabled = true
+		c.RouterRules = []config.RouteRule{
+			{Name: "tools", Tools: &yes, Models: []string{config.BackendOpenAI, config.BackendAnthropic}},
+			{Name: "code", Code: &yes, Models: []string{config.BackendGrok}},
+		}
+	})
+	st.session.Backend = config.BackendOllama
+	st.mu.Unlock()
+	defer func() {
+		st.mu.Lock()
+		st.updateConfig(func(c *config.Config) { c.RouterEnabled, c.RouterRules = false, nil })
+		st.mu.Unlock()
+	}()
+
+	// Only Anthropic requests carry the MCP tools
+	target, route := st.routeTarget(ctx, "call the echo tool", llmTarget{Backend: config.BackendOllama})
+	if target.Backend != config.BackendAnthropic || len(route.Skipped) != 1 {
+		return fmt.Errorf("unexpected routing decision %+v", route)
+	}
+
+	if err := st.chat(ctx, config.BackendOllama, "fix this python bug", "fix this python bug"); err != nil {
+		return err
+	}
+	if err := st.chat(ctx, config.BackendOllama, "hello router", "hello router"); err != nil {
+		return err
+	}
+	st.mu.Lock()
+	messages := st.session.Messages
+	backendName := st.session.Backend
+	st.mu.Unlock()
+	code, chatted := messages[len(messages)-3].Route, messages[len(messages)-1].Route
+	switch {
+	case code == nil || code.Rule != "code" || code.Backend != config.BackendGrok:
+		return fmt.Errorf("expected the code prompt routed to grok, got %+v", code)
+	case chatted == nil || chatted.Rule != "" || chatted.Backend != config.BackendOllama:
+		return fmt.Errorf("expected the chat prompt kept on ollama, got %+v", chatted)
+	case backendName != config.BackendOllama:
+		return fmt.Errorf("routing switched the session to %s", backendName)
+	}
+	return nil
+}
+
+// checkBestOf samples three replies and lets the judge pick one
+func (st *selfTest) checkBestOf(ctx context.Context) error {
+	st.mu.Lock()
+	st.updateConfig(func(c *config.Config) { c.BestOfJudge = config.BackendOllama })
+	st.session.Backend = config.BackendOpenAI
+	st.mu.Unlock()
+	defer func() {
+		st.mu.Lock()
+		st.updateConfig(func(c *config.Config) { c.BestOfJudge = "" })
+		st.mu.Unlock()
+	}()
+
+	result, err := st.bestOf(ctx, 3, "name 2 tide pool animals")
+	if err != nil {
+		return err
+	}
+	for i, sample := range result.Samples {
+		if sample.Err != nil || !strings.Contains(sample.Response, "tide pool animals") {
+			return fmt.Errorf("unexpected reply %d: %q (%v)", i+1, sample.Response, sample.Err)
+		}
+	}
+	// The stub judge quotes the prompt, whose first number is 2
+	if result.JudgeErr != nil || result.Selected != 1 {
+		return fmt.Errorf("expected the judge to pick reply 2, got %d (%v)", result.Selected+1, result.JudgeErr)
+	}
+	if !result.Priced {
+		return fmt.Errorf("expected a known cost")
+	}
+	return nil
+}
+
+// checkPostProcessing runs a persona's post-processors on its replies
+func (st *selfTest) checkPostProcessing(ctx context.Context) error {
+	// The mock backend echoes the prompt, so the prompt is the reply
+	// the post-processors see
+	st.mu.Lock()
+	st.updateConfig(func(c *config.Config) {
+		c.Personas = map[string]config.Persona{"shouter": {System: "Shout code.", Post: []config.PostProcessor{
+			{Kind: config.PostFormat, Lang: "txt", Command: "tr a-z A-Z"},
+			{Kind: config.PostFormat, Lang: "txt", Command: "exit 3"},
+			{Kind: config.PostTrimFences},
+		}}, "extractor": {System: "Answer in JSON.", Post: []config.PostProcessor{{Kind: config.PostExtractJSON}}}}
+	})
+	st.session.Persona, st.session.Backend = "shouter", config.BackendMock
+	st.mu.Unlock()
+	defer func() {
+		st.mu.Lock()
+		st.updateConfig(func(c *config.Config) { c.Personas = nil })
+		st.session.Persona = ""
+		st.mu.Unlock()
+	}()
+
+	// A failing formatter leaves the block as the one before made it
+	reply, err := st.sendMessage(ctx, "code:\n```txt\nquiet please\n```\nbye")
+	if err != nil {
+		return err
+	}
+	if !strings.HasSuffix(reply, "code:\nQUIET PLEASE\nbye") {
+		return fmt.Errorf("expected the block formatted and its fences trimmed, got %q", reply)
+	}
+	st.mu.Lock()
+	stored := st.session.Messages[len(st.session.Messages)-1].Content
+	st.session.Persona = "extractor"
+	st.mu.Unlock()
+	if stored != reply {
+		return fmt.Errorf("expected the processed reply stored, got %q", stored)
+	}
+	if err := st.chat(ctx, config.BackendMock, `the answer is {"tides": [2, 14]} as asked`, ""); err != nil {
+		return err
+	}
+	st.mu.Lock()
+	stored = st.session.Messages[len(st.session.Messages)-1].Content
+	st.mu.Unlock()
+	if stored != `{"tides": [2, 14]}` {
+		return fmt.Errorf("expected only the JSON kept, got %q", stored)
+	}
+	return nil
+}
+
+// checkGuardrails blocks prompts and replies the content filters catch, unsent and unstreamed
+func (st *selfTest) checkGuardrails(ctx context.Context) error {
+	st.mu.Lock()
+	st.updateConfig(func(c *config.Config) {
+		c.InputFilter = config.ContentFilter{Keywords: []string{"launch codes"}, MaxLength: 200}
+		c.OutputFilter = config.ContentFilter{Patterns: []string{`secret-\d+`}, Moderation: true}
+	})
+	st.session.Backend = config.BackendOllama
+	before := len(st.session.Messages)
+	st.mu.Unlock()
+	defer func() {
+		st.mu.Lock()
+		st.updateConfig(func(c *config.Config) { c.InputFilter, c.OutputFilter = config.ContentFilter{}, config.ContentFilter{} })
+		st.mu.Unlock()
+	}()
+
+	// blocked sends a message that must trip the given check
+	blocked := func(ctx context.Context, message, subject, check string) error {
+		_, err := st.sendMessage(ctx, message)
+		var violation *guard.Violation
+		if !errors.As(err, &violation) || violation.Subject != subject || violation.Check != check {
+			return fmt.Errorf("expected %q to trip the %s %s check, got %v", message, subject, check, err)
+		}
+		return nil
+	}
+	sent := st.stubs.Hits("/api/chat")
+	if err := blocked(ctx, "What are the LAUNCH  codes?", guard.Prompt, guard.CheckKeyword); err != nil {
+		return err
+	}
+	if err := blocked(ctx, strings.Repeat("long ", 50), guard.Prompt, guard.CheckLength); err != nil {
+		return err
+	}
+	if st.stubs.Hits("/api/chat") != sent {
+		return fmt.Errorf("a blocked prompt was sent")
+	}
+
+	// A blocked reply is not streamed either
+	var streamed strings.Builder
+	streamCtx := withTurnEvents(ctx, func(event turnEvent) { streamed.WriteString(event.Text) })
+	if err := blocked(streamCtx, "repeat secret-42", guard.Reply, guard.CheckPattern); err != nil {
+		return err
+	}
+	if streamed.Len() > 0 {
+		return fmt.Errorf("the blocked reply was streamed: %q", streamed.String())
+	}
+	if err := blocked(ctx, "describe some violence", guard.Reply, guard.CheckModeration); err != nil {
+		return err
+	}
+	if err := st.chat(ctx, config.BackendOllama, "a harmless question", "a harmless question"); err != nil {
+		return err
+	}
+
+	// Blocked prompts are dropped; prompts of blocked replies stay, as after any failure
+	st.mu.Lock()
+	added := len(st.session.Messages) - before
+	st.mu.Unlock()
+	if added != 4 {
+		return fmt.Errorf("expected 4 messages added to the session, got %d", added)
+	}
+	return nil
+}
+
+// checkSecretScan holds back prompts with secrets and redacts them from diffs
+func (st *selfTest) checkSecretScan(ctx context.Context) error {
+	st.mu.Lock()
+	st.updateConfig(func(c *config.Config) { c.SecretScan = true })
+	st.session.Backend = config.BackendOpenAI
+	before := len(st.session.Messages)
+	st.mu.Unlock()
+	defer func() {
+		st.mu.Lock()
+		st.updateConfig(func(c *config.Config) { c.SecretScan = false })
+		st.mu.Unlock()
+	}()
+
+	// Without an interactive input nothing with a secret is sent
+	key := "sk-" + strings.Repeat("x", 24)
+	sent := st.stubs.Hits("/v1/chat/completions")
+	if err := st.handleBestOfCommand([]string{"2", "check", key}); err == nil || !strings.Contains(err.Error(), "an OpenAI API key") {
+		return fmt.Errorf("expected /bestof to hold back the key, got %v", err)
+	}
+	if err := st.handleAsyncCommand([]string{"check", key}); err == nil || !strings.Contains(err.Error(), "an OpenAI API key") {
+		return fmt.Errorf("expected /async to hold back the key, got %v", err)
+	}
+	var jobs int
+	if err := st.db.QueryRow("SELECT COUNT(*) FROM jobs WHERE prompt LIKE ?", "%"+key+"%").Scan(&jobs); err != nil {
+		return err
+	}
+	st.mu.Lock()
+	added := len(st.session.Messages) - before
+	st.mu.Unlock()
+	if jobs != 0 || added != 0 || st.stubs.Hits("/v1/chat/completions") != sent {
+		return fmt.Errorf("a prompt with a secret was queued or sent")
+	}
+
+	// Diffs are sent with the secrets replaced; the audit log has
+	// what was sent
+	if _, err := exec.LookPath("git"); err == nil {
+		if err := os.WriteFile(st.path("repo", "keys.txt"), []byte("key = "+key+"\n"), 0o644); err != nil {
+			return err
+		}
+		if out, err := exec.Command("git", "-C", st.path("repo"), "add", "keys.txt").CombinedOutput(); err != nil {
+			return fmt.Errorf("git add: %w: %s", err, out)
+		}
+		var progress strings.Builder
+		if err := st.RunGit(ctx, io.Discard, &progress, GitOptions{Mode: GitCommitMsg, Dir: st.path("repo")}); err != nil {
+			return err
+		}
+		if !strings.Contains(progress.String(), "The diff contains an OpenAI API key") {
+			return fmt.Errorf("expected a note of the redacted key, got %q", progress.String())
+		}
+	}
+	var progress strings.Builder
+	opts := ReviewOptions{Paths: []string{"-"}, Stdin: strings.NewReader("diff --git a/keys.txt b/keys.txt\n--- a/keys.txt\n+++ b/keys.txt\n" +
+		"@@ -0,0 +1 @@\n+key = " + key + "\n"), ChunkLines: 100, Concurrency: 1}
+	// The stub's reply isn't a list of findings, so only what was sent counts
+	st.RunReview(ctx, io.Discard, &progress, opts)
+	if !strings.Contains(progress.String(), "keys.txt:1-1 contains an OpenAI API key") {
+		return fmt.Errorf("expected a note of the redacted key, got %q", progress.String())
+	}
+	if logged, err := os.ReadFile(st.cfg().AuditLog); err != nil || strings.Contains(string(logged), key) {
+		return fmt.Errorf("a secret was sent (%v)", err)
+	}
+	return nil
+}
+
+// checkPersistence saves and loads the session with its citations and routing decisions
+func (st *selfTest) checkPersistence(ctx context.Context) error {
+	if err := st.saveSession(); err != nil {
+		return err
+	}
+	st.mu.Lock()
+	id, want := st.session.ID, len(st.session.Messages)
+	st.mu.Unlock()
+
+	loaded, err := st.loadSession(id)
+	if err != nil {
+		return err
+	}
+	if len(loaded.Messages) != want {
+		return fmt.Errorf("expected %d saved messages, got %d", want, len(loaded.Messages))
+	}
+	cited, routed := 0, 0
+	for _, msg := range loaded.Messages {
+		cited += len(msg.Citations)
+		if msg.Route != nil {
+			routed++
+		}
+	}
+	if cited != 1 {
+		return fmt.Errorf("expected 1 saved citation, got %d", cited)
+	}
+	if routed != 2 {
+		return fmt.Errorf("expected 2 saved routing decisions, got %d", routed)
+	}
+	return nil
+}
+
+// checkPagedLoading loads the latest page of a session, then earlier messages
+func (st *selfTest) checkPagedLoading(ctx context.Context) error {
+	st.mu.Lock()
+	id, all := st.session.ID, slices.Clone(st.session.Messages)
+	st.mu.Unlock()
+	if len(all) < 3 {
+		return fmt.Errorf("expected at least 3 messages, got %d", len(all))
+	}
+
+	paged, err := st.loadSessionPage(id, 2)
+	if err != nil {
+		return err
+	}
+	if len(paged.Messages) != 2 || paged.Older != len(all)-2 {
+		return fmt.Errorf("expected 2 loaded and %d older messages, got %d and %d", len(all)-2, len(paged.Messages), paged.Older)
+	}
+	if paged.Messages[1].ID != all[len(all)-1].ID {
+		return fmt.Errorf("expected the page to end with the latest message")
+	}
+	earlier, err := st.loadMessages(id, paged.Older-1, 1)
+	if err != nil {
+		return err
+	}
+	if len(earlier) != 1 || earlier[0].ID != all[len(all)-3].ID {
+		return fmt.Errorf("expected the message before the page")
+	}
+
+	// The API returns the whole history whatever the page size
+	st.mu.Lock()
+	pageSize := st.cfg().PageSize
+	st.updateConfig(func(c *config.Config) { c.PageSize = 2 })
+	st.mu.Unlock()
+	api := &apiServer{bot: st.ChatBot, locks: session.NewLocks(), limiter: newRateLimiter()}
+	resp := httptest.NewRecorder()
+	api.routes().ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/v1/sessions/"+id, nil))
+	st.mu.Lock()
+	st.updateConfig(func(c *config.Config) { c.PageSize = pageSize })
+	st.mu.Unlock()
+	var fetched session.Session
+	if err := json.Unmarshal(resp.Body.Bytes(), &fetched); err != nil {
+		return fmt.Errorf("GET /v1/sessions/%s: %d %v", id, resp.Code, err)
+	}
+	if len(fetched.Messages) != len(all) || fetched.Older != 0 {
+		return fmt.Errorf("expected all %d messages from the API, got %d and %d older", len(all), len(fetched.Messages), fetched.Older)
+	}
+	return nil
+}
+
+// checkReplay replays the session on Grok and reports the changed replies
+func (st *selfTest) checkReplay(ctx context.Context) error {
+	st.mu.Lock()
+	id := st.session.ID
+	prompts := 0
+	for _, msg := range st.session.Messages {
+		if msg.Role == "user" {
+			prompts++
+		}
+	}
+	st.mu.Unlock()
+
+	record, err := st.replay(ctx, ReplayOptions{SessionID: id, Backend: config.BackendGrok})
+	if err != nil {
+		return err
+	}
+	if len(record.Turns) != prompts || record.Failed > 0 {
+		return fmt.Errorf("expected %d replayed turns without failures, got %d with %d failed", prompts, len(record.Turns), record.Failed)
+	}
+	// The stubs name the model in their replies, so turns that were not on Grok changed
+	if record.Changed == 0 {
+		return fmt.Errorf("expected changed replies, got %d identical", record.Identical)
+	}
+	var report strings.Builder
+	writeReplayReport(&report, record, 100)
+	want := fmt.Sprintf("Summary: %d turns, %d identical, %d changed, 0 failed", prompts, record.Identical, record.Changed)
+	if !strings.Contains(report.String(), want) {
+		return fmt.Errorf("report lacks %q", want)
+	}
+	if !strings.Contains(report.String(), " | stub(") {
+		return fmt.Errorf("report marks no changed line")
+	}
+	return nil
+}
+
+// checkExport exports the session as ShareGPT and OpenAI fine-tuning records
+func (st *selfTest) checkExport(ctx context.Context) error {
+	if err := st.saveSession(); err != nil {
+		return err
+	}
+	st.mu.Lock()
+	id := st.session.ID
+	st.mu.Unlock()
+
+	var sharegpt strings.Builder
+	opts := ExportOptions{SessionIDs: []string{id}, Format: dataset.FormatShareGPT, Tools: ExportToolsInclude}
+	if err := st.RunExport(ctx, &sharegpt, io.Discard, opts); err != nil {
+		return err
+	}
+	var record struct {
+		Conversations []struct{ From, Value string }
+	}
+	if err := json.Unmarshal([]byte(sharegpt.String()), &record); err != nil {
+		return fmt.Errorf("invalid ShareGPT record: %w", err)
+	}
+	var calls, results int
+	for i, msg := range record.Conversations {
+		switch msg.From {
+		case "function_call":
+			calls++
+		case "observation":
+			results++
+			if strings.Contains(record.Conversations[i-1].Value, "look up tides") && !strings.Contains(msg.Value, "echo: look up tides") {
+				return fmt.Errorf("expected the audited tool result, got %q", msg.Value)
+			}
+		case "gpt":
+			// Stopped replies are left out with their prompt
+			if strings.HasSuffix(msg.Value, ": one ") {
+				return fmt.Errorf("expected the stopped reply left out")
+			}
+		}
+	}
+	if calls < 2 || calls != results {
+		return fmt.Errorf("expected each tool call with its result, got %d calls and %d results", calls, results)
+	}
+
+	// OpenAI fine-tuning pairs results with calls by ID
+	var openai strings.Builder
+	opts.Format, opts.Roles = dataset.FormatOpenAIFT, map[string]string{dataset.RoleUser: "customer"}
+	if err := st.RunExport(ctx, &openai, io.Discard, opts); err != nil {
+		return err
+	}
+	var messages struct {
+		Messages []struct {
+			Role       string
+			ToolCalls  []struct{ ID string } `json:"tool_calls"`
+			ToolCallID string                `json:"tool_call_id"`
+		}
+	}
+	if err := json.Unmarshal([]byte(openai.String()), &messages); err != nil {
+		return fmt.Errorf("invalid OpenAI record: %w", err)
+	}
+	pending := map[string]bool{}
+	for _, msg := range messages.Messages {
+		if msg.Role == "user" {
+			return fmt.Errorf("expected the user role mapped to customer")
+		}
+		for _, call := range msg.ToolCalls {
+			pending[call.ID] = true
+		}
+		if msg.Role == "tool" {
+			if !pending[msg.ToolCallID] {
+				return fmt.Errorf("tool result %q answers no call", msg.ToolCallID)
+			}
+			delete(pending, msg.ToolCallID)
+		}
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("expected every tool call answered, %d are not", len(pending))
+	}
+	return nil
+}
+
+// checkAgents runs a moderated conversation of two agents
+func (st *selfTest) checkAgents(ctx context.Context) error {
+	opts := AgentOptions{
+		Task:      "Name a tide pool animal.",
+		Agents:    []string{"sre=anthropic", "copywriter=openai"},
+		Moderator: "socratic-tutor=ollama",
+		Turns:     3,
+		Stop:      "[DONE]",
+	}
+	if err := st.RunAgents(ctx, io.Discard, io.Discard, opts); err != nil {
+		return err
+	}
+	st.mu.Lock()
+	id := st.session.ID
+	st.mu.Unlock()
+	loaded, err := st.loadSession(id)
+	if err != nil {
+		return err
+	}
+	var speakers []string
+	for _, msg := range loaded.Messages {
+		speakers = append(speakers, msg.Author())
+	}
+	// The moderator steps in after the first round, not after the last turn
+	if got := strings.Join(speakers, " "); got != "user sre copywriter moderator sre" {
+		return fmt.Errorf("unexpected speakers %q", got)
+	}
+	// Each agent sees the others' replies by name
+	if reply := loaded.Messages[2].Content; !strings.Contains(reply, "sre: stub(") {
+		return fmt.Errorf("unexpected reply %q", reply)
+	}
+
+	// The stubs echo the prompt, so a stop phrase from the task ends it at once
+	opts.Task, opts.Stop = "Say stop.", "stop"
+	var progress strings.Builder
+	if err := st.RunAgents(ctx, io.Discard, &progress, opts); err != nil {
+		return err
+	}
+	if !strings.Contains(progress.String(), "Stopped: sre said stop") {
+		return fmt.Errorf("unexpected outcome %q", progress.String())
+	}
+	return nil
+}
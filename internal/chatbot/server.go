@@ -0,0 +1,760 @@
+package chatbot
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"ExtraChat/internal/config"
+	"ExtraChat/internal/guard"
+	"ExtraChat/internal/mcp"
+	"ExtraChat/internal/session"
+)
+
+// API server limits
+const (
+	maxRequestBody    = 4 << 20          // Bytes accepted in a request body
+	defaultListLimit  = 50               // Sessions returned by GET /v1/sessions without ?limit
+	streamKeepAlive   = 15 * time.Second // Comment lines keeping idle event streams open
+	serveShutdownWait = 30 * time.Second // Grace period for turns in flight on shutdown
+)
+
+// apiServer serves sessions over HTTP, see Serve
+type apiServer struct {
+	bot   *ChatBot
+	token string         // Operator's bearer token; with neither it nor tenants, authentication is off
+	locks *session.Locks // Serializes requests against a session until its turn is saved
+
+	limiter *rateLimiter  // Tenants' requests per minute
+	quotas  *quotaMetrics // Tenants' quota usage, exported as metrics
+
+	// Shutdown does not wait for WebSocket connections: they are closed when
+	// shutdown is, and counted in wsConns
+	shutdown chan struct{}
+	wsConns  sync.WaitGroup
+}
+
+// apiClient is the tenant a request authenticated as. Requests without one
+// come from the operator, who has the --token or runs without
+// authentication, and are not scoped.
+type apiClient struct {
+	name   string
+	tenant config.Tenant
+}
+
+// apiClientKey is the context key for the apiClient of a request
+type apiClientKey struct{}
+
+// clientFrom returns the tenant a request authenticated as, or nil for the
+// operator
+func clientFrom(ctx context.Context) *apiClient {
+	client, _ := ctx.Value(apiClientKey{}).(*apiClient)
+	return client
+}
+
+// sessionInfo is a session in GET /v1/sessions
+type sessionInfo struct {
+	ID           string    `json:"id"`
+	StartTime    time.Time `json:"start_time"`
+	Backend      string    `json:"backend"`
+	Title        string    `json:"title,omitempty"`
+	Persona      string    `json:"persona,omitempty"`
+	Tenant       string    `json:"tenant,omitempty"`
+	MessageCount int       `json:"message_count"`
+}
+
+// Serve runs the REST API on addr until SIGINT or SIGTERM. Unless token is
+// empty, requests may send it as a bearer token for full access; the
+// tenants of the config file authenticate with their own tokens.
+func (cb *ChatBot) Serve(addr, token string) error {
+	defer cb.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+
+	if !cb.cfg().SkipStartupChecks {
+		cb.reportPreflight(ctx)
+	}
+	cb.startBackground(ctx)
+	// Scheduled jobs only run in server mode
+	go cb.runSchedule(ctx)
+
+	quotas, err := newQuotaMetrics(cb.meter)
+	if err != nil {
+		return err
+	}
+	s := &apiServer{
+		bot:      cb,
+		token:    token,
+		locks:    session.NewLocks(),
+		limiter:  newRateLimiter(),
+		quotas:   quotas,
+		shutdown: make(chan struct{}),
+	}
+	server := &http.Server{Handler: s.routes(), ReadHeaderTimeout: 10 * time.Second}
+	server.RegisterOnShutdown(func() { close(s.shutdown) })
+
+	for name, tenant := range cb.cfg().Tenants {
+		if os.ExpandEnv(tenant.Token) == "" {
+			fmt.Fprintf(os.Stderr, "Warning: the token of tenant %s is empty, so it can't sign in\n", name)
+		}
+	}
+	if !s.authRequired() && !isLoopback(listener.Addr()) {
+		fmt.Fprintf(os.Stderr, "Warning: serving on %s without --token or tenants; anyone who can reach it can use your API keys\n", listener.Addr())
+	}
+	cb.logger.Info("API server started", "addr", listener.Addr().String(), "auth", s.authRequired(), "tenants", len(cb.cfg().Tenants))
+	fmt.Printf("Serving the API on http://%s/v1/\n", listener.Addr())
+
+	errc := make(chan error, 1)
+	go func() { errc <- server.Serve(listener) }()
+	select {
+	case err := <-errc:
+		return fmt.Errorf("API server stopped: %w", err)
+	case <-ctx.Done():
+	}
+
+	fmt.Println("Shutting down...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), serveShutdownWait)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("failed to shut down API server: %w", err)
+	}
+	s.wsConns.Wait()
+	cb.logger.Info("API server stopped")
+	return nil
+}
+
+// isLoopback reports whether addr only accepts local connections
+func isLoopback(addr net.Addr) bool {
+	tcp, ok := addr.(*net.TCPAddr)
+	return ok && tcp.IP.IsLoopback()
+}
+
+// routes returns the API handler; a private mux, as for pprof
+func (s *apiServer) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/health", s.handleHealth)
+	mux.HandleFunc("GET /v1/sessions", s.handleListSessions)
+	mux.HandleFunc("POST /v1/sessions", s.handleCreateSession)
+	mux.HandleFunc("GET /v1/sessions/{id}", s.handleGetSession)
+	mux.HandleFunc("POST /v1/sessions/{id}/messages", s.handlePostMessage)
+	mux.HandleFunc("PUT /v1/sessions/{id}/backend", s.handleSwitchBackend)
+	mux.HandleFunc("GET /v1/ws", s.handleWebSocket)
+	return s.authenticate(mux)
+}
+
+// authRequired reports whether requests must send a bearer token: the
+// operator's, or a tenant's. Tenants are read per request, so a config
+// reload adds and revokes them.
+func (s *apiServer) authRequired() bool {
+	s.bot.mu.Lock()
+	defer s.bot.mu.Unlock()
+	return s.token != "" || len(s.bot.cfg().Tenants) > 0
+}
+
+// authenticate checks the bearer token of every request but health checks,
+// and tags tenants' requests with their apiClient after checking their
+// rate limit. Browsers can't set
+// headers on WebSocket connections, so /v1/ws also takes the token as
+// ?token=.
+func (s *apiServer) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/health" || !s.authRequired() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok && r.URL.Path == "/v1/ws" {
+			got, ok = r.URL.Query().Get("token"), r.URL.Query().Has("token")
+		}
+		if ok && s.token != "" && subtle.ConstantTimeCompare([]byte(got), []byte(s.token)) == 1 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if ok {
+			s.bot.mu.Lock()
+			name, tenant, found := s.bot.cfg().TenantByToken(got)
+			s.bot.mu.Unlock()
+			if found {
+				ctx := context.WithValue(r.Context(), apiClientKey{}, &apiClient{name: name, tenant: tenant})
+				if err := s.checkRate(ctx); err != nil {
+					s.fail(w, err)
+					return
+				}
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+		}
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeError(w, http.StatusUnauthorized, "missing or invalid bearer token")
+	})
+}
+
+// forSession returns a view of the chatbot for one API request: it shares
+// the database, cache, telemetry and MCP clients but has its own session
+// and a snapshot of the config. Without an interactive input, only
+// auto-approved tools run.
+func (cb *ChatBot) forSession(sess *session.Session) *ChatBot {
+	view := &ChatBot{
+		db:            cb.db,
+		cache:         cb.cache,
+		logger:        cb.logger,
+		tracer:        cb.tracer,
+		meter:         cb.meter,
+		httpPools:     cb.httpPools,
+		clock:         cb.clock,
+		history:       cb.history,
+		session:       sess,
+		locks:         cb.locks,
+		spanRecorder:  cb.spanRecorder,
+		approvedTools: make(map[string]bool),
+		modelInfo:     cb.modelInfo,
+		modelLists:    cb.modelLists,
+		progress:      newProgressDisplay(io.Discard, true),
+		turnStats:     cb.turnStats,
+		audit:         cb.audit,
+		mcpRegistry:   cb.mcpRegistry,
+		mcpTools:      cb.getMCPTools(),
+		mcpHealth:     cb.mcpHealth,
+	}
+	view.config.Store(cb.cfg())
+	return view
+}
+
+// resolveBackend returns the backend of a backend name or model alias
+// without selecting the alias's model
+func (cb *ChatBot) resolveBackend(name string) string {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if backendName, _, ok := cb.cfg().ResolveAlias(name); ok {
+		return backendName
+	}
+	return name
+}
+
+// switchBackend resolves a backend or model alias and switches sess to it,
+// and returns the backend and model. An alias's model is kept on the
+// session, so it applies to that session only. Callers must hold cb.mu.
+func (cb *ChatBot) switchBackend(sess *session.Session, name string) (string, string, error) {
+	if backendName, model, ok := cb.cfg().ResolveAlias(name); ok {
+		sess.Backend, sess.Model = backendName, model
+		return backendName, model, nil
+	}
+	if !config.ValidBackend(name) {
+		return "", "", fmt.Errorf("unknown backend or alias: %s", name)
+	}
+	sess.Backend, sess.Model = name, ""
+	return name, cb.modelFor(name), nil
+}
+
+func (s *apiServer) handleHealth(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (s *apiServer) handleListSessions(w http.ResponseWriter, r *http.Request) {
+	limit := defaultListLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			writeError(w, http.StatusBadRequest, "limit must be a positive number")
+			return
+		}
+		limit = n
+	}
+
+	// Tenants only see their own sessions
+	query := `SELECT s.id, s.start_time, s.backend, COALESCE(s.title, ''), COALESCE(s.persona, ''), COALESCE(s.tenant, ''),
+			(SELECT COUNT(*) FROM messages m WHERE m.session_id = s.id)
+		FROM sessions s`
+	var args []interface{}
+	if client := clientFrom(r.Context()); client != nil {
+		query += " WHERE s.tenant = ?"
+		args = append(args, client.name)
+	}
+	query += " ORDER BY s.start_time DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := s.bot.db.QueryContext(r.Context(), query, args...)
+	if err != nil {
+		s.internalError(w, fmt.Errorf("failed to list sessions: %w", err))
+		return
+	}
+	defer rows.Close()
+
+	sessions := []sessionInfo{}
+	for rows.Next() {
+		var info sessionInfo
+		if err := rows.Scan(&info.ID, &info.StartTime, &info.Backend, &info.Title, &info.Persona, &info.Tenant, &info.MessageCount); err != nil {
+			s.internalError(w, fmt.Errorf("failed to scan session: %w", err))
+			return
+		}
+		sessions = append(sessions, info)
+	}
+	if err := rows.Err(); err != nil {
+		s.internalError(w, fmt.Errorf("failed to list sessions: %w", err))
+		return
+	}
+	writeJSON(w, http.StatusOK, sessions)
+}
+
+func (s *apiServer) handleCreateSession(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Backend string `json:"backend"`
+		Persona string `json:"persona"`
+	}
+	if !decodeBody(w, r, &req, true) {
+		return
+	}
+
+	sess, err := s.createSession(r.Context(), req.Backend, req.Persona)
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, sess)
+}
+
+func (s *apiServer) handleGetSession(w http.ResponseWriter, r *http.Request) {
+	// The whole history, not the page a turn keeps in memory
+	sess, err := s.loadSession(r.Context(), r.PathValue("id"), 0)
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, sess)
+}
+
+// handlePostMessage runs a turn. The reply comes back as the turn's record,
+// or as server-sent events when the client asks for a stream.
+func (s *apiServer) handlePostMessage(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Content       string   `json:"content"`
+		StopSequences []string `json:"stop_sequences"`
+	}
+	if !decodeBody(w, r, &req, false) {
+		return
+	}
+	if strings.TrimSpace(req.Content) == "" {
+		writeError(w, http.StatusBadRequest, "content is required")
+		return
+	}
+	ctx := r.Context()
+	if req.StopSequences != nil {
+		if err := validStopSequences(req.StopSequences); err != nil {
+			s.fail(w, err)
+			return
+		}
+		ctx = withStopSequences(ctx, req.StopSequences)
+	}
+	r = r.WithContext(ctx)
+
+	id := r.PathValue("id")
+	if r.URL.Query().Get("stream") == "true" || strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		s.streamTurn(w, r, id, req.Content)
+		return
+	}
+
+	record, err := s.runTurn(r.Context(), id, req.Content, nil, nil)
+	var violation *guard.Violation
+	switch {
+	case r.Context().Err() != nil:
+		// The client is gone
+	case record == nil:
+		s.fail(w, err)
+	case err == nil:
+		writeJSON(w, http.StatusOK, record)
+	case errors.Is(err, session.ErrSessionBusy):
+		writeJSON(w, http.StatusConflict, record)
+	case errors.As(err, &violation):
+		writeJSON(w, http.StatusUnprocessableEntity, record)
+	default:
+		writeJSON(w, http.StatusBadGateway, record)
+	}
+}
+
+// sseEvent is a server-sent event waiting to be written
+type sseEvent struct {
+	name string
+	data interface{}
+}
+
+// streamTurn runs a turn as server-sent events: start, the reply's tokens
+// and tool calls as they happen, then done or error with the turn's record.
+// Comment lines keep the stream open while the backend works.
+func (s *apiServer) streamTurn(w http.ResponseWriter, r *http.Request, id, prompt string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+
+	// Unbuffered, so every event is written before the turn is over
+	events := make(chan sseEvent)
+	var record *turnRecord
+	var err error
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		record, err = s.runTurn(r.Context(), id, prompt,
+			func(start turnStart) { events <- sseEvent{"start", start} },
+			func(event turnEvent) { events <- sseEvent{event.Type, event} },
+		)
+	}()
+
+	// The status is sent with the first event, so a missing session is
+	// still answered with 404
+	started := false
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+	for waiting := true; waiting; {
+		select {
+		case event := <-events:
+			if !started {
+				w.Header().Set("Content-Type", "text/event-stream")
+				w.Header().Set("Cache-Control", "no-cache")
+				w.WriteHeader(http.StatusOK)
+				started = true
+			}
+			writeEvent(w, event.name, event.data)
+			flusher.Flush()
+		case <-keepAlive.C:
+			if started {
+				fmt.Fprint(w, ": waiting\n\n")
+				flusher.Flush()
+			}
+		case <-done:
+			waiting = false
+		}
+	}
+
+	if !started {
+		if r.Context().Err() == nil {
+			s.fail(w, err)
+		}
+		return
+	}
+	if err != nil {
+		writeEvent(w, "error", record)
+	} else {
+		writeEvent(w, "done", record)
+	}
+	flusher.Flush()
+}
+
+func (s *apiServer) handleSwitchBackend(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Backend string `json:"backend"`
+	}
+	if !decodeBody(w, r, &req, false) {
+		return
+	}
+	if req.Backend == "" {
+		writeError(w, http.StatusBadRequest, "backend is required")
+		return
+	}
+
+	backendName, model, err := s.switchSessionBackend(r.Context(), r.PathValue("id"), req.Backend)
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"backend": backendName, "model": model})
+}
+
+// requestError is an error in what a client asked for, answered with 400
+type requestError struct {
+	message string
+}
+
+func (e *requestError) Error() string {
+	return e.message
+}
+
+// accessError is a request outside the scopes of a tenant, answered with 403
+type accessError struct {
+	message string
+}
+
+func (e *accessError) Error() string {
+	return e.message
+}
+
+// Errors answered with 404 and 429
+var (
+	errSessionNotFound = errors.New("session not found")
+	errQuotaExceeded   = errors.New("usage quota exceeded")
+)
+
+// allowBackend checks that the client of ctx may use a backend
+func allowBackend(ctx context.Context, backendName string) error {
+	if client := clientFrom(ctx); client != nil && !client.tenant.AllowsBackend(backendName) {
+		return &accessError{fmt.Sprintf("backend %s is not allowed for tenant %s", backendName, client.name)}
+	}
+	return nil
+}
+
+// createSession creates and saves a session on a backend or model alias and
+// with a persona, both optional. A tenant's session belongs to it and
+// defaults to its first backend if the configured one is out of scope.
+func (s *apiServer) createSession(ctx context.Context, backendName, personaName string) (*session.Session, error) {
+	sess := s.bot.newSession()
+	if client := clientFrom(ctx); client != nil {
+		sess.Tenant = client.name
+		if !client.tenant.AllowsBackend(sess.Backend) {
+			sess.Backend = client.tenant.Backends[0]
+		}
+	}
+	if backendName != "" {
+		if err := allowBackend(ctx, s.bot.resolveBackend(backendName)); err != nil {
+			return nil, err
+		}
+		s.bot.mu.Lock()
+		_, _, err := s.bot.switchBackend(sess, backendName)
+		s.bot.mu.Unlock()
+		if err != nil {
+			return nil, &requestError{err.Error()}
+		}
+	}
+	if personaName != "" {
+		// A persona's model applies as it does with /persona
+		s.bot.mu.Lock()
+		persona, ok := s.bot.cfg().Persona(personaName)
+		var err, scopeErr error
+		if ok && persona.Model != "" {
+			var resolved, model string
+			resolved, model, err = s.bot.cfg().ResolveModelRef(persona.Model)
+			if err == nil {
+				scopeErr = allowBackend(ctx, resolved)
+			}
+			if err == nil && scopeErr == nil {
+				sess.Backend, sess.Model = resolved, model
+			}
+		}
+		s.bot.mu.Unlock()
+		if !ok {
+			return nil, &requestError{"unknown persona " + personaName}
+		}
+		if err != nil {
+			return nil, &requestError{fmt.Sprintf("persona %s: %v", personaName, err)}
+		}
+		if scopeErr != nil {
+			return nil, scopeErr
+		}
+		sess.Persona = personaName
+	}
+
+	if err := s.bot.forSession(sess).saveSession(); err != nil {
+		return nil, err
+	}
+	return sess, nil
+}
+
+// loadSession loads a session with its last limit messages (every message
+// when limit <= 0), failing with errSessionNotFound. Tenants can't tell
+// other tenants' sessions from missing ones.
+func (s *apiServer) loadSession(ctx context.Context, id string, limit int) (*session.Session, error) {
+	sess, err := s.bot.loadSessionPage(id, limit)
+	if err != nil {
+		s.bot.logger.Warn("failed to load session", "session_id", id, "error", err)
+		return nil, fmt.Errorf("%w: %s", errSessionNotFound, id)
+	}
+	if client := clientFrom(ctx); client != nil && sess.Tenant != client.name {
+		s.bot.logger.Warn("tenant denied access to session", "session_id", id, "tenant", client.name)
+		return nil, fmt.Errorf("%w: %s", errSessionNotFound, id)
+	}
+	return sess, nil
+}
+
+// switchSessionBackend switches a session to a backend or model alias and
+// returns the backend and model
+func (s *apiServer) switchSessionBackend(ctx context.Context, id, name string) (string, string, error) {
+	unlock, err := s.locks.Acquire(ctx, id)
+	if err != nil {
+		return "", "", err
+	}
+	defer unlock()
+
+	sess, err := s.loadSession(ctx, id, s.bot.cfg().PageSize)
+	if err != nil {
+		return "", "", err
+	}
+	if err := allowBackend(ctx, s.bot.resolveBackend(name)); err != nil {
+		return "", "", err
+	}
+	s.bot.mu.Lock()
+	fromBackend, fromModel := sess.Backend, s.bot.sessionModel(sess)
+	backendName, model, err := s.bot.switchBackend(sess, name)
+	s.bot.mu.Unlock()
+	if err != nil {
+		return "", "", &requestError{err.Error()}
+	}
+	recordSwitch(sess, fromBackend, fromModel, backendName, model)
+	if err := s.bot.forSession(sess).saveSession(); err != nil {
+		return "", "", err
+	}
+	s.bot.logger.Info("switched session backend", "session_id", id, "backend", backendName, "model", model)
+	return backendName, model, nil
+}
+
+// turnStart is the first event of a streamed turn
+type turnStart struct {
+	Type      string `json:"type"` // start
+	SessionID string `json:"session_id"`
+	Backend   string `json:"backend"`
+	Model     string `json:"model"`
+}
+
+// runTurn runs a turn against a session within the scopes of the client of
+// ctx. started, when not nil, is called once the session is loaded, and
+// emit gets the turn's events as they happen. Errors before the turn starts
+// come without a record.
+func (s *apiServer) runTurn(ctx context.Context, id, prompt string, started func(turnStart), emit func(turnEvent)) (*turnRecord, error) {
+	// Turns against a session queue up, and the lock is held until the
+	// turn's save so the next one loads the saved version
+	unlock, err := s.locks.Acquire(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	sess, err := s.loadSession(ctx, id, s.bot.cfg().PageSize)
+	if err == nil {
+		err = allowBackend(ctx, sess.Backend)
+	}
+	if err == nil {
+		err = s.checkQuota(ctx)
+	}
+	if err != nil {
+		unlock()
+		return nil, err
+	}
+	view := s.bot.forSession(sess)
+	if client := clientFrom(ctx); client != nil {
+		// Tools out of scope are neither offered to the model nor found
+		// when it calls them anyway
+		var tools []mcp.Tool
+		for _, tool := range view.mcpTools {
+			if client.tenant.AllowsTool(tool.Name) {
+				tools = append(tools, tool)
+			}
+		}
+		view.mcpTools = tools
+	}
+	defer func() {
+		go func() {
+			view.turnJobs.Wait()
+			unlock()
+		}()
+	}()
+
+	if started != nil {
+		view.mu.Lock()
+		start := turnStart{
+			Type:      "start",
+			SessionID: view.session.ID,
+			Backend:   view.session.Backend,
+			Model:     view.sessionModel(view.session),
+		}
+		view.mu.Unlock()
+		started(start)
+	}
+	if emit != nil {
+		ctx = withTurnEvents(ctx, emit)
+	}
+	record, err := view.recordTurn(ctx, prompt)
+	if errors.Is(err, errStopped) && record.Truncated {
+		// A stopped turn is done, with what was streamed of the reply
+		err = nil
+	}
+	return record, err
+}
+
+// errorStatus returns the HTTP status for an error of a request
+func errorStatus(err error) int {
+	var reqErr *requestError
+	var accessErr *accessError
+	switch {
+	case errors.As(err, &reqErr):
+		return http.StatusBadRequest
+	case errors.As(err, &accessErr):
+		return http.StatusForbidden
+	case errors.Is(err, errSessionNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, errQuotaExceeded):
+		return http.StatusTooManyRequests
+	case errors.Is(err, session.ErrVersionConflict), errors.Is(err, session.ErrSessionBusy):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+// fail answers a request with the status for err. Internal errors are
+// logged, and their details are not sent.
+func (s *apiServer) fail(w http.ResponseWriter, err error) {
+	status := errorStatus(err)
+	if status == http.StatusInternalServerError {
+		s.internalError(w, err)
+		return
+	}
+	var quotaErr *quotaError
+	if errors.As(err, &quotaErr) {
+		setRetryAfter(w, quotaErr)
+	}
+	writeError(w, status, err.Error())
+}
+
+// internalError logs err and answers 500 without the details
+func (s *apiServer) internalError(w http.ResponseWriter, err error) {
+	s.bot.logger.Error("API request failed", "error", err)
+	writeError(w, http.StatusInternalServerError, "internal error")
+}
+
+// decodeBody reads a JSON request body into v, answering 400 if it is
+// malformed. With optional, an empty body leaves v as is.
+func decodeBody(w http.ResponseWriter, r *http.Request, v interface{}, optional bool) bool {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBody))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(v)
+	if err == nil || (optional && errors.Is(err, io.EOF)) {
+		return true
+	}
+	writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+// writeEvent writes a server-sent event with v as JSON data
+func writeEvent(w io.Writer, event string, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		data = []byte(`{}`)
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+}
@@ -0,0 +1,146 @@
+package chatbot
+
+import (
+	"fmt"
+	"strings"
+
+	"ExtraChat/internal/config"
+	"ExtraChat/internal/telemetry"
+)
+
+// handleConfigCommand handles /config show [prefix] and
+// /config set [--save] <key> <value>
+func (cb *ChatBot) handleConfigCommand(args []string) error {
+	if len(args) == 0 || args[0] == "show" {
+		prefix := ""
+		if len(args) > 1 {
+			prefix = args[1]
+		}
+		cb.showConfig(prefix)
+		return nil
+	}
+	if args[0] != "set" {
+		return fmt.Errorf("usage: /config show [prefix] | /config set [--save] <key> <value>")
+	}
+
+	args = args[1:]
+	save := len(args) > 0 && args[0] == "--save"
+	if save {
+		args = args[1:]
+	}
+	if len(args) < 2 {
+		return fmt.Errorf("usage: /config set [--save] <key> <value>")
+	}
+	return cb.setConfig(args[0], strings.Join(args[1:], " "), save)
+}
+
+// showConfig prints the current value of every setting whose key starts
+// with prefix
+func (cb *ChatBot) showConfig(prefix string) {
+	cfg := *cb.cfg()
+
+	if cfg.ConfigFile != "" {
+		fmt.Printf("\nConfig file: %s\n", cfg.ConfigFile)
+	} else {
+		fmt.Println("\nConfig file: none")
+	}
+	for _, setting := range config.Settings() {
+		if !strings.HasPrefix(setting.Key, prefix) {
+			continue
+		}
+		note := ""
+		if setting.Restart {
+			note = "  (restart required)"
+		}
+		fmt.Printf("  %-30s %s%s\n", setting.Key, setting.Format(cfg), note)
+	}
+	fmt.Println()
+}
+
+// setConfig changes a setting in the live configuration and, with save,
+// in the config file
+func (cb *ChatBot) setConfig(key, value string, save bool) error {
+	setting, ok := config.LookupSetting(key)
+	if !ok {
+		return fmt.Errorf("unknown setting %q (see /config show)", key)
+	}
+
+	cb.reloadMu.Lock()
+	defer cb.reloadMu.Unlock()
+
+	cb.mu.Lock()
+	previous := *cb.cfg()
+	updated := previous
+	if err := setting.Set(&updated, value); err != nil {
+		cb.mu.Unlock()
+		return err
+	}
+	cb.config.Store(&updated)
+	if key == "backend" {
+		cb.session.Backend, cb.session.Model = updated.Backend, ""
+	}
+	cb.mu.Unlock()
+
+	if !setting.Restart {
+		cb.applyLiveChanges(previous, updated)
+	}
+
+	cb.logger.Info("config setting changed", "key", key, "value", setting.Format(updated))
+	fmt.Printf("%s = %s\n", key, setting.Format(updated))
+	if setting.Restart {
+		fmt.Println("This setting takes effect after a restart.")
+	}
+	if !save {
+		return nil
+	}
+
+	path := updated.ConfigFile
+	if path == "" {
+		var err error
+		if path, err = config.DefaultConfigPath(); err != nil {
+			return err
+		}
+	}
+	if err := config.SaveSetting(path, key, setting.Value(updated)); err != nil {
+		return fmt.Errorf("failed to save setting: %w", err)
+	}
+
+	cb.mu.Lock()
+	cb.updateConfig(func(c *config.Config) { c.ConfigFile = path })
+	cb.mu.Unlock()
+	fmt.Printf("Saved to %s\n", path)
+	return nil
+}
+
+// handleDebugCommand handles /debug [on|off], which switches the application
+// log to debug level and back without a restart
+func (cb *ChatBot) handleDebugCommand(args []string) error {
+	if len(args) == 0 {
+		fmt.Printf("Log level: %s\n", strings.ToLower(telemetry.LogLevel().String()))
+		return nil
+	}
+
+	var debug bool
+	switch args[0] {
+	case "on":
+		debug = true
+	case "off":
+		debug = false
+	default:
+		return fmt.Errorf("usage: /debug [on|off]")
+	}
+
+	cb.reloadMu.Lock()
+	defer cb.reloadMu.Unlock()
+
+	cb.mu.Lock()
+	previous := *cb.cfg()
+	cb.updateConfig(func(c *config.Config) { c.Debug = debug })
+	updated := *cb.cfg()
+	cb.mu.Unlock()
+
+	cb.applyLiveChanges(previous, updated)
+	cb.logger.Info("debug logging toggled", "debug", debug, "log_level", updated.SlogLevel().String())
+	fmt.Printf("Debug logging %s (log level: %s)\n", args[0], strings.ToLower(updated.SlogLevel().String()))
+	return nil
+}
@@ -0,0 +1,236 @@
+package chatbot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	"ExtraChat/internal/guard"
+)
+
+// Turn outcomes, the error classes of the llm.turn.duration histogram
+const (
+	outcomeOK          = "ok"
+	outcomeRateLimited = "rate_limited"
+	outcomeAuthError   = "auth_error"
+	outcomeTimeout     = "timeout"
+	outcomeCancelled   = "cancelled"
+	outcomeBlocked     = "blocked" // Stopped by the guardrails
+	outcomeError       = "error"
+)
+
+// outcomes lists the turn outcomes in display order
+var outcomes = []string{outcomeOK, outcomeRateLimited, outcomeAuthError, outcomeTimeout, outcomeCancelled, outcomeBlocked, outcomeError}
+
+// turnStatsWindow caps the latency samples kept per backend and model
+const turnStatsWindow = 1000
+
+// apiError is a non-200 response from an LLM API
+type apiError struct {
+	op         string
+	StatusCode int
+	Status     string
+	Body       string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("%s: %s - %s", e.op, e.Status, e.Body)
+}
+
+// newAPIError builds the error for a failed API response
+func newAPIError(op string, resp *http.Response, body []byte) error {
+	return &apiError{op: op, StatusCode: resp.StatusCode, Status: resp.Status, Body: string(body)}
+}
+
+// classifyOutcome maps the result of a turn to its outcome label
+func classifyOutcome(err error) string {
+	if err == nil {
+		return outcomeOK
+	}
+
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		switch apiErr.StatusCode {
+		case http.StatusTooManyRequests:
+			return outcomeRateLimited
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return outcomeAuthError
+		case http.StatusRequestTimeout, http.StatusGatewayTimeout:
+			return outcomeTimeout
+		}
+		return outcomeError
+	}
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return outcomeTimeout
+	}
+	if errors.Is(err, context.Canceled) {
+		return outcomeCancelled
+	}
+	var violation *guard.Violation
+	if errors.As(err, &violation) {
+		return outcomeBlocked
+	}
+	return outcomeError
+}
+
+// turnKey identifies the backend and model of a turn
+type turnKey struct {
+	backend string
+	model   string
+}
+
+// turnSeries holds the turns of one backend and model in this run
+type turnSeries struct {
+	latencies []time.Duration // Most recent last, at most turnStatsWindow
+	outcomes  map[string]int
+}
+
+// turnStats tracks chat turn latency and outcomes for /stats and exports
+// them as OTel metrics
+type turnStats struct {
+	mu     sync.Mutex
+	series map[turnKey]*turnSeries
+
+	duration metric.Float64Histogram
+}
+
+// newTurnStats creates the turn tracker and registers its histogram
+func newTurnStats(meter metric.Meter) (*turnStats, error) {
+	s := &turnStats{series: make(map[turnKey]*turnSeries)}
+
+	var err error
+	s.duration, err = meter.Float64Histogram(
+		"llm.turn.duration",
+		metric.WithDescription("Chat turn duration in milliseconds, by backend, model and outcome"),
+		metric.WithUnit("ms"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create turn duration histogram: %w", err)
+	}
+	return s, nil
+}
+
+// record stores the latency and outcome of a turn and updates the metrics
+func (s *turnStats) record(ctx context.Context, target llmTarget, latency time.Duration, err error) {
+	if s == nil {
+		return
+	}
+
+	outcome := classifyOutcome(err)
+	s.duration.Record(ctx, float64(latency.Microseconds())/1000, metric.WithAttributes(
+		attribute.String("backend", target.Backend),
+		attribute.String("model", target.Model),
+		attribute.String("outcome", outcome),
+	))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := turnKey{backend: target.Backend, model: target.Model}
+	series, ok := s.series[key]
+	if !ok {
+		series = &turnSeries{outcomes: make(map[string]int)}
+		s.series[key] = series
+	}
+	series.outcomes[outcome]++
+	series.latencies = append(series.latencies, latency)
+	if len(series.latencies) > turnStatsWindow {
+		series.latencies = series.latencies[len(series.latencies)-turnStatsWindow:]
+	}
+}
+
+// median returns the median latency of the recent turns of a backend and
+// model, or 0 if there were none
+func (s *turnStats) median(backendName, model string) time.Duration {
+	if s == nil {
+		return 0
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	series, ok := s.series[turnKey{backend: backendName, model: model}]
+	if !ok {
+		return 0
+	}
+	sorted := append([]time.Duration(nil), series.latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return percentile(sorted, 50)
+}
+
+// percentile returns the nearest-rank p-th percentile of sorted latencies
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(p/100*float64(len(sorted))+0.5) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
+
+// handleStatsCommand handles /stats: turn count, p50/p95 latency and error
+// classes per backend and model since startup, then connection reuse
+func (cb *ChatBot) handleStatsCommand() error {
+	if cb.turnStats == nil {
+		fmt.Println("Turn statistics are not available.")
+		return nil
+	}
+
+	s := cb.turnStats
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.series) == 0 {
+		fmt.Println("No turns yet.")
+		return nil
+	}
+
+	keys := make([]turnKey, 0, len(s.series))
+	for key := range s.series {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].backend != keys[j].backend {
+			return keys[i].backend < keys[j].backend
+		}
+		return keys[i].model < keys[j].model
+	})
+
+	fmt.Println("\nTurn latency since startup:")
+	fmt.Printf("%-10s %-32s %6s %9s %9s  %s\n", "BACKEND", "MODEL", "TURNS", "P50", "P95", "OUTCOMES")
+	for _, key := range keys {
+		series := s.series[key]
+		sorted := append([]time.Duration(nil), series.latencies...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+		turns := 0
+		var counts []string
+		for _, outcome := range outcomes {
+			if n := series.outcomes[outcome]; n > 0 {
+				turns += n
+				counts = append(counts, fmt.Sprintf("%s=%d", outcome, n))
+			}
+		}
+		fmt.Printf("%-10s %-32s %6d %9s %9s  %s\n", key.backend, key.model, turns,
+			formatSpanDuration(percentile(sorted, 50)), formatSpanDuration(percentile(sorted, 95)), strings.Join(counts, " "))
+	}
+	fmt.Println()
+	cb.printConnectionStats()
+	return nil
+}
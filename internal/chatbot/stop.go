@@ -0,0 +1,123 @@
+package chatbot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"ExtraChat/internal/config"
+	"ExtraChat/internal/session"
+)
+
+// errStopped is the cause of a turn the user stopped with Esc, /stop or a
+// WebSocket stop message. Unlike a cancelled turn, it keeps the reply
+// streamed so far.
+var errStopped = errors.New("stopped by the user")
+
+// stopSequencesKey is the context key for the stop sequences of one request
+type stopSequencesKey struct{}
+
+// withStopSequences makes the requests of ctx end replies at stop instead of
+// the configured stop sequences
+func withStopSequences(ctx context.Context, stop []string) context.Context {
+	return context.WithValue(ctx, stopSequencesKey{}, stop)
+}
+
+// stopSequences returns the sequences that end replies to the requests of
+// ctx: its own, or else the configured ones
+func (cb *ChatBot) stopSequences(ctx context.Context) []string {
+	if stop, ok := ctx.Value(stopSequencesKey{}).([]string); ok {
+		return stop
+	}
+	return cb.cfg().StopSequences
+}
+
+// ollamaOptions returns the options of an Ollama request of ctx, with its
+// stop sequences after those of the ollama section
+func (cb *ChatBot) ollamaOptions(ctx context.Context) map[string]interface{} {
+	options := cb.cfg().OllamaOptions.Options()
+	if stop := cb.stopSequences(ctx); len(stop) > 0 {
+		if options == nil {
+			options = make(map[string]interface{})
+		}
+		options["stop"] = append(slices.Clone(cb.cfg().OllamaOptions.Stop), stop...)
+	}
+	return options
+}
+
+// cutAtStop ends a reply before the first of the stop sequences in it, as
+// the backends do
+func cutAtStop(reply string, stop []string) string {
+	for _, s := range stop {
+		if i := strings.Index(reply, s); i >= 0 {
+			reply = reply[:i]
+		}
+	}
+	return reply
+}
+
+// captureTokens keeps a copy of the tokens streamed by the turn ctx belongs
+// to, returning the reply streamed so far. A turn without an event sink
+// isn't streamed, so nothing is captured.
+func captureTokens(ctx context.Context) (context.Context, func() string) {
+	emit := turnEventsFrom(ctx)
+	if emit == nil {
+		return ctx, func() string { return "" }
+	}
+	var mu sync.Mutex
+	var streamed strings.Builder
+	ctx = withTurnEvents(ctx, func(event turnEvent) {
+		if event.Type == "token" {
+			mu.Lock()
+			streamed.WriteString(event.Text)
+			mu.Unlock()
+		}
+		emit(event)
+	})
+	return ctx, func() string {
+		mu.Lock()
+		defer mu.Unlock()
+		return streamed.String()
+	}
+}
+
+// stoppedError is returned for a reply the user stopped after part of it
+// was streamed; the turn keeps that part, marked as truncated
+type stoppedError struct {
+	partial string
+}
+
+func (e *stoppedError) Error() string { return "reply " + errStopped.Error() }
+func (e *stoppedError) Unwrap() error { return errStopped }
+
+// sendStoppable sends the conversation to the target backend like
+// sendToBackend, returning a stoppedError with the reply streamed so far
+// when the user stopped it
+func (cb *ChatBot) sendStoppable(ctx context.Context, target llmTarget, messages []session.Message) (string, error) {
+	ctx, partial := captureTokens(ctx)
+	response, err := cb.sendToBackend(ctx, target, messages)
+	if err != nil && errors.Is(context.Cause(ctx), errStopped) {
+		if streamed := partial(); strings.TrimSpace(streamed) != "" {
+			return "", &stoppedError{partial: streamed}
+		}
+	}
+	return response, err
+}
+
+// handleStopCommand handles /stop at the prompt. While a reply is generated,
+// the REPL watches for /stop itself, so there is nothing to stop here.
+func (cb *ChatBot) handleStopCommand() error {
+	fmt.Println("No reply is being generated; /stop and Esc stop one while it is.")
+	return nil
+}
+
+// validStopSequences checks the stop sequences of an API request
+func validStopSequences(stop []string) error {
+	if err := config.ValidStopSequences(stop); err != nil {
+		return &requestError{err.Error()}
+	}
+	return nil
+}
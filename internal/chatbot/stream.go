@@ -0,0 +1,237 @@
+package chatbot
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"ExtraChat/internal/backend"
+)
+
+// maxStreamLine bounds a line of a streamed backend response
+const maxStreamLine = 1 << 20
+
+// turnEvent is something that happens during a turn, sent to API clients
+// as it happens
+type turnEvent struct {
+	Type    string                 `json:"type"`               // token, tool_call or tool_result
+	Text    string                 `json:"text,omitempty"`     // token: the next piece of the reply
+	ToolID  string                 `json:"tool_id,omitempty"`  // tool_*: pairs a call with its result
+	Tool    string                 `json:"tool,omitempty"`     // tool_*
+	Input   map[string]interface{} `json:"input,omitempty"`    // tool_call
+	Result  string                 `json:"result,omitempty"`   // tool_result
+	IsError bool                   `json:"is_error,omitempty"` // tool_result
+}
+
+// turnEventsKey is the context key for the event sink of the turn in flight
+type turnEventsKey struct{}
+
+// withTurnEvents makes the turn run with ctx report its events to emit,
+// which must be safe for concurrent use. Backends stream their replies
+// only for such turns.
+func withTurnEvents(ctx context.Context, emit func(turnEvent)) context.Context {
+	return context.WithValue(ctx, turnEventsKey{}, emit)
+}
+
+// turnEventsFrom returns the event sink of the turn ctx belongs to, or nil
+func turnEventsFrom(ctx context.Context) func(turnEvent) {
+	emit, _ := ctx.Value(turnEventsKey{}).(func(turnEvent))
+	return emit
+}
+
+// emitToken reports the next piece of a streamed reply
+func emitToken(emit func(turnEvent), text string) {
+	if text != "" {
+		emit(turnEvent{Type: "token", Text: text})
+	}
+}
+
+// readSSE calls handle with the event name and data of each server-sent
+// event in r
+func readSSE(r io.Reader, handle func(event string, data []byte) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxStreamLine)
+	var event string
+	var data [][]byte
+
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			// An empty line terminates the current event
+			if len(data) > 0 {
+				if err := handle(event, bytes.Join(data, []byte("\n"))); err != nil {
+					return err
+				}
+			}
+			event, data = "", nil
+			continue
+		}
+		field, value, _ := strings.Cut(string(line), ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			event = value
+		case "data":
+			data = append(data, []byte(value))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if len(data) > 0 {
+		return handle(event, bytes.Join(data, []byte("\n")))
+	}
+	return nil
+}
+
+// readOpenAIStream assembles a streamed chat completion into a response,
+// emitting the reply as it arrives
+func readOpenAIStream(r io.Reader, emit func(turnEvent)) (backend.OpenAIResponse, error) {
+	var apiResp backend.OpenAIResponse
+	var content strings.Builder
+	var finishReason string
+
+	err := readSSE(r, func(_ string, data []byte) error {
+		if string(data) == "[DONE]" {
+			return nil
+		}
+		var chunk struct {
+			backend.OpenAIResponse
+			Error *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal(data, &chunk); err != nil {
+			return fmt.Errorf("failed to unmarshal stream chunk: %w", err)
+		}
+		if chunk.Error != nil {
+			return fmt.Errorf("stream error: %s", chunk.Error.Message)
+		}
+		apiResp.ID, apiResp.Model = chunk.ID, chunk.Model
+		if chunk.Usage != nil {
+			apiResp.Usage = chunk.Usage
+		}
+		for _, choice := range chunk.Choices {
+			if choice.Index != 0 {
+				continue
+			}
+			content.WriteString(choice.Delta.Content)
+			emitToken(emit, choice.Delta.Content)
+			if choice.FinishReason != "" {
+				finishReason = choice.FinishReason
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return apiResp, err
+	}
+
+	if content.Len() > 0 || finishReason != "" {
+		apiResp.Choices = []backend.OpenAIChoice{{
+			Message:      backend.OpenAIMessage{Role: "assistant", Content: content.String()},
+			FinishReason: finishReason,
+		}}
+	}
+	return apiResp, nil
+}
+
+// readOllamaStream assembles a streamed Ollama chat response, one JSON
+// object per line, emitting the reply as it arrives
+func readOllamaStream(r io.Reader, emit func(turnEvent)) (backend.OllamaResponse, error) {
+	var apiResp backend.OllamaResponse
+	var content strings.Builder
+
+	decoder := json.NewDecoder(r)
+	for {
+		var chunk backend.OllamaResponse
+		if err := decoder.Decode(&chunk); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return apiResp, fmt.Errorf("failed to unmarshal stream chunk: %w", err)
+		}
+		if chunk.Error != "" {
+			return apiResp, fmt.Errorf("stream error: %s", chunk.Error)
+		}
+		content.WriteString(chunk.Message.Content)
+		emitToken(emit, chunk.Message.Content)
+		if chunk.Done {
+			apiResp = chunk
+			break
+		}
+	}
+
+	apiResp.Message.Role = "assistant"
+	apiResp.Message.Content = content.String()
+	return apiResp, nil
+}
+
+// readAnthropicStream assembles a streamed Messages API response, tool_use
+// blocks included, emitting text as it arrives
+func readAnthropicStream(r io.Reader, emit func(turnEvent)) (backend.AnthropicResponse, error) {
+	var apiResp backend.AnthropicResponse
+	inputs := make(map[int]*strings.Builder) // Partial JSON input of tool_use blocks
+
+	err := readSSE(r, func(_ string, data []byte) error {
+		var event backend.AnthropicStreamEvent
+		if err := json.Unmarshal(data, &event); err != nil {
+			return fmt.Errorf("failed to unmarshal stream event: %w", err)
+		}
+
+		switch event.Type {
+		case "message_start":
+			apiResp = event.Message
+			apiResp.Content = nil
+		case "content_block_start":
+			for len(apiResp.Content) <= event.Index {
+				apiResp.Content = append(apiResp.Content, backend.AnthropicContent{})
+			}
+			apiResp.Content[event.Index] = event.ContentBlock
+			if event.ContentBlock.Type == "tool_use" {
+				inputs[event.Index] = &strings.Builder{}
+			}
+		case "content_block_delta":
+			if event.Index >= len(apiResp.Content) {
+				return fmt.Errorf("delta for unknown content block %d", event.Index)
+			}
+			switch event.Delta.Type {
+			case "text_delta":
+				apiResp.Content[event.Index].Text += event.Delta.Text
+				emitToken(emit, event.Delta.Text)
+			case "input_json_delta":
+				if input, ok := inputs[event.Index]; ok {
+					input.WriteString(event.Delta.PartialJSON)
+				}
+			}
+		case "content_block_stop":
+			input, ok := inputs[event.Index]
+			if !ok || event.Index >= len(apiResp.Content) {
+				return nil
+			}
+			block := &apiResp.Content[event.Index]
+			block.Input = map[string]interface{}{}
+			if input.Len() > 0 {
+				if err := json.Unmarshal([]byte(input.String()), &block.Input); err != nil {
+					return fmt.Errorf("failed to unmarshal input of tool %s: %w", block.Name, err)
+				}
+			}
+		case "message_delta":
+			apiResp.StopReason = event.Delta.StopReason
+			if apiResp.Usage == nil {
+				apiResp.Usage = map[string]interface{}{}
+			}
+			for key, value := range event.Usage {
+				apiResp.Usage[key] = value
+			}
+		case "error":
+			return fmt.Errorf("stream error: %s: %s", event.Error.Type, event.Error.Message)
+		}
+		return nil
+	})
+	return apiResp, err
+}
@@ -0,0 +1,110 @@
+package chatbot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"ExtraChat/internal/session"
+)
+
+// summaryPrompt asks for a title line followed by the summary, so that one
+// request serves /summarize save
+const summaryPrompt = "Summarize the following conversation concisely: the topics, decisions and open questions, in at most 5 sentences or bullet points. " +
+	"Start with a title of at most 6 words on its own line, then a blank line, then the summary.\n\n%s"
+
+// handleSummarizeCommand handles /summarize [save]: it summarizes the session
+// with the summarizer backend (the active one unless configured) and, with
+// save, stores the summary and title with the session
+func (cb *ChatBot) handleSummarizeCommand(args []string) error {
+	save := len(args) == 1 && args[0] == "save"
+	if len(args) > 0 && !save {
+		return fmt.Errorf("usage: /summarize [save]")
+	}
+
+	cb.mu.Lock()
+	sessionID := cb.session.ID
+	messages := append([]session.Message(nil), cb.session.Messages...)
+	older := cb.session.Older
+	budget := cb.cfg().ContextMaxTokens * bytesPerToken
+	cb.mu.Unlock()
+	if len(messages) == 0 {
+		fmt.Println("No messages in this session yet.")
+		return nil
+	}
+
+	// Long sessions keep their most recent messages within the context limit
+	first := len(messages)
+	for size := 0; first > 0; first-- {
+		size += len(messages[first-1].Content)
+		if size > budget && first < len(messages) {
+			break
+		}
+	}
+	transcript := formatTranscript(messages[first:])
+	if omitted := older + first; omitted > 0 {
+		transcript = fmt.Sprintf("(%d earlier messages omitted)\n%s", omitted, transcript)
+	}
+
+	target := cb.housekeepingTarget()
+	ctx, done := cb.interruptible(context.Background())
+	_, waited := cb.progress.start("summarizing with " + target.Backend)
+	reply, err := cb.runHousekeeping(ctx, "summary", fmt.Sprintf(summaryPrompt, transcript))
+	waited()
+	done()
+	if errors.Is(err, context.Canceled) {
+		fmt.Println("Summary cancelled.")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	title, summary := parseSummary(reply)
+	if summary == "" {
+		return fmt.Errorf("the summary came back empty")
+	}
+	if title != "" {
+		fmt.Printf("\n%s\n", title)
+	}
+	fmt.Printf("\n%s\n\n", summary)
+	if !save {
+		return nil
+	}
+
+	// An empty title keeps the current one
+	if _, err := cb.db.Exec(
+		"UPDATE sessions SET summary = ?, title = COALESCE(NULLIF(?, ''), title) WHERE id = ?",
+		summary, title, sessionID,
+	); err != nil {
+		return fmt.Errorf("failed to save summary: %w", err)
+	}
+	cb.mu.Lock()
+	if cb.session.ID == sessionID {
+		cb.session.Summary = summary
+		if title != "" {
+			cb.session.Title = title
+		}
+	}
+	cb.mu.Unlock()
+	cb.logger.Info("saved session summary", "session_id", sessionID, "title", title)
+	fmt.Println("Saved the summary and title with the session.")
+	return nil
+}
+
+// parseSummary splits a summary reply into its title line and the summary.
+// A reply without a separate title line is all summary.
+func parseSummary(reply string) (string, string) {
+	reply = strings.TrimSpace(reply)
+	head, rest, found := strings.Cut(reply, "\n")
+	if !found || strings.TrimSpace(rest) == "" {
+		return "", reply
+	}
+	head = strings.TrimSpace(head)
+	if len(head) >= 6 && strings.EqualFold(head[:6], "title:") {
+		head = head[6:]
+	}
+	head = strings.Trim(head, "# ")
+	return cleanTitle(head), strings.TrimSpace(rest)
+}
@@ -0,0 +1,153 @@
+package chatbot
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"ExtraChat/internal/config"
+	"ExtraChat/internal/session"
+)
+
+// historyShape counts what shapeHistory changed to fit a conversation to a
+// backend's API
+type historyShape struct {
+	system  int  // System messages moved into the system prompt
+	merged  int  // Messages merged into the one before, having the same role
+	tool    int  // Tool and other messages sent as the user's
+	leading bool // A user message was put before an opening assistant message
+}
+
+// String describes the changes, empty when there were none
+func (s historyShape) String() string {
+	var changes []string
+	if s.system > 0 {
+		changes = append(changes, fmt.Sprintf("%d system %s moved into the system prompt", s.system, plural(s.system, "message", "messages")))
+	}
+	if s.merged > 0 {
+		changes = append(changes, fmt.Sprintf("%d %s merged into the one before, to alternate roles", s.merged, plural(s.merged, "message", "messages")))
+	}
+	if s.tool > 0 {
+		changes = append(changes, fmt.Sprintf("%d tool %s sent as the user's", s.tool, plural(s.tool, "message", "messages")))
+	}
+	if s.leading {
+		changes = append(changes, "a user message added before the opening reply")
+	}
+	return strings.Join(changes, ", ")
+}
+
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
+
+// formatFor returns the message format of a backend's chat API
+func formatFor(backendName string) messageFormat {
+	if backendName == config.BackendAnthropic {
+		return anthropicFormat
+	}
+	return chatFormat
+}
+
+// shapeHistory fits a stored conversation to what a backend's chat API
+// accepts, returning the system prompt to send with it. Stored messages are
+// left alone, since the session may switch back.
+//
+// Both kinds of API take user and assistant messages. Messages of other
+// roles, such as the tool results of a provider the session used before,
+// answer no tool call of this one and are sent as the user's. The
+// Ollama and OpenAI-compatible APIs take system messages anywhere; Anthropic
+// takes the system prompt beside the messages and wants them to start with
+// the user and alternate, so system messages are appended to the system
+// prompt and messages of the same role in a row are merged.
+func shapeHistory(format messageFormat, system string, messages []session.Message) (string, []session.Message, historyShape) {
+	var shape historyShape
+	shaped := make([]session.Message, 0, len(messages))
+	for _, msg := range messages {
+		switch msg.Role {
+		case "user", "assistant":
+		case "system":
+			if format == anthropicFormat {
+				system = strings.TrimSpace(system + "\n\n" + msg.Content)
+				shape.system++
+				continue
+			}
+		default:
+			msg.Role, msg.Content = "user", fmt.Sprintf("[%s message]\n%s", msg.Role, msg.Content)
+			shape.tool++
+		}
+
+		if format == anthropicFormat {
+			if n := len(shaped); n > 0 && shaped[n-1].Role == msg.Role {
+				shaped[n-1].Content += "\n\n" + msg.Content
+				shape.merged++
+				continue
+			}
+			if len(shaped) == 0 && msg.Role == "assistant" {
+				// Keyed off the reply's ID so the conversation cache still finds it
+				shaped = append(shaped, session.Message{ID: msg.ID + "-lead", Role: "user", Content: "(continuing an earlier conversation)"})
+				shape.leading = true
+			}
+		}
+		shaped = append(shaped, msg)
+	}
+	return system, shaped, shape
+}
+
+// recordSwitch records a switch of sess to another backend or model as an
+// event after its latest message, and returns how the history is converted
+// for the new backend. Nothing is recorded when neither changed; for the
+// current session, callers must hold cb.mu.
+func recordSwitch(sess *session.Session, fromBackend, fromModel, toBackend, toModel string) string {
+	if fromBackend == toBackend && fromModel == toModel {
+		return ""
+	}
+	_, _, shape := shapeHistory(formatFor(toBackend), "", sess.Messages)
+	sess.AddEvent(session.Event{
+		Kind:   session.EventSwitch,
+		From:   fromBackend + "/" + fromModel,
+		To:     toBackend + "/" + toModel,
+		Detail: shape.String(),
+	})
+	return shape.String()
+}
+
+// encodeEvents formats a session's events for the database
+func encodeEvents(events []session.Event) (string, error) {
+	if len(events) == 0 {
+		return "", nil
+	}
+	data, err := json.Marshal(events)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode session events: %w", err)
+	}
+	return string(data), nil
+}
+
+// decodeEvents parses the events column of a session
+func decodeEvents(s string) ([]session.Event, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var events []session.Event
+	if err := json.Unmarshal([]byte(s), &events); err != nil {
+		return nil, fmt.Errorf("failed to decode session events: %w", err)
+	}
+	return events, nil
+}
+
+// printEvent shows a session event in a listing of its messages
+func printEvent(event session.Event) {
+	switch event.Kind {
+	case session.EventSwitch:
+		fmt.Printf("-- switched from %s to %s", event.From, event.To)
+		if event.Detail != "" {
+			fmt.Printf(" (%s)", event.Detail)
+		}
+		fmt.Println(" --")
+	default:
+		fmt.Printf("-- %s --\n", event.Kind)
+	}
+}
@@ -0,0 +1,75 @@
+package chatbot
+
+import (
+	"testing"
+
+	"ExtraChat/internal/config"
+	"ExtraChat/internal/session"
+)
+
+func TestShapeHistory(t *testing.T) {
+	history := []session.Message{
+		{ID: "m1", Role: "system", Content: "Be brief."},
+		{ID: "m2", Role: "assistant", Content: "Hello."},
+		{ID: "m3", Role: "user", Content: "first try"},
+		{ID: "m4", Role: "user", Content: "second try"},
+		{ID: "m5", Role: "tool", Content: "42"},
+	}
+	system, shaped, shape := shapeHistory(anthropicFormat, "Persona.", history)
+	if system != "Persona.\n\nBe brief." || len(shaped) != 3 || shaped[0].Role != "user" || shaped[1].Content != "Hello." ||
+		shaped[2].Content != "first try\n\nsecond try\n\n[tool message]\n42" {
+		t.Errorf("Anthropic history %q %+v", system, shaped)
+	}
+	if shape != (historyShape{system: 1, merged: 2, tool: 1, leading: true}) {
+		t.Errorf("conversion %+v", shape)
+	}
+	if _, shaped, _ := shapeHistory(chatFormat, "", history); len(shaped) != 5 || shaped[0].Role != "system" || shaped[4].Role != "user" {
+		t.Errorf("chat history %+v", shaped)
+	}
+}
+
+func TestSwitchIsSavedWithTheSession(t *testing.T) {
+	cb := newTestChatBot(t, Dependencies{})
+	cb.mu.Lock()
+	cb.session.AddMessage("user", "hi")
+	fromBackend, fromModel := cb.session.Backend, cb.sessionModel(cb.session)
+	backendName, model, err := cb.switchBackend(cb.session, config.BackendAnthropic)
+	if err != nil {
+		cb.mu.Unlock()
+		t.Fatal(err)
+	}
+	recordSwitch(cb.session, fromBackend, fromModel, backendName, model)
+	id, lastSeq := cb.session.ID, cb.session.Messages[0].Seq
+	cb.mu.Unlock()
+	if err := cb.saveSession(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := cb.loadSession(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Events) != 1 {
+		t.Fatalf("saved events %+v, want the switch", loaded.Events)
+	}
+	if e := loaded.Events[0]; e.Kind != session.EventSwitch || e.Seq != lastSeq || e.To != backendName+"/"+model {
+		t.Errorf("switch event %+v", e)
+	}
+}
+
+func TestSwitchToAliasKeepsTheModelOnTheSession(t *testing.T) {
+	cb := newTestChatBot(t, Dependencies{})
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.updateConfig(func(c *config.Config) { c.Aliases = map[string]string{"smart": "openai/gpt-test"} })
+
+	// API sessions need the alias's model as their own
+	sess := cb.newSession()
+	_, model, err := cb.switchBackend(sess, "smart")
+	if err != nil || model != "gpt-test" || sess.Model != "gpt-test" {
+		t.Errorf("switched to %q, session model %q (%v), want gpt-test", model, sess.Model, err)
+	}
+	if configured := cb.modelFor(config.BackendOpenAI); configured == "gpt-test" {
+		t.Error("the alias changed the configured OpenAI model")
+	}
+}
@@ -0,0 +1,55 @@
+package chatbot
+
+import (
+	"context"
+	"testing"
+
+	"ExtraChat/internal/mcp"
+)
+
+// listingClient is an MCP client that only lists tools
+type listingClient struct {
+	mcp.MCPClient
+	name  string
+	tools []string
+}
+
+func (c listingClient) Name() string { return c.name }
+func (c listingClient) Close() error { return nil }
+
+func (c listingClient) ListTools(ctx context.Context) ([]mcp.Tool, error) {
+	tools := make([]mcp.Tool, len(c.tools))
+	for i, name := range c.tools {
+		tools[i] = mcp.Tool{Name: name, ServerName: c.name}
+	}
+	return tools, nil
+}
+
+func TestToolNameCollisions(t *testing.T) {
+	cb := newTestChatBot(t, Dependencies{})
+	cb.mcpRegistry = mcp.NewClientRegistry()
+	cb.mcpRegistry.Register("tickets", listingClient{name: "tickets", tools: []string{"search", "close"}})
+	cb.mcpRegistry.Register("files", listingClient{name: "files", tools: []string{"search", "read"}})
+	if err := cb.refreshMCPTools(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Servers are listed by name, so files' search is the one offered
+	tools := cb.getMCPTools()
+	if len(tools) != 3 {
+		t.Fatalf("offered %+v, want one tool of each name", tools)
+	}
+	tool, client, err := cb.findMCPTool("search")
+	if err != nil || tool.ServerName != "files" || client.Name() != "files" {
+		t.Errorf("search resolved to %+v on %v, %v; want files", tool, client, err)
+	}
+
+	// Approving one server's tool for the run doesn't approve another's
+	cb.approvedTools[toolKey("tickets", "search")] = true
+	if cb.toolAutoApproved("files", "search") {
+		t.Error("files' search was approved with tickets' search")
+	}
+	if !cb.toolAutoApproved("tickets", "search") {
+		t.Error("tickets' search is not approved")
+	}
+}
@@ -0,0 +1,127 @@
+package chatbot
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxRecordedTraces is how many recent traces are kept in memory for /trace
+const maxRecordedTraces = 32
+
+// handleTraceCommand prints the trace ID of the last turn and, with "tree",
+// its span tree as recorded by the in-process span recorder
+func (cb *ChatBot) handleTraceCommand(args []string) error {
+	if !cb.cfg().TelemetryEnabled {
+		fmt.Println("Tracing is disabled (--no-telemetry).")
+		return nil
+	}
+
+	cb.mu.Lock()
+	traceID := cb.lastTraceID
+	cb.mu.Unlock()
+
+	if !traceID.IsValid() {
+		fmt.Println("No turns traced yet in this run.")
+		return nil
+	}
+
+	fmt.Printf("Last turn trace ID: %s\n", traceID)
+
+	if len(args) == 0 {
+		return nil
+	}
+	if args[0] != "tree" {
+		return fmt.Errorf("usage: /trace [tree]")
+	}
+
+	spans := cb.spanRecorder.Spans(traceID)
+	if len(spans) == 0 {
+		fmt.Println("No spans recorded for this trace.")
+		return nil
+	}
+
+	fmt.Println()
+	printSpanTree(spans)
+	fmt.Println()
+	return nil
+}
+
+// printSpanTree prints spans indented under their parents, showing each
+// span's offset from the start of the trace and its duration
+func printSpanTree(spans []sdktrace.ReadOnlySpan) {
+	byID := make(map[trace.SpanID]bool, len(spans))
+	children := make(map[trace.SpanID][]sdktrace.ReadOnlySpan)
+	var roots []sdktrace.ReadOnlySpan
+	for _, s := range spans {
+		byID[s.SpanContext().SpanID()] = true
+	}
+	for _, s := range spans {
+		parent := s.Parent().SpanID()
+		if s.Parent().IsValid() && byID[parent] {
+			children[parent] = append(children[parent], s)
+		} else {
+			roots = append(roots, s)
+		}
+	}
+
+	byStart := func(list []sdktrace.ReadOnlySpan) {
+		sort.Slice(list, func(i, j int) bool {
+			return list[i].StartTime().Before(list[j].StartTime())
+		})
+	}
+	byStart(roots)
+	if len(roots) == 0 {
+		return
+	}
+	traceStart := roots[0].StartTime()
+
+	var walk func(s sdktrace.ReadOnlySpan, depth int)
+	walk = func(s sdktrace.ReadOnlySpan, depth int) {
+		fmt.Printf("%s%-*s +%6s %8s%s%s\n",
+			strings.Repeat("  ", depth),
+			32-2*depth, s.Name(),
+			formatSpanDuration(s.StartTime().Sub(traceStart)),
+			formatSpanDuration(s.EndTime().Sub(s.StartTime())),
+			spanDetail(s),
+			spanStatus(s),
+		)
+		kids := children[s.SpanContext().SpanID()]
+		byStart(kids)
+		for _, kid := range kids {
+			walk(kid, depth+1)
+		}
+	}
+	for _, root := range roots {
+		walk(root, 0)
+	}
+}
+
+// spanDetail returns the most useful attribute of a span for display
+func spanDetail(s sdktrace.ReadOnlySpan) string {
+	for _, kv := range s.Attributes() {
+		switch kv.Key {
+		case "tool", "model":
+			return fmt.Sprintf("  %s=%s", kv.Key, kv.Value.Emit())
+		}
+	}
+	return ""
+}
+
+// spanStatus marks failed spans
+func spanStatus(s sdktrace.ReadOnlySpan) string {
+	if s.Status().Code == codes.Error {
+		return "  ERROR: " + s.Status().Description
+	}
+	return ""
+}
+
+// formatSpanDuration renders a duration in milliseconds
+func formatSpanDuration(d time.Duration) string {
+	return fmt.Sprintf("%dms", d.Milliseconds())
+}
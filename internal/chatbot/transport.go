@@ -0,0 +1,161 @@
+package chatbot
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	"ExtraChat/internal/config"
+	"ExtraChat/internal/web"
+)
+
+// apiPool is the connection pool of the embeddings, rerank and moderation
+// APIs, which aren't backends
+const apiPool = "api"
+
+// fetchPool is the connection pool of web pages fetched by /fetch and the
+// fetch_url tool
+const fetchPool = "fetch"
+
+// httpPool is the keep-alive connection pool of one backend. Requests that
+// aren't streamed are bounded by the overall timeout; streamed replies
+// aren't, since they last as long as the model writes.
+type httpPool struct {
+	name    string
+	base    http.RoundTripper // Sends the requests: the pooled transport, an injected one, or a recorder
+	request *http.Client
+	stream  *http.Client
+
+	opened      atomic.Int64 // Requests that opened a new connection
+	reused      atomic.Int64 // Requests sent on a kept-alive connection
+	connections metric.Int64Counter
+}
+
+// newHTTPPools creates a pool per backend and one for the other APIs.
+// An injected transport replaces the pooled ones.
+func newHTTPPools(cfg config.Config, injected http.RoundTripper, meter metric.Meter) (map[string]*httpPool, error) {
+	connections, err := meter.Int64Counter(
+		"http.client.connections",
+		metric.WithDescription("API requests by connection pool and whether they reused a kept-alive connection"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create connection counter: %w", err)
+	}
+
+	pools := make(map[string]*httpPool)
+	for _, name := range append(append([]string(nil), config.Backends...), apiPool, fetchPool) {
+		pool := &httpPool{name: name, base: injected, connections: connections}
+		if pool.base == nil {
+			pool.base = newTransport(cfg)
+		}
+		pool.request = &http.Client{Timeout: cfg.HTTPTimeout, Transport: pool}
+		pool.stream = &http.Client{Transport: pool}
+		pools[name] = pool
+	}
+	return pools, nil
+}
+
+// newTransport creates a pooled transport with the configured timeouts.
+// HTTP/2 is used where the server offers it; a custom dialer would
+// otherwise turn it off. Fetches of web pages are kept to public addresses
+// by the dialer.
+func newTransport(cfg config.Config) *http.Transport {
+	headerTimeout := cfg.HTTPHeaderTimeout
+	if headerTimeout == 0 {
+		headerTimeout = cfg.HTTPTimeout
+	}
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: web.DialContext(&net.Dialer{
+			Timeout:   cfg.HTTPDialTimeout,
+			KeepAlive: 30 * time.Second,
+		}),
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          cfg.HTTPMaxIdleConns * 2,
+		MaxIdleConnsPerHost:   cfg.HTTPMaxIdleConns,
+		IdleConnTimeout:       cfg.HTTPIdleTimeout,
+		TLSHandshakeTimeout:   cfg.HTTPTLSTimeout,
+		ResponseHeaderTimeout: headerTimeout,
+		ExpectContinueTimeout: time.Second,
+	}
+}
+
+// RoundTrip sends a request through the pool's transport, counting whether
+// it reused a connection
+func (p *httpPool) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				p.reused.Add(1)
+			} else {
+				p.opened.Add(1)
+			}
+			p.connections.Add(ctx, 1, metric.WithAttributes(
+				attribute.String("pool", p.name),
+				attribute.Bool("reused", info.Reused),
+			))
+		},
+	}
+	return p.base.RoundTrip(req.WithContext(httptrace.WithClientTrace(ctx, trace)))
+}
+
+// closeIdle closes the pool's idle connections
+func (p *httpPool) closeIdle() {
+	if closer, ok := p.base.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+}
+
+// httpClient returns the client for requests to a backend, or to the other
+// APIs for any other name; stream selects the one without an overall
+// timeout
+func (cb *ChatBot) httpClient(name string, stream bool) *http.Client {
+	pool, ok := cb.httpPools[name]
+	if !ok {
+		pool = cb.httpPools[apiPool]
+	}
+	if stream {
+		return pool.stream
+	}
+	return pool.request
+}
+
+// wrapTransports sends the requests of every pool through wrap, which is
+// given the pool's current transport
+func (cb *ChatBot) wrapTransports(wrap func(http.RoundTripper) http.RoundTripper) {
+	for _, pool := range cb.httpPools {
+		pool.base = wrap(pool.base)
+	}
+}
+
+// printConnectionStats prints, for /stats, how many requests of each pool
+// opened a connection and how many reused one
+func (cb *ChatBot) printConnectionStats() {
+	names := make([]string, 0, len(cb.httpPools))
+	for name, pool := range cb.httpPools {
+		if pool.opened.Load()+pool.reused.Load() > 0 {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return
+	}
+	sort.Strings(names)
+
+	fmt.Println("HTTP connections since startup:")
+	fmt.Printf("%-10s %8s %8s %7s\n", "POOL", "OPENED", "REUSED", "REUSE")
+	for _, name := range names {
+		pool := cb.httpPools[name]
+		opened, reused := pool.opened.Load(), pool.reused.Load()
+		fmt.Printf("%-10s %8d %8d %6.0f%%\n", name, opened, reused, float64(reused)*100/float64(opened+reused))
+	}
+	fmt.Println()
+}
@@ -0,0 +1,866 @@
+package chatbot
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/bubbles/spinner"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	"ExtraChat/internal/lineedit"
+	"ExtraChat/internal/session"
+	"ExtraChat/internal/telemetry"
+	"ExtraChat/internal/tui"
+)
+
+// tuiSessions is how many of the latest sessions the sidebar lists
+const tuiSessions = 100
+
+// terminalUI is the full-screen interface of --tui, a Bubble Tea program.
+// Everything the commands print goes to the conversation pane through a
+// pipe that replaces stdout, so they run as they do in the REPL; the turn
+// hooks of ChatBot reach the program as messages.
+type terminalUI struct {
+	cb      *ChatBot
+	program *tea.Program
+	term    *os.File      // The terminal, which stdout no longer is
+	out     *os.File      // The pipe that replaces stdout
+	flushed chan struct{} // Signalled when output has reached the pane
+	closed  chan struct{} // Closed once the program has quit
+	turns   sync.WaitGroup
+	flushMu sync.Mutex
+	askMu   sync.Mutex // Serializes questions on the input line
+}
+
+// tuiModel is the state of the interface, owned by the program's loop
+type tuiModel struct {
+	t   *terminalUI
+	ctx context.Context
+
+	width, height int
+	pane          tui.Pane
+	input         textinput.Model
+	spinner       spinner.Model
+
+	history []string // Of the input line, for Up/Down
+	histPos int
+	pending string // The unsubmitted line while browsing history
+	quick   bool   // Ctrl+K was pressed: Enter opens the quick switcher
+	hint    string // Completions listed by Tab, until the next key
+
+	sessions []tuiSession
+	branches []tuiSession // The fork tree of the current session
+	tree     bool         // The sidebar lists branches rather than sessions
+	selected int          // Sidebar item with the keyboard; -1 when the input line has it
+	shownID  string
+	target   string // Backend and model of the current session
+	usage    string
+
+	busy     time.Time // When the turn in flight started; zero at the prompt
+	activity string
+	turn     int // Pane block of the line the turn runs; -1 when none
+	reply    int // Pane block of the reply streaming in; -1 when none
+	output   int // Pane block printed output goes to; -1 starts another
+	stop     context.CancelCauseFunc
+
+	question string        // Prompt of the question being asked
+	answer   chan askReply // Where its answer goes; nil when none is asked
+	draft    string        // The input line put aside for the question
+}
+
+// tuiSession is a session listed in the sidebar, as one of the latest or a
+// line of the fork tree
+type tuiSession struct {
+	ID, Label string
+}
+
+// askReply is an answer typed on the input line
+type askReply struct {
+	line string
+	err  error
+}
+
+// Messages sent to the program from outside its loop
+type (
+	outputMsg   string    // Printed by a command
+	eventMsg    turnEvent // Of the turn in flight
+	replyMsg    string    // The finished reply
+	turnDoneMsg bool      // Whether the turn quits
+	watchMsg    struct{ stop context.CancelCauseFunc }
+	askMsg      struct {
+		prompt string
+		reply  chan askReply
+	}
+)
+
+// loadedMsg is what refreshing the sidebar, status bar and pane read
+type loadedMsg struct {
+	session  session.Session
+	target   string
+	usage    string
+	sessions []tuiSession
+	branches []tuiSession
+	tree     bool // Give the sidebar the keyboard, listing branches
+	turn     bool // Read after a turn, which may have switched sessions
+}
+
+// ansiSequence matches the color and cursor sequences of printed output,
+// which the pane draws as plain text
+var ansiSequence = regexp.MustCompile(`\x1b\[[0-9;?]*[A-Za-z]`)
+
+// RunTUI starts the chat bot in a full-screen interface: the sessions in a
+// sidebar, the conversation in a scrollable pane, and a status bar with the
+// backend, model and token usage above the input line
+func (cb *ChatBot) RunTUI() error {
+	defer cb.Close()
+
+	cb.openInput()
+	if !isTerminal(os.Stdin) || !isTerminal(os.Stdout) {
+		return errors.New("--tui needs a terminal")
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("failed to capture output: %w", err)
+	}
+	stdout, stderr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = w, w
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			os.Stdout, os.Stderr = stdout, stderr
+			w.Close()
+		})
+	}
+	defer release()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	t := &terminalUI{cb: cb, term: stdout, out: w, flushed: make(chan struct{}, 1), closed: make(chan struct{})}
+	t.program = tea.NewProgram(newTUIModel(ctx, t), tea.WithAltScreen(), tea.WithInput(os.Stdin), tea.WithOutput(stdout))
+	go t.copyOutput(r)
+	cb.progress = newProgressDisplay(io.Discard, true)
+	cb.tui = t
+
+	if !cb.cfg().SkipStartupChecks {
+		go cb.reportPreflight(ctx)
+	}
+	if cb.cfg().PprofAddr != "" {
+		addr, err := telemetry.StartPprof(ctx, cb.cfg().PprofAddr, cb.logger)
+		if err != nil {
+			return fmt.Errorf("failed to start pprof server: %w", err)
+		}
+		cb.pprofAddr = addr
+		fmt.Printf("pprof: http://%s/debug/pprof/\n", addr)
+	}
+	cb.printAttachments()
+	cb.warnShadowedCommands(*cb.cfg())
+	cb.startBackground(ctx)
+
+	final, runErr := t.program.Run()
+	if errors.Is(runErr, tea.ErrInterrupted) {
+		cb.logger.Info("received signal, shutting down", "signal", "interrupt")
+		runErr = nil
+	}
+	t.quit(final)
+	err = cb.saveSession()
+	release()
+	if runErr != nil {
+		return fmt.Errorf("terminal interface failed: %w", runErr)
+	}
+	if err != nil {
+		cb.logger.Error("failed to save session on exit", "error", err)
+		return err
+	}
+	fmt.Println("Goodbye!")
+	return nil
+}
+
+// quit ends the turn in flight, if any, once the program has quit, and
+// declines the question it may be asking
+func (t *terminalUI) quit(final tea.Model) {
+	close(t.closed)
+	if m, ok := final.(*tuiModel); ok && !m.busy.IsZero() {
+		if m.stop != nil {
+			m.stop(errStopped)
+		}
+		t.cb.interruptTurn()
+	}
+	t.turns.Wait()
+}
+
+// newTUIModel starts the interface at an empty input line
+func newTUIModel(ctx context.Context, t *terminalUI) *tuiModel {
+	input := textinput.New()
+	input.Prompt = "You: "
+	input.Focus()
+	history := t.cb.input.History()
+	return &tuiModel{
+		t:        t,
+		ctx:      ctx,
+		input:    input,
+		spinner:  spinner.New(spinner.WithSpinner(spinner.Dot)),
+		history:  history,
+		histPos:  len(history),
+		selected: -1,
+		turn:     -1,
+		reply:    -1,
+		output:   -1,
+	}
+}
+
+// Init loads the sessions and the conversation
+func (m *tuiModel) Init() tea.Cmd {
+	return tea.Batch(textinput.Blink, m.t.load)
+}
+
+// Update handles a key or a message from outside the loop
+func (m *tuiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		m.layout()
+		return m, nil
+	case tea.KeyMsg:
+		return m.handleKey(msg)
+	case outputMsg:
+		// Output continues its block until something else is added
+		if m.output < 0 || m.output != m.pane.Len()-1 {
+			m.output = m.pane.Append(string(msg))
+		} else {
+			m.pane.Extend(m.output, string(msg))
+		}
+		return m, nil
+	case eventMsg:
+		m.showEvent(turnEvent(msg))
+		return m, nil
+	case replyMsg:
+		if m.reply < 0 {
+			m.reply = m.pane.Append("")
+		}
+		m.pane.Set(m.reply, "Bot: "+string(msg))
+		m.reply, m.output = -1, -1
+		return m, nil
+	case watchMsg:
+		m.stop = msg.stop
+		return m, nil
+	case askMsg:
+		m.question, m.answer = msg.prompt, msg.reply
+		m.draft = m.input.Value()
+		m.input.Reset()
+		m.selected = -1
+		m.layout()
+		return m, m.input.Focus()
+	case turnDoneMsg:
+		m.busy, m.activity, m.reply = time.Time{}, "", -1
+		if msg {
+			return m, tea.Quit
+		}
+		t := m.t
+		return m, func() tea.Msg {
+			loaded := t.load().(loadedMsg)
+			loaded.turn = true
+			return loaded
+		}
+	case loadedMsg:
+		m.loaded(msg)
+		return m, nil
+	case spinner.TickMsg:
+		// The spinner, and the elapsed time with it, runs during a turn
+		if m.busy.IsZero() {
+			return m, nil
+		}
+		var cmd tea.Cmd
+		m.spinner, cmd = m.spinner.Update(msg)
+		return m, cmd
+	}
+	var cmd tea.Cmd
+	m.input, cmd = m.input.Update(msg)
+	return m, cmd
+}
+
+// handleKey acts on a key
+func (m *tuiModel) handleKey(k tea.KeyMsg) (tea.Model, tea.Cmd) {
+	m.hint = ""
+	if m.selected >= 0 {
+		return m, m.sidebarKey(k)
+	}
+
+	busy := !m.busy.IsZero()
+	switch k.String() {
+	case "ctrl+c":
+		switch {
+		case m.answer != nil:
+			m.answerWith("", lineedit.ErrInterrupt)
+		case busy:
+			if !m.t.cb.interruptTurn() {
+				return m, tea.Quit
+			}
+		case m.input.Value() != "" || m.quick:
+			m.clearInput()
+		default:
+			return m, tea.Quit
+		}
+		return m, nil
+	case "ctrl+d":
+		if !busy && m.answer == nil && m.input.Value() == "" {
+			return m, tea.Quit
+		}
+	case "esc":
+		if m.stop != nil {
+			m.stop(errStopped)
+		}
+		return m, nil
+	case "pgup":
+		m.pane.PageUp()
+		return m, nil
+	case "pgdown":
+		m.pane.PageDown()
+		return m, nil
+	case "ctrl+s":
+		m.focusSidebar(false)
+		return m, nil
+	case "ctrl+b":
+		return m, m.showBranches(busy)
+	case "ctrl+l":
+		return m, tea.ClearScreen
+	case "ctrl+k":
+		if m.answer == nil {
+			m.quick = !m.quick
+			m.layout()
+		}
+		return m, nil
+	case "up", "ctrl+p":
+		m.browse(-1)
+		return m, nil
+	case "down", "ctrl+n":
+		m.browse(1)
+		return m, nil
+	case "tab":
+		m.complete()
+		return m, nil
+	case "enter":
+		return m, m.submit(busy)
+	}
+	var cmd tea.Cmd
+	m.input, cmd = m.input.Update(k)
+	return m, cmd
+}
+
+// submit acts on Enter: it answers the question being asked, stops the
+// turn in flight on /stop, or runs the line as the REPL would
+func (m *tuiModel) submit(busy bool) tea.Cmd {
+	raw := m.input.Value()
+	switch {
+	case m.answer != nil:
+		m.answerWith(raw, nil)
+		return nil
+	case busy:
+		// As in the REPL, /stop is the one thing typed during a turn
+		if strings.TrimSpace(raw) == "/stop" && m.stop != nil {
+			m.input.Reset()
+			m.stop(errStopped)
+		}
+		return nil
+	}
+
+	quick := m.quick
+	m.clearInput()
+	if strings.TrimSpace(raw) == "" && !quick {
+		return nil
+	}
+	if quick {
+		raw = string(quickSwitchKey) + raw
+	}
+	cb := m.t.cb
+	if err := cb.input.AddHistory(raw); err != nil {
+		cb.logger.Warn("failed to save input history", "error", err)
+	}
+	m.history = cb.input.History()
+	m.histPos = len(m.history)
+
+	// The pane drops control characters, so Ctrl+K is shown as the REPL does
+	m.turn = m.pane.Append("You: " + strings.ReplaceAll(raw, string(quickSwitchKey), "^K"))
+	m.pane.GotoBottom()
+	m.output = -1
+	m.busy, m.activity = time.Now(), "Thinking"
+	m.t.turns.Add(1)
+	ctx := m.ctx
+	return tea.Batch(m.spinner.Tick, func() tea.Msg {
+		defer m.t.turns.Done()
+		quit := cb.handleLine(ctx, raw)
+		m.t.flush()
+		return turnDoneMsg(quit)
+	})
+}
+
+// clearInput empties the input line and starts browsing history from its
+// end again
+func (m *tuiModel) clearInput() {
+	m.input.Reset()
+	m.quick = false
+	m.histPos, m.pending = len(m.history), ""
+	m.layout()
+}
+
+// browse moves through history by step, keeping the unsubmitted line so
+// coming back down restores it
+func (m *tuiModel) browse(step int) {
+	next := m.histPos + step
+	if next < 0 || next > len(m.history) {
+		return
+	}
+	if m.histPos == len(m.history) {
+		m.pending = m.input.Value()
+	}
+	if next == len(m.history) {
+		m.input.SetValue(m.pending)
+	} else {
+		m.input.SetValue(m.history[next])
+	}
+	m.input.CursorEnd()
+	m.histPos = next
+}
+
+// complete extends the word before the cursor as far as all completions
+// agree, listing them in the status bar when that doesn't add anything
+func (m *tuiModel) complete() {
+	value := []rune(m.input.Value())
+	pos := m.input.Position()
+	insert, candidates := lineedit.Complete(m.t.cb.complete, string(value[:pos]))
+	if insert == "" {
+		m.hint = strings.Join(candidates, "  ")
+		return
+	}
+	m.input.SetValue(string(value[:pos]) + insert + string(value[pos:]))
+	m.input.SetCursor(pos + utf8.RuneCountInString(insert))
+}
+
+// answerWith answers the question on the input line
+func (m *tuiModel) answerWith(line string, err error) {
+	m.answer <- askReply{line: line, err: err}
+	m.question, m.answer = "", nil
+	m.input.SetValue(m.draft)
+	m.draft = ""
+	m.layout()
+}
+
+// showEvent streams a turn's reply into the pane and shows the tool it runs
+func (m *tuiModel) showEvent(ev turnEvent) {
+	switch ev.Type {
+	case "token":
+		if m.reply < 0 {
+			m.reply = m.pane.Append("Bot: ")
+			m.output = -1
+		}
+		m.pane.Extend(m.reply, ev.Text)
+		m.activity = "Replying"
+	case "tool_call":
+		m.activity = "Running " + ev.Tool
+	case "tool_result":
+		m.activity = "Thinking"
+	}
+}
+
+// listed returns the sessions the sidebar shows
+func (m *tuiModel) listed() []tuiSession {
+	if m.tree {
+		return m.branches
+	}
+	return m.sessions
+}
+
+// focusSidebar gives the sidebar the keyboard, listing the fork tree or the
+// latest sessions from the current one
+func (m *tuiModel) focusSidebar(tree bool) {
+	m.tree = tree
+	listed := m.listed()
+	if tui.SidebarWidth(m.width) == 0 || len(listed) == 0 {
+		m.selected = -1
+		return
+	}
+	m.selected = max(slices.IndexFunc(listed, func(s tuiSession) bool { return s.ID == m.shownID }), 0)
+	m.input.Blur()
+}
+
+// sidebarKey acts on a key while the sidebar has the keyboard
+func (m *tuiModel) sidebarKey(k tea.KeyMsg) tea.Cmd {
+	listed := m.listed()
+	switch k.String() {
+	case "up", "k":
+		m.selected = max(m.selected-1, 0)
+	case "down", "j":
+		m.selected = min(m.selected+1, len(listed)-1)
+	case "home":
+		m.selected = 0
+	case "end":
+		m.selected = len(listed) - 1
+	case "tab":
+		m.focusSidebar(!m.tree)
+	case "enter":
+		id := listed[m.selected].ID
+		m.selected = -1
+		if id != m.shownID {
+			return tea.Batch(m.input.Focus(), m.openSession(id))
+		}
+		return m.input.Focus()
+	case "esc", "ctrl+s", "ctrl+b", "ctrl+c":
+		m.selected = -1
+		return m.input.Focus()
+	}
+	return nil
+}
+
+// showBranches lists the fork tree of the current session in the sidebar.
+// As for /branches, the session is saved first so a new branch is in it.
+func (m *tuiModel) showBranches(busy bool) tea.Cmd {
+	t := m.t
+	return func() tea.Msg {
+		if !busy {
+			if err := t.cb.saveSession(); err != nil {
+				fmt.Printf("Error: failed to save current session: %v\n", err)
+			}
+		}
+		loaded := t.load().(loadedMsg)
+		loaded.tree = true
+		return loaded
+	}
+}
+
+// openSession switches to a session picked in the sidebar
+func (m *tuiModel) openSession(id string) tea.Cmd {
+	if !m.busy.IsZero() {
+		m.output = m.pane.Append("Error: wait for the reply, or stop it with Esc, before opening another session")
+		return nil
+	}
+	t := m.t
+	return func() tea.Msg {
+		cb := t.cb
+		if err := cb.saveSession(); err != nil {
+			fmt.Printf("Error: failed to save current session: %v\n", err)
+			return nil
+		}
+		sess, err := cb.loadSession(id)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return nil
+		}
+		cb.mu.Lock()
+		from := cb.session.ID
+		cb.session = sess
+		cb.mu.Unlock()
+		cb.logger.Info("switched session", "session_id", sess.ID, "from", from)
+		return t.load()
+	}
+}
+
+// loaded shows what load read, and the conversation when another session
+// is current
+func (m *tuiModel) loaded(msg loadedMsg) {
+	m.target, m.usage = msg.target, msg.usage
+	m.sessions, m.branches = msg.sessions, msg.branches
+	if m.selected >= len(m.listed()) {
+		m.selected = len(m.listed()) - 1
+	}
+	if msg.tree {
+		m.focusSidebar(true)
+	}
+	turn := -1
+	if msg.turn {
+		turn, m.turn = m.turn, -1
+	}
+	sess := &msg.session
+	if sess.ID == m.shownID {
+		return
+	}
+	// What the turn that switched sessions printed, such as the switch, is
+	// kept after the conversation
+	var printed []string
+	for i := turn + 1; turn >= 0 && i < m.pane.Len(); i++ {
+		printed = append(printed, m.pane.Text(i))
+	}
+	m.shownID = sess.ID
+	m.pane.Reset()
+	m.reply, m.output = -1, -1
+	m.pane.Append(sessionBanner(sess))
+	if sess.Older > 0 {
+		m.pane.Append(fmt.Sprintf("(%d earlier messages not shown)", sess.Older))
+	}
+	for _, message := range sess.Messages {
+		m.pane.Append(messageText(message))
+	}
+	for _, text := range printed {
+		m.pane.Append(text)
+	}
+}
+
+// layout sizes the pane and the input line to the terminal
+func (m *tuiModel) layout() {
+	switch {
+	case m.answer != nil:
+		m.input.Prompt = m.question
+	case m.quick:
+		m.input.Prompt = "Quick switch: "
+	default:
+		m.input.Prompt = "You: "
+	}
+	m.input.Width = max(m.width-lipgloss.Width(m.input.Prompt)-1, 1)
+	m.pane.SetSize(m.width-tui.SidebarWidth(m.width), max(m.height-2, 1))
+}
+
+// View draws the interface
+func (m *tuiModel) View() string {
+	if m.width == 0 {
+		return ""
+	}
+	body := m.pane.View()
+	if width := tui.SidebarWidth(m.width); width > 0 {
+		heading := "Sessions"
+		if m.tree {
+			heading = "Branches"
+		}
+		sidebar := tui.Sidebar{Heading: heading, Selected: m.selected}
+		for _, s := range m.listed() {
+			sidebar.Items = append(sidebar.Items, tui.Item{Label: s.Label, Current: s.ID == m.shownID})
+		}
+		body = lipgloss.JoinHorizontal(lipgloss.Top, sidebar.View(width, max(m.height-2, 1)), body)
+	}
+	return lipgloss.JoinVertical(lipgloss.Left, body, tui.StatusBar(m.status(), m.width), m.input.View())
+}
+
+// status returns the text of the status bar
+func (m *tuiModel) status() string {
+	status := []string{m.target}
+	if m.usage != "" {
+		status = append(status, m.usage)
+	}
+	switch {
+	case m.hint != "":
+		status = append(status, m.hint)
+	case m.answer != nil:
+		status = append(status, "Enter answers, Ctrl+C declines")
+	case !m.busy.IsZero():
+		status = append(status, fmt.Sprintf("%s%s… %ds, Esc stops", m.spinner.View(), m.activity, int(time.Since(m.busy).Seconds())))
+	case m.selected >= 0:
+		status = append(status, "↑/↓ pick, Enter opens, Tab sessions/branches, Esc returns")
+	case m.pane.Scrolled():
+		status = append(status, "Scrolled back, PgDn returns")
+	default:
+		status = append(status, "Ctrl+S sessions, Ctrl+B branches, PgUp/PgDn scroll, /help")
+	}
+	return strings.Join(status, " │ ")
+}
+
+// ask asks a question on the input line, for ChatBot.readLine
+func (t *terminalUI) ask(prompt string) (string, error) {
+	t.askMu.Lock()
+	defer t.askMu.Unlock()
+
+	reply := make(chan askReply, 1)
+	t.flush()
+	t.program.Send(askMsg{prompt: prompt, reply: reply})
+	select {
+	case answer := <-reply:
+		if answer.err == nil {
+			// Kept in the pane, as the REPL keeps it on screen
+			fmt.Println(prompt + answer.line)
+		}
+		return answer.line, answer.err
+	case <-t.closed:
+		return "", io.EOF
+	}
+}
+
+// watch makes Esc and /stop stop the turn in flight, for ChatBot.watchTurn
+func (t *terminalUI) watch(stop context.CancelCauseFunc) func() {
+	t.program.Send(watchMsg{stop: stop})
+	return func() {
+		t.program.Send(watchMsg{})
+	}
+}
+
+// showEvent streams a turn's reply into the pane, for ChatBot.turnEvents
+func (t *terminalUI) showEvent(ev turnEvent) {
+	t.flush()
+	t.program.Send(eventMsg(ev))
+}
+
+// finishReply shows the whole reply in place of what streamed in, for
+// ChatBot.showReply
+func (t *terminalUI) finishReply(reply string) {
+	t.flush()
+	t.program.Send(replyMsg(reply))
+}
+
+// copyOutput adds what is printed to the pane until the pipe is closed. A
+// NUL byte, written by flush, signals that what came before it is there.
+func (t *terminalUI) copyOutput(r *os.File) {
+	defer r.Close()
+	buf := make([]byte, 4096)
+	for {
+		n, err := r.Read(buf)
+		chunks := bytes.Split(buf[:n], []byte{0})
+		for i, chunk := range chunks {
+			if len(chunk) > 0 {
+				t.program.Send(outputMsg(ansiSequence.ReplaceAllString(string(chunk), "")))
+			}
+			if i < len(chunks)-1 {
+				select {
+				case t.flushed <- struct{}{}:
+				default:
+				}
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// flush waits until what was printed so far has reached the pane, so it
+// comes before what the caller shows next. Printing and the turn's events
+// take different ways to the program.
+func (t *terminalUI) flush() {
+	t.flushMu.Lock()
+	defer t.flushMu.Unlock()
+	if _, err := t.out.Write([]byte{0}); err != nil {
+		return
+	}
+	select {
+	case <-t.flushed:
+	case <-t.closed:
+	}
+}
+
+// suspend gives the terminal back for a program such as $EDITOR, returning
+// the function that takes it again
+func (t *terminalUI) suspend() func() {
+	if err := t.program.ReleaseTerminal(); err != nil {
+		t.cb.logger.Error("failed to release the terminal", "error", err)
+	}
+	stdout, stderr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = t.term, t.term
+	return func() {
+		os.Stdout, os.Stderr = stdout, stderr
+		if err := t.program.RestoreTerminal(); err != nil {
+			t.cb.logger.Error("failed to take the terminal back", "error", err)
+		}
+	}
+}
+
+// load reads the sessions of the sidebar, the backend, model and token
+// usage of the status bar, and the current conversation
+func (t *terminalUI) load() tea.Msg {
+	cb := t.cb
+	cb.mu.Lock()
+	sess := *cb.session
+	sess.Messages = slices.Clone(sess.Messages)
+	target := sess.Backend + "/" + cb.sessionModel(cb.session)
+	cb.mu.Unlock()
+
+	usage := ""
+	totals, err := cb.loadUsageTotals(sess.ID)
+	if err != nil {
+		cb.logger.Warn("failed to load token usage", "error", err)
+	}
+	var prompt, completion int64
+	for _, u := range totals {
+		prompt += u.PromptTokens
+		completion += u.CompletionTokens
+	}
+	if prompt+completion > 0 {
+		usage = fmt.Sprintf("%d in, %d out tokens", prompt, completion)
+	}
+	sessions, err := cb.listTUISessions(sess.ID, sess.Title)
+	if err != nil {
+		cb.logger.Warn("failed to list sessions", "error", err)
+	}
+	branches, err := cb.listTUIBranches(sess.ID)
+	if err != nil {
+		// Not saved yet, so not in a tree; Ctrl+B saves it
+		cb.logger.Debug("failed to load fork tree", "session_id", sess.ID, "error", err)
+		branches = []tuiSession{{ID: sess.ID, Label: sess.ID}}
+	}
+	return loadedMsg{session: sess, target: target, usage: usage, sessions: sessions, branches: branches}
+}
+
+// messageText is a message as the pane shows it
+func messageText(msg session.Message) string {
+	switch {
+	case msg.Speaker != "":
+		return msg.Speaker + ": " + msg.Content
+	case msg.Role == "user":
+		return "You: " + msg.Content
+	case msg.Role == "assistant":
+		return "Bot: " + msg.Content
+	}
+	return "[" + msg.Role + "] " + msg.Content
+}
+
+// listTUISessions returns the latest sessions, newest first, with the
+// current one even when it is older or not saved yet
+func (cb *ChatBot) listTUISessions(currentID, currentTitle string) ([]tuiSession, error) {
+	rows, err := cb.db.Query("SELECT id, COALESCE(title, '') FROM sessions ORDER BY start_time DESC LIMIT ?", tuiSessions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []tuiSession
+	for rows.Next() {
+		var s tuiSession
+		if err := rows.Scan(&s.ID, &s.Label); err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		sessions = append(sessions, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if !slices.ContainsFunc(sessions, func(s tuiSession) bool { return s.ID == currentID }) {
+		sessions = append([]tuiSession{{ID: currentID, Label: currentTitle}}, sessions...)
+	}
+	for i := range sessions {
+		if sessions[i].Label == "" {
+			sessions[i].Label = sessions[i].ID
+		}
+	}
+	return sessions, nil
+}
+
+// listTUIBranches returns the fork tree of a session as the sidebar draws it
+func (cb *ChatBot) listTUIBranches(sessionID string) ([]tuiSession, error) {
+	root, order, err := cb.loadBranchTree(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	label := func(node *branchNode) string {
+		text := node.ID
+		if node.Title != "" {
+			text = node.Title
+		}
+		if node.ForkSeq > 0 {
+			text = fmt.Sprintf("@%d %s", node.ForkSeq, text)
+		}
+		return text
+	}
+	lines := branchTreeLines(root, false, label)
+	branches := make([]tuiSession, len(order))
+	for i, node := range order {
+		branches[i] = tuiSession{ID: node.ID, Label: lines[i]}
+	}
+	return branches, nil
+}
@@ -0,0 +1,176 @@
+package chatbot
+
+import (
+	"context"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"ExtraChat/internal/lineedit"
+	"ExtraChat/internal/session"
+)
+
+// newTestTUI returns the interface's model on a 100 by 20 screen, without
+// a program: messages are passed to Update directly
+func newTestTUI(t *testing.T, history ...string) *tuiModel {
+	t.Helper()
+	cb := newTestChatBot(t, Dependencies{})
+	cb.input = lineedit.New(os.Stdin, io.Discard)
+	for _, line := range history {
+		if err := cb.input.AddHistory(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m := newTUIModel(context.Background(), &terminalUI{cb: cb, closed: make(chan struct{})})
+	m.Update(tea.WindowSizeMsg{Width: 100, Height: 20})
+	return m
+}
+
+// typeKeys passes keys to the model: text is typed as runes, and the
+// names of other keys are enclosed in <>, as in "<up>"
+func typeKeys(m *tuiModel, keys ...string) {
+	names := map[string]tea.KeyType{
+		"<up>": tea.KeyUp, "<down>": tea.KeyDown, "<left>": tea.KeyLeft,
+		"<tab>": tea.KeyTab, "<enter>": tea.KeyEnter, "<esc>": tea.KeyEsc,
+		"<ctrl+c>": tea.KeyCtrlC, "<ctrl+k>": tea.KeyCtrlK, "<ctrl+u>": tea.KeyCtrlU,
+	}
+	for _, k := range keys {
+		if name, ok := names[k]; ok {
+			m.Update(tea.KeyMsg{Type: name})
+			continue
+		}
+		m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(k)})
+	}
+}
+
+// paneText returns the text of the pane's blocks
+func paneText(m *tuiModel) []string {
+	var blocks []string
+	for i := 0; i < m.pane.Len(); i++ {
+		blocks = append(blocks, m.pane.Text(i))
+	}
+	return blocks
+}
+
+func TestTUIHistory(t *testing.T) {
+	tests := []struct {
+		name string
+		keys []string
+		want string
+	}{
+		{"up", []string{"<up>"}, "second"},
+		{"up twice", []string{"<up>", "<up>"}, "first"},
+		{"up stops at oldest", []string{"<up>", "<up>", "<up>"}, "first"},
+		{"down restores the unsubmitted line", []string{"draft", "<up>", "<up>", "<down>", "<down>"}, "draft"},
+		{"ctrl+u clears", []string{"<up>", "<ctrl+u>", "x"}, "x"},
+	}
+	for _, tt := range tests {
+		m := newTestTUI(t, "first", "second")
+		typeKeys(m, tt.keys...)
+		if got := m.input.Value(); got != tt.want {
+			t.Errorf("%s: input = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTUICompletion(t *testing.T) {
+	m := newTestTUI(t)
+	typeKeys(m, "/hel", "<tab>")
+	if got := m.input.Value(); got != "/help " {
+		t.Errorf("input = %q, want /help completed", got)
+	}
+
+	// Completions that add nothing are listed in the status bar until the
+	// next key
+	m = newTestTUI(t)
+	typeKeys(m, "/s", "<tab>")
+	if m.input.Value() != "/s" || !strings.Contains(m.status(), "/stats") {
+		t.Errorf("input = %q, status = %q", m.input.Value(), m.status())
+	}
+	typeKeys(m, "e")
+	if strings.Contains(m.status(), "/stats") {
+		t.Errorf("status after a key = %q", m.status())
+	}
+}
+
+func TestTUIQuestion(t *testing.T) {
+	m := newTestTUI(t)
+	typeKeys(m, "half typed")
+
+	reply := make(chan askReply, 1)
+	m.Update(askMsg{prompt: "Allow? ", reply: reply})
+	if m.input.Prompt != "Allow? " || m.input.Value() != "" {
+		t.Errorf("asking: prompt %q, input %q", m.input.Prompt, m.input.Value())
+	}
+	typeKeys(m, "y", "<enter>")
+	if answer := <-reply; answer.line != "y" || answer.err != nil {
+		t.Errorf("answer = %+v", answer)
+	}
+	// The typed line is back once answered
+	if m.input.Prompt != "You: " || m.input.Value() != "half typed" {
+		t.Errorf("after answering: prompt %q, input %q", m.input.Prompt, m.input.Value())
+	}
+
+	m.Update(askMsg{prompt: "Allow? ", reply: reply})
+	typeKeys(m, "<ctrl+c>")
+	if answer := <-reply; answer.err != lineedit.ErrInterrupt {
+		t.Errorf("Ctrl+C answer = %+v, want ErrInterrupt", answer)
+	}
+}
+
+func TestTUIStreaming(t *testing.T) {
+	m := newTestTUI(t)
+	m.Update(outputMsg("Searching"))
+	m.Update(outputMsg("...\n"))
+	m.Update(eventMsg{Type: "tool_call", Tool: "web_search"})
+	if !strings.Contains(m.activity, "web_search") {
+		t.Errorf("activity = %q", m.activity)
+	}
+	m.Update(eventMsg{Type: "token", Text: "Hel"})
+	m.Update(eventMsg{Type: "token", Text: "lo"})
+	if got := paneText(m); len(got) != 2 || got[0] != "Searching...\n" || got[1] != "Bot: Hello" {
+		t.Errorf("pane while streaming = %q", got)
+	}
+
+	// The finished reply replaces what streamed in, and output after it
+	// starts another block
+	m.Update(replyMsg("Hello, world"))
+	m.Update(outputMsg("done\n"))
+	if got := paneText(m); len(got) != 3 || got[1] != "Bot: Hello, world" || got[2] != "done\n" {
+		t.Errorf("pane after the reply = %q", got)
+	}
+}
+
+func TestTUISwitchKeepsOutput(t *testing.T) {
+	m := newTestTUI(t)
+	m.Update(loadedMsg{session: session.Session{ID: "one"}})
+	m.turn = m.pane.Append("You: /load two")
+	m.Update(outputMsg("Loaded session two\n"))
+
+	m.Update(loadedMsg{session: session.Session{ID: "two", Messages: []session.Message{{Role: "user", Content: "hi"}}}, turn: true})
+	got := paneText(m)
+	if len(got) != 3 || got[1] != "You: hi" || got[2] != "Loaded session two\n" {
+		t.Errorf("pane after switching = %q", got)
+	}
+
+	// Opening a session from the sidebar starts the pane afresh
+	m.Update(loadedMsg{session: session.Session{ID: "one"}})
+	if got := paneText(m); len(got) != 1 {
+		t.Errorf("pane after opening = %q", got)
+	}
+}
+
+func TestTUIQuickSwitch(t *testing.T) {
+	m := newTestTUI(t)
+	typeKeys(m, "<ctrl+k>")
+	if m.input.Prompt != "Quick switch: " {
+		t.Errorf("prompt = %q", m.input.Prompt)
+	}
+	typeKeys(m, "<ctrl+c>")
+	if m.quick || m.input.Prompt != "You: " {
+		t.Errorf("Ctrl+C left quick switch on: prompt %q", m.input.Prompt)
+	}
+}
@@ -0,0 +1,138 @@
+package chatbot
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// usageTotals are the accumulated token counts of one backend and model
+type usageTotals struct {
+	Backend          string
+	Model            string
+	Requests         int64
+	PromptTokens     int64
+	CompletionTokens int64
+}
+
+// usageTokens extracts prompt and completion token counts from a backend's
+// usage data: input_tokens/output_tokens (Anthropic) or prompt_tokens/
+// completion_tokens (OpenAI, Grok, Ollama)
+func usageTokens(usage map[string]interface{}) (int64, int64, bool) {
+	count := func(keys ...string) (int64, bool) {
+		for _, key := range keys {
+			if v, ok := usage[key].(float64); ok {
+				return int64(v), true
+			}
+		}
+		return 0, false
+	}
+	prompt, promptOK := count("input_tokens", "prompt_tokens")
+	completion, completionOK := count("output_tokens", "completion_tokens")
+	return prompt, completion, promptOK || completionOK
+}
+
+// recordUsage adds the token counts of one LLM request to the session's
+// totals for the backend and model and to the turn's record, and records its
+// cost. Failures are logged, never returned.
+func (cb *ChatBot) recordUsage(ctx context.Context, target llmTarget, usage map[string]interface{}) {
+	prompt, completion, ok := usageTokens(usage)
+	if !ok {
+		return
+	}
+	if record := turnRecordFrom(ctx); record != nil {
+		record.Usage.Requests++
+		record.Usage.PromptTokens += prompt
+		record.Usage.CompletionTokens += completion
+	}
+
+	cb.mu.Lock()
+	sessionID := cb.session.ID
+	cb.mu.Unlock()
+
+	_, err := cb.db.Exec(`
+		INSERT INTO token_usage (session_id, backend, model, requests, prompt_tokens, completion_tokens, updated_at)
+		VALUES (?, ?, ?, 1, ?, ?, ?)
+		ON CONFLICT(session_id, backend, model) DO UPDATE SET
+			requests = requests + 1,
+			prompt_tokens = prompt_tokens + excluded.prompt_tokens,
+			completion_tokens = completion_tokens + excluded.completion_tokens,
+			updated_at = excluded.updated_at`,
+		sessionID, target.Backend, target.Model, prompt, completion, time.Now(),
+	)
+	if err != nil {
+		cb.logger.Warn("failed to record token usage", "backend", target.Backend, "model", target.Model, "error", err)
+	}
+
+	cb.recordCost(ctx, sessionID, target, prompt, completion)
+}
+
+// loadUsageTotals sums token usage per backend and model, for one session or,
+// if sessionID is empty, across all sessions
+func (cb *ChatBot) loadUsageTotals(sessionID string) ([]usageTotals, error) {
+	query := `SELECT backend, model, SUM(requests), SUM(prompt_tokens), SUM(completion_tokens)
+		FROM token_usage`
+	var args []interface{}
+	if sessionID != "" {
+		query += " WHERE session_id = ?"
+		args = append(args, sessionID)
+	}
+	query += " GROUP BY backend, model ORDER BY backend, model"
+
+	rows, err := cb.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query token usage: %w", err)
+	}
+	defer rows.Close()
+
+	var totals []usageTotals
+	for rows.Next() {
+		var t usageTotals
+		if err := rows.Scan(&t.Backend, &t.Model, &t.Requests, &t.PromptTokens, &t.CompletionTokens); err != nil {
+			return nil, fmt.Errorf("failed to scan token usage: %w", err)
+		}
+		totals = append(totals, t)
+	}
+	return totals, rows.Err()
+}
+
+// handleUsageCommand handles /usage [all]: token counts of the current
+// session, or of every session, per backend and model
+func (cb *ChatBot) handleUsageCommand(args []string) error {
+	cb.mu.Lock()
+	sessionID := cb.session.ID
+	cb.mu.Unlock()
+
+	heading := fmt.Sprintf("Token usage of session %s:", sessionID)
+	if len(args) > 0 {
+		if args[0] != "all" {
+			return fmt.Errorf("usage: /usage [all]")
+		}
+		sessionID = ""
+		heading = "Token usage of all sessions:"
+	}
+
+	totals, err := cb.loadUsageTotals(sessionID)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("\n%s\n", heading)
+	if len(totals) == 0 {
+		fmt.Println("No LLM requests recorded.")
+		fmt.Println()
+		return nil
+	}
+
+	var sum usageTotals
+	fmt.Printf("%-10s %-32s %8s %12s %12s %12s\n", "BACKEND", "MODEL", "REQUESTS", "PROMPT", "COMPLETION", "TOTAL")
+	for _, t := range totals {
+		fmt.Printf("%-10s %-32s %8d %12d %12d %12d\n", t.Backend, t.Model, t.Requests, t.PromptTokens, t.CompletionTokens, t.PromptTokens+t.CompletionTokens)
+		sum.Requests += t.Requests
+		sum.PromptTokens += t.PromptTokens
+		sum.CompletionTokens += t.CompletionTokens
+	}
+	fmt.Printf("%-10s %-32s %8d %12d %12d %12d\n", "total", "", sum.Requests, sum.PromptTokens, sum.CompletionTokens, sum.PromptTokens+sum.CompletionTokens)
+	fmt.Println()
+	return nil
+}
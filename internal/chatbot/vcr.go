@@ -0,0 +1,31 @@
+package chatbot
+
+import (
+	"ExtraChat/internal/config"
+	"ExtraChat/internal/vcr"
+)
+
+// setupVCR routes the backend HTTP traffic through a recorder: with
+// --record it is saved to cassettes, with --replay it is answered from them.
+// MCP servers are not recorded.
+func (cb *ChatBot) setupVCR() error {
+	mode, dir := vcr.ModeRecord, cb.cfg().RecordDir
+	if cb.cfg().ReplayDir != "" {
+		mode, dir = vcr.ModeReplay, cb.cfg().ReplayDir
+	}
+	var secrets []string
+	if mode == vcr.ModeRecord {
+		for backendName := range config.APIKeyEnvVars {
+			if key := cb.cfg().APIKey(backendName); key != "" {
+				secrets = append(secrets, key)
+			}
+		}
+	}
+	recorder, err := vcr.New(mode, dir, nil, secrets)
+	if err != nil {
+		return err
+	}
+	cb.wrapTransports(recorder.Wrap)
+	cb.logger.Info("backend HTTP traffic goes through cassettes", "mode", mode, "dir", dir)
+	return nil
+}
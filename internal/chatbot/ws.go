@@ -0,0 +1,294 @@
+package chatbot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// WebSocket keep-alive: pings go out every wsPingEvery, and a connection
+// that answers nothing for wsPongWait is closed
+const (
+	wsPingEvery = 30 * time.Second
+	wsPongWait  = 60 * time.Second
+	wsWriteWait = 10 * time.Second
+)
+
+// wsRequest is a message from a WebSocket client; Type says which of the
+// other fields apply
+type wsRequest struct {
+	Type      string `json:"type"`       // bind, new, message, switch, cancel or stop
+	SessionID string `json:"session_id"` // bind
+	Backend   string `json:"backend"`    // new, switch
+	Persona   string `json:"persona"`    // new
+	Content   string `json:"content"`    // message
+
+	StopSequences []string `json:"stop_sequences"` // message
+}
+
+// wsConn is a WebSocket client of the API, bound to one session at a time
+type wsConn struct {
+	server  *apiServer
+	conn    *websocket.Conn
+	writeMu sync.Mutex // gorilla/websocket allows only one concurrent writer
+
+	mu         sync.Mutex              // Guards sessionID and cancelTurn
+	sessionID  string                  // Session messages go to; empty until bound
+	cancelTurn context.CancelCauseFunc // Aborts the turn in flight; nil when idle
+}
+
+// handleWebSocket upgrades to a WebSocket connection that runs turns on its
+// bound session and streams their events. ?session= binds on connect.
+func (s *apiServer) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	// Without authentication, only pages served from this address may
+	// connect, so other websites open in the browser can't drive the API
+	upgrader := websocket.Upgrader{
+		CheckOrigin: func(r *http.Request) bool { return s.authRequired() || sameOrigin(r) },
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has answered with an error status
+		s.bot.logger.Warn("WebSocket upgrade failed", "error", err)
+		return
+	}
+
+	s.wsConns.Add(1)
+	defer s.wsConns.Done()
+
+	c := &wsConn{server: s, conn: conn}
+	s.bot.logger.Info("WebSocket client connected", "remote", r.RemoteAddr)
+	if id := r.URL.Query().Get("session"); id != "" {
+		c.bind(r.Context(), id)
+	}
+	c.serve(r.Context())
+	s.bot.logger.Info("WebSocket client disconnected", "remote", r.RemoteAddr)
+}
+
+// sameOrigin reports whether a request has no Origin header or one matching
+// its host
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// serve reads client messages until the connection closes
+func (c *wsConn) serve(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	defer c.conn.Close()
+
+	c.conn.SetReadLimit(maxRequestBody)
+	c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+	go c.ping(ctx)
+
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				c.server.bot.logger.Warn("WebSocket read failed", "error", err)
+			}
+			return
+		}
+		// Messages count as a sign of life too
+		c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+
+		var req wsRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			c.sendError(&requestError{"invalid message: " + err.Error()})
+			continue
+		}
+		c.handle(ctx, req)
+	}
+}
+
+// ping keeps the connection alive until ctx is done, and closes it when the
+// server shuts down
+func (c *wsConn) ping(ctx context.Context) {
+	ticker := time.NewTicker(wsPingEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.server.shutdown:
+			c.conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"), time.Now().Add(wsWriteWait))
+			c.conn.Close()
+			return
+		case <-ticker.C:
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// handle answers a client message. Turns run in the background, so a
+// cancel can reach them.
+func (c *wsConn) handle(ctx context.Context, req wsRequest) {
+	// Every message counts against the tenant's requests per minute, as
+	// a request to the REST API would; cancel and stop always go through
+	if req.Type != "cancel" && req.Type != "stop" {
+		if err := c.server.checkRate(ctx); err != nil {
+			c.sendError(err)
+			return
+		}
+	}
+
+	c.mu.Lock()
+	id, busy := c.sessionID, c.cancelTurn != nil
+	c.mu.Unlock()
+
+	switch req.Type {
+	case "bind":
+		if busy {
+			c.sendError(&requestError{"a turn is running; cancel it or wait for it to finish"})
+			return
+		}
+		c.bind(ctx, req.SessionID)
+	case "new":
+		if busy {
+			c.sendError(&requestError{"a turn is running; cancel it or wait for it to finish"})
+			return
+		}
+		sess, err := c.server.createSession(ctx, req.Backend, req.Persona)
+		if err != nil {
+			c.sendError(err)
+			return
+		}
+		c.mu.Lock()
+		c.sessionID = sess.ID
+		c.mu.Unlock()
+		c.send(map[string]interface{}{"type": "session", "session": sess})
+	case "message":
+		switch {
+		case id == "":
+			c.sendError(&requestError{"no session bound; send bind or new first"})
+		case busy:
+			c.sendError(&requestError{"a turn is already running"})
+		case strings.TrimSpace(req.Content) == "":
+			c.sendError(&requestError{"content is required"})
+		default:
+			turnCtx := ctx
+			if req.StopSequences != nil {
+				if err := validStopSequences(req.StopSequences); err != nil {
+					c.sendError(err)
+					return
+				}
+				turnCtx = withStopSequences(ctx, req.StopSequences)
+			}
+			turnCtx, cancel := context.WithCancelCause(turnCtx)
+			c.mu.Lock()
+			c.cancelTurn = cancel
+			c.mu.Unlock()
+			go c.runTurn(turnCtx, cancel, id, req.Content)
+		}
+	case "switch":
+		switch {
+		case id == "":
+			c.sendError(&requestError{"no session bound; send bind or new first"})
+		case busy:
+			c.sendError(&requestError{"a turn is running; cancel it or wait for it to finish"})
+		default:
+			backendName, model, err := c.server.switchSessionBackend(ctx, id, req.Backend)
+			if err != nil {
+				c.sendError(err)
+				return
+			}
+			c.send(map[string]string{"type": "backend", "backend": backendName, "model": model})
+		}
+	case "cancel", "stop":
+		// A stopped turn keeps the reply streamed so far; a cancelled one is dropped
+		cause := context.Canceled
+		if req.Type == "stop" {
+			cause = errStopped
+		}
+		c.mu.Lock()
+		if c.cancelTurn != nil {
+			c.cancelTurn(cause)
+		}
+		c.mu.Unlock()
+	default:
+		c.sendError(&requestError{"unknown message type " + req.Type})
+	}
+}
+
+// bind makes the connection's messages go to an existing session and sends
+// the session with all of its messages
+func (c *wsConn) bind(ctx context.Context, id string) {
+	sess, err := c.server.loadSession(ctx, id, 0)
+	if err != nil {
+		c.sendError(err)
+		return
+	}
+	c.mu.Lock()
+	c.sessionID = id
+	c.mu.Unlock()
+	c.send(map[string]interface{}{"type": "session", "session": sess})
+}
+
+// runTurn runs a turn on the bound session, streaming its events, and ends
+// with done or error
+func (c *wsConn) runTurn(ctx context.Context, cancel context.CancelCauseFunc, id, prompt string) {
+	record, err := c.server.runTurn(ctx, id, prompt,
+		func(start turnStart) { c.send(start) },
+		func(event turnEvent) { c.send(event) },
+	)
+	c.mu.Lock()
+	c.cancelTurn = nil
+	c.mu.Unlock()
+	cancel(nil)
+
+	switch {
+	case record == nil:
+		c.sendError(err)
+	case err != nil:
+		c.send(map[string]interface{}{"type": "error", "error": record.Error, "record": record})
+	default:
+		c.send(map[string]interface{}{"type": "done", "record": record})
+	}
+}
+
+// send writes v as a JSON message. Failures mean the client is gone, which
+// the read loop notices.
+func (c *wsConn) send(v interface{}) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+	if err := c.conn.WriteJSON(v); err != nil {
+		c.server.bot.logger.Debug("WebSocket write failed", "error", err)
+	}
+}
+
+// sendError reports a failed request to the client, with retry_after in
+// seconds when over a quota. Internal errors are logged, and their details
+// are not sent.
+func (c *wsConn) sendError(err error) {
+	message := err.Error()
+	if errors.Is(err, context.Canceled) {
+		message = "cancelled"
+	} else if errorStatus(err) == http.StatusInternalServerError {
+		c.server.bot.logger.Error("WebSocket request failed", "error", err)
+		message = "internal error"
+	}
+	var quotaErr *quotaError
+	if errors.As(err, &quotaErr) {
+		c.send(map[string]interface{}{"type": "error", "error": message, "retry_after": quotaErr.retryAfterSeconds()})
+		return
+	}
+	c.send(map[string]string{"type": "error", "error": message})
+}
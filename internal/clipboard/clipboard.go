@@ -0,0 +1,75 @@
+// Package clipboard copies text to the system clipboard using the
+// platform's clipboard command, falling back to the OSC 52 terminal escape
+package clipboard
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// command is a clipboard tool that reads the text on stdin
+type command struct {
+	name string
+	args []string
+}
+
+// commands returns the clipboard tools to try on the current platform, in
+// order of preference
+func commands() []command {
+	switch runtime.GOOS {
+	case "darwin":
+		return []command{{name: "pbcopy"}}
+	case "windows":
+		return []command{
+			{name: "powershell.exe", args: []string{"-NoProfile", "-Command", "$input | Set-Clipboard"}},
+			{name: "clip.exe"},
+		}
+	}
+
+	var cmds []command
+	if os.Getenv("WAYLAND_DISPLAY") != "" {
+		cmds = append(cmds, command{name: "wl-copy"})
+	}
+	return append(cmds,
+		command{name: "xclip", args: []string{"-selection", "clipboard"}},
+		command{name: "xsel", args: []string{"--clipboard", "--input"}},
+	)
+}
+
+// Copy puts text on the clipboard and returns the method used. Without a
+// clipboard tool (e.g. over SSH) it writes an OSC 52 escape to terminal,
+// which most terminal emulators turn into a clipboard update; terminal may be
+// nil to disable that fallback.
+func Copy(text string, terminal io.Writer) (string, error) {
+	var errs []error
+	for _, c := range commands() {
+		path, err := exec.LookPath(c.name)
+		if err != nil {
+			continue
+		}
+		cmd := exec.Command(path, c.args...)
+		cmd.Stdin = strings.NewReader(text)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w: %s", c.name, err, strings.TrimSpace(string(out))))
+			continue
+		}
+		return c.name, nil
+	}
+
+	if terminal == nil {
+		if len(errs) > 0 {
+			return "", fmt.Errorf("failed to copy to clipboard: %w", errors.Join(errs...))
+		}
+		return "", fmt.Errorf("no clipboard tool found")
+	}
+	if _, err := fmt.Fprintf(terminal, "\033]52;c;%s\a", base64.StdEncoding.EncodeToString([]byte(text))); err != nil {
+		return "", fmt.Errorf("failed to write terminal clipboard escape: %w", err)
+	}
+	return "terminal (OSC 52)", nil
+}
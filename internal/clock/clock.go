@@ -0,0 +1,29 @@
+// Package clock abstracts the passing of time, so waits such as retry
+// backoffs can be driven by a fake clock instead of the wall clock.
+package clock
+
+import "time"
+
+// Clock tells the time and waits
+type Clock interface {
+	Now() time.Time
+	// After sends the time on the returned channel once d has passed
+	After(d time.Duration) <-chan time.Time
+}
+
+// System is the wall clock
+var System Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// Or returns c, or System if c is nil
+func Or(c Clock) Clock {
+	if c == nil {
+		return System
+	}
+	return c
+}
@@ -0,0 +1,50 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CommandSteps is what a user-defined command runs: one line for an alias,
+// several for a macro. In the config file it is a string or a list.
+type CommandSteps []string
+
+// UnmarshalYAML accepts a single line as well as a list of lines
+func (s *CommandSteps) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var line string
+	if err := unmarshal(&line); err == nil {
+		*s = CommandSteps{line}
+		return nil
+	}
+	var lines []string
+	if err := unmarshal(&lines); err != nil {
+		return fmt.Errorf("expected a command line or a list of them")
+	}
+	*s = lines
+	return nil
+}
+
+// normalizeCommands checks the user-defined commands of the config file and
+// strips the optional leading slash of their names
+func normalizeCommands(commands map[string]CommandSteps) (map[string]CommandSteps, error) {
+	normalized := make(map[string]CommandSteps, len(commands))
+	for name, steps := range commands {
+		trimmed := strings.TrimPrefix(name, "/")
+		if trimmed == "" || strings.ContainsAny(trimmed, " \t/") {
+			return nil, fmt.Errorf("commands: invalid name %q", name)
+		}
+		if _, dup := normalized[trimmed]; dup {
+			return nil, fmt.Errorf("commands: %s is defined twice", trimmed)
+		}
+		if len(steps) == 0 {
+			return nil, fmt.Errorf("commands: %s has no steps", name)
+		}
+		for _, step := range steps {
+			if strings.TrimSpace(step) == "" {
+				return nil, fmt.Errorf("commands: %s has an empty step", name)
+			}
+		}
+		normalized[trimmed] = steps
+	}
+	return normalized, nil
+}
@@ -1,21 +1,665 @@
 package config
 
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"ExtraChat/internal/keyring"
+	"ExtraChat/internal/mcp"
+	"ExtraChat/internal/pricing"
+)
+
 const (
 	BackendOllama    = "ollama"
 	BackendAnthropic = "anthropic"
 	BackendGrok      = "grok"
 	BackendOpenAI    = "openai"
+	BackendMock      = "mock" // Offline: canned, scripted or echoed replies
+)
+
+// Default models for each backend
+const (
+	DefaultOllamaModel    = "llama3:latest"
+	DefaultAnthropicModel = "claude-sonnet-4-20250514"
+	DefaultGrokModel      = "grok-1"
+	DefaultOpenAIModel    = "gpt-3.5-turbo"
+	DefaultMockModel      = "mock"
+)
+
+// Default API base URLs for each backend
+const (
+	DefaultOllamaURL    = "http://localhost:11434"
+	DefaultAnthropicURL = "https://api.anthropic.com"
+	DefaultGrokURL      = "https://api.grok.x.ai"
+	DefaultOpenAIURL    = "https://api.openai.com"
+	DefaultCohereURL    = "https://api.cohere.com"
+	DefaultVoyageURL    = "https://api.voyageai.com"
+)
+
+// Retrieval defaults: embedding models per backend, and how documents are
+// chunked and how many chunks a prompt gets
+const (
+	DefaultOllamaEmbedModel = "nomic-embed-text"
+	DefaultOpenAIEmbedModel = "text-embedding-3-small"
+	DefaultRAGTopK          = 4
+	DefaultChunkSize        = 1500 // Characters
+	DefaultChunkOverlap     = 200  // Characters
+)
+
+// Rerankers re-order the chunks vector search found before the best are sent
+const (
+	RerankOff    = "off"
+	RerankLLM    = "llm" // The summarizer backend scores the chunks
+	RerankCohere = "cohere"
+	RerankVoyage = "voyage"
+)
+
+// Re-ranking defaults: rerank API models, and how many chunks vector search
+// hands the reranker
+const (
+	DefaultCohereRerankModel = "rerank-v3.5"
+	DefaultVoyageRerankModel = "rerank-2"
+	DefaultRerankCandidates  = 20
+)
+
+// DefaultFetchMaxSize bounds a page downloaded by /fetch or the fetch_url
+// tool, in KB
+const DefaultFetchMaxSize = 2048
+
+// MaxStopSequences is the most stop sequences a request may have, the
+// limit of the OpenAI API
+const MaxStopSequences = 4
+
+// ValidStopSequences checks the stop sequences of a request
+func ValidStopSequences(stop []string) error {
+	if len(stop) > MaxStopSequences {
+		return fmt.Errorf("at most %d stop sequences are allowed, got %d", MaxStopSequences, len(stop))
+	}
+	for _, s := range stop {
+		if s == "" {
+			return fmt.Errorf("stop sequences must not be empty")
+		}
+	}
+	return nil
+}
+
+// DefaultMaxToolIterations caps the rounds of tool calls in a single turn
+const DefaultMaxToolIterations = 10
+
+// DefaultToolTimeout bounds how long a single MCP tool call may run
+const DefaultToolTimeout = 60 * time.Second
+
+// MCP startup defaults: how many servers are initialized at once, and how
+// long startup waits for all of them
+const (
+	DefaultMCPStartupConcurrency = 4
+	DefaultMCPStartupTimeout     = 30 * time.Second
+)
+
+// HTTP connection defaults for the backend APIs
+const (
+	DefaultHTTPTimeout      = 60 * time.Second
+	DefaultHTTPDialTimeout  = 10 * time.Second
+	DefaultHTTPTLSTimeout   = 10 * time.Second
+	DefaultHTTPIdleTimeout  = 90 * time.Second
+	DefaultHTTPMaxIdleConns = 16
+)
+
+// DefaultSessionPageSize is how many of a session's most recent messages
+// are loaded with it
+const DefaultSessionPageSize = 500
+
+// Database backup defaults
+const (
+	DefaultBackupRetention = 7
+	DefaultBackupTime      = "03:00"
 )
 
+// Storage defaults, relative to the working directory
+const (
+	DefaultDBPath = "chatbot.db"
+	DefaultLogDir = "logs"
+)
+
+// Audit log rotation defaults: rotated files are kept until removed by hand
+const (
+	DefaultAuditMaxSize    = 100 // MB
+	DefaultAuditMaxBackups = 0
+	DefaultAuditMaxAge     = 0 // Days
+)
+
+// DefaultContextMaxTokens caps the context injected with --file or piped
+// stdin, estimated at four bytes per token
+const DefaultContextMaxTokens = 32000
+
+// DefaultLogLevel is the application log level when neither --log-level nor
+// --debug is given
+const DefaultLogLevel = "info"
+
+// Output formats: text for people, json for a record per turn on stdout
+const (
+	OutputText = "text"
+	OutputJSON = "json"
+)
+
+// APIKeyEnvVars names the environment variable holding each backend's API
+// key, and those of the rerank APIs
+var APIKeyEnvVars = map[string]string{
+	BackendAnthropic: "ANTHROPIC_API_KEY",
+	BackendGrok:      "GROK_API_KEY",
+	BackendOpenAI:    "OPENAI_API_KEY",
+	RerankCohere:     "COHERE_API_KEY",
+	RerankVoyage:     "VOYAGE_API_KEY",
+}
+
 // Config holds application configuration
 type Config struct {
-	Backend     string
-	SessionID   string
-	Debug       bool
-	OllamaModel string // Model specification in format "model:version" (e.g., "llama3:latest")
+	Backend        string
+	SessionID      string
+	Debug          bool
+	OllamaModel    string // Model specification in format "model:version" (e.g., "llama3:latest")
+	AnthropicModel string // Anthropic model ID
+	GrokModel      string // Grok model ID
+	OpenAIModel    string // OpenAI model ID
+	MockModel      string // Model name the mock backend reports
+
+	// Generation options of Ollama chat requests
+	OllamaOptions OllamaOptions
+
+	// Sequences that end a reply on every backend; Ollama also gets
+	// OllamaOptions.Stop
+	StopSequences []string
+
+	// API base URLs; empty uses the backend's default endpoint
+	OllamaURL    string
+	AnthropicURL string
+	GrokURL      string
+	OpenAIURL    string
+	CohereURL    string // Rerank API base URLs
+	VoyageURL    string
+
+	// API keys from the config file, keyed by backend. Values may reference
+	// environment variables as ${VAR}; the backend's own variable (e.g.
+	// ANTHROPIC_API_KEY) takes precedence and the OS keyring is the fallback.
+	APIKeys map[string]string
+
+	// Per-model prices in US dollars per million tokens, overriding the
+	// built-in list prices; keys are model IDs or ID prefixes
+	Pricing map[string]pricing.Price
+
+	// Model aliases such as "fast" -> "openai/gpt-4o-mini", usable wherever
+	// a backend name is accepted
+	Aliases map[string]string
+
+	// System prompt presets by name, added to or overriding the built-in
+	// ones; the session's persona is chosen with /persona
+	Personas map[string]Persona
+
+	// User-defined REPL commands by name (without the slash): an alias such
+	// as sre -> "/persona sre", or a macro of several lines
+	Commands map[string]CommandSteps
+
+	// Model router: with RouterEnabled, each prompt goes to the cheapest
+	// adequate model of the first rule it matches instead of the session's
+	// backend
+	RouterEnabled bool // Toggled with /route
+	RouterRules   []RouteRule
+
+	// Judge of /bestof: an alias, backend or backend/model that picks the
+	// best of the sampled replies; empty lets the user pick
+	BestOfJudge string
+
+	// Guardrails: prompts tripping InputFilter are not sent, and replies
+	// tripping OutputFilter are not shown
+	InputFilter     ContentFilter
+	OutputFilter    ContentFilter
+	ModerationModel string // OpenAI moderation model for filters with Moderation
+	SecretScan      bool   // Look for API keys, private keys and card numbers in prompts to cloud backends
+
+	// API clients of "extrachat serve" by name, each with its own token,
+	// sessions, backend and tool scopes and usage quota
+	Tenants map[string]Tenant
+
+	// Prompts and pipelines "extrachat serve" runs on a cron schedule, and
+	// the sinks their replies are delivered to by name
+	Schedule []ScheduledJob
+	Sinks    map[string]Sink
+
+	// Plain selects append-only plain text output for slow links and screen
+	// readers: no colors, spinners, markdown rendering or streaming re-renders
+	Plain bool
+
+	// TUI runs the full-screen interface instead of the REPL
+	TUI bool
+
+	// Output is the output format, OutputText or OutputJSON
+	Output string
+
+	// NotifyAfter is how long a reply or /async job may take before a
+	// desktop notification tells it is done; 0 disables notifications
+	NotifyAfter time.Duration
+
+	// Mock backend: replies from a fixture file, or echoes of the prompt,
+	// for development and tests without a network or API keys
+	MockFixtures     string        // YAML file of canned and scripted replies; empty echoes
+	MockLatency      time.Duration // Delay before each reply
+	MockErrorPercent int           // Percentage of requests failing with a 503
+
+	SkipStartupChecks bool // Don't check the backend's key, endpoint and model at startup
+
+	// HTTP connections to the APIs: every backend has its own pool of
+	// keep-alive connections (HTTP/2 where the server offers it). Streamed
+	// replies have no overall timeout; they end when the reply does.
+	HTTPTimeout       time.Duration // Overall limit of a request that isn't streamed
+	HTTPDialTimeout   time.Duration // Limit on opening a TCP connection
+	HTTPTLSTimeout    time.Duration // Limit on the TLS handshake
+	HTTPHeaderTimeout time.Duration // Limit on waiting for response headers; 0 uses HTTPTimeout
+	HTTPIdleTimeout   time.Duration // How long an idle connection is kept open
+	HTTPMaxIdleConns  int           // Idle connections kept per host
+
+	// HTTP record/replay: backend traffic is recorded to, or replayed from,
+	// a directory of sanitized cassettes; at most one is set
+	RecordDir string
+	ReplayDir string
+
+	// Context injection: files, and piped stdin with Prompt, are prepended to
+	// the first prompt
+	Prompt           string   // One-shot prompt: send it, print the reply and exit; empty starts the REPL
+	ContextFiles     []string // Files to send as context
+	ContextMaxTokens int      // Rejects context above this estimated number of tokens
+
+	ConfigFile  string       // Config file the settings were loaded from; empty if none
+	EnvFileVars []EnvFileVar // Variables found in .env files at startup, for debug logging
+
+	// Storage and telemetry
+	DBPath       string        // SQLite database file
+	PageSize     int           // Most recent messages loaded with a session, older ones read on demand; 0 loads all
+	LogDir       string        // Directory for logs, traces and metrics
+	LogLevel     string        // Application log level: debug, info, warn or error; Debug forces debug
+	CacheEnabled bool          // Reuse responses for identical conversations
+	CacheTTL     time.Duration // How long a cached response stays valid; 0 never expires
+
+	TelemetryEnabled bool   // Export traces and metrics; false skips tracer and meter setup
+	PprofAddr        string // Address for the net/http/pprof endpoint; disabled when empty
+
+	// Prompt/response audit log; disabled when AuditLog is empty
+	AuditLog        string // JSONL file recording prompts, responses and tool calls
+	AuditMaxSize    int    // Size in MB at which the audit log is rotated
+	AuditMaxBackups int    // Rotated audit logs to keep; 0 keeps all
+	AuditMaxAge     int    // Days to keep rotated audit logs; 0 keeps them forever
+
+	// Background job configuration (titling, summarization, ...)
+	SummarizerBackend string // Backend for background jobs; empty uses the interactive backend
+	SummarizerModel   string // Model for background jobs; empty uses the backend's configured model
+	AutoTitle         bool   // Generate a session title after the first exchange
+
+	// Retrieval-augmented generation: documents added with "extrachat ingest"
+	// are embedded, and the chunks closest to a prompt are sent with it
+	RAGEnabled   bool   // Send retrieved chunks with prompts; toggled with /rag
+	EmbedBackend string // Backend computing embeddings: ollama or openai
+	EmbedModel   string // Embedding model; empty uses the backend's default
+	RAGTopK      int    // Chunks sent with a prompt
+	ChunkSize    int    // Characters per chunk when ingesting
+	ChunkOverlap int    // Characters repeated between consecutive chunks
+
+	// Re-ranking of the chunks vector search finds; a collection may choose
+	// its own reranker
+	Rerank           string // Reranker: off, llm, cohere or voyage
+	RerankModel      string // Rerank API model; empty uses the API's default
+	RerankCandidates int    // Chunks vector search finds for the reranker
+
+	// Web pages downloaded with /fetch and the fetch_url tool
+	FetchAllowedDomains []string // Domains that may be fetched, with their subdomains; empty allows all
+	FetchMaxSize        int      // Largest download in KB; longer pages are cut
+	FetchAllowPrivate   bool     // Fetch loopback, private and link-local addresses too
+
+	// Nightly database backups; disabled when BackupDir is empty
+	BackupDir       string // Directory for verified database snapshots
+	BackupRetention int    // Number of snapshots to keep
+	BackupTime      string // Local time of day to take the snapshot (HH:MM)
 
 	// MCP Configuration
-	MCPEnabled       bool     // Enable MCP tool support
-	MCPLocalServers  []string // Paths to Python MCP servers
-	MCPRemoteServers []string // URLs to remote MCP servers (http:// or ws://)
+	MCPEnabled        bool               // Enable MCP tool support
+	MCPConfigFile     string             // JSON/YAML file with an mcpServers section
+	MCPServers        []mcp.ServerConfig // Servers defined inline in the config file
+	MCPLocalServers   []string           // Paths to Python MCP servers (legacy; prefer MCPConfigFile)
+	MCPRemoteServers  []string           // URLs to remote MCP servers (http:// or ws://)
+	ToolAutoApprove   []string           // Tool names that run without confirmation ("*" approves all)
+	MaxToolIterations int                // Maximum rounds of tool calls per turn
+	MCPLogLevel       string             // Minimum level of server log notifications (logging/setLevel); empty keeps the server default
+	BuiltinTools      bool               // Offer the built-in read_file/write_file/run_command/fetch_url tools
+	SandboxRoot       string             // Directory the built-in file and command tools are confined to
+
+	// MCP startup; servers still initializing at the deadline are skipped
+	MCPStartupConcurrency int           // Servers initialized at once
+	MCPStartupTimeout     time.Duration // Overall deadline for initializing all servers
+
+	// Tool call timeouts; a timed-out call is cancelled on the MCP server
+	ToolTimeout  time.Duration            // Default timeout for a single tool call
+	ToolTimeouts map[string]time.Duration // Per-tool overrides keyed by tool name
+
+	// Tool permission tiers: every tool is read, write or destructive (see
+	// mcp.Tool.Tier), and each tier has a policy
+	ToolTiers    map[string]string // Tier by tool name, overriding the server's annotations
+	TierPolicies map[string]string // Policy by tier; tiers not listed use PolicyConfirm
+}
+
+// Default returns the built-in configuration that the config file, the
+// environment and flags are layered on
+func Default() Config {
+	cfg := Config{
+		Backend:           BackendOllama,
+		OllamaModel:       DefaultOllamaModel,
+		AnthropicModel:    DefaultAnthropicModel,
+		GrokModel:         DefaultGrokModel,
+		OpenAIModel:       DefaultOpenAIModel,
+		MockModel:         DefaultMockModel,
+		OllamaURL:         DefaultOllamaURL,
+		AnthropicURL:      DefaultAnthropicURL,
+		GrokURL:           DefaultGrokURL,
+		OpenAIURL:         DefaultOpenAIURL,
+		CohereURL:         DefaultCohereURL,
+		VoyageURL:         DefaultVoyageURL,
+		Output:            OutputText,
+		DBPath:            DefaultDBPath,
+		PageSize:          DefaultSessionPageSize,
+		LogDir:            DefaultLogDir,
+		LogLevel:          DefaultLogLevel,
+		CacheEnabled:      true,
+		TelemetryEnabled:  true,
+		EmbedBackend:      BackendOllama,
+		RAGTopK:           DefaultRAGTopK,
+		ChunkSize:         DefaultChunkSize,
+		ChunkOverlap:      DefaultChunkOverlap,
+		Rerank:            RerankOff,
+		RerankCandidates:  DefaultRerankCandidates,
+		FetchMaxSize:      DefaultFetchMaxSize,
+		ModerationModel:   DefaultModerationModel,
+		BackupRetention:   DefaultBackupRetention,
+		BackupTime:        DefaultBackupTime,
+		AuditMaxSize:      DefaultAuditMaxSize,
+		AuditMaxBackups:   DefaultAuditMaxBackups,
+		AuditMaxAge:       DefaultAuditMaxAge,
+		MaxToolIterations: DefaultMaxToolIterations,
+		ContextMaxTokens:  DefaultContextMaxTokens,
+		ToolTimeout:       DefaultToolTimeout,
+		SandboxRoot:       ".",
+		HTTPTimeout:       DefaultHTTPTimeout,
+		HTTPDialTimeout:   DefaultHTTPDialTimeout,
+		HTTPTLSTimeout:    DefaultHTTPTLSTimeout,
+		HTTPIdleTimeout:   DefaultHTTPIdleTimeout,
+		HTTPMaxIdleConns:  DefaultHTTPMaxIdleConns,
+
+		MCPStartupConcurrency: DefaultMCPStartupConcurrency,
+		MCPStartupTimeout:     DefaultMCPStartupTimeout,
+	}
+
+	// Honor Ollama's own OLLAMA_HOST, which may omit the scheme
+	if host := os.Getenv("OLLAMA_HOST"); host != "" {
+		if !strings.Contains(host, "://") {
+			host = "http://" + host
+		}
+		cfg.OllamaURL = host
+	}
+	return cfg
+}
+
+// ReplayAPIKey stands in for missing API keys while replaying cassettes,
+// which need none
+const ReplayAPIKey = "replay"
+
+// APIKey returns the API key for a backend: its environment variable if
+// set, otherwise the (expanded) key from the config file, otherwise the key
+// stored in the OS keyring with "extrachat auth set"
+func (c Config) APIKey(backend string) string {
+	if key := os.Getenv(APIKeyEnvVars[backend]); key != "" {
+		return key
+	}
+	if key := os.ExpandEnv(c.APIKeys[backend]); key != "" {
+		return key
+	}
+	key, err := keyring.Get(backend)
+	if err != nil && !errors.Is(err, keyring.ErrNotFound) {
+		slog.Warn("failed to read API key from keyring", "backend", backend, "error", err)
+	}
+	if key == "" && c.ReplayDir != "" {
+		return ReplayAPIKey
+	}
+	return key
+}
+
+// ParseLogLevel parses an application log level: debug, info, warn or error
+func ParseLogLevel(level string) (slog.Level, error) {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info", "":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return slog.LevelInfo, fmt.Errorf("unknown log level %q (expected debug, info, warn or error)", level)
+}
+
+// SlogLevel returns the effective application log level: debug with Debug
+// set, otherwise LogLevel
+func (c Config) SlogLevel() slog.Level {
+	if c.Debug {
+		return slog.LevelDebug
+	}
+	level, _ := ParseLogLevel(c.LogLevel)
+	return level
+}
+
+// EnvPrefix prefixes the environment variables that mirror command-line
+// flags, e.g. EXTRACHAT_OPENAI_MODEL for --openai-model
+const EnvPrefix = "EXTRACHAT_"
+
+// EnvVarName returns the environment variable for a flag name
+func EnvVarName(flagName string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// TimeoutForTool returns the timeout that applies to the named tool
+func (c Config) TimeoutForTool(name string) time.Duration {
+	if timeout, ok := c.ToolTimeouts[name]; ok {
+		return timeout
+	}
+	if c.ToolTimeout > 0 {
+		return c.ToolTimeout
+	}
+	return DefaultToolTimeout
+}
+
+// Tool policies of a permission tier
+const (
+	PolicyAllow   = "allow"   // Run without asking
+	PolicyConfirm = "confirm" // Ask, unless the tool is auto-approved
+	PolicyDeny    = "deny"    // Never run, even when auto-approved
+)
+
+// Policies lists the tool policies
+var Policies = []string{PolicyAllow, PolicyConfirm, PolicyDeny}
+
+// PolicyForTier returns the policy of a permission tier
+func (c Config) PolicyForTier(tier string) string {
+	if policy, ok := c.TierPolicies[tier]; ok {
+		return policy
+	}
+	return PolicyConfirm
+}
+
+// ParseToolTiers parses tiers of tools in the form "search=read,deploy=destructive"
+func ParseToolTiers(spec string) (map[string]string, error) {
+	return parseAssignments(spec, "tool tier", "name=tier", validTier)
+}
+
+// ParseTierPolicies parses policies in the form "read=allow,destructive=deny"
+func ParseTierPolicies(spec string) (map[string]string, error) {
+	policies, err := parseAssignments(spec, "tier policy", "tier=policy", validPolicy)
+	if err != nil {
+		return nil, err
+	}
+	for tier := range policies {
+		if err := validTier(tier); err != nil {
+			return nil, err
+		}
+	}
+	return policies, nil
+}
+
+// parseAssignments parses comma-separated key=value pairs, checking each
+// value with valid
+func parseAssignments(spec, what, form string, valid func(string) error) (map[string]string, error) {
+	values := make(map[string]string)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(entry, "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid %s %q (expected %s)", what, entry, form)
+		}
+		if err := valid(value); err != nil {
+			return nil, err
+		}
+		values[key] = value
+	}
+	return values, nil
+}
+
+// validTier checks the name of a permission tier
+func validTier(tier string) error {
+	if !slices.Contains(mcp.Tiers, tier) {
+		return fmt.Errorf("unknown tool tier %q (expected %s)", tier, strings.Join(mcp.Tiers, ", "))
+	}
+	return nil
+}
+
+// validPolicy checks the name of a tool policy
+func validPolicy(policy string) error {
+	if !slices.Contains(Policies, policy) {
+		return fmt.Errorf("unknown tool policy %q (expected %s)", policy, strings.Join(Policies, ", "))
+	}
+	return nil
+}
+
+// ParseToolTimeouts parses per-tool timeouts in the form "name=30s,other=5m"
+func ParseToolTimeouts(spec string) (map[string]time.Duration, error) {
+	timeouts := make(map[string]time.Duration)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(entry, "=")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("invalid tool timeout %q (expected name=duration)", entry)
+		}
+		timeout, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("invalid timeout for tool %s: %q", name, value)
+		}
+		timeouts[strings.TrimSpace(name)] = timeout
+	}
+	return timeouts, nil
+}
+
+// ParseModelRef splits a "backend/model" reference such as an alias target
+func ParseModelRef(ref string) (string, string, error) {
+	backendName, model, ok := strings.Cut(ref, "/")
+	if !ok || model == "" || !ValidBackend(backendName) {
+		return "", "", fmt.Errorf("invalid model reference %q (expected backend/model, e.g. openai/gpt-4o-mini)", ref)
+	}
+	return backendName, model, nil
+}
+
+// ResolveAlias returns the backend and model an alias points at
+func (c Config) ResolveAlias(name string) (string, string, bool) {
+	ref, ok := c.Aliases[name]
+	if !ok {
+		return "", "", false
+	}
+	backendName, model, err := ParseModelRef(ref)
+	if err != nil {
+		return "", "", false
+	}
+	return backendName, model, true
+}
+
+// SetModel sets the model used for a backend
+func (c *Config) SetModel(backendName, model string) {
+	switch backendName {
+	case BackendOllama:
+		c.OllamaModel = model
+	case BackendAnthropic:
+		c.AnthropicModel = model
+	case BackendGrok:
+		c.GrokModel = model
+	case BackendOpenAI:
+		c.OpenAIModel = model
+	case BackendMock:
+		c.MockModel = model
+	}
+}
+
+// Backends lists the supported backends
+var Backends = []string{BackendOllama, BackendAnthropic, BackendGrok, BackendOpenAI, BackendMock}
+
+// EmbeddingModel returns the embedding model: EmbedModel, or the default
+// of EmbedBackend
+func (c Config) EmbeddingModel() string {
+	if c.EmbedModel != "" {
+		return c.EmbedModel
+	}
+	if c.EmbedBackend == BackendOpenAI {
+		return DefaultOpenAIEmbedModel
+	}
+	return DefaultOllamaEmbedModel
+}
+
+// EmbedBackends lists the backends with an embeddings API
+var EmbedBackends = []string{BackendOllama, BackendOpenAI}
+
+// ValidEmbedBackend reports whether name is a backend with an embeddings API
+func ValidEmbedBackend(name string) bool {
+	return slices.Contains(EmbedBackends, name)
+}
+
+// Rerankers lists the ways retrieved chunks can be re-ranked
+var Rerankers = []string{RerankOff, RerankLLM, RerankCohere, RerankVoyage}
+
+// ValidReranker reports whether name is a reranker
+func ValidReranker(name string) bool {
+	return slices.Contains(Rerankers, name)
+}
+
+// RerankingModel returns the model of a rerank API: RerankModel, or the
+// API's default
+func (c Config) RerankingModel(reranker string) string {
+	if c.RerankModel != "" {
+		return c.RerankModel
+	}
+	if reranker == RerankVoyage {
+		return DefaultVoyageRerankModel
+	}
+	return DefaultCohereRerankModel
+}
+
+// ValidBackend reports whether name is a supported backend
+func ValidBackend(name string) bool {
+	switch name {
+	case BackendOllama, BackendAnthropic, BackendGrok, BackendOpenAI, BackendMock:
+		return true
+	}
+	return false
 }
@@ -0,0 +1,161 @@
+package config
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// EnvFileVar records a variable found in a .env file
+type EnvFileVar struct {
+	File    string
+	Name    string
+	Skipped bool // Already set in the environment, so the file's value was ignored
+	Ignored bool // Not an API key variable, which is all a project's .env may set
+}
+
+// DotEnvFile is a .env file loaded at startup
+type DotEnvFile struct {
+	Path     string
+	KeysOnly bool // Only the API key variables of APIKeyEnvVars are set from it
+}
+
+// DotEnvPaths returns the .env files loaded at startup, most specific first:
+// ./.env, then ~/.extrachat/.env. The working directory may be a cloned
+// repository, so ./.env only supplies API keys: any other variable, such as
+// an EXTRACHAT_* backend URL or MCP server command, could send keys or run
+// commands on its author's behalf.
+func DotEnvPaths() []DotEnvFile {
+	files := []DotEnvFile{{Path: ".env", KeysOnly: true}}
+	if home, err := os.UserHomeDir(); err == nil {
+		files = append(files, DotEnvFile{Path: filepath.Join(home, ".extrachat", ".env")})
+	}
+	return files
+}
+
+// isAPIKeyEnvVar reports whether name is one of APIKeyEnvVars
+func isAPIKeyEnvVar(name string) bool {
+	for _, v := range APIKeyEnvVars {
+		if v == name {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadDotEnv sets environment variables from .env files. Variables that are
+// already set win, so the real environment overrides ./.env, which in turn
+// overrides files later in files. Missing files are skipped, and a
+// malformed file is skipped whole; its error is returned, joined with any
+// others, after the rest are loaded.
+func LoadDotEnv(files ...DotEnvFile) ([]EnvFileVar, error) {
+	var loaded []EnvFileVar
+	var errs []error
+	for _, file := range files {
+		vars, err := parseDotEnv(file.Path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		for _, kv := range vars {
+			entry := EnvFileVar{File: file.Path, Name: kv[0]}
+			if file.KeysOnly && !isAPIKeyEnvVar(kv[0]) {
+				entry.Ignored = true
+			} else if _, ok := os.LookupEnv(kv[0]); ok {
+				entry.Skipped = true
+			} else if err := os.Setenv(kv[0], kv[1]); err != nil {
+				errs = append(errs, fmt.Errorf("failed to set %s from %s: %w", kv[0], file.Path, err))
+				continue
+			}
+			loaded = append(loaded, entry)
+		}
+	}
+	return loaded, errors.Join(errs...)
+}
+
+// parseDotEnv reads KEY=value lines. Blank lines, # comments and an
+// "export " prefix are ignored; single-quoted values are literal and
+// double-quoted values understand \n, \" and \\.
+func parseDotEnv(path string) ([][2]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var vars [][2]string
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		name, value, ok := strings.Cut(line, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || strings.ContainsAny(name, " \t") {
+			return nil, fmt.Errorf("%s:%d: expected KEY=value", path, lineNo)
+		}
+		value, err := dotEnvValue(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, lineNo, err)
+		}
+		vars = append(vars, [2]string{name, value})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return vars, nil
+}
+
+// dotEnvValue unquotes a value, dropping a trailing comment from unquoted ones
+func dotEnvValue(raw string) (string, error) {
+	if raw == "" {
+		return "", nil
+	}
+
+	switch quote := raw[0]; quote {
+	case '\'':
+		end := strings.IndexByte(raw[1:], '\'')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated quoted value")
+		}
+		return raw[1 : end+1], nil
+	case '"':
+		var b strings.Builder
+		for i := 1; i < len(raw); i++ {
+			c := raw[i]
+			switch {
+			case c == '"':
+				return b.String(), nil
+			case c == '\\' && i+1 < len(raw):
+				i++
+				switch raw[i] {
+				case 'n':
+					b.WriteByte('\n')
+				case 't':
+					b.WriteByte('\t')
+				default:
+					b.WriteByte(raw[i])
+				}
+			default:
+				b.WriteByte(c)
+			}
+		}
+		return "", fmt.Errorf("unterminated quoted value")
+	}
+
+	if i := strings.Index(raw, " #"); i >= 0 {
+		raw = raw[:i]
+	}
+	return strings.TrimSpace(raw), nil
+}
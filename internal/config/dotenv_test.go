@@ -0,0 +1,132 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeEnvFile writes a .env file into a temporary directory
+func writeEnvFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestParseDotEnv(t *testing.T) {
+	path := writeEnvFile(t, `
+# a comment
+PLAIN=value
+export EXPORTED=yes
+SPACED = padded value  # trailing comment
+SINGLE='literal \n #not a comment'
+DOUBLE="line\nbreak \"quoted\" \\ done"
+EMPTY=
+`)
+	vars, err := parseDotEnv(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][2]string{
+		{"PLAIN", "value"},
+		{"EXPORTED", "yes"},
+		{"SPACED", "padded value"},
+		{"SINGLE", `literal \n #not a comment`},
+		{"DOUBLE", "line\nbreak \"quoted\" \\ done"},
+		{"EMPTY", ""},
+	}
+	if len(vars) != len(want) {
+		t.Fatalf("got %d variables, want %d: %q", len(vars), len(want), vars)
+	}
+	for i := range want {
+		if vars[i] != want[i] {
+			t.Errorf("variable %d = %q, want %q", i, vars[i], want[i])
+		}
+	}
+}
+
+func TestParseDotEnvRejects(t *testing.T) {
+	for _, content := range []string{
+		"NO_EQUALS\n",
+		"=value\n",
+		"TWO WORDS=value\n",
+		"OPEN='unterminated\n",
+		"OPEN=\"unterminated\n",
+	} {
+		path := writeEnvFile(t, content)
+		_, err := parseDotEnv(path)
+		if err == nil || !strings.Contains(err.Error(), path+":1:") {
+			t.Errorf("parseDotEnv(%q) = %v, want an error at line 1", content, err)
+		}
+	}
+}
+
+func TestLoadDotEnvPrecedence(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "from-environment")
+	t.Setenv("ANTHROPIC_API_KEY", "")
+	os.Unsetenv("ANTHROPIC_API_KEY")
+	t.Setenv("GROK_API_KEY", "")
+	os.Unsetenv("GROK_API_KEY")
+	t.Setenv("EXTRACHAT_BACKEND", "")
+	os.Unsetenv("EXTRACHAT_BACKEND")
+
+	project := writeEnvFile(t, "OPENAI_API_KEY=from-project\nANTHROPIC_API_KEY=from-project\nEXTRACHAT_BACKEND=grok\n")
+	user := writeEnvFile(t, "ANTHROPIC_API_KEY=from-user\nGROK_API_KEY=from-user\nEXTRACHAT_BACKEND=openai\n")
+	missing := filepath.Join(t.TempDir(), ".env")
+
+	loaded, err := LoadDotEnv(
+		DotEnvFile{Path: project, KeysOnly: true},
+		DotEnvFile{Path: missing},
+		DotEnvFile{Path: user},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]string{
+		"OPENAI_API_KEY":    "from-environment", // The environment wins
+		"ANTHROPIC_API_KEY": "from-project",     // ./.env wins over the user's file
+		"GROK_API_KEY":      "from-user",
+		"EXTRACHAT_BACKEND": "openai", // ./.env only sets API keys
+	} {
+		if got := os.Getenv(name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+
+	var skipped, ignored []string
+	for _, v := range loaded {
+		if v.Skipped {
+			skipped = append(skipped, v.File+" "+v.Name)
+		}
+		if v.Ignored {
+			ignored = append(ignored, v.File+" "+v.Name)
+		}
+	}
+	wantSkipped := []string{project + " OPENAI_API_KEY", user + " ANTHROPIC_API_KEY"}
+	if strings.Join(skipped, ",") != strings.Join(wantSkipped, ",") {
+		t.Errorf("skipped %q, want %q", skipped, wantSkipped)
+	}
+	if len(ignored) != 1 || ignored[0] != project+" EXTRACHAT_BACKEND" {
+		t.Errorf("ignored %q, want the project's EXTRACHAT_BACKEND", ignored)
+	}
+}
+
+func TestLoadDotEnvSkipsMalformedFile(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "")
+	os.Unsetenv("OPENAI_API_KEY")
+
+	bad := writeEnvFile(t, "OPENAI_API_KEY=from-bad\nBROKEN\n")
+	good := writeEnvFile(t, "OPENAI_API_KEY=from-good\n")
+	_, err := LoadDotEnv(DotEnvFile{Path: bad}, DotEnvFile{Path: good})
+	if err == nil || !strings.Contains(err.Error(), bad) {
+		t.Fatalf("LoadDotEnv = %v, want an error naming %s", err, bad)
+	}
+	if got := os.Getenv("OPENAI_API_KEY"); got != "from-good" {
+		t.Errorf("OPENAI_API_KEY = %q, want the later file's value", got)
+	}
+}
@@ -0,0 +1,616 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"ExtraChat/internal/mcp"
+	"ExtraChat/internal/pricing"
+)
+
+// fileConfig is the layout of config.yaml. Durations are strings in
+// time.ParseDuration format ("90s", "5m").
+type fileConfig struct {
+	Backend string `yaml:"backend"`
+	Debug   bool   `yaml:"debug"`
+	Plain   bool   `yaml:"plain"`
+	Output  string `yaml:"output"`
+
+	Notify struct {
+		After string `yaml:"after"`
+	} `yaml:"notify"`
+
+	Models struct {
+		Ollama    string `yaml:"ollama"`
+		Anthropic string `yaml:"anthropic"`
+		Grok      string `yaml:"grok"`
+		OpenAI    string `yaml:"openai"`
+		Mock      string `yaml:"mock"`
+	} `yaml:"models"`
+
+	URLs struct {
+		Ollama    string `yaml:"ollama"`
+		Anthropic string `yaml:"anthropic"`
+		Grok      string `yaml:"grok"`
+		OpenAI    string `yaml:"openai"`
+		Cohere    string `yaml:"cohere"`
+		Voyage    string `yaml:"voyage"`
+	} `yaml:"urls"`
+
+	Ollama OllamaOptions `yaml:"ollama"`
+
+	StopSequences []string `yaml:"stop_sequences"`
+
+	APIKeys map[string]string        `yaml:"api_keys"`
+	Aliases map[string]string        `yaml:"aliases"`
+	Pricing map[string]pricing.Price `yaml:"pricing"`
+
+	Personas map[string]Persona      `yaml:"personas"`
+	Commands map[string]CommandSteps `yaml:"commands"`
+	Tenants  map[string]Tenant       `yaml:"tenants"`
+
+	Schedule struct {
+		Jobs      []ScheduledJob    `yaml:"jobs"`
+		Sinks     map[string]Sink   `yaml:"sinks"`
+		Templates map[string]string `yaml:"templates"` // Prompts jobs name with template
+	} `yaml:"schedule"`
+
+	Router struct {
+		Enabled bool        `yaml:"enabled"`
+		Rules   []RouteRule `yaml:"rules"`
+	} `yaml:"router"`
+
+	BestOf struct {
+		Judge string `yaml:"judge"`
+	} `yaml:"bestof"`
+
+	Guardrails struct {
+		Input           ContentFilter `yaml:"input"`
+		Output          ContentFilter `yaml:"output"`
+		ModerationModel string        `yaml:"moderation_model"`
+		SecretScan      bool          `yaml:"secret_scan"`
+	} `yaml:"guardrails"`
+
+	Mock struct {
+		Fixtures     string `yaml:"fixtures"`
+		Latency      string `yaml:"latency"`
+		ErrorPercent int    `yaml:"error_percent"`
+	} `yaml:"mock"`
+
+	HTTP struct {
+		Timeout       string `yaml:"timeout"`
+		DialTimeout   string `yaml:"dial_timeout"`
+		TLSTimeout    string `yaml:"tls_timeout"`
+		HeaderTimeout string `yaml:"header_timeout"`
+		IdleTimeout   string `yaml:"idle_timeout"`
+		MaxIdleConns  int    `yaml:"max_idle_conns"`
+	} `yaml:"http"`
+
+	Summarizer struct {
+		Backend   string `yaml:"backend"`
+		Model     string `yaml:"model"`
+		AutoTitle bool   `yaml:"auto_title"`
+	} `yaml:"summarizer"`
+
+	RAG struct {
+		Enabled      bool   `yaml:"enabled"`
+		Backend      string `yaml:"backend"`
+		Model        string `yaml:"model"`
+		TopK         int    `yaml:"top_k"`
+		ChunkSize    int    `yaml:"chunk_size"`
+		ChunkOverlap int    `yaml:"chunk_overlap"`
+
+		Rerank           string `yaml:"rerank"`
+		RerankModel      string `yaml:"rerank_model"`
+		RerankCandidates int    `yaml:"rerank_candidates"`
+	} `yaml:"rag"`
+
+	Fetch struct {
+		AllowedDomains []string `yaml:"allowed_domains"`
+		MaxSizeKB      int      `yaml:"max_size_kb"`
+		AllowPrivate   bool     `yaml:"allow_private"`
+	} `yaml:"fetch"`
+
+	Backup struct {
+		Dir       string `yaml:"dir"`
+		Retention int    `yaml:"retention"`
+		Time      string `yaml:"time"`
+	} `yaml:"backup"`
+
+	Audit struct {
+		Path       string `yaml:"path"`
+		MaxSizeMB  int    `yaml:"max_size_mb"`
+		MaxBackups int    `yaml:"max_backups"`
+		MaxAgeDays int    `yaml:"max_age_days"`
+	} `yaml:"audit"`
+
+	Context struct {
+		MaxTokens int `yaml:"max_tokens"`
+	} `yaml:"context"`
+
+	Database struct {
+		Path     string `yaml:"path"`
+		PageSize int    `yaml:"page_size"`
+	} `yaml:"database"`
+
+	Cache struct {
+		Enabled bool   `yaml:"enabled"`
+		TTL     string `yaml:"ttl"`
+	} `yaml:"cache"`
+
+	Telemetry struct {
+		Enabled   bool   `yaml:"enabled"`
+		LogDir    string `yaml:"log_dir"`
+		LogLevel  string `yaml:"log_level"`
+		PprofAddr string `yaml:"pprof_addr"`
+	} `yaml:"telemetry"`
+
+	MCP struct {
+		Enabled            bool                        `yaml:"enabled"`
+		Config             string                      `yaml:"config"`
+		Servers            map[string]mcp.ServerConfig `yaml:"servers"`
+		LogLevel           string                      `yaml:"log_level"`
+		BuiltinTools       bool                        `yaml:"builtin_tools"`
+		SandboxRoot        string                      `yaml:"sandbox_root"`
+		AutoApprove        []string                    `yaml:"auto_approve"`
+		MaxToolIterations  int                         `yaml:"max_tool_iterations"`
+		ToolTimeout        string                      `yaml:"tool_timeout"`
+		ToolTimeouts       map[string]string           `yaml:"tool_timeouts"`
+		ToolTiers          map[string]string           `yaml:"tool_tiers"`
+		TierPolicies       map[string]string           `yaml:"tier_policies"`
+		StartupConcurrency int                         `yaml:"startup_concurrency"`
+		StartupTimeout     string                      `yaml:"startup_timeout"`
+	} `yaml:"mcp"`
+}
+
+// DefaultConfigPath returns ~/.config/extrachat/config.yaml (or the
+// platform's equivalent user config directory)
+func DefaultConfigPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate user config directory: %w", err)
+	}
+	return filepath.Join(dir, "extrachat", "config.yaml"), nil
+}
+
+// LoadFile layers a YAML config file over cfg. Settings missing from the
+// file keep their value in cfg. An empty path loads DefaultConfigPath if
+// it exists; an explicit path must exist.
+func LoadFile(cfg Config, path string) (Config, error) {
+	explicit := path != ""
+	if !explicit {
+		var err error
+		if path, err = DefaultConfigPath(); err != nil {
+			return cfg, nil
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !explicit && errors.Is(err, fs.ErrNotExist) {
+			return cfg, nil
+		}
+		return cfg, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	file := toFile(cfg)
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return cfg, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	if err := file.apply(&cfg, filepath.Dir(path)); err != nil {
+		return cfg, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	cfg.ConfigFile = path
+	return cfg, nil
+}
+
+// toFile fills a fileConfig with the current settings so that keys absent
+// from the file leave them unchanged
+func toFile(cfg Config) fileConfig {
+	var f fileConfig
+	f.Backend = cfg.Backend
+	f.Debug = cfg.Debug
+	f.Plain = cfg.Plain
+	f.Output = cfg.Output
+	f.Models.Ollama = cfg.OllamaModel
+	f.Models.Anthropic = cfg.AnthropicModel
+	f.Models.Grok = cfg.GrokModel
+	f.Models.OpenAI = cfg.OpenAIModel
+	f.Models.Mock = cfg.MockModel
+	f.Ollama = cfg.OllamaOptions.clone()
+	f.StopSequences = cfg.StopSequences
+	f.URLs.Ollama = cfg.OllamaURL
+	f.URLs.Anthropic = cfg.AnthropicURL
+	f.URLs.Grok = cfg.GrokURL
+	f.URLs.OpenAI = cfg.OpenAIURL
+	f.URLs.Cohere = cfg.CohereURL
+	f.URLs.Voyage = cfg.VoyageURL
+	f.Mock.Fixtures = cfg.MockFixtures
+	f.Mock.ErrorPercent = cfg.MockErrorPercent
+	f.HTTP.MaxIdleConns = cfg.HTTPMaxIdleConns
+	f.Summarizer.Backend = cfg.SummarizerBackend
+	f.Summarizer.Model = cfg.SummarizerModel
+	f.Summarizer.AutoTitle = cfg.AutoTitle
+	f.Router.Enabled = cfg.RouterEnabled
+	f.BestOf.Judge = cfg.BestOfJudge
+	f.Guardrails.Input = cfg.InputFilter
+	f.Guardrails.Output = cfg.OutputFilter
+	f.Guardrails.ModerationModel = cfg.ModerationModel
+	f.Guardrails.SecretScan = cfg.SecretScan
+	f.RAG.Enabled = cfg.RAGEnabled
+	f.RAG.Backend = cfg.EmbedBackend
+	f.RAG.Model = cfg.EmbedModel
+	f.RAG.TopK = cfg.RAGTopK
+	f.RAG.ChunkSize = cfg.ChunkSize
+	f.RAG.ChunkOverlap = cfg.ChunkOverlap
+	f.RAG.Rerank = cfg.Rerank
+	f.RAG.RerankModel = cfg.RerankModel
+	f.RAG.RerankCandidates = cfg.RerankCandidates
+	f.Fetch.AllowedDomains = cfg.FetchAllowedDomains
+	f.Fetch.MaxSizeKB = cfg.FetchMaxSize
+	f.Fetch.AllowPrivate = cfg.FetchAllowPrivate
+	f.Backup.Dir = cfg.BackupDir
+	f.Backup.Retention = cfg.BackupRetention
+	f.Backup.Time = cfg.BackupTime
+	f.Audit.Path = cfg.AuditLog
+	f.Audit.MaxSizeMB = cfg.AuditMaxSize
+	f.Audit.MaxBackups = cfg.AuditMaxBackups
+	f.Audit.MaxAgeDays = cfg.AuditMaxAge
+	f.Context.MaxTokens = cfg.ContextMaxTokens
+	f.Database.Path = cfg.DBPath
+	f.Database.PageSize = cfg.PageSize
+	f.Cache.Enabled = cfg.CacheEnabled
+	f.Telemetry.Enabled = cfg.TelemetryEnabled
+	f.Telemetry.LogDir = cfg.LogDir
+	f.Telemetry.PprofAddr = cfg.PprofAddr
+	f.Telemetry.LogLevel = cfg.LogLevel
+	f.MCP.Enabled = cfg.MCPEnabled
+	f.MCP.Config = cfg.MCPConfigFile
+	f.MCP.LogLevel = cfg.MCPLogLevel
+	f.MCP.BuiltinTools = cfg.BuiltinTools
+	f.MCP.SandboxRoot = cfg.SandboxRoot
+	f.MCP.AutoApprove = cfg.ToolAutoApprove
+	f.MCP.MaxToolIterations = cfg.MaxToolIterations
+	f.MCP.StartupConcurrency = cfg.MCPStartupConcurrency
+	return f
+}
+
+// apply copies the file's settings into cfg. Relative paths in the mcp
+// section are resolved against baseDir, the config file's directory.
+func (f fileConfig) apply(cfg *Config, baseDir string) error {
+	for name, ref := range f.Aliases {
+		if ValidBackend(name) {
+			return fmt.Errorf("alias %q shadows a backend", name)
+		}
+		if _, _, err := ParseModelRef(ref); err != nil {
+			return fmt.Errorf("alias %s: %w", name, err)
+		}
+	}
+	if _, isAlias := f.Aliases[f.Backend]; !ValidBackend(f.Backend) && !isAlias {
+		return fmt.Errorf("unknown backend %q", f.Backend)
+	}
+	if err := validOutput(f.Output); err != nil {
+		return err
+	}
+	if err := validEmbedBackend(f.RAG.Backend); err != nil {
+		return fmt.Errorf("rag: %w", err)
+	}
+	if err := validReranker(f.RAG.Rerank); err != nil {
+		return fmt.Errorf("rag: %w", err)
+	}
+	if err := f.Ollama.validate(); err != nil {
+		return fmt.Errorf("ollama: %w", err)
+	}
+	if err := ValidStopSequences(f.StopSequences); err != nil {
+		return fmt.Errorf("stop_sequences: %w", err)
+	}
+	if err := validErrorPercent(f.Mock.ErrorPercent); err != nil {
+		return fmt.Errorf("mock: %w", err)
+	}
+	if f.HTTP.MaxIdleConns < 0 {
+		return fmt.Errorf("http: max_idle_conns must not be negative")
+	}
+	if f.Database.PageSize < 0 {
+		return fmt.Errorf("database: page_size must not be negative")
+	}
+	if f.MCP.StartupConcurrency <= 0 {
+		return fmt.Errorf("mcp: startup_concurrency must be positive")
+	}
+
+	cfg.Backend = f.Backend
+	cfg.Debug = f.Debug
+	cfg.Plain = f.Plain
+	cfg.Output = f.Output
+	cfg.OllamaModel = f.Models.Ollama
+	cfg.AnthropicModel = f.Models.Anthropic
+	cfg.GrokModel = f.Models.Grok
+	cfg.OpenAIModel = f.Models.OpenAI
+	cfg.MockModel = f.Models.Mock
+	cfg.OllamaOptions = f.Ollama
+	cfg.StopSequences = f.StopSequences
+	cfg.OllamaURL = f.URLs.Ollama
+	cfg.AnthropicURL = f.URLs.Anthropic
+	cfg.GrokURL = f.URLs.Grok
+	cfg.OpenAIURL = f.URLs.OpenAI
+	cfg.CohereURL = f.URLs.Cohere
+	cfg.VoyageURL = f.URLs.Voyage
+	cfg.MockErrorPercent = f.Mock.ErrorPercent
+	cfg.HTTPMaxIdleConns = f.HTTP.MaxIdleConns
+	cfg.SummarizerBackend = f.Summarizer.Backend
+	cfg.SummarizerModel = f.Summarizer.Model
+	cfg.AutoTitle = f.Summarizer.AutoTitle
+	cfg.RouterEnabled = f.Router.Enabled
+	cfg.BestOfJudge = f.BestOf.Judge
+	cfg.ModerationModel = f.Guardrails.ModerationModel
+	cfg.SecretScan = f.Guardrails.SecretScan
+	cfg.RAGEnabled = f.RAG.Enabled
+	cfg.EmbedBackend = f.RAG.Backend
+	cfg.EmbedModel = f.RAG.Model
+	cfg.RAGTopK = f.RAG.TopK
+	cfg.ChunkSize = f.RAG.ChunkSize
+	cfg.ChunkOverlap = f.RAG.ChunkOverlap
+	cfg.Rerank = f.RAG.Rerank
+	cfg.RerankModel = f.RAG.RerankModel
+	cfg.RerankCandidates = f.RAG.RerankCandidates
+	cfg.FetchAllowedDomains = f.Fetch.AllowedDomains
+	cfg.FetchMaxSize = f.Fetch.MaxSizeKB
+	cfg.FetchAllowPrivate = f.Fetch.AllowPrivate
+	cfg.BackupDir = f.Backup.Dir
+	cfg.BackupRetention = f.Backup.Retention
+	cfg.BackupTime = f.Backup.Time
+	cfg.AuditLog = f.Audit.Path
+	cfg.AuditMaxSize = f.Audit.MaxSizeMB
+	cfg.AuditMaxBackups = f.Audit.MaxBackups
+	cfg.AuditMaxAge = f.Audit.MaxAgeDays
+	cfg.ContextMaxTokens = f.Context.MaxTokens
+	cfg.DBPath = f.Database.Path
+	cfg.PageSize = f.Database.PageSize
+	cfg.CacheEnabled = f.Cache.Enabled
+	cfg.TelemetryEnabled = f.Telemetry.Enabled
+	cfg.LogDir = f.Telemetry.LogDir
+	cfg.PprofAddr = f.Telemetry.PprofAddr
+	cfg.LogLevel = f.Telemetry.LogLevel
+	cfg.MCPEnabled = f.MCP.Enabled
+	cfg.MCPLogLevel = f.MCP.LogLevel
+	cfg.BuiltinTools = f.MCP.BuiltinTools
+	cfg.SandboxRoot = f.MCP.SandboxRoot
+	cfg.ToolAutoApprove = f.MCP.AutoApprove
+	cfg.MaxToolIterations = f.MCP.MaxToolIterations
+	cfg.MCPStartupConcurrency = f.MCP.StartupConcurrency
+
+	for backend := range f.APIKeys {
+		if _, ok := APIKeyEnvVars[backend]; !ok {
+			return fmt.Errorf("api_keys: backend %q does not take an API key", backend)
+		}
+	}
+	if f.APIKeys != nil {
+		cfg.APIKeys = f.APIKeys
+	}
+	if f.Aliases != nil {
+		cfg.Aliases = f.Aliases
+	}
+	for model, price := range f.Pricing {
+		if price.Input < 0 || price.Output < 0 {
+			return fmt.Errorf("pricing: negative price for %s", model)
+		}
+	}
+	if f.Pricing != nil {
+		cfg.Pricing = f.Pricing
+	}
+	if err := validatePersonas(f.Personas, cfg.Aliases); err != nil {
+		return err
+	}
+	if f.Personas != nil {
+		cfg.Personas = f.Personas
+	}
+	if f.Commands != nil {
+		commands, err := normalizeCommands(f.Commands)
+		if err != nil {
+			return err
+		}
+		cfg.Commands = commands
+	}
+	if err := validateRouteRules(f.Router.Rules, cfg.Aliases); err != nil {
+		return err
+	}
+	if f.Router.Rules != nil {
+		cfg.RouterRules = f.Router.Rules
+	}
+	if err := validateContentFilter("input", f.Guardrails.Input); err != nil {
+		return err
+	}
+	if err := validateContentFilter("output", f.Guardrails.Output); err != nil {
+		return err
+	}
+	cfg.InputFilter, cfg.OutputFilter = f.Guardrails.Input, f.Guardrails.Output
+	if err := validateTenants(f.Tenants); err != nil {
+		return err
+	}
+	if f.Tenants != nil {
+		cfg.Tenants = f.Tenants
+	}
+	if err := validateSchedule(f.Schedule.Jobs, f.Schedule.Sinks, f.Schedule.Templates, cfg.Personas, cfg.Aliases, baseDir); err != nil {
+		return err
+	}
+	if f.Schedule.Jobs != nil {
+		cfg.Schedule = f.Schedule.Jobs
+	}
+	if f.Schedule.Sinks != nil {
+		cfg.Sinks = f.Schedule.Sinks
+	}
+
+	if f.Notify.After != "" {
+		after, err := time.ParseDuration(f.Notify.After)
+		if err != nil || after < 0 {
+			return fmt.Errorf("invalid notify after %q", f.Notify.After)
+		}
+		cfg.NotifyAfter = after
+	}
+
+	if f.Cache.TTL != "" {
+		ttl, err := time.ParseDuration(f.Cache.TTL)
+		if err != nil || ttl < 0 {
+			return fmt.Errorf("invalid cache ttl %q", f.Cache.TTL)
+		}
+		cfg.CacheTTL = ttl
+	}
+
+	if f.Mock.Fixtures != cfg.MockFixtures {
+		cfg.MockFixtures = resolvePath(f.Mock.Fixtures, baseDir)
+	}
+	if f.Mock.Latency != "" {
+		latency, err := time.ParseDuration(f.Mock.Latency)
+		if err != nil || latency < 0 {
+			return fmt.Errorf("invalid mock latency %q", f.Mock.Latency)
+		}
+		cfg.MockLatency = latency
+	}
+
+	for _, timeout := range []struct {
+		name  string
+		value string
+		field *time.Duration
+	}{
+		{"timeout", f.HTTP.Timeout, &cfg.HTTPTimeout},
+		{"dial_timeout", f.HTTP.DialTimeout, &cfg.HTTPDialTimeout},
+		{"tls_timeout", f.HTTP.TLSTimeout, &cfg.HTTPTLSTimeout},
+		{"header_timeout", f.HTTP.HeaderTimeout, &cfg.HTTPHeaderTimeout},
+		{"idle_timeout", f.HTTP.IdleTimeout, &cfg.HTTPIdleTimeout},
+	} {
+		if timeout.value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(timeout.value)
+		if err != nil || d < 0 {
+			return fmt.Errorf("invalid http %s %q", timeout.name, timeout.value)
+		}
+		*timeout.field = d
+	}
+
+	if f.MCP.Config != cfg.MCPConfigFile {
+		cfg.MCPConfigFile = resolvePath(f.MCP.Config, baseDir)
+	}
+	if len(f.MCP.Servers) > 0 {
+		servers, err := mcp.NamedServers(f.MCP.Servers, baseDir)
+		if err != nil {
+			return err
+		}
+		cfg.MCPServers = servers
+	}
+	if f.MCP.ToolTimeout != "" {
+		timeout, err := time.ParseDuration(f.MCP.ToolTimeout)
+		if err != nil || timeout <= 0 {
+			return fmt.Errorf("invalid mcp tool_timeout %q", f.MCP.ToolTimeout)
+		}
+		cfg.ToolTimeout = timeout
+	}
+	if f.MCP.StartupTimeout != "" {
+		timeout, err := time.ParseDuration(f.MCP.StartupTimeout)
+		if err != nil || timeout <= 0 {
+			return fmt.Errorf("invalid mcp startup_timeout %q", f.MCP.StartupTimeout)
+		}
+		cfg.MCPStartupTimeout = timeout
+	}
+	if len(f.MCP.ToolTimeouts) > 0 {
+		cfg.ToolTimeouts = make(map[string]time.Duration, len(f.MCP.ToolTimeouts))
+		for name, value := range f.MCP.ToolTimeouts {
+			timeout, err := time.ParseDuration(value)
+			if err != nil || timeout <= 0 {
+				return fmt.Errorf("invalid timeout for tool %s: %q", name, value)
+			}
+			cfg.ToolTimeouts[name] = timeout
+		}
+	}
+	for name, tier := range f.MCP.ToolTiers {
+		if err := validTier(tier); err != nil {
+			return fmt.Errorf("mcp: tool_tiers: %s: %w", name, err)
+		}
+	}
+	if len(f.MCP.ToolTiers) > 0 {
+		cfg.ToolTiers = f.MCP.ToolTiers
+	}
+	for tier, policy := range f.MCP.TierPolicies {
+		if err := validTier(tier); err != nil {
+			return fmt.Errorf("mcp: tier_policies: %w", err)
+		}
+		if err := validPolicy(policy); err != nil {
+			return fmt.Errorf("mcp: tier_policies: %s: %w", tier, err)
+		}
+	}
+	if len(f.MCP.TierPolicies) > 0 {
+		cfg.TierPolicies = f.MCP.TierPolicies
+	}
+	return nil
+}
+
+// resolvePath makes a relative path from the config file absolute
+func resolvePath(path, baseDir string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(baseDir, path)
+}
+
+// SaveSetting writes one setting into the config file at path, creating the
+// file if needed. Other keys keep their order; comments are not preserved.
+func SaveSetting(path, key string, value interface{}) error {
+	var doc yaml.MapSlice
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return fmt.Errorf("failed to parse config file %s: %w", path, err)
+		}
+	case errors.Is(err, fs.ErrNotExist):
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return fmt.Errorf("failed to create config directory: %w", err)
+		}
+	default:
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	doc = setPath(doc, strings.Split(key, "."), value)
+	out, err := yaml.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("failed to encode config file: %w", err)
+	}
+
+	// Write atomically so a crash can't leave a truncated config behind
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, out, 0600); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	return nil
+}
+
+// setPath sets a nested key in a YAML mapping, adding sections as needed
+func setPath(doc yaml.MapSlice, keys []string, value interface{}) yaml.MapSlice {
+	for i, item := range doc {
+		if fmt.Sprint(item.Key) != keys[0] {
+			continue
+		}
+		if len(keys) == 1 {
+			doc[i].Value = value
+		} else {
+			section, _ := item.Value.(yaml.MapSlice)
+			doc[i].Value = setPath(section, keys[1:], value)
+		}
+		return doc
+	}
+
+	if len(keys) == 1 {
+		return append(doc, yaml.MapItem{Key: keys[0], Value: value})
+	}
+	return append(doc, yaml.MapItem{Key: keys[0], Value: setPath(nil, keys[1:], value)})
+}
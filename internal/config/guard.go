@@ -0,0 +1,36 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// DefaultModerationModel is the OpenAI moderation model guardrails use
+const DefaultModerationModel = "omni-moderation-latest"
+
+// ContentFilter is a guardrail on the prompts sent to a backend or on the
+// replies that come back. Text that trips any of its checks is blocked.
+type ContentFilter struct {
+	Keywords   []string `yaml:"keywords,omitempty"`   // Blocked words and phrases, matched as whole words in any case
+	Patterns   []string `yaml:"patterns,omitempty"`   // Blocked regular expressions
+	MaxLength  int      `yaml:"max_length,omitempty"` // Most characters; 0 for no limit
+	Moderation bool     `yaml:"moderation,omitempty"` // Blocked when the OpenAI moderation API flags it
+}
+
+// Enabled reports whether the filter checks anything
+func (f ContentFilter) Enabled() bool {
+	return len(f.Keywords) > 0 || len(f.Patterns) > 0 || f.MaxLength > 0 || f.Moderation
+}
+
+// validateContentFilter checks a filter defined in the config file
+func validateContentFilter(name string, f ContentFilter) error {
+	for _, pattern := range f.Patterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("guardrails: %s: invalid pattern: %w", name, err)
+		}
+	}
+	if f.MaxLength < 0 {
+		return fmt.Errorf("guardrails: %s: negative max_length", name)
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// OllamaOptions are the generation options sent with every Ollama chat
+// request. Unset options leave the model's own defaults, which for
+// llama3-family models include a 2048-token context.
+type OllamaOptions struct {
+	NumCtx      int      `yaml:"num_ctx,omitempty"`     // Context window in tokens; 0 for the model's default
+	Temperature *float64 `yaml:"temperature,omitempty"` // nil for the model's default
+	TopK        int      `yaml:"top_k,omitempty"`       // 0 for the model's default
+	Seed        *int     `yaml:"seed,omitempty"`        // Fixed seed for reproducible replies; nil for random
+	Stop        []string `yaml:"stop,omitempty"`        // Sequences that end the reply
+	KeepAlive   string   `yaml:"keep_alive,omitempty"`  // How long the model stays loaded, e.g. "30m"; negative keeps it loaded
+}
+
+// Options returns the options in the form of the "options" object of the
+// Ollama API, nil when none are set
+func (o OllamaOptions) Options() map[string]interface{} {
+	options := make(map[string]interface{})
+	if o.NumCtx > 0 {
+		options["num_ctx"] = o.NumCtx
+	}
+	if o.Temperature != nil {
+		options["temperature"] = *o.Temperature
+	}
+	if o.TopK > 0 {
+		options["top_k"] = o.TopK
+	}
+	if o.Seed != nil {
+		options["seed"] = *o.Seed
+	}
+	if len(o.Stop) > 0 {
+		options["stop"] = o.Stop
+	}
+	if len(options) == 0 {
+		return nil
+	}
+	return options
+}
+
+// KeepAliveValue returns KeepAlive for the "keep_alive" field of the Ollama
+// API, which takes durations as strings and plain numbers as seconds; nil
+// when unset
+func (o OllamaOptions) KeepAliveValue() interface{} {
+	if o.KeepAlive == "" {
+		return nil
+	}
+	if seconds, err := strconv.Atoi(o.KeepAlive); err == nil {
+		return seconds
+	}
+	return o.KeepAlive
+}
+
+// clone copies the options so that parsing a config file into the copy
+// can't change the original's pointers
+func (o OllamaOptions) clone() OllamaOptions {
+	if o.Temperature != nil {
+		t := *o.Temperature
+		o.Temperature = &t
+	}
+	if o.Seed != nil {
+		s := *o.Seed
+		o.Seed = &s
+	}
+	o.Stop = slices.Clone(o.Stop)
+	return o
+}
+
+// validate checks options defined in the config file
+func (o OllamaOptions) validate() error {
+	if o.NumCtx < 0 || o.TopK < 0 {
+		return fmt.Errorf("num_ctx and top_k must not be negative")
+	}
+	if o.Temperature != nil {
+		if err := validTemperature(*o.Temperature); err != nil {
+			return err
+		}
+	}
+	return validKeepAlive(o.KeepAlive)
+}
+
+// validTemperature checks a sampling temperature
+func validTemperature(t float64) error {
+	if t < 0 || t > 2 {
+		return fmt.Errorf("temperature must be from 0 to 2, got %g", t)
+	}
+	return nil
+}
+
+// validKeepAlive checks a keep_alive value: a duration, or a number of
+// seconds
+func validKeepAlive(value string) error {
+	if value == "" {
+		return nil
+	}
+	if _, err := strconv.Atoi(value); err == nil {
+		return nil
+	}
+	if _, err := time.ParseDuration(value); err != nil {
+		return fmt.Errorf("invalid keep_alive %q (expected a duration such as 30m, or seconds)", value)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Persona is a named system prompt preset, selected with /persona
+type Persona struct {
+	System string          `yaml:"system"`
+	Model  string          `yaml:"model,omitempty"` // Preferred model: an alias or "backend/model"; empty keeps the current one
+	Post   []PostProcessor `yaml:"post,omitempty"`  // Applied to the replies in order
+}
+
+// builtinPersonas are available without configuration; the config file can
+// override them by name
+var builtinPersonas = map[string]Persona{
+	"sre": {
+		System: "You are a senior site reliability engineer. Be precise and terse. " +
+			"When diagnosing, state the most likely causes first, give the commands or queries to confirm them, " +
+			"and call out risky operations and how to roll them back.",
+	},
+	"copywriter": {
+		System: "You are an experienced copywriter. Write clear, vivid, concise copy in an active voice. " +
+			"Ask about audience, tone and length when they matter and are not given, " +
+			"and offer two or three alternatives for headlines and taglines.",
+	},
+	"socratic-tutor": {
+		System: "You are a Socratic tutor. Don't give answers outright; guide the student with one focused question at a time, " +
+			"build on what they already know, and confirm understanding before moving on. " +
+			"Give a direct explanation only when the student is stuck after several attempts.",
+	},
+}
+
+// Persona returns the persona called name, from the config file or the
+// built-in presets
+func (c Config) Persona(name string) (Persona, bool) {
+	if persona, ok := c.Personas[name]; ok {
+		return persona, true
+	}
+	persona, ok := builtinPersonas[name]
+	return persona, ok
+}
+
+// PersonaNames returns the names of all available personas, sorted
+func (c Config) PersonaNames() []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, personas := range []map[string]Persona{builtinPersonas, c.Personas} {
+		for name := range personas {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ResolveModelRef returns the backend and model of an alias or a
+// "backend/model" reference
+func (c Config) ResolveModelRef(ref string) (string, string, error) {
+	if backendName, model, ok := c.ResolveAlias(ref); ok {
+		return backendName, model, nil
+	}
+	return ParseModelRef(ref)
+}
+
+// validatePersonas checks the personas defined in the config file
+func validatePersonas(personas map[string]Persona, aliases map[string]string) error {
+	for name, persona := range personas {
+		if persona.System == "" {
+			return fmt.Errorf("persona %s: system prompt is empty", name)
+		}
+		if err := validatePostProcessors(persona.Post); err != nil {
+			return fmt.Errorf("persona %s: %w", name, err)
+		}
+		if persona.Model == "" {
+			continue
+		}
+		if _, isAlias := aliases[persona.Model]; isAlias {
+			continue
+		}
+		if _, _, err := ParseModelRef(persona.Model); err != nil {
+			return fmt.Errorf("persona %s: %w", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Kinds of post-processors
+const (
+	PostTrimFences  = "trim_fences"  // Drop the ``` lines around code blocks, keeping the code
+	PostExtractJSON = "extract_json" // Keep only the first JSON object or array of the reply
+	PostFormat      = "format"       // Pipe the code blocks of one language through a formatter
+)
+
+// PostProcessors lists the kinds of post-processors
+var PostProcessors = []string{PostTrimFences, PostExtractJSON, PostFormat}
+
+// PostProcessor rewrites assistant replies before they are shown and
+// stored. In the config file it is the name of a built-in or, for a
+// formatter, a mapping such as {format: go, command: gofmt}.
+type PostProcessor struct {
+	Kind    string
+	Lang    string // Language of the code blocks a formatter runs on, as in ```go
+	Command string // Shell command reading a code block on stdin and writing it formatted
+}
+
+// UnmarshalYAML accepts a post-processor's name as well as a formatter
+func (p *PostProcessor) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var kind string
+	if err := unmarshal(&kind); err == nil {
+		*p = PostProcessor{Kind: kind}
+		return nil
+	}
+	var format struct {
+		Format  string `yaml:"format"`
+		Command string `yaml:"command"`
+	}
+	if err := unmarshal(&format); err != nil {
+		return fmt.Errorf("expected %s, %s or {format: <lang>, command: <command>}", PostTrimFences, PostExtractJSON)
+	}
+	*p = PostProcessor{Kind: PostFormat, Lang: format.Format, Command: format.Command}
+	return nil
+}
+
+// String describes the post-processor as in the config file
+func (p PostProcessor) String() string {
+	if p.Kind == PostFormat {
+		return fmt.Sprintf("format %s: %s", p.Lang, p.Command)
+	}
+	return p.Kind
+}
+
+// validatePostProcessors checks the post-processors of a persona
+func validatePostProcessors(post []PostProcessor) error {
+	for _, p := range post {
+		if err := p.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Validate checks a post-processor from the config file or a pipeline
+func (p PostProcessor) Validate() error {
+	switch p.Kind {
+	case PostTrimFences, PostExtractJSON:
+		return nil
+	case PostFormat:
+		if strings.TrimSpace(p.Lang) == "" || strings.TrimSpace(p.Command) == "" {
+			return fmt.Errorf("post: a formatter needs a language and a command")
+		}
+		return nil
+	default:
+		return fmt.Errorf("post: unknown post-processor %q (one of: %s)", p.Kind, strings.Join(PostProcessors, ", "))
+	}
+}
@@ -0,0 +1,68 @@
+package config
+
+import "fmt"
+
+// What a routing rule picks its model by
+const (
+	PreferCost    = "cost"
+	PreferLatency = "latency"
+)
+
+// RouteRule is a rule of the model router. A prompt matching all of its
+// conditions goes to the cheapest (or fastest) adequate model it lists; a
+// rule without conditions matches every prompt.
+type RouteRule struct {
+	Name      string   `yaml:"name,omitempty"`       // Shown in routing decisions; defaults to rule N
+	Code      *bool    `yaml:"code,omitempty"`       // The prompt contains or asks about code
+	Tools     *bool    `yaml:"tools,omitempty"`      // The prompt names an available MCP tool
+	MinTokens int      `yaml:"min_tokens,omitempty"` // Estimated tokens of the prompt, at least
+	MaxTokens int      `yaml:"max_tokens,omitempty"` // Estimated tokens of the prompt, at most; 0 for no limit
+	Models    []string `yaml:"models"`               // Aliases, backends or backend/model references
+	Prefer    string   `yaml:"prefer,omitempty"`     // PreferCost (default) or PreferLatency
+}
+
+// RuleName returns the name of the i-th rule (from 0) for display
+func (r RouteRule) RuleName(i int) string {
+	if r.Name != "" {
+		return r.Name
+	}
+	return fmt.Sprintf("rule %d", i+1)
+}
+
+// ResolveRouteModel returns the backend and model of a model in a routing
+// rule; the model is empty for a plain backend, which uses its configured
+// model
+func (c Config) ResolveRouteModel(ref string) (string, string, error) {
+	if ValidBackend(ref) {
+		return ref, "", nil
+	}
+	return c.ResolveModelRef(ref)
+}
+
+// validateRouteRules checks the routing rules defined in the config file
+func validateRouteRules(rules []RouteRule, aliases map[string]string) error {
+	c := Config{Aliases: aliases}
+	for i, rule := range rules {
+		name := rule.RuleName(i)
+		if len(rule.Models) == 0 {
+			return fmt.Errorf("router: %s lists no models", name)
+		}
+		for _, ref := range rule.Models {
+			if _, _, err := c.ResolveRouteModel(ref); err != nil {
+				return fmt.Errorf("router: %s: %w", name, err)
+			}
+		}
+		if rule.MinTokens < 0 || rule.MaxTokens < 0 {
+			return fmt.Errorf("router: %s: negative token limit", name)
+		}
+		if rule.MaxTokens > 0 && rule.MinTokens > rule.MaxTokens {
+			return fmt.Errorf("router: %s: min_tokens is above max_tokens", name)
+		}
+		switch rule.Prefer {
+		case "", PreferCost, PreferLatency:
+		default:
+			return fmt.Errorf("router: %s: prefer must be %s or %s", name, PreferCost, PreferLatency)
+		}
+	}
+	return nil
+}
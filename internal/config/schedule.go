@@ -0,0 +1,173 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"regexp"
+	"strings"
+
+	"ExtraChat/internal/cron"
+)
+
+// ScheduledJob is a prompt or pipeline "extrachat serve" runs on a cron
+// schedule, delivering the reply to sinks
+type ScheduledJob struct {
+	Name     string            `yaml:"name,omitempty"`     // Shown in logs and deliveries; defaults to job N
+	Cron     string            `yaml:"cron"`               // Five-field crontab schedule or a shorthand such as @daily, in local time
+	Prompt   string            `yaml:"prompt,omitempty"`   // Prompt template, sent as a one-step pipeline
+	Template string            `yaml:"template,omitempty"` // Named prompt template of the schedule, instead of Prompt
+	Pipeline string            `yaml:"pipeline,omitempty"` // Pipeline file, instead of Prompt
+	Vars     map[string]string `yaml:"vars,omitempty"`     // Template variables, over the pipeline's defaults
+	Backend  string            `yaml:"backend,omitempty"`  // Backend or model alias of a prompt; empty for the configured backend
+	Persona  string            `yaml:"persona,omitempty"`  // System prompt of a prompt
+	Sinks    []string          `yaml:"sinks"`              // Where the reply goes, by name
+}
+
+// scheduleLine splits the one-line form of a job:
+// "<cron> prompt:<text>|template:<name>|pipeline:<file> -> <sink>[, <sink>...]"
+var scheduleLine = regexp.MustCompile(`^\s*(@\w+|\S+\s+\S+\s+\S+\s+\S+\s+\S+)\s+(prompt|template|pipeline):\s*(.+?)\s*(?:->|→)\s*(.+?)\s*$`)
+
+// UnmarshalYAML accepts a mapping or the one-line form, e.g.
+// "0 9 * * 1-5 template:standup-summary -> slack"
+func (j *ScheduledJob) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var line string
+	if err := unmarshal(&line); err == nil {
+		m := scheduleLine.FindStringSubmatch(line)
+		if m == nil {
+			return fmt.Errorf("invalid scheduled job %q: want \"<cron> prompt:<text> -> <sink>\", \"<cron> template:<name> -> <sink>\" or \"<cron> pipeline:<file> -> <sink>\"", line)
+		}
+		*j = ScheduledJob{Cron: m[1]}
+		switch m[2] {
+		case "prompt":
+			j.Prompt = m[3]
+		case "template":
+			j.Template = m[3]
+		default:
+			j.Pipeline = m[3]
+		}
+		for _, sink := range strings.Split(m[4], ",") {
+			j.Sinks = append(j.Sinks, strings.TrimSpace(sink))
+		}
+		return nil
+	}
+	type plain ScheduledJob
+	return unmarshal((*plain)(j))
+}
+
+// Sink is where the replies of scheduled jobs are delivered: appended to a
+// file, posted to a webhook or emailed. Exactly one is set.
+type Sink struct {
+	File    string     `yaml:"file,omitempty"`    // Appended to; relative to the config file
+	Webhook string     `yaml:"webhook,omitempty"` // Posted {"text": ..., "job": ..., "time": ...} as JSON, as Slack incoming webhooks take it; may reference environment variables as ${VAR}
+	Email   *EmailSink `yaml:"email,omitempty"`
+}
+
+// EmailSink sends each reply as a plain text email over SMTP with STARTTLS
+type EmailSink struct {
+	SMTP     string   `yaml:"smtp"`               // Server as host:port
+	From     string   `yaml:"from"`               // Sender address
+	To       []string `yaml:"to"`                 // Recipient addresses
+	Username string   `yaml:"username,omitempty"` // Sign-in with PLAIN auth; empty sends without
+	Password string   `yaml:"password,omitempty"` // May reference environment variables as ${VAR}
+	Subject  string   `yaml:"subject,omitempty"`  // Defaults to the job name and date
+}
+
+// validateSchedule checks the sinks and scheduled jobs of the config file,
+// naming the unnamed jobs, resolving files against baseDir and templates
+// to their prompts
+func validateSchedule(jobs []ScheduledJob, sinks map[string]Sink, templates map[string]string, personas map[string]Persona, aliases map[string]string, baseDir string) error {
+	for name, sink := range sinks {
+		if err := validateSink(sink); err != nil {
+			return fmt.Errorf("schedule: sink %s: %w", name, err)
+		}
+		sink.File = resolvePath(sink.File, baseDir)
+		sinks[name] = sink
+	}
+
+	c := Config{Aliases: aliases, Personas: personas}
+	seen := make(map[string]bool)
+	for i := range jobs {
+		job := &jobs[i]
+		if job.Pipeline != "" {
+			job.Pipeline = resolvePath(job.Pipeline, baseDir)
+		}
+		if job.Name == "" {
+			job.Name = fmt.Sprintf("job %d", i+1)
+		}
+		if seen[job.Name] {
+			return fmt.Errorf("schedule: %s is defined twice", job.Name)
+		}
+		seen[job.Name] = true
+
+		if _, err := cron.Parse(job.Cron); err != nil {
+			return fmt.Errorf("schedule: %s: %w", job.Name, err)
+		}
+		set := 0
+		for _, field := range []string{job.Prompt, job.Template, job.Pipeline} {
+			if field != "" {
+				set++
+			}
+		}
+		if set != 1 {
+			return fmt.Errorf("schedule: %s: set one of prompt, template and pipeline", job.Name)
+		}
+		if job.Template != "" {
+			prompt, ok := templates[job.Template]
+			if !ok {
+				return fmt.Errorf("schedule: %s: unknown template %q", job.Name, job.Template)
+			}
+			job.Prompt = prompt
+		}
+		switch {
+		case job.Pipeline != "" && (job.Backend != "" || job.Persona != ""):
+			return fmt.Errorf("schedule: %s: backend and persona apply to prompts; pipeline steps set their own", job.Name)
+		case len(job.Sinks) == 0:
+			return fmt.Errorf("schedule: %s has no sinks", job.Name)
+		}
+		if job.Backend != "" && !ValidBackend(job.Backend) {
+			if _, _, ok := c.ResolveAlias(job.Backend); !ok {
+				return fmt.Errorf("schedule: %s: unknown backend or alias %q", job.Name, job.Backend)
+			}
+		}
+		if _, ok := c.Persona(job.Persona); job.Persona != "" && !ok {
+			return fmt.Errorf("schedule: %s: unknown persona %q", job.Name, job.Persona)
+		}
+		for _, sink := range job.Sinks {
+			if _, ok := sinks[sink]; !ok {
+				return fmt.Errorf("schedule: %s: unknown sink %q", job.Name, sink)
+			}
+		}
+	}
+	return nil
+}
+
+// validateSink checks that a sink has exactly one destination
+func validateSink(sink Sink) error {
+	set := 0
+	for _, ok := range []bool{sink.File != "", sink.Webhook != "", sink.Email != nil} {
+		if ok {
+			set++
+		}
+	}
+	if set != 1 {
+		return errors.New("set exactly one of file, webhook and email")
+	}
+	if sink.Webhook != "" && !strings.HasPrefix(sink.Webhook, "https://") && !strings.HasPrefix(sink.Webhook, "http://") && !strings.HasPrefix(sink.Webhook, "$") {
+		return fmt.Errorf("webhook %q is not an http(s) URL", sink.Webhook)
+	}
+	if email := sink.Email; email != nil {
+		if !strings.Contains(email.SMTP, ":") {
+			return fmt.Errorf("email: smtp %q is not host:port", email.SMTP)
+		}
+		if len(email.To) == 0 {
+			return errors.New("email: no recipients")
+		}
+		for _, addr := range append([]string{email.From}, email.To...) {
+			if _, err := mail.ParseAddress(addr); err != nil {
+				return fmt.Errorf("email: invalid address %q", addr)
+			}
+		}
+	}
+	return nil
+}
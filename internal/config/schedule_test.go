@@ -0,0 +1,52 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestScheduleLineTemplate(t *testing.T) {
+	var jobs []ScheduledJob
+	if err := yaml.Unmarshal([]byte(`["0 9 * * * template:standup-summary → slack-webhook, log"]`), &jobs); err != nil {
+		t.Fatal(err)
+	}
+	if job := jobs[0]; job.Cron != "0 9 * * *" || job.Template != "standup-summary" || strings.Join(job.Sinks, ",") != "slack-webhook,log" {
+		t.Fatalf("parsed %+v", job)
+	}
+
+	sinks := map[string]Sink{"slack-webhook": {Webhook: "https://hooks.example.com/x"}, "log": {File: "log.md"}}
+	templates := map[string]string{"standup-summary": "Summarize yesterday for {{.date}}"}
+	if err := validateSchedule(jobs, sinks, templates, nil, nil, t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if jobs[0].Prompt != templates["standup-summary"] {
+		t.Errorf("template resolved to %q", jobs[0].Prompt)
+	}
+}
+
+func TestScheduleTemplateErrors(t *testing.T) {
+	sinks := map[string]Sink{"log": {File: "log.md"}}
+	templates := map[string]string{"digest": "Digest"}
+	tests := []struct {
+		job  ScheduledJob
+		want string
+	}{
+		{ScheduledJob{Cron: "@daily", Template: "missing", Sinks: []string{"log"}}, `unknown template "missing"`},
+		{ScheduledJob{Cron: "@daily", Template: "digest", Prompt: "Digest", Sinks: []string{"log"}}, "set one of prompt, template and pipeline"},
+		{ScheduledJob{Cron: "@daily", Sinks: []string{"log"}}, "set one of prompt, template and pipeline"},
+	}
+	for _, tt := range tests {
+		err := validateSchedule([]ScheduledJob{tt.job}, sinks, templates, nil, nil, t.TempDir())
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("validateSchedule(%+v) = %v, want %q", tt.job, err, tt.want)
+		}
+	}
+
+	var jobs []ScheduledJob
+	err := yaml.Unmarshal([]byte(`["@daily recipe:standup -> log"]`), &jobs)
+	if err == nil || !strings.Contains(err.Error(), "template:<name>") {
+		t.Errorf("invalid line = %v, want the accepted forms", err)
+	}
+}
@@ -0,0 +1,412 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"ExtraChat/internal/mcp"
+)
+
+// Setting is one configuration value addressable by its config file key
+// (e.g. "models.openai"), for /config show and /config set
+type Setting struct {
+	Key     string
+	Restart bool // Only takes effect after a restart
+
+	get  func(c *Config) interface{}
+	set  func(c *Config, value string) error
+	keep func(dst *Config, src Config) // Copies the value from src to dst
+}
+
+// Value returns the setting's current value as it is written to the
+// config file: a string, bool, int, float64 or []string, or nil for an
+// unset optional value
+func (s Setting) Value(c Config) interface{} {
+	return s.get(&c)
+}
+
+// Format returns the setting's current value for display
+func (s Setting) Format(c Config) string {
+	switch v := s.get(&c).(type) {
+	case []string:
+		return strings.Join(v, ",")
+	case string:
+		if v == "" {
+			return `""`
+		}
+		return v
+	case nil:
+		return unsetValue
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// Set parses value and stores it in c
+func (s Setting) Set(c *Config, value string) error {
+	if err := s.set(c, strings.TrimSpace(value)); err != nil {
+		return fmt.Errorf("invalid value for %s: %w", s.Key, err)
+	}
+	return nil
+}
+
+// settings lists every setting that can be shown and changed at runtime
+var settings = []Setting{
+	stringSetting("backend", false, func(c *Config) *string { return &c.Backend }, validBackend),
+	boolSetting("debug", false, func(c *Config) *bool { return &c.Debug }),
+	boolSetting("plain", true, func(c *Config) *bool { return &c.Plain }),
+	stringSetting("output", true, func(c *Config) *string { return &c.Output }, validOutput),
+	durationSetting("notify.after", false, func(c *Config) *time.Duration { return &c.NotifyAfter }),
+	stringSetting("models.ollama", false, func(c *Config) *string { return &c.OllamaModel }, nil),
+	stringSetting("models.anthropic", false, func(c *Config) *string { return &c.AnthropicModel }, nil),
+	stringSetting("models.grok", false, func(c *Config) *string { return &c.GrokModel }, nil),
+	stringSetting("models.openai", false, func(c *Config) *string { return &c.OpenAIModel }, nil),
+	stringSetting("models.mock", false, func(c *Config) *string { return &c.MockModel }, nil),
+	listSetting("stop_sequences", false, func(c *Config) *[]string { return &c.StopSequences }, ValidStopSequences),
+	intSetting("ollama.num_ctx", false, func(c *Config) *int { return &c.OllamaOptions.NumCtx }),
+	floatSetting("ollama.temperature", false, func(c *Config) **float64 { return &c.OllamaOptions.Temperature }, validTemperature),
+	intSetting("ollama.top_k", false, func(c *Config) *int { return &c.OllamaOptions.TopK }),
+	optionalIntSetting("ollama.seed", false, func(c *Config) **int { return &c.OllamaOptions.Seed }),
+	listSetting("ollama.stop", false, func(c *Config) *[]string { return &c.OllamaOptions.Stop }, nil),
+	stringSetting("ollama.keep_alive", false, func(c *Config) *string { return &c.OllamaOptions.KeepAlive }, validKeepAlive),
+	stringSetting("urls.ollama", false, func(c *Config) *string { return &c.OllamaURL }, nil),
+	stringSetting("urls.anthropic", false, func(c *Config) *string { return &c.AnthropicURL }, nil),
+	stringSetting("urls.grok", false, func(c *Config) *string { return &c.GrokURL }, nil),
+	stringSetting("urls.openai", false, func(c *Config) *string { return &c.OpenAIURL }, nil),
+	stringSetting("urls.cohere", false, func(c *Config) *string { return &c.CohereURL }, nil),
+	stringSetting("urls.voyage", false, func(c *Config) *string { return &c.VoyageURL }, nil),
+	stringSetting("mock.fixtures", false, func(c *Config) *string { return &c.MockFixtures }, nil),
+	durationSetting("mock.latency", false, func(c *Config) *time.Duration { return &c.MockLatency }),
+	percentSetting("mock.error_percent", false, func(c *Config) *int { return &c.MockErrorPercent }),
+	durationSetting("http.timeout", true, func(c *Config) *time.Duration { return &c.HTTPTimeout }),
+	durationSetting("http.dial_timeout", true, func(c *Config) *time.Duration { return &c.HTTPDialTimeout }),
+	durationSetting("http.tls_timeout", true, func(c *Config) *time.Duration { return &c.HTTPTLSTimeout }),
+	durationSetting("http.header_timeout", true, func(c *Config) *time.Duration { return &c.HTTPHeaderTimeout }),
+	durationSetting("http.idle_timeout", true, func(c *Config) *time.Duration { return &c.HTTPIdleTimeout }),
+	intSetting("http.max_idle_conns", true, func(c *Config) *int { return &c.HTTPMaxIdleConns }),
+	stringSetting("summarizer.backend", false, func(c *Config) *string { return &c.SummarizerBackend }, validOptionalBackend),
+	stringSetting("summarizer.model", false, func(c *Config) *string { return &c.SummarizerModel }, nil),
+	boolSetting("summarizer.auto_title", false, func(c *Config) *bool { return &c.AutoTitle }),
+	boolSetting("router.enabled", false, func(c *Config) *bool { return &c.RouterEnabled }),
+	stringSetting("bestof.judge", false, func(c *Config) *string { return &c.BestOfJudge }, nil),
+	listSetting("guardrails.input.keywords", false, func(c *Config) *[]string { return &c.InputFilter.Keywords }, nil),
+	intSetting("guardrails.input.max_length", false, func(c *Config) *int { return &c.InputFilter.MaxLength }),
+	boolSetting("guardrails.input.moderation", false, func(c *Config) *bool { return &c.InputFilter.Moderation }),
+	listSetting("guardrails.output.keywords", false, func(c *Config) *[]string { return &c.OutputFilter.Keywords }, nil),
+	intSetting("guardrails.output.max_length", false, func(c *Config) *int { return &c.OutputFilter.MaxLength }),
+	boolSetting("guardrails.output.moderation", false, func(c *Config) *bool { return &c.OutputFilter.Moderation }),
+	stringSetting("guardrails.moderation_model", false, func(c *Config) *string { return &c.ModerationModel }, nil),
+	boolSetting("guardrails.secret_scan", false, func(c *Config) *bool { return &c.SecretScan }),
+	boolSetting("rag.enabled", false, func(c *Config) *bool { return &c.RAGEnabled }),
+	stringSetting("rag.backend", false, func(c *Config) *string { return &c.EmbedBackend }, validEmbedBackend),
+	stringSetting("rag.model", false, func(c *Config) *string { return &c.EmbedModel }, nil),
+	intSetting("rag.top_k", false, func(c *Config) *int { return &c.RAGTopK }),
+	intSetting("rag.chunk_size", false, func(c *Config) *int { return &c.ChunkSize }),
+	intSetting("rag.chunk_overlap", false, func(c *Config) *int { return &c.ChunkOverlap }),
+	stringSetting("rag.rerank", false, func(c *Config) *string { return &c.Rerank }, validReranker),
+	stringSetting("rag.rerank_model", false, func(c *Config) *string { return &c.RerankModel }, nil),
+	intSetting("rag.rerank_candidates", false, func(c *Config) *int { return &c.RerankCandidates }),
+	listSetting("fetch.allowed_domains", false, func(c *Config) *[]string { return &c.FetchAllowedDomains }, nil),
+	intSetting("fetch.max_size_kb", false, func(c *Config) *int { return &c.FetchMaxSize }),
+	boolSetting("fetch.allow_private", false, func(c *Config) *bool { return &c.FetchAllowPrivate }),
+	stringSetting("backup.dir", true, func(c *Config) *string { return &c.BackupDir }, nil),
+	intSetting("backup.retention", true, func(c *Config) *int { return &c.BackupRetention }),
+	stringSetting("backup.time", true, func(c *Config) *string { return &c.BackupTime }, nil),
+	stringSetting("audit.path", true, func(c *Config) *string { return &c.AuditLog }, nil),
+	intSetting("audit.max_size_mb", true, func(c *Config) *int { return &c.AuditMaxSize }),
+	intSetting("audit.max_backups", true, func(c *Config) *int { return &c.AuditMaxBackups }),
+	intSetting("audit.max_age_days", true, func(c *Config) *int { return &c.AuditMaxAge }),
+	intSetting("context.max_tokens", true, func(c *Config) *int { return &c.ContextMaxTokens }),
+	stringSetting("database.path", true, func(c *Config) *string { return &c.DBPath }, nil),
+	intSetting("database.page_size", false, func(c *Config) *int { return &c.PageSize }),
+	boolSetting("cache.enabled", false, func(c *Config) *bool { return &c.CacheEnabled }),
+	durationSetting("cache.ttl", false, func(c *Config) *time.Duration { return &c.CacheTTL }),
+	boolSetting("telemetry.enabled", true, func(c *Config) *bool { return &c.TelemetryEnabled }),
+	stringSetting("telemetry.log_dir", true, func(c *Config) *string { return &c.LogDir }, nil),
+	stringSetting("telemetry.pprof_addr", true, func(c *Config) *string { return &c.PprofAddr }, nil),
+	stringSetting("telemetry.log_level", false, func(c *Config) *string { return &c.LogLevel }, validLogLevel),
+	boolSetting("mcp.enabled", true, func(c *Config) *bool { return &c.MCPEnabled }),
+	stringSetting("mcp.config", false, func(c *Config) *string { return &c.MCPConfigFile }, nil),
+	stringSetting("mcp.log_level", false, func(c *Config) *string { return &c.MCPLogLevel }, validOptionalLogLevel),
+	boolSetting("mcp.builtin_tools", true, func(c *Config) *bool { return &c.BuiltinTools }),
+	stringSetting("mcp.sandbox_root", true, func(c *Config) *string { return &c.SandboxRoot }, nil),
+	listSetting("mcp.auto_approve", false, func(c *Config) *[]string { return &c.ToolAutoApprove }, nil),
+	intSetting("mcp.max_tool_iterations", false, func(c *Config) *int { return &c.MaxToolIterations }),
+	durationSetting("mcp.tool_timeout", false, func(c *Config) *time.Duration { return &c.ToolTimeout }),
+	intSetting("mcp.startup_concurrency", false, func(c *Config) *int { return &c.MCPStartupConcurrency }),
+	durationSetting("mcp.startup_timeout", false, func(c *Config) *time.Duration { return &c.MCPStartupTimeout }),
+}
+
+// KeepRestartSettings copies the settings that only take effect after a
+// restart, and the startup-only fields, from current into next. A reloaded
+// configuration can then replace current without pretending to apply them.
+func KeepRestartSettings(next *Config, current Config) {
+	for _, s := range settings {
+		if s.Restart {
+			s.keep(next, current)
+		}
+	}
+	next.SessionID = current.SessionID
+	next.EnvFileVars = current.EnvFileVars
+	next.SkipStartupChecks = current.SkipStartupChecks
+	next.RecordDir = current.RecordDir
+	next.ReplayDir = current.ReplayDir
+	next.Prompt = current.Prompt
+	next.ContextFiles = current.ContextFiles
+}
+
+// Settings returns all runtime settings sorted by key
+func Settings() []Setting {
+	sorted := append([]Setting(nil), settings...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Key < sorted[j].Key
+	})
+	return sorted
+}
+
+// LookupSetting finds a setting by its config file key
+func LookupSetting(key string) (Setting, bool) {
+	for _, s := range settings {
+		if s.Key == key {
+			return s, true
+		}
+	}
+	return Setting{}, false
+}
+
+func stringSetting(key string, restart bool, field func(*Config) *string, validate func(string) error) Setting {
+	return Setting{
+		Key:     key,
+		Restart: restart,
+		keep:    func(dst *Config, src Config) { *field(dst) = *field(&src) },
+		get:     func(c *Config) interface{} { return *field(c) },
+		set: func(c *Config, value string) error {
+			if validate != nil {
+				if err := validate(value); err != nil {
+					return err
+				}
+			}
+			*field(c) = value
+			return nil
+		},
+	}
+}
+
+func boolSetting(key string, restart bool, field func(*Config) *bool) Setting {
+	return Setting{
+		Key:     key,
+		Restart: restart,
+		keep:    func(dst *Config, src Config) { *field(dst) = *field(&src) },
+		get:     func(c *Config) interface{} { return *field(c) },
+		set: func(c *Config, value string) error {
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("expected true or false")
+			}
+			*field(c) = b
+			return nil
+		},
+	}
+}
+
+func intSetting(key string, restart bool, field func(*Config) *int) Setting {
+	return Setting{
+		Key:     key,
+		Restart: restart,
+		keep:    func(dst *Config, src Config) { *field(dst) = *field(&src) },
+		get:     func(c *Config) interface{} { return *field(c) },
+		set: func(c *Config, value string) error {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return fmt.Errorf("expected a non-negative number")
+			}
+			*field(c) = n
+			return nil
+		},
+	}
+}
+
+// percentSetting values are ints from 0 to 100
+func percentSetting(key string, restart bool, field func(*Config) *int) Setting {
+	s := intSetting(key, restart, field)
+	s.set = func(c *Config, value string) error {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("expected a percentage from 0 to 100")
+		}
+		if err := validErrorPercent(n); err != nil {
+			return err
+		}
+		*field(c) = n
+		return nil
+	}
+	return s
+}
+
+// durationSetting values are written to the config file as strings ("90s")
+func durationSetting(key string, restart bool, field func(*Config) *time.Duration) Setting {
+	return Setting{
+		Key:     key,
+		Restart: restart,
+		keep:    func(dst *Config, src Config) { *field(dst) = *field(&src) },
+		get:     func(c *Config) interface{} { return field(c).String() },
+		set: func(c *Config, value string) error {
+			d, err := time.ParseDuration(value)
+			if err != nil || d < 0 {
+				return fmt.Errorf("expected a duration such as 30s or 5m")
+			}
+			*field(c) = d
+			return nil
+		},
+	}
+}
+
+// unsetValue is how optional settings without a value are shown, and the
+// value that unsets them
+const unsetValue = "default"
+
+// floatSetting values are optional numbers, written to the config file as
+// null when unset
+func floatSetting(key string, restart bool, field func(*Config) **float64, validate func(float64) error) Setting {
+	return Setting{
+		Key:     key,
+		Restart: restart,
+		keep:    func(dst *Config, src Config) { *field(dst) = *field(&src) },
+		get: func(c *Config) interface{} {
+			if *field(c) == nil {
+				return nil
+			}
+			return **field(c)
+		},
+		set: func(c *Config, value string) error {
+			if value == unsetValue {
+				*field(c) = nil
+				return nil
+			}
+			f, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return fmt.Errorf("expected a number, or %s", unsetValue)
+			}
+			if err := validate(f); err != nil {
+				return err
+			}
+			*field(c) = &f
+			return nil
+		},
+	}
+}
+
+// optionalIntSetting values are like floatSetting's, for whole numbers
+// where zero is a value of its own
+func optionalIntSetting(key string, restart bool, field func(*Config) **int) Setting {
+	return Setting{
+		Key:     key,
+		Restart: restart,
+		keep:    func(dst *Config, src Config) { *field(dst) = *field(&src) },
+		get: func(c *Config) interface{} {
+			if *field(c) == nil {
+				return nil
+			}
+			return **field(c)
+		},
+		set: func(c *Config, value string) error {
+			if value == unsetValue {
+				*field(c) = nil
+				return nil
+			}
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("expected a whole number, or %s", unsetValue)
+			}
+			*field(c) = &n
+			return nil
+		},
+	}
+}
+
+// listSetting values are comma-separated
+func listSetting(key string, restart bool, field func(*Config) *[]string, validate func([]string) error) Setting {
+	return Setting{
+		Key:     key,
+		Restart: restart,
+		keep:    func(dst *Config, src Config) { *field(dst) = *field(&src) },
+		get: func(c *Config) interface{} {
+			if *field(c) == nil {
+				return []string{}
+			}
+			return *field(c)
+		},
+		set: func(c *Config, value string) error {
+			var items []string
+			for _, item := range strings.Split(value, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+			}
+			if validate != nil {
+				if err := validate(items); err != nil {
+					return err
+				}
+			}
+			*field(c) = items
+			return nil
+		},
+	}
+}
+
+func validBackend(value string) error {
+	if !ValidBackend(value) {
+		return fmt.Errorf("unknown backend %q", value)
+	}
+	return nil
+}
+
+func validEmbedBackend(value string) error {
+	if !ValidEmbedBackend(value) {
+		return fmt.Errorf("backend %q has no embeddings API (expected ollama or openai)", value)
+	}
+	return nil
+}
+
+func validReranker(value string) error {
+	if !ValidReranker(value) {
+		return fmt.Errorf("unknown reranker %q (expected %s)", value, strings.Join(Rerankers, ", "))
+	}
+	return nil
+}
+
+func validErrorPercent(value int) error {
+	if value < 0 || value > 100 {
+		return fmt.Errorf("error percentage must be from 0 to 100, got %d", value)
+	}
+	return nil
+}
+
+func validOutput(value string) error {
+	if value != OutputText && value != OutputJSON {
+		return fmt.Errorf("unknown output format %q (expected text or json)", value)
+	}
+	return nil
+}
+
+func validOptionalBackend(value string) error {
+	if value == "" {
+		return nil
+	}
+	return validBackend(value)
+}
+
+func validLogLevel(value string) error {
+	_, err := ParseLogLevel(value)
+	return err
+}
+
+func validOptionalLogLevel(value string) error {
+	if value != "" && !mcp.ValidLogLevel(value) {
+		return fmt.Errorf("unknown log level %q", value)
+	}
+	return nil
+}
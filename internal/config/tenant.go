@@ -0,0 +1,83 @@
+package config
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+)
+
+// Tenant is a client of "extrachat serve" with its own API token. A tenant
+// only sees its own sessions and is limited to its scopes.
+type Tenant struct {
+	Token    string   `yaml:"token"`              // Bearer token; may reference environment variables as ${VAR}
+	Backends []string `yaml:"backends,omitempty"` // Backends it may use, directly or through an alias; empty allows all
+	Tools    []string `yaml:"tools,omitempty"`    // MCP tools it may call, as names or patterns like "github_*"; empty allows all
+	Quota    Quota    `yaml:"quota,omitempty"`
+}
+
+// Quota limits a tenant's API requests per minute and its LLM usage over a
+// rolling 24 hours; zero fields are unlimited
+type Quota struct {
+	RequestsPerMinute int64 `yaml:"requests_per_minute,omitempty"` // API requests and WebSocket messages
+	RequestsPerDay    int64 `yaml:"requests_per_day,omitempty"`    // LLM requests, tool-use follow-ups included
+	TokensPerDay      int64 `yaml:"tokens_per_day,omitempty"`      // Input plus output tokens
+}
+
+// AllowsBackend reports whether the tenant may use a backend
+func (t Tenant) AllowsBackend(backend string) bool {
+	return len(t.Backends) == 0 || slices.Contains(t.Backends, backend)
+}
+
+// AllowsTool reports whether the tenant may call a tool
+func (t Tenant) AllowsTool(name string) bool {
+	if len(t.Tools) == 0 {
+		return true
+	}
+	for _, pattern := range t.Tools {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// TenantByToken returns the tenant whose (expanded) token is token
+func (c Config) TenantByToken(token string) (string, Tenant, bool) {
+	for name, tenant := range c.Tenants {
+		expanded := os.ExpandEnv(tenant.Token)
+		if expanded != "" && subtle.ConstantTimeCompare([]byte(token), []byte(expanded)) == 1 {
+			return name, tenant, true
+		}
+	}
+	return "", Tenant{}, false
+}
+
+// validateTenants checks the tenants defined in the config file
+func validateTenants(tenants map[string]Tenant) error {
+	tokens := make(map[string]string, len(tenants))
+	for name, tenant := range tenants {
+		if tenant.Token == "" {
+			return fmt.Errorf("tenant %s: token is empty", name)
+		}
+		if other, dup := tokens[tenant.Token]; dup {
+			return fmt.Errorf("tenants %s and %s have the same token", other, name)
+		}
+		tokens[tenant.Token] = name
+		for _, backend := range tenant.Backends {
+			if !ValidBackend(backend) {
+				return fmt.Errorf("tenant %s: unknown backend %q", name, backend)
+			}
+		}
+		for _, pattern := range tenant.Tools {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("tenant %s: invalid tool pattern %q", name, pattern)
+			}
+		}
+		if tenant.Quota.RequestsPerMinute < 0 || tenant.Quota.RequestsPerDay < 0 || tenant.Quota.TokensPerDay < 0 {
+			return fmt.Errorf("tenant %s: negative quota", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+// Package cron parses the five-field schedules of crontab(5) and tells when
+// they are due
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// shorthands are the @ schedules crontab accepts in place of the fields
+var shorthands = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Names of months and weekdays, usable in their fields
+var (
+	monthNames = []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}
+	dayNames   = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+)
+
+// field describes one of the five fields
+type field struct {
+	name     string
+	min, max int
+	names    []string // Names of the values from min, if any
+}
+
+var fields = []field{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: monthNames},
+	{name: "day of week", min: 0, max: 7, names: dayNames}, // 7 is Sunday too
+}
+
+// Schedule is a parsed schedule; a minute is due when it matches every field
+type Schedule struct {
+	minute, hour, dom, month, dow uint64 // Bit n set if value n matches
+
+	// As in crontab, a minute matches either day field when both are
+	// restricted, and both when either is *
+	domStar, dowStar bool
+}
+
+// Parse parses "minute hour day-of-month month day-of-week", with *, lists,
+// ranges, steps and month and day names, or a shorthand such as @daily
+func Parse(expr string) (*Schedule, error) {
+	spec := strings.TrimSpace(expr)
+	if full, ok := shorthands[strings.ToLower(spec)]; ok {
+		spec = full
+	}
+	parts := strings.Fields(spec)
+	if len(parts) != len(fields) {
+		return nil, fmt.Errorf("invalid schedule %q: want 5 fields (minute hour day month weekday) or a shorthand such as @daily", expr)
+	}
+
+	var sets [5]uint64
+	for i, part := range parts {
+		set, err := parseField(part, fields[i])
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %s: %w", expr, fields[i].name, err)
+		}
+		sets[i] = set
+	}
+	s := &Schedule{
+		minute:  sets[0],
+		hour:    sets[1],
+		dom:     sets[2],
+		month:   sets[3],
+		dow:     sets[4],
+		domStar: strings.HasPrefix(parts[2], "*"),
+		dowStar: strings.HasPrefix(parts[4], "*"),
+	}
+	// Sunday is 0 or 7
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	return s, nil
+}
+
+// parseField parses a comma-separated list of *, values and ranges, each
+// with an optional /step
+func parseField(text string, f field) (uint64, error) {
+	var set uint64
+	for _, item := range strings.Split(text, ",") {
+		rangeText, stepText, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepText); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step %q", stepText)
+			}
+		}
+
+		lo, hi := f.min, f.max
+		switch {
+		case rangeText == "*":
+		case strings.Contains(rangeText, "-"):
+			loText, hiText, _ := strings.Cut(rangeText, "-")
+			var err error
+			if lo, err = parseValue(loText, f); err != nil {
+				return 0, err
+			}
+			if hi, err = parseValue(hiText, f); err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("range %q runs backwards", rangeText)
+			}
+		default:
+			value, err := parseValue(rangeText, f)
+			if err != nil {
+				return 0, err
+			}
+			// "5/15" is every 15 from 5
+			lo, hi = value, value
+			if hasStep {
+				hi = f.max
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			set |= 1 << v
+		}
+	}
+	return set, nil
+}
+
+// parseValue parses a number or a name within the field's bounds
+func parseValue(text string, f field) (int, error) {
+	for i, name := range f.names {
+		if strings.EqualFold(text, name) {
+			return f.min + i, nil
+		}
+	}
+	value, err := strconv.Atoi(text)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", text)
+	}
+	if value < f.min || value > f.max {
+		return 0, fmt.Errorf("%d is out of range %d-%d", value, f.min, f.max)
+	}
+	return value, nil
+}
+
+// Matches reports whether the minute of t is due
+func (s *Schedule) Matches(t time.Time) bool {
+	return s.minute&(1<<t.Minute()) != 0 && s.hour&(1<<t.Hour()) != 0 && s.month&(1<<int(t.Month())) != 0 && s.dayMatches(t)
+}
+
+// dayMatches reports whether the day of t is due, whatever its time
+func (s *Schedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<t.Day()) != 0
+	dow := s.dow&(1<<int(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// Next returns the first due minute after t, or the zero time if none comes
+// within five years (such as on February 30th)
+func (s *Schedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	next := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute()+1, 0, 0, loc)
+	end := next.AddDate(5, 0, 0)
+	for next.Before(end) {
+		switch {
+		case s.month&(1<<int(next.Month())) == 0:
+			next = time.Date(next.Year(), next.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !s.dayMatches(next):
+			next = time.Date(next.Year(), next.Month(), next.Day()+1, 0, 0, 0, 0, loc)
+		case s.hour&(1<<next.Hour()) == 0:
+			next = time.Date(next.Year(), next.Month(), next.Day(), next.Hour()+1, 0, 0, 0, loc)
+		case s.minute&(1<<next.Minute()) == 0:
+			next = next.Add(time.Minute)
+		default:
+			return next
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,81 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRejects(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"10-5 * * * *",
+		"* * * foo *",
+		"@fortnightly",
+	} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Parse(%q) succeeded, want an error", expr)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	// A Wednesday
+	from := time.Date(2026, time.January, 14, 8, 30, 15, 0, time.UTC)
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2026, time.January, 14, 8, 31, 0, 0, time.UTC)},
+		{"0 9 * * *", time.Date(2026, time.January, 14, 9, 0, 0, 0, time.UTC)},
+		{"0 8 * * *", time.Date(2026, time.January, 15, 8, 0, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2026, time.January, 14, 8, 45, 0, 0, time.UTC)},
+		{"5/20 8 * * *", time.Date(2026, time.January, 14, 8, 45, 0, 0, time.UTC)},
+		{"0 9 * * mon-fri", time.Date(2026, time.January, 14, 9, 0, 0, 0, time.UTC)},
+		{"0 9 * * sat,sun", time.Date(2026, time.January, 17, 9, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2026, time.January, 18, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2026, time.February, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 12 1 feb *", time.Date(2026, time.February, 1, 12, 0, 0, 0, time.UTC)},
+		{"@yearly", time.Date(2027, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2026, time.January, 14, 9, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		// Both day fields restricted: either matches
+		{"0 0 20 * fri", time.Date(2026, time.January, 16, 0, 0, 0, 0, time.UTC)},
+		// Never due
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, tt := range tests {
+		s, err := Parse(tt.expr)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.expr, err)
+			continue
+		}
+		if got := s.Next(from); !got.Equal(tt.want) {
+			t.Errorf("Next(%q) = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestMatchesAgreesWithNext(t *testing.T) {
+	s, err := Parse("30 9-17/2 * * 1-5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.Date(2026, time.March, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 20; i++ {
+		next := s.Next(at)
+		if !s.Matches(next) {
+			t.Fatalf("Next returned %v, which Matches rejects", next)
+		}
+		if next.Minute() != 30 || next.Hour()%2 != 1 || next.Weekday() == time.Saturday || next.Weekday() == time.Sunday {
+			t.Fatalf("Next returned %v, outside the schedule", next)
+		}
+		at = next
+	}
+}
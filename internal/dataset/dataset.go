@@ -0,0 +1,237 @@
+// Package dataset writes conversations as fine-tuning datasets: ShareGPT
+// records or the chat format of OpenAI fine-tuning, one JSON object per line
+package dataset
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Dataset formats
+const (
+	FormatShareGPT = "sharegpt"
+	FormatOpenAIFT = "openai-ft"
+)
+
+// Formats lists the dataset formats
+var Formats = []string{FormatShareGPT, FormatOpenAIFT}
+
+// Roles of the turns of a conversation, before mapping
+const (
+	RoleSystem     = "system"
+	RoleUser       = "user"
+	RoleAssistant  = "assistant"
+	RoleToolCall   = "tool_call"
+	RoleToolResult = "tool_result"
+)
+
+// SourceRoles lists the roles a role mapping can rename
+var SourceRoles = []string{RoleSystem, RoleUser, RoleAssistant, RoleToolCall, RoleToolResult}
+
+// Turn is one message of a conversation. Tool calls carry the tool and its
+// arguments; a tool result carries the call it answers in CallID.
+type Turn struct {
+	Role      string
+	Content   string
+	CallID    string                 // Pairs a tool call with its result
+	Tool      string                 // Tool calls only
+	Arguments map[string]interface{} // Tool calls only
+}
+
+// Conversation is one dataset record
+type Conversation struct {
+	ID    string
+	Turns []Turn
+}
+
+// ValidFormat reports whether format is a dataset format
+func ValidFormat(format string) bool {
+	for _, f := range Formats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultRoles returns the role names format uses for each source role
+func DefaultRoles(format string) map[string]string {
+	if format == FormatShareGPT {
+		return map[string]string{
+			RoleSystem:     "system",
+			RoleUser:       "human",
+			RoleAssistant:  "gpt",
+			RoleToolCall:   "function_call",
+			RoleToolResult: "observation",
+		}
+	}
+	return map[string]string{
+		RoleSystem:     "system",
+		RoleUser:       "user",
+		RoleAssistant:  "assistant",
+		RoleToolCall:   "assistant",
+		RoleToolResult: "tool",
+	}
+}
+
+// ParseRoles parses a role mapping such as "user=human,assistant=gpt" into
+// overrides of the default role names
+func ParseRoles(spec string) (map[string]string, error) {
+	roles := make(map[string]string)
+	for _, pair := range strings.Split(spec, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		from, to, ok := strings.Cut(pair, "=")
+		from, to = strings.TrimSpace(from), strings.TrimSpace(to)
+		if !ok || to == "" {
+			return nil, fmt.Errorf("invalid role mapping %q: want role=name", pair)
+		}
+		if !validSourceRole(from) {
+			return nil, fmt.Errorf("invalid role mapping %q: role must be one of %s", pair, strings.Join(SourceRoles, ", "))
+		}
+		roles[from] = to
+	}
+	return roles, nil
+}
+
+func validSourceRole(role string) bool {
+	for _, r := range SourceRoles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Writer writes conversations in a dataset format
+type Writer struct {
+	enc    *json.Encoder
+	format string
+	roles  map[string]string
+}
+
+// NewWriter returns a Writer of format to w. roles overrides the default
+// role names of the format; it may be nil.
+func NewWriter(w io.Writer, format string, roles map[string]string) (*Writer, error) {
+	if !ValidFormat(format) {
+		return nil, fmt.Errorf("unknown dataset format %q (want %s)", format, strings.Join(Formats, " or "))
+	}
+	mapped := DefaultRoles(format)
+	for from, to := range roles {
+		mapped[from] = to
+	}
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return &Writer{enc: enc, format: format, roles: mapped}, nil
+}
+
+// Write writes a conversation as one line
+func (w *Writer) Write(c Conversation) error {
+	var record interface{}
+	if w.format == FormatShareGPT {
+		record = w.shareGPT(c)
+	} else {
+		record = w.openAI(c)
+	}
+	if err := w.enc.Encode(record); err != nil {
+		return fmt.Errorf("failed to write conversation %s: %w", c.ID, err)
+	}
+	return nil
+}
+
+// shareGPTRecord is a conversation in the ShareGPT format
+type shareGPTRecord struct {
+	ID            string            `json:"id"`
+	Conversations []shareGPTMessage `json:"conversations"`
+}
+
+type shareGPTMessage struct {
+	From  string `json:"from"`
+	Value string `json:"value"`
+}
+
+// shareGPT converts a conversation; a tool call's value is the JSON of its
+// name and arguments, as function-calling ShareGPT datasets have it
+func (w *Writer) shareGPT(c Conversation) shareGPTRecord {
+	record := shareGPTRecord{ID: c.ID, Conversations: []shareGPTMessage{}}
+	for _, turn := range c.Turns {
+		value := turn.Content
+		if turn.Role == RoleToolCall {
+			value = callJSON(map[string]interface{}{"name": turn.Tool, "arguments": arguments(turn)})
+		}
+		record.Conversations = append(record.Conversations, shareGPTMessage{From: w.roles[turn.Role], Value: value})
+	}
+	return record
+}
+
+// openAIRecord is a conversation in the chat format of OpenAI fine-tuning
+type openAIRecord struct {
+	Messages []openAIMessage `json:"messages"`
+}
+
+type openAIMessage struct {
+	Role       string           `json:"role"`
+	Content    *string          `json:"content"`
+	ToolCalls  []openAIToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
+}
+
+type openAIToolCall struct {
+	ID       string             `json:"id"`
+	Type     string             `json:"type"`
+	Function openAIFunctionCall `json:"function"`
+}
+
+type openAIFunctionCall struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"` // JSON, as a string
+}
+
+// openAI converts a conversation. Tool calls in a row become one assistant
+// message with no content, the way the model made them.
+func (w *Writer) openAI(c Conversation) openAIRecord {
+	record := openAIRecord{Messages: []openAIMessage{}}
+	for _, turn := range c.Turns {
+		switch turn.Role {
+		case RoleToolCall:
+			call := openAIToolCall{
+				ID:       turn.CallID,
+				Type:     "function",
+				Function: openAIFunctionCall{Name: turn.Tool, Arguments: callJSON(arguments(turn))},
+			}
+			if n := len(record.Messages); n > 0 && record.Messages[n-1].ToolCalls != nil {
+				record.Messages[n-1].ToolCalls = append(record.Messages[n-1].ToolCalls, call)
+				continue
+			}
+			record.Messages = append(record.Messages, openAIMessage{Role: w.roles[RoleToolCall], ToolCalls: []openAIToolCall{call}})
+		case RoleToolResult:
+			content := turn.Content
+			record.Messages = append(record.Messages, openAIMessage{Role: w.roles[RoleToolResult], Content: &content, ToolCallID: turn.CallID})
+		default:
+			content := turn.Content
+			record.Messages = append(record.Messages, openAIMessage{Role: w.roles[turn.Role], Content: &content})
+		}
+	}
+	return record
+}
+
+// arguments returns a tool call's arguments, never nil so they encode as {}
+func arguments(turn Turn) map[string]interface{} {
+	if turn.Arguments == nil {
+		return map[string]interface{}{}
+	}
+	return turn.Arguments
+}
+
+// callJSON encodes tool call data, with keys sorted so equal calls encode
+// the same
+func callJSON(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "{}"
+	}
+	return string(data)
+}
@@ -0,0 +1,292 @@
+// Package eval reads evaluation suites: YAML files of prompts with
+// assertions on their replies, which are run on several backends and scored.
+package eval
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Kinds of assertions
+const (
+	KindContains   = "contains"
+	KindRegex      = "regex"
+	KindJSONSchema = "json_schema"
+	KindRubric     = "rubric"
+)
+
+// DefaultMinScore is the lowest rubric score, out of MaxScore, that passes
+const DefaultMinScore = 7
+
+// MaxScore is the top of the scale the judge scores rubrics on
+const MaxScore = 10
+
+// Suite is a parsed suite file
+type Suite struct {
+	Name     string   `yaml:"name"`
+	Backends []string `yaml:"backends"` // Aliases, backends or backend/model to run the cases on; --backends overrides
+	Judge    string   `yaml:"judge"`    // Alias, backend or backend/model scoring the rubrics; empty for the configured backend
+	System   string   `yaml:"system"`   // System prompt of the cases without their own
+	Cases    []*Case  `yaml:"cases"`
+}
+
+// Case is a prompt and what its reply must satisfy
+type Case struct {
+	Name   string       `yaml:"name"`
+	System string       `yaml:"system"`
+	Prompt string       `yaml:"prompt"`
+	Assert []*Assertion `yaml:"assert"`
+}
+
+// Assertion is a check of a reply. Exactly one of Contains, Regex,
+// JSONSchema and Rubric is set.
+type Assertion struct {
+	Contains   string      `yaml:"contains"`    // Text the reply contains
+	Regex      string      `yaml:"regex"`       // Pattern the reply matches
+	JSONSchema interface{} `yaml:"json_schema"` // Schema the JSON in the reply matches
+	Rubric     string      `yaml:"rubric"`      // What the judge scores the reply on
+	Not        bool        `yaml:"not"`         // Contains or Regex must not match
+	MinScore   int         `yaml:"min_score"`   // Lowest passing rubric score; 0 for DefaultMinScore
+	Weight     float64     `yaml:"weight"`      // Share of the case's score; 0 for 1
+
+	kind   string
+	regex  *regexp.Regexp
+	schema Schema
+}
+
+// Result is the outcome of an assertion on a reply
+type Result struct {
+	Assertion string  `json:"assertion"` // As Describe renders it
+	Kind      string  `json:"kind"`
+	Passed    bool    `json:"passed"`
+	Score     float64 `json:"score"` // From 0 to 1; rubrics score in between
+	Detail    string  `json:"detail,omitempty"`
+}
+
+// Judge scores reply, the answer to prompt, against rubric from 0 to
+// MaxScore, with the reason it gives
+type Judge func(ctx context.Context, rubric, prompt, reply string) (int, string, error)
+
+// fencedJSON finds a fenced code block in a reply
+var fencedJSON = regexp.MustCompile("(?s)```(?:json)?\\s*\\n(.*?)\\n?```")
+
+// Load reads and validates a suite file
+func Load(path string) (*Suite, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read suite: %w", err)
+	}
+	var s Suite
+	if err := yaml.UnmarshalStrict(data, &s); err != nil {
+		return nil, fmt.Errorf("failed to parse suite %s: %w", path, err)
+	}
+	if s.Name == "" {
+		s.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	if err := s.validate(); err != nil {
+		return nil, fmt.Errorf("invalid suite %s: %w", path, err)
+	}
+	return &s, nil
+}
+
+// validate names the cases and compiles their assertions
+func (s *Suite) validate() error {
+	if len(s.Cases) == 0 {
+		return errors.New("no cases")
+	}
+	seen := make(map[string]bool)
+	for i, c := range s.Cases {
+		if c.Name == "" {
+			c.Name = fmt.Sprintf("case%d", i+1)
+		}
+		switch {
+		case seen[c.Name]:
+			return fmt.Errorf("case %q is defined twice", c.Name)
+		case strings.TrimSpace(c.Prompt) == "":
+			return fmt.Errorf("case %q has no prompt", c.Name)
+		case len(c.Assert) == 0:
+			return fmt.Errorf("case %q has no assertions", c.Name)
+		}
+		seen[c.Name] = true
+		if c.System == "" {
+			c.System = s.System
+		}
+		for j, a := range c.Assert {
+			if err := a.compile(); err != nil {
+				return fmt.Errorf("case %q, assertion %d: %w", c.Name, j+1, err)
+			}
+		}
+	}
+	return nil
+}
+
+// compile works out the assertion's kind and compiles its pattern or schema
+func (a *Assertion) compile() error {
+	var kinds []string
+	if a.Contains != "" {
+		kinds = append(kinds, KindContains)
+	}
+	if a.Regex != "" {
+		kinds = append(kinds, KindRegex)
+	}
+	if a.JSONSchema != nil {
+		kinds = append(kinds, KindJSONSchema)
+	}
+	if strings.TrimSpace(a.Rubric) != "" {
+		kinds = append(kinds, KindRubric)
+	}
+	if len(kinds) != 1 {
+		return errors.New("set exactly one of contains, regex, json_schema and rubric")
+	}
+	a.kind = kinds[0]
+
+	switch {
+	case a.Not && a.kind != KindContains && a.kind != KindRegex:
+		return fmt.Errorf("not applies to contains and regex, not to %s", a.kind)
+	case a.MinScore != 0 && a.kind != KindRubric:
+		return errors.New("min_score applies to rubric only")
+	case a.MinScore < 0 || a.MinScore > MaxScore:
+		return fmt.Errorf("min_score must be from 1 to %d", MaxScore)
+	case a.Weight < 0:
+		return errors.New("weight must not be negative")
+	}
+	if a.MinScore == 0 {
+		a.MinScore = DefaultMinScore
+	}
+	if a.Weight == 0 {
+		a.Weight = 1
+	}
+
+	var err error
+	switch a.kind {
+	case KindRegex:
+		if a.regex, err = regexp.Compile(a.Regex); err != nil {
+			return fmt.Errorf("invalid regex: %w", err)
+		}
+	case KindJSONSchema:
+		if a.schema, err = newSchema(a.JSONSchema); err != nil {
+			return fmt.Errorf("invalid json_schema: %w", err)
+		}
+	}
+	return nil
+}
+
+// Kind returns which check the assertion is
+func (a *Assertion) Kind() string {
+	return a.kind
+}
+
+// Describe renders the assertion for reports
+func (a *Assertion) Describe() string {
+	not := ""
+	if a.Not {
+		not = "not "
+	}
+	switch a.kind {
+	case KindContains:
+		return fmt.Sprintf("%scontains %q", not, a.Contains)
+	case KindRegex:
+		return fmt.Sprintf("%smatches /%s/", not, a.Regex)
+	case KindJSONSchema:
+		return "JSON matches schema"
+	}
+	return fmt.Sprintf("rubric %q (min %d/%d)", a.Rubric, a.MinScore, MaxScore)
+}
+
+// Check runs the case's assertions on reply, asking judge to score rubrics
+func (c *Case) Check(ctx context.Context, reply string, judge Judge) []Result {
+	results := make([]Result, len(c.Assert))
+	for i, a := range c.Assert {
+		results[i] = a.check(ctx, c.Prompt, reply, judge)
+	}
+	return results
+}
+
+func (a *Assertion) check(ctx context.Context, prompt, reply string, judge Judge) Result {
+	r := Result{Assertion: a.Describe(), Kind: a.kind}
+	switch a.kind {
+	case KindContains, KindRegex:
+		matched := strings.Contains(reply, a.Contains)
+		if a.kind == KindRegex {
+			matched = a.regex.MatchString(reply)
+		}
+		r.Passed = matched != a.Not
+		if !r.Passed && a.Not {
+			r.Detail = "found in the reply"
+		} else if !r.Passed {
+			r.Detail = "not found in the reply"
+		}
+	case KindJSONSchema:
+		v, err := ExtractJSON(reply)
+		if err != nil {
+			r.Detail = err.Error()
+			break
+		}
+		r.Detail = a.schema.Validate(v)
+		r.Passed = r.Detail == ""
+	case KindRubric:
+		score, reason, err := judge(ctx, a.Rubric, prompt, reply)
+		if err != nil {
+			r.Detail = "judge failed: " + err.Error()
+			break
+		}
+		r.Score = float64(score) / MaxScore
+		r.Passed = score >= a.MinScore
+		r.Detail = fmt.Sprintf("scored %d/%d", score, MaxScore)
+		if reason != "" {
+			r.Detail += ": " + reason
+		}
+		return r
+	}
+	if r.Passed {
+		r.Score = 1
+	}
+	return r
+}
+
+// Score weighs the results of a case's assertions into a score from 0 to 1;
+// the case passes if every assertion passed
+func (c *Case) Score(results []Result) (float64, bool) {
+	var total, score float64
+	passed := true
+	for i, r := range results {
+		total += c.Assert[i].Weight
+		score += c.Assert[i].Weight * r.Score
+		passed = passed && r.Passed
+	}
+	if total == 0 {
+		return 0, passed
+	}
+	return score / total, passed
+}
+
+// ExtractJSON finds the JSON value in a reply: a fenced code block, the
+// whole reply, or the text from the first opening to the last closing brace
+// or bracket
+func ExtractJSON(reply string) (interface{}, error) {
+	candidates := []string{strings.TrimSpace(reply)}
+	if m := fencedJSON.FindStringSubmatch(reply); m != nil {
+		candidates = append([]string{m[1]}, candidates...)
+	}
+	for _, pair := range []string{"{}", "[]"} {
+		start, end := strings.IndexByte(reply, pair[0]), strings.LastIndexByte(reply, pair[1])
+		if start >= 0 && end > start {
+			candidates = append(candidates, reply[start:end+1])
+		}
+	}
+	for _, candidate := range candidates {
+		var v interface{}
+		if json.Unmarshal([]byte(candidate), &v) == nil {
+			return v, nil
+		}
+	}
+	return nil, errors.New("no JSON in the reply")
+}
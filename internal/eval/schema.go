@@ -0,0 +1,305 @@
+package eval
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Schema is the subset of JSON Schema a json_schema assertion supports:
+// type, enum, const, properties, required, additionalProperties (as a
+// boolean or a schema), items, minItems, maxItems, minLength, maxLength,
+// pattern, minimum and maximum. Annotations such as title and description
+// are ignored; other keywords are rejected, so a schema never passes by
+// being misread.
+type Schema map[string]interface{}
+
+// schemaKeywords are the keywords a Schema checks
+var schemaKeywords = map[string]bool{
+	"type": true, "enum": true, "const": true, "properties": true, "required": true, "additionalProperties": true,
+	"items": true, "minItems": true, "maxItems": true, "minLength": true, "maxLength": true, "pattern": true,
+	"minimum": true, "maximum": true,
+}
+
+// schemaAnnotations are the keywords a Schema ignores
+var schemaAnnotations = map[string]bool{
+	"$schema": true, "$id": true, "title": true, "description": true, "examples": true, "default": true,
+}
+
+// schemaTypes are the values of the type keyword
+var schemaTypes = map[string]bool{
+	"object": true, "array": true, "string": true, "number": true, "integer": true, "boolean": true, "null": true,
+}
+
+// newSchema turns a schema as YAML decodes it into one as JSON would, so
+// its numbers compare with those of a reply, and checks its keywords
+func newSchema(v interface{}) (Schema, error) {
+	data, err := json.Marshal(jsonValue(v))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode schema: %w", err)
+	}
+	var s Schema
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("schema must be an object: %w", err)
+	}
+	if err := s.check("$"); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// jsonValue converts the map[interface{}]interface{} of YAML to the
+// map[string]interface{} of JSON, recursively
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			m[fmt.Sprint(key)] = jsonValue(value)
+		}
+		return m
+	case []interface{}:
+		for i, value := range v {
+			v[i] = jsonValue(value)
+		}
+	}
+	return v
+}
+
+// check rejects unknown keywords and malformed values in the schema at path
+func (s Schema) check(path string) error {
+	for keyword, value := range s {
+		switch {
+		case schemaAnnotations[keyword]:
+			continue
+		case !schemaKeywords[keyword]:
+			return fmt.Errorf("%s: unsupported schema keyword %q", path, keyword)
+		}
+		switch keyword {
+		case "type":
+			for _, t := range typeNames(value) {
+				if !schemaTypes[t] {
+					return fmt.Errorf("%s: unknown type %q", path, t)
+				}
+			}
+		case "enum":
+			if _, ok := value.([]interface{}); !ok {
+				return fmt.Errorf("%s: enum must be a list", path)
+			}
+		case "properties":
+			properties, ok := value.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("%s: properties must be an object", path)
+			}
+			for name, property := range properties {
+				sub, ok := property.(map[string]interface{})
+				if !ok {
+					return fmt.Errorf("%s.%s: schema must be an object", path, name)
+				}
+				if err := Schema(sub).check(path + "." + name); err != nil {
+					return err
+				}
+			}
+		case "required":
+			names, ok := value.([]interface{})
+			if !ok {
+				return fmt.Errorf("%s: required must be a list of names", path)
+			}
+			for _, name := range names {
+				if _, ok := name.(string); !ok {
+					return fmt.Errorf("%s: required must be a list of names", path)
+				}
+			}
+		case "additionalProperties", "items":
+			if _, ok := value.(bool); ok && keyword == "additionalProperties" {
+				continue
+			}
+			sub, ok := value.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("%s: %s must be a schema", path, keyword)
+			}
+			if err := Schema(sub).check(path + "[]"); err != nil {
+				return err
+			}
+		case "minItems", "maxItems", "minLength", "maxLength", "minimum", "maximum":
+			if _, ok := value.(float64); !ok {
+				return fmt.Errorf("%s: %s must be a number", path, keyword)
+			}
+		case "pattern":
+			pattern, ok := value.(string)
+			if !ok {
+				return fmt.Errorf("%s: pattern must be a string", path)
+			}
+			if _, err := regexp.Compile(pattern); err != nil {
+				return fmt.Errorf("%s: invalid pattern: %w", path, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Validate returns what makes v, a value decoded from JSON, not match the
+// schema, or "" if it matches
+func (s Schema) Validate(v interface{}) string {
+	return s.validate(v, "$")
+}
+
+func (s Schema) validate(v interface{}, path string) string {
+	if types := typeNames(s["type"]); len(types) > 0 {
+		matched := false
+		for _, t := range types {
+			matched = matched || hasType(v, t)
+		}
+		if !matched {
+			return fmt.Sprintf("%s: expected %s, got %s", path, strings.Join(types, " or "), typeOf(v))
+		}
+	}
+	if enum, ok := s["enum"].([]interface{}); ok {
+		found := false
+		for _, allowed := range enum {
+			found = found || reflect.DeepEqual(v, allowed)
+		}
+		if !found {
+			return fmt.Sprintf("%s: %s is not one of the allowed values", path, compact(v))
+		}
+	}
+	if want, ok := s["const"]; ok && !reflect.DeepEqual(v, want) {
+		return fmt.Sprintf("%s: expected %s, got %s", path, compact(want), compact(v))
+	}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return s.validateObject(v, path)
+	case []interface{}:
+		if n, ok := s["minItems"].(float64); ok && float64(len(v)) < n {
+			return fmt.Sprintf("%s: %d items, fewer than %g", path, len(v), n)
+		}
+		if n, ok := s["maxItems"].(float64); ok && float64(len(v)) > n {
+			return fmt.Sprintf("%s: %d items, more than %g", path, len(v), n)
+		}
+		if items, ok := s["items"].(map[string]interface{}); ok {
+			for i, item := range v {
+				if problem := Schema(items).validate(item, fmt.Sprintf("%s[%d]", path, i)); problem != "" {
+					return problem
+				}
+			}
+		}
+	case string:
+		n := utf8.RuneCountInString(v)
+		if min, ok := s["minLength"].(float64); ok && float64(n) < min {
+			return fmt.Sprintf("%s: %d characters, fewer than %g", path, n, min)
+		}
+		if max, ok := s["maxLength"].(float64); ok && float64(n) > max {
+			return fmt.Sprintf("%s: %d characters, more than %g", path, n, max)
+		}
+		if pattern, ok := s["pattern"].(string); ok && !regexp.MustCompile(pattern).MatchString(v) {
+			return fmt.Sprintf("%s: %q does not match /%s/", path, v, pattern)
+		}
+	case float64:
+		if min, ok := s["minimum"].(float64); ok && v < min {
+			return fmt.Sprintf("%s: %g is less than %g", path, v, min)
+		}
+		if max, ok := s["maximum"].(float64); ok && v > max {
+			return fmt.Sprintf("%s: %g is more than %g", path, v, max)
+		}
+	}
+	return ""
+}
+
+// validateObject checks the properties of an object
+func (s Schema) validateObject(v map[string]interface{}, path string) string {
+	required, _ := s["required"].([]interface{})
+	for _, name := range required {
+		if _, ok := v[name.(string)]; !ok {
+			return fmt.Sprintf("%s: missing property %q", path, name)
+		}
+	}
+
+	properties, _ := s["properties"].(map[string]interface{})
+	names := make([]string, 0, len(v))
+	for name := range v {
+		names = append(names, name)
+	}
+	// Sorted, so the same reply always reports the same problem
+	sort.Strings(names)
+	for _, name := range names {
+		sub, ok := properties[name].(map[string]interface{})
+		if !ok {
+			switch extra := s["additionalProperties"].(type) {
+			case bool:
+				if !extra {
+					return fmt.Sprintf("%s: unexpected property %q", path, name)
+				}
+				continue
+			case map[string]interface{}:
+				sub = extra
+			default:
+				continue
+			}
+		}
+		if problem := Schema(sub).validate(v[name], path+"."+name); problem != "" {
+			return problem
+		}
+	}
+	return ""
+}
+
+// typeNames returns the types of a type keyword, given as a name or a list
+func typeNames(v interface{}) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		names := make([]string, 0, len(v))
+		for _, name := range v {
+			names = append(names, fmt.Sprint(name))
+		}
+		return names
+	}
+	return nil
+}
+
+// hasType reports whether v is of the JSON Schema type t
+func hasType(v interface{}, t string) bool {
+	if t == "integer" {
+		n, ok := v.(float64)
+		return ok && n == math.Trunc(n)
+	}
+	return typeOf(v) == t
+}
+
+// typeOf returns the JSON Schema type of v
+func typeOf(v interface{}) string {
+	switch v.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	case nil:
+		return "null"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// compact renders v as short JSON for a problem report
+func compact(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	if len(data) > 60 {
+		return string(data[:57]) + "..."
+	}
+	return string(data)
+}
@@ -0,0 +1,110 @@
+// Package extract turns documents into plain text for the chat context and
+// for retrieval: PDF and DOCX files are parsed, anything else must be text
+package extract
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrNotText is returned for files that are neither text nor a supported
+// document format
+var ErrNotText = errors.New("not a text file")
+
+// maxDocumentXML bounds the decompressed body of a DOCX file
+const maxDocumentXML = 64 << 20
+
+// Text returns the text of a document named name with content data. The
+// format is chosen by the file extension.
+func Text(name string, data []byte) (string, error) {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".pdf":
+		text, err := pdfText(data)
+		if err != nil {
+			return "", fmt.Errorf("failed to read PDF: %w", err)
+		}
+		if strings.TrimSpace(text) == "" {
+			return "", errors.New("the PDF has no extractable text (is it scanned?)")
+		}
+		return text, nil
+	case ".docx":
+		text, err := docxText(data)
+		if err != nil {
+			return "", fmt.Errorf("failed to read DOCX: %w", err)
+		}
+		return text, nil
+	}
+
+	if !utf8.Valid(data) || bytes.IndexByte(data, 0) >= 0 {
+		return "", ErrNotText
+	}
+	return string(data), nil
+}
+
+// docxText returns the paragraphs of a DOCX file's main document, one per
+// line. Tables come out a cell per line; headers, footers and comments are
+// left out.
+func docxText(data []byte) (string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", fmt.Errorf("failed to open archive: %w", err)
+	}
+
+	var body io.ReadCloser
+	for _, f := range zr.File {
+		if f.Name == "word/document.xml" {
+			if body, err = f.Open(); err != nil {
+				return "", fmt.Errorf("failed to open document: %w", err)
+			}
+			break
+		}
+	}
+	if body == nil {
+		return "", errors.New("word/document.xml is missing")
+	}
+	defer body.Close()
+
+	var b strings.Builder
+	dec := xml.NewDecoder(io.LimitReader(body, maxDocumentXML))
+	inText := false
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to parse document: %w", err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "t":
+				inText = true
+			case "tab":
+				b.WriteByte('\t')
+			case "br", "cr":
+				b.WriteByte('\n')
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				b.WriteByte('\n')
+			}
+		case xml.CharData:
+			if inText {
+				b.Write(t)
+			}
+		}
+	}
+	return strings.TrimSpace(b.String()), nil
+}
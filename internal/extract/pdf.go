@@ -0,0 +1,942 @@
+package extract
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// PDF objects as parsed: float64 numbers, bool, nil, and the types below
+type (
+	pdfName    string
+	pdfString  []byte
+	pdfKeyword string // Operators in content streams, and obj, R, stream, ...
+	pdfArray   []interface{}
+	pdfDict    map[pdfName]interface{}
+	pdfRef     int // Indirect reference by object number
+)
+
+// pdfStream is a stream object with its still encoded data
+type pdfStream struct {
+	dict pdfDict
+	data []byte
+}
+
+// maxFormDepth bounds how deeply form XObjects may nest, which also catches
+// forms drawing themselves
+const maxFormDepth = 8
+
+// maxInflated bounds the decompressed streams of a PDF altogether, so a
+// small file can't expand to gigabytes
+const maxInflated = 64 << 20
+
+// errTooLarge is returned for PDFs whose streams decompress past maxInflated
+var errTooLarge = fmt.Errorf("streams decompress to more than %d MB", maxInflated>>20)
+
+var (
+	objHeader = regexp.MustCompile(`(\d+)\s+\d+\s+obj\b`)
+	encrypted = regexp.MustCompile(`/Encrypt\s+(\d+\s+\d+\s+R|<<)`)
+)
+
+// pdfText extracts the text of a PDF page by page. It reads the objects
+// directly rather than through the cross-reference table, so files with a
+// damaged xref still work. Fonts are decoded through their ToUnicode maps,
+// or as WinAnsi when they have none; scanned pages have no text to find.
+func pdfText(data []byte) (string, error) {
+	if !bytes.HasPrefix(bytes.TrimLeft(data, "\x00\t\r\n "), []byte("%PDF-")) {
+		return "", errors.New("not a PDF file")
+	}
+	if encrypted.Match(data) {
+		return "", errors.New("encrypted PDFs are not supported")
+	}
+
+	doc := &pdfDoc{objects: make(map[int]interface{}), cmaps: make(map[int]*cmap)}
+	doc.load(data)
+
+	var b strings.Builder
+	for _, page := range doc.pages() {
+		w := &textWriter{}
+		for _, content := range doc.contents(page.dict) {
+			doc.run(w, content, page.resources, 0)
+		}
+		if text := w.String(); text != "" {
+			if b.Len() > 0 {
+				b.WriteString("\n\n")
+			}
+			b.WriteString(text)
+		}
+	}
+	if doc.tooLarge {
+		return "", errTooLarge
+	}
+	return b.String(), nil
+}
+
+// pdfDoc holds the objects of a PDF by number
+type pdfDoc struct {
+	objects  map[int]interface{}
+	cmaps    map[int]*cmap // Parsed ToUnicode maps by object number
+	inflated int           // Bytes decompressed so far, up to maxInflated
+	tooLarge bool          // A stream didn't fit in what was left of maxInflated
+}
+
+// load parses every "n g obj" in data, later definitions replacing earlier
+// ones as in incremental updates, then the objects packed in object streams
+func (d *pdfDoc) load(data []byte) {
+	var objStreams []*pdfStream
+	for _, m := range objHeader.FindAllSubmatchIndex(data, -1) {
+		num, err := strconv.Atoi(string(data[m[2]:m[3]]))
+		if err != nil {
+			continue
+		}
+		p := &pdfParser{data: data, pos: m[1]}
+		value, err := p.object()
+		if err != nil {
+			continue
+		}
+		if dict, ok := value.(pdfDict); ok && p.keyword("stream") {
+			stream := &pdfStream{dict: dict, data: p.streamData(dict)}
+			value = stream
+			if dict["Type"] == pdfName("ObjStm") {
+				objStreams = append(objStreams, stream)
+			}
+		}
+		d.objects[num] = value
+	}
+
+	for _, stream := range objStreams {
+		d.loadObjStream(stream)
+	}
+}
+
+// loadObjStream adds the objects of an object stream not defined directly
+func (d *pdfDoc) loadObjStream(stream *pdfStream) {
+	data, err := d.decode(stream)
+	if err != nil {
+		return
+	}
+	n, _ := d.resolve(stream.dict["N"]).(float64)
+	first, _ := d.resolve(stream.dict["First"]).(float64)
+	if first <= 0 || int(first) > len(data) {
+		return
+	}
+
+	header := &pdfParser{data: data[:int(first)]}
+	for i := 0; i < int(n); i++ {
+		num, err1 := header.object()
+		offset, err2 := header.object()
+		if err1 != nil || err2 != nil {
+			return
+		}
+		numF, ok1 := num.(float64)
+		offsetF, ok2 := offset.(float64)
+		if !ok1 || !ok2 {
+			return
+		}
+		if _, defined := d.objects[int(numF)]; defined {
+			continue
+		}
+		p := &pdfParser{data: data, pos: int(first) + int(offsetF)}
+		if value, err := p.object(); err == nil {
+			d.objects[int(numF)] = value
+		}
+	}
+}
+
+// resolve follows indirect references
+func (d *pdfDoc) resolve(v interface{}) interface{} {
+	for i := 0; i < 32; i++ {
+		ref, ok := v.(pdfRef)
+		if !ok {
+			return v
+		}
+		v = d.objects[int(ref)]
+	}
+	return nil
+}
+
+// dict resolves v to a dictionary, or the dictionary of a stream
+func (d *pdfDoc) dict(v interface{}) pdfDict {
+	switch v := d.resolve(v).(type) {
+	case pdfDict:
+		return v
+	case *pdfStream:
+		return v.dict
+	}
+	return nil
+}
+
+// pdfPage is a page with the resources it uses, inherited ones included
+type pdfPage struct {
+	dict      pdfDict
+	resources pdfDict
+}
+
+// pages returns the pages in order, walking the page tree from the
+// catalog, or every page object in object order if there is no catalog
+func (d *pdfDoc) pages() []pdfPage {
+	var pages []pdfPage
+	seen := make(map[int]bool)
+	var walk func(node interface{}, resources pdfDict)
+	walk = func(node interface{}, resources pdfDict) {
+		if ref, ok := node.(pdfRef); ok {
+			if seen[int(ref)] {
+				return
+			}
+			seen[int(ref)] = true
+		}
+		dict := d.dict(node)
+		if dict == nil {
+			return
+		}
+		if own := d.dict(dict["Resources"]); own != nil {
+			resources = own
+		}
+		if kids, ok := d.resolve(dict["Kids"]).(pdfArray); ok {
+			for _, kid := range kids {
+				walk(kid, resources)
+			}
+			return
+		}
+		pages = append(pages, pdfPage{dict: dict, resources: resources})
+	}
+
+	for _, num := range d.numbers() {
+		if dict := d.dict(pdfRef(num)); dict["Type"] == pdfName("Catalog") {
+			walk(dict["Pages"], nil)
+			if len(pages) > 0 {
+				return pages
+			}
+		}
+	}
+	for _, num := range d.numbers() {
+		if dict := d.dict(pdfRef(num)); dict["Type"] == pdfName("Page") {
+			walk(pdfRef(num), nil)
+		}
+	}
+	return pages
+}
+
+// numbers returns the object numbers in ascending order
+func (d *pdfDoc) numbers() []int {
+	nums := make([]int, 0, len(d.objects))
+	for num := range d.objects {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+	return nums
+}
+
+// contents returns the decoded content streams of a page
+func (d *pdfDoc) contents(page pdfDict) [][]byte {
+	var refs pdfArray
+	switch v := d.resolve(page["Contents"]).(type) {
+	case pdfArray:
+		refs = v
+	case *pdfStream:
+		refs = pdfArray{v}
+	}
+
+	var contents [][]byte
+	for _, ref := range refs {
+		if stream, ok := d.resolve(ref).(*pdfStream); ok {
+			if data, err := d.decode(stream); err == nil {
+				contents = append(contents, data)
+			}
+		}
+	}
+	return contents
+}
+
+// decode applies a stream's filters. Only the filters text content uses in
+// practice are supported.
+func (d *pdfDoc) decode(stream *pdfStream) ([]byte, error) {
+	var filters pdfArray
+	switch f := d.resolve(stream.dict["Filter"]).(type) {
+	case pdfName:
+		filters = pdfArray{f}
+	case pdfArray:
+		filters = f
+	}
+
+	data := stream.data
+	for _, f := range filters {
+		switch d.resolve(f) {
+		case pdfName("FlateDecode"), pdfName("Fl"):
+			inflated, err := inflate(data, maxInflated-d.inflated)
+			if errors.Is(err, errTooLarge) {
+				d.tooLarge = true
+			}
+			if err != nil {
+				return nil, err
+			}
+			d.inflated += len(inflated)
+			data = inflated
+		case pdfName("ASCIIHexDecode"), pdfName("AHx"):
+			data = decodeHex(bytes.TrimSuffix(bytes.TrimSpace(data), []byte(">")))
+		default:
+			return nil, fmt.Errorf("unsupported filter %v", f)
+		}
+	}
+	return data, nil
+}
+
+// inflate decompresses zlib data, or raw deflate data from writers that
+// leave out the zlib header, to at most limit bytes. Whatever was read
+// before a corrupt tail is kept.
+func inflate(data []byte, limit int) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		r = flate.NewReader(bytes.NewReader(data))
+	}
+	defer r.Close()
+	out, err := io.ReadAll(io.LimitReader(r, int64(limit)+1))
+	if len(out) > limit {
+		return nil, errTooLarge
+	}
+	if err != nil && len(out) == 0 {
+		return nil, fmt.Errorf("failed to inflate stream: %w", err)
+	}
+	return out, nil
+}
+
+// font returns the decoder of a font resource
+func (d *pdfDoc) font(resources pdfDict, name pdfName) *cmap {
+	fonts := d.dict(resources["Font"])
+	ref, isRef := fonts[name].(pdfRef)
+	font := d.dict(fonts[name])
+	if font == nil {
+		return nil
+	}
+	if isRef {
+		if m, ok := d.cmaps[int(ref)]; ok {
+			return m
+		}
+	}
+
+	m := &cmap{}
+	if stream, ok := d.resolve(font["ToUnicode"]).(*pdfStream); ok {
+		if data, err := d.decode(stream); err == nil {
+			m = parseCMap(data)
+		}
+	} else if font["Subtype"] == pdfName("Type0") {
+		// Two-byte glyph IDs without a map to Unicode can't be read
+		m.opaque = true
+	}
+	if isRef {
+		d.cmaps[int(ref)] = m
+	}
+	return m
+}
+
+// run interprets a content stream, writing its text to w. Form XObjects
+// drawn with Do are run with their own resources.
+func (d *pdfDoc) run(w *textWriter, content []byte, resources pdfDict, depth int) {
+	p := &pdfParser{data: content}
+	var operands []interface{}
+	var font *cmap
+	var lastY float64
+
+	operand := func(i int) interface{} {
+		if i < len(operands) {
+			return operands[i]
+		}
+		return nil
+	}
+	number := func(i int) float64 {
+		n, _ := operand(i).(float64)
+		return n
+	}
+	show := func(v interface{}) {
+		if s, ok := v.(pdfString); ok {
+			w.write(font.decode(s))
+		}
+	}
+
+	for {
+		value, err := p.object()
+		if err != nil {
+			return
+		}
+		op, ok := value.(pdfKeyword)
+		if !ok {
+			operands = append(operands, value)
+			continue
+		}
+
+		switch op {
+		case "BT":
+			w.space()
+		case "ET":
+			w.space()
+		case "Tf":
+			if name, ok := operand(0).(pdfName); ok {
+				font = d.font(resources, name)
+			}
+		case "Tj":
+			show(operand(0))
+		case "'":
+			w.newline()
+			show(operand(0))
+		case "\"":
+			w.newline()
+			show(operand(2))
+		case "TJ":
+			items, _ := operand(0).(pdfArray)
+			for _, item := range items {
+				// A negative adjustment of a fifth of an em or more (in
+				// thousandths) stands for a space
+				if n, ok := item.(float64); ok && n <= -200 {
+					w.space()
+				}
+				show(item)
+			}
+		case "Td", "TD":
+			if number(1) != 0 {
+				w.newline()
+			} else if number(0) != 0 {
+				w.space()
+			}
+		case "Tm":
+			if y := number(5); y != lastY {
+				w.newline()
+				lastY = y
+			} else {
+				w.space()
+			}
+		case "T*":
+			w.newline()
+		case "ID":
+			// Inline image data runs up to EI
+			p.skipInlineImage()
+		case "Do":
+			name, _ := operand(0).(pdfName)
+			stream, ok := d.resolve(d.dict(resources["XObject"])[name]).(*pdfStream)
+			if ok && stream.dict["Subtype"] == pdfName("Form") && depth < maxFormDepth {
+				if data, err := d.decode(stream); err == nil {
+					formResources := d.dict(stream.dict["Resources"])
+					if formResources == nil {
+						formResources = resources
+					}
+					w.newline()
+					d.run(w, data, formResources, depth+1)
+					w.newline()
+				}
+			}
+		}
+		operands = operands[:0]
+	}
+}
+
+// textWriter collects extracted text, collapsing the spaces and line
+// breaks the layout operators add
+type textWriter struct {
+	b strings.Builder
+}
+
+func (w *textWriter) write(s string) {
+	if s == "" {
+		return
+	}
+	w.b.WriteString(s)
+}
+
+func (w *textWriter) last() byte {
+	s := w.b.String()
+	if s == "" {
+		return '\n'
+	}
+	return s[len(s)-1]
+}
+
+func (w *textWriter) space() {
+	if c := w.last(); c != ' ' && c != '\n' {
+		w.b.WriteByte(' ')
+	}
+}
+
+func (w *textWriter) newline() {
+	if w.last() != '\n' {
+		s := strings.TrimRight(w.b.String(), " ")
+		w.b.Reset()
+		w.b.WriteString(s)
+		w.b.WriteByte('\n')
+	}
+}
+
+func (w *textWriter) String() string {
+	lines := strings.Split(w.b.String(), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// cmap maps a font's character codes to Unicode
+type cmap struct {
+	width  int               // Bytes per code: 1, or 2 for CID fonts
+	codes  map[string]string // Code bytes to text
+	opaque bool              // Codes that can't be mapped to text
+}
+
+// decode converts a string shown in the font to text. A nil cmap is a
+// simple font without a map, read as WinAnsi.
+func (m *cmap) decode(s pdfString) string {
+	if m == nil || (m.codes == nil && !m.opaque) {
+		return winAnsi(s)
+	}
+	if m.opaque {
+		return ""
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		n := min(m.width, len(s)-i)
+		if text, ok := m.codes[string(s[i:i+n])]; ok {
+			b.WriteString(text)
+		} else if m.width == 1 {
+			b.WriteString(winAnsi(s[i : i+1]))
+		}
+		i += n
+	}
+	return b.String()
+}
+
+// parseCMap reads the bfchar and bfrange mappings of a ToUnicode CMap
+func parseCMap(data []byte) *cmap {
+	m := &cmap{width: 1, codes: make(map[string]string)}
+	p := &pdfParser{data: data}
+	var operands []interface{}
+
+	for {
+		value, err := p.object()
+		if err != nil {
+			break
+		}
+		op, ok := value.(pdfKeyword)
+		if !ok {
+			operands = append(operands, value)
+			continue
+		}
+
+		switch op {
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				src, ok1 := operands[i].(pdfString)
+				dst, ok2 := operands[i+1].(pdfString)
+				if ok1 && ok2 {
+					m.add(src, utf16BE(dst))
+				}
+			}
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				lo, ok1 := operands[i].(pdfString)
+				hi, ok2 := operands[i+1].(pdfString)
+				if !ok1 || !ok2 || len(lo) != len(hi) || len(lo) == 0 {
+					continue
+				}
+				start, end := codeValue(lo), codeValue(hi)
+				if end < start || end-start > 0xFFFF {
+					continue
+				}
+				for code := start; code <= end; code++ {
+					src := codeBytes(code, len(lo))
+					switch dst := operands[i+2].(type) {
+					case pdfString:
+						m.add(src, utf16BE(incrementLast(dst, code-start)))
+					case pdfArray:
+						if int(code-start) < len(dst) {
+							if s, ok := dst[code-start].(pdfString); ok {
+								m.add(src, utf16BE(s))
+							}
+						}
+					}
+				}
+			}
+		}
+		if strings.HasPrefix(string(op), "end") || strings.HasPrefix(string(op), "begin") {
+			operands = operands[:0]
+		}
+	}
+	return m
+}
+
+// add maps a code; the widest code seen sets the width
+func (m *cmap) add(code []byte, text string) {
+	m.codes[string(code)] = text
+	if len(code) > m.width {
+		m.width = len(code)
+	}
+}
+
+func codeValue(b []byte) uint32 {
+	var v uint32
+	for _, c := range b {
+		v = v<<8 | uint32(c)
+	}
+	return v
+}
+
+func codeBytes(v uint32, n int) []byte {
+	b := make([]byte, n)
+	for i := n - 1; i >= 0; i-- {
+		b[i] = byte(v)
+		v >>= 8
+	}
+	return b
+}
+
+// incrementLast adds n to the last UTF-16 unit of a bfrange destination
+func incrementLast(dst []byte, n uint32) []byte {
+	out := append([]byte(nil), dst...)
+	if len(out) < 2 {
+		return out
+	}
+	last := uint32(out[len(out)-2])<<8 | uint32(out[len(out)-1])
+	last += n
+	out[len(out)-2], out[len(out)-1] = byte(last>>8), byte(last)
+	return out
+}
+
+// utf16BE decodes big-endian UTF-16, the encoding of ToUnicode targets
+func utf16BE(b []byte) string {
+	units := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		units = append(units, uint16(b[i])<<8|uint16(b[i+1]))
+	}
+	return string(utf16.Decode(units))
+}
+
+// winAnsiHigh maps the bytes 0x80-0x9F of WinAnsiEncoding; the rest of the
+// upper half is Latin-1
+var winAnsiHigh = map[byte]rune{
+	0x80: '€', 0x82: '‚', 0x83: 'ƒ', 0x84: '„', 0x85: '…', 0x86: '†', 0x87: '‡',
+	0x88: 'ˆ', 0x89: '‰', 0x8A: 'Š', 0x8B: '‹', 0x8C: 'Œ', 0x8E: 'Ž',
+	0x91: '‘', 0x92: '’', 0x93: '“', 0x94: '”', 0x95: '•', 0x96: '–', 0x97: '—',
+	0x98: '˜', 0x99: '™', 0x9A: 'š', 0x9B: '›', 0x9C: 'œ', 0x9E: 'ž', 0x9F: 'Ÿ',
+}
+
+// winAnsi decodes a string of a simple font. Strings starting with a UTF-16
+// byte order mark are text strings and decoded as such.
+func winAnsi(s []byte) string {
+	if bytes.HasPrefix(s, []byte{0xFE, 0xFF}) {
+		return utf16BE(s[2:])
+	}
+	var b strings.Builder
+	for _, c := range s {
+		switch {
+		case c >= 0x80 && c <= 0x9F:
+			if r, ok := winAnsiHigh[c]; ok {
+				b.WriteRune(r)
+			}
+		case c >= 0x20 || c == '\t' || c == '\n':
+			b.WriteRune(rune(c))
+		}
+	}
+	return b.String()
+}
+
+// pdfParser reads PDF objects and content stream tokens
+type pdfParser struct {
+	data []byte
+	pos  int
+}
+
+var errEOF = errors.New("end of data")
+
+func isPDFSpace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\f' || c == 0
+}
+
+func isPDFDelimiter(c byte) bool {
+	return strings.IndexByte("()<>[]{}/%", c) >= 0
+}
+
+// skipSpace skips white space and comments
+func (p *pdfParser) skipSpace() {
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		if c == '%' {
+			for p.pos < len(p.data) && p.data[p.pos] != '\n' && p.data[p.pos] != '\r' {
+				p.pos++
+			}
+			continue
+		}
+		if !isPDFSpace(c) {
+			return
+		}
+		p.pos++
+	}
+}
+
+// keyword consumes the keyword kw if it comes next
+func (p *pdfParser) keyword(kw string) bool {
+	start := p.pos
+	value, err := p.token()
+	if err == nil && value == pdfKeyword(kw) {
+		return true
+	}
+	p.pos = start
+	return false
+}
+
+// object reads the next object. Numbers followed by "g R" become references.
+func (p *pdfParser) object() (interface{}, error) {
+	value, err := p.token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch v := value.(type) {
+	case float64:
+		start := p.pos
+		gen, err := p.token()
+		if _, ok := gen.(float64); ok && err == nil && p.keyword("R") {
+			return pdfRef(int(v)), nil
+		}
+		p.pos = start
+		return v, nil
+	case pdfKeyword:
+		switch v {
+		case "[":
+			var arr pdfArray
+			for {
+				if p.skipSpace(); p.pos < len(p.data) && p.data[p.pos] == ']' {
+					p.pos++
+					return arr, nil
+				}
+				item, err := p.object()
+				if err != nil {
+					return nil, err
+				}
+				arr = append(arr, item)
+			}
+		case "<<":
+			dict := make(pdfDict)
+			for {
+				if p.skipSpace(); p.pos+1 < len(p.data) && p.data[p.pos] == '>' && p.data[p.pos+1] == '>' {
+					p.pos += 2
+					return dict, nil
+				}
+				key, err := p.token()
+				if err != nil {
+					return nil, err
+				}
+				name, ok := key.(pdfName)
+				if !ok {
+					return nil, fmt.Errorf("dictionary key %v is not a name", key)
+				}
+				item, err := p.object()
+				if err != nil {
+					return nil, err
+				}
+				dict[name] = item
+			}
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+	}
+	return value, nil
+}
+
+// token reads a number, string, name, keyword or the opening of an array
+// or dictionary
+func (p *pdfParser) token() (interface{}, error) {
+	p.skipSpace()
+	if p.pos >= len(p.data) {
+		return nil, errEOF
+	}
+
+	c := p.data[p.pos]
+	switch {
+	case c == '(':
+		return p.literalString(), nil
+	case c == '<' && p.pos+1 < len(p.data) && p.data[p.pos+1] == '<':
+		p.pos += 2
+		return pdfKeyword("<<"), nil
+	case c == '<':
+		end := bytes.IndexByte(p.data[p.pos:], '>')
+		if end < 0 {
+			return nil, errEOF
+		}
+		s := decodeHex(p.data[p.pos+1 : p.pos+end])
+		p.pos += end + 1
+		return pdfString(s), nil
+	case c == '>' && p.pos+1 < len(p.data) && p.data[p.pos+1] == '>':
+		p.pos += 2
+		return pdfKeyword(">>"), nil
+	case c == '[' || c == ']' || c == '{' || c == '}' || c == '>' || c == ')':
+		p.pos++
+		return pdfKeyword(string(c)), nil
+	case c == '/':
+		p.pos++
+		return pdfName(unescapeName(p.regular())), nil
+	}
+
+	word := p.regular()
+	if word == "" {
+		p.pos++
+		return pdfKeyword(string(c)), nil
+	}
+	if n, err := strconv.ParseFloat(word, 64); err == nil && (c == '-' || c == '+' || c == '.' || (c >= '0' && c <= '9')) {
+		return n, nil
+	}
+	return pdfKeyword(word), nil
+}
+
+// regular reads a run of regular characters
+func (p *pdfParser) regular() string {
+	start := p.pos
+	for p.pos < len(p.data) && !isPDFSpace(p.data[p.pos]) && !isPDFDelimiter(p.data[p.pos]) {
+		p.pos++
+	}
+	return string(p.data[start:p.pos])
+}
+
+// literalString reads a (string) with its escapes and balanced parentheses
+func (p *pdfParser) literalString() pdfString {
+	p.pos++ // (
+	var s []byte
+	depth := 1
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		p.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			if depth--; depth == 0 {
+				return s
+			}
+		case '\\':
+			if p.pos >= len(p.data) {
+				return s
+			}
+			e := p.data[p.pos]
+			p.pos++
+			switch e {
+			case 'n':
+				s = append(s, '\n')
+			case 'r':
+				s = append(s, '\r')
+			case 't':
+				s = append(s, '\t')
+			case 'b':
+				s = append(s, '\b')
+			case 'f':
+				s = append(s, '\f')
+			case '\r':
+				// Line continuation
+				if p.pos < len(p.data) && p.data[p.pos] == '\n' {
+					p.pos++
+				}
+			case '\n':
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for i := 0; i < 2 && p.pos < len(p.data) && p.data[p.pos] >= '0' && p.data[p.pos] <= '7'; i++ {
+						v = v*8 + int(p.data[p.pos]-'0')
+						p.pos++
+					}
+					s = append(s, byte(v))
+				} else {
+					s = append(s, e)
+				}
+			}
+			continue
+		}
+		s = append(s, c)
+	}
+	return s
+}
+
+// streamData returns the data of a stream whose "stream" keyword was just
+// read, using /Length when it is direct and plausible
+func (p *pdfParser) streamData(dict pdfDict) []byte {
+	if p.pos < len(p.data) && p.data[p.pos] == '\r' {
+		p.pos++
+	}
+	if p.pos < len(p.data) && p.data[p.pos] == '\n' {
+		p.pos++
+	}
+	start := p.pos
+
+	if n, ok := dict["Length"].(float64); ok && n >= 0 && start+int(n) <= len(p.data) {
+		end := start + int(n)
+		if rest := bytes.TrimLeft(p.data[end:min(end+32, len(p.data))], "\r\n \t"); bytes.HasPrefix(rest, []byte("endstream")) {
+			p.pos = end
+			return p.data[start:end]
+		}
+	}
+
+	end := bytes.Index(p.data[start:], []byte("endstream"))
+	if end < 0 {
+		p.pos = len(p.data)
+		return p.data[start:]
+	}
+	p.pos = start + end
+	return bytes.TrimRight(p.data[start:start+end], "\r\n")
+}
+
+// skipInlineImage skips the data of an inline image, after its ID operator
+func (p *pdfParser) skipInlineImage() {
+	for i := p.pos + 1; i+2 <= len(p.data); i++ {
+		if p.data[i] == 'E' && p.data[i+1] == 'I' && isPDFSpace(p.data[i-1]) &&
+			(i+2 == len(p.data) || isPDFSpace(p.data[i+2])) {
+			p.pos = i + 2
+			return
+		}
+	}
+	p.pos = len(p.data)
+}
+
+// decodeHex decodes hex digits, ignoring white space and padding an odd
+// final digit with 0
+func decodeHex(b []byte) []byte {
+	digits := make([]byte, 0, len(b)+1)
+	for _, c := range b {
+		if !isPDFSpace(c) {
+			digits = append(digits, c)
+		}
+	}
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	out := make([]byte, len(digits)/2)
+	if _, err := hex.Decode(out, digits); err != nil {
+		return nil
+	}
+	return out
+}
+
+// unescapeName decodes #xx escapes in a name
+func unescapeName(s string) string {
+	if !strings.Contains(s, "#") {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '#' && i+2 < len(s) {
+			if v, err := strconv.ParseUint(s[i+1:i+3], 16, 8); err == nil {
+				b.WriteByte(byte(v))
+				i += 2
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
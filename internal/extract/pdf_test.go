@@ -0,0 +1,185 @@
+package extract
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// buildPDF writes objects numbered from 1, without an xref table, which
+// the parser doesn't need. Empty objects are left out, as for numbers
+// defined in an object stream.
+func buildPDF(objects ...string) []byte {
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.7\n")
+	for i, obj := range objects {
+		if obj != "" {
+			fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+		}
+	}
+	b.WriteString("%%EOF\n")
+	return b.Bytes()
+}
+
+// stream is a stream object with data as it is stored
+func stream(dict string, data []byte) string {
+	return fmt.Sprintf("<< %s /Length %d >>\nstream\n%s\nendstream", dict, len(data), data)
+}
+
+func deflate(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	w := zlib.NewWriter(&b)
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+// onePage is a catalog, a page tree and a page whose font F1 is object 5
+// and whose content is object 4
+var onePage = []string{
+	"<< /Type /Catalog /Pages 2 0 R >>",
+	"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+	"<< /Type /Page /Parent 2 0 R /Resources << /Font << /F1 5 0 R >> >> /Contents 4 0 R >>",
+}
+
+const helvetica = "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>"
+
+func TestPDFText(t *testing.T) {
+	content := []byte("BT /F1 12 Tf 72 700 Td (Hello, world) Tj 0 -14 Td [(Sec) -300 (ond) 20 (line)] TJ ET")
+	tests := []struct {
+		name    string
+		objects []string
+		want    string
+	}{
+		{
+			name:    "plain stream",
+			objects: append(append([]string{}, onePage...), stream("", content), helvetica),
+			want:    "Hello, world\nSec ondline",
+		},
+		{
+			name:    "Flate-compressed stream",
+			objects: append(append([]string{}, onePage...), stream("/Filter /FlateDecode", deflate(t, content)), helvetica),
+			want:    "Hello, world\nSec ondline",
+		},
+		{
+			name: "WinAnsi and escapes",
+			objects: append(append([]string{}, onePage...),
+				stream("", []byte(`BT /F1 12 Tf (Caf\351 \223quoted\224 \(x\)) Tj ET`)), helvetica),
+			want: "Café “quoted” (x)",
+		},
+	}
+	for _, tt := range tests {
+		got, err := Text("doc.pdf", buildPDF(tt.objects...))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPDFObjectAndXrefStreams(t *testing.T) {
+	// The catalog, page tree and page are packed in object stream 6, as
+	// writers that use xref streams (object 7) do
+	packed := []string{onePage[0], onePage[1], onePage[2]}
+	var header, body strings.Builder
+	for i, obj := range packed {
+		fmt.Fprintf(&header, "%d %d ", i+1, body.Len())
+		body.WriteString(obj + "\n")
+	}
+	data := header.String() + body.String()
+	objStm := stream(fmt.Sprintf("/Type /ObjStm /N 3 /First %d /Filter /FlateDecode", header.Len()), deflate(t, []byte(data)))
+	xref := stream("/Type /XRef /Size 8 /W [1 2 1] /Root 1 0 R /Filter /FlateDecode", deflate(t, make([]byte, 32)))
+
+	pdf := buildPDF(
+		"", "", "",
+		stream("", []byte("BT /F1 12 Tf (Packed) Tj ET")),
+		helvetica,
+		objStm,
+		xref,
+	)
+
+	got, err := Text("doc.pdf", pdf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "Packed" {
+		t.Errorf("got %q, want Packed", got)
+	}
+}
+
+func TestPDFToUnicode(t *testing.T) {
+	cmap := []byte(`/CIDInit /ProcSet findresource begin
+begincmap
+1 begincodespacerange <0000> <FFFF> endcodespacerange
+1 beginbfchar
+<0001> <0048>
+endbfchar
+2 beginbfrange
+<0002> <0003> <0069>
+<0004> <0005> [<00E9> <D83DDE00>]
+endbfrange
+endcmap`)
+	font := "<< /Type /Font /Subtype /Type0 /BaseFont /Custom /Encoding /Identity-H /ToUnicode 6 0 R >>"
+	pdf := buildPDF(append(append([]string{}, onePage...),
+		stream("", []byte("BT /F1 12 Tf <00010002000300040005> Tj ET")),
+		font,
+		stream("/Filter /FlateDecode", deflate(t, cmap)),
+	)...)
+
+	got, err := Text("doc.pdf", pdf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "Hijé😀" {
+		t.Errorf("got %q, want Hijé😀", got)
+	}
+
+	// Without a map, the glyph IDs of a CID font can't be read
+	opaque := strings.Replace(font, " /ToUnicode 6 0 R", "", 1)
+	pdf = buildPDF(append(append([]string{}, onePage...),
+		stream("", []byte("BT /F1 12 Tf <0001> Tj ET")), opaque)...)
+	if _, err := Text("doc.pdf", pdf); err == nil || !strings.Contains(err.Error(), "no extractable text") {
+		t.Errorf("Text = %v, want a no extractable text error", err)
+	}
+}
+
+func TestPDFDecompressionBomb(t *testing.T) {
+	// Under 100 KB compressed, past maxInflated decompressed
+	bomb := deflate(t, make([]byte, maxInflated+1))
+	pdf := buildPDF(append(append([]string{}, onePage...), stream("/Filter /FlateDecode", bomb), helvetica)...)
+	if _, err := Text("doc.pdf", pdf); err == nil || !strings.Contains(err.Error(), "decompress to more than") {
+		t.Errorf("Text = %v, want a decompression limit error", err)
+	}
+
+	// The limit is on the document: streams under it each add up past it
+	half := stream("/Filter /FlateDecode", deflate(t, make([]byte, maxInflated/2+1)))
+	page := "<< /Type /Page /Parent 2 0 R /Resources << /Font << /F1 5 0 R >> >> /Contents [4 0 R 6 0 R] >>"
+	pdf = buildPDF(onePage[0], onePage[1], page, half, helvetica, half)
+	if _, err := Text("doc.pdf", pdf); err == nil || !strings.Contains(err.Error(), "decompress to more than") {
+		t.Errorf("Text = %v, want a decompression limit error", err)
+	}
+}
+
+func TestPDFRejected(t *testing.T) {
+	tests := []struct {
+		name, data, want string
+	}{
+		{"not a PDF", "hello", "not a PDF file"},
+		{"encrypted", "%PDF-1.4\ntrailer << /Encrypt 9 0 R >>", "encrypted PDFs are not supported"},
+	}
+	for _, tt := range tests {
+		if _, err := Text("doc.pdf", []byte(tt.data)); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: Text = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+// Package git reads the changes of a local repository with the git command,
+// the staged diff or a branch's diff and commits, and writes commit messages
+// and pull request descriptions back
+package git
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Changes is a diff and what it is made of
+type Changes struct {
+	Branch  string   // Current branch; empty when HEAD is detached
+	Base    string   // Ref a branch diff is against; empty for the staged changes
+	Stat    string   // Files changed, as git diff --stat shows them
+	Diff    string   // Unified diff
+	Commits []string // Subjects of the branch's commits since Base, oldest first
+}
+
+// defaultBases are the branches a branch is compared with when the remote
+// doesn't name its default branch, in order of preference
+var defaultBases = []string{"origin/main", "origin/master", "main", "master"}
+
+// Staged returns the changes staged for the next commit in the repository
+// at dir, or the working directory when dir is empty
+func Staged(ctx context.Context, dir string) (*Changes, error) {
+	diff, err := run(ctx, dir, "", "diff", "--cached", "--no-color", "--no-ext-diff")
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(diff) == "" {
+		return nil, errors.New("nothing is staged; stage changes with git add first")
+	}
+	stat, err := run(ctx, dir, "", "diff", "--cached", "--no-color", "--stat")
+	if err != nil {
+		return nil, err
+	}
+	return &Changes{Branch: currentBranch(ctx, dir), Stat: stat, Diff: diff}, nil
+}
+
+// Branch returns the changes of the current branch since it left base: its
+// commits and their diff, without any other changes on base. An empty base
+// is the remote's default branch, or main or master.
+func Branch(ctx context.Context, dir, base string) (*Changes, error) {
+	if base == "" {
+		var err error
+		if base, err = DefaultBase(ctx, dir); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := run(ctx, dir, "", "rev-parse", "--verify", "--quiet", base+"^{commit}"); err != nil {
+		return nil, fmt.Errorf("no branch or commit %q to compare with", base)
+	}
+	log, err := run(ctx, dir, "", "log", "--reverse", "--format=%s", base+"..HEAD")
+	if err != nil {
+		return nil, err
+	}
+	commits := strings.Split(strings.TrimSpace(log), "\n")
+	if commits[0] == "" {
+		return nil, fmt.Errorf("HEAD has no commits that %s doesn't have", base)
+	}
+	diff, err := run(ctx, dir, "", "diff", "--no-color", "--no-ext-diff", base+"...HEAD")
+	if err != nil {
+		return nil, err
+	}
+	stat, err := run(ctx, dir, "", "diff", "--no-color", "--stat", base+"...HEAD")
+	if err != nil {
+		return nil, err
+	}
+	return &Changes{Branch: currentBranch(ctx, dir), Base: base, Stat: stat, Diff: diff, Commits: commits}, nil
+}
+
+// DefaultBase returns the branch the current one is most likely to be
+// merged into: the default branch of the origin remote, or the first of
+// origin/main, origin/master, main and master that exists
+func DefaultBase(ctx context.Context, dir string) (string, error) {
+	if head, err := run(ctx, dir, "", "symbolic-ref", "--quiet", "--short", "refs/remotes/origin/HEAD"); err == nil {
+		return strings.TrimSpace(head), nil
+	}
+	for _, ref := range defaultBases {
+		if _, err := run(ctx, dir, "", "rev-parse", "--verify", "--quiet", ref+"^{commit}"); err == nil {
+			return ref, nil
+		}
+	}
+	return "", errors.New("no main or master branch to compare with; name one with --base")
+}
+
+// currentBranch returns the checked out branch, or "" when HEAD is detached
+func currentBranch(ctx context.Context, dir string) string {
+	branch, err := run(ctx, dir, "", "symbolic-ref", "--quiet", "--short", "HEAD")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(branch)
+}
+
+// Commit commits the staged changes with message, running the repository's
+// hooks, and returns what git printed
+func Commit(ctx context.Context, dir, message string) (string, error) {
+	return run(ctx, dir, message, "commit", "--file=-")
+}
+
+// EditPullRequest sets the title and body of the open pull request of the
+// current branch with the GitHub CLI, gh, and returns what it printed
+func EditPullRequest(ctx context.Context, dir, title, body string) (string, error) {
+	if _, err := exec.LookPath("gh"); err != nil {
+		return "", errors.New("the GitHub CLI (gh) is needed to update the pull request")
+	}
+	return command(ctx, exec.CommandContext(ctx, "gh", "pr", "edit", "--title", title, "--body-file", "-"), dir, body)
+}
+
+// run runs git with args in dir and returns its output, stdin fed to it
+func run(ctx context.Context, dir, stdin string, args ...string) (string, error) {
+	return command(ctx, exec.CommandContext(ctx, "git", args...), dir, stdin)
+}
+
+// command runs cmd in dir with stdin and returns its standard output. Its
+// error names the command and carries what it wrote to standard error.
+func command(ctx context.Context, cmd *exec.Cmd, dir, stdin string) (string, error) {
+	cmd.Dir = dir
+	cmd.Stdin = strings.NewReader(stdin)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		name := strings.Join(cmd.Args[:min(len(cmd.Args), 2)], " ")
+		if errors.Is(err, exec.ErrNotFound) {
+			return "", fmt.Errorf("%s: %w", name, err)
+		}
+		detail := strings.TrimSpace(stderr.String())
+		if detail == "" {
+			detail = strings.TrimSpace(stdout.String())
+		}
+		return "", fmt.Errorf("%s failed: %w: %s", name, err, detail)
+	}
+	return stdout.String(), nil
+}
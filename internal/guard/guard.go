@@ -0,0 +1,126 @@
+// Package guard checks prompts and replies against the content filters of
+// the guardrails: blocked keywords and patterns, a length limit and an
+// optional moderation API.
+package guard
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"ExtraChat/internal/config"
+)
+
+// What a filter guards
+const (
+	Prompt = "prompt"
+	Reply  = "reply"
+)
+
+// Checks a violation can come from
+const (
+	CheckKeyword    = "keyword"
+	CheckPattern    = "pattern"
+	CheckLength     = "length"
+	CheckModeration = "moderation"
+)
+
+// Violation is a prompt or reply a filter blocked
+type Violation struct {
+	Subject string // Prompt or Reply
+	Check   string // The check that tripped, such as CheckKeyword
+	Detail  string // What it found
+}
+
+func (v *Violation) Error() string {
+	return fmt.Sprintf("%s blocked by guardrails: %s", v.Subject, v.Detail)
+}
+
+// Moderator asks a moderation API about text and returns the categories it
+// was flagged for, none if it wasn't
+type Moderator func(ctx context.Context, text string) ([]string, error)
+
+// Filter checks the prompts or the replies
+type Filter struct {
+	subject   string
+	keywords  []string
+	matchers  []*regexp.Regexp // One per keyword
+	patterns  []*regexp.Regexp
+	maxLength int
+	moderate  Moderator // nil without moderation
+}
+
+// New compiles a filter for subject. moderate is used when the filter asks
+// for moderation.
+func New(subject string, cfg config.ContentFilter, moderate Moderator) (*Filter, error) {
+	f := &Filter{subject: subject, maxLength: cfg.MaxLength}
+	for _, keyword := range cfg.Keywords {
+		keyword = strings.TrimSpace(keyword)
+		if keyword == "" {
+			continue
+		}
+		// Words are matched whole, so "ass" doesn't block "class"
+		words := strings.Fields(regexp.QuoteMeta(keyword))
+		re, err := regexp.Compile(`(?i)(^|\W)` + strings.Join(words, `\s+`) + `($|\W)`)
+		if err != nil {
+			return nil, fmt.Errorf("invalid keyword %q: %w", keyword, err)
+		}
+		f.keywords = append(f.keywords, keyword)
+		f.matchers = append(f.matchers, re)
+	}
+	for _, pattern := range cfg.Patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+		f.patterns = append(f.patterns, re)
+	}
+	if cfg.Moderation {
+		f.moderate = moderate
+	}
+	return f, nil
+}
+
+// Enabled reports whether the filter checks anything
+func (f *Filter) Enabled() bool {
+	return f != nil && (len(f.matchers) > 0 || len(f.patterns) > 0 || f.maxLength > 0 || f.moderate != nil)
+}
+
+// Check returns a *Violation if text trips the filter. The moderation API
+// is asked last, and only if the local checks pass; its failure is returned
+// as an error, so unchecked text is not let through.
+func (f *Filter) Check(ctx context.Context, text string) error {
+	if !f.Enabled() {
+		return nil
+	}
+	if n := utf8.RuneCountInString(text); f.maxLength > 0 && n > f.maxLength {
+		return f.violation(CheckLength, fmt.Sprintf("%d characters, over the limit of %d", n, f.maxLength))
+	}
+	for i, re := range f.matchers {
+		if re.MatchString(text) {
+			return f.violation(CheckKeyword, fmt.Sprintf("contains %q", f.keywords[i]))
+		}
+	}
+	for _, re := range f.patterns {
+		if re.MatchString(text) {
+			return f.violation(CheckPattern, fmt.Sprintf("matches /%s/", re))
+		}
+	}
+	if f.moderate == nil {
+		return nil
+	}
+	categories, err := f.moderate(ctx, text)
+	if err != nil {
+		return fmt.Errorf("failed to moderate %s: %w", f.subject, err)
+	}
+	if len(categories) > 0 {
+		return f.violation(CheckModeration, "flagged for "+strings.Join(categories, ", "))
+	}
+	return nil
+}
+
+func (f *Filter) violation(check, detail string) *Violation {
+	return &Violation{Subject: f.subject, Check: check, Detail: detail}
+}
@@ -0,0 +1,97 @@
+package guard
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Secret is a credential or card number found in text
+type Secret struct {
+	Kind  string // What it looks like, such as "AWS access key"
+	Start int    // Byte offsets of the secret in the text
+	End   int
+}
+
+// secretPattern finds one kind of secret; valid, when set, weeds out
+// matches that only look like one
+type secretPattern struct {
+	kind  string
+	re    *regexp.Regexp
+	valid func(string) bool
+}
+
+// secretPatterns are the secrets ScanSecrets looks for. Keys are matched by
+// their published prefixes, so ordinary prose and code rarely trip them.
+var secretPatterns = []secretPattern{
+	{kind: "private key", re: regexp.MustCompile(`-----BEGIN [A-Z0-9 ]*PRIVATE KEY( BLOCK)?-----(?s:.*?)(-----END [A-Z0-9 ]*PRIVATE KEY( BLOCK)?-----|\z)`)},
+	{kind: "Anthropic API key", re: regexp.MustCompile(`\bsk-ant-[A-Za-z0-9_-]{20,}`)},
+	{kind: "OpenAI API key", re: regexp.MustCompile(`\bsk-(proj-|svcacct-)?[A-Za-z0-9_-]{20,}`)},
+	{kind: "xAI API key", re: regexp.MustCompile(`\bxai-[A-Za-z0-9]{20,}`)},
+	{kind: "AWS access key", re: regexp.MustCompile(`\b(AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{kind: "GitHub token", re: regexp.MustCompile(`\b(gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})`)},
+	{kind: "Slack token", re: regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,}`)},
+	{kind: "Google API key", re: regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}`)},
+	{kind: "Stripe secret key", re: regexp.MustCompile(`\b[rs]k_live_[0-9A-Za-z]{20,}`)},
+	{kind: "credit card number", re: regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`), valid: luhn},
+}
+
+// ScanSecrets returns the secrets in text in order of appearance. Where
+// matches overlap, the first to start wins.
+func ScanSecrets(text string) []Secret {
+	var found []Secret
+	for _, p := range secretPatterns {
+		for _, loc := range p.re.FindAllStringIndex(text, -1) {
+			if p.valid != nil && !p.valid(text[loc[0]:loc[1]]) {
+				continue
+			}
+			found = append(found, Secret{Kind: p.kind, Start: loc[0], End: loc[1]})
+		}
+	}
+	sort.SliceStable(found, func(i, j int) bool { return found[i].Start < found[j].Start })
+
+	var secrets []Secret
+	for _, s := range found {
+		if n := len(secrets); n > 0 && s.Start < secrets[n-1].End {
+			continue
+		}
+		secrets = append(secrets, s)
+	}
+	return secrets
+}
+
+// Redact replaces the secrets ScanSecrets found in text with markers
+// naming their kind
+func Redact(text string, secrets []Secret) string {
+	var b strings.Builder
+	pos := 0
+	for _, s := range secrets {
+		b.WriteString(text[pos:s.Start])
+		b.WriteString("[REDACTED " + s.Kind + "]")
+		pos = s.End
+	}
+	b.WriteString(text[pos:])
+	return b.String()
+}
+
+// luhn reports whether the digits of s pass the Luhn checksum of card
+// numbers, which rules out most other long numbers
+func luhn(s string) bool {
+	sum, n := 0, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if n%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n >= 13 && sum%10 == 0
+}
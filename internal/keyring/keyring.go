@@ -0,0 +1,62 @@
+// Package keyring stores secrets such as provider API keys in the OS
+// credential store: the macOS Keychain, the Secret Service (GNOME Keyring,
+// KWallet) via secret-tool, or the Windows Credential Manager.
+package keyring
+
+import (
+	"errors"
+	"sync"
+)
+
+// Service is the service name every secret is stored under; the account
+// is the backend name (e.g. "anthropic")
+const Service = "extrachat"
+
+// ErrNotFound is returned when no secret is stored for an account
+var ErrNotFound = errors.New("secret not found in keyring")
+
+// Lookups hit the credential store (and on most platforms spawn a process),
+// so results are cached for the life of the process
+var (
+	cacheMu sync.Mutex
+	cache   = make(map[string]lookupResult)
+)
+
+type lookupResult struct {
+	secret string
+	err    error
+}
+
+// Get returns the secret stored for account
+func Get(account string) (string, error) {
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	if r, ok := cache[account]; ok {
+		return r.secret, r.err
+	}
+	secret, err := get(account)
+	cache[account] = lookupResult{secret, err}
+	return secret, err
+}
+
+// Set stores secret for account, replacing any existing one
+func Set(account, secret string) error {
+	if err := set(account, secret); err != nil {
+		return err
+	}
+	cacheMu.Lock()
+	cache[account] = lookupResult{secret: secret}
+	cacheMu.Unlock()
+	return nil
+}
+
+// Delete removes the secret stored for account
+func Delete(account string) error {
+	if err := del(account); err != nil {
+		return err
+	}
+	cacheMu.Lock()
+	cache[account] = lookupResult{err: ErrNotFound}
+	cacheMu.Unlock()
+	return nil
+}
@@ -0,0 +1,65 @@
+package keyring
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// securityNotFound is the exit status of security(1) when no item matches
+const securityNotFound = 44
+
+// get reads a generic password from the login keychain
+func get(account string) (string, error) {
+	out, err := exec.Command("security", "find-generic-password", "-s", Service, "-a", account, "-w").Output()
+	if err != nil {
+		return "", securityError(err)
+	}
+	return strings.TrimRight(string(out), "\n"), nil
+}
+
+// securityLineMax is the longest command line security -i reads
+const securityLineMax = 4096
+
+// set adds or updates a generic password in the login keychain. The command
+// goes to security -i on stdin, with the secret hex-encoded, so the secret
+// never appears in the process list.
+func set(account, secret string) error {
+	if strings.ContainsAny(account, "\"\\\n") {
+		return fmt.Errorf("invalid keychain account %q", account)
+	}
+	command := fmt.Sprintf("add-generic-password -U -s \"%s\" -a \"%s\" -X %s\n", Service, account, hex.EncodeToString([]byte(secret)))
+	if len(command) > securityLineMax {
+		return errors.New("failed to store secret in keychain: the secret is too long")
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.Command("security", "-i")
+	cmd.Stdin = strings.NewReader(command)
+	cmd.Stderr = &stderr
+	// security -i may exit 0 after a command fails, leaving only its message
+	if err := cmd.Run(); err != nil || stderr.Len() > 0 {
+		return fmt.Errorf("failed to store secret in keychain: %s", strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// del removes a generic password from the login keychain
+func del(account string) error {
+	if err := exec.Command("security", "delete-generic-password", "-s", Service, "-a", account).Run(); err != nil {
+		return securityError(err)
+	}
+	return nil
+}
+
+// securityError maps security(1)'s "item not found" exit status to ErrNotFound
+func securityError(err error) error {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == securityNotFound {
+		return ErrNotFound
+	}
+	return fmt.Errorf("failed to access keychain: %w", err)
+}
@@ -0,0 +1,69 @@
+//go:build !darwin && !windows
+
+package keyring
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// The Secret Service is reached through secret-tool(1) from libsecret, which
+// works with GNOME Keyring, KWallet and KeePassXC alike
+
+// get looks up the secret stored for account
+func get(account string) (string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("secret-tool", "lookup", "service", Service, "account", account)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		// secret-tool exits 1 without output when nothing matches
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && stderr.Len() == 0 {
+			return "", ErrNotFound
+		}
+		return "", secretToolError(err, stderr.String())
+	}
+	return strings.TrimRight(string(out), "\n"), nil
+}
+
+// set stores secret for account; secret-tool reads it from stdin so it never
+// appears in the process list
+func set(account, secret string) error {
+	var stderr bytes.Buffer
+	cmd := exec.Command("secret-tool", "store", "--label", Service+" "+account+" API key", "service", Service, "account", account)
+	cmd.Stdin = strings.NewReader(secret)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return secretToolError(err, stderr.String())
+	}
+	return nil
+}
+
+// del removes the secret stored for account
+func del(account string) error {
+	if _, err := get(account); err != nil {
+		return err
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command("secret-tool", "clear", "service", Service, "account", account)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return secretToolError(err, stderr.String())
+	}
+	return nil
+}
+
+// secretToolError explains a failed secret-tool invocation
+func secretToolError(err error, stderr string) error {
+	if errors.Is(err, exec.ErrNotFound) {
+		return fmt.Errorf("secret-tool not found; install libsecret-tools to use the keyring")
+	}
+	if msg := strings.TrimSpace(stderr); msg != "" {
+		return fmt.Errorf("failed to access keyring: %s", msg)
+	}
+	return fmt.Errorf("failed to access keyring: %w", err)
+}
@@ -0,0 +1,594 @@
+// Package lineedit reads lines from a terminal with editing, history and
+// reverse search. When the input isn't a terminal, lines are read as is.
+// Full-screen interfaces share its history and completion.
+package lineedit
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// ErrInterrupt is returned by ReadLine when the user presses Ctrl+C
+var ErrInterrupt = errors.New("interrupted")
+
+// maxHistory caps the entries kept in memory and loaded from the history file
+const maxHistory = 1000
+
+// Key codes
+const (
+	keyCtrlA     = 1
+	keyCtrlB     = 2
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyCtrlF     = 6
+	keyCtrlG     = 7
+	keyBackspace = 8
+	keyTab       = 9
+	keyCtrlK     = 11
+	keyCtrlL     = 12
+	keyEnter     = 13
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlR     = 18
+	keyCtrlU     = 21
+	keyCtrlW     = 23
+	keyEscape    = 27
+	keyDelete    = 127
+)
+
+// Editor reads lines with editing and history on a terminal
+type Editor struct {
+	in       *os.File
+	reader   *bufio.Reader
+	out      io.Writer
+	terminal bool
+	cooked   bool // Set by DisableEditing
+
+	history     []string
+	historyFile string // Appended to by AddHistory; empty disables it
+
+	completer Completer // Tab completion; nil inserts a tab
+
+	mu sync.Mutex // Held while reading, so Watch yields the input to ReadLine
+}
+
+// Completer returns the completions of the word being typed, the text after
+// the last space in line. line is the input before the cursor.
+type Completer func(line string) []string
+
+// SetCompleter enables Tab completion with complete
+func (e *Editor) SetCompleter(complete Completer) {
+	e.completer = complete
+}
+
+// New creates an editor reading from in and echoing to out. Line editing is
+// used only when in is a terminal.
+func New(in *os.File, out io.Writer) *Editor {
+	info, err := in.Stat()
+	return &Editor{
+		in:       in,
+		reader:   bufio.NewReader(in),
+		out:      out,
+		terminal: err == nil && info.Mode()&os.ModeCharDevice != 0,
+	}
+}
+
+// DisableEditing leaves editing to the terminal, as when the input isn't
+// one, so ReadLine doesn't redraw the line on every key. History and
+// completion are then unavailable.
+func (e *Editor) DisableEditing() {
+	e.cooked = true
+}
+
+// LoadHistory reads previous entries from path, one per line, and appends
+// new entries to it from now on. A missing file is not an error.
+func (e *Editor) LoadHistory(path string) error {
+	e.historyFile = path
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read history: %w", err)
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		if line != "" {
+			e.history = append(e.history, line)
+		}
+	}
+	if len(e.history) > maxHistory {
+		e.history = e.history[len(e.history)-maxHistory:]
+		// Compact the file so it doesn't grow without bound
+		content := strings.Join(e.history, "\n") + "\n"
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			return fmt.Errorf("failed to compact history: %w", err)
+		}
+	}
+	return nil
+}
+
+// History returns the entries recorded for Up/Down, oldest first
+func (e *Editor) History() []string {
+	return slices.Clone(e.history)
+}
+
+// AddHistory records a line for Up/Down and Ctrl+R, skipping blank lines and
+// immediate repeats, and appends it to the history file
+func (e *Editor) AddHistory(line string) error {
+	if strings.TrimSpace(line) == "" || strings.ContainsAny(line, "\r\n") {
+		return nil
+	}
+	if n := len(e.history); n > 0 && e.history[n-1] == line {
+		return nil
+	}
+	e.history = append(e.history, line)
+	if len(e.history) > maxHistory {
+		e.history = e.history[1:]
+	}
+
+	if e.historyFile == "" {
+		return nil
+	}
+	f, err := os.OpenFile(e.historyFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open history: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(line + "\n"); err != nil {
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+	return nil
+}
+
+// ReadLine prints prompt and reads one line without its line ending. It
+// returns io.EOF when the input ends (or Ctrl+D on an empty line) and
+// ErrInterrupt, along with the discarded line, on Ctrl+C.
+func (e *Editor) ReadLine(prompt string) (string, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.terminal && !e.cooked {
+		restore, err := rawMode(e.in)
+		if err == nil {
+			defer restore()
+			return e.edit(prompt)
+		}
+		// Without stty (e.g. on Windows) the terminal does the editing
+	}
+
+	fmt.Fprint(e.out, prompt)
+	line, err := e.reader.ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// Watch reads keys typed while the program is busy, such as during a long
+// reply, without echoing them: onEscape is called for Esc and onLine for a
+// line ended with Enter. ReadLine still works meanwhile, for a confirmation
+// say, taking the input until it returns. The returned function stops
+// watching and restores the terminal. Input that isn't a terminal isn't
+// watched, so it is left for the next ReadLine.
+func (e *Editor) Watch(onEscape func(), onLine func(string)) func() {
+	if !e.terminal {
+		return func() {}
+	}
+	saved, err := stty(e.in, "-g")
+	if err != nil {
+		return func() {}
+	}
+	// Reads return after a tenth of a second without input, so ReadLine
+	// can take over in between; Ctrl+C still sends SIGINT
+	if _, err := stty(e.in, "-icanon", "-echo", "min", "0", "time", "1"); err != nil {
+		return func() {}
+	}
+
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		buf := make([]byte, 64)
+		var line []byte
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			e.mu.Lock()
+			n, _ := e.reader.Read(buf)
+			e.mu.Unlock()
+
+			for i := 0; i < n; i++ {
+				switch b := buf[i]; b {
+				case keyEscape:
+					// A lone Esc; the rest of a read starting with it is
+					// an escape sequence, such as an arrow key
+					if i == n-1 {
+						onEscape()
+					}
+					i = n
+				case '\r', '\n':
+					onLine(string(line))
+					line = line[:0]
+				case keyBackspace, keyDelete:
+					if len(line) > 0 {
+						line = line[:len(line)-1]
+					}
+				default:
+					line = append(line, b)
+				}
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-stopped
+		stty(e.in, strings.TrimSpace(saved))
+	}
+}
+
+// rawMode switches the terminal to unbuffered input without echo or signal
+// keys, returning a function that restores the previous settings
+func rawMode(tty *os.File) (func(), error) {
+	saved, err := stty(tty, "-g")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := stty(tty, "-icanon", "-echo", "-isig", "-ixon", "-iexten", "min", "1", "time", "0"); err != nil {
+		return nil, err
+	}
+	return func() {
+		stty(tty, strings.TrimSpace(saved))
+	}, nil
+}
+
+func stty(tty *os.File, args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = tty
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("stty failed: %w", err)
+	}
+	return string(out), nil
+}
+
+// lineState is the line being edited
+type lineState struct {
+	prompt string
+	buf    []rune
+	pos    int // Cursor position in buf
+}
+
+// edit runs the line editor until Enter, Ctrl+C or the end of input
+func (e *Editor) edit(prompt string) (string, error) {
+	s := &lineState{prompt: prompt}
+	histPos := len(e.history)
+	var pending []rune // The unsubmitted line while browsing history
+	e.refresh(s)
+
+	for {
+		r, _, err := e.reader.ReadRune()
+		if err != nil {
+			fmt.Fprint(e.out, "\r\n")
+			if len(s.buf) > 0 {
+				return string(s.buf), nil
+			}
+			return "", err
+		}
+
+		switch r {
+		case keyEnter, '\n':
+			fmt.Fprint(e.out, "\r\n")
+			return string(s.buf), nil
+		case keyCtrlC:
+			fmt.Fprint(e.out, "^C\r\n")
+			return string(s.buf), ErrInterrupt
+		case keyCtrlD:
+			if len(s.buf) == 0 {
+				fmt.Fprint(e.out, "\r\n")
+				return "", io.EOF
+			}
+			s.deleteAt()
+		case keyCtrlA:
+			s.pos = 0
+		case keyCtrlE:
+			s.pos = len(s.buf)
+		case keyCtrlB:
+			s.left()
+		case keyCtrlF:
+			s.right()
+		case keyBackspace, keyDelete:
+			s.backspace()
+		case keyCtrlU:
+			s.buf = append([]rune(nil), s.buf[s.pos:]...)
+			s.pos = 0
+		case keyCtrlW:
+			s.deleteWord()
+		case keyCtrlL:
+			fmt.Fprint(e.out, "\x1b[H\x1b[2J")
+		case keyTab:
+			if e.completer == nil {
+				s.insert(r)
+				break
+			}
+			e.complete(s)
+		case keyCtrlP:
+			histPos, pending = e.browse(s, histPos, -1, pending)
+		case keyCtrlN:
+			histPos, pending = e.browse(s, histPos, 1, pending)
+		case keyCtrlR:
+			line, accept, err := e.search(s)
+			if err != nil {
+				return line, err
+			}
+			if accept {
+				fmt.Fprint(e.out, "\r\n")
+				return line, nil
+			}
+		case keyEscape:
+			switch e.readEscape() {
+			case "[A", "OA":
+				histPos, pending = e.browse(s, histPos, -1, pending)
+			case "[B", "OB":
+				histPos, pending = e.browse(s, histPos, 1, pending)
+			case "[C", "OC":
+				s.right()
+			case "[D", "OD":
+				s.left()
+			case "[H", "OH", "[1~", "[7~":
+				s.pos = 0
+			case "[F", "OF", "[4~", "[8~":
+				s.pos = len(s.buf)
+			case "[3~":
+				s.deleteAt()
+			}
+		default:
+			// Ctrl+K is kept in the line; the caller treats it as a hotkey
+			if r >= ' ' || r == keyCtrlK {
+				s.insert(r)
+			}
+		}
+		e.refresh(s)
+	}
+}
+
+// complete extends the word before the cursor as far as all completions
+// agree, listing them when that doesn't add anything
+func (e *Editor) complete(s *lineState) {
+	insert, candidates := Complete(e.completer, string(s.buf[:s.pos]))
+	for _, r := range insert {
+		s.insert(r)
+	}
+	switch {
+	case len(candidates) == 0:
+		fmt.Fprint(e.out, "\a")
+	case insert == "":
+		fmt.Fprintf(e.out, "\r\n%s\r\n", strings.Join(candidates, "  "))
+	}
+}
+
+// Complete extends the last word of head, the input before the cursor, as
+// far as all its completions agree. It returns the text to insert, empty
+// when that adds nothing, and the completions.
+func Complete(complete Completer, head string) (string, []string) {
+	word := head[strings.LastIndex(head, " ")+1:]
+	candidates := complete(head)
+	if len(candidates) == 0 {
+		return "", nil
+	}
+
+	prefix := candidates[0]
+	for _, c := range candidates[1:] {
+		for !strings.HasPrefix(c, prefix) {
+			_, size := utf8.DecodeLastRuneInString(prefix)
+			prefix = prefix[:len(prefix)-size]
+		}
+	}
+	if len(candidates) == 1 {
+		prefix += " "
+	}
+	if len(prefix) > len(word) && strings.HasPrefix(prefix, word) {
+		return prefix[len(word):], candidates
+	}
+	return "", candidates
+}
+
+// readEscape reads the rest of an escape sequence such as "[A" or "[3~"
+func (e *Editor) readEscape() string {
+	first, _, err := e.reader.ReadRune()
+	if err != nil || (first != '[' && first != 'O') {
+		return ""
+	}
+	seq := []rune{first}
+	for {
+		r, _, err := e.reader.ReadRune()
+		if err != nil {
+			return ""
+		}
+		seq = append(seq, r)
+		// Parameters are digits and ';'; anything else ends the sequence
+		if (r < '0' || r > '9') && r != ';' {
+			return string(seq)
+		}
+	}
+}
+
+// browse moves through history by step, keeping the unsubmitted line so
+// coming back down restores it
+func (e *Editor) browse(s *lineState, histPos, step int, pending []rune) (int, []rune) {
+	next := histPos + step
+	if next < 0 || next > len(e.history) {
+		return histPos, pending
+	}
+	if histPos == len(e.history) {
+		pending = append([]rune(nil), s.buf...)
+	}
+	if next == len(e.history) {
+		s.buf = append([]rune(nil), pending...)
+	} else {
+		s.buf = []rune(e.history[next])
+	}
+	s.pos = len(s.buf)
+	return next, pending
+}
+
+// search runs Ctrl+R reverse incremental search. Enter accepts the match as
+// the submitted line; Escape or an editing key keeps it in the buffer for
+// editing; Ctrl+G restores the original line.
+func (e *Editor) search(s *lineState) (string, bool, error) {
+	original := append([]rune(nil), s.buf...)
+	var query []rune
+	match := len(e.history)
+	failed := false
+
+	find := func(from int) {
+		for i := from; i >= 0; i-- {
+			if strings.Contains(e.history[i], string(query)) {
+				match, failed = i, false
+				s.buf = []rune(e.history[i])
+				s.pos = len(s.buf)
+				return
+			}
+		}
+		failed = true
+	}
+
+	for {
+		label := "reverse-i-search"
+		if failed {
+			label = "failing reverse-i-search"
+		}
+		e.refresh(&lineState{
+			prompt: fmt.Sprintf("(%s)`%s': ", label, string(query)),
+			buf:    s.buf,
+			pos:    s.pos,
+		})
+
+		r, _, err := e.reader.ReadRune()
+		if err != nil {
+			return "", false, err
+		}
+		switch r {
+		case keyEnter, '\n':
+			return string(s.buf), true, nil
+		case keyCtrlC:
+			fmt.Fprint(e.out, "^C\r\n")
+			return string(s.buf), false, ErrInterrupt
+		case keyCtrlG:
+			s.buf = original
+			s.pos = len(s.buf)
+			return "", false, nil
+		case keyCtrlR:
+			if match > 0 {
+				find(match - 1)
+			}
+		case keyBackspace, keyDelete:
+			if len(query) > 0 {
+				query = query[:len(query)-1]
+				find(len(e.history) - 1)
+			}
+		case keyEscape:
+			e.readEscape()
+			return "", false, nil
+		default:
+			if r < ' ' {
+				return "", false, nil
+			}
+			query = append(query, r)
+			// A longer query can still match the current entry
+			find(min(match, len(e.history)-1))
+		}
+	}
+}
+
+// refresh redraws the prompt and line and places the cursor
+func (e *Editor) refresh(s *lineState) {
+	var b strings.Builder
+	b.WriteString("\r")
+	b.WriteString(s.prompt)
+	for _, r := range s.buf {
+		b.WriteString(display(r))
+	}
+	b.WriteString("\x1b[K")
+	if back := width(s.buf[s.pos:]); back > 0 {
+		fmt.Fprintf(&b, "\x1b[%dD", back)
+	}
+	fmt.Fprint(e.out, b.String())
+}
+
+// display returns how a rune is shown: control characters as ^X
+func display(r rune) string {
+	switch {
+	case r == '\t':
+		return " "
+	case r < ' ':
+		return "^" + string(r+'@')
+	}
+	return string(r)
+}
+
+// width returns the number of columns runes take on screen
+func width(runes []rune) int {
+	n := 0
+	for _, r := range runes {
+		n += utf8.RuneCountInString(display(r))
+	}
+	return n
+}
+
+func (s *lineState) insert(r rune) {
+	s.buf = append(s.buf, 0)
+	copy(s.buf[s.pos+1:], s.buf[s.pos:])
+	s.buf[s.pos] = r
+	s.pos++
+}
+
+func (s *lineState) backspace() {
+	if s.pos == 0 {
+		return
+	}
+	s.buf = append(s.buf[:s.pos-1], s.buf[s.pos:]...)
+	s.pos--
+}
+
+func (s *lineState) deleteAt() {
+	if s.pos < len(s.buf) {
+		s.buf = append(s.buf[:s.pos], s.buf[s.pos+1:]...)
+	}
+}
+
+func (s *lineState) left() {
+	if s.pos > 0 {
+		s.pos--
+	}
+}
+
+func (s *lineState) right() {
+	if s.pos < len(s.buf) {
+		s.pos++
+	}
+}
+
+// deleteWord deletes the word before the cursor, like Ctrl+W in a shell
+func (s *lineState) deleteWord() {
+	start := s.pos
+	for start > 0 && s.buf[start-1] == ' ' {
+		start--
+	}
+	for start > 0 && s.buf[start-1] != ' ' {
+		start--
+	}
+	s.buf = append(s.buf[:start], s.buf[s.pos:]...)
+	s.pos = start
+}
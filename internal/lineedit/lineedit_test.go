@@ -0,0 +1,299 @@
+package lineedit
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// Escape sequences sent by a terminal's arrow and editing keys
+const (
+	up    = "\x1b[A"
+	down  = "\x1b[B"
+	left  = "\x1b[D"
+	right = "\x1b[C"
+	home  = "\x1b[H"
+	end   = "\x1b[F"
+	del   = "\x1b[3~"
+)
+
+// fakeTerminal is an editor reading keys as typed in raw mode, so edit
+// can be driven without a terminal
+func fakeTerminal(keys string, history ...string) (*Editor, *strings.Builder) {
+	var out strings.Builder
+	return &Editor{
+		reader:   bufio.NewReader(strings.NewReader(keys)),
+		out:      &out,
+		terminal: true,
+		history:  history,
+	}, &out
+}
+
+func TestEditKeys(t *testing.T) {
+	tests := []struct {
+		name string
+		keys string
+		want string
+	}{
+		{"enter", "hello\r", "hello"},
+		{"newline", "hello\n", "hello"},
+		{"insert after left", "helo" + left + "l\r", "hello"},
+		{"left stops at start", "ab" + left + left + left + "x\r", "xab"},
+		{"right stops at end", "ab" + right + "c\r", "abc"},
+		{"ctrl+a and ctrl+e", "bc\x01a\x05d\r", "abcd"},
+		{"ctrl+b and ctrl+f", "ac\x02b\x06d\r", "abcd"},
+		{"home and end", "bc" + home + "a" + end + "d\r", "abcd"},
+		{"backspace", "abx\x7fc\r", "abc"},
+		{"ctrl+h", "abx\x08c\r", "abc"},
+		{"backspace at start", "a\x01\x7f\r", "a"},
+		{"delete under cursor", "abc" + home + del + "\r", "bc"},
+		{"ctrl+d under cursor", "abc\x01\x04\r", "bc"},
+		{"ctrl+u", "one two" + left + left + left + "\x15\r", "two"},
+		{"ctrl+w", "one two  \x17\r", "one "},
+		{"ctrl+w at start", "one\x01\x17\r", "one"},
+		{"ctrl+k is kept", "a\x0b\r", "a\x0b"},
+		{"other control keys dropped", "a\x1a\x1cb\r", "ab"},
+		{"unknown escape ignored", "a\x1b[5~b\r", "ab"},
+		{"multibyte runes", "héllo" + left + "\x7f\r", "hélo"},
+		{"tab without completer", "a\tb\r", "a\tb"},
+		{"end of input keeps the line", "partial", "partial"},
+	}
+	for _, tt := range tests {
+		e, _ := fakeTerminal(tt.keys)
+		got, err := e.edit("> ")
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestEditEndings(t *testing.T) {
+	e, out := fakeTerminal("typed\x03")
+	line, err := e.edit("> ")
+	if !errors.Is(err, ErrInterrupt) || line != "typed" {
+		t.Errorf("Ctrl+C: got %q, %v; want the discarded line and ErrInterrupt", line, err)
+	}
+	if !strings.HasSuffix(out.String(), "^C\r\n") {
+		t.Errorf("Ctrl+C: output %q doesn't end with ^C", out.String())
+	}
+
+	e, _ = fakeTerminal("\x04")
+	if _, err := e.edit("> "); err != io.EOF {
+		t.Errorf("Ctrl+D on an empty line: err = %v, want io.EOF", err)
+	}
+
+	e, _ = fakeTerminal("")
+	if _, err := e.edit("> "); err != io.EOF {
+		t.Errorf("end of input: err = %v, want io.EOF", err)
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	// Each key redraws the prompt and line, then moves the cursor back
+	// over what follows it; control characters show as ^X
+	e, out := fakeTerminal("ab\x0b" + left + left + "\r")
+	if _, err := e.edit("> "); err != nil {
+		t.Fatal(err)
+	}
+	want := "\r> \x1b[K" +
+		"\r> a\x1b[K" +
+		"\r> ab\x1b[K" +
+		"\r> ab^K\x1b[K" +
+		"\r> ab^K\x1b[K\x1b[2D" +
+		"\r> ab^K\x1b[K\x1b[3D" +
+		"\r\n"
+	if out.String() != want {
+		t.Errorf("output = %q, want %q", out.String(), want)
+	}
+}
+
+func TestHistoryBrowsing(t *testing.T) {
+	history := []string{"first", "second", "third"}
+	tests := []struct {
+		name string
+		keys string
+		want string
+	}{
+		{"up", up + "\r", "third"},
+		{"up twice", up + up + "\r", "second"},
+		{"up stops at oldest", up + up + up + up + "\r", "first"},
+		{"ctrl+p and ctrl+n", "\x10\x10\x0e\r", "third"},
+		{"down restores the unsubmitted line", "draft" + up + up + down + down + "\r", "draft"},
+		{"down past the end", down + "x\r", "x"},
+		{"entries can be edited", up + "\x7f\x7fee\r", "thiee"},
+		{"edits aren't kept", up + "!" + up + down + "\r", "third"},
+	}
+	for _, tt := range tests {
+		e, _ := fakeTerminal(tt.keys, history...)
+		got, err := e.edit("> ")
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestReverseSearch(t *testing.T) {
+	history := []string{"git status", "go test ./...", "git log", "go vet"}
+	tests := []struct {
+		name string
+		keys string
+		want string
+	}{
+		{"enter sends the match", "\x12git\r", "git log"},
+		{"ctrl+r finds older matches", "\x12git\x12\r", "git status"},
+		{"ctrl+r stops at the oldest", "\x12git\x12\x12\x12\r", "git status"},
+		{"longer query narrows", "\x12go t\r", "go test ./..."},
+		{"backspace widens", "\x12go t\x7f\x7f\r", "go vet"},
+		{"arrow key keeps the match for editing", "\x12log" + left + "x\r", "git logx"},
+		{"editing key keeps the match", "\x12vet\x01#\r", "go vet#"},
+		{"ctrl+g restores the line", "draft\x12git\x07!\r", "draft!"},
+		{"no match keeps the line", "draft\x12zzz\x07\r", "draft"},
+	}
+	for _, tt := range tests {
+		e, _ := fakeTerminal(tt.keys, history...)
+		got, err := e.edit("> ")
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	e, out := fakeTerminal("\x12zzz\x03", history...)
+	if _, err := e.edit("> "); !errors.Is(err, ErrInterrupt) {
+		t.Errorf("Ctrl+C in search: err = %v, want ErrInterrupt", err)
+	}
+	if !strings.Contains(out.String(), "(failing reverse-i-search)`zzz': ") {
+		t.Errorf("output %q lacks the failing search prompt", out.String())
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	complete := func(line string) []string {
+		word := line[strings.LastIndex(line, " ")+1:]
+		var matches []string
+		for _, c := range []string{"/help", "/history", "/model", "/models"} {
+			if strings.HasPrefix(c, word) {
+				matches = append(matches, c)
+			}
+		}
+		return matches
+	}
+	tests := []struct {
+		name     string
+		keys     string
+		want     string
+		listed   bool
+		rungBell bool
+	}{
+		{"single match adds a space", "/he\t\r", "/help ", false, false},
+		{"common prefix", "/mo\t\r", "/model", false, false},
+		{"nothing to add lists them", "/h\t\r", "/h", true, false},
+		{"no match rings", "/x\t\r", "/x", false, true},
+		{"completes the word before the cursor", "/he rest" + home + right + right + right + "\t\r", "/help  rest", false, false},
+	}
+	for _, tt := range tests {
+		e, out := fakeTerminal(tt.keys)
+		e.SetCompleter(complete)
+		got, err := e.edit("> ")
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+		if listed := strings.Contains(out.String(), "/help  /history"); listed != tt.listed {
+			t.Errorf("%s: listed = %v, want %v", tt.name, listed, tt.listed)
+		}
+		if rang := strings.Contains(out.String(), "\a"); rang != tt.rungBell {
+			t.Errorf("%s: rang = %v, want %v", tt.name, rang, tt.rungBell)
+		}
+	}
+}
+
+func TestAddHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	e, _ := fakeTerminal("")
+	if err := e.LoadHistory(path); err != nil {
+		t.Fatalf("LoadHistory of a missing file: %v", err)
+	}
+	for _, line := range []string{"one", "one", "", "  ", "two", "multi\nline", "one"} {
+		if err := e.AddHistory(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []string{"one", "two", "one"}
+	if !slices.Equal(e.history, want) {
+		t.Errorf("history = %q, want %q", e.history, want)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "one\ntwo\none\n" {
+		t.Errorf("history file = %q", data)
+	}
+}
+
+func TestLoadHistoryCompacts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	var b strings.Builder
+	for i := range maxHistory + 10 {
+		b.WriteString(strings.Repeat("x", i%7+1) + "\n\n")
+	}
+	if err := os.WriteFile(path, []byte(b.String()), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	e, _ := fakeTerminal("")
+	if err := e.LoadHistory(path); err != nil {
+		t.Fatal(err)
+	}
+	if len(e.history) != maxHistory {
+		t.Errorf("loaded %d entries, want %d", len(e.history), maxHistory)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines != maxHistory {
+		t.Errorf("compacted file has %d lines, want %d", lines, maxHistory)
+	}
+	// The oldest entries are the ones dropped
+	if e.history[0] != strings.Repeat("x", 10%7+1) {
+		t.Errorf("first entry = %q", e.history[0])
+	}
+}
+
+func TestDisableEditing(t *testing.T) {
+	// Keys reach the program as typed, since the terminal edits the line
+	e, out := fakeTerminal("a\x01b" + left + "\r\n")
+	e.DisableEditing()
+	got, err := e.ReadLine("> ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "a\x01b"+left {
+		t.Errorf("got %q, want the keys as typed", got)
+	}
+	if out.String() != "> " {
+		t.Errorf("output = %q, want only the prompt", out.String())
+	}
+}
@@ -3,6 +3,7 @@ package mcp
 import (
 	"context"
 	"fmt"
+	"sort"
 	"sync"
 )
 
@@ -22,6 +23,52 @@ type MCPClient interface {
 
 	// Name returns the client identifier
 	Name() string
+
+	// SetNotificationHandler registers a callback for server notifications
+	SetNotificationHandler(handler NotificationHandler)
+
+	// Ping checks that the server is responsive
+	Ping(ctx context.Context) error
+
+	// ServerInfo returns what the server reported during Initialize
+	ServerInfo() InitializeResult
+
+	// SetLogLevel sets the minimum level of log notifications the server sends
+	SetLogLevel(ctx context.Context, level string) error
+
+	// Diagnostics describes the state of the connection, for debugging hangs
+	Diagnostics() Diagnostics
+}
+
+// Diagnostics describes the state of a client's connection
+type Diagnostics struct {
+	Transport string // stdio, http, sse, websocket or builtin
+	Target    string // Command line or URL of the server
+	PID       int    // Server process ID; stdio only
+	Framing   string // Message framing in use; stdio only
+	Pending   int    // Requests awaiting a response
+	Closed    bool
+	Err       string // Why the connection failed, if it did
+}
+
+// serverInfo records the initialize result; it is embedded by every client
+type serverInfo struct {
+	mu     sync.RWMutex
+	result InitializeResult
+}
+
+// ServerInfo returns what the server reported during Initialize
+func (s *serverInfo) ServerInfo() InitializeResult {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.result
+}
+
+// setServerInfo stores the initialize result
+func (s *serverInfo) setServerInfo(result InitializeResult) {
+	s.mu.Lock()
+	s.result = result
+	s.mu.Unlock()
 }
 
 // Tool represents an MCP tool/function available for invocation
@@ -30,6 +77,33 @@ type Tool struct {
 	Description string                 // Tool description
 	InputSchema map[string]interface{} // JSON Schema for input parameters
 	ServerName  string                 // Which server provides this tool
+	Annotations *ToolAnnotations       // The server's hints; nil if it gave none
+}
+
+// Permission tiers of tools, from least to most dangerous
+const (
+	TierRead        = "read"        // Only reads
+	TierWrite       = "write"       // Changes things, but only additively
+	TierDestructive = "destructive" // May delete or overwrite
+)
+
+// Tiers lists the permission tiers
+var Tiers = []string{TierRead, TierWrite, TierDestructive}
+
+// Tier classifies the tool by its annotations: read-only tools are TierRead,
+// tools declared not destructive TierWrite, and all others TierDestructive
+func (t Tool) Tier() string {
+	a := t.Annotations
+	switch {
+	case a == nil:
+		return TierDestructive
+	case a.ReadOnlyHint != nil && *a.ReadOnlyHint:
+		return TierRead
+	case a.DestructiveHint != nil && !*a.DestructiveHint:
+		return TierWrite
+	default:
+		return TierDestructive
+	}
 }
 
 // ClientRegistry manages multiple MCP clients
@@ -60,7 +134,16 @@ func (r *ClientRegistry) Get(name string) (MCPClient, bool) {
 	return client, ok
 }
 
-// All returns all registered clients
+// Unregister removes a client from the registry without closing it
+func (r *ClientRegistry) Unregister(name string) (MCPClient, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	client, ok := r.clients[name]
+	delete(r.clients, name)
+	return client, ok
+}
+
+// All returns all registered clients, sorted by name
 func (r *ClientRegistry) All() []MCPClient {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
@@ -68,6 +151,7 @@ func (r *ClientRegistry) All() []MCPClient {
 	for _, client := range r.clients {
 		clients = append(clients, client)
 	}
+	sort.Slice(clients, func(i, j int) bool { return clients[i].Name() < clients[j].Name() })
 	return clients
 }
 
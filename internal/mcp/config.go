@@ -0,0 +1,223 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Transport types for ServerConfig.Type
+const (
+	TransportStdio     = "stdio"
+	TransportHTTP      = "http"
+	TransportWebSocket = "websocket"
+	TransportSSE       = "sse" // Legacy HTTP+SSE transport (2024-11-05)
+)
+
+// ServerConfig describes how to reach one MCP server. Local servers set
+// Command (plus optional Args, Env and Cwd); remote servers set URL.
+type ServerConfig struct {
+	Name       string            `json:"-" yaml:"-"`
+	Type       string            `json:"type,omitempty" yaml:"type,omitempty"` // Transport; inferred when empty
+	Command    string            `json:"command,omitempty" yaml:"command,omitempty"`
+	Args       []string          `json:"args,omitempty" yaml:"args,omitempty"`
+	Env        map[string]string `json:"env,omitempty" yaml:"env,omitempty"`
+	InheritEnv bool              `json:"inheritEnv,omitempty" yaml:"inheritEnv,omitempty"` // Pass our whole environment, not just baseEnvVars
+	Cwd        string            `json:"cwd,omitempty" yaml:"cwd,omitempty"`
+	Framing    string            `json:"framing,omitempty" yaml:"framing,omitempty"` // Stdio message framing; detected when empty
+	URL        string            `json:"url,omitempty" yaml:"url,omitempty"`
+	Sandbox    *Sandbox          `json:"sandbox,omitempty" yaml:"sandbox,omitempty"` // Limits of a local server's process
+	TLS        *TLSConfig        `json:"tls,omitempty" yaml:"tls,omitempty"`         // Certificate checks of a remote server
+}
+
+// baseEnvVars are the variables every local server gets from our
+// environment; anything else (API keys in particular) must be listed in Env
+var baseEnvVars = []string{
+	"PATH", "HOME", "USER", "LOGNAME", "SHELL", "LANG", "LC_ALL", "LC_CTYPE", "TERM", "TMPDIR", "TZ",
+	"SYSTEMROOT", "WINDIR", "COMSPEC", "PATHEXT", "TEMP", "TMP", "USERPROFILE", "APPDATA", "LOCALAPPDATA",
+}
+
+// Environ returns the environment for a local server: the base variables
+// (our whole environment with InheritEnv, only PATH in a sandbox with
+// CleanEnv) plus Env, whose values may reference our environment as ${VAR}
+func (c ServerConfig) Environ() []string {
+	var env []string
+	if c.InheritEnv {
+		env = os.Environ()
+	} else if c.Sandbox != nil && c.Sandbox.CleanEnv {
+		if path, ok := os.LookupEnv("PATH"); ok {
+			env = append(env, "PATH="+path)
+		}
+	} else {
+		for _, key := range baseEnvVars {
+			if value, ok := os.LookupEnv(key); ok {
+				env = append(env, key+"="+value)
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(c.Env))
+	for key := range c.Env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		env = append(env, key+"="+os.ExpandEnv(c.Env[key]))
+	}
+	return env
+}
+
+// IsRemote reports whether the server is reached over the network
+func (c ServerConfig) IsRemote() bool {
+	return c.URL != ""
+}
+
+// TransportType returns the configured transport, inferring it from the
+// command or URL when Type is empty: ws(s):// URLs use WebSocket, URLs whose
+// path ends in /sse use the legacy SSE transport, other URLs use HTTP
+func (c ServerConfig) TransportType() string {
+	if c.Type != "" {
+		return c.Type
+	}
+	switch {
+	case !c.IsRemote():
+		return TransportStdio
+	case strings.HasPrefix(c.URL, "ws://") || strings.HasPrefix(c.URL, "wss://"):
+		return TransportWebSocket
+	case strings.HasSuffix(strings.TrimSuffix(strings.SplitN(c.URL, "?", 2)[0], "/"), "/sse"):
+		return TransportSSE
+	default:
+		return TransportHTTP
+	}
+}
+
+// serversFile is the on-disk layout, compatible with Claude Desktop's
+// claude_desktop_config.json
+type serversFile struct {
+	MCPServers map[string]ServerConfig `json:"mcpServers" yaml:"mcpServers"`
+}
+
+// LoadServerConfigs reads MCP server definitions from a JSON or YAML file
+// (chosen by extension), returning them sorted by name
+func LoadServerConfigs(path string) ([]ServerConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read MCP config: %w", err)
+	}
+
+	var file serversFile
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.UnmarshalStrict(data, &file)
+	default:
+		err = json.Unmarshal(data, &file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse MCP config %s: %w", path, err)
+	}
+
+	// Relative working directories are resolved against the config file
+	return NamedServers(file.MCPServers, filepath.Dir(path))
+}
+
+// NamedServers validates servers keyed by name, resolving relative working
+// directories against baseDir, and returns them sorted by name
+func NamedServers(byName map[string]ServerConfig, baseDir string) ([]ServerConfig, error) {
+	servers := make([]ServerConfig, 0, len(byName))
+	for name, server := range byName {
+		server.Name = name
+		if err := server.validate(); err != nil {
+			return nil, err
+		}
+		if server.Sandbox != nil && server.Sandbox.Chroot != "" && !filepath.IsAbs(server.Sandbox.Chroot) {
+			sandbox := *server.Sandbox
+			sandbox.Chroot = filepath.Join(baseDir, sandbox.Chroot)
+			server.Sandbox = &sandbox
+		} else if server.Cwd != "" && !filepath.IsAbs(server.Cwd) {
+			server.Cwd = filepath.Join(baseDir, server.Cwd)
+		}
+		if server.TLS != nil && server.TLS.CAFile != "" && !filepath.IsAbs(server.TLS.CAFile) {
+			tlsConfig := *server.TLS
+			tlsConfig.CAFile = filepath.Join(baseDir, tlsConfig.CAFile)
+			server.TLS = &tlsConfig
+		}
+		servers = append(servers, server)
+	}
+	sort.Slice(servers, func(i, j int) bool {
+		return servers[i].Name < servers[j].Name
+	})
+	return servers, nil
+}
+
+// validate checks that exactly one way of reaching the server is configured
+func (c ServerConfig) validate() error {
+	switch {
+	case c.Name == "":
+		return fmt.Errorf("MCP server with empty name")
+	case c.Command == "" && c.URL == "":
+		return fmt.Errorf("MCP server %s: either command or url is required", c.Name)
+	case c.Command != "" && c.URL != "":
+		return fmt.Errorf("MCP server %s: command and url are mutually exclusive", c.Name)
+	case c.URL != "" && (len(c.Args) > 0 || len(c.Env) > 0 || c.InheritEnv || c.Cwd != "" || c.Framing != "" || c.Sandbox != nil):
+		return fmt.Errorf("MCP server %s: args, env, inheritEnv, cwd, framing and sandbox only apply to local servers", c.Name)
+	}
+	if c.Sandbox != nil {
+		if err := c.Sandbox.validate(c); err != nil {
+			return err
+		}
+	}
+	if c.TLS != nil {
+		if c.URL == "" {
+			return fmt.Errorf("MCP server %s: tls only applies to remote servers", c.Name)
+		}
+		if err := c.TLS.validate(c.Name); err != nil {
+			return err
+		}
+	}
+
+	switch c.Framing {
+	case FramingAuto, FramingNewline, FramingContentLength:
+	default:
+		return fmt.Errorf("MCP server %s: unknown framing %q", c.Name, c.Framing)
+	}
+
+	switch c.Type {
+	case "":
+	case TransportStdio:
+		if c.Command == "" {
+			return fmt.Errorf("MCP server %s: type %s requires a command", c.Name, c.Type)
+		}
+	case TransportHTTP, TransportWebSocket, TransportSSE:
+		if c.URL == "" {
+			return fmt.Errorf("MCP server %s: type %s requires a url", c.Name, c.Type)
+		}
+	default:
+		return fmt.Errorf("MCP server %s: unknown type %q", c.Name, c.Type)
+	}
+	return nil
+}
+
+// LegacyLocalServer converts an --mcp-local entry ("script.py" or
+// "/path/to/python script.py") into a server config named after the entry.
+// Legacy servers keep inheriting our whole environment.
+func LegacyLocalServer(spec string) (ServerConfig, error) {
+	parts := strings.Fields(spec)
+	switch len(parts) {
+	case 0:
+		return ServerConfig{}, fmt.Errorf("empty script path")
+	case 1:
+		return ServerConfig{Name: spec, Command: "python3", Args: parts, InheritEnv: true}, nil
+	default:
+		return ServerConfig{Name: spec, Command: parts[0], Args: parts[1:], InheritEnv: true}, nil
+	}
+}
+
+// LegacyRemoteServer converts an --mcp-remote URL into a server config
+func LegacyRemoteServer(url string) ServerConfig {
+	return ServerConfig{Name: url, URL: url}
+}
@@ -0,0 +1,134 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Message framings for stdio servers (ServerConfig.Framing)
+const (
+	FramingAuto          = ""               // Newline-delimited until the server sends a Content-Length frame
+	FramingNewline       = "newline"        // One JSON message per line
+	FramingContentLength = "content-length" // LSP-style "Content-Length: N" headers
+)
+
+// maxMessageSize bounds a single message from a stdio server. Tool results
+// can be large (file contents, search results), far beyond bufio.Scanner's
+// 64 KiB default.
+const maxMessageSize = 64 << 20
+
+// frameReader reads JSON-RPC messages from a stdio server, detecting per
+// message whether it is newline-delimited or has Content-Length headers
+type frameReader struct {
+	r *bufio.Reader
+}
+
+// newFrameReader wraps a server's stdout
+func newFrameReader(r io.Reader) *frameReader {
+	return &frameReader{r: bufio.NewReaderSize(r, 64*1024)}
+}
+
+// next returns the next message and whether it was Content-Length framed
+func (f *frameReader) next() ([]byte, bool, error) {
+	for {
+		line, err := f.readLine()
+		if err != nil {
+			return nil, false, err
+		}
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		if !isHeader(line) {
+			return line, false, nil
+		}
+
+		length, err := f.readHeaders(line)
+		if err != nil {
+			return nil, false, err
+		}
+		body := make([]byte, length)
+		if _, err := io.ReadFull(f.r, body); err != nil {
+			return nil, false, fmt.Errorf("failed to read framed message: %w", err)
+		}
+		return body, true, nil
+	}
+}
+
+// readHeaders parses a header block starting with first, up to the blank
+// line, returning the Content-Length
+func (f *frameReader) readHeaders(first []byte) (int, error) {
+	length := -1
+	line := first
+	for {
+		name, value, _ := strings.Cut(string(line), ":")
+		if strings.EqualFold(strings.TrimSpace(name), "Content-Length") {
+			n, err := strconv.Atoi(strings.TrimSpace(value))
+			if err != nil || n < 0 {
+				return 0, fmt.Errorf("invalid Content-Length header %q", line)
+			}
+			if n > maxMessageSize {
+				return 0, fmt.Errorf("message of %d bytes exceeds the %d byte limit", n, maxMessageSize)
+			}
+			length = n
+		}
+
+		next, err := f.readLine()
+		if err != nil {
+			return 0, err
+		}
+		line = bytes.TrimRight(next, "\r")
+		if len(line) == 0 {
+			break
+		}
+	}
+	if length < 0 {
+		return 0, fmt.Errorf("framed message without Content-Length header")
+	}
+	return length, nil
+}
+
+// readLine reads one line without its terminator, up to maxMessageSize
+func (f *frameReader) readLine() ([]byte, error) {
+	var line []byte
+	for {
+		chunk, err := f.r.ReadSlice('\n')
+		line = append(line, chunk...)
+		if len(line) > maxMessageSize {
+			return nil, fmt.Errorf("message exceeds the %d byte limit", maxMessageSize)
+		}
+		switch err {
+		case nil:
+			return bytes.TrimRight(line, "\r\n"), nil
+		case bufio.ErrBufferFull:
+			continue
+		case io.EOF:
+			if len(line) > 0 {
+				return line, nil
+			}
+			return nil, err
+		default:
+			return nil, err
+		}
+	}
+}
+
+// isHeader reports whether a line starts an LSP-style header block
+func isHeader(line []byte) bool {
+	name, _, ok := strings.Cut(string(line), ":")
+	name = strings.TrimSpace(name)
+	return ok && (strings.EqualFold(name, "Content-Length") || strings.EqualFold(name, "Content-Type"))
+}
+
+// encodeFrame frames a marshaled message for a stdio server
+func encodeFrame(data []byte, contentLength bool) []byte {
+	if !contentLength {
+		return append(data, '\n')
+	}
+	header := fmt.Sprintf("Content-Length: %d\r\n\r\n", len(data))
+	return append([]byte(header), data...)
+}
@@ -15,6 +15,9 @@ import (
 
 // HTTPClient implements MCPClient for remote MCP servers via HTTP
 type HTTPClient struct {
+	notifier
+	serverInfo
+
 	name       string
 	baseURL    string
 	httpClient *http.Client
@@ -22,17 +25,24 @@ type HTTPClient struct {
 	logger     *slog.Logger
 }
 
-// NewHTTPClient creates a new HTTP-based MCP client for remote servers
-func NewHTTPClient(name string, baseURL string, logger *slog.Logger) (*HTTPClient, error) {
+// NewHTTPClient creates a new HTTP-based MCP client for remote servers.
+// WithTransport replaces how requests are sent, and WithTLS how the server's
+// certificate is checked.
+func NewHTTPClient(name string, baseURL string, logger *slog.Logger, opts ...Option) (*HTTPClient, error) {
 	if logger == nil {
 		return nil, fmt.Errorf("logger cannot be nil")
 	}
 
+	transport, err := newOptions(opts).httpTransport()
+	if err != nil {
+		return nil, fmt.Errorf("MCP server %s: %w", name, err)
+	}
 	client := &HTTPClient{
 		name:    name,
 		baseURL: baseURL,
 		httpClient: &http.Client{
-			Timeout: 0, // No timeout for SSE streams
+			Timeout:   0, // No timeout for SSE streams
+			Transport: transport,
 		},
 		reqID:  0,
 		logger: logger,
@@ -66,6 +76,7 @@ func (c *HTTPClient) Initialize(ctx context.Context) error {
 	if err := c.sendRequest(ctx, MethodInitialize, params, &result); err != nil {
 		return fmt.Errorf("initialize failed: %w", err)
 	}
+	c.setServerInfo(result)
 
 	c.logger.Info("MCP server initialized",
 		"server", result.ServerInfo.Name,
@@ -77,7 +88,7 @@ func (c *HTTPClient) Initialize(ctx context.Context) error {
 // ListTools returns available tools from this MCP server
 func (c *HTTPClient) ListTools(ctx context.Context) ([]Tool, error) {
 	var result ListToolsResult
-	if err := c.sendRequest(ctx, MethodListTools, nil, &result); err != nil {
+	if err := c.sendRequest(ctx, MethodListTools, listToolsParams(ctx), &result); err != nil {
 		return nil, fmt.Errorf("list tools failed: %w", err)
 	}
 
@@ -88,6 +99,7 @@ func (c *HTTPClient) ListTools(ctx context.Context) ([]Tool, error) {
 			Description: toolInfo.Description,
 			InputSchema: toolInfo.InputSchema,
 			ServerName:  c.name,
+			Annotations: toolInfo.Annotations,
 		}
 	}
 
@@ -100,6 +112,7 @@ func (c *HTTPClient) CallTool(ctx context.Context, toolName string, args map[str
 	params := CallToolParams{
 		Name:      toolName,
 		Arguments: args,
+		Meta:      requestMeta(ctx),
 	}
 
 	var result CallToolResult
@@ -111,6 +124,28 @@ func (c *HTTPClient) CallTool(ctx context.Context, toolName string, args map[str
 	return result, nil
 }
 
+// Ping checks that the server is responsive
+func (c *HTTPClient) Ping(ctx context.Context) error {
+	if err := c.sendRequest(ctx, MethodPing, nil, nil); err != nil {
+		return fmt.Errorf("ping failed: %w", err)
+	}
+	return nil
+}
+
+// SetLogLevel sets the minimum level of log notifications the server sends
+func (c *HTTPClient) SetLogLevel(ctx context.Context, level string) error {
+	if err := c.sendRequest(ctx, MethodSetLevel, SetLevelParams{Level: level}, nil); err != nil {
+		return fmt.Errorf("set log level failed: %w", err)
+	}
+	return nil
+}
+
+// Diagnostics describes the HTTP endpoint; requests are not multiplexed, so
+// nothing is pending between calls
+func (c *HTTPClient) Diagnostics() Diagnostics {
+	return Diagnostics{Transport: TransportHTTP, Target: c.baseURL}
+}
+
 // Close disconnects from the MCP server
 func (c *HTTPClient) Close() error {
 	c.logger.Info("closed MCP HTTP client", "name", c.name)
@@ -201,7 +236,9 @@ func (c *HTTPClient) sendRequest(ctx context.Context, method string, params inte
 	return nil
 }
 
-// parseSSEResponse parses Server-Sent Events (SSE) format and extracts JSON data
+// parseSSEResponse parses Server-Sent Events (SSE) format and extracts the
+// JSON-RPC response. Notifications sent on the stream ahead of the response
+// are dispatched to the notification handler.
 // SSE format:
 //
 //	event: message
@@ -210,11 +247,31 @@ func (c *HTTPClient) parseSSEResponse(body io.Reader) ([]byte, error) {
 	scanner := bufio.NewScanner(body)
 	var dataLines []string
 
+	// handleEvent returns the event data if it holds the response
+	handleEvent := func() []byte {
+		if len(dataLines) == 0 {
+			return nil
+		}
+		// Join all data lines (in case data is split across multiple lines)
+		data := []byte(strings.Join(dataLines, "\n"))
+		dataLines = nil
+
+		var msg jsonrpcMessage
+		if err := json.Unmarshal(data, &msg); err == nil && msg.isNotification() {
+			c.dispatch(c.logger, c.name, msg)
+			return nil
+		}
+		return data
+	}
+
 	for scanner.Scan() {
 		line := scanner.Text()
 
-		// Skip empty lines and event lines
-		if line == "" || strings.HasPrefix(line, "event:") {
+		// An empty line terminates the current event
+		if line == "" {
+			if data := handleEvent(); data != nil {
+				return data, nil
+			}
 			continue
 		}
 
@@ -229,10 +286,9 @@ func (c *HTTPClient) parseSSEResponse(body io.Reader) ([]byte, error) {
 		return nil, fmt.Errorf("scanner error: %w", err)
 	}
 
-	if len(dataLines) == 0 {
-		return nil, fmt.Errorf("no data found in SSE response")
+	if data := handleEvent(); data != nil {
+		return data, nil
 	}
 
-	// Join all data lines (in case data is split across multiple lines)
-	return []byte(strings.Join(dataLines, "\n")), nil
+	return nil, fmt.Errorf("no data found in SSE response")
 }
@@ -0,0 +1,45 @@
+package mcp
+
+import (
+	"encoding/json"
+	"log/slog"
+)
+
+// LogLevels are the MCP (syslog) log levels, least severe first
+var LogLevels = []string{"debug", "info", "notice", "warning", "error", "critical", "alert", "emergency"}
+
+// ValidLogLevel reports whether level is an MCP log level
+func ValidLogLevel(level string) bool {
+	for _, l := range LogLevels {
+		if l == level {
+			return true
+		}
+	}
+	return false
+}
+
+// SetLevelParams represents parameters for a logging/setLevel request
+type SetLevelParams struct {
+	Level string `json:"level"`
+}
+
+// LoggingMessageParams represents parameters for a notifications/message notification
+type LoggingMessageParams struct {
+	Level  string          `json:"level"`
+	Logger string          `json:"logger,omitempty"`
+	Data   json.RawMessage `json:"data"`
+}
+
+// SlogLevel maps an MCP log level to the nearest slog level
+func SlogLevel(level string) slog.Level {
+	switch level {
+	case "debug":
+		return slog.LevelDebug
+	case "info", "notice":
+		return slog.LevelInfo
+	case "warning":
+		return slog.LevelWarn
+	default:
+		return slog.LevelError
+	}
+}
@@ -0,0 +1,41 @@
+package mcp
+
+import (
+	"log/slog"
+	"sync"
+)
+
+// NotificationHandler receives notifications pushed by an MCP server.
+// It runs on its own goroutine, so it may issue requests on the same client.
+type NotificationHandler func(serverName string, notification JSONRPCNotification)
+
+// notifier holds the notification handler shared by all transports
+type notifier struct {
+	mu      sync.RWMutex
+	handler NotificationHandler
+}
+
+// SetNotificationHandler registers the callback for server notifications
+func (n *notifier) SetNotificationHandler(handler NotificationHandler) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.handler = handler
+}
+
+// dispatch hands a notification to the registered handler, if any
+func (n *notifier) dispatch(logger *slog.Logger, serverName string, msg jsonrpcMessage) {
+	n.mu.RLock()
+	handler := n.handler
+	n.mu.RUnlock()
+
+	logger.Debug("received MCP notification", "server", serverName, "method", msg.Method)
+	if handler == nil {
+		return
+	}
+
+	go handler(serverName, JSONRPCNotification{
+		JSONRPC: msg.JSONRPC,
+		Method:  msg.Method,
+		Params:  msg.Params,
+	})
+}
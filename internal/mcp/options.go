@@ -0,0 +1,126 @@
+package mcp
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+
+	"ExtraChat/internal/clock"
+)
+
+// Option customizes how a client reaches its server, for tests that fake
+// the network, the clock or the server process
+type Option func(*options)
+
+type options struct {
+	transport http.RoundTripper // nil uses http.DefaultTransport
+	tls       *tls.Config       // nil uses Go's defaults
+	clock     clock.Clock
+	launcher  Launcher
+}
+
+// WithTransport sends the requests of HTTP and SSE clients through rt
+func WithTransport(rt http.RoundTripper) Option {
+	return func(o *options) { o.transport = rt }
+}
+
+// WithTLS checks the certificates of https:// and wss:// servers with cfg,
+// see TLSConfig.ClientConfig. HTTP and SSE clients apply it to a transport
+// of WithTransport too, and fail if it isn't an *http.Transport.
+func WithTLS(cfg *tls.Config) Option {
+	return func(o *options) { o.tls = cfg }
+}
+
+// WithClock makes clients time their waits, such as the SSE endpoint
+// timeout, with c
+func WithClock(c clock.Clock) Option {
+	return func(o *options) { o.clock = c }
+}
+
+// WithLauncher starts the processes of stdio clients with l
+func WithLauncher(l Launcher) Option {
+	return func(o *options) { o.launcher = l }
+}
+
+func newOptions(opts []Option) options {
+	o := options{clock: clock.System, launcher: ExecLauncher{}}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	o.clock = clock.Or(o.clock)
+	if o.launcher == nil {
+		o.launcher = ExecLauncher{}
+	}
+	return o
+}
+
+// Launcher starts the process of a stdio server
+type Launcher interface {
+	Launch(server ServerConfig) (*Process, error)
+}
+
+// Process is a running stdio server: its pipes and how to stop it. Signal
+// asks a hung server to exit before it is killed; nil goes straight to Kill.
+type Process struct {
+	Stdin  io.WriteCloser
+	Stdout io.ReadCloser
+	Stderr io.ReadCloser
+	PID    int
+	Signal func(os.Signal) error
+	Kill   func() error
+	Wait   func() error
+}
+
+// ExecLauncher starts servers as child processes with server.Environ in
+// server.Cwd, confined by server.Sandbox. A sandbox with limits, a chroot
+// or a user starts through the shim of SandboxMain.
+type ExecLauncher struct{}
+
+// Launch starts the server's command
+func (ExecLauncher) Launch(server ServerConfig) (*Process, error) {
+	cmd := exec.Command(server.Command, server.Args...)
+	cmd.Dir = server.Cwd
+	cmd.Env = server.Environ()
+	if server.Sandbox.limited() {
+		if err := server.Sandbox.wrap(cmd); err != nil {
+			return nil, fmt.Errorf("failed to sandbox MCP server %s: %w", server.Name, err)
+		}
+	}
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stdin pipe: %w", err)
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		stdin.Close()
+		return nil, fmt.Errorf("failed to create stdout pipe: %w", err)
+	}
+
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		stdin.Close()
+		stdout.Close()
+		return nil, fmt.Errorf("failed to create stderr pipe: %w", err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		stdin.Close()
+		stdout.Close()
+		stderr.Close()
+		return nil, fmt.Errorf("failed to start MCP server process: %w", err)
+	}
+	return &Process{
+		Stdin:  stdin,
+		Stdout: stdout,
+		Stderr: stderr,
+		PID:    cmd.Process.Pid,
+		Signal: cmd.Process.Signal,
+		Kill:   cmd.Process.Kill,
+		Wait:   cmd.Wait,
+	}, nil
+}
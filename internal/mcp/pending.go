@@ -0,0 +1,94 @@
+package mcp
+
+import (
+	"fmt"
+	"sync"
+)
+
+// pendingRequests routes responses to in-flight requests by JSON-RPC ID,
+// allowing many requests to share one connection concurrently
+type pendingRequests struct {
+	mu      sync.Mutex
+	waiters map[int]chan jsonrpcMessage
+	err     error // Set once the connection fails; rejects new requests
+}
+
+// newPendingRequests creates an empty pending request table
+func newPendingRequests() *pendingRequests {
+	return &pendingRequests{
+		waiters: make(map[int]chan jsonrpcMessage),
+	}
+}
+
+// add registers a request ID and returns the channel its response arrives on.
+// The channel is closed without a value if the connection fails first.
+func (p *pendingRequests) add(id int) (<-chan jsonrpcMessage, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.err != nil {
+		return nil, p.err
+	}
+
+	ch := make(chan jsonrpcMessage, 1)
+	p.waiters[id] = ch
+	return ch, nil
+}
+
+// remove forgets a request ID, e.g. after its caller gave up waiting
+func (p *pendingRequests) remove(id int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.waiters, id)
+}
+
+// resolve delivers a response to its waiter, reporting whether one existed
+func (p *pendingRequests) resolve(msg jsonrpcMessage) bool {
+	id, ok := msg.intID()
+	if !ok {
+		return false
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ch, ok := p.waiters[id]
+	if !ok {
+		return false
+	}
+	delete(p.waiters, id)
+	ch <- msg
+	return true
+}
+
+// failAll fails every in-flight and future request with err
+func (p *pendingRequests) failAll(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err == nil {
+		err = fmt.Errorf("connection closed")
+	}
+	p.err = err
+	for id, ch := range p.waiters {
+		close(ch)
+		delete(p.waiters, id)
+	}
+}
+
+// diagnose fills in the pending request count and connection failure
+func (p *pendingRequests) diagnose(d *Diagnostics) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	d.Pending = len(p.waiters)
+	if p.err != nil {
+		d.Err = p.err.Error()
+	}
+}
+
+// failure returns the error the connection failed with, if any
+func (p *pendingRequests) failure() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
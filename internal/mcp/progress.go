@@ -0,0 +1,62 @@
+package mcp
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// RequestMeta is the _meta object of a request's params
+type RequestMeta struct {
+	ProgressToken string `json:"progressToken,omitempty"`
+
+	// W3C trace context of the span making the request, so servers that
+	// support it can attach their own spans to the chat turn's trace
+	Traceparent string `json:"traceparent,omitempty"`
+	Tracestate  string `json:"tracestate,omitempty"`
+}
+
+// ProgressParams represents parameters for a notifications/progress notification
+type ProgressParams struct {
+	ProgressToken interface{} `json:"progressToken"`
+	Progress      float64     `json:"progress"`
+	Total         float64     `json:"total,omitempty"` // Zero when the total is unknown
+	Message       string      `json:"message,omitempty"`
+}
+
+// progressTokenKey is the context key for a request's progress token
+type progressTokenKey struct{}
+
+// WithProgressToken returns a context whose tool calls ask the server for
+// progress notifications tagged with token
+func WithProgressToken(ctx context.Context, token string) context.Context {
+	return context.WithValue(ctx, progressTokenKey{}, token)
+}
+
+// requestMeta returns the _meta for a request made with ctx, or nil when
+// there is nothing to send
+func requestMeta(ctx context.Context) *RequestMeta {
+	token, _ := ctx.Value(progressTokenKey{}).(string)
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(ctx, carrier)
+
+	meta := RequestMeta{
+		ProgressToken: token,
+		Traceparent:   carrier.Get("traceparent"),
+		Tracestate:    carrier.Get("tracestate"),
+	}
+	if meta == (RequestMeta{}) {
+		return nil
+	}
+	return &meta
+}
+
+// listToolsParams returns the params of a tools/list request made with ctx;
+// nil leaves them out for servers that don't expect any
+func listToolsParams(ctx context.Context) interface{} {
+	meta := requestMeta(ctx)
+	if meta == nil {
+		return nil
+	}
+	return ListToolsParams{Meta: meta}
+}
@@ -1,5 +1,10 @@
 package mcp
 
+import (
+	"encoding/json"
+	"fmt"
+)
+
 // JSON-RPC 2.0 protocol types for Model Context Protocol
 
 // JSONRPCRequest represents a JSON-RPC 2.0 request
@@ -18,6 +23,13 @@ type JSONRPCResponse struct {
 	Error   *RPCError   `json:"error,omitempty"`
 }
 
+// JSONRPCNotification represents a JSON-RPC 2.0 notification (no ID, no response)
+type JSONRPCNotification struct {
+	JSONRPC string          `json:"jsonrpc"` // Always "2.0"
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
 // RPCError represents a JSON-RPC 2.0 error
 type RPCError struct {
 	Code    int         `json:"code"`
@@ -30,8 +42,100 @@ const (
 	MethodInitialize = "initialize"
 	MethodListTools  = "tools/list"
 	MethodCallTool   = "tools/call"
+	MethodPing       = "ping"
+	MethodSetLevel   = "logging/setLevel"
+)
+
+// MCP notification methods sent by servers
+const (
+	NotificationToolsListChanged = "notifications/tools/list_changed"
+	NotificationProgress         = "notifications/progress"
+	NotificationMessage          = "notifications/message"
+)
+
+// MCP notification methods sent by clients
+const (
+	NotificationCancelled   = "notifications/cancelled"
+	NotificationInitialized = "notifications/initialized"
 )
 
+// JSON-RPC 2.0 error codes
+const (
+	ErrCodeMethodNotFound = -32601
+)
+
+// jsonrpcMessage is the superset of every inbound JSON-RPC 2.0 message shape.
+// A message with a method and no ID is a notification, a message with a method
+// and an ID is a server-initiated request, and anything else is a response.
+type jsonrpcMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+}
+
+// hasID reports whether the message carries a non-null ID
+func (m jsonrpcMessage) hasID() bool {
+	return len(m.ID) > 0 && string(m.ID) != "null"
+}
+
+// isNotification reports whether the message is a server notification
+func (m jsonrpcMessage) isNotification() bool {
+	return m.Method != "" && !m.hasID()
+}
+
+// isRequest reports whether the message is a server-initiated request
+func (m jsonrpcMessage) isRequest() bool {
+	return m.Method != "" && m.hasID()
+}
+
+// intID returns the numeric ID of a response to one of our requests
+func (m jsonrpcMessage) intID() (int, bool) {
+	var id int
+	if err := json.Unmarshal(m.ID, &id); err != nil {
+		return 0, false
+	}
+	return id, true
+}
+
+// decodeResult checks a response for an RPC error and unmarshals its result
+func decodeResult(msg jsonrpcMessage, result interface{}) error {
+	if msg.Error != nil {
+		return fmt.Errorf("RPC error %d: %s", msg.Error.Code, msg.Error.Message)
+	}
+	if result != nil && len(msg.Result) > 0 {
+		if err := json.Unmarshal(msg.Result, result); err != nil {
+			return fmt.Errorf("failed to unmarshal result: %w", err)
+		}
+	}
+	return nil
+}
+
+// jsonrpcReply is a response we send to a server-initiated request
+type jsonrpcReply struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+}
+
+// replyToServerRequest builds the reply to a server-initiated request.
+// Only ping is supported; everything else is answered with method not found.
+func replyToServerRequest(msg jsonrpcMessage) jsonrpcReply {
+	reply := jsonrpcReply{JSONRPC: "2.0", ID: msg.ID}
+	if msg.Method == MethodPing {
+		reply.Result = struct{}{}
+	} else {
+		reply.Error = &RPCError{
+			Code:    ErrCodeMethodNotFound,
+			Message: fmt.Sprintf("method not found: %s", msg.Method),
+		}
+	}
+	return reply
+}
+
 // InitializeParams represents parameters for initialize request
 type InitializeParams struct {
 	ProtocolVersion string             `json:"protocolVersion"`
@@ -99,6 +203,11 @@ type ServerInfo struct {
 	Version string `json:"version"`
 }
 
+// ListToolsParams represents parameters for tools/list request
+type ListToolsParams struct {
+	Meta *RequestMeta `json:"_meta,omitempty"`
+}
+
 // ListToolsResult represents result from tools/list request
 type ListToolsResult struct {
 	Tools []ToolInfo `json:"tools"`
@@ -109,12 +218,40 @@ type ToolInfo struct {
 	Name        string                 `json:"name"`
 	Description string                 `json:"description"`
 	InputSchema map[string]interface{} `json:"inputSchema"` // JSON Schema
+	Annotations *ToolAnnotations       `json:"annotations,omitempty"`
+}
+
+// ToolAnnotations are a server's hints about what a tool does (protocol
+// 2025-03-26). Unset hints take the protocol's defaults: a tool may write
+// and may be destructive.
+type ToolAnnotations struct {
+	Title           string `json:"title,omitempty"`
+	ReadOnlyHint    *bool  `json:"readOnlyHint,omitempty"`
+	DestructiveHint *bool  `json:"destructiveHint,omitempty"`
+	IdempotentHint  *bool  `json:"idempotentHint,omitempty"`
+	OpenWorldHint   *bool  `json:"openWorldHint,omitempty"`
+}
+
+// CancelledParams represents parameters for a notifications/cancelled notification
+type CancelledParams struct {
+	RequestID int    `json:"requestId"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// newNotification builds an outbound notification with marshaled params
+func newNotification(method string, params interface{}) (JSONRPCNotification, error) {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return JSONRPCNotification{}, fmt.Errorf("failed to marshal notification params: %w", err)
+	}
+	return JSONRPCNotification{JSONRPC: "2.0", Method: method, Params: data}, nil
 }
 
 // CallToolParams represents parameters for tools/call request
 type CallToolParams struct {
 	Name      string                 `json:"name"`
 	Arguments map[string]interface{} `json:"arguments"`
+	Meta      *RequestMeta           `json:"_meta,omitempty"`
 }
 
 // CallToolResult represents result from tools/call request
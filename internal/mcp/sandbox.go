@@ -0,0 +1,95 @@
+package mcp
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// nobody is the user and group a chrooted server runs as when the chatbot
+// runs as root and the sandbox names no user
+const nobody = 65534
+
+// Sandbox confines the process of a local server. Resource limits, chroot
+// and User are only available on Linux; MaxRuntime and CleanEnv work
+// everywhere.
+type Sandbox struct {
+	CPUSeconds int    `json:"cpuSeconds,omitempty" yaml:"cpuSeconds,omitempty"` // CPU time before the kernel kills the process; 0 is unlimited
+	MemoryMB   int    `json:"memoryMB,omitempty" yaml:"memoryMB,omitempty"`     // Address space limit; 0 is unlimited
+	Chroot     string `json:"chroot,omitempty" yaml:"chroot,omitempty"`         // Root directory of the process; needs root privileges
+	User       string `json:"user,omitempty" yaml:"user,omitempty"`             // Numeric "uid:gid" the process runs as; needs root privileges
+	MaxRuntime string `json:"maxRuntime,omitempty" yaml:"maxRuntime,omitempty"` // Wall-clock time after which the process is killed, e.g. "8h"
+	CleanEnv   bool   `json:"cleanEnv,omitempty" yaml:"cleanEnv,omitempty"`     // Pass only PATH and Env, none of baseEnvVars
+}
+
+// runtime returns MaxRuntime, 0 when unlimited
+func (s *Sandbox) runtime() time.Duration {
+	if s == nil || s.MaxRuntime == "" {
+		return 0
+	}
+	d, _ := time.ParseDuration(s.MaxRuntime) // Checked by validate
+	return d
+}
+
+// limited reports whether the sandbox sets limits that need OS support
+func (s *Sandbox) limited() bool {
+	return s != nil && (s.CPUSeconds > 0 || s.MemoryMB > 0 || s.Chroot != "" || s.User != "")
+}
+
+// credentials returns the user and group the process runs as, -1 for ours.
+// A root process can leave a chroot, so a chrooted server started by root
+// runs as nobody unless User names someone else.
+func (s *Sandbox) credentials() (uid, gid int, err error) {
+	if s.User == "" {
+		if s.Chroot != "" && os.Geteuid() == 0 {
+			return nobody, nobody, nil
+		}
+		return -1, -1, nil
+	}
+	uidText, gidText, ok := strings.Cut(s.User, ":")
+	if uid, err = strconv.Atoi(uidText); err != nil || !ok || uid < 0 {
+		return 0, 0, fmt.Errorf("sandbox user must be a numeric \"uid:gid\", got %q", s.User)
+	}
+	if gid, err = strconv.Atoi(gidText); err != nil || gid < 0 {
+		return 0, 0, fmt.Errorf("sandbox user must be a numeric \"uid:gid\", got %q", s.User)
+	}
+	return uid, gid, nil
+}
+
+// validate checks the sandbox of a server with the given command and
+// working directory
+func (s *Sandbox) validate(server ServerConfig) error {
+	if s.CPUSeconds < 0 || s.MemoryMB < 0 {
+		return fmt.Errorf("MCP server %s: sandbox limits must not be negative", server.Name)
+	}
+	if s.MaxRuntime != "" {
+		if d, err := time.ParseDuration(s.MaxRuntime); err != nil || d <= 0 {
+			return fmt.Errorf("MCP server %s: sandbox maxRuntime must be a positive duration like \"8h\"", server.Name)
+		}
+	}
+	if s.CleanEnv && server.InheritEnv {
+		return fmt.Errorf("MCP server %s: cleanEnv and inheritEnv are mutually exclusive", server.Name)
+	}
+	if s.User != "" {
+		uid, _, err := s.credentials()
+		if err != nil {
+			return fmt.Errorf("MCP server %s: %w", server.Name, err)
+		}
+		if uid == 0 && s.Chroot != "" {
+			return fmt.Errorf("MCP server %s: a chrooted server can't run as root, which could leave the chroot", server.Name)
+		}
+	}
+	// Paths are looked up inside the new root, so they can't be relative
+	if s.Chroot != "" {
+		if !filepath.IsAbs(server.Command) {
+			return fmt.Errorf("MCP server %s: a chrooted command must be an absolute path within the chroot", server.Name)
+		}
+		if server.Cwd != "" && !filepath.IsAbs(server.Cwd) {
+			return fmt.Errorf("MCP server %s: a chrooted cwd must be an absolute path within the chroot", server.Name)
+		}
+	}
+	return nil
+}
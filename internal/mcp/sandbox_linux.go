@@ -0,0 +1,135 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// sandboxShimArg makes our own executable confine itself and exec a
+// server's command, see SandboxMain
+const sandboxShimArg = "__mcp-sandbox-shim"
+
+// sandboxSpec is what the shim applies before it execs the server
+type sandboxSpec struct {
+	CPUSeconds int      `json:"cpuSeconds,omitempty"`
+	MemoryMB   int      `json:"memoryMB,omitempty"`
+	Chroot     string   `json:"chroot,omitempty"`
+	Dir        string   `json:"dir,omitempty"` // Working directory inside the chroot
+	UID        int      `json:"uid"`           // -1 keeps ours
+	GID        int      `json:"gid"`
+	Path       string   `json:"path"`
+	Args       []string `json:"args"`
+}
+
+// wrap makes cmd start our own executable as the sandbox shim, which
+// confines itself and then execs the server's command. Limits, root and
+// user are so in place before the server's first instruction, and apply to
+// everything it forks.
+func (s *Sandbox) wrap(cmd *exec.Cmd) error {
+	self, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate the sandbox shim: %w", err)
+	}
+	uid, gid, err := s.credentials()
+	if err != nil {
+		return err
+	}
+
+	spec := sandboxSpec{
+		CPUSeconds: s.CPUSeconds,
+		MemoryMB:   s.MemoryMB,
+		Chroot:     s.Chroot,
+		UID:        uid,
+		GID:        gid,
+		Path:       cmd.Path,
+		Args:       cmd.Args,
+	}
+	if s.Chroot != "" {
+		// exec.Command resolved the command on our filesystem; inside the
+		// root it is the path as configured, and so is the working directory
+		spec.Path = cmd.Args[0]
+		spec.Dir = cmd.Dir
+		if spec.Dir == "" {
+			spec.Dir = "/"
+		}
+		cmd.Dir = ""
+		cmd.Err = nil
+	} else if cmd.Err != nil {
+		return cmd.Err
+	}
+
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return fmt.Errorf("failed to encode sandbox: %w", err)
+	}
+	cmd.Path = self
+	cmd.Args = []string{self, sandboxShimArg, string(data)}
+	return nil
+}
+
+// SandboxMain runs the sandbox shim when this process was started as one:
+// it confines itself as its arguments say and execs the MCP server, never
+// returning. Otherwise it returns at once. Programs that start sandboxed
+// stdio servers call it first thing in main.
+func SandboxMain() {
+	if len(os.Args) != 3 || os.Args[1] != sandboxShimArg {
+		return
+	}
+	var spec sandboxSpec
+	err := json.Unmarshal([]byte(os.Args[2]), &spec)
+	if err == nil {
+		err = spec.enter()
+	}
+	// enter only returns on failure
+	fmt.Fprintf(os.Stderr, "MCP server sandbox: %v\n", err)
+	os.Exit(126)
+}
+
+// enter changes root, drops privileges, sets the resource limits and execs
+// the server. The limits come last, as lowering them may leave too little
+// for the steps before.
+func (spec sandboxSpec) enter() error {
+	if spec.Chroot != "" {
+		if err := syscall.Chroot(spec.Chroot); err != nil {
+			return fmt.Errorf("failed to change root: %w", err)
+		}
+		if err := os.Chdir(spec.Dir); err != nil {
+			return fmt.Errorf("failed to enter working directory: %w", err)
+		}
+	}
+	if spec.GID >= 0 {
+		if err := syscall.Setgroups(nil); err != nil {
+			return fmt.Errorf("failed to drop supplementary groups: %w", err)
+		}
+		if err := syscall.Setgid(spec.GID); err != nil {
+			return fmt.Errorf("failed to set group: %w", err)
+		}
+	}
+	if spec.UID >= 0 {
+		if err := syscall.Setuid(spec.UID); err != nil {
+			return fmt.Errorf("failed to set user: %w", err)
+		}
+	}
+	if spec.CPUSeconds > 0 {
+		lim := unix.Rlimit{Cur: uint64(spec.CPUSeconds), Max: uint64(spec.CPUSeconds)}
+		if err := unix.Setrlimit(unix.RLIMIT_CPU, &lim); err != nil {
+			return fmt.Errorf("failed to limit CPU time: %w", err)
+		}
+	}
+	if spec.MemoryMB > 0 {
+		bytes := uint64(spec.MemoryMB) << 20
+		lim := unix.Rlimit{Cur: bytes, Max: bytes}
+		if err := unix.Setrlimit(unix.RLIMIT_AS, &lim); err != nil {
+			return fmt.Errorf("failed to limit memory: %w", err)
+		}
+	}
+	if err := syscall.Exec(spec.Path, spec.Args, os.Environ()); err != nil {
+		return fmt.Errorf("failed to start %s: %w", spec.Path, err)
+	}
+	return nil
+}
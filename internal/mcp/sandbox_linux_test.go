@@ -0,0 +1,84 @@
+package mcp
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestMain lets the test binary serve as the sandbox shim
+func TestMain(m *testing.M) {
+	SandboxMain()
+	os.Exit(m.Run())
+}
+
+// runSandboxed starts a shell script in sandbox and returns its output
+func runSandboxed(t *testing.T, sandbox *Sandbox, script string) string {
+	t.Helper()
+	server := ServerConfig{Name: "sandboxed", Command: "/bin/sh", Args: []string{"-c", script}, Sandbox: sandbox}
+	process, err := ExecLauncher{}.Launch(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	process.Stdin.Close()
+	out, err := io.ReadAll(process.Stdout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stderr, _ := io.ReadAll(process.Stderr)
+	if err := process.Wait(); err != nil {
+		t.Fatalf("sandboxed script failed: %v: %s", err, stderr)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func TestSandboxLimitsApplyFromTheStart(t *testing.T) {
+	// The script reads its limits before doing anything else, and a child
+	// it forks reports the same
+	out := runSandboxed(t, &Sandbox{CPUSeconds: 7, MemoryMB: 512}, "ulimit -t; ulimit -v; sh -c 'ulimit -t; ulimit -v'")
+	if want := "7\n524288\n7\n524288"; out != want {
+		t.Errorf("limits %q, want %q", out, want)
+	}
+}
+
+func TestSandboxUser(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("changing user needs root privileges")
+	}
+	out := runSandboxed(t, &Sandbox{User: "65534:65534"}, "id -u; id -g; id -G")
+	if want := "65534\n65534\n65534"; out != want {
+		t.Errorf("credentials %q, want %q", out, want)
+	}
+}
+
+func TestSandboxCredentials(t *testing.T) {
+	tests := []struct {
+		sandbox  Sandbox
+		uid, gid int
+		wantErr  bool
+	}{
+		{Sandbox{User: "1000:100"}, 1000, 100, false},
+		{Sandbox{User: "1000"}, 0, 0, true},
+		{Sandbox{User: "alice:staff"}, 0, 0, true},
+		{Sandbox{User: "-1:-1"}, 0, 0, true},
+		{Sandbox{CPUSeconds: 5}, -1, -1, false},
+	}
+	for _, tt := range tests {
+		uid, gid, err := tt.sandbox.credentials()
+		if (err != nil) != tt.wantErr || (!tt.wantErr && (uid != tt.uid || gid != tt.gid)) {
+			t.Errorf("credentials(%+v) = %d, %d, %v", tt.sandbox, uid, gid, err)
+		}
+	}
+
+	// A chrooted server started by root doesn't stay root
+	uid, gid, _ := (&Sandbox{Chroot: "/srv/jail"}).credentials()
+	if os.Geteuid() == 0 && (uid != nobody || gid != nobody) {
+		t.Errorf("chrooted server runs as %d:%d, want nobody", uid, gid)
+	}
+
+	root := ServerConfig{Name: "jailed", Command: "/bin/server", Sandbox: &Sandbox{Chroot: "/srv/jail", User: "0:0"}}
+	if err := root.Sandbox.validate(root); err == nil {
+		t.Error("a chrooted server was allowed to run as root")
+	}
+}
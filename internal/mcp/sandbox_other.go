@@ -0,0 +1,16 @@
+//go:build !linux
+
+package mcp
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+// wrap refuses limits this platform can't enforce
+func (s *Sandbox) wrap(cmd *exec.Cmd) error {
+	return fmt.Errorf("sandbox resource limits, chroot and user are only supported on Linux")
+}
+
+// SandboxMain returns at once; servers are never sandboxed here
+func SandboxMain() {}
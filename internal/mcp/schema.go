@@ -0,0 +1,270 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// SchemaError lists every way a value violates a tool's input schema
+type SchemaError struct {
+	Violations []string
+}
+
+// Error implements error
+func (e *SchemaError) Error() string {
+	return "arguments do not match the input schema: " + strings.Join(e.Violations, "; ")
+}
+
+// ValidateArguments checks tool arguments against the tool's InputSchema.
+// It supports the JSON Schema keywords tool schemas use in practice: type,
+// properties, required, additionalProperties, items, enum, const, string,
+// number and array bounds, pattern, and allOf/anyOf/oneOf. Unknown keywords
+// are ignored, so an unusual schema never blocks a call.
+func ValidateArguments(schema map[string]interface{}, args map[string]interface{}) error {
+	if len(schema) == 0 {
+		return nil
+	}
+
+	// Round-trip through JSON so values have the types the server will see
+	var value interface{} = map[string]interface{}{}
+	if args != nil {
+		data, err := json.Marshal(args)
+		if err != nil {
+			return fmt.Errorf("failed to marshal arguments: %w", err)
+		}
+		if err := json.Unmarshal(data, &value); err != nil {
+			return fmt.Errorf("failed to unmarshal arguments: %w", err)
+		}
+	}
+
+	var violations []string
+	validateValue(schema, value, "arguments", &violations)
+	if len(violations) > 0 {
+		return &SchemaError{Violations: violations}
+	}
+	return nil
+}
+
+// validateValue appends a violation for every keyword of schema that value
+// does not satisfy
+func validateValue(schema map[string]interface{}, value interface{}, path string, violations *[]string) {
+	fail := func(format string, args ...interface{}) {
+		*violations = append(*violations, path+": "+fmt.Sprintf(format, args...))
+	}
+
+	if types := schemaTypes(schema["type"]); len(types) > 0 {
+		matched := false
+		for _, t := range types {
+			if hasType(value, t) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			fail("expected %s, got %s", strings.Join(types, " or "), jsonType(value))
+			return
+		}
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, candidate := range enum {
+			if reflect.DeepEqual(candidate, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			fail("must be one of %s", compactJSON(enum))
+		}
+	}
+	if constant, ok := schema["const"]; ok && !reflect.DeepEqual(constant, value) {
+		fail("must be %s", compactJSON(constant))
+	}
+
+	switch v := value.(type) {
+	case string:
+		length := utf8.RuneCountInString(v)
+		if n, ok := schemaNumber(schema["minLength"]); ok && float64(length) < n {
+			fail("must be at least %v characters", n)
+		}
+		if n, ok := schemaNumber(schema["maxLength"]); ok && float64(length) > n {
+			fail("must be at most %v characters", n)
+		}
+		if pattern, ok := schema["pattern"].(string); ok {
+			if re, err := regexp.Compile(pattern); err == nil && !re.MatchString(v) {
+				fail("must match pattern %q", pattern)
+			}
+		}
+
+	case float64:
+		if n, ok := schemaNumber(schema["minimum"]); ok && v < n {
+			fail("must be >= %v", n)
+		}
+		if n, ok := schemaNumber(schema["maximum"]); ok && v > n {
+			fail("must be <= %v", n)
+		}
+		if n, ok := schemaNumber(schema["exclusiveMinimum"]); ok && v <= n {
+			fail("must be > %v", n)
+		}
+		if n, ok := schemaNumber(schema["exclusiveMaximum"]); ok && v >= n {
+			fail("must be < %v", n)
+		}
+
+	case []interface{}:
+		if n, ok := schemaNumber(schema["minItems"]); ok && float64(len(v)) < n {
+			fail("must have at least %v items", n)
+		}
+		if n, ok := schemaNumber(schema["maxItems"]); ok && float64(len(v)) > n {
+			fail("must have at most %v items", n)
+		}
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range v {
+				validateValue(items, item, fmt.Sprintf("%s[%d]", path, i), violations)
+			}
+		}
+
+	case map[string]interface{}:
+		if required, ok := schema["required"].([]interface{}); ok {
+			for _, name := range required {
+				if key, ok := name.(string); ok {
+					if _, present := v[key]; !present {
+						fail("missing required property %q", key)
+					}
+				}
+			}
+		}
+
+		properties, _ := schema["properties"].(map[string]interface{})
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			if propSchema, ok := properties[key].(map[string]interface{}); ok {
+				validateValue(propSchema, v[key], path+"."+key, violations)
+				continue
+			}
+			if _, declared := properties[key]; declared {
+				continue
+			}
+			switch additional := schema["additionalProperties"].(type) {
+			case bool:
+				if !additional {
+					fail("unexpected property %q", key)
+				}
+			case map[string]interface{}:
+				validateValue(additional, v[key], path+"."+key, violations)
+			}
+		}
+	}
+
+	if all, ok := schema["allOf"].([]interface{}); ok {
+		for _, sub := range all {
+			if subSchema, ok := sub.(map[string]interface{}); ok {
+				validateValue(subSchema, value, path, violations)
+			}
+		}
+	}
+	if anyOf, ok := schema["anyOf"].([]interface{}); ok && countMatches(anyOf, value, path) == 0 {
+		fail("does not match any of the allowed schemas")
+	}
+	if oneOf, ok := schema["oneOf"].([]interface{}); ok && countMatches(oneOf, value, path) != 1 {
+		fail("must match exactly one of the allowed schemas")
+	}
+}
+
+// countMatches returns how many of the schemas value satisfies
+func countMatches(schemas []interface{}, value interface{}, path string) int {
+	matches := 0
+	for _, sub := range schemas {
+		subSchema, ok := sub.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		var subViolations []string
+		validateValue(subSchema, value, path, &subViolations)
+		if len(subViolations) == 0 {
+			matches++
+		}
+	}
+	return matches
+}
+
+// schemaTypes normalizes the "type" keyword, which may be a string or a list
+func schemaTypes(t interface{}) []string {
+	switch t := t.(type) {
+	case string:
+		return []string{t}
+	case []interface{}:
+		var types []string
+		for _, item := range t {
+			if s, ok := item.(string); ok {
+				types = append(types, s)
+			}
+		}
+		return types
+	}
+	return nil
+}
+
+// hasType reports whether a decoded JSON value is of a JSON Schema type
+func hasType(value interface{}, t string) bool {
+	switch t {
+	case "integer":
+		n, ok := value.(float64)
+		return ok && n == math.Trunc(n)
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	default:
+		return jsonType(value) == t
+	}
+}
+
+// jsonType names the JSON type of a decoded value
+func jsonType(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// schemaNumber reads a numeric keyword
+func schemaNumber(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+// compactJSON renders a value for an error message
+func compactJSON(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(data)
+}
@@ -0,0 +1,443 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// sseEndpointTimeout bounds how long we wait for the server to announce its
+// message endpoint after opening the event stream
+const sseEndpointTimeout = 10 * time.Second
+
+// SSEClient implements MCPClient for remote servers using the legacy HTTP+SSE
+// transport (protocol 2024-11-05): the server announces a POST endpoint in an
+// "endpoint" event, and responses arrive as "message" events on the stream
+type SSEClient struct {
+	notifier
+	serverInfo
+
+	name       string
+	url        string
+	endpoint   string // Where messages are POSTed, announced by the server
+	httpClient *http.Client
+	stream     io.ReadCloser
+	cancel     context.CancelFunc // Stops the event stream and pending POSTs
+	ctx        context.Context
+	reqID      int32
+	logger     *slog.Logger
+	mu         sync.Mutex // Guards closed
+	closed     bool
+	pending    *pendingRequests // In-flight requests awaiting responses
+}
+
+// NewSSEClient opens the event stream of a legacy SSE MCP server and waits for
+// its message endpoint. WithTransport replaces how requests are sent,
+// WithTLS how the server's certificate is checked, and WithClock times the
+// wait.
+func NewSSEClient(name string, sseURL string, logger *slog.Logger, opts ...Option) (*SSEClient, error) {
+	if logger == nil {
+		return nil, fmt.Errorf("logger cannot be nil")
+	}
+	o := newOptions(opts)
+	transport, err := o.httpTransport()
+	if err != nil {
+		return nil, fmt.Errorf("MCP server %s: %w", name, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequestWithContext(ctx, "GET", sseURL, nil)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to create SSE request: %w", err)
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	httpClient := &http.Client{
+		Timeout:   0, // The event stream stays open for the client's lifetime
+		Transport: transport,
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to connect to SSE stream: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		cancel()
+		return nil, fmt.Errorf("HTTP error %d: %s", resp.StatusCode, string(body))
+	}
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		resp.Body.Close()
+		cancel()
+		return nil, fmt.Errorf("unexpected content type %q for SSE stream", resp.Header.Get("Content-Type"))
+	}
+
+	client := &SSEClient{
+		name:       name,
+		url:        sseURL,
+		httpClient: httpClient,
+		stream:     resp.Body,
+		cancel:     cancel,
+		ctx:        ctx,
+		reqID:      0,
+		logger:     logger,
+		closed:     false,
+		pending:    newPendingRequests(),
+	}
+
+	// The first event must tell us where to send messages
+	endpointCh := make(chan string, 1)
+	go client.readLoop(endpointCh)
+
+	select {
+	case endpoint, ok := <-endpointCh:
+		if !ok {
+			client.Close()
+			return nil, fmt.Errorf("SSE stream closed before endpoint event: %w", client.pending.failure())
+		}
+		client.endpoint = endpoint
+	case <-o.clock.After(sseEndpointTimeout):
+		client.Close()
+		return nil, fmt.Errorf("timed out waiting for SSE endpoint event")
+	}
+
+	logger.Info("created MCP SSE client", "name", name, "url", sseURL, "endpoint", client.endpoint)
+	return client, nil
+}
+
+// Name returns the client identifier
+func (c *SSEClient) Name() string {
+	return c.name
+}
+
+// Initialize establishes connection to MCP server
+func (c *SSEClient) Initialize(ctx context.Context) error {
+	params := InitializeParams{
+		ProtocolVersion: "2024-11-05",
+		Capabilities: ClientCapabilities{
+			Roots: &RootsCapability{
+				ListChanged: false,
+			},
+		},
+		ClientInfo: ClientInfo{
+			Name:    "extrachat",
+			Version: "1.1.0",
+		},
+	}
+
+	var result InitializeResult
+	if err := c.sendRequest(ctx, MethodInitialize, params, &result); err != nil {
+		return fmt.Errorf("initialize failed: %w", err)
+	}
+	c.setServerInfo(result)
+
+	// SSE servers typically refuse requests until initialization is confirmed
+	notification, err := newNotification(NotificationInitialized, struct{}{})
+	if err == nil {
+		err = c.writeMessage(notification)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to confirm initialization: %w", err)
+	}
+
+	c.logger.Info("MCP server initialized",
+		"server", result.ServerInfo.Name,
+		"version", result.ServerInfo.Version,
+		"protocol", result.ProtocolVersion)
+	return nil
+}
+
+// ListTools returns available tools from this MCP server
+func (c *SSEClient) ListTools(ctx context.Context) ([]Tool, error) {
+	var result ListToolsResult
+	if err := c.sendRequest(ctx, MethodListTools, listToolsParams(ctx), &result); err != nil {
+		return nil, fmt.Errorf("list tools failed: %w", err)
+	}
+
+	tools := make([]Tool, len(result.Tools))
+	for i, toolInfo := range result.Tools {
+		tools[i] = Tool{
+			Name:        toolInfo.Name,
+			Description: toolInfo.Description,
+			InputSchema: toolInfo.InputSchema,
+			ServerName:  c.name,
+			Annotations: toolInfo.Annotations,
+		}
+	}
+
+	c.logger.Info("listed tools from MCP server", "server", c.name, "count", len(tools))
+	return tools, nil
+}
+
+// CallTool invokes a tool with given arguments
+func (c *SSEClient) CallTool(ctx context.Context, toolName string, args map[string]interface{}) (interface{}, error) {
+	params := CallToolParams{
+		Name:      toolName,
+		Arguments: args,
+		Meta:      requestMeta(ctx),
+	}
+
+	var result CallToolResult
+	if err := c.sendRequest(ctx, MethodCallTool, params, &result); err != nil {
+		return nil, fmt.Errorf("call tool failed: %w", err)
+	}
+
+	c.logger.Info("called tool", "server", c.name, "tool", toolName)
+	return result, nil
+}
+
+// Ping checks that the server is responsive
+func (c *SSEClient) Ping(ctx context.Context) error {
+	if err := c.sendRequest(ctx, MethodPing, nil, nil); err != nil {
+		return fmt.Errorf("ping failed: %w", err)
+	}
+	return nil
+}
+
+// SetLogLevel sets the minimum level of log notifications the server sends
+func (c *SSEClient) SetLogLevel(ctx context.Context, level string) error {
+	if err := c.sendRequest(ctx, MethodSetLevel, SetLevelParams{Level: level}, nil); err != nil {
+		return fmt.Errorf("set log level failed: %w", err)
+	}
+	return nil
+}
+
+// Diagnostics describes the event stream connection
+func (c *SSEClient) Diagnostics() Diagnostics {
+	d := Diagnostics{Transport: TransportSSE, Target: c.url}
+	c.mu.Lock()
+	d.Closed = c.closed
+	c.mu.Unlock()
+	c.pending.diagnose(&d)
+	return d
+}
+
+// Close disconnects from the MCP server
+func (c *SSEClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+
+	c.cancel()
+	c.stream.Close()
+
+	c.logger.Info("closed MCP SSE client", "name", c.name)
+	return nil
+}
+
+// sendRequest POSTs a JSON-RPC request and waits for its response on the
+// event stream
+func (c *SSEClient) sendRequest(ctx context.Context, method string, params interface{}, result interface{}) error {
+	c.mu.Lock()
+	closed := c.closed
+	c.mu.Unlock()
+
+	if closed {
+		return fmt.Errorf("client is closed")
+	}
+
+	// Generate unique request ID
+	reqID := int(atomic.AddInt32(&c.reqID, 1))
+
+	// Register before sending so a fast response cannot be missed
+	respCh, err := c.pending.add(reqID)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	defer c.pending.remove(reqID)
+
+	// Build JSON-RPC request
+	request := JSONRPCRequest{
+		JSONRPC: "2.0",
+		ID:      reqID,
+		Method:  method,
+		Params:  params,
+	}
+
+	// Send request
+	if err := c.writeMessage(request); err != nil {
+		return fmt.Errorf("failed to write request: %w", err)
+	}
+
+	// Wait for the matching response; readLoop routes it here by ID
+	select {
+	case msg, ok := <-respCh:
+		if !ok {
+			return fmt.Errorf("failed to read response: %w", c.pending.failure())
+		}
+		return decodeResult(msg, result)
+	case <-ctx.Done():
+		// Let the server abort the work; initialize must never be cancelled
+		if method != MethodInitialize {
+			c.sendCancelled(reqID, ctx.Err())
+		}
+		return ctx.Err()
+	}
+}
+
+// sendCancelled notifies the server that we stopped waiting for a request
+func (c *SSEClient) sendCancelled(reqID int, reason error) {
+	notification, err := newNotification(NotificationCancelled, CancelledParams{
+		RequestID: reqID,
+		Reason:    reason.Error(),
+	})
+	if err == nil {
+		err = c.writeMessage(notification)
+	}
+	if err != nil {
+		c.logger.Warn("failed to send cancellation to MCP server", "server", c.name, "id", reqID, "error", err)
+		return
+	}
+	c.logger.Info("cancelled MCP request", "server", c.name, "id", reqID, "reason", reason)
+}
+
+// writeMessage POSTs a JSON-RPC message to the server's message endpoint. The
+// server acknowledges with 202 Accepted; any reply comes over the stream.
+func (c *SSEClient) writeMessage(msg interface{}) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(c.ctx, "POST", c.endpoint, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send HTTP request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("HTTP error %d: %s", resp.StatusCode, string(body))
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// readLoop parses the event stream until it closes. The endpoint event is
+// delivered on endpointCh; message events are dispatched like the other
+// transports do.
+func (c *SSEClient) readLoop(endpointCh chan<- string) {
+	scanner := bufio.NewScanner(c.stream)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	var event string
+	var dataLines []string
+	endpointSent := false
+
+	handleEvent := func() {
+		defer func() {
+			event = ""
+			dataLines = nil
+		}()
+		if len(dataLines) == 0 {
+			return
+		}
+		data := strings.Join(dataLines, "\n")
+
+		switch event {
+		case "endpoint":
+			endpoint, err := c.resolveEndpoint(data)
+			if err != nil {
+				c.logger.Warn("invalid SSE endpoint event", "server", c.name, "data", data, "error", err)
+				return
+			}
+			if !endpointSent {
+				endpointSent = true
+				endpointCh <- endpoint
+				close(endpointCh)
+			}
+		case "", "message":
+			c.handleMessage([]byte(data))
+		default:
+			c.logger.Debug("ignoring SSE event", "server", c.name, "event", event)
+		}
+	}
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			handleEvent()
+		case strings.HasPrefix(line, ":"):
+			// Comment, used by servers as keep-alive
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data := strings.TrimPrefix(line, "data:")
+			dataLines = append(dataLines, strings.TrimPrefix(data, " "))
+		}
+	}
+	handleEvent()
+
+	err := scanner.Err()
+	if err == nil {
+		err = fmt.Errorf("EOF from MCP server")
+	}
+	c.pending.failAll(err)
+	if !endpointSent {
+		close(endpointCh)
+	}
+}
+
+// handleMessage routes one JSON-RPC message from the stream
+func (c *SSEClient) handleMessage(data []byte) {
+	var msg jsonrpcMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		c.logger.Warn("failed to unmarshal message from MCP server", "server", c.name, "error", err)
+		return
+	}
+
+	switch {
+	case msg.isNotification():
+		c.dispatch(c.logger, c.name, msg)
+	case msg.isRequest():
+		if err := c.writeMessage(replyToServerRequest(msg)); err != nil {
+			c.logger.Warn("failed to reply to MCP server request", "server", c.name, "method", msg.Method, "error", err)
+		}
+	default:
+		if !c.pending.resolve(msg) {
+			c.logger.Warn("discarding unexpected response from MCP server", "server", c.name, "id", string(msg.ID))
+		}
+	}
+}
+
+// resolveEndpoint resolves the announced endpoint against the stream URL.
+// The endpoint must be on the same origin, so a server cannot redirect our
+// messages elsewhere.
+func (c *SSEClient) resolveEndpoint(data string) (string, error) {
+	base, err := url.Parse(c.url)
+	if err != nil {
+		return "", err
+	}
+	ref, err := url.Parse(strings.TrimSpace(data))
+	if err != nil {
+		return "", err
+	}
+	endpoint := base.ResolveReference(ref)
+	if endpoint.Scheme != base.Scheme || endpoint.Host != base.Host {
+		return "", fmt.Errorf("endpoint %s is not on %s://%s", endpoint, base.Scheme, base.Host)
+	}
+	return endpoint.String(), nil
+}
@@ -7,90 +7,95 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
-	"os/exec"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"syscall"
+	"time"
+
+	"ExtraChat/internal/clock"
 )
 
-// StdioClient implements MCPClient for local Python MCP servers via stdio
+// cancelGrace is how long a server has to take a cancellation and answer a
+// ping before it is taken for hung and sent SIGTERM, and how long it then
+// has to exit before it is killed
+const cancelGrace = 5 * time.Second
+
+// StdioClient implements MCPClient for local MCP servers via stdio
 type StdioClient struct {
+	notifier
+	serverInfo
+
 	name    string
-	cmd     *exec.Cmd
+	command string   // Command line, for diagnostics
+	process *Process // The server process
 	stdin   io.WriteCloser
 	stdout  io.ReadCloser
 	stderr  io.ReadCloser
-	scanner *bufio.Scanner
+	reader  *frameReader
+	framing string      // Configured framing; FramingAuto detects it
+	framed  atomic.Bool // Write Content-Length frames instead of lines
 	reqID   int32
 	logger  *slog.Logger
-	mu      sync.Mutex
+	clock   clock.Clock
+	mu      sync.Mutex // Guards closed
+	writeMu sync.Mutex // Serializes writes to stdin
 	closed  bool
+	done    chan struct{}    // Closed by Close
+	exited  chan struct{}    // Closed when the server's output ends
+	pending *pendingRequests // In-flight requests awaiting responses
+
+	terminating atomic.Bool // A hung server is being stopped
 }
 
-// NewStdioClient creates a new stdio-based MCP client for local Python servers
-// pythonScript can be:
-//   - Just a script path: "/path/to/script.py" (uses python3)
-//   - Python interpreter and script: "/path/to/python /path/to/script.py"
-func NewStdioClient(name string, pythonScript string, logger *slog.Logger) (*StdioClient, error) {
+// NewStdioClient starts a local MCP server process and connects to its stdio.
+// The server gets the environment from server.Environ and runs in Cwd when set,
+// and is killed once it has run for its sandbox's MaxRuntime.
+// WithLauncher replaces how the process is started.
+func NewStdioClient(server ServerConfig, logger *slog.Logger, opts ...Option) (*StdioClient, error) {
 	if logger == nil {
 		return nil, fmt.Errorf("logger cannot be nil")
 	}
-
-	// Parse the pythonScript to detect if it includes a custom Python interpreter
-	var cmd *exec.Cmd
-	parts := strings.Fields(pythonScript)
-
-	if len(parts) == 0 {
-		return nil, fmt.Errorf("empty script path")
-	} else if len(parts) == 1 {
-		// Just a script path, use default python3
-		cmd = exec.Command("python3", parts[0])
-	} else {
-		// First part is Python interpreter, rest are arguments
-		cmd = exec.Command(parts[0], parts[1:]...)
-	}
-
-	stdin, err := cmd.StdinPipe()
-	if err != nil {
-		return nil, fmt.Errorf("failed to create stdin pipe: %w", err)
+	if server.Command == "" {
+		return nil, fmt.Errorf("empty command for MCP server %s", server.Name)
 	}
 
-	stdout, err := cmd.StdoutPipe()
+	o := newOptions(opts)
+	process, err := o.launcher.Launch(server)
 	if err != nil {
-		stdin.Close()
-		return nil, fmt.Errorf("failed to create stdout pipe: %w", err)
-	}
-
-	stderr, err := cmd.StderrPipe()
-	if err != nil {
-		stdin.Close()
-		stdout.Close()
-		return nil, fmt.Errorf("failed to create stderr pipe: %w", err)
-	}
-
-	if err := cmd.Start(); err != nil {
-		stdin.Close()
-		stdout.Close()
-		stderr.Close()
-		return nil, fmt.Errorf("failed to start Python process: %w", err)
+		return nil, err
 	}
 
 	client := &StdioClient{
-		name:    name,
-		cmd:     cmd,
-		stdin:   stdin,
-		stdout:  stdout,
-		stderr:  stderr,
-		scanner: bufio.NewScanner(stdout),
+		name:    server.Name,
+		command: strings.Join(append([]string{server.Command}, server.Args...), " "),
+		process: process,
+		stdin:   process.Stdin,
+		stdout:  process.Stdout,
+		stderr:  process.Stderr,
+		reader:  newFrameReader(process.Stdout),
+		framing: server.Framing,
 		reqID:   0,
 		logger:  logger,
+		clock:   o.clock,
 		closed:  false,
+		done:    make(chan struct{}),
+		exited:  make(chan struct{}),
+		pending: newPendingRequests(),
+	}
+	client.framed.Store(server.Framing == FramingContentLength)
+
+	if limit := server.Sandbox.runtime(); limit > 0 {
+		go client.killAfter(o.clock.After(limit), limit)
 	}
 
 	// Start goroutine to log stderr
 	go client.logStderr()
 
-	logger.Info("started MCP stdio client", "name", name, "script", pythonScript)
+	// Start goroutine to read responses and notifications
+	go client.readLoop()
+
+	logger.Info("started MCP stdio client", "name", server.Name, "command", server.Command, "args", server.Args, "cwd", server.Cwd)
 
 	return client, nil
 }
@@ -119,6 +124,7 @@ func (c *StdioClient) Initialize(ctx context.Context) error {
 	if err := c.sendRequest(ctx, MethodInitialize, params, &result); err != nil {
 		return fmt.Errorf("initialize failed: %w", err)
 	}
+	c.setServerInfo(result)
 
 	c.logger.Info("MCP server initialized",
 		"server", result.ServerInfo.Name,
@@ -130,7 +136,7 @@ func (c *StdioClient) Initialize(ctx context.Context) error {
 // ListTools returns available tools from this MCP server
 func (c *StdioClient) ListTools(ctx context.Context) ([]Tool, error) {
 	var result ListToolsResult
-	if err := c.sendRequest(ctx, MethodListTools, nil, &result); err != nil {
+	if err := c.sendRequest(ctx, MethodListTools, listToolsParams(ctx), &result); err != nil {
 		return nil, fmt.Errorf("list tools failed: %w", err)
 	}
 
@@ -141,6 +147,7 @@ func (c *StdioClient) ListTools(ctx context.Context) ([]Tool, error) {
 			Description: toolInfo.Description,
 			InputSchema: toolInfo.InputSchema,
 			ServerName:  c.name,
+			Annotations: toolInfo.Annotations,
 		}
 	}
 
@@ -153,6 +160,7 @@ func (c *StdioClient) CallTool(ctx context.Context, toolName string, args map[st
 	params := CallToolParams{
 		Name:      toolName,
 		Arguments: args,
+		Meta:      requestMeta(ctx),
 	}
 
 	var result CallToolResult
@@ -164,6 +172,40 @@ func (c *StdioClient) CallTool(ctx context.Context, toolName string, args map[st
 	return result, nil
 }
 
+// Ping checks that the server is responsive
+func (c *StdioClient) Ping(ctx context.Context) error {
+	if err := c.sendRequest(ctx, MethodPing, nil, nil); err != nil {
+		return fmt.Errorf("ping failed: %w", err)
+	}
+	return nil
+}
+
+// SetLogLevel sets the minimum level of log notifications the server sends
+func (c *StdioClient) SetLogLevel(ctx context.Context, level string) error {
+	if err := c.sendRequest(ctx, MethodSetLevel, SetLevelParams{Level: level}, nil); err != nil {
+		return fmt.Errorf("set log level failed: %w", err)
+	}
+	return nil
+}
+
+// Diagnostics describes the server process and its connection
+func (c *StdioClient) Diagnostics() Diagnostics {
+	d := Diagnostics{
+		Transport: TransportStdio,
+		Target:    c.command,
+		PID:       c.process.PID,
+		Framing:   FramingNewline,
+	}
+	if c.framed.Load() {
+		d.Framing = FramingContentLength
+	}
+	c.mu.Lock()
+	d.Closed = c.closed
+	c.mu.Unlock()
+	c.pending.diagnose(&d)
+	return d
+}
+
 // Close disconnects from the MCP server
 func (c *StdioClient) Close() error {
 	c.mu.Lock()
@@ -173,6 +215,7 @@ func (c *StdioClient) Close() error {
 		return nil
 	}
 	c.closed = true
+	close(c.done)
 
 	// Close pipes
 	if c.stdin != nil {
@@ -186,11 +229,13 @@ func (c *StdioClient) Close() error {
 	}
 
 	// Kill process
-	if c.cmd != nil && c.cmd.Process != nil {
-		if err := c.cmd.Process.Kill(); err != nil {
+	if c.process.Kill != nil {
+		if err := c.process.Kill(); err != nil {
 			c.logger.Warn("failed to kill MCP server process", "error", err)
 		}
-		c.cmd.Wait() // Clean up zombie process
+	}
+	if c.process.Wait != nil {
+		c.process.Wait() // Clean up zombie process
 	}
 
 	c.logger.Info("closed MCP stdio client", "name", c.name)
@@ -200,15 +245,23 @@ func (c *StdioClient) Close() error {
 // sendRequest sends a JSON-RPC request and waits for response
 func (c *StdioClient) sendRequest(ctx context.Context, method string, params interface{}, result interface{}) error {
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	closed := c.closed
+	c.mu.Unlock()
 
-	if c.closed {
+	if closed {
 		return fmt.Errorf("client is closed")
 	}
 
 	// Generate unique request ID
 	reqID := int(atomic.AddInt32(&c.reqID, 1))
 
+	// Register before sending so a fast response cannot be missed
+	respCh, err := c.pending.add(reqID)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	defer c.pending.remove(reqID)
+
 	// Build JSON-RPC request
 	request := JSONRPCRequest{
 		JSONRPC: "2.0",
@@ -217,55 +270,211 @@ func (c *StdioClient) sendRequest(ctx context.Context, method string, params int
 		Params:  params,
 	}
 
-	// Marshal request to JSON
-	requestJSON, err := json.Marshal(request)
+	// Send request; a server that stops reading its input mustn't block us
+	// past ctx
+	if err := c.writeMessage(ctx, request); err != nil {
+		if ctx.Err() != nil {
+			go c.abandon(method, reqID, ctx.Err())
+		}
+		return fmt.Errorf("failed to write request: %w", err)
+	}
+
+	// Wait for the matching response; readLoop routes it here by ID
+	select {
+	case msg, ok := <-respCh:
+		if !ok {
+			return fmt.Errorf("failed to read response: %w", c.pending.failure())
+		}
+		return decodeResult(msg, result)
+	case <-ctx.Done():
+		go c.abandon(method, reqID, ctx.Err())
+		return ctx.Err()
+	}
+}
+
+// abandon tells the server to stop working on a request we no longer wait
+// for. A server that takes neither the cancellation nor a ping within
+// cancelGrace is hung and gets terminated. Initialize must never be
+// cancelled, and an unanswered ping needs no cancellation of its own.
+func (c *StdioClient) abandon(method string, reqID int, reason error) {
+	if method == MethodInitialize || method == MethodPing {
+		return
+	}
+	ctx, cancel := c.graceContext()
+	defer cancel()
+	err := c.sendCancelled(ctx, reqID, reason)
+	if err == nil {
+		err = c.sendRequest(ctx, MethodPing, nil, nil)
+	}
+	if err == nil || c.isClosed() {
+		return
+	}
+	c.terminate(fmt.Errorf("no response to the cancellation of request %d: %w", reqID, err))
+}
+
+// sendCancelled notifies the server that we stopped waiting for a request
+func (c *StdioClient) sendCancelled(ctx context.Context, reqID int, reason error) error {
+	notification, err := newNotification(NotificationCancelled, CancelledParams{
+		RequestID: reqID,
+		Reason:    reason.Error(),
+	})
+	if err == nil {
+		err = c.writeMessage(ctx, notification)
+	}
 	if err != nil {
-		return fmt.Errorf("failed to marshal request: %w", err)
+		c.logger.Warn("failed to send cancellation to MCP server", "server", c.name, "id", reqID, "error", err)
+		return err
 	}
+	c.logger.Info("cancelled MCP request", "server", c.name, "id", reqID, "reason", reason)
+	return nil
+}
 
-	// Send request
-	if _, err := c.stdin.Write(append(requestJSON, '\n')); err != nil {
-		return fmt.Errorf("failed to write request: %w", err)
+// terminate stops a hung server: SIGTERM first, then SIGKILL if it is still
+// running after cancelGrace. Requests in flight fail as its output ends.
+func (c *StdioClient) terminate(reason error) {
+	if !c.terminating.CompareAndSwap(false, true) {
+		return
+	}
+	c.logger.Warn("terminating hung MCP server", "server", c.name, "pid", c.process.PID, "reason", reason)
+
+	if c.process.Signal != nil {
+		if err := c.process.Signal(syscall.SIGTERM); err != nil {
+			c.logger.Warn("failed to send SIGTERM to MCP server", "server", c.name, "error", err)
+		} else {
+			select {
+			case <-c.exited:
+				return
+			case <-c.done:
+				return
+			case <-c.clock.After(cancelGrace):
+			}
+		}
 	}
 
-	// Read response
-	if !c.scanner.Scan() {
-		if err := c.scanner.Err(); err != nil {
-			return fmt.Errorf("failed to read response: %w", err)
+	c.logger.Warn("killing MCP server", "server", c.name, "pid", c.process.PID)
+	if c.process.Kill != nil {
+		if err := c.process.Kill(); err != nil {
+			c.logger.Warn("failed to kill MCP server process", "server", c.name, "error", err)
 		}
-		return fmt.Errorf("EOF from MCP server")
 	}
+}
+
+// graceContext returns a context that is done after cancelGrace on the
+// client's clock
+func (c *StdioClient) graceContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		select {
+		case <-c.clock.After(cancelGrace):
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
 
-	responseJSON := c.scanner.Bytes()
+// isClosed reports whether Close was called
+func (c *StdioClient) isClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
 
-	// Parse JSON-RPC response
-	var response JSONRPCResponse
-	if err := json.Unmarshal(responseJSON, &response); err != nil {
-		return fmt.Errorf("failed to unmarshal response: %w", err)
+// writeMessage marshals a JSON-RPC message and writes it as a single line,
+// or as a Content-Length frame once the server is known to use them. The
+// write happens in the background, so it returns when ctx is done even if
+// the server doesn't read; the message is then still written once the
+// server reads again, or dropped when the client is closed.
+func (c *StdioClient) writeMessage(ctx context.Context, msg interface{}) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
 	}
 
-	// Check for JSON-RPC error
-	if response.Error != nil {
-		return fmt.Errorf("RPC error %d: %s", response.Error.Code, response.Error.Message)
+	written := make(chan error, 1)
+	go func() {
+		c.writeMu.Lock()
+		defer c.writeMu.Unlock()
+		_, err := c.stdin.Write(encodeFrame(data, c.framed.Load()))
+		written <- err
+	}()
+	select {
+	case err := <-written:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
 	}
+}
 
-	// Unmarshal result into the provided result pointer
-	if result != nil {
-		resultJSON, err := json.Marshal(response.Result)
+// readLoop reads messages from stdout until EOF, dispatching notifications
+// and server requests and forwarding responses to sendRequest
+func (c *StdioClient) readLoop() {
+	var err error
+	for {
+		var data []byte
+		var framed bool
+		data, framed, err = c.reader.next()
 		if err != nil {
-			return fmt.Errorf("failed to marshal result: %w", err)
+			break
 		}
-		if err := json.Unmarshal(resultJSON, result); err != nil {
-			return fmt.Errorf("failed to unmarshal result: %w", err)
+
+		// Answer in the framing the server speaks
+		if framed && c.framing == FramingAuto && !c.framed.Swap(true) {
+			c.logger.Info("MCP server uses Content-Length framing", "server", c.name)
+		}
+
+		var msg jsonrpcMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			c.logger.Warn("failed to unmarshal message from MCP server", "server", c.name, "error", err)
+			continue
+		}
+
+		switch {
+		case msg.isNotification():
+			c.dispatch(c.logger, c.name, msg)
+		case msg.isRequest():
+			// Replied to off the reader: a server that doesn't read its stdin
+			// while it writes would otherwise stop this loop, and every
+			// response with it
+			go func(msg jsonrpcMessage) {
+				if err := c.writeMessage(context.Background(), replyToServerRequest(msg)); err != nil {
+					c.logger.Warn("failed to reply to MCP server request", "server", c.name, "method", msg.Method, "error", err)
+				}
+			}(msg)
+		default:
+			if !c.pending.resolve(msg) {
+				c.logger.Warn("discarding unexpected response from MCP server", "server", c.name, "id", string(msg.ID))
+			}
 		}
 	}
 
-	return nil
+	if err == io.EOF {
+		err = fmt.Errorf("EOF from MCP server")
+	}
+	c.pending.failAll(err)
+	close(c.exited)
+}
+
+// killAfter kills the server process when expired fires before the client
+// is closed. Requests in flight then fail as the server's output ends.
+func (c *StdioClient) killAfter(expired <-chan time.Time, limit time.Duration) {
+	select {
+	case <-expired:
+	case <-c.done:
+		return
+	}
+	c.logger.Warn("killing MCP server after its maximum runtime", "server", c.name, "pid", c.process.PID, "max_runtime", limit)
+	if c.process.Kill != nil {
+		if err := c.process.Kill(); err != nil {
+			c.logger.Warn("failed to kill MCP server process", "server", c.name, "error", err)
+		}
+	}
 }
 
 // logStderr logs stderr output from the Python process
 func (c *StdioClient) logStderr() {
 	scanner := bufio.NewScanner(c.stderr)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
 	for scanner.Scan() {
 		c.logger.Warn("MCP server stderr", "server", c.name, "message", scanner.Text())
 	}
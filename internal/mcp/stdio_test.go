@@ -0,0 +1,409 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"ExtraChat/internal/clock"
+)
+
+// fakeServer is a stdio server run in process. handle answers a request
+// with a result, or returns false to never answer it.
+type fakeServer struct {
+	handle func(method string, params json.RawMessage) (interface{}, bool)
+
+	exitOnTerm bool // Exit on SIGTERM; otherwise only Kill stops it
+	pingFirst  bool // Send a ping before each answer, without reading stdin
+
+	mu       sync.Mutex
+	received []jsonrpcMessage // Requests and notifications, in order
+	signals  []os.Signal
+	killed   bool
+	changed  chan struct{} // Signalled on every message, signal and kill
+}
+
+// fakeLauncher starts a fakeServer in place of the server's command
+type fakeLauncher struct {
+	server *fakeServer
+	err    error
+}
+
+func (l fakeLauncher) Launch(server ServerConfig) (*Process, error) {
+	if l.err != nil {
+		return nil, l.err
+	}
+	return l.server.start(), nil
+}
+
+func newFakeServer(handle func(method string, params json.RawMessage) (interface{}, bool)) *fakeServer {
+	return &fakeServer{handle: handle, changed: make(chan struct{}, 1)}
+}
+
+// start serves on pipes until killed or its stdin closes
+func (s *fakeServer) start() *Process {
+	stdinReader, stdinWriter := io.Pipe()
+	stdoutReader, stdoutWriter := io.Pipe()
+	done := make(chan struct{})
+	var once sync.Once
+	stop := func() {
+		once.Do(func() {
+			stdinReader.Close()
+			stdoutWriter.Close()
+		})
+	}
+
+	go func() {
+		defer close(done)
+		defer stop()
+		var writeMu sync.Mutex
+		scanner := bufio.NewScanner(stdinReader)
+		for scanner.Scan() {
+			var msg jsonrpcMessage
+			if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+				continue
+			}
+			s.record(msg)
+			if msg.isNotification() {
+				continue
+			}
+			result, ok := s.handle(msg.Method, msg.Params)
+			if !ok {
+				continue
+			}
+			data, _ := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": msg.ID, "result": result})
+			writeMu.Lock()
+			if s.pingFirst {
+				ping, _ := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": "ping-" + string(msg.ID), "method": MethodPing})
+				stdoutWriter.Write(append(ping, '\n'))
+			}
+			stdoutWriter.Write(append(data, '\n'))
+			writeMu.Unlock()
+		}
+	}()
+
+	return &Process{
+		Stdin:  stdinWriter,
+		Stdout: stdoutReader,
+		Stderr: io.NopCloser(strings.NewReader("")),
+		PID:    4242,
+		Signal: func(sig os.Signal) error {
+			s.mu.Lock()
+			s.signals = append(s.signals, sig)
+			s.mu.Unlock()
+			s.notify()
+			if s.exitOnTerm && sig == syscall.SIGTERM {
+				stop()
+			}
+			return nil
+		},
+		Kill: func() error {
+			s.mu.Lock()
+			s.killed = true
+			s.mu.Unlock()
+			s.notify()
+			stop()
+			return nil
+		},
+		Wait: func() error {
+			<-done
+			return nil
+		},
+	}
+}
+
+func (s *fakeServer) record(msg jsonrpcMessage) {
+	s.mu.Lock()
+	s.received = append(s.received, msg)
+	s.mu.Unlock()
+	s.notify()
+}
+
+// notify wakes waitFor without blocking
+func (s *fakeServer) notify() {
+	select {
+	case s.changed <- struct{}{}:
+	default:
+	}
+}
+
+// waitFor waits until cond holds for the server, failing the test after a
+// few seconds
+func (s *fakeServer) waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		s.mu.Lock()
+		ok := cond()
+		s.mu.Unlock()
+		if ok {
+			return
+		}
+		select {
+		case <-s.changed:
+		case <-timeout:
+			t.Fatalf("timed out waiting for %s", what)
+		}
+	}
+}
+
+// cancelledIDs returns the request IDs of the cancellation notifications
+// received; callers hold s.mu
+func (s *fakeServer) cancelledIDs() []int {
+	var ids []int
+	for _, msg := range s.received {
+		if msg.Method == NotificationCancelled {
+			var params CancelledParams
+			json.Unmarshal(msg.Params, &params)
+			ids = append(ids, params.RequestID)
+		}
+	}
+	return ids
+}
+
+// echoTools answers initialize, ping and tools/call; the "hang" tool never
+// answers
+func echoTools(method string, params json.RawMessage) (interface{}, bool) {
+	switch method {
+	case MethodInitialize:
+		return InitializeResult{ProtocolVersion: "2024-11-05", ServerInfo: ServerInfo{Name: "fake", Version: "1"}}, true
+	case MethodCallTool:
+		var call CallToolParams
+		json.Unmarshal(params, &call)
+		if call.Name == "hang" {
+			return nil, false
+		}
+		return CallToolResult{Content: []Content{{Type: "text", Text: fmt.Sprint(call.Arguments["text"])}}}, true
+	default:
+		return struct{}{}, true
+	}
+}
+
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func TestStdioCallTool(t *testing.T) {
+	server := newFakeServer(echoTools)
+	client, err := NewStdioClient(ServerConfig{Name: "fake", Command: "fake-server"}, testLogger(), WithLauncher(fakeLauncher{server: server}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	ctx := context.Background()
+	if err := client.Initialize(ctx); err != nil {
+		t.Fatal(err)
+	}
+	result, err := client.CallTool(ctx, "echo", map[string]interface{}{"text": "hello"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content := result.(CallToolResult).Content; len(content) != 1 || content[0].Text != "hello" {
+		t.Errorf("CallTool returned %+v, want hello", result)
+	}
+}
+
+func TestStdioCallToolTimeoutSendsCancellation(t *testing.T) {
+	server := newFakeServer(echoTools)
+	client, err := NewStdioClient(ServerConfig{Name: "fake", Command: "fake-server"}, testLogger(), WithLauncher(fakeLauncher{server: server}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := client.CallTool(ctx, "hang", nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("CallTool = %v, want a deadline error", err)
+	}
+	server.waitFor(t, "the cancellation", func() bool {
+		ids := server.cancelledIDs()
+		return len(ids) == 1 && ids[0] == 1
+	})
+
+	// The server is still usable
+	if _, err := client.CallTool(context.Background(), "echo", map[string]interface{}{"text": "again"}); err != nil {
+		t.Fatalf("CallTool after a cancellation: %v", err)
+	}
+}
+
+func TestStdioServerRequestWhileServerWrites(t *testing.T) {
+	// The server's stdin is an unbuffered pipe it doesn't read while it
+	// writes, so the reply to its ping can't block reading its answer
+	server := newFakeServer(echoTools)
+	server.pingFirst = true
+	client, err := NewStdioClient(ServerConfig{Name: "fake", Command: "fake-server"}, testLogger(), WithLauncher(fakeLauncher{server: server}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := client.CallTool(ctx, "echo", map[string]interface{}{"text": "hello"}); err != nil {
+		t.Fatalf("CallTool = %v", err)
+	}
+	server.waitFor(t, "the ping reply", func() bool {
+		for _, msg := range server.received {
+			if string(msg.ID) == `"ping-1"` && msg.Method == "" {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func TestStdioLaunchFailure(t *testing.T) {
+	_, err := NewStdioClient(ServerConfig{Name: "fake", Command: "fake-server"}, testLogger(),
+		WithLauncher(fakeLauncher{err: errors.New("no such file")}))
+	if err == nil || !strings.Contains(err.Error(), "no such file") {
+		t.Fatalf("NewStdioClient = %v, want the launch error", err)
+	}
+}
+
+func TestStdioServerExitFailsPendingRequests(t *testing.T) {
+	server := newFakeServer(echoTools)
+	process := server.start()
+	client, err := NewStdioClient(ServerConfig{Name: "fake", Command: "fake-server"}, testLogger(),
+		WithLauncher(launcherFunc(func(ServerConfig) (*Process, error) { return process, nil })))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	errs := make(chan error, 1)
+	go func() {
+		_, err := client.CallTool(context.Background(), "hang", nil)
+		errs <- err
+	}()
+	server.waitFor(t, "the call", func() bool { return len(server.received) == 1 })
+	process.Kill()
+
+	select {
+	case err := <-errs:
+		if err == nil || !strings.Contains(err.Error(), "EOF") {
+			t.Errorf("CallTool = %v, want an EOF error", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("CallTool didn't fail when the server exited")
+	}
+}
+
+func TestStdioMaxRuntime(t *testing.T) {
+	clk := clock.NewFake(time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC))
+	server := newFakeServer(echoTools)
+	config := ServerConfig{Name: "fake", Command: "fake-server", Sandbox: &Sandbox{MaxRuntime: "8h"}}
+	client, err := NewStdioClient(config, testLogger(), WithLauncher(fakeLauncher{server: server}), WithClock(clk))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	clk.BlockUntil(1)
+	clk.Advance(8*time.Hour - time.Second)
+	server.mu.Lock()
+	killed := server.killed
+	server.mu.Unlock()
+	if killed {
+		t.Fatal("server killed before its maximum runtime")
+	}
+	clk.Advance(time.Second)
+	server.waitFor(t, "the kill", func() bool { return server.killed })
+}
+
+// launcherFunc launches with a function
+type launcherFunc func(ServerConfig) (*Process, error)
+
+func (f launcherFunc) Launch(server ServerConfig) (*Process, error) {
+	return f(server)
+}
+
+// freezingTools is echoTools plus a "freeze" tool that stops the server
+// reading its input until release is closed
+func freezingTools(release <-chan struct{}) func(string, json.RawMessage) (interface{}, bool) {
+	return func(method string, params json.RawMessage) (interface{}, bool) {
+		var call CallToolParams
+		json.Unmarshal(params, &call)
+		if method == MethodCallTool && call.Name == "freeze" {
+			<-release
+			return nil, false
+		}
+		return echoTools(method, params)
+	}
+}
+
+func TestStdioHungServerIsTerminated(t *testing.T) {
+	for _, exitOnTerm := range []bool{false, true} {
+		t.Run(fmt.Sprintf("exit on SIGTERM %t", exitOnTerm), func(t *testing.T) {
+			release := make(chan struct{})
+			clk := clock.NewFake(time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC))
+			server := newFakeServer(freezingTools(release))
+			server.exitOnTerm = exitOnTerm
+			client, err := NewStdioClient(ServerConfig{Name: "fake", Command: "fake-server"}, testLogger(),
+				WithLauncher(fakeLauncher{server: server}), WithClock(clk))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer client.Close()
+			defer close(release) // Before Close waits for the server
+
+			frozen := make(chan error, 1)
+			go func() {
+				_, err := client.CallTool(context.Background(), "freeze", nil)
+				frozen <- err
+			}()
+			server.waitFor(t, "the freeze", func() bool { return len(server.received) == 1 })
+
+			// The server no longer reads, so this request can't even be
+			// written; the call still returns at its deadline
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			start := time.Now()
+			if _, err := client.CallTool(ctx, "echo", nil); !errors.Is(err, context.DeadlineExceeded) {
+				t.Fatalf("CallTool = %v, want a deadline error", err)
+			}
+			if elapsed := time.Since(start); elapsed > 2*time.Second {
+				t.Fatalf("CallTool took %s on a hung server", elapsed)
+			}
+
+			// The cancellation can't be written either: SIGTERM after the grace period
+			clk.BlockUntil(1)
+			clk.Advance(cancelGrace)
+			server.waitFor(t, "SIGTERM", func() bool { return len(server.signals) == 1 && server.signals[0] == syscall.SIGTERM })
+
+			if exitOnTerm {
+				select {
+				case err := <-frozen:
+					if err == nil {
+						t.Error("the frozen call succeeded after the server exited")
+					}
+				case <-time.After(5 * time.Second):
+					t.Fatal("the frozen call didn't fail when the server exited")
+				}
+				server.mu.Lock()
+				killed := server.killed
+				server.mu.Unlock()
+				if killed {
+					t.Error("killed a server that exited on SIGTERM")
+				}
+				return
+			}
+
+			// Still running after another grace period: SIGKILL
+			clk.BlockUntil(1)
+			clk.Advance(cancelGrace)
+			server.waitFor(t, "the kill", func() bool { return server.killed })
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package mcp
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// TLSConfig is how the certificate of an https:// or wss:// server is
+// checked. Tool results go straight into prompts, so a server can be held
+// to a private CA, a pinned certificate and a minimum TLS version.
+type TLSConfig struct {
+	CAFile             string   `json:"caFile,omitempty" yaml:"caFile,omitempty"`                         // PEM bundle trusted instead of the system roots
+	PinnedSHA256       []string `json:"pinnedSHA256,omitempty" yaml:"pinnedSHA256,omitempty"`             // SHA-256 fingerprints in hex, one of which the server's certificate must have
+	MinVersion         string   `json:"minVersion,omitempty" yaml:"minVersion,omitempty"`                 // "1.2" or "1.3"; Go's default when empty
+	InsecureSkipVerify bool     `json:"insecureSkipVerify,omitempty" yaml:"insecureSkipVerify,omitempty"` // Don't verify the chain; only allowed with PinnedSHA256
+}
+
+// tlsVersions maps MinVersion values to crypto/tls versions
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// validate checks the settings of the named server without reading CAFile
+func (t *TLSConfig) validate(name string) error {
+	if _, ok := tlsVersions[t.MinVersion]; t.MinVersion != "" && !ok {
+		return fmt.Errorf("MCP server %s: unknown tls minVersion %q (expected 1.2 or 1.3)", name, t.MinVersion)
+	}
+	for _, pin := range t.PinnedSHA256 {
+		if _, err := parseFingerprint(pin); err != nil {
+			return fmt.Errorf("MCP server %s: %w", name, err)
+		}
+	}
+	if t.InsecureSkipVerify && len(t.PinnedSHA256) == 0 {
+		return fmt.Errorf("MCP server %s: tls insecureSkipVerify requires pinnedSHA256", name)
+	}
+	return nil
+}
+
+// ClientConfig returns the crypto/tls configuration for the settings
+func (t *TLSConfig) ClientConfig() (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tlsVersions[t.MinVersion]}
+
+	if t.CAFile != "" {
+		pem, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in CA file %s", t.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if len(t.PinnedSHA256) > 0 {
+		pins := make([][]byte, len(t.PinnedSHA256))
+		for i, pin := range t.PinnedSHA256 {
+			pins[i], _ = parseFingerprint(pin) // Checked by validate
+		}
+		// The chain is still verified first unless InsecureSkipVerify is set
+		cfg.InsecureSkipVerify = t.InsecureSkipVerify
+		cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 {
+				return fmt.Errorf("server sent no certificate")
+			}
+			sum := sha256.Sum256(cs.PeerCertificates[0].Raw)
+			for _, pin := range pins {
+				if bytes.Equal(sum[:], pin) {
+					return nil
+				}
+			}
+			return fmt.Errorf("certificate fingerprint %s is not pinned", hex.EncodeToString(sum[:]))
+		}
+	}
+	return cfg, nil
+}
+
+// parseFingerprint decodes a SHA-256 fingerprint written in hex, with or
+// without colons, as openssl x509 -fingerprint -sha256 prints it
+func parseFingerprint(pin string) ([]byte, error) {
+	sum, err := hex.DecodeString(strings.ReplaceAll(pin, ":", ""))
+	if err != nil || len(sum) != sha256.Size {
+		return nil, fmt.Errorf("invalid pinned SHA-256 fingerprint %q", pin)
+	}
+	return sum, nil
+}
+
+// httpTransport returns the transport for HTTP and SSE clients: the one of
+// WithTransport, or else the default transport, with the TLS settings of
+// WithTLS. An injected transport that isn't an *http.Transport can't take
+// them, which is an error rather than a server checked less than asked.
+func (o options) httpTransport() (http.RoundTripper, error) {
+	if o.tls == nil {
+		return o.transport, nil
+	}
+	base := http.DefaultTransport
+	if o.transport != nil {
+		base = o.transport
+	}
+	t, ok := base.(*http.Transport)
+	if !ok {
+		return nil, fmt.Errorf("TLS settings can't be applied to a %T transport", base)
+	}
+	transport := t.Clone()
+	transport.TLSClientConfig = o.tls
+	return transport, nil
+}
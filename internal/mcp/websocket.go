@@ -13,36 +13,53 @@ import (
 
 // WebSocketClient implements MCPClient for remote MCP servers via WebSocket
 type WebSocketClient struct {
-	name   string
-	url    string
-	conn   *websocket.Conn
-	reqID  int32
-	logger *slog.Logger
-	mu     sync.Mutex
-	closed bool
+	notifier
+	serverInfo
+
+	name    string
+	url     string
+	conn    *websocket.Conn
+	reqID   int32
+	logger  *slog.Logger
+	mu      sync.Mutex // Guards closed
+	writeMu sync.Mutex // gorilla/websocket allows only one concurrent writer
+	closed  bool
+	pending *pendingRequests // In-flight requests awaiting responses
 }
 
-// NewWebSocketClient creates a new WebSocket-based MCP client for remote servers
-func NewWebSocketClient(name string, url string, logger *slog.Logger) (*WebSocketClient, error) {
+// NewWebSocketClient creates a new WebSocket-based MCP client for remote
+// servers. WithTLS replaces how a wss:// server's certificate is checked.
+func NewWebSocketClient(name string, url string, logger *slog.Logger, opts ...Option) (*WebSocketClient, error) {
 	if logger == nil {
 		return nil, fmt.Errorf("logger cannot be nil")
 	}
 
+	dialer := websocket.DefaultDialer
+	if o := newOptions(opts); o.tls != nil {
+		withTLS := *websocket.DefaultDialer
+		withTLS.TLSClientConfig = o.tls
+		dialer = &withTLS
+	}
+
 	// Connect to WebSocket server
-	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	conn, _, err := dialer.Dial(url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to WebSocket: %w", err)
 	}
 
 	client := &WebSocketClient{
-		name:   name,
-		url:    url,
-		conn:   conn,
-		reqID:  0,
-		logger: logger,
-		closed: false,
+		name:    name,
+		url:     url,
+		conn:    conn,
+		reqID:   0,
+		logger:  logger,
+		closed:  false,
+		pending: newPendingRequests(),
 	}
 
+	// Start goroutine to read responses and notifications
+	go client.readLoop()
+
 	logger.Info("created MCP WebSocket client", "name", name, "url", url)
 	return client, nil
 }
@@ -71,6 +88,7 @@ func (c *WebSocketClient) Initialize(ctx context.Context) error {
 	if err := c.sendRequest(ctx, MethodInitialize, params, &result); err != nil {
 		return fmt.Errorf("initialize failed: %w", err)
 	}
+	c.setServerInfo(result)
 
 	c.logger.Info("MCP server initialized",
 		"server", result.ServerInfo.Name,
@@ -82,7 +100,7 @@ func (c *WebSocketClient) Initialize(ctx context.Context) error {
 // ListTools returns available tools from this MCP server
 func (c *WebSocketClient) ListTools(ctx context.Context) ([]Tool, error) {
 	var result ListToolsResult
-	if err := c.sendRequest(ctx, MethodListTools, nil, &result); err != nil {
+	if err := c.sendRequest(ctx, MethodListTools, listToolsParams(ctx), &result); err != nil {
 		return nil, fmt.Errorf("list tools failed: %w", err)
 	}
 
@@ -93,6 +111,7 @@ func (c *WebSocketClient) ListTools(ctx context.Context) ([]Tool, error) {
 			Description: toolInfo.Description,
 			InputSchema: toolInfo.InputSchema,
 			ServerName:  c.name,
+			Annotations: toolInfo.Annotations,
 		}
 	}
 
@@ -105,6 +124,7 @@ func (c *WebSocketClient) CallTool(ctx context.Context, toolName string, args ma
 	params := CallToolParams{
 		Name:      toolName,
 		Arguments: args,
+		Meta:      requestMeta(ctx),
 	}
 
 	var result CallToolResult
@@ -116,6 +136,32 @@ func (c *WebSocketClient) CallTool(ctx context.Context, toolName string, args ma
 	return result, nil
 }
 
+// Ping checks that the server is responsive
+func (c *WebSocketClient) Ping(ctx context.Context) error {
+	if err := c.sendRequest(ctx, MethodPing, nil, nil); err != nil {
+		return fmt.Errorf("ping failed: %w", err)
+	}
+	return nil
+}
+
+// SetLogLevel sets the minimum level of log notifications the server sends
+func (c *WebSocketClient) SetLogLevel(ctx context.Context, level string) error {
+	if err := c.sendRequest(ctx, MethodSetLevel, SetLevelParams{Level: level}, nil); err != nil {
+		return fmt.Errorf("set log level failed: %w", err)
+	}
+	return nil
+}
+
+// Diagnostics describes the WebSocket connection
+func (c *WebSocketClient) Diagnostics() Diagnostics {
+	d := Diagnostics{Transport: TransportWebSocket, Target: c.url}
+	c.mu.Lock()
+	d.Closed = c.closed
+	c.mu.Unlock()
+	c.pending.diagnose(&d)
+	return d
+}
+
 // Close disconnects from the MCP server
 func (c *WebSocketClient) Close() error {
 	c.mu.Lock()
@@ -128,7 +174,9 @@ func (c *WebSocketClient) Close() error {
 
 	if c.conn != nil {
 		// Send close message
+		c.writeMu.Lock()
 		c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+		c.writeMu.Unlock()
 		c.conn.Close()
 	}
 
@@ -139,15 +187,23 @@ func (c *WebSocketClient) Close() error {
 // sendRequest sends a JSON-RPC request over WebSocket
 func (c *WebSocketClient) sendRequest(ctx context.Context, method string, params interface{}, result interface{}) error {
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	closed := c.closed
+	c.mu.Unlock()
 
-	if c.closed {
+	if closed {
 		return fmt.Errorf("client is closed")
 	}
 
 	// Generate unique request ID
 	reqID := int(atomic.AddInt32(&c.reqID, 1))
 
+	// Register before sending so a fast response cannot be missed
+	respCh, err := c.pending.add(reqID)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	defer c.pending.remove(reqID)
+
 	// Build JSON-RPC request
 	request := JSONRPCRequest{
 		JSONRPC: "2.0",
@@ -157,31 +213,76 @@ func (c *WebSocketClient) sendRequest(ctx context.Context, method string, params
 	}
 
 	// Send request
-	if err := c.conn.WriteJSON(request); err != nil {
+	if err := c.writeMessage(request); err != nil {
 		return fmt.Errorf("failed to write request: %w", err)
 	}
 
-	// Read response
-	var response JSONRPCResponse
-	if err := c.conn.ReadJSON(&response); err != nil {
-		return fmt.Errorf("failed to read response: %w", err)
+	// Wait for the matching response; readLoop routes it here by ID
+	select {
+	case msg, ok := <-respCh:
+		if !ok {
+			return fmt.Errorf("failed to read response: %w", c.pending.failure())
+		}
+		return decodeResult(msg, result)
+	case <-ctx.Done():
+		// Let the server abort the work; initialize must never be cancelled
+		if method != MethodInitialize {
+			c.sendCancelled(reqID, ctx.Err())
+		}
+		return ctx.Err()
 	}
+}
 
-	// Check for JSON-RPC error
-	if response.Error != nil {
-		return fmt.Errorf("RPC error %d: %s", response.Error.Code, response.Error.Message)
+// sendCancelled notifies the server that we stopped waiting for a request
+func (c *WebSocketClient) sendCancelled(reqID int, reason error) {
+	notification, err := newNotification(NotificationCancelled, CancelledParams{
+		RequestID: reqID,
+		Reason:    reason.Error(),
+	})
+	if err == nil {
+		err = c.writeMessage(notification)
+	}
+	if err != nil {
+		c.logger.Warn("failed to send cancellation to MCP server", "server", c.name, "id", reqID, "error", err)
+		return
 	}
+	c.logger.Info("cancelled MCP request", "server", c.name, "id", reqID, "reason", reason)
+}
+
+// writeMessage writes a JSON-RPC message as a single WebSocket frame
+func (c *WebSocketClient) writeMessage(msg interface{}) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.conn.WriteJSON(msg)
+}
 
-	// Unmarshal result into the provided result pointer
-	if result != nil {
-		resultJSON, err := json.Marshal(response.Result)
+// readLoop reads frames until the connection closes, dispatching notifications
+// and server requests and forwarding responses to sendRequest
+func (c *WebSocketClient) readLoop() {
+	for {
+		_, data, err := c.conn.ReadMessage()
 		if err != nil {
-			return fmt.Errorf("failed to marshal result: %w", err)
+			c.pending.failAll(err)
+			return
+		}
+
+		var msg jsonrpcMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			c.logger.Warn("failed to unmarshal message from MCP server", "server", c.name, "error", err)
+			continue
 		}
-		if err := json.Unmarshal(resultJSON, result); err != nil {
-			return fmt.Errorf("failed to unmarshal result: %w", err)
+
+		switch {
+		case msg.isNotification():
+			c.dispatch(c.logger, c.name, msg)
+		case msg.isRequest():
+			if err := c.writeMessage(replyToServerRequest(msg)); err != nil {
+				c.logger.Warn("failed to reply to MCP server request", "server", c.name, "method", msg.Method, "error", err)
+			}
+		default:
+			if !c.pending.resolve(msg) {
+				c.logger.Warn("discarding unexpected response from MCP server", "server", c.name, "id", string(msg.ID))
+			}
 		}
 	}
-
-	return nil
 }
@@ -0,0 +1,561 @@
+// Package mcptest is a reference MCP server with configurable tools,
+// latencies and failure modes. It speaks stdio (newline-delimited or
+// Content-Length framed) and Streamable HTTP, for the selftest and for
+// debugging MCP setups without a real server.
+package mcptest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"ExtraChat/internal/mcp"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Failure modes of a tool
+const (
+	FailError    = "error"     // A tool result flagged isError
+	FailRPCError = "rpc_error" // A JSON-RPC error response
+	FailHang     = "hang"      // No response until the request is cancelled
+	FailCrash    = "crash"     // The stdio server exits; HTTP drops the connection
+)
+
+// ErrCrashed is returned by ServeStdio when a tool crashes the server
+var ErrCrashed = errors.New("MCP test server crashed on purpose")
+
+// Config is a parsed server configuration file
+type Config struct {
+	Name    string  `yaml:"name"`    // Reported by initialize; "extrachat-mcp-testserver" if empty
+	Latency string  `yaml:"latency"` // Delay before every response, e.g. "100ms"
+	Tools   []*Tool `yaml:"tools"`
+}
+
+// Tool is a configured tool. Replies are Go templates over the call's
+// arguments, e.g. "echo: {{.text}}".
+type Tool struct {
+	Name        string                 `yaml:"name"`
+	Description string                 `yaml:"description"`
+	InputSchema map[string]interface{} `yaml:"input_schema"` // JSON Schema; an open object if empty
+	Reply       string                 `yaml:"reply"`        // Empty replies with the arguments as JSON
+	Latency     string                 `yaml:"latency"`      // Delay before answering, on top of the server's
+	Failure     string                 `yaml:"failure"`      // error, rpc_error, hang or crash
+	FailAfter   int                    `yaml:"fail_after"`   // Calls answered normally before failing
+	Message     string                 `yaml:"message"`      // Text of error and rpc_error failures
+
+	reply   *template.Template
+	latency time.Duration
+}
+
+// DefaultConfig is the configuration without a file: an echo tool, a slow
+// one and one per failure mode except crash
+func DefaultConfig() *Config {
+	return &Config{Tools: []*Tool{
+		{
+			Name:        "echo",
+			Description: "Echo the given text back",
+			InputSchema: map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{"text": map[string]interface{}{"type": "string"}},
+				"required":   []interface{}{"text"},
+			},
+			Reply: "echo: {{.text}}",
+		},
+		{Name: "slow", Description: "Answer after two seconds", Reply: "done", Latency: "2s"},
+		{Name: "fail", Description: "Return a tool error", Failure: FailError, Message: "tool failed on purpose"},
+		{Name: "rpc_fail", Description: "Return a JSON-RPC error", Failure: FailRPCError, Message: "internal error on purpose"},
+		{Name: "hang", Description: "Never answer", Failure: FailHang},
+	}}
+}
+
+// LoadConfig reads a server configuration file
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read test server config: %w", err)
+	}
+	cfg := &Config{}
+	if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse test server config %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Server answers MCP requests from its configuration
+type Server struct {
+	name    string
+	latency time.Duration
+	tools   []*Tool
+	logger  *slog.Logger
+
+	mu    sync.Mutex
+	calls map[string]int // Calls by tool name
+}
+
+// New creates a server from cfg
+func New(cfg *Config, logger *slog.Logger) (*Server, error) {
+	if logger == nil {
+		return nil, fmt.Errorf("logger cannot be nil")
+	}
+	s := &Server{name: cfg.Name, tools: cfg.Tools, logger: logger, calls: make(map[string]int)}
+	if s.name == "" {
+		s.name = "extrachat-mcp-testserver"
+	}
+	if cfg.Latency != "" {
+		var err error
+		if s.latency, err = time.ParseDuration(cfg.Latency); err != nil || s.latency < 0 {
+			return nil, fmt.Errorf("invalid latency %q", cfg.Latency)
+		}
+	}
+
+	seen := make(map[string]bool)
+	for i, tool := range s.tools {
+		switch {
+		case tool.Name == "":
+			return nil, fmt.Errorf("tool %d has no name", i+1)
+		case seen[tool.Name]:
+			return nil, fmt.Errorf("duplicate tool %s", tool.Name)
+		case tool.Failure != "" && tool.Failure != FailError && tool.Failure != FailRPCError && tool.Failure != FailHang && tool.Failure != FailCrash:
+			return nil, fmt.Errorf("tool %s: unknown failure %q", tool.Name, tool.Failure)
+		case tool.FailAfter < 0:
+			return nil, fmt.Errorf("tool %s: fail_after must not be negative", tool.Name)
+		}
+		seen[tool.Name] = true
+
+		if tool.Reply != "" {
+			t, err := template.New(tool.Name).Option("missingkey=error").Parse(tool.Reply)
+			if err != nil {
+				return nil, fmt.Errorf("tool %s: failed to parse reply: %w", tool.Name, err)
+			}
+			tool.reply = t
+		}
+		if tool.Latency != "" {
+			var err error
+			if tool.latency, err = time.ParseDuration(tool.Latency); err != nil || tool.latency < 0 {
+				return nil, fmt.Errorf("tool %s: invalid latency %q", tool.Name, tool.Latency)
+			}
+		}
+		if tool.InputSchema == nil {
+			tool.InputSchema = map[string]interface{}{"type": "object"}
+		} else {
+			tool.InputSchema = jsonValue(tool.InputSchema).(map[string]interface{})
+		}
+	}
+	return s, nil
+}
+
+// SetLatency replaces the delay before every response
+func (s *Server) SetLatency(latency time.Duration) {
+	s.latency = latency
+}
+
+// Calls returns how many times tool has been called
+func (s *Server) Calls(tool string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[tool]
+}
+
+// request is an inbound JSON-RPC request or notification
+type request struct {
+	ID     json.RawMessage `json:"id,omitempty"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+func (r request) isNotification() bool {
+	return len(r.ID) == 0 || string(r.ID) == "null"
+}
+
+// response is an outbound JSON-RPC response
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *mcp.RPCError   `json:"error,omitempty"`
+}
+
+// JSON-RPC error codes the server answers with
+const (
+	errCodeInvalidParams = -32602
+	errCodeInternal      = -32603
+)
+
+// handle answers a request. It returns nil when the request was cancelled
+// while waiting, and crash when a tool asks the server to die.
+func (s *Server) handle(ctx context.Context, req request) (resp *response, crash bool) {
+	s.logger.Debug("handling MCP request", "method", req.Method, "id", string(req.ID))
+	if !wait(ctx, s.latency) {
+		return nil, false
+	}
+
+	resp = &response{JSONRPC: "2.0", ID: req.ID}
+	switch req.Method {
+	case mcp.MethodInitialize:
+		resp.Result = mcp.InitializeResult{
+			ProtocolVersion: "2024-11-05",
+			Capabilities:    mcp.ServerCapabilities{Tools: &mcp.ToolsCapability{}, Logging: &mcp.LoggingCapability{}},
+			ServerInfo:      mcp.ServerInfo{Name: s.name, Version: "1.0.0"},
+		}
+	case mcp.MethodPing, mcp.MethodSetLevel:
+		resp.Result = struct{}{}
+	case mcp.MethodListTools:
+		tools := make([]mcp.ToolInfo, len(s.tools))
+		for i, tool := range s.tools {
+			tools[i] = mcp.ToolInfo{Name: tool.Name, Description: tool.Description, InputSchema: tool.InputSchema}
+		}
+		resp.Result = mcp.ListToolsResult{Tools: tools}
+	case mcp.MethodCallTool:
+		return s.callTool(ctx, resp, req.Params)
+	default:
+		resp.Error = &mcp.RPCError{Code: mcp.ErrCodeMethodNotFound, Message: "method not found: " + req.Method}
+	}
+	return resp, false
+}
+
+// callTool runs a tool call, applying its latency and failure mode
+func (s *Server) callTool(ctx context.Context, resp *response, raw json.RawMessage) (*response, bool) {
+	var params mcp.CallToolParams
+	if err := json.Unmarshal(raw, &params); err != nil {
+		resp.Error = &mcp.RPCError{Code: errCodeInvalidParams, Message: "invalid params: " + err.Error()}
+		return resp, false
+	}
+	var tool *Tool
+	for _, t := range s.tools {
+		if t.Name == params.Name {
+			tool = t
+		}
+	}
+	if tool == nil {
+		resp.Error = &mcp.RPCError{Code: errCodeInvalidParams, Message: "unknown tool: " + params.Name}
+		return resp, false
+	}
+
+	s.mu.Lock()
+	s.calls[tool.Name]++
+	call := s.calls[tool.Name]
+	s.mu.Unlock()
+	s.logger.Info("tool called", "tool", tool.Name, "call", call)
+
+	if !wait(ctx, tool.latency) {
+		return nil, false
+	}
+
+	failure := tool.Failure
+	if call <= tool.FailAfter {
+		failure = ""
+	}
+	message := tool.Message
+	if message == "" {
+		message = fmt.Sprintf("%s failed", tool.Name)
+	}
+	switch failure {
+	case FailError:
+		resp.Result = map[string]interface{}{
+			"content": []mcp.Content{{Type: "text", Text: message}},
+			"isError": true,
+		}
+		return resp, false
+	case FailRPCError:
+		resp.Error = &mcp.RPCError{Code: errCodeInternal, Message: message}
+		return resp, false
+	case FailHang:
+		<-ctx.Done()
+		return nil, false
+	case FailCrash:
+		return nil, true
+	}
+
+	text, err := tool.render(params.Arguments)
+	if err != nil {
+		resp.Error = &mcp.RPCError{Code: errCodeInvalidParams, Message: err.Error()}
+		return resp, false
+	}
+	resp.Result = mcp.CallToolResult{Content: []mcp.Content{{Type: "text", Text: text}}}
+	return resp, false
+}
+
+// render returns the tool's reply to arguments
+func (t *Tool) render(arguments map[string]interface{}) (string, error) {
+	if t.reply == nil {
+		data, err := json.Marshal(arguments)
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal arguments: %w", err)
+		}
+		return string(data), nil
+	}
+	var reply strings.Builder
+	if err := t.reply.Execute(&reply, arguments); err != nil {
+		return "", fmt.Errorf("failed to render reply: %w", err)
+	}
+	return reply.String(), nil
+}
+
+// ServeStdio answers the requests read from r on w until r is closed and
+// the requests in flight are answered, ctx is done or a tool crashes the
+// server (ErrCrashed). Requests are answered concurrently, each in the
+// framing it arrived in.
+func (s *Server) ServeStdio(ctx context.Context, r io.Reader, w io.Writer) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type message struct {
+		data   []byte
+		framed bool
+		err    error
+	}
+	messages := make(chan message)
+	go func() {
+		reader := bufio.NewReaderSize(r, 64*1024)
+		for {
+			data, framed, err := readMessage(reader)
+			select {
+			case messages <- message{data, framed, err}:
+			case <-ctx.Done():
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	var (
+		writeMu  sync.Mutex
+		inflight = make(map[string]context.CancelFunc) // By request ID
+		mu       sync.Mutex
+		crashed  = make(chan struct{})
+		once     sync.Once
+		wg       sync.WaitGroup
+	)
+	for {
+		var msg message
+		select {
+		case msg = <-messages:
+		case <-crashed:
+			return ErrCrashed
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if msg.err == io.EOF {
+			done := make(chan struct{})
+			go func() {
+				wg.Wait()
+				close(done)
+			}()
+			select {
+			case <-done:
+				return nil
+			case <-crashed:
+				return ErrCrashed
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if msg.err != nil {
+			return msg.err
+		}
+
+		var req request
+		if err := json.Unmarshal(msg.data, &req); err != nil {
+			s.logger.Warn("failed to unmarshal request", "error", err)
+			continue
+		}
+		if req.isNotification() {
+			if req.Method == mcp.NotificationCancelled {
+				var params struct {
+					RequestID json.RawMessage `json:"requestId"`
+				}
+				json.Unmarshal(req.Params, &params)
+				mu.Lock()
+				if cancelRequest, ok := inflight[string(params.RequestID)]; ok {
+					cancelRequest()
+				}
+				mu.Unlock()
+			}
+			continue
+		}
+
+		reqCtx, cancelRequest := context.WithCancel(ctx)
+		mu.Lock()
+		inflight[string(req.ID)] = cancelRequest
+		mu.Unlock()
+		wg.Add(1)
+		go func(req request, framed bool) {
+			defer wg.Done()
+			defer func() {
+				mu.Lock()
+				delete(inflight, string(req.ID))
+				mu.Unlock()
+				cancelRequest()
+			}()
+			resp, crash := s.handle(reqCtx, req)
+			if crash {
+				once.Do(func() { close(crashed) })
+				return
+			}
+			if resp == nil {
+				return
+			}
+			data, err := json.Marshal(resp)
+			if err != nil {
+				s.logger.Error("failed to marshal response", "error", err)
+				return
+			}
+			writeMu.Lock()
+			defer writeMu.Unlock()
+			if _, err := w.Write(encodeFrame(data, framed)); err != nil {
+				s.logger.Warn("failed to write response", "error", err)
+			}
+		}(req, msg.framed)
+	}
+}
+
+// Handler serves Streamable HTTP on /mcp. Requests to /mcp/rpc are served
+// too, for clients that append it to the configured URL.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /mcp", s.handleHTTP)
+	mux.HandleFunc("POST /mcp/rpc", s.handleHTTP)
+	// No server-initiated stream is offered
+	mux.HandleFunc("GET /mcp", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	})
+	return mux
+}
+
+// handleHTTP answers one request posted to the endpoint
+func (s *Server) handleHTTP(w http.ResponseWriter, r *http.Request) {
+	var req request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	if req.isNotification() {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	resp, crash := s.handle(r.Context(), req)
+	if crash {
+		// Drop the connection without a response
+		if hijacker, ok := w.(http.Hijacker); ok {
+			if conn, _, err := hijacker.Hijack(); err == nil {
+				conn.Close()
+				return
+			}
+		}
+		panic(http.ErrAbortHandler)
+	}
+	if resp == nil {
+		return
+	}
+
+	if req.Method == mcp.MethodInitialize {
+		w.Header().Set("Mcp-Session-Id", strconv.FormatInt(time.Now().UnixNano(), 36))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		s.logger.Warn("failed to write response", "error", err)
+	}
+}
+
+// wait sleeps for d, reporting false if ctx is done first
+func wait(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// readMessage reads a newline-delimited or Content-Length framed message,
+// reporting which
+func readMessage(r *bufio.Reader) ([]byte, bool, error) {
+	for {
+		line, err := r.ReadBytes('\n')
+		if err != nil && (err != io.EOF || len(bytes.TrimSpace(line)) == 0) {
+			return nil, false, err
+		}
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		name, value, ok := strings.Cut(string(line), ":")
+		if !ok || !strings.EqualFold(strings.TrimSpace(name), "Content-Length") {
+			return line, false, nil
+		}
+
+		length, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || length < 0 {
+			return nil, false, fmt.Errorf("invalid Content-Length header %q", line)
+		}
+		// Skip the remaining headers up to the blank line
+		for {
+			header, err := r.ReadBytes('\n')
+			if err != nil {
+				return nil, false, err
+			}
+			if len(bytes.TrimSpace(header)) == 0 {
+				break
+			}
+		}
+		body := make([]byte, length)
+		if _, err := io.ReadFull(r, body); err != nil {
+			return nil, false, fmt.Errorf("failed to read framed message: %w", err)
+		}
+		return body, true, nil
+	}
+}
+
+// encodeFrame frames a marshaled response like the request it answers
+func encodeFrame(data []byte, contentLength bool) []byte {
+	if !contentLength {
+		return append(data, '\n')
+	}
+	return append([]byte(fmt.Sprintf("Content-Length: %d\r\n\r\n", len(data))), data...)
+}
+
+// jsonValue converts the maps YAML decodes into ones JSON can encode
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, value := range v {
+			m[fmt.Sprint(k)] = jsonValue(value)
+		}
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, value := range v {
+			m[k] = jsonValue(value)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(v))
+		for i, value := range v {
+			s[i] = jsonValue(value)
+		}
+		return s
+	}
+	return v
+}
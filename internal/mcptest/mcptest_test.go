@@ -0,0 +1,141 @@
+package mcptest
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"ExtraChat/internal/mcp"
+	"ExtraChat/internal/vcr"
+)
+
+// pipeLauncher runs a test server in process, connected by pipes, in
+// place of a stdio server's command
+type pipeLauncher struct {
+	server *Server
+}
+
+// Launch starts serving; killing the process stops the server
+func (l pipeLauncher) Launch(server mcp.ServerConfig) (*mcp.Process, error) {
+	stdinReader, stdinWriter := io.Pipe()
+	stdoutReader, stdoutWriter := io.Pipe()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		l.server.ServeStdio(ctx, stdinReader, stdoutWriter)
+		// Like an exiting process, close the pipes
+		stdoutWriter.Close()
+		stdinReader.Close()
+	}()
+	return &mcp.Process{
+		Stdin:  stdinWriter,
+		Stdout: stdoutReader,
+		Stderr: io.NopCloser(strings.NewReader("")),
+		Kill: func() error {
+			cancel()
+			return nil
+		},
+		Wait: func() error {
+			<-done
+			return nil
+		},
+	}, nil
+}
+
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+// newCrashingServer is the default server with a tool that crashes it on
+// its second call
+func newCrashingServer(t *testing.T) *Server {
+	t.Helper()
+	cfg := DefaultConfig()
+	cfg.Tools = append(cfg.Tools, &Tool{Name: "crash", Reply: "alive", Failure: FailCrash, FailAfter: 1})
+	s, err := New(cfg, testLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestServerOverStdioAndHTTP(t *testing.T) {
+	ctx := context.Background()
+	// One server per transport, so each sees its own crash
+	endpoint := httptest.NewServer(newCrashingServer(t).Handler())
+	defer endpoint.Close()
+	httpClient, err := mcp.NewHTTPClient("testserver-http", endpoint.URL+"/mcp", testLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer httpClient.Close()
+	stdioClient, err := mcp.NewStdioClient(mcp.ServerConfig{Name: "testserver-stdio", Command: "mcp-testserver"}, testLogger(),
+		mcp.WithLauncher(pipeLauncher{newCrashingServer(t)}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdioClient.Close()
+
+	for _, client := range []mcp.MCPClient{httpClient, stdioClient} {
+		if err := client.Initialize(ctx); err != nil {
+			t.Fatalf("%s: %v", client.Name(), err)
+		}
+		if tools, err := client.ListTools(ctx); err != nil || len(tools) != 6 {
+			t.Errorf("%s: listed %d tools (%v), want 6", client.Name(), len(tools), err)
+		}
+		result, err := client.CallTool(ctx, "echo", map[string]interface{}{"text": "over the wire"})
+		if err != nil || !strings.Contains(fmt.Sprint(result), "echo: over the wire") {
+			t.Errorf("%s: echo %v (%v)", client.Name(), result, err)
+		}
+		if _, err := client.CallTool(ctx, "rpc_fail", nil); err == nil || !strings.Contains(err.Error(), "internal error on purpose") {
+			t.Errorf("%s: rpc_fail = %v, want the RPC error", client.Name(), err)
+		}
+		hangCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		_, err = client.CallTool(hangCtx, "hang", nil)
+		cancel()
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("%s: hang = %v, want a timeout", client.Name(), err)
+		}
+		if result, err := client.CallTool(ctx, "crash", nil); err != nil || !strings.Contains(fmt.Sprint(result), "alive") {
+			t.Errorf("%s: first crash call = %v (%v), want it to succeed", client.Name(), result, err)
+		}
+		if _, err := client.CallTool(ctx, "crash", nil); err == nil {
+			t.Errorf("%s: the crash didn't fail the call", client.Name())
+		}
+	}
+
+	// The crashed stdio server is gone; the HTTP one only dropped a connection
+	if err := stdioClient.Ping(ctx); err == nil {
+		t.Error("the crashed stdio server is still reachable")
+	}
+	if err := httpClient.Ping(ctx); err != nil {
+		t.Errorf("the HTTP server is unreachable after the crash: %v", err)
+	}
+}
+
+func TestTLSOnInjectedTransports(t *testing.T) {
+	endpoint := httptest.NewServer(newCrashingServer(t).Handler())
+	defer endpoint.Close()
+
+	// TLS settings go onto an injected transport, or the client fails
+	recorder, err := vcr.New(vcr.ModeRecord, t.TempDir(), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pinned := mcp.WithTLS(&tls.Config{MinVersion: tls.VersionTLS13})
+	if _, err := mcp.NewHTTPClient("pinned", endpoint.URL+"/mcp", testLogger(), mcp.WithTransport(recorder), pinned); err == nil {
+		t.Error("TLS settings were accepted for a recorder transport")
+	}
+	if _, err := mcp.NewHTTPClient("pinned", endpoint.URL+"/mcp", testLogger(), mcp.WithTransport(&http.Transport{}), pinned); err != nil {
+		t.Error(err)
+	}
+}
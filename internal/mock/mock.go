@@ -0,0 +1,255 @@
+// Package mock is the offline backend: it answers from a fixture file of
+// canned and scripted replies, or echoes the prompt, with optional latency
+// and injected failures, so everything around the LLM APIs can be exercised
+// without a network or API keys.
+package mock
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Fixtures is a parsed fixture file
+type Fixtures struct {
+	Rules   []*Rule  `yaml:"rules"`   // Tried in order against the prompt; the first match answers
+	Script  []string `yaml:"script"`  // Replies to the prompts no rule matches, in order
+	Default string   `yaml:"default"` // Reply once the script is used up; empty echoes the prompt
+}
+
+// Rule answers the prompts matching a pattern. Replies are Go templates
+// that can use {{.prompt}}, {{.model}} and, after a tool call, {{.result}}.
+type Rule struct {
+	Match     string                 `yaml:"match"`     // Regexp the last user message matches; empty matches all
+	Reply     string                 `yaml:"reply"`     // Reply to every match
+	Replies   []string               `yaml:"replies"`   // Replies to the matches in turn, the last one repeating
+	Tool      string                 `yaml:"tool"`      // MCP tool called before replying
+	Arguments map[string]interface{} `yaml:"arguments"` // Arguments of the tool call, templates like the replies
+	Error     string                 `yaml:"error"`     // Fail with this message instead of replying
+	Status    int                    `yaml:"status"`    // HTTP status of the failure; 0 for 500
+	Latency   string                 `yaml:"latency"`   // Overrides the backend's latency, e.g. "2s"
+
+	match   *regexp.Regexp
+	replies []*template.Template
+	latency time.Duration
+	calls   int
+}
+
+// Failure is a scripted or injected error, reported like a failed API
+// response
+type Failure struct {
+	Status  int
+	Message string
+}
+
+func (f *Failure) Error() string {
+	return fmt.Sprintf("mock error: %d %s - %s", f.Status, http.StatusText(f.Status), f.Message)
+}
+
+// Turn is how the backend answers a prompt: optionally after a tool call,
+// with a reply rendered once the tool's result is in
+type Turn struct {
+	Tool      string
+	Arguments map[string]interface{}
+	Latency   time.Duration
+
+	reply *template.Template // nil echoes the prompt
+	data  map[string]interface{}
+}
+
+// Backend answers prompts; it keeps the position in the script and in
+// each rule's replies
+type Backend struct {
+	mu        sync.Mutex
+	fixtures  *Fixtures
+	script    []*template.Template
+	fallback  *template.Template // nil echoes the prompt
+	next      int                // Next reply of the script
+	latency   time.Duration
+	errorRate int // Percentage of requests failing with a 503
+	rand      *rand.Rand
+}
+
+// New creates a backend answering from the fixture file at path, or echoing
+// every prompt if path is empty. errorPercent of the requests fail.
+func New(path string, latency time.Duration, errorPercent int) (*Backend, error) {
+	if errorPercent < 0 || errorPercent > 100 {
+		return nil, fmt.Errorf("error percentage must be from 0 to 100, got %d", errorPercent)
+	}
+	b := &Backend{
+		fixtures:  &Fixtures{},
+		latency:   latency,
+		errorRate: errorPercent,
+		rand:      rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	if path == "" {
+		return b, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mock fixtures: %w", err)
+	}
+	if err := yaml.UnmarshalStrict(data, b.fixtures); err != nil {
+		return nil, fmt.Errorf("failed to parse mock fixtures %s: %w", path, err)
+	}
+	if err := b.compile(); err != nil {
+		return nil, fmt.Errorf("invalid mock fixtures %s: %w", path, err)
+	}
+	return b, nil
+}
+
+// compile checks the fixtures and parses their templates
+func (b *Backend) compile() error {
+	for i, rule := range b.fixtures.Rules {
+		name := fmt.Sprintf("rule %d", i+1)
+		var err error
+		if rule.match, err = regexp.Compile(rule.Match); err != nil {
+			return fmt.Errorf("%s: invalid match: %w", name, err)
+		}
+		replies := rule.Replies
+		if rule.Reply != "" {
+			replies = append([]string{rule.Reply}, replies...)
+		}
+		switch {
+		case len(replies) == 0 && rule.Error == "":
+			return fmt.Errorf("%s has no reply, replies or error", name)
+		case len(replies) > 0 && rule.Error != "":
+			return fmt.Errorf("%s has both a reply and an error", name)
+		case rule.Status != 0 && rule.Error == "":
+			return fmt.Errorf("%s: status applies to an error", name)
+		case rule.Status != 0 && (rule.Status < 400 || rule.Status > 599):
+			return fmt.Errorf("%s: status must be an HTTP error status, got %d", name, rule.Status)
+		case len(rule.Arguments) > 0 && rule.Tool == "":
+			return fmt.Errorf("%s: arguments apply to a tool", name)
+		}
+		for _, reply := range replies {
+			t, err := parse(name, reply)
+			if err != nil {
+				return err
+			}
+			rule.replies = append(rule.replies, t)
+		}
+		if rule.Latency != "" {
+			if rule.latency, err = time.ParseDuration(rule.Latency); err != nil || rule.latency < 0 {
+				return fmt.Errorf("%s: invalid latency %q", name, rule.Latency)
+			}
+		}
+	}
+	for i, reply := range b.fixtures.Script {
+		t, err := parse(fmt.Sprintf("script reply %d", i+1), reply)
+		if err != nil {
+			return err
+		}
+		b.script = append(b.script, t)
+	}
+	if b.fixtures.Default != "" {
+		t, err := parse("default", b.fixtures.Default)
+		if err != nil {
+			return err
+		}
+		b.fallback = t
+	}
+	return nil
+}
+
+// parse compiles a reply template that fails on undefined names
+func parse(name, text string) (*template.Template, error) {
+	t, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("%s: failed to parse template: %w", name, err)
+	}
+	return t, nil
+}
+
+// Respond decides how to answer prompt on model: a rule's reply, error or
+// tool call, the next reply of the script, or the default. Injected
+// failures come first. The turn is returned with failures too, for its
+// latency.
+func (b *Backend) Respond(prompt, model string) (*Turn, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	turn := &Turn{Latency: b.latency, data: map[string]interface{}{"prompt": prompt, "model": model, "result": ""}}
+	if b.errorRate > 0 && b.rand.Intn(100) < b.errorRate {
+		return turn, &Failure{Status: http.StatusServiceUnavailable, Message: "injected failure"}
+	}
+
+	for _, rule := range b.fixtures.Rules {
+		if !rule.match.MatchString(prompt) {
+			continue
+		}
+		if rule.Latency != "" {
+			turn.Latency = rule.latency
+		}
+		if rule.Error != "" {
+			status := rule.Status
+			if status == 0 {
+				status = http.StatusInternalServerError
+			}
+			return turn, &Failure{Status: status, Message: rule.Error}
+		}
+		turn.reply = rule.replies[min(rule.calls, len(rule.replies)-1)]
+		rule.calls++
+		if rule.Tool != "" {
+			arguments, err := renderArguments(rule.Arguments, turn.data)
+			if err != nil {
+				return nil, err
+			}
+			turn.Tool, turn.Arguments = rule.Tool, arguments
+		}
+		return turn, nil
+	}
+
+	if b.next < len(b.script) {
+		turn.reply = b.script[b.next]
+		b.next++
+		return turn, nil
+	}
+	turn.reply = b.fallback
+	return turn, nil
+}
+
+// Reply renders the turn's reply with the result of its tool call, if any
+func (t *Turn) Reply(result string) (string, error) {
+	if t.reply == nil {
+		return fmt.Sprintf("mock(%s): %s", t.data["model"], t.data["prompt"]), nil
+	}
+	t.data["result"] = result
+	var reply strings.Builder
+	if err := t.reply.Execute(&reply, t.data); err != nil {
+		return "", fmt.Errorf("failed to render mock reply: %w", err)
+	}
+	return reply.String(), nil
+}
+
+// renderArguments fills in the string arguments of a tool call, which are
+// templates like the replies
+func renderArguments(arguments map[string]interface{}, data map[string]interface{}) (map[string]interface{}, error) {
+	rendered := make(map[string]interface{}, len(arguments))
+	for name, value := range arguments {
+		text, ok := value.(string)
+		if !ok {
+			rendered[name] = value
+			continue
+		}
+		t, err := parse("argument "+name, text)
+		if err != nil {
+			return nil, err
+		}
+		var b strings.Builder
+		if err := t.Execute(&b, data); err != nil {
+			return nil, fmt.Errorf("failed to render argument %s: %w", name, err)
+		}
+		rendered[name] = b.String()
+	}
+	return rendered, nil
+}
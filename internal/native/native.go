@@ -0,0 +1,253 @@
+package native
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"ExtraChat/internal/mcp"
+	"ExtraChat/internal/web"
+)
+
+// ServerName is the registry name of the built-in tool pack
+const ServerName = "builtin"
+
+// maxOutputBytes caps file contents, command output and fetched bodies
+// returned to the model
+const maxOutputBytes = 256 * 1024
+
+// RunCommandTool is the tool that runs shell commands; it is never approved
+// by a "*" wildcard
+const RunCommandTool = "run_command"
+
+// tool is one built-in tool
+type tool struct {
+	description string
+	schema      map[string]interface{}
+	tier        string // Permission tier, announced as annotations
+	run         func(ctx context.Context, args map[string]interface{}) (string, error)
+}
+
+// Client implements mcp.MCPClient for tools that run in-process, so they are
+// listed, confirmed, validated and audited exactly like MCP server tools.
+// File tools are confined to a sandbox root.
+type Client struct {
+	root        string // Absolute, symlink-free sandbox root
+	httpClient  *http.Client
+	fetchLimits func() web.Limits
+	tools       map[string]tool
+	logger      *slog.Logger
+}
+
+// NewClient creates the built-in tool pack rooted at root. fetch_url sends
+// its requests with httpClient, whose transport should dial with
+// web.DialContext, and calls fetchLimits every time, so changed limits apply
+// at once.
+func NewClient(root string, httpClient *http.Client, fetchLimits func() web.Limits, logger *slog.Logger) (*Client, error) {
+	if logger == nil {
+		return nil, fmt.Errorf("logger cannot be nil")
+	}
+	if httpClient == nil {
+		return nil, fmt.Errorf("HTTP client cannot be nil")
+	}
+
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve sandbox root: %w", err)
+	}
+	if err := os.MkdirAll(abs, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create sandbox root: %w", err)
+	}
+	abs, err = filepath.EvalSymlinks(abs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve sandbox root: %w", err)
+	}
+
+	c := &Client{root: abs, httpClient: httpClient, fetchLimits: fetchLimits, logger: logger}
+	c.tools = map[string]tool{
+		"read_file": {
+			description: "Read a text file inside the sandbox directory",
+			schema: objectSchema(map[string]interface{}{
+				"path": stringProperty("File path, relative to the sandbox directory"),
+			}, "path"),
+			tier: mcp.TierRead,
+			run:  c.readFile,
+		},
+		"write_file": {
+			description: "Create or overwrite a text file inside the sandbox directory",
+			schema: objectSchema(map[string]interface{}{
+				"path":    stringProperty("File path, relative to the sandbox directory"),
+				"content": stringProperty("Full new contents of the file"),
+			}, "path", "content"),
+			tier: mcp.TierDestructive, // It may overwrite
+			run:  c.writeFile,
+		},
+		RunCommandTool: {
+			description: "Run a shell command in the sandbox directory and return its exit status and combined output",
+			schema: objectSchema(map[string]interface{}{
+				"command": stringProperty("Command line passed to sh -c"),
+			}, "command"),
+			tier: mcp.TierDestructive,
+			run:  c.runCommand,
+		},
+		"fetch_url": {
+			description: "Fetch an http or https URL with GET and return its readable text: HTML pages without navigation, scripts and other boilerplate, PDF text, or text bodies as they are",
+			schema: objectSchema(map[string]interface{}{
+				"url": stringProperty("URL to fetch"),
+			}, "url"),
+			tier: mcp.TierRead,
+			run:  c.fetchURL,
+		},
+	}
+
+	logger.Info("created built-in tool pack", "root", abs)
+	return c, nil
+}
+
+// Name returns the client identifier
+func (c *Client) Name() string {
+	return ServerName
+}
+
+// Initialize has nothing to connect to
+func (c *Client) Initialize(ctx context.Context) error {
+	return nil
+}
+
+// ListTools returns the built-in tools
+func (c *Client) ListTools(ctx context.Context) ([]mcp.Tool, error) {
+	tools := make([]mcp.Tool, 0, len(c.tools))
+	for name, t := range c.tools {
+		tools = append(tools, mcp.Tool{
+			Name:        name,
+			Description: t.description,
+			InputSchema: t.schema,
+			ServerName:  ServerName,
+			Annotations: tierAnnotations(t.tier),
+		})
+	}
+	sort.Slice(tools, func(i, j int) bool {
+		return tools[i].Name < tools[j].Name
+	})
+	return tools, nil
+}
+
+// tierAnnotations returns the annotations that classify a tool into tier
+func tierAnnotations(tier string) *mcp.ToolAnnotations {
+	readOnly, destructive := tier == mcp.TierRead, tier == mcp.TierDestructive
+	return &mcp.ToolAnnotations{ReadOnlyHint: &readOnly, DestructiveHint: &destructive}
+}
+
+// CallTool runs a built-in tool, returning an MCP-shaped result
+func (c *Client) CallTool(ctx context.Context, toolName string, args map[string]interface{}) (interface{}, error) {
+	t, ok := c.tools[toolName]
+	if !ok {
+		return nil, fmt.Errorf("unknown tool: %s", toolName)
+	}
+
+	text, err := t.run(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+
+	c.logger.Info("called built-in tool", "tool", toolName)
+	return mcp.CallToolResult{Content: []mcp.Content{{Type: "text", Text: text}}}, nil
+}
+
+// Close has nothing to release
+func (c *Client) Close() error {
+	return nil
+}
+
+// SetNotificationHandler is a no-op; built-in tools send no notifications
+func (c *Client) SetNotificationHandler(handler mcp.NotificationHandler) {}
+
+// Ping always succeeds
+func (c *Client) Ping(ctx context.Context) error {
+	return nil
+}
+
+// ServerInfo describes the tool pack as an MCP server
+func (c *Client) ServerInfo() mcp.InitializeResult {
+	return mcp.InitializeResult{
+		Capabilities: mcp.ServerCapabilities{Tools: &mcp.ToolsCapability{}},
+		ServerInfo:   mcp.ServerInfo{Name: "extrachat-builtin", Version: "1.0.0"},
+	}
+}
+
+// SetLogLevel is unsupported; the tool pack logs to our own logger
+func (c *Client) SetLogLevel(ctx context.Context, level string) error {
+	return fmt.Errorf("logging is not supported by the built-in tools")
+}
+
+// Diagnostics describes the in-process tool pack
+func (c *Client) Diagnostics() mcp.Diagnostics {
+	return mcp.Diagnostics{Transport: "builtin", Target: c.root}
+}
+
+// resolve maps a model-supplied path to an absolute path inside the sandbox.
+// Symlinks are resolved on the longest existing prefix so a link can't be
+// used to escape the root.
+func (c *Client) resolve(path string) (string, error) {
+	if path == "" {
+		return "", fmt.Errorf("path is required")
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(c.root, path)
+	}
+	path = filepath.Clean(path)
+
+	existing, rest := path, ""
+	for {
+		if _, err := os.Lstat(existing); err == nil {
+			break
+		}
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			break
+		}
+		rest = filepath.Join(filepath.Base(existing), rest)
+		existing = parent
+	}
+	resolved, err := filepath.EvalSymlinks(existing)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s: %w", path, err)
+	}
+	resolved = filepath.Join(resolved, rest)
+
+	rel, err := filepath.Rel(c.root, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("path %s is outside the sandbox directory", path)
+	}
+	return resolved, nil
+}
+
+// objectSchema builds an object input schema
+func objectSchema(properties map[string]interface{}, required ...string) map[string]interface{} {
+	req := make([]interface{}, len(required))
+	for i, name := range required {
+		req[i] = name
+	}
+	return map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"required":             req,
+		"additionalProperties": false,
+	}
+}
+
+// stringProperty builds a string property schema
+func stringProperty(description string) map[string]interface{} {
+	return map[string]interface{}{"type": "string", "description": description}
+}
+
+// stringArg returns a string argument; the schema has already been validated
+func stringArg(args map[string]interface{}, name string) string {
+	s, _ := args[name].(string)
+	return s
+}
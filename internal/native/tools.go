@@ -0,0 +1,124 @@
+package native
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"ExtraChat/internal/web"
+)
+
+// readFile implements read_file
+func (c *Client) readFile(ctx context.Context, args map[string]interface{}) (string, error) {
+	path, err := c.resolve(stringArg(args, "path"))
+	if err != nil {
+		return "", err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, maxOutputBytes+1))
+	if err != nil {
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+	return truncate(data), nil
+}
+
+// writeFile implements write_file
+func (c *Client) writeFile(ctx context.Context, args map[string]interface{}) (string, error) {
+	path, err := c.resolve(stringArg(args, "path"))
+	if err != nil {
+		return "", err
+	}
+	content := stringArg(args, "content")
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("failed to create directory: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		return "", fmt.Errorf("failed to write file: %w", err)
+	}
+
+	rel, _ := filepath.Rel(c.root, path)
+	return fmt.Sprintf("wrote %d bytes to %s", len(content), rel), nil
+}
+
+// runCommand implements run_command. A non-zero exit is reported in the
+// result rather than as an error so the model sees the output.
+func (c *Client) runCommand(ctx context.Context, args map[string]interface{}) (string, error) {
+	cmd := exec.CommandContext(ctx, "sh", "-c", stringArg(args, "command"))
+	cmd.Dir = c.root
+
+	// One byte past the limit, so truncate marks the cut
+	output := &limitedBuffer{max: maxOutputBytes + 1}
+	cmd.Stdout = output
+	cmd.Stderr = output
+
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return "exit status 0\n" + truncate(output.Bytes()), nil
+	case ctx.Err() != nil:
+		return "", fmt.Errorf("command interrupted: %w", ctx.Err())
+	case errors.As(err, &exitErr):
+		return fmt.Sprintf("exit status %d\n%s", exitErr.ExitCode(), truncate(output.Bytes())), nil
+	default:
+		return "", fmt.Errorf("failed to run command: %w", err)
+	}
+}
+
+// fetchURL implements fetch_url
+func (c *Client) fetchURL(ctx context.Context, args map[string]interface{}) (string, error) {
+	page, err := web.Fetch(ctx, c.httpClient, stringArg(args, "url"), c.fetchLimits())
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "HTTP %d %s\n", page.Status, page.ContentType)
+	if page.Title != "" {
+		fmt.Fprintf(&b, "Title: %s\n", page.Title)
+	}
+	if page.Truncated {
+		b.WriteString("[page cut at the fetch size limit]\n")
+	}
+	b.WriteString("\n")
+	b.WriteString(truncate([]byte(page.Text)))
+	return b.String(), nil
+}
+
+// limitedBuffer keeps the first max bytes written to it and drops the
+// rest, so a command can't fill memory with output the model never sees
+type limitedBuffer struct {
+	bytes.Buffer
+	max int
+}
+
+// Write stores what fits and reports every byte written, so the command
+// isn't stopped by a failed write
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.Len(); room < len(p) {
+		b.Buffer.Write(p[:max(room, 0)])
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
+
+// truncate converts output to text, marking it when cut at maxOutputBytes
+func truncate(data []byte) string {
+	if len(data) > maxOutputBytes {
+		return string(data[:maxOutputBytes]) + "\n[truncated]"
+	}
+	return string(data)
+}
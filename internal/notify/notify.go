@@ -0,0 +1,97 @@
+// Package notify shows desktop notifications using the platform's
+// notification command, falling back to the OSC 9 terminal escape
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// appName is the application notifications are shown for
+const appName = "extrachat"
+
+// windowsAppID is the AppUserModelID of PowerShell. Windows only shows toasts
+// of registered applications, and every Windows install has this one.
+const windowsAppID = `{1AC14E77-02E7-4E5D-B744-2EB1AE5198B7}\WindowsPowerShell\v1.0\powershell.exe`
+
+// windowsToast shows a toast with the title and body taken from the
+// environment, so they need no quoting
+const windowsToast = `[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] > $null
+$xml = [Windows.UI.Notifications.ToastNotificationManager]::GetTemplateContent([Windows.UI.Notifications.ToastTemplateType]::ToastText02)
+$text = $xml.GetElementsByTagName('text')
+$text.Item(0).AppendChild($xml.CreateTextNode($env:EXTRACHAT_NOTIFY_TITLE)) > $null
+$text.Item(1).AppendChild($xml.CreateTextNode($env:EXTRACHAT_NOTIFY_BODY)) > $null
+[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier('` + windowsAppID + `').Show([Windows.UI.Notifications.ToastNotification]::new($xml))`
+
+// command is a notification tool; the title and body are appended to args,
+// or passed in the environment with env
+type command struct {
+	name string
+	args []string
+	env  bool
+}
+
+// commands returns the notification tools to try on the current platform,
+// in order of preference
+func commands() []command {
+	switch runtime.GOOS {
+	case "darwin":
+		// The title and body are passed as arguments of the script, so they
+		// need no AppleScript quoting
+		return []command{{name: "osascript", args: []string{
+			"-e", "on run argv",
+			"-e", "display notification (item 2 of argv) with title (item 1 of argv)",
+			"-e", "end run",
+		}}}
+	case "windows":
+		return []command{{name: "powershell.exe", args: []string{"-NoProfile", "-NonInteractive", "-Command", windowsToast}, env: true}}
+	}
+	return []command{{name: "notify-send", args: []string{"--app-name=" + appName}}}
+}
+
+// Send shows a notification and returns the method used. Without a
+// notification tool (e.g. over SSH) it writes an OSC 9 escape to terminal,
+// which iTerm2, kitty, WezTerm and Windows Terminal show as a notification;
+// terminal may be nil to disable that fallback.
+func Send(title, body string, terminal io.Writer) (string, error) {
+	var errs []error
+	for _, c := range commands() {
+		path, err := exec.LookPath(c.name)
+		if err != nil {
+			continue
+		}
+		cmd := exec.Command(path, c.args...)
+		if c.env {
+			cmd.Env = append(cmd.Environ(), "EXTRACHAT_NOTIFY_TITLE="+title, "EXTRACHAT_NOTIFY_BODY="+body)
+		} else {
+			cmd.Args = append(cmd.Args, title, body)
+		}
+		if out, err := cmd.CombinedOutput(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w: %s", c.name, err, strings.TrimSpace(string(out))))
+			continue
+		}
+		return c.name, nil
+	}
+
+	if terminal == nil {
+		if len(errs) > 0 {
+			return "", fmt.Errorf("failed to show notification: %w", errors.Join(errs...))
+		}
+		return "", fmt.Errorf("no notification tool found")
+	}
+	// Control characters would end the escape early
+	text := strings.Map(func(r rune) rune {
+		if r < ' ' || r == 0x7f {
+			return ' '
+		}
+		return r
+	}, title+": "+body)
+	if _, err := fmt.Fprintf(terminal, "\033]9;%s\a", text); err != nil {
+		return "", fmt.Errorf("failed to write terminal notification escape: %w", err)
+	}
+	return "terminal (OSC 9)", nil
+}
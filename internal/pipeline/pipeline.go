@@ -0,0 +1,208 @@
+// Package pipeline reads prompt pipelines: YAML files of templated steps run
+// in order, where each step's prompt can use the variables of the run and
+// the replies of the steps before it.
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v2"
+
+	"ExtraChat/internal/config"
+)
+
+// Pipeline is a parsed pipeline file
+type Pipeline struct {
+	Name  string            `yaml:"name"`
+	Vars  map[string]string `yaml:"vars"` // Defaults of the variables, overridden with --var
+	Steps []*Step           `yaml:"steps"`
+}
+
+// Step is one prompt of a pipeline. Its reply is available to the steps
+// after it as {{.<name>}}.
+type Step struct {
+	Name    string `yaml:"name"`
+	Backend string `yaml:"backend"` // Backend or model alias; empty for the configured backend
+	Model   string `yaml:"model"`   // Overrides the backend's configured model
+	System  string `yaml:"system"`  // System prompt template; empty sends none
+	Prompt  string `yaml:"prompt"`  // Prompt template
+
+	Post []config.PostProcessor `yaml:"post"` // Applied to the reply before the steps after it see it
+
+	system *template.Template
+	prompt *template.Template
+}
+
+// validName matches step and variable names usable as {{.name}}
+var validName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ErrMissingVar is returned by Check for a variable without a value
+var ErrMissingVar = errors.New("missing variable")
+
+// missingKey finds the name in text/template's error for an undefined key
+var missingKey = regexp.MustCompile(`no entry for key "([^"]*)"`)
+
+// Load reads and validates a pipeline file, compiling its templates
+func Load(path string) (*Pipeline, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pipeline: %w", err)
+	}
+	var p Pipeline
+	if err := yaml.UnmarshalStrict(data, &p); err != nil {
+		return nil, fmt.Errorf("failed to parse pipeline %s: %w", path, err)
+	}
+	if p.Name == "" {
+		p.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	if err := p.validate(); err != nil {
+		return nil, fmt.Errorf("invalid pipeline %s: %w", path, err)
+	}
+	return &p, nil
+}
+
+// New builds a pipeline in code, validating it and compiling its templates
+// as Load does
+func New(name string, vars map[string]string, steps ...*Step) (*Pipeline, error) {
+	p := &Pipeline{Name: name, Vars: vars, Steps: steps}
+	if err := p.validate(); err != nil {
+		return nil, fmt.Errorf("invalid pipeline %s: %w", name, err)
+	}
+	return p, nil
+}
+
+// validate checks the names and compiles the templates
+func (p *Pipeline) validate() error {
+	if len(p.Steps) == 0 {
+		return errors.New("no steps")
+	}
+	for name := range p.Vars {
+		if !validName.MatchString(name) {
+			return fmt.Errorf("variable %q: names are letters, digits and underscores", name)
+		}
+	}
+
+	seen := make(map[string]bool)
+	for i, step := range p.Steps {
+		if step.Name == "" {
+			step.Name = fmt.Sprintf("step%d", i+1)
+		}
+		switch {
+		case !validName.MatchString(step.Name):
+			return fmt.Errorf("step %q: names are letters, digits and underscores", step.Name)
+		case seen[step.Name]:
+			return fmt.Errorf("step %q is defined twice", step.Name)
+		case hasKey(p.Vars, step.Name):
+			return fmt.Errorf("step %q has the name of a variable", step.Name)
+		case strings.TrimSpace(step.Prompt) == "":
+			return fmt.Errorf("step %q has no prompt", step.Name)
+		}
+		for _, post := range step.Post {
+			if err := post.Validate(); err != nil {
+				return fmt.Errorf("step %q: %w", step.Name, err)
+			}
+		}
+		seen[step.Name] = true
+
+		var err error
+		if step.prompt, err = parse(step.Name+".prompt", step.Prompt); err != nil {
+			return err
+		}
+		if step.System != "" {
+			if step.system, err = parse(step.Name+".system", step.System); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// parse compiles a template that fails on references to undefined names
+func parse(name, text string) (*template.Template, error) {
+	t, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template: %w", err)
+	}
+	return t, nil
+}
+
+// Values returns the variables of a run: the pipeline's defaults with vars
+// on top
+func (p *Pipeline) Values(vars map[string]string) map[string]string {
+	values := make(map[string]string, len(p.Vars)+len(vars))
+	for name, value := range p.Vars {
+		values[name] = value
+	}
+	for name, value := range vars {
+		values[name] = value
+	}
+	return values
+}
+
+// Check renders every step with placeholder replies before anything is
+// sent, so a misspelled or missing variable, or a reference to a later
+// step, fails the run up front
+func (p *Pipeline) Check(values map[string]string) error {
+	steps := make(map[string]bool, len(p.Steps))
+	for _, step := range p.Steps {
+		if hasKey(values, step.Name) {
+			return fmt.Errorf("variable %s has the name of a step", step.Name)
+		}
+		steps[step.Name] = true
+	}
+
+	data := make(map[string]string, len(values)+len(p.Steps))
+	for name, value := range values {
+		data[name] = value
+	}
+	for _, step := range p.Steps {
+		if _, _, err := step.Render(data); err != nil {
+			m := missingKey.FindStringSubmatch(err.Error())
+			switch {
+			case m != nil && steps[m[1]]:
+				return fmt.Errorf("step %s uses the reply of step %s, which runs after it", step.Name, m[1])
+			case m != nil:
+				return fmt.Errorf("step %s: %w %s (set it with --var %s=...)", step.Name, ErrMissingVar, m[1], m[1])
+			}
+			return fmt.Errorf("step %s: %w", step.Name, err)
+		}
+		data[step.Name] = ""
+	}
+	return nil
+}
+
+// Render fills in the step's system prompt and prompt from data, the
+// variables and the replies of earlier steps
+func (s *Step) Render(data map[string]string) (string, string, error) {
+	var system, prompt strings.Builder
+	if s.system != nil {
+		if err := s.system.Execute(&system, data); err != nil {
+			return "", "", err
+		}
+	}
+	if err := s.prompt.Execute(&prompt, data); err != nil {
+		return "", "", err
+	}
+	return strings.TrimSpace(system.String()), strings.TrimSpace(prompt.String()), nil
+}
+
+// hasKey reports whether m has an entry for key
+func hasKey(m map[string]string, key string) bool {
+	_, ok := m[key]
+	return ok
+}
+
+// ParseVar splits a --var argument of the form name=value
+func ParseVar(arg string) (string, string, error) {
+	name, value, ok := strings.Cut(arg, "=")
+	if !ok || !validName.MatchString(name) {
+		return "", "", fmt.Errorf("%q is not name=value", arg)
+	}
+	return name, value, nil
+}
@@ -0,0 +1,18 @@
+package pipeline
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadRejectsUnknownPostProcessors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "post.yaml")
+	if err := os.WriteFile(path, []byte("steps:\n  - prompt: hi\n    post: [tidy]\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "tidy") {
+		t.Errorf("Load = %v, want the unknown post-processor rejected", err)
+	}
+}
@@ -0,0 +1,144 @@
+// Package postprocess rewrites assistant replies before they are shown and
+// stored: markdown fences are trimmed, JSON is extracted, or code blocks are
+// piped through a formatter such as gofmt.
+package postprocess
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+
+	"ExtraChat/internal/config"
+)
+
+// FormatTimeout bounds a formatter run on one code block
+const FormatTimeout = 10 * time.Second
+
+// ErrNoJSON is returned by extract_json for a reply without JSON
+var ErrNoJSON = errors.New("no JSON object or array in the reply")
+
+// fencePattern finds fenced code blocks: the info string's first word, and
+// the code
+var fencePattern = regexp.MustCompile("(?ms)^[ \t]*```[ \t]*([^\\s`]*)[^\n]*\n(.*?)^[ \t]*```[ \t]*$")
+
+// fenceLine matches a line opening or closing a code block
+var fenceLine = regexp.MustCompile("(?m)^[ \t]*```[^\n]*(\n|$)")
+
+// Apply runs the post-processors on a reply in order. A failing one leaves
+// the reply as it was before it, and the others still run; the error
+// reports every failure.
+func Apply(ctx context.Context, reply string, post []config.PostProcessor) (string, error) {
+	var errs []error
+	for _, p := range post {
+		processed, err := apply(ctx, reply, p)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", p, err))
+		}
+		reply = processed
+	}
+	return reply, errors.Join(errs...)
+}
+
+func apply(ctx context.Context, reply string, p config.PostProcessor) (string, error) {
+	switch p.Kind {
+	case config.PostTrimFences:
+		return TrimFences(reply), nil
+	case config.PostExtractJSON:
+		return ExtractJSON(reply)
+	case config.PostFormat:
+		return Format(ctx, reply, p.Lang, p.Command)
+	default:
+		return reply, fmt.Errorf("unknown post-processor %q", p.Kind)
+	}
+}
+
+// TrimFences drops the lines opening and closing code blocks, so a reply
+// that is only code can be used as it is
+func TrimFences(reply string) string {
+	if !fencePattern.MatchString(reply) {
+		return reply
+	}
+	return strings.TrimSpace(fenceLine.ReplaceAllString(reply, ""))
+}
+
+// ExtractJSON returns the first JSON object or array of a reply, preferring
+// a ```json block; a reply that is already JSON comes back unchanged
+func ExtractJSON(reply string) (string, error) {
+	for _, m := range fencePattern.FindAllStringSubmatch(reply, -1) {
+		if strings.EqualFold(m[1], "json") && json.Valid([]byte(strings.TrimSpace(m[2]))) {
+			return strings.TrimSpace(m[2]), nil
+		}
+	}
+	for i, r := range reply {
+		if r != '{' && r != '[' {
+			continue
+		}
+		var value json.RawMessage
+		if json.NewDecoder(strings.NewReader(reply[i:])).Decode(&value) == nil {
+			return string(value), nil
+		}
+	}
+	return reply, ErrNoJSON
+}
+
+// Format pipes the code blocks of lang through a shell command and puts
+// its output in their place. A block the command fails on is left as it is.
+func Format(ctx context.Context, reply, lang, command string) (string, error) {
+	var errs []error
+	formatted := fencePattern.ReplaceAllStringFunc(reply, func(block string) string {
+		m := fencePattern.FindStringSubmatchIndex(block)
+		if !strings.EqualFold(block[m[2]:m[3]], lang) {
+			return block
+		}
+		out, err := runFormatter(ctx, command, block[m[4]:m[5]])
+		if err != nil {
+			errs = append(errs, err)
+			return block
+		}
+		// The fences and their indentation stay as they were
+		return block[:m[4]] + out + block[m[5]:]
+	})
+	return formatted, errors.Join(errs...)
+}
+
+// runFormatter runs command with code on stdin and returns its output,
+// ending with a newline like the code block it replaces
+func runFormatter(ctx context.Context, command, code string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, FormatTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	}
+	cmd.Stdin = strings.NewReader(code)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if detail := strings.TrimSpace(stderr.String()); detail != "" {
+			return "", fmt.Errorf("%s failed: %w: %s", command, err, firstLine(detail))
+		}
+		return "", fmt.Errorf("%s failed: %w", command, err)
+	}
+	out := stdout.String()
+	if strings.TrimSpace(out) == "" {
+		return "", fmt.Errorf("%s wrote nothing", command)
+	}
+	if !strings.HasSuffix(out, "\n") {
+		out += "\n"
+	}
+	return out, nil
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
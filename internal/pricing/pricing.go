@@ -0,0 +1,93 @@
+// Package pricing estimates the cost of LLM requests from token usage
+package pricing
+
+import (
+	"strings"
+)
+
+// Price is what a model charges in US dollars per million tokens
+type Price struct {
+	Input  float64 `yaml:"input"`
+	Output float64 `yaml:"output"`
+}
+
+// Cost returns the cost in US dollars of a request
+func (p Price) Cost(inputTokens, outputTokens int64) float64 {
+	return (float64(inputTokens)*p.Input + float64(outputTokens)*p.Output) / 1e6
+}
+
+// Batch returns the price of requests sent through a provider's batch API,
+// which bills them at half the list price
+func (p Price) Batch() Price {
+	return Price{Input: p.Input / 2, Output: p.Output / 2}
+}
+
+// defaultPrices are list prices keyed by model ID prefix, so dated releases
+// such as claude-sonnet-4-20250514 match their family. Local models are free.
+var defaultPrices = map[string]Price{
+	// Anthropic
+	"claude-opus-4":     {Input: 15, Output: 75},
+	"claude-sonnet-4":   {Input: 3, Output: 15},
+	"claude-3-7-sonnet": {Input: 3, Output: 15},
+	"claude-3-5-sonnet": {Input: 3, Output: 15},
+	"claude-3-5-haiku":  {Input: 0.8, Output: 4},
+	"claude-3-opus":     {Input: 15, Output: 75},
+	"claude-3-haiku":    {Input: 0.25, Output: 1.25},
+
+	// OpenAI
+	"gpt-4o":        {Input: 2.5, Output: 10},
+	"gpt-4o-mini":   {Input: 0.15, Output: 0.6},
+	"gpt-4.1":       {Input: 2, Output: 8},
+	"gpt-4.1-mini":  {Input: 0.4, Output: 1.6},
+	"gpt-4.1-nano":  {Input: 0.1, Output: 0.4},
+	"gpt-4-turbo":   {Input: 10, Output: 30},
+	"gpt-3.5-turbo": {Input: 0.5, Output: 1.5},
+	"o1":            {Input: 15, Output: 60},
+	"o3-mini":       {Input: 1.1, Output: 4.4},
+
+	// xAI
+	"grok-beta":   {Input: 5, Output: 15},
+	"grok-2":      {Input: 2, Output: 10},
+	"grok-3":      {Input: 3, Output: 15},
+	"grok-3-mini": {Input: 0.3, Output: 0.5},
+}
+
+// Table looks up model prices: overrides (from the config file) first,
+// then the built-in list prices
+type Table struct {
+	overrides map[string]Price
+}
+
+// NewTable creates a pricing table with per-model overrides
+func NewTable(overrides map[string]Price) *Table {
+	return &Table{overrides: overrides}
+}
+
+// Lookup returns the price of a model on a backend. Ollama models run
+// locally and the mock backend is offline, so they cost nothing. The longest matching prefix wins, so
+// "gpt-4o-mini" isn't priced as "gpt-4o".
+func (t *Table) Lookup(backend, model string) (Price, bool) {
+	if price, ok := t.overrides[model]; ok {
+		return price, true
+	}
+	if backend == "ollama" || backend == "mock" {
+		return Price{}, true
+	}
+	if price, ok := longestPrefix(t.overrides, model); ok {
+		return price, true
+	}
+	return longestPrefix(defaultPrices, model)
+}
+
+// longestPrefix finds the entry whose key is the longest prefix of model
+func longestPrefix(prices map[string]Price, model string) (Price, bool) {
+	var best string
+	var price Price
+	found := false
+	for prefix, p := range prices {
+		if strings.HasPrefix(model, prefix) && len(prefix) >= len(best) {
+			best, price, found = prefix, p, true
+		}
+	}
+	return price, found
+}
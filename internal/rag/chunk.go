@@ -0,0 +1,91 @@
+// Package rag stores embedded chunks of documents and finds the ones most
+// relevant to a prompt, for retrieval-augmented generation
+package rag
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"unicode"
+)
+
+// Chunk is a piece of a document
+type Chunk struct {
+	Text  string
+	Start int // Offset of the first character in the document text, in characters
+	End   int // Offset just past the last character
+}
+
+// ContentHash returns the hash stored with a chunk's vector, under which
+// the vector is reused for the same text on later ingests
+func ContentHash(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+// Split cuts text into chunks of at most size characters, each repeating
+// the last overlap characters of the one before so that a passage cut in
+// two is still found whole. Chunks end at a paragraph, line or word break
+// where one falls in their second half.
+func Split(text string, size, overlap int) []Chunk {
+	runes := []rune(text)
+	if size <= 0 {
+		size = len(runes)
+	}
+	if overlap < 0 || overlap >= size {
+		overlap = 0
+	}
+
+	// Leading and trailing space is not part of any chunk
+	first, last := 0, len(runes)
+	for first < last && unicode.IsSpace(runes[first]) {
+		first++
+	}
+	for last > first && unicode.IsSpace(runes[last-1]) {
+		last--
+	}
+	runes = runes[:last]
+
+	var chunks []Chunk
+	for start := first; start < len(runes); {
+		end := start + size
+		if end >= len(runes) {
+			end = len(runes)
+		} else {
+			end = breakPoint(runes, start+size/2, end)
+		}
+
+		from, to := start, end
+		for from < to && unicode.IsSpace(runes[from]) {
+			from++
+		}
+		for to > from && unicode.IsSpace(runes[to-1]) {
+			to--
+		}
+		if from < to {
+			chunks = append(chunks, Chunk{Text: string(runes[from:to]), Start: from, End: to})
+		}
+		if end == len(runes) {
+			break
+		}
+		start = max(end-overlap, start+1)
+	}
+	return chunks
+}
+
+// breakPoint returns the end of a chunk in runes[from:to]: after the last
+// paragraph break, line break or space in it, in that order of preference,
+// or to if there is none
+func breakPoint(runes []rune, from, to int) int {
+	for _, isBreak := range []func(i int) bool{
+		func(i int) bool { return runes[i] == '\n' && i > 0 && runes[i-1] == '\n' },
+		func(i int) bool { return runes[i] == '\n' },
+		func(i int) bool { return unicode.IsSpace(runes[i]) },
+	} {
+		for i := to - 1; i >= from; i-- {
+			if isBreak(i) {
+				return i + 1
+			}
+		}
+	}
+	return to
+}
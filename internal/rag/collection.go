@@ -0,0 +1,250 @@
+package rag
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+var (
+	// ErrNoCollection is returned for a collection name that doesn't exist
+	ErrNoCollection = errors.New("no such collection")
+	// ErrCollectionExists is returned when creating a collection twice
+	ErrCollectionExists = errors.New("collection already exists")
+)
+
+// collectionName is what collection names may look like
+var collectionName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// ValidCollectionName checks a name for a new collection
+func ValidCollectionName(name string) error {
+	if !collectionName.MatchString(name) {
+		return fmt.Errorf("invalid collection name %q (letters, digits, '.', '_' and '-')", name)
+	}
+	return nil
+}
+
+// Collection is a named set of ingested documents
+type Collection struct {
+	Name      string
+	CreatedAt time.Time
+	Documents int
+	Chunks    int
+	Rerank    string // Reranker for searches of the collection; empty follows the configuration
+}
+
+// DocumentInfo describes an ingested document
+type DocumentInfo struct {
+	Path       string
+	Model      string
+	Chunks     int
+	IngestedAt time.Time
+}
+
+// CreateCollection adds an empty collection
+func (s *Store) CreateCollection(ctx context.Context, name string) error {
+	if err := ValidCollectionName(name); err != nil {
+		return err
+	}
+	res, err := s.db.ExecContext(ctx,
+		"INSERT OR IGNORE INTO rag_collections (name, created_at) VALUES (?, ?)", name, time.Now(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create collection: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("%s: %w", name, ErrCollectionExists)
+	}
+	return nil
+}
+
+// queryRower is a database or a transaction
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// collectionID looks up a collection by name
+func collectionID(ctx context.Context, q queryRower, name string) (int64, error) {
+	var id int64
+	err := q.QueryRowContext(ctx, "SELECT id FROM rag_collections WHERE name = ?", name).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("%s: %w", name, ErrNoCollection)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to look up collection: %w", err)
+	}
+	return id, nil
+}
+
+// HasCollection reports whether a collection exists
+func (s *Store) HasCollection(ctx context.Context, name string) (bool, error) {
+	_, err := collectionID(ctx, s.db, name)
+	if errors.Is(err, ErrNoCollection) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// AddToCollection puts the ingested document at path into a collection
+func (s *Store) AddToCollection(ctx context.Context, name, path string) error {
+	id, err := collectionID(ctx, s.db, name)
+	if err != nil {
+		return err
+	}
+	res, err := s.db.ExecContext(ctx,
+		`INSERT OR IGNORE INTO rag_collection_documents (collection_id, document_id)
+		SELECT ?, id FROM rag_documents WHERE path = ?`,
+		id, path,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to add document to collection: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		// Either already a member or never ingested
+		var exists int
+		if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM rag_documents WHERE path = ?", path).Scan(&exists); err != nil {
+			return fmt.Errorf("failed to look up document: %w", err)
+		}
+		if exists == 0 {
+			return fmt.Errorf("document %s has not been ingested", path)
+		}
+	}
+	return nil
+}
+
+// SetCollectionRerank sets the reranker used for searches of a collection;
+// an empty reranker follows the configuration again
+func (s *Store) SetCollectionRerank(ctx context.Context, name, reranker string) error {
+	id, err := collectionID(ctx, s.db, name)
+	if err != nil {
+		return err
+	}
+	var value interface{}
+	if reranker != "" {
+		value = reranker
+	}
+	if _, err := s.db.ExecContext(ctx, "UPDATE rag_collections SET rerank = ? WHERE id = ?", value, id); err != nil {
+		return fmt.Errorf("failed to set collection reranker: %w", err)
+	}
+	return nil
+}
+
+// CollectionRerank returns the reranker set for a collection, or "" when it
+// follows the configuration
+func (s *Store) CollectionRerank(ctx context.Context, name string) (string, error) {
+	var reranker sql.NullString
+	err := s.db.QueryRowContext(ctx, "SELECT rerank FROM rag_collections WHERE name = ?", name).Scan(&reranker)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("%s: %w", name, ErrNoCollection)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to look up collection: %w", err)
+	}
+	return reranker.String, nil
+}
+
+// Collections lists the collections by name, with their document and chunk
+// counts across all embedding models
+func (s *Store) Collections(ctx context.Context) ([]Collection, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT k.name, k.created_at, COALESCE(k.rerank, ''),
+			(SELECT COUNT(*) FROM rag_collection_documents m WHERE m.collection_id = k.id),
+			(SELECT COUNT(*) FROM rag_collection_documents m JOIN rag_chunks c ON c.document_id = m.document_id
+				WHERE m.collection_id = k.id)
+		FROM rag_collections k ORDER BY k.name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list collections: %w", err)
+	}
+	defer rows.Close()
+
+	var collections []Collection
+	for rows.Next() {
+		var c Collection
+		if err := rows.Scan(&c.Name, &c.CreatedAt, &c.Rerank, &c.Documents, &c.Chunks); err != nil {
+			return nil, fmt.Errorf("failed to scan collection: %w", err)
+		}
+		collections = append(collections, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list collections: %w", err)
+	}
+	return collections, nil
+}
+
+// CollectionDocuments lists the documents of a collection by path
+func (s *Store) CollectionDocuments(ctx context.Context, name string) ([]DocumentInfo, error) {
+	id, err := collectionID(ctx, s.db, name)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT d.path, d.model, d.ingested_at, (SELECT COUNT(*) FROM rag_chunks c WHERE c.document_id = d.id)
+		FROM rag_collection_documents m JOIN rag_documents d ON d.id = m.document_id
+		WHERE m.collection_id = ? ORDER BY d.path`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list documents: %w", err)
+	}
+	defer rows.Close()
+
+	var documents []DocumentInfo
+	for rows.Next() {
+		var d DocumentInfo
+		var ingestedAt sql.NullTime
+		if err := rows.Scan(&d.Path, &d.Model, &ingestedAt, &d.Chunks); err != nil {
+			return nil, fmt.Errorf("failed to scan document: %w", err)
+		}
+		d.IngestedAt = ingestedAt.Time
+		documents = append(documents, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list documents: %w", err)
+	}
+	return documents, nil
+}
+
+// DeleteCollection removes a collection. Its documents are deleted with
+// their chunks unless another collection still holds them; it returns how
+// many were deleted.
+func (s *Store) DeleteCollection(ctx context.Context, name string) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	id, err := collectionID(ctx, tx, name)
+	if err != nil {
+		return 0, err
+	}
+
+	// Documents only this collection holds
+	orphans := `SELECT m.document_id FROM rag_collection_documents m WHERE m.collection_id = ?
+		AND NOT EXISTS (SELECT 1 FROM rag_collection_documents o
+			WHERE o.document_id = m.document_id AND o.collection_id != m.collection_id)`
+	if _, err := tx.ExecContext(ctx, "DELETE FROM rag_chunks WHERE document_id IN ("+orphans+")", id); err != nil {
+		return 0, fmt.Errorf("failed to delete chunks: %w", err)
+	}
+	res, err := tx.ExecContext(ctx, "DELETE FROM rag_documents WHERE id IN ("+orphans+")", id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete documents: %w", err)
+	}
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete documents: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM rag_collection_documents WHERE collection_id = ?", id); err != nil {
+		return 0, fmt.Errorf("failed to delete collection: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM rag_collections WHERE id = ?", id); err != nil {
+		return 0, fmt.Errorf("failed to delete collection: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return int(deleted), nil
+}
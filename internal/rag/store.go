@@ -0,0 +1,271 @@
+package rag
+
+import (
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Store keeps ingested documents and their embedded chunks in the rag_*
+// tables of the chat database. Vectors are compared in Go, which is fast
+// enough for the tens of thousands of chunks a personal corpus has.
+type Store struct {
+	db *sql.DB
+}
+
+// NewStore returns a store on a database initialized by telemetry.InitDB
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+// Match is a chunk found by Search
+type Match struct {
+	Path    string
+	Seq     int // Position of the chunk in its document, from 1
+	Start   int // Character offsets of the chunk in the document text; both 0 for chunks ingested without them
+	End     int
+	Content string
+	Score   float64 // Cosine similarity to the query
+}
+
+// Stats summarizes what has been ingested with an embedding model
+type Stats struct {
+	Documents int
+	Chunks    int
+}
+
+// Unchanged reports whether a document was already ingested with model and
+// its content still has the given hash
+func (s *Store) Unchanged(ctx context.Context, path, hash, model string) (bool, error) {
+	var stored, storedModel string
+	err := s.db.QueryRowContext(ctx,
+		"SELECT hash, model FROM rag_documents WHERE path = ?", path,
+	).Scan(&stored, &storedModel)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to look up document: %w", err)
+	}
+	return stored == hash && storedModel == model, nil
+}
+
+// Replace stores a document's chunks and their vectors, replacing what was
+// ingested for it before. The document keeps its collections.
+func (s *Store) Replace(ctx context.Context, path, hash, model string, chunks []Chunk, vectors [][]float32) error {
+	if len(chunks) != len(vectors) {
+		return fmt.Errorf("got %d vectors for %d chunks", len(vectors), len(chunks))
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var docID int64
+	err = tx.QueryRowContext(ctx, "SELECT id FROM rag_documents WHERE path = ?", path).Scan(&docID)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		res, err := tx.ExecContext(ctx,
+			"INSERT INTO rag_documents (path, hash, model, ingested_at) VALUES (?, ?, ?, ?)",
+			path, hash, model, time.Now(),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to save document: %w", err)
+		}
+		if docID, err = res.LastInsertId(); err != nil {
+			return fmt.Errorf("failed to save document: %w", err)
+		}
+	case err != nil:
+		return fmt.Errorf("failed to look up document: %w", err)
+	default:
+		if _, err := tx.ExecContext(ctx, "DELETE FROM rag_chunks WHERE document_id = ?", docID); err != nil {
+			return fmt.Errorf("failed to delete old chunks: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx,
+			"UPDATE rag_documents SET hash = ?, model = ?, ingested_at = ? WHERE id = ?",
+			hash, model, time.Now(), docID,
+		); err != nil {
+			return fmt.Errorf("failed to save document: %w", err)
+		}
+	}
+
+	for i, chunk := range chunks {
+		if _, err := tx.ExecContext(ctx,
+			"INSERT INTO rag_chunks (document_id, seq, start_offset, end_offset, content, content_hash, embedding) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			docID, i+1, chunk.Start, chunk.End, chunk.Text, ContentHash(chunk.Text), encodeVector(vectors[i]),
+		); err != nil {
+			return fmt.Errorf("failed to save chunk: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// hashBatchSize is how many content hashes Vectors looks up per query,
+// well below SQLite's limit on bound parameters
+const hashBatchSize = 500
+
+// Vectors returns the stored vectors embedded with model for the chunk texts
+// with the given content hashes, keyed by hash. Hashes nothing was embedded
+// for are missing from the map, so only their chunks need embedding.
+func (s *Store) Vectors(ctx context.Context, model string, hashes []string) (map[string][]float32, error) {
+	vectors := make(map[string][]float32)
+	for start := 0; start < len(hashes); start += hashBatchSize {
+		batch := hashes[start:min(start+hashBatchSize, len(hashes))]
+		args := []interface{}{model}
+		for _, hash := range batch {
+			args = append(args, hash)
+		}
+		rows, err := s.db.QueryContext(ctx,
+			`SELECT c.content_hash, c.embedding
+			FROM rag_chunks c JOIN rag_documents d ON d.id = c.document_id
+			WHERE d.model = ? AND c.content_hash IN (?`+strings.Repeat(", ?", len(batch)-1)+")",
+			args...,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up cached vectors: %w", err)
+		}
+		for rows.Next() {
+			var hash string
+			var blob []byte
+			if err := rows.Scan(&hash, &blob); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("failed to scan cached vector: %w", err)
+			}
+			vectors[hash] = decodeVector(blob)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up cached vectors: %w", err)
+		}
+	}
+	return vectors, nil
+}
+
+// Scope limits a search to some documents: those at Paths and those in
+// Collection. The zero Scope searches every document.
+type Scope struct {
+	Paths      []string
+	Collection string
+}
+
+// Search returns the k chunks embedded with model that are most similar to
+// the query vector, best first, among the documents in scope
+func (s *Store) Search(ctx context.Context, model string, query []float32, k int, scope Scope) ([]Match, error) {
+	q := `SELECT d.path, c.seq, COALESCE(c.start_offset, 0), COALESCE(c.end_offset, 0), c.content, c.embedding
+		FROM rag_chunks c JOIN rag_documents d ON d.id = c.document_id
+		WHERE d.model = ?`
+	args := []interface{}{model}
+	var filters []string
+	if len(scope.Paths) > 0 {
+		filters = append(filters, "d.path IN (?"+strings.Repeat(", ?", len(scope.Paths)-1)+")")
+		for _, path := range scope.Paths {
+			args = append(args, path)
+		}
+	}
+	if scope.Collection != "" {
+		filters = append(filters, `d.id IN (SELECT m.document_id FROM rag_collection_documents m
+			JOIN rag_collections k ON k.id = m.collection_id WHERE k.name = ?)`)
+		args = append(args, scope.Collection)
+	}
+	if len(filters) > 0 {
+		q += " AND (" + strings.Join(filters, " OR ") + ")"
+	}
+
+	rows, err := s.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query chunks: %w", err)
+	}
+	defer rows.Close()
+
+	queryNorm := norm(query)
+	var matches []Match
+	for rows.Next() {
+		var m Match
+		var blob []byte
+		if err := rows.Scan(&m.Path, &m.Seq, &m.Start, &m.End, &m.Content, &blob); err != nil {
+			return nil, fmt.Errorf("failed to scan chunk: %w", err)
+		}
+		vector := decodeVector(blob)
+		if len(vector) != len(query) {
+			continue
+		}
+		m.Score = cosine(query, vector, queryNorm)
+		matches = append(matches, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query chunks: %w", err)
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].Score > matches[j].Score })
+	if len(matches) > k {
+		matches = matches[:k]
+	}
+	return matches, nil
+}
+
+// Stats counts the documents and chunks ingested with model
+func (s *Store) Stats(ctx context.Context, model string) (Stats, error) {
+	var stats Stats
+	err := s.db.QueryRowContext(ctx,
+		`SELECT COUNT(DISTINCT d.id), COUNT(c.id)
+		FROM rag_documents d LEFT JOIN rag_chunks c ON c.document_id = d.id
+		WHERE d.model = ?`,
+		model,
+	).Scan(&stats.Documents, &stats.Chunks)
+	if err != nil {
+		return stats, fmt.Errorf("failed to count documents: %w", err)
+	}
+	return stats, nil
+}
+
+// encodeVector packs a vector as little-endian float32s
+func encodeVector(v []float32) []byte {
+	buf := make([]byte, 4*len(v))
+	for i, x := range v {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(x))
+	}
+	return buf
+}
+
+// decodeVector unpacks a vector stored by encodeVector
+func decodeVector(buf []byte) []float32 {
+	v := make([]float32, len(buf)/4)
+	for i := range v {
+		v[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[4*i:]))
+	}
+	return v
+}
+
+func norm(v []float32) float64 {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	return math.Sqrt(sum)
+}
+
+// cosine returns the cosine similarity of a and b, given the norm of a
+func cosine(a, b []float32, normA float64) float64 {
+	var dot float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+	}
+	normB := norm(b)
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (normA * normB)
+}
@@ -0,0 +1,309 @@
+// Package review splits source files or a unified diff into chunks with
+// line numbers for a model to review, reads the findings it replies with
+// and reports them grouped by file and line
+package review
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Severities of findings, most severe first
+const (
+	SeverityError   = "error"   // A bug, security hole or data loss
+	SeverityWarning = "warning" // Likely wrong, fragile or misleading
+	SeverityInfo    = "info"    // Style, naming, simplification
+)
+
+// Severities lists the severities, most severe first
+var Severities = []string{SeverityError, SeverityWarning, SeverityInfo}
+
+// Kinds of chunks
+const (
+	KindFile = "file" // Lines of a source file
+	KindDiff = "diff" // Hunks of a unified diff
+)
+
+// Chunk is a part of a file the model reviews at once. Its text has each
+// line prefixed with its number; in a diff, removed lines have none and
+// added lines are marked with +.
+type Chunk struct {
+	File      string
+	Kind      string
+	StartLine int
+	EndLine   int
+	Text      string
+}
+
+// Finding is a problem the model found
+type Finding struct {
+	File       string `json:"file"`
+	Line       int    `json:"line"`               // 0 for the whole file
+	EndLine    int    `json:"end_line,omitempty"` // Last line of a range
+	Severity   string `json:"severity"`
+	Message    string `json:"message"`
+	Suggestion string `json:"suggestion,omitempty"`
+}
+
+// numbered formats a line of a chunk's text
+func numbered(n int, marker, line string) string {
+	return fmt.Sprintf("%5d %s %s\n", n, marker, line)
+}
+
+// FileChunks splits a source file into chunks of at most maxLines lines.
+// Binary files have none.
+func FileChunks(path string, content []byte, maxLines int) []Chunk {
+	if bytes.IndexByte(content, 0) >= 0 || !utf8.Valid(content) {
+		return nil
+	}
+	text := strings.TrimSuffix(string(content), "\n")
+	if strings.TrimSpace(text) == "" {
+		return nil
+	}
+	lines := strings.Split(text, "\n")
+
+	var chunks []Chunk
+	for start := 0; start < len(lines); start += maxLines {
+		end := min(start+maxLines, len(lines))
+		var b strings.Builder
+		for i := start; i < end; i++ {
+			b.WriteString(numbered(i+1, "|", strings.TrimSuffix(lines[i], "\r")))
+		}
+		chunks = append(chunks, Chunk{File: path, Kind: KindFile, StartLine: start + 1, EndLine: end, Text: b.String()})
+	}
+	return chunks
+}
+
+// hunkHeader matches "@@ -a,b +c,d @@", capturing the number of old lines,
+// the new file's first line and the number of new lines
+var hunkHeader = regexp.MustCompile(`^@@ -\d+(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// diffHunk is a hunk of a file in a diff
+type diffHunk struct {
+	file       string
+	start, end int // Lines of the new file it spans
+	text       string
+}
+
+// DiffChunks splits a unified diff, as git diff or diff -u write it, into
+// chunks of whole hunks of one file, up to about maxLines lines each.
+// Deleted files have none.
+func DiffChunks(diff string, maxLines int) ([]Chunk, error) {
+	var hunks []diffHunk
+	var file string
+	var current *diffHunk
+	var b strings.Builder
+	line := 0
+	oldLeft, newLeft := 0, 0 // Lines of the hunk still to come
+	flush := func() {
+		if current != nil {
+			current.text = b.String()
+			hunks = append(hunks, *current)
+			current = nil
+		}
+		b.Reset()
+	}
+
+	for _, text := range strings.Split(strings.TrimSuffix(diff, "\n"), "\n") {
+		text = strings.TrimSuffix(text, "\r")
+		if current != nil && oldLeft <= 0 && newLeft <= 0 && !strings.HasPrefix(text, `\`) {
+			flush()
+		}
+		switch {
+		case strings.HasPrefix(text, "diff "):
+			flush()
+			file = ""
+		case current == nil && strings.HasPrefix(text, "--- "):
+		case current == nil && strings.HasPrefix(text, "+++ "):
+			file = strings.TrimPrefix(strings.TrimSpace(strings.TrimPrefix(text, "+++ ")), "b/")
+			if i := strings.IndexByte(file, '\t'); i >= 0 {
+				file = file[:i] // diff -u adds the date
+			}
+			if file == "/dev/null" {
+				file = ""
+			}
+		case strings.HasPrefix(text, "@@"):
+			flush()
+			m := hunkHeader.FindStringSubmatch(text)
+			if m == nil {
+				return nil, fmt.Errorf("invalid hunk header %q", text)
+			}
+			if file == "" {
+				continue
+			}
+			oldLeft, newLeft = count(m[1]), count(m[3])
+			line, _ = strconv.Atoi(m[2])
+			current = &diffHunk{file: file, start: line, end: line}
+		case current == nil:
+			// Headers such as "index ..." and text before the diff
+		case strings.HasPrefix(text, "+"):
+			b.WriteString(numbered(line, "+", text[1:]))
+			current.end = line
+			line++
+			newLeft--
+		case strings.HasPrefix(text, "-"):
+			b.WriteString(fmt.Sprintf("%5s - %s\n", "", text[1:]))
+			oldLeft--
+		case strings.HasPrefix(text, " ") || text == "":
+			// Some tools strip the space of empty context lines
+			b.WriteString(numbered(line, "|", strings.TrimPrefix(text, " ")))
+			current.end = line
+			line++
+			oldLeft--
+			newLeft--
+		case strings.HasPrefix(text, `\`):
+			// "\ No newline at end of file"
+		default:
+			flush()
+		}
+	}
+	flush()
+	if len(hunks) == 0 && strings.TrimSpace(diff) != "" {
+		return nil, errors.New("no hunks found; expected a unified diff such as git diff writes")
+	}
+
+	// Hunks of a file are joined until a chunk would pass maxLines
+	var chunks []Chunk
+	for _, h := range hunks {
+		if n := len(chunks); n > 0 {
+			last := &chunks[n-1]
+			if last.File == h.file && strings.Count(last.Text, "\n")+strings.Count(h.text, "\n") <= maxLines {
+				last.Text += "  ...\n" + h.text
+				last.EndLine = h.end
+				continue
+			}
+		}
+		chunks = append(chunks, Chunk{File: h.file, Kind: KindDiff, StartLine: h.start, EndLine: h.end, Text: h.text})
+	}
+	return chunks, nil
+}
+
+// count parses the line count of a hunk header, which is 1 when left out
+func count(text string) int {
+	if text == "" {
+		return 1
+	}
+	n, _ := strconv.Atoi(text)
+	return n
+}
+
+// ParseFindings reads the findings of a chunk from a model's reply: a JSON
+// array of objects with line, end_line, severity, message and suggestion,
+// or an object with such an array under "findings". Findings outside the
+// chunk's lines are kept for the whole file; unknown severities count as
+// info.
+func ParseFindings(reply string, chunk Chunk) ([]Finding, error) {
+	data := []byte(strings.TrimSpace(reply))
+	var findings []Finding
+	if err := json.Unmarshal(data, &findings); err != nil {
+		var wrapped struct {
+			Findings []Finding `json:"findings"`
+		}
+		if json.Unmarshal(data, &wrapped) != nil {
+			return nil, fmt.Errorf("the reply is not a JSON array of findings: %w", err)
+		}
+		findings = wrapped.Findings
+	}
+
+	kept := findings[:0]
+	for _, f := range findings {
+		if strings.TrimSpace(f.Message) == "" {
+			continue
+		}
+		f.File = chunk.File
+		f.Severity = strings.ToLower(strings.TrimSpace(f.Severity))
+		if !ValidSeverity(f.Severity) {
+			f.Severity = SeverityInfo
+		}
+		if f.Line < chunk.StartLine || f.Line > chunk.EndLine {
+			f.Line, f.EndLine = 0, 0
+		}
+		if f.EndLine <= f.Line || f.EndLine > chunk.EndLine {
+			f.EndLine = 0
+		}
+		kept = append(kept, f)
+	}
+	return kept, nil
+}
+
+// severityRank orders severities, most severe first; unknown ones last
+func severityRank(severity string) int {
+	for i, s := range Severities {
+		if s == severity {
+			return i
+		}
+	}
+	return len(Severities)
+}
+
+// AtLeast reports whether severity is at least as severe as threshold
+func AtLeast(severity, threshold string) bool {
+	return severityRank(severity) <= severityRank(threshold)
+}
+
+// ValidSeverity reports whether severity is one of Severities
+func ValidSeverity(severity string) bool {
+	return severityRank(severity) < len(Severities)
+}
+
+// Sort orders findings by file, then line, then severity
+func Sort(findings []Finding) {
+	sort.SliceStable(findings, func(i, j int) bool {
+		a, b := findings[i], findings[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return severityRank(a.Severity) < severityRank(b.Severity)
+	})
+}
+
+// Counts returns how many findings there are of each severity
+func Counts(findings []Finding) map[string]int {
+	counts := make(map[string]int, len(Severities))
+	for _, s := range Severities {
+		counts[s] = 0
+	}
+	for _, f := range findings {
+		counts[f.Severity]++
+	}
+	return counts
+}
+
+// WriteText writes sorted findings grouped by file, each with its line,
+// severity and message, and its suggestion indented below
+func WriteText(w io.Writer, findings []Finding) {
+	file := ""
+	for _, f := range findings {
+		if f.File != file {
+			if file != "" {
+				fmt.Fprintln(w)
+			}
+			file = f.File
+			fmt.Fprintln(w, file)
+		}
+		where := "-"
+		switch {
+		case f.EndLine > 0:
+			where = fmt.Sprintf("%d-%d", f.Line, f.EndLine)
+		case f.Line > 0:
+			where = strconv.Itoa(f.Line)
+		}
+		fmt.Fprintf(w, "  %-9s %-7s  %s\n", where, f.Severity, f.Message)
+		if f.Suggestion != "" {
+			for _, line := range strings.Split(strings.TrimSpace(f.Suggestion), "\n") {
+				fmt.Fprintf(w, "  %-9s %-7s  > %s\n", "", "", line)
+			}
+		}
+	}
+}
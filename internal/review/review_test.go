@@ -0,0 +1,17 @@
+package review
+
+import "testing"
+
+func TestDiffChunks(t *testing.T) {
+	diff := "diff --git a/tides.go b/tides.go\n--- a/tides.go\n+++ b/tides.go\n" +
+		"@@ -2,2 +2,2 @@\n \n-const High = 1\n+const High = 2\n"
+	chunks, err := DiffChunks(diff, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Removed lines are shown without a number of the new file
+	if len(chunks) != 1 || chunks[0].File != "tides.go" || chunks[0].StartLine != 2 || chunks[0].EndLine != 3 ||
+		chunks[0].Text != "    2 | \n      - const High = 1\n    3 + const High = 2\n" {
+		t.Errorf("DiffChunks = %+v", chunks)
+	}
+}
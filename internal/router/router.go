@@ -0,0 +1,162 @@
+// Package router holds the logic of the model router: it classifies a
+// prompt, finds the first rule the prompt matches and ranks the models the
+// rule lists by cost or latency.
+package router
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"ExtraChat/internal/config"
+	"ExtraChat/internal/pricing"
+)
+
+// bytesPerToken estimates tokens from the length of a prompt
+const bytesPerToken = 4
+
+// replyTokens is the reply length assumed when estimating a prompt's cost
+const replyTokens = 500
+
+// Class is what the router makes of a prompt
+type Class struct {
+	Tokens int  // Estimated from the prompt's length
+	Code   bool // The prompt contains or asks about code
+	Tools  bool // The prompt names an available MCP tool
+}
+
+var (
+	// codeLine matches lines that look like source code
+	codeLine = regexp.MustCompile(`(?m)^\s*(func|def|class|import|package|return|const|let|var|public|private|#include|SELECT|INSERT|UPDATE|CREATE)\b|[;{}]\s*$`)
+
+	// codeWords matches prose asking about code
+	codeWords = regexp.MustCompile(`(?i)\b(code|function|bug|compiler?|stack ?trace|exception|regexp?|refactor|debug|unit tests?|golang|python|javascript|typescript|rust|java|sql|bash|shell script)\b`)
+)
+
+// Classify estimates the size of a prompt and whether it is about code or
+// needs one of the tools
+func Classify(prompt string, tools []string) Class {
+	c := Class{Tokens: (len(prompt) + bytesPerToken - 1) / bytesPerToken}
+	c.Code = strings.Contains(prompt, "```") ||
+		len(codeLine.FindAllStringIndex(prompt, 2)) == 2 ||
+		codeWords.MatchString(prompt)
+
+	lower := strings.ToLower(prompt)
+	for _, tool := range tools {
+		// A tool like read_file is named as such or as "read file"
+		name := strings.ToLower(tool)
+		spaced := strings.NewReplacer("_", " ", "-", " ").Replace(name)
+		if containsWord(lower, name) || containsWord(lower, spaced) {
+			c.Tools = true
+			break
+		}
+	}
+	return c
+}
+
+// containsWord reports whether s contains word, not as part of a longer word
+func containsWord(s, word string) bool {
+	re, err := regexp.Compile(`\b` + regexp.QuoteMeta(word) + `\b`)
+	return err == nil && re.MatchString(s)
+}
+
+// Match returns the index of the first rule c matches, or -1 if none does
+func Match(rules []config.RouteRule, c Class) int {
+	for i, rule := range rules {
+		switch {
+		case rule.Code != nil && *rule.Code != c.Code:
+		case rule.Tools != nil && *rule.Tools != c.Tools:
+		case c.Tokens < rule.MinTokens:
+		case rule.MaxTokens > 0 && c.Tokens > rule.MaxTokens:
+		default:
+			return i
+		}
+	}
+	return -1
+}
+
+// Candidate is a model a rule lists, with what the router knows about it
+type Candidate struct {
+	Ref     string // As written in the rule
+	Backend string
+	Model   string
+	Price   pricing.Price
+	Priced  bool          // Price is known
+	Latency time.Duration // Median of the recent turns; 0 if there were none
+	Skip    string        // Why the model is not adequate for the prompt; empty if it is
+}
+
+// cost estimates what the prompt costs on the candidate
+func (c Candidate) cost(class Class) float64 {
+	return c.Price.Cost(int64(class.Tokens), replyTokens)
+}
+
+// Pick returns the adequate candidate to use and why: the cheapest, or with
+// config.PreferLatency the fastest, the other breaking ties and then the
+// order of the rule. Unknown prices and latencies rank last.
+func Pick(candidates []Candidate, class Class, prefer string) (Candidate, string, bool) {
+	var adequate []Candidate
+	for _, c := range candidates {
+		if c.Skip == "" {
+			adequate = append(adequate, c)
+		}
+	}
+	if len(adequate) == 0 {
+		return Candidate{}, "", false
+	}
+
+	byCost := func(a, b Candidate) int {
+		switch {
+		case a.Priced != b.Priced:
+			return boolRank(a.Priced)
+		case !a.Priced || a.cost(class) == b.cost(class):
+			return 0
+		case a.cost(class) < b.cost(class):
+			return -1
+		}
+		return 1
+	}
+	byLatency := func(a, b Candidate) int {
+		switch {
+		case (a.Latency > 0) != (b.Latency > 0):
+			return boolRank(a.Latency > 0)
+		case a.Latency == b.Latency:
+			return 0
+		case a.Latency < b.Latency:
+			return -1
+		}
+		return 1
+	}
+	first, second := byCost, byLatency
+	if prefer == config.PreferLatency {
+		first, second = byLatency, byCost
+	}
+	sort.SliceStable(adequate, func(i, j int) bool {
+		if r := first(adequate[i], adequate[j]); r != 0 {
+			return r < 0
+		}
+		return second(adequate[i], adequate[j]) < 0
+	})
+
+	best := adequate[0]
+	n := len(adequate)
+	switch {
+	case n == 1:
+		return best, "only adequate model", true
+	case prefer == config.PreferLatency && best.Latency > 0:
+		return best, fmt.Sprintf("fastest of %d at a median %s", n, best.Latency.Round(time.Millisecond)), true
+	case best.Priced:
+		return best, fmt.Sprintf("cheapest of %d at about $%.4f", n, best.cost(class)), true
+	}
+	return best, fmt.Sprintf("first of %d, without known prices or latencies", n), true
+}
+
+// boolRank orders true before false
+func boolRank(b bool) int {
+	if b {
+		return -1
+	}
+	return 1
+}
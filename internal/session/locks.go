@@ -0,0 +1,98 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrVersionConflict is returned when a session was written by another client
+// after it was loaded, so appending our turn would corrupt the role alternation
+var ErrVersionConflict = errors.New("session was modified by another client")
+
+// ErrSessionBusy is returned when another turn currently holds the session lock
+var ErrSessionBusy = errors.New("another turn is in progress for this session")
+
+// Locks hands out per-session advisory locks so that only one turn at a time
+// runs against a session within this process
+type Locks struct {
+	mu    sync.Mutex
+	locks map[string]*sessionLock
+}
+
+// sessionLock is a reference-counted semaphore for a single session
+type sessionLock struct {
+	sem  chan struct{}
+	refs int
+}
+
+// NewLocks creates an empty lock table
+func NewLocks() *Locks {
+	return &Locks{
+		locks: make(map[string]*sessionLock),
+	}
+}
+
+// Acquire blocks until the lock for sessionID is free or ctx is done, and
+// returns the function that releases it
+func (l *Locks) Acquire(ctx context.Context, sessionID string) (func(), error) {
+	lock := l.ref(sessionID)
+
+	select {
+	case lock.sem <- struct{}{}:
+		return l.releaser(sessionID, lock), nil
+	case <-ctx.Done():
+		l.unref(sessionID, lock)
+		return nil, ctx.Err()
+	}
+}
+
+// TryAcquire takes the lock for sessionID only if it is free, returning
+// ErrSessionBusy otherwise
+func (l *Locks) TryAcquire(sessionID string) (func(), error) {
+	lock := l.ref(sessionID)
+
+	select {
+	case lock.sem <- struct{}{}:
+		return l.releaser(sessionID, lock), nil
+	default:
+		l.unref(sessionID, lock)
+		return nil, ErrSessionBusy
+	}
+}
+
+// ref returns the lock for sessionID, creating it on first use
+func (l *Locks) ref(sessionID string) *sessionLock {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	lock, ok := l.locks[sessionID]
+	if !ok {
+		lock = &sessionLock{sem: make(chan struct{}, 1)}
+		l.locks[sessionID] = lock
+	}
+	lock.refs++
+	return lock
+}
+
+// unref drops a reference, forgetting the lock once nobody holds or awaits it
+func (l *Locks) unref(sessionID string, lock *sessionLock) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	lock.refs--
+	if lock.refs == 0 {
+		delete(l.locks, sessionID)
+	}
+}
+
+// releaser returns an idempotent function that releases a held lock
+func (l *Locks) releaser(sessionID string, lock *sessionLock) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			<-lock.sem
+			l.unref(sessionID, lock)
+		})
+	}
+}
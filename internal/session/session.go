@@ -4,15 +4,107 @@ import "time"
 
 // Message represents a single chat message
 type Message struct {
-	Role      string    `json:"role"`
-	Content   string    `json:"content"`
-	Timestamp time.Time `json:"timestamp"`
+	ID        string     `json:"id"`  // UUIDv7 assigned when the message is created
+	Seq       int        `json:"seq"` // Position within the session, starting at 1
+	Role      string     `json:"role"`
+	Content   string     `json:"content"`
+	Timestamp time.Time  `json:"timestamp"`
+	Citations []Citation `json:"citations,omitempty"` // Retrieved chunks an assistant reply cites
+	Speaker   string     `json:"speaker,omitempty"`   // Persona that wrote the message in a multi-agent conversation
+	Route     *Route     `json:"route,omitempty"`     // Why the model router chose the model of an assistant reply
+	Truncated bool       `json:"truncated,omitempty"` // The reply was stopped before it was complete
+}
+
+// Route is a decision of the model router: what it made of the prompt and
+// which model it picked
+type Route struct {
+	Rule    string   `json:"rule,omitempty"` // Rule the prompt matched; empty if none did
+	Tokens  int      `json:"tokens"`         // Estimated tokens of the prompt
+	Code    bool     `json:"code"`           // The prompt contains or asks about code
+	Tools   bool     `json:"tools"`          // The prompt names an available MCP tool
+	Backend string   `json:"backend"`
+	Model   string   `json:"model"`
+	Reason  string   `json:"reason"`
+	Skipped []string `json:"skipped,omitempty"` // Models of the rule ruled out, with why
+}
+
+// Citation links a numbered marker in a reply, like [2], to the document
+// chunk it refers to
+type Citation struct {
+	N     int     `json:"n"`
+	Path  string  `json:"path"`
+	Chunk int     `json:"chunk"` // Position of the chunk in the document, from 1
+	Start int     `json:"start"` // Character offsets of the chunk in the document text; 0 if unknown
+	End   int     `json:"end"`
+	Score float64 `json:"score"` // Similarity of the chunk to the prompt
 }
 
 // Session represents a chat session
 type Session struct {
-	ID        string    `json:"id"`
-	StartTime time.Time `json:"start_time"`
-	Backend   string    `json:"backend"`
-	Messages  []Message `json:"messages"`
+	ID         string    `json:"id"`
+	StartTime  time.Time `json:"start_time"`
+	Backend    string    `json:"backend"`
+	Model      string    `json:"model,omitempty"` // Model picked for Backend by a persona or model alias; empty uses the configured one
+	Title      string    `json:"title,omitempty"`
+	Persona    string    `json:"persona,omitempty"`    // System prompt preset, see config.Persona
+	Summary    string    `json:"summary,omitempty"`    // Saved with /summarize save
+	ParentID   string    `json:"parent_id,omitempty"`  // Session this one was forked from
+	ForkSeq    int       `json:"fork_seq,omitempty"`   // Last message shared with the parent
+	Tenant     string    `json:"tenant,omitempty"`     // API client owning the session; empty for local sessions
+	Documents  []string  `json:"documents,omitempty"`  // Files loaded with /load, searched by retrieval
+	Collection string    `json:"collection,omitempty"` // Knowledge collection bound with /kb use, searched by retrieval
+	Version    int       `json:"version"`              // Incremented on every save; guards against concurrent writers
+	Older      int       `json:"older,omitempty"`      // Earlier messages left in the database when the session was loaded
+	Events     []Event   `json:"events,omitempty"`     // Things that happened between messages, in order
+	Messages   []Message `json:"messages"`
+}
+
+// EventSwitch is the kind of event /switch records
+const EventSwitch = "switch"
+
+// Event is something that happened in a session between two messages, such
+// as a switch to another backend
+type Event struct {
+	Kind      string    `json:"kind"`
+	Seq       int       `json:"seq"`            // Last message before the event; 0 before the first
+	From      string    `json:"from,omitempty"` // backend/model before a switch
+	To        string    `json:"to,omitempty"`   // backend/model after it
+	Detail    string    `json:"detail,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// AddEvent records an event after the latest message
+func (s *Session) AddEvent(event Event) {
+	event.Seq = 0
+	if n := len(s.Messages); n > 0 {
+		event.Seq = s.Messages[n-1].Seq
+	}
+	event.Timestamp = time.Now()
+	s.Events = append(s.Events, event)
+}
+
+// AddMessage appends a message with a fresh ID and the next sequence number
+func (s *Session) AddMessage(role, content string) Message {
+	seq := 1
+	if n := len(s.Messages); n > 0 {
+		seq = s.Messages[n-1].Seq + 1
+	}
+
+	msg := Message{
+		ID:        NewUUIDv7(),
+		Seq:       seq,
+		Role:      role,
+		Content:   content,
+		Timestamp: time.Now(),
+	}
+	s.Messages = append(s.Messages, msg)
+	return msg
+}
+
+// Author returns who wrote the message: its speaker, or else its role
+func (m Message) Author() string {
+	if m.Speaker != "" {
+		return m.Speaker
+	}
+	return m.Role
 }
@@ -0,0 +1,173 @@
+// Package sink delivers the replies of scheduled jobs: appended to a file,
+// posted to a webhook or sent as an email
+package sink
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"ExtraChat/internal/config"
+)
+
+// Timeout bounds one delivery
+const Timeout = 30 * time.Second
+
+// Delivery is the reply of one run of a job
+type Delivery struct {
+	Job  string
+	Time time.Time // When the run was due
+	Text string
+}
+
+// Deliver sends d to a sink
+func Deliver(ctx context.Context, s config.Sink, d Delivery) error {
+	ctx, cancel := context.WithTimeout(ctx, Timeout)
+	defer cancel()
+
+	switch {
+	case s.File != "":
+		return appendFile(s.File, d)
+	case s.Webhook != "":
+		return post(ctx, os.ExpandEnv(s.Webhook), d)
+	case s.Email != nil:
+		return sendMail(ctx, *s.Email, d)
+	default:
+		return fmt.Errorf("sink has no destination")
+	}
+}
+
+// appendFile appends the reply under a heading naming the job and time
+func appendFile(path string, d Delivery) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", path, err)
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	_, err = fmt.Fprintf(f, "## %s, %s\n\n%s\n\n", d.Job, d.Time.Format("2006-01-02 15:04"), strings.TrimSpace(d.Text))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// webhookPayload is what a webhook receives; "text" is the field Slack and
+// Mattermost incoming webhooks show
+type webhookPayload struct {
+	Text string `json:"text"`
+	Job  string `json:"job"`
+	Time string `json:"time"`
+}
+
+// post sends the reply to a webhook as JSON
+func post(ctx context.Context, url string, d Delivery) error {
+	body, err := json.Marshal(webhookPayload{Text: d.Text, Job: d.Job, Time: d.Time.Format(time.RFC3339)})
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook payload: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("invalid webhook URL: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("webhook returned %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
+
+// sendMail sends the reply as a plain text email, upgrading the connection
+// with STARTTLS when the server offers it. net/smtp refuses to send the
+// password over a connection that isn't encrypted, except to localhost.
+func sendMail(ctx context.Context, e config.EmailSink, d Delivery) error {
+	host, _, err := net.SplitHostPort(e.SMTP)
+	if err != nil {
+		return fmt.Errorf("invalid smtp address %q: %w", e.SMTP, err)
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", e.SMTP)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", e.SMTP, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to connect to %s: %w", e.SMTP, err)
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return fmt.Errorf("STARTTLS with %s failed: %w", e.SMTP, err)
+		}
+	}
+	if e.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", e.Username, os.ExpandEnv(e.Password), host)); err != nil {
+			return fmt.Errorf("sign-in to %s failed: %w", e.SMTP, err)
+		}
+	}
+	if err := c.Mail(e.From); err != nil {
+		return fmt.Errorf("sender %s refused: %w", e.From, err)
+	}
+	for _, to := range e.To {
+		if err := c.Rcpt(to); err != nil {
+			return fmt.Errorf("recipient %s refused: %w", to, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	if _, err := w.Write(message(e, d)); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return c.Quit()
+}
+
+// message builds the email with its headers, lines ending in CRLF
+func message(e config.EmailSink, d Delivery) []byte {
+	subject := e.Subject
+	if subject == "" {
+		subject = fmt.Sprintf("%s, %s", d.Job, d.Time.Format("2006-01-02 15:04"))
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", e.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(e.To, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	text := strings.ReplaceAll(strings.TrimSpace(d.Text), "\r\n", "\n")
+	b.WriteString(strings.ReplaceAll(text, "\n", "\r\n"))
+	b.WriteString("\r\n")
+	return []byte(b.String())
+}
@@ -0,0 +1,884 @@
+package stub
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// Model is the only model the stub Ollama server reports
+const Model = "stub:latest"
+
+// Server serves minimal Anthropic, OpenAI/Grok, Ollama, Cohere/Voyage rerank,
+// OpenAI moderation and MCP (streamable HTTP) endpoints on localhost. Replies are
+// deterministic so a scripted conversation can assert on them, and are
+// streamed word by word when the request asks for a stream. Embeddings are
+// hashed bags of words, so texts sharing words come out similar.
+type Server struct {
+	listener net.Listener
+	server   *http.Server
+
+	mu     sync.Mutex
+	hits   map[string]int // Requests served per endpoint or MCP method
+	pulled []string       // Models pulled through /api/pull, listed after Model
+
+	batches map[string]*messageBatch // Message Batches by id
+}
+
+// messageBatch is a Message Batch, which ends on the second status check
+type messageBatch struct {
+	results []map[string]interface{}
+	polls   int
+}
+
+// Start serves the stub endpoints on a free localhost port
+func Start() (*Server, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen: %w", err)
+	}
+
+	s := &Server{
+		listener: listener,
+		hits:     make(map[string]int),
+		batches:  make(map[string]*messageBatch),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/messages", s.handleAnthropic)
+	mux.HandleFunc("POST /v1/messages/batches", s.handleCreateBatch)
+	mux.HandleFunc("GET /v1/messages/batches/{id}", s.handleGetBatch)
+	mux.HandleFunc("GET /v1/messages/batches/{id}/results", s.handleBatchResults)
+	mux.HandleFunc("POST /v1/chat/completions", s.handleOpenAI)
+	mux.HandleFunc("GET /v1/models", s.handleModels)
+	mux.HandleFunc("POST /api/chat", s.handleOllamaChat)
+	mux.HandleFunc("GET /api/tags", s.handleOllamaTags)
+	mux.HandleFunc("POST /api/pull", s.handleOllamaPull)
+	mux.HandleFunc("POST /api/show", s.handleOllamaShow)
+	mux.HandleFunc("POST /api/embed", s.handleOllamaEmbed)
+	mux.HandleFunc("POST /v1/embeddings", s.handleOpenAIEmbeddings)
+	mux.HandleFunc("POST /v2/rerank", s.handleRerank)
+	mux.HandleFunc("POST /v1/rerank", s.handleRerank)
+	mux.HandleFunc("POST /v1/moderations", s.handleModeration)
+	mux.HandleFunc("POST /mcp/rpc", s.handleMCP)
+	mux.HandleFunc("GET /page", s.handlePage)
+
+	s.server = &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go s.server.Serve(listener)
+	return s, nil
+}
+
+// URL returns the base URL for the LLM endpoints
+func (s *Server) URL() string {
+	return "http://" + s.listener.Addr().String()
+}
+
+// MCPURL returns the base URL of the MCP endpoint
+func (s *Server) MCPURL() string {
+	return s.URL() + "/mcp"
+}
+
+// Hits returns how often an endpoint path or MCP method was served
+func (s *Server) Hits(key string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.hits[key]
+}
+
+// Close stops the server
+func (s *Server) Close() error {
+	return s.server.Close()
+}
+
+func (s *Server) hit(key string) {
+	s.mu.Lock()
+	s.hits[key]++
+	s.mu.Unlock()
+}
+
+// reply is the deterministic answer to a user message
+func reply(model, text string) string {
+	return fmt.Sprintf("stub(%s): %s", model, text)
+}
+
+// stopReply ends a reply before the first of the request's stop sequences
+// in it, as the APIs do
+func stopReply(text string, stop []string) string {
+	for _, s := range stop {
+		if i := strings.Index(text, s); i >= 0 {
+			text = text[:i]
+		}
+	}
+	return text
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// handleAnthropic answers the Messages API. When tools are offered and the
+// user mentions "tool", it requests the echo tool; a tool_result is answered
+// with its content.
+func (s *Server) handleAnthropic(w http.ResponseWriter, r *http.Request) {
+	s.hit(r.URL.Path)
+
+	var req struct {
+		Model    string `json:"model"`
+		Messages []struct {
+			Role    string          `json:"role"`
+			Content json.RawMessage `json:"content"`
+		} `json:"messages"`
+		Tools []struct {
+			Name string `json:"name"`
+		} `json:"tools"`
+		Stream        bool     `json:"stream"`
+		StopSequences []string `json:"stop_sequences"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Messages) == 0 {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	content := func(blocks ...map[string]interface{}) []map[string]interface{} { return blocks }
+	resp := map[string]interface{}{
+		"id":          "msg_stub",
+		"type":        "message",
+		"role":        "assistant",
+		"model":       req.Model,
+		"stop_reason": "end_turn",
+		"usage":       map[string]interface{}{"input_tokens": 10, "output_tokens": 5},
+	}
+
+	last := req.Messages[len(req.Messages)-1]
+	var text string
+	if json.Unmarshal(last.Content, &text) != nil {
+		// Structured content: answer tool results
+		var blocks []struct {
+			Type    string `json:"type"`
+			Content string `json:"content"`
+			IsError bool   `json:"is_error"`
+		}
+		json.Unmarshal(last.Content, &blocks)
+		var results []string
+		for _, block := range blocks {
+			if block.Type == "tool_result" {
+				results = append(results, block.Content)
+			}
+		}
+		resp["content"] = content(map[string]interface{}{
+			"type": "text",
+			"text": reply(req.Model, "tool returned "+strings.Join(results, ", ")),
+		})
+		s.writeAnthropic(w, resp, req.Stream)
+		return
+	}
+
+	if len(req.Tools) > 0 && strings.Contains(strings.ToLower(text), "tool") {
+		resp["stop_reason"] = "tool_use"
+		resp["content"] = content(map[string]interface{}{
+			"type":  "tool_use",
+			"id":    "toolu_stub",
+			"name":  "echo",
+			"input": map[string]interface{}{"text": text},
+		})
+		s.writeAnthropic(w, resp, req.Stream)
+		return
+	}
+
+	answer := stopReply(reply(req.Model, text), req.StopSequences)
+	if answer != reply(req.Model, text) {
+		resp["stop_reason"] = "stop_sequence"
+	}
+	resp["content"] = content(map[string]interface{}{"type": "text", "text": answer})
+	s.writeAnthropic(w, resp, req.Stream)
+}
+
+// handleCreateBatch answers the creation of a Message Batch. Its requests
+// are answered like the Messages API would, except that prompts mentioning
+// "batch-error" fail.
+func (s *Server) handleCreateBatch(w http.ResponseWriter, r *http.Request) {
+	s.hit(r.URL.Path)
+
+	var req struct {
+		Requests []struct {
+			CustomID string `json:"custom_id"`
+			Params   struct {
+				Model    string `json:"model"`
+				Messages []struct {
+					Content string `json:"content"`
+				} `json:"messages"`
+			} `json:"params"`
+		} `json:"requests"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Requests) == 0 {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	batch := &messageBatch{}
+	for _, item := range req.Requests {
+		var text string
+		if n := len(item.Params.Messages); n > 0 {
+			text = item.Params.Messages[n-1].Content
+		}
+		result := map[string]interface{}{"type": "succeeded", "message": map[string]interface{}{
+			"id":          "msg_stub",
+			"type":        "message",
+			"role":        "assistant",
+			"model":       item.Params.Model,
+			"content":     []map[string]interface{}{{"type": "text", "text": reply(item.Params.Model, text)}},
+			"stop_reason": "end_turn",
+			"usage":       map[string]interface{}{"input_tokens": 10, "output_tokens": 5},
+		}}
+		if strings.Contains(text, "batch-error") {
+			result = map[string]interface{}{"type": "errored", "error": map[string]interface{}{
+				"type":  "error",
+				"error": map[string]string{"type": "invalid_request_error", "message": "stub rejects this prompt"},
+			}}
+		}
+		batch.results = append(batch.results, map[string]interface{}{"custom_id": item.CustomID, "result": result})
+	}
+
+	s.mu.Lock()
+	id := fmt.Sprintf("msgbatch_stub%d", len(s.batches)+1)
+	s.batches[id] = batch
+	s.mu.Unlock()
+	writeJSON(w, s.batchStatus(id, batch))
+}
+
+// handleGetBatch answers a Message Batch status check
+func (s *Server) handleGetBatch(w http.ResponseWriter, r *http.Request) {
+	s.hit("/v1/messages/batches/{id}")
+
+	id := r.PathValue("id")
+	s.mu.Lock()
+	batch, ok := s.batches[id]
+	if ok {
+		batch.polls++
+	}
+	s.mu.Unlock()
+	if !ok {
+		http.Error(w, "no such batch", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, s.batchStatus(id, batch))
+}
+
+// batchStatus describes a Message Batch; callers must not hold s.mu
+func (s *Server) batchStatus(id string, batch *messageBatch) map[string]interface{} {
+	s.mu.Lock()
+	ended := batch.polls >= 2
+	s.mu.Unlock()
+
+	counts := map[string]int{"processing": 0, "succeeded": 0, "errored": 0, "canceled": 0, "expired": 0}
+	status := map[string]interface{}{"id": id, "type": "message_batch", "processing_status": "in_progress", "request_counts": counts}
+	if !ended {
+		counts["processing"] = len(batch.results)
+		return status
+	}
+	for _, line := range batch.results {
+		counts[line["result"].(map[string]interface{})["type"].(string)]++
+	}
+	status["processing_status"] = "ended"
+	status["results_url"] = s.URL() + "/v1/messages/batches/" + id + "/results"
+	return status
+}
+
+// handleBatchResults answers the results of an ended Message Batch, one
+// JSON object per line
+func (s *Server) handleBatchResults(w http.ResponseWriter, r *http.Request) {
+	s.hit("/v1/messages/batches/{id}/results")
+
+	s.mu.Lock()
+	batch, ok := s.batches[r.PathValue("id")]
+	s.mu.Unlock()
+	if !ok || batch.polls < 2 {
+		http.Error(w, "no results", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/binary")
+	encoder := json.NewEncoder(w)
+	for _, line := range batch.results {
+		encoder.Encode(line)
+	}
+}
+
+// writeAnthropic writes a Messages API response, or streams it as the API's
+// events: text word by word, tool input as JSON in two pieces
+func (s *Server) writeAnthropic(w http.ResponseWriter, resp map[string]interface{}, stream bool) {
+	if !stream {
+		writeJSON(w, resp)
+		return
+	}
+
+	blocks := resp["content"].([]map[string]interface{})
+	start := make(map[string]interface{}, len(resp))
+	for key, value := range resp {
+		start[key] = value
+	}
+	start["content"] = []interface{}{}
+	start["stop_reason"] = nil
+	start["usage"] = map[string]interface{}{"input_tokens": 10, "output_tokens": 1}
+
+	events := []interface{}{map[string]interface{}{"type": "message_start", "message": start}}
+	for i, block := range blocks {
+		switch block["type"] {
+		case "text":
+			events = append(events, map[string]interface{}{
+				"type": "content_block_start", "index": i, "content_block": map[string]interface{}{"type": "text", "text": ""},
+			})
+			for _, word := range words(block["text"].(string)) {
+				events = append(events, map[string]interface{}{
+					"type": "content_block_delta", "index": i, "delta": map[string]interface{}{"type": "text_delta", "text": word},
+				})
+			}
+		case "tool_use":
+			events = append(events, map[string]interface{}{
+				"type": "content_block_start", "index": i, "content_block": map[string]interface{}{
+					"type": "tool_use", "id": block["id"], "name": block["name"], "input": map[string]interface{}{},
+				},
+			})
+			input, _ := json.Marshal(block["input"])
+			half := len(input) / 2
+			for _, part := range []string{string(input[:half]), string(input[half:])} {
+				events = append(events, map[string]interface{}{
+					"type": "content_block_delta", "index": i, "delta": map[string]interface{}{"type": "input_json_delta", "partial_json": part},
+				})
+			}
+		}
+		events = append(events, map[string]interface{}{"type": "content_block_stop", "index": i})
+	}
+	events = append(events,
+		map[string]interface{}{
+			"type":  "message_delta",
+			"delta": map[string]interface{}{"stop_reason": resp["stop_reason"], "stop_sequence": nil},
+			"usage": map[string]interface{}{"output_tokens": 5},
+		},
+		map[string]interface{}{"type": "message_stop"},
+	)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	flusher, _ := w.(http.Flusher)
+	for _, event := range events {
+		data, _ := json.Marshal(event)
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.(map[string]interface{})["type"], data)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
+
+// words splits text into streamed pieces that join back to it
+func words(text string) []string {
+	var pieces []string
+	for len(text) > 0 {
+		n := strings.IndexByte(text[1:], ' ') + 1
+		if n == 0 {
+			n = len(text)
+		}
+		pieces = append(pieces, text[:n])
+		text = text[n:]
+	}
+	return pieces
+}
+
+// chatRequest is what the stub reads of an OpenAI or Ollama style request
+type chatRequest struct {
+	model  string
+	text   string // Content of the last message
+	stream bool
+	stop   []string // stop, or Ollama's options.stop
+}
+
+// answer is the reply to the request, ended at its stop sequences
+func (c chatRequest) answer() string {
+	return stopReply(reply(c.model, c.text), c.stop)
+}
+
+// lastMessage reads the last message of an OpenAI or Ollama style request
+func lastMessage(r *http.Request) (chatRequest, error) {
+	var req struct {
+		Model    string              `json:"model"`
+		Messages []map[string]string `json:"messages"`
+		Stream   bool                `json:"stream"`
+		Stop     []string            `json:"stop"`
+		Options  struct {
+			Stop []string `json:"stop"`
+		} `json:"options"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return chatRequest{}, err
+	}
+	if len(req.Messages) == 0 {
+		return chatRequest{}, fmt.Errorf("no messages")
+	}
+	return chatRequest{
+		model:  req.Model,
+		text:   req.Messages[len(req.Messages)-1]["content"],
+		stream: req.Stream,
+		stop:   append(req.Stop, req.Options.Stop...),
+	}, nil
+}
+
+// handleOpenAI answers chat completions for OpenAI and Grok
+func (s *Server) handleOpenAI(w http.ResponseWriter, r *http.Request) {
+	s.hit(r.URL.Path)
+
+	req, err := lastMessage(r)
+	if err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	usage := map[string]interface{}{"prompt_tokens": 10, "completion_tokens": 5, "total_tokens": 15}
+	if req.stream {
+		// Deltas, then the usage in a chunk without choices
+		var chunks []interface{}
+		for i, word := range words(req.answer()) {
+			delta := map[string]string{"content": word}
+			if i == 0 {
+				delta["role"] = "assistant"
+			}
+			chunks = append(chunks, map[string]interface{}{
+				"id": "chatcmpl-stub", "object": "chat.completion.chunk", "model": req.model,
+				"choices": []map[string]interface{}{{"index": 0, "delta": delta, "finish_reason": nil}},
+			})
+		}
+		chunks = append(chunks,
+			map[string]interface{}{
+				"id": "chatcmpl-stub", "object": "chat.completion.chunk", "model": req.model,
+				"choices": []map[string]interface{}{{"index": 0, "delta": map[string]string{}, "finish_reason": "stop"}},
+			},
+			map[string]interface{}{
+				"id": "chatcmpl-stub", "object": "chat.completion.chunk", "model": req.model,
+				"choices": []interface{}{}, "usage": usage,
+			},
+		)
+		s.streamSSE(w, chunks...)
+		fmt.Fprint(w, "data: [DONE]\n\n")
+		return
+	}
+	writeJSON(w, map[string]interface{}{
+		"id":      "chatcmpl-stub",
+		"object":  "chat.completion",
+		"created": time.Now().Unix(),
+		"model":   req.model,
+		"choices": []map[string]interface{}{{
+			"index":         0,
+			"message":       map[string]string{"role": "assistant", "content": req.answer()},
+			"finish_reason": "stop",
+		}},
+		"usage": usage,
+	})
+}
+
+// handleOllamaChat answers /api/chat
+func (s *Server) handleOllamaChat(w http.ResponseWriter, r *http.Request) {
+	s.hit(r.URL.Path)
+
+	req, err := lastMessage(r)
+	if err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	if req.stream {
+		// One JSON object per line; the last one is done and has the counts
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		encoder := json.NewEncoder(w)
+		flusher, _ := w.(http.Flusher)
+		for _, word := range words(req.answer()) {
+			encoder.Encode(map[string]interface{}{
+				"model":   req.model,
+				"message": map[string]string{"role": "assistant", "content": word},
+				"done":    false,
+			})
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		encoder.Encode(map[string]interface{}{
+			"model":             req.model,
+			"message":           map[string]string{"role": "assistant", "content": ""},
+			"done":              true,
+			"prompt_eval_count": 10,
+			"eval_count":        5,
+		})
+		return
+	}
+	writeJSON(w, map[string]interface{}{
+		"model":      req.model,
+		"created_at": time.Now().Format(time.RFC3339),
+		"message":    map[string]string{"role": "assistant", "content": req.answer()},
+		"done":       true,
+	})
+}
+
+// handleOllamaTags answers /api/tags
+func (s *Server) handleOllamaTags(w http.ResponseWriter, r *http.Request) {
+	s.hit(r.URL.Path)
+	models := []map[string]interface{}{{"name": Model, "size": 1 << 20}}
+	s.mu.Lock()
+	for _, name := range s.pulled {
+		models = append(models, map[string]interface{}{"name": name, "size": 3 << 20})
+	}
+	s.mu.Unlock()
+	writeJSON(w, map[string]interface{}{"models": models})
+}
+
+// handleModels answers /v1/models: two pages of Anthropic models when asked
+// with an anthropic-version header, else a chat, an embedding and an audio
+// model in OpenAI's format
+func (s *Server) handleModels(w http.ResponseWriter, r *http.Request) {
+	s.hit(r.URL.Path)
+	if r.Header.Get("anthropic-version") == "" {
+		writeJSON(w, map[string]interface{}{"object": "list", "data": []map[string]interface{}{
+			{"id": "gpt-stub", "object": "model", "owned_by": "stub"},
+			{"id": "text-embedding-stub", "object": "model", "owned_by": "stub"},
+			{"id": "whisper-stub", "object": "model", "owned_by": "stub"},
+		}})
+		return
+	}
+	if r.URL.Query().Get("after_id") == "" {
+		writeJSON(w, map[string]interface{}{"has_more": true, "first_id": "claude-stub-2", "last_id": "claude-stub-2", "data": []map[string]interface{}{
+			{"type": "model", "id": "claude-stub-2", "display_name": "Claude Stub 2"},
+		}})
+		return
+	}
+	writeJSON(w, map[string]interface{}{"has_more": false, "first_id": "claude-stub-1", "last_id": "claude-stub-1", "data": []map[string]interface{}{
+		{"type": "model", "id": "claude-stub-1", "display_name": "Claude Stub 1"},
+	}})
+}
+
+// handleOllamaShow answers /api/show for Model, a llama model trained with
+// an 8192-token context whose Modelfile sets num_ctx 4096
+func (s *Server) handleOllamaShow(w http.ResponseWriter, r *http.Request) {
+	s.hit(r.URL.Path)
+
+	var req struct {
+		Model string `json:"model"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	if req.Model != Model {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": fmt.Sprintf("model '%s' not found", req.Model)})
+		return
+	}
+	writeJSON(w, map[string]interface{}{
+		"parameters": "num_ctx                        4096\nstop                           \"<|eot_id|>\"",
+		"template":   "{{ .System }}\n{{ .Prompt }}",
+		"details": map[string]string{
+			"format":             "gguf",
+			"family":             "llama",
+			"parameter_size":     "8.0B",
+			"quantization_level": "Q4_K_M",
+		},
+		"model_info": map[string]interface{}{
+			"general.architecture": "llama",
+			"llama.context_length": 8192,
+		},
+		"capabilities": []string{"completion"},
+	})
+}
+
+// handleOllamaPull answers /api/pull, streaming the progress of two layers;
+// models named "missing:..." fail like an unknown model does
+func (s *Server) handleOllamaPull(w http.ResponseWriter, r *http.Request) {
+	s.hit(r.URL.Path)
+
+	var req struct {
+		Model string `json:"model"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Model == "" {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	encoder := json.NewEncoder(w)
+	send := func(v map[string]interface{}) {
+		encoder.Encode(v)
+		if flusher, ok := w.(http.Flusher); ok {
+			flusher.Flush()
+		}
+	}
+	send(map[string]interface{}{"status": "pulling manifest"})
+	if strings.HasPrefix(req.Model, "missing:") {
+		send(map[string]interface{}{"error": "pull model manifest: file does not exist"})
+		return
+	}
+	for i, size := range []int64{2 << 20, 1 << 20} {
+		digest := fmt.Sprintf("sha256:%064x", i+1)
+		for done := int64(0); done <= size; done += size / 4 {
+			send(map[string]interface{}{"status": "pulling " + digest[7:19], "digest": digest, "total": size, "completed": done})
+		}
+	}
+	for _, status := range []string{"verifying sha256 digest", "writing manifest", "success"} {
+		send(map[string]interface{}{"status": status})
+	}
+
+	s.mu.Lock()
+	if !slices.Contains(s.pulled, req.Model) {
+		s.pulled = append(s.pulled, req.Model)
+	}
+	s.mu.Unlock()
+}
+
+// page is the HTML served at /page: an article wrapped in navigation, a
+// cookie banner and a footer that readable-text extraction must drop
+const page = `<!DOCTYPE html>
+<html><head><title>Stub Harbor News</title><script>var tracking = "ignore me";</script></head>
+<body>
+<nav><a href="/">Home</a> <a href="/about">About</a></nav>
+<div class="cookie-banner">We use cookies</div>
+<article>
+<h1>Harbor reopens</h1>
+<p>The harbor reopened on Monday after the storm repairs.</p>
+</article>
+<footer>Copyright Stub Harbor</footer>
+</body></html>`
+
+// handlePage serves a web page for fetching
+func (s *Server) handlePage(w http.ResponseWriter, r *http.Request) {
+	s.hit(r.URL.Path)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(w, page)
+}
+
+// embedDims is the size of the stub's embeddings
+const embedDims = 64
+
+// embedding hashes the lowercased words of text into a vector
+func embedding(text string) []float32 {
+	v := make([]float32, embedDims)
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		h := fnv.New32a()
+		h.Write([]byte(word))
+		v[h.Sum32()%embedDims]++
+	}
+	return v
+}
+
+// embedRequest is the body of both embedding APIs
+type embedRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+// handleOllamaEmbed answers /api/embed
+func (s *Server) handleOllamaEmbed(w http.ResponseWriter, r *http.Request) {
+	s.hit(r.URL.Path)
+
+	var req embedRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Input) == 0 {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	embeddings := make([][]float32, len(req.Input))
+	for i, input := range req.Input {
+		embeddings[i] = embedding(input)
+	}
+	writeJSON(w, map[string]interface{}{
+		"model":             req.Model,
+		"embeddings":        embeddings,
+		"prompt_eval_count": 10 * len(req.Input),
+	})
+}
+
+// handleOpenAIEmbeddings answers /v1/embeddings
+func (s *Server) handleOpenAIEmbeddings(w http.ResponseWriter, r *http.Request) {
+	s.hit(r.URL.Path)
+
+	var req embedRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Input) == 0 {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	data := make([]map[string]interface{}, len(req.Input))
+	for i, input := range req.Input {
+		data[i] = map[string]interface{}{"object": "embedding", "index": i, "embedding": embedding(input)}
+	}
+	writeJSON(w, map[string]interface{}{
+		"object": "list",
+		"model":  req.Model,
+		"data":   data,
+		"usage":  map[string]interface{}{"prompt_tokens": 10 * len(req.Input), "total_tokens": 10 * len(req.Input)},
+	})
+}
+
+// handleRerank answers Cohere's /v2/rerank and Voyage AI's /v1/rerank. A
+// document's score is the share of the query's words it contains.
+func (s *Server) handleRerank(w http.ResponseWriter, r *http.Request) {
+	s.hit(r.URL.Path)
+
+	var req struct {
+		Query     string   `json:"query"`
+		Documents []string `json:"documents"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Documents) == 0 {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	split := func(text string) []string {
+		return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+	}
+	query := split(req.Query)
+
+	results := make([]map[string]interface{}, len(req.Documents))
+	for i, document := range req.Documents {
+		words := make(map[string]bool)
+		for _, word := range split(document) {
+			words[word] = true
+		}
+		found := 0
+		for _, word := range query {
+			if words[word] {
+				found++
+			}
+		}
+		score := 0.0
+		if len(query) > 0 {
+			score = float64(found) / float64(len(query))
+		}
+		results[i] = map[string]interface{}{"index": i, "relevance_score": score}
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i]["relevance_score"].(float64) > results[j]["relevance_score"].(float64)
+	})
+
+	key := "results"
+	if r.URL.Path == "/v1/rerank" {
+		key = "data"
+	}
+	writeJSON(w, map[string]interface{}{key: results})
+}
+
+// handleModeration answers OpenAI's /v1/moderations, flagging any input
+// that mentions violence
+func (s *Server) handleModeration(w http.ResponseWriter, r *http.Request) {
+	s.hit(r.URL.Path)
+
+	var req struct {
+		Model string `json:"model"`
+		Input string `json:"input"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	flagged := strings.Contains(strings.ToLower(req.Input), "violence")
+	writeJSON(w, map[string]interface{}{
+		"model": req.Model,
+		"results": []map[string]interface{}{{
+			"flagged":    flagged,
+			"categories": map[string]bool{"violence": flagged, "harassment": false},
+		}},
+	})
+}
+
+// handleMCP implements an MCP server with a single echo tool. Tool calls are
+// answered as an SSE stream carrying a log notification (and progress, when
+// requested) ahead of the result.
+func (s *Server) handleMCP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ID     *int            `json:"id"`
+		Method string          `json:"method"`
+		Params json.RawMessage `json:"params"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	s.hit(req.Method)
+
+	// Notifications get no response
+	if req.ID == nil {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	response := map[string]interface{}{"jsonrpc": "2.0", "id": *req.ID}
+	switch req.Method {
+	case "initialize":
+		response["result"] = map[string]interface{}{
+			"protocolVersion": "2024-11-05",
+			"capabilities":    map[string]interface{}{"tools": map[string]interface{}{}, "logging": map[string]interface{}{}},
+			"serverInfo":      map[string]string{"name": "extrachat-stub", "version": "1.0.0"},
+		}
+	case "ping", "logging/setLevel":
+		response["result"] = map[string]interface{}{}
+	case "tools/list":
+		response["result"] = map[string]interface{}{
+			"tools": []map[string]interface{}{{
+				"name":        "echo",
+				"description": "Echo the given text back",
+				"inputSchema": map[string]interface{}{
+					"type":       "object",
+					"properties": map[string]interface{}{"text": map[string]string{"type": "string"}},
+					"required":   []string{"text"},
+				},
+			}},
+		}
+	case "tools/call":
+		var params struct {
+			Name      string                 `json:"name"`
+			Arguments map[string]interface{} `json:"arguments"`
+			Meta      struct {
+				ProgressToken interface{} `json:"progressToken"`
+			} `json:"_meta"`
+		}
+		json.Unmarshal(req.Params, &params)
+		if params.Name != "echo" {
+			response["error"] = map[string]interface{}{"code": -32602, "message": "unknown tool: " + params.Name}
+			break
+		}
+		response["result"] = map[string]interface{}{
+			"content": []map[string]string{{"type": "text", "text": fmt.Sprintf("echo: %v", params.Arguments["text"])}},
+		}
+		messages := []interface{}{map[string]interface{}{
+			"jsonrpc": "2.0",
+			"method":  "notifications/message",
+			"params":  map[string]string{"level": "info", "data": "echo tool running"},
+		}}
+		if params.Meta.ProgressToken != nil {
+			messages = append(messages, map[string]interface{}{
+				"jsonrpc": "2.0",
+				"method":  "notifications/progress",
+				"params":  map[string]interface{}{"progressToken": params.Meta.ProgressToken, "progress": 1, "total": 1},
+			})
+		}
+		s.streamSSE(w, append(messages, response)...)
+		return
+	default:
+		response["error"] = map[string]interface{}{"code": -32601, "message": "method not found: " + req.Method}
+	}
+	writeJSON(w, response)
+}
+
+// streamSSE writes messages as separate server-sent events, flushing each
+func (s *Server) streamSSE(w http.ResponseWriter, messages ...interface{}) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	flusher, _ := w.(http.Flusher)
+	for _, msg := range messages {
+		data, _ := json.Marshal(msg)
+		fmt.Fprintf(w, "event: message\ndata: %s\n\n", data)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
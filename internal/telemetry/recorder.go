@@ -0,0 +1,65 @@
+package telemetry
+
+import (
+	"context"
+	"sync"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SpanRecorder is a span processor that keeps the finished spans of the most
+// recent traces in memory, so they can be inspected without a trace backend
+type SpanRecorder struct {
+	mu     sync.Mutex
+	traces map[trace.TraceID][]sdktrace.ReadOnlySpan
+	order  []trace.TraceID // Oldest first
+	limit  int             // Maximum number of traces kept
+}
+
+// NewSpanRecorder creates a recorder that keeps up to limit traces
+func NewSpanRecorder(limit int) *SpanRecorder {
+	return &SpanRecorder{
+		traces: make(map[trace.TraceID][]sdktrace.ReadOnlySpan),
+		limit:  limit,
+	}
+}
+
+// OnStart implements sdktrace.SpanProcessor
+func (r *SpanRecorder) OnStart(parent context.Context, s sdktrace.ReadWriteSpan) {}
+
+// OnEnd implements sdktrace.SpanProcessor
+func (r *SpanRecorder) OnEnd(s sdktrace.ReadOnlySpan) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	traceID := s.SpanContext().TraceID()
+	if _, ok := r.traces[traceID]; !ok {
+		r.order = append(r.order, traceID)
+		if len(r.order) > r.limit {
+			delete(r.traces, r.order[0])
+			r.order = r.order[1:]
+		}
+	}
+	r.traces[traceID] = append(r.traces[traceID], s)
+}
+
+// Shutdown implements sdktrace.SpanProcessor
+func (r *SpanRecorder) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+// ForceFlush implements sdktrace.SpanProcessor
+func (r *SpanRecorder) ForceFlush(ctx context.Context) error {
+	return nil
+}
+
+// Spans returns the recorded spans of a trace in the order they ended
+func (r *SpanRecorder) Spans(traceID trace.TraceID) []sdktrace.ReadOnlySpan {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	spans := make([]sdktrace.ReadOnlySpan, len(r.traces[traceID]))
+	copy(spans, r.traces[traceID])
+	return spans
+}
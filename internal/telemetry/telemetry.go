@@ -9,22 +9,40 @@ import (
 	"path/filepath"
 	"time"
 
+	"ExtraChat/internal/rag"
+	"ExtraChat/internal/session"
+
 	_ "github.com/mattn/go-sqlite3"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/exporters/stdout/stdoutmetric"
 	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
 	"go.opentelemetry.io/otel/metric"
+	metricnoop "go.opentelemetry.io/otel/metric/noop"
 	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
 	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
 	"go.opentelemetry.io/otel/trace"
+	tracenoop "go.opentelemetry.io/otel/trace/noop"
 	lumberjack "gopkg.in/natefinch/lumberjack.v2"
 )
 
-// InitLogger initializes structured logging with rotation
-func InitLogger() (*slog.Logger, error) {
-	logDir := "logs"
+// logLevel is the application log level, adjustable at runtime with SetLogLevel
+var logLevel = new(slog.LevelVar)
+
+// SetLogLevel changes the application log level of a running logger
+func SetLogLevel(level slog.Level) {
+	logLevel.Set(level)
+}
+
+// LogLevel returns the current application log level
+func LogLevel() slog.Level {
+	return logLevel.Level()
+}
+
+// InitLogger initializes structured logging with rotation in logDir at the
+// given level
+func InitLogger(logDir string, level slog.Level) (*slog.Logger, error) {
 	if err := os.MkdirAll(logDir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create logs directory: %w", err)
 	}
@@ -40,8 +58,9 @@ func InitLogger() (*slog.Logger, error) {
 	}
 
 	// Log only to file, not to stdout
+	SetLogLevel(level)
 	handler := slog.NewJSONHandler(lumberjackLogger, &slog.HandlerOptions{
-		Level: slog.LevelInfo,
+		Level: logLevel,
 	})
 
 	logger := slog.New(handler)
@@ -50,11 +69,21 @@ func InitLogger() (*slog.Logger, error) {
 	return logger, nil
 }
 
+// NoopTelemetry returns a tracer and meter that record nothing. No
+// providers, exporters or files are set up, so startup stays fast and no
+// metrics are written in the background.
+func NoopTelemetry() (trace.Tracer, metric.Meter, func()) {
+	tracer := tracenoop.NewTracerProvider().Tracer("chatbot")
+	meter := metricnoop.NewMeterProvider().Meter("chatbot")
+	return tracer, meter, func() {}
+}
+
 // InitTelemetry initializes OpenTelemetry tracing and metrics
-// Traces are exported to ./logs/chatbot_traces.log for debugging
-// Metrics are exported to ./logs/metrics_traces.log for debugging (every 10 seconds)
+// Traces are exported to <logDir>/extrachat_traces_process.log for debugging
+// Metrics are exported to <logDir>/extrachat_metrics_process.log for debugging (every 10 seconds)
 // OTEL collector can still pick up traces/metrics via the SDK
-func InitTelemetry(ctx context.Context) (trace.Tracer, metric.Meter, func(), error) {
+// Additional span processors (e.g. a SpanRecorder) receive every span as well
+func InitTelemetry(ctx context.Context, logDir string, processors ...sdktrace.SpanProcessor) (trace.Tracer, metric.Meter, func(), error) {
 	res, err := resource.New(ctx,
 		resource.WithAttributes(
 			semconv.ServiceName("chatbot"),
@@ -66,7 +95,6 @@ func InitTelemetry(ctx context.Context) (trace.Tracer, metric.Meter, func(), err
 	}
 
 	// Create logs directory for traces
-	logDir := "logs"
 	if err := os.MkdirAll(logDir, 0755); err != nil {
 		return nil, nil, nil, fmt.Errorf("failed to create logs directory: %w", err)
 	}
@@ -91,10 +119,14 @@ func InitTelemetry(ctx context.Context) (trace.Tracer, metric.Meter, func(), err
 
 	// Set up tracer provider with file exporter
 	// OTEL collector can still pick up traces via the SDK
-	tp := sdktrace.NewTracerProvider(
+	tpOpts := []sdktrace.TracerProviderOption{
 		sdktrace.WithBatcher(traceExporter),
 		sdktrace.WithResource(res),
-	)
+	}
+	for _, processor := range processors {
+		tpOpts = append(tpOpts, sdktrace.WithSpanProcessor(processor))
+	}
+	tp := sdktrace.NewTracerProvider(tpOpts...)
 	otel.SetTracerProvider(tp)
 
 	// Set up file writer for metrics with rotation
@@ -151,9 +183,9 @@ func InitTelemetry(ctx context.Context) (trace.Tracer, metric.Meter, func(), err
 	return tracer, meter, cleanup, nil
 }
 
-// InitDB initializes the SQLite database
-func InitDB() (*sql.DB, error) {
-	db, err := sql.Open("sqlite3", "chatbot.db")
+// InitDB initializes the SQLite database at path
+func InitDB(path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite3", path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
@@ -162,19 +194,135 @@ func InitDB() (*sql.DB, error) {
 	CREATE TABLE IF NOT EXISTS sessions (
 		id TEXT PRIMARY KEY,
 		start_time DATETIME,
-		backend TEXT
+		backend TEXT,
+		version INTEGER NOT NULL DEFAULT 0,
+		title TEXT,
+		parent_id TEXT,
+		fork_seq INTEGER,
+		favorite INTEGER NOT NULL DEFAULT 0,
+		tags TEXT,
+		persona TEXT,
+		summary TEXT,
+		tenant TEXT,
+		documents TEXT,
+		collection TEXT,
+		events TEXT,
+		model TEXT
 	);`
 
 	createMessagesTable := `
 	CREATE TABLE IF NOT EXISTS messages (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		uuid TEXT,
 		session_id TEXT,
+		seq INTEGER,
 		role TEXT,
 		content TEXT,
 		timestamp DATETIME,
+		citations TEXT,
+		speaker TEXT,
+		route TEXT,
+		truncated BOOLEAN,
+		FOREIGN KEY(session_id) REFERENCES sessions(id)
+	);`
+
+	createToolCallsTable := `
+	CREATE TABLE IF NOT EXISTS tool_calls (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		session_id TEXT,
+		server TEXT,
+		tool TEXT,
+		arguments TEXT,
+		result_hash TEXT,
+		duration_ms INTEGER,
+		error TEXT,
+		timestamp DATETIME,
+		FOREIGN KEY(session_id) REFERENCES sessions(id)
+	);`
+
+	createLLMRequestsTable := `
+	CREATE TABLE IF NOT EXISTS llm_requests (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		session_id TEXT,
+		backend TEXT,
+		model TEXT,
+		input_tokens INTEGER,
+		output_tokens INTEGER,
+		cost_usd REAL,
+		timestamp DATETIME,
 		FOREIGN KEY(session_id) REFERENCES sessions(id)
 	);`
 
+	createTokenUsageTable := `
+	CREATE TABLE IF NOT EXISTS token_usage (
+		session_id TEXT NOT NULL,
+		backend TEXT NOT NULL,
+		model TEXT NOT NULL,
+		requests INTEGER NOT NULL DEFAULT 0,
+		prompt_tokens INTEGER NOT NULL DEFAULT 0,
+		completion_tokens INTEGER NOT NULL DEFAULT 0,
+		updated_at DATETIME,
+		PRIMARY KEY (session_id, backend, model),
+		FOREIGN KEY(session_id) REFERENCES sessions(id)
+	);`
+
+	// Prompts queued with /async, and their results
+	createJobsTable := `
+	CREATE TABLE IF NOT EXISTS jobs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		session_id TEXT NOT NULL,
+		prompt TEXT NOT NULL,
+		backend TEXT NOT NULL,
+		model TEXT NOT NULL,
+		status TEXT NOT NULL,
+		response TEXT,
+		error TEXT,
+		created_at DATETIME NOT NULL,
+		started_at DATETIME,
+		finished_at DATETIME,
+		FOREIGN KEY(session_id) REFERENCES sessions(id)
+	);`
+
+	// Documents ingested for retrieval, and their embedded chunks
+	createRAGDocumentsTable := `
+	CREATE TABLE IF NOT EXISTS rag_documents (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		path TEXT NOT NULL UNIQUE,
+		hash TEXT NOT NULL,
+		model TEXT NOT NULL,
+		ingested_at DATETIME
+	);`
+
+	createRAGCollectionsTable := `
+	CREATE TABLE IF NOT EXISTS rag_collections (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL UNIQUE,
+		created_at DATETIME,
+		rerank TEXT
+	);`
+
+	createRAGCollectionDocumentsTable := `
+	CREATE TABLE IF NOT EXISTS rag_collection_documents (
+		collection_id INTEGER NOT NULL,
+		document_id INTEGER NOT NULL,
+		PRIMARY KEY(collection_id, document_id),
+		FOREIGN KEY(collection_id) REFERENCES rag_collections(id),
+		FOREIGN KEY(document_id) REFERENCES rag_documents(id)
+	);`
+
+	createRAGChunksTable := `
+	CREATE TABLE IF NOT EXISTS rag_chunks (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		document_id INTEGER NOT NULL,
+		seq INTEGER NOT NULL,
+		start_offset INTEGER,
+		end_offset INTEGER,
+		content TEXT NOT NULL,
+		content_hash TEXT,
+		embedding BLOB NOT NULL,
+		FOREIGN KEY(document_id) REFERENCES rag_documents(id)
+	);`
+
 	if _, err := db.Exec(createSessionsTable); err != nil {
 		return nil, fmt.Errorf("failed to create sessions table: %w", err)
 	}
@@ -183,5 +331,212 @@ func InitDB() (*sql.DB, error) {
 		return nil, fmt.Errorf("failed to create messages table: %w", err)
 	}
 
+	if _, err := db.Exec(createToolCallsTable); err != nil {
+		return nil, fmt.Errorf("failed to create tool_calls table: %w", err)
+	}
+	if _, err := db.Exec("CREATE INDEX IF NOT EXISTS idx_tool_calls_session ON tool_calls(session_id, id)"); err != nil {
+		return nil, fmt.Errorf("failed to create tool_calls index: %w", err)
+	}
+
+	if _, err := db.Exec(createLLMRequestsTable); err != nil {
+		return nil, fmt.Errorf("failed to create llm_requests table: %w", err)
+	}
+	if _, err := db.Exec("CREATE INDEX IF NOT EXISTS idx_llm_requests_session ON llm_requests(session_id)"); err != nil {
+		return nil, fmt.Errorf("failed to create llm_requests index: %w", err)
+	}
+	if _, err := db.Exec("CREATE INDEX IF NOT EXISTS idx_llm_requests_timestamp ON llm_requests(timestamp)"); err != nil {
+		return nil, fmt.Errorf("failed to create llm_requests index: %w", err)
+	}
+
+	if _, err := db.Exec(createTokenUsageTable); err != nil {
+		return nil, fmt.Errorf("failed to create token_usage table: %w", err)
+	}
+
+	if _, err := db.Exec(createJobsTable); err != nil {
+		return nil, fmt.Errorf("failed to create jobs table: %w", err)
+	}
+	if _, err := db.Exec("CREATE INDEX IF NOT EXISTS idx_jobs_session ON jobs(session_id, id)"); err != nil {
+		return nil, fmt.Errorf("failed to create jobs index: %w", err)
+	}
+
+	if _, err := db.Exec(createRAGDocumentsTable); err != nil {
+		return nil, fmt.Errorf("failed to create rag_documents table: %w", err)
+	}
+	if _, err := db.Exec(createRAGChunksTable); err != nil {
+		return nil, fmt.Errorf("failed to create rag_chunks table: %w", err)
+	}
+	if _, err := db.Exec("CREATE INDEX IF NOT EXISTS idx_rag_chunks_document ON rag_chunks(document_id)"); err != nil {
+		return nil, fmt.Errorf("failed to create rag_chunks index: %w", err)
+	}
+	if _, err := db.Exec(createRAGCollectionsTable); err != nil {
+		return nil, fmt.Errorf("failed to create rag_collections table: %w", err)
+	}
+	if _, err := db.Exec(createRAGCollectionDocumentsTable); err != nil {
+		return nil, fmt.Errorf("failed to create rag_collection_documents table: %w", err)
+	}
+
+	for _, col := range []struct{ name, decl string }{
+		{"version", "INTEGER NOT NULL DEFAULT 0"},
+		{"title", "TEXT"},
+		{"parent_id", "TEXT"},
+		{"fork_seq", "INTEGER"},
+		{"favorite", "INTEGER NOT NULL DEFAULT 0"},
+		{"tags", "TEXT"},
+		{"persona", "TEXT"},
+		{"summary", "TEXT"},
+		{"tenant", "TEXT"},
+		{"documents", "TEXT"},
+		{"collection", "TEXT"},
+		{"events", "TEXT"},
+		{"model", "TEXT"},
+	} {
+		if err := ensureColumn(db, "sessions", col.name, col.decl); err != nil {
+			return nil, fmt.Errorf("failed to migrate sessions table: %w", err)
+		}
+	}
+
+	if err := migrateMessageIDs(db); err != nil {
+		return nil, fmt.Errorf("failed to migrate messages table: %w", err)
+	}
+
+	// Citations of retrieved chunks, the speakers of multi-agent
+	// conversations, routing decisions, stopped replies, the chunk offsets
+	// citations point to, and per-collection rerankers
+	for _, col := range []struct{ table, name, decl string }{
+		{"messages", "citations", "TEXT"},
+		{"messages", "speaker", "TEXT"},
+		{"messages", "route", "TEXT"},
+		{"messages", "truncated", "BOOLEAN"},
+		{"rag_chunks", "start_offset", "INTEGER"},
+		{"rag_chunks", "end_offset", "INTEGER"},
+		{"rag_collections", "rerank", "TEXT"},
+	} {
+		if err := ensureColumn(db, col.table, col.name, col.decl); err != nil {
+			return nil, fmt.Errorf("failed to migrate %s table: %w", col.table, err)
+		}
+	}
+
+	if err := migrateChunkHashes(db); err != nil {
+		return nil, fmt.Errorf("failed to migrate rag_chunks table: %w", err)
+	}
+
 	return db, nil
 }
+
+// migrateChunkHashes adds the content_hash column to rag_chunks, under which
+// ingest reuses vectors, and backfills it for chunks stored before it existed
+func migrateChunkHashes(db *sql.DB) error {
+	if err := ensureColumn(db, "rag_chunks", "content_hash", "TEXT"); err != nil {
+		return err
+	}
+
+	rows, err := db.Query("SELECT id, content FROM rag_chunks WHERE content_hash IS NULL")
+	if err != nil {
+		return fmt.Errorf("failed to query legacy chunks: %w", err)
+	}
+	hashes := make(map[int64]string)
+	for rows.Next() {
+		var id int64
+		var content string
+		if err := rows.Scan(&id, &content); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan legacy chunk: %w", err)
+		}
+		hashes[id] = rag.ContentHash(content)
+	}
+	rows.Close()
+
+	for id, hash := range hashes {
+		if _, err := db.Exec("UPDATE rag_chunks SET content_hash = ? WHERE id = ?", hash, id); err != nil {
+			return fmt.Errorf("failed to backfill chunk hash: %w", err)
+		}
+	}
+
+	if _, err := db.Exec("CREATE INDEX IF NOT EXISTS idx_rag_chunks_hash ON rag_chunks(content_hash)"); err != nil {
+		return fmt.Errorf("failed to create chunk hash index: %w", err)
+	}
+	return nil
+}
+
+// migrateMessageIDs adds the uuid and seq columns to databases created before
+// messages had stable identities, and backfills them for existing rows
+func migrateMessageIDs(db *sql.DB) error {
+	for _, col := range []struct{ name, decl string }{
+		{"uuid", "TEXT"},
+		{"seq", "INTEGER"},
+	} {
+		if err := ensureColumn(db, "messages", col.name, col.decl); err != nil {
+			return err
+		}
+	}
+
+	// Legacy rows are numbered in insertion order within their session
+	if _, err := db.Exec(`
+	UPDATE messages SET seq = (
+		SELECT COUNT(*) + 1 FROM messages AS prev
+		WHERE prev.session_id = messages.session_id AND prev.id < messages.id
+	) WHERE seq IS NULL`); err != nil {
+		return fmt.Errorf("failed to backfill message seq: %w", err)
+	}
+
+	rows, err := db.Query("SELECT id FROM messages WHERE uuid IS NULL")
+	if err != nil {
+		return fmt.Errorf("failed to query legacy messages: %w", err)
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan legacy message: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		if _, err := db.Exec("UPDATE messages SET uuid = ? WHERE id = ?", session.NewUUIDv7(), id); err != nil {
+			return fmt.Errorf("failed to backfill message uuid: %w", err)
+		}
+	}
+
+	if _, err := db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_messages_uuid ON messages(uuid)"); err != nil {
+		return fmt.Errorf("failed to create message uuid index: %w", err)
+	}
+	if _, err := db.Exec("CREATE INDEX IF NOT EXISTS idx_messages_session_seq ON messages(session_id, seq)"); err != nil {
+		return fmt.Errorf("failed to create message seq index: %w", err)
+	}
+
+	return nil
+}
+
+// ensureColumn adds a column to a table if it does not already exist
+func ensureColumn(db *sql.DB, table, column, decl string) error {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return fmt.Errorf("failed to inspect table %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid        int
+			name, typ  string
+			notNull    int
+			defaultVal sql.NullString
+			pk         int
+		)
+		if err := rows.Scan(&cid, &name, &typ, &notNull, &defaultVal, &pk); err != nil {
+			return fmt.Errorf("failed to scan column info: %w", err)
+		}
+		if name == column {
+			return nil
+		}
+	}
+	rows.Close()
+
+	if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, decl)); err != nil {
+		return fmt.Errorf("failed to add column %s.%s: %w", table, column, err)
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+// Package tui has the parts of the full-screen interface of --tui, drawn
+// with Bubble Tea's bubbles and Lip Gloss: the scrollable conversation pane,
+// the sidebar and the status bar. The model tying them to the chat bot,
+// which reads the keys and runs the turns, lives with the chat bot.
+package tui
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/charmbracelet/bubbles/viewport"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// sidebarWidth is the columns of the sidebar, its border included
+const sidebarWidth = 30
+
+// minPaneWidth is the narrowest pane the sidebar is shown beside
+const minPaneWidth = 40
+
+var (
+	headingStyle  = lipgloss.NewStyle().Bold(true)
+	selectedStyle = lipgloss.NewStyle().Reverse(true)
+	sidebarStyle  = lipgloss.NewStyle().Border(lipgloss.NormalBorder(), false, true, false, false)
+	statusStyle   = lipgloss.NewStyle().Reverse(true)
+)
+
+// SidebarWidth returns the columns the sidebar takes on a screen width
+// columns wide: 0 when the pane beside it would be too narrow
+func SidebarWidth(width int) int {
+	if width-sidebarWidth < minPaneWidth {
+		return 0
+	}
+	return sidebarWidth
+}
+
+// Item is an entry of the sidebar
+type Item struct {
+	Label   string
+	Current bool // Marked as the one the pane shows
+}
+
+// Sidebar lists sessions, or the branches of one, beside the pane
+type Sidebar struct {
+	Heading  string
+	Items    []Item
+	Selected int // Highlighted item; -1 for none
+}
+
+// View draws the sidebar width columns by height rows, its border
+// included, keeping the selected item in view
+func (s Sidebar) View(width, height int) string {
+	if width < 2 || height < 1 {
+		return ""
+	}
+	inner := width - 1
+	rows := []string{headingStyle.Render(fit(" "+s.Heading, inner))}
+
+	room := height - 1
+	first := 0
+	if s.Selected >= room {
+		first = s.Selected - room + 1
+	}
+	for i := first; i < len(s.Items) && len(rows) < height; i++ {
+		mark := "  "
+		if s.Items[i].Current {
+			mark = "* "
+		}
+		text := fit(mark+s.Items[i].Label, inner)
+		if i == s.Selected {
+			text = selectedStyle.Render(text)
+		}
+		rows = append(rows, text)
+	}
+	return sidebarStyle.Width(inner).Height(height).Render(strings.Join(rows, "\n"))
+}
+
+// StatusBar draws text as the status bar of a screen width columns wide
+func StatusBar(text string, width int) string {
+	return statusStyle.Width(width).MaxWidth(width).Render(fit(" "+text, width))
+}
+
+// fit pads or cuts text to exactly width columns
+func fit(text string, width int) string {
+	if n := lipgloss.Width(text); n <= width {
+		return text + strings.Repeat(" ", width-n)
+	}
+	runes := []rune(text)
+	for len(runes) > 0 && lipgloss.Width(string(runes))+1 > width {
+		runes = runes[:len(runes)-1]
+	}
+	if width < 1 {
+		return ""
+	}
+	return string(runes) + "…"
+}
+
+// Pane is a conversation of blocks of text, such as messages, wrapped to
+// its width in a viewport that follows the end unless scrolled back. Blank
+// lines around the text of a block aren't shown.
+type Pane struct {
+	viewport viewport.Model
+	blocks   []block
+}
+
+type block struct {
+	text     string
+	rendered string // Wrapped to the pane's width; empty when not yet
+}
+
+// SetSize sets the columns and rows the pane is drawn in
+func (p *Pane) SetSize(width, height int) {
+	if width != p.viewport.Width {
+		for i := range p.blocks {
+			p.blocks[i].rendered = ""
+		}
+	}
+	p.viewport.Width, p.viewport.Height = width, height
+	p.sync()
+}
+
+// Append adds a block after the others and returns its index
+func (p *Pane) Append(text string) int {
+	p.blocks = append(p.blocks, block{text: text})
+	p.sync()
+	return len(p.blocks) - 1
+}
+
+// Set replaces the text of block i
+func (p *Pane) Set(i int, text string) {
+	p.blocks[i] = block{text: text}
+	p.sync()
+}
+
+// Extend adds text to the end of block i, as a reply streams in
+func (p *Pane) Extend(i int, text string) {
+	p.blocks[i] = block{text: p.blocks[i].text + text}
+	p.sync()
+}
+
+// Text returns the text of block i
+func (p *Pane) Text(i int) string {
+	return p.blocks[i].text
+}
+
+// Len returns the number of blocks
+func (p *Pane) Len() int {
+	return len(p.blocks)
+}
+
+// Reset removes every block and follows the end again
+func (p *Pane) Reset() {
+	p.blocks = nil
+	p.viewport.SetContent("")
+	p.viewport.GotoBottom()
+}
+
+// PageUp scrolls back a page
+func (p *Pane) PageUp() {
+	p.viewport.PageUp()
+}
+
+// PageDown scrolls forward a page, following the end again once there
+func (p *Pane) PageDown() {
+	p.viewport.PageDown()
+}
+
+// GotoBottom scrolls to the end, which the pane then follows
+func (p *Pane) GotoBottom() {
+	p.viewport.GotoBottom()
+}
+
+// Scrolled reports whether the view is scrolled back from the end
+func (p *Pane) Scrolled() bool {
+	return !p.viewport.AtBottom()
+}
+
+// View draws the lines in view
+func (p *Pane) View() string {
+	return p.viewport.View()
+}
+
+// sync wraps the blocks that changed and updates the viewport, keeping the
+// end in view if it was
+func (p *Pane) sync() {
+	if p.viewport.Width <= 0 {
+		return
+	}
+	follow := p.viewport.AtBottom()
+	wrap := lipgloss.NewStyle().Width(p.viewport.Width)
+	parts := make([]string, len(p.blocks))
+	for i := range p.blocks {
+		blk := &p.blocks[i]
+		if blk.rendered == "" {
+			blk.rendered = wrap.Render(clean(strings.Trim(blk.text, "\n")))
+		}
+		parts[i] = blk.rendered
+	}
+	p.viewport.SetContent(strings.Join(parts, "\n\n"))
+	if follow {
+		p.viewport.GotoBottom()
+	}
+}
+
+// clean drops the control characters of text other than line breaks and
+// tabs, such as a bell or the carriage return of a redrawn line
+func clean(text string) string {
+	return strings.Map(func(r rune) rune {
+		if r != '\n' && r != '\t' && unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, text)
+}
@@ -0,0 +1,119 @@
+package tui
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// lines returns the lines of a view without the padding to its width
+func lines(view string) []string {
+	rows := strings.Split(view, "\n")
+	for i, row := range rows {
+		rows[i] = strings.TrimRight(row, " ")
+	}
+	return rows
+}
+
+func TestPaneWraps(t *testing.T) {
+	var p Pane
+	p.SetSize(10, 6)
+	p.Append("the quick brown fox")
+	p.Append("\none\ttwo\a\r\n")
+
+	got := strings.Join(lines(p.View()), "|")
+	want := "the quick|brown fox||one    two||"
+	if got != want {
+		t.Errorf("View = %q, want %q", got, want)
+	}
+
+	// A narrower pane wraps the blocks again
+	p.SetSize(5, 10)
+	if got := lines(p.View()); got[0] != "the" || got[1] != "quick" {
+		t.Errorf("View at width 5 = %q", got)
+	}
+}
+
+func TestPaneFollowsEnd(t *testing.T) {
+	var p Pane
+	p.SetSize(20, 3)
+	for _, text := range []string{"one", "two", "three"} {
+		p.Append(text)
+	}
+	// Blocks are separated by a blank line, and the end is in view
+	if got := strings.Join(lines(p.View()), "|"); got != "two||three" {
+		t.Errorf("View = %q", got)
+	}
+
+	// Streaming keeps the end in view
+	i := p.Append("four")
+	p.Extend(i, " five")
+	if got := strings.Join(lines(p.View()), "|"); got != "three||four five" {
+		t.Errorf("View after Extend = %q", got)
+	}
+
+	// Scrolled back, the view stays put as the reply grows
+	p.PageUp()
+	if !p.Scrolled() {
+		t.Fatal("Scrolled = false after PageUp")
+	}
+	before := p.View()
+	p.Extend(i, "\nsix\nseven")
+	if p.View() != before {
+		t.Errorf("scrolled view moved: %q, was %q", p.View(), before)
+	}
+
+	p.GotoBottom()
+	if p.Scrolled() {
+		t.Error("Scrolled = true at the end")
+	}
+	if got := strings.Join(lines(p.View()), "|"); got != "four five|six|seven" {
+		t.Errorf("View at the end = %q", got)
+	}
+}
+
+func TestSidebar(t *testing.T) {
+	s := Sidebar{
+		Heading:  "Sessions",
+		Items:    []Item{{Label: "first", Current: true}, {Label: "second"}, {Label: "a very long session title indeed"}},
+		Selected: -1,
+	}
+	view := s.View(20, 5)
+	if w, h := lipgloss.Size(view); w != 20 || h != 5 {
+		t.Errorf("size = %dx%d, want 20x5", w, h)
+	}
+	rows := strings.Split(view, "\n")
+	for i, want := range []string{"Sessions", "* first", "  second", "  a very long sess…"} {
+		if !strings.Contains(rows[i], want) {
+			t.Errorf("row %d = %q, want %q", i, rows[i], want)
+		}
+	}
+
+	// The selected item stays in view
+	s.Selected = 2
+	rows = strings.Split(s.View(20, 3), "\n")
+	if !strings.Contains(rows[1], "second") || !strings.Contains(rows[2], "a very long") {
+		t.Errorf("rows with the last item selected = %q", rows)
+	}
+}
+
+func TestSidebarWidth(t *testing.T) {
+	if got := SidebarWidth(100); got != sidebarWidth {
+		t.Errorf("SidebarWidth(100) = %d", got)
+	}
+	// The sidebar gives way to the pane on a narrow terminal
+	if got := SidebarWidth(60); got != 0 {
+		t.Errorf("SidebarWidth(60) = %d, want 0", got)
+	}
+}
+
+func TestStatusBar(t *testing.T) {
+	bar := StatusBar("mock/mock │ a status far longer than the terminal is wide", 30)
+	if w, h := lipgloss.Size(bar); w != 30 || h != 1 {
+		t.Errorf("size = %dx%d, want 30x1", w, h)
+	}
+	if !strings.Contains(bar, " mock/mock") {
+		t.Errorf("bar = %q", bar)
+	}
+}
@@ -0,0 +1,331 @@
+// Package vcr records backend HTTP traffic to cassettes and replays it, so
+// conversations with every provider can be re-run deterministically without
+// a network or API keys. Credentials are stripped before anything is
+// written.
+package vcr
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Modes of a Recorder
+const (
+	ModeRecord = "record"
+	ModeReplay = "replay"
+)
+
+// redacted replaces credentials in cassettes
+const redacted = "REDACTED"
+
+// Cassette holds the recorded exchanges of one request: the same method,
+// path, query and body. Repeated requests are replayed in order, the last
+// one repeating.
+type Cassette struct {
+	Request      Request       `json:"request"`
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Request is a sanitized recorded request
+type Request struct {
+	Method  string            `json:"method"`
+	Path    string            `json:"path"`
+	Query   string            `json:"query,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body,omitempty"`
+}
+
+// Interaction is a recorded response
+type Interaction struct {
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body"`
+}
+
+// Recorder is an http.RoundTripper that records the exchanges of the
+// wrapped transport to a directory of cassettes, or replays them from it
+// without sending anything
+type Recorder struct {
+	mode      string
+	dir       string
+	transport http.RoundTripper
+	secrets   []string // Values scrubbed from recorded bodies, such as API keys
+
+	mu        sync.Mutex
+	cassettes map[string]*Cassette // Loaded or recorded, by file name
+	played    map[string]int       // Interactions replayed, by file name
+}
+
+// recordedHeaders are the headers kept in cassettes; credentials never are
+var recordedHeaders = []string{"Content-Type", "Anthropic-Version", "Retry-After"}
+
+// secretParam matches query parameters that carry credentials
+var secretParam = regexp.MustCompile(`(?i)(key|token|secret|signature)`)
+
+// unsafeName matches the characters replaced in cassette file names
+var unsafeName = regexp.MustCompile(`[^a-zA-Z0-9]+`)
+
+// New creates a recorder in mode over transport (http.DefaultTransport if
+// nil), which replaying never uses. Recording creates dir; replaying
+// requires it. secrets are scrubbed from the recorded bodies.
+func New(mode, dir string, transport http.RoundTripper, secrets []string) (*Recorder, error) {
+	switch mode {
+	case ModeRecord:
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create cassette directory: %w", err)
+		}
+	case ModeReplay:
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("cassette directory %s not found", dir)
+		}
+	default:
+		return nil, fmt.Errorf("unknown vcr mode %q", mode)
+	}
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	var scrub []string
+	for _, s := range secrets {
+		if len(s) >= 8 { // Short values would redact ordinary text
+			scrub = append(scrub, s)
+		}
+	}
+	return &Recorder{
+		mode:      mode,
+		dir:       dir,
+		transport: transport,
+		secrets:   scrub,
+		cassettes: make(map[string]*Cassette),
+		played:    make(map[string]int),
+	}, nil
+}
+
+// RoundTrip records or replays one exchange
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	return r.roundTrip(req, r.transport)
+}
+
+// Wrap returns a RoundTripper that records the exchanges of transport to
+// the recorder's cassettes, or replays them, like the recorder does for
+// its own transport. It lets one set of cassettes cover several pools of
+// connections.
+func (r *Recorder) Wrap(transport http.RoundTripper) http.RoundTripper {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		return r.roundTrip(req, transport)
+	})
+}
+
+// roundTripFunc adapts a function to http.RoundTripper
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// roundTrip records the exchange with transport, or replays it
+func (r *Recorder) roundTrip(req *http.Request, transport http.RoundTripper) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, fmt.Errorf("failed to read request body: %w", err)
+		}
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	recorded := r.sanitizeRequest(req, body)
+	name := cassetteName(recorded)
+
+	if r.mode == ModeReplay {
+		return r.replay(req, name, recorded)
+	}
+
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	// Save the response once it is read, so streamed replies still stream
+	resp.Body = &recordingBody{
+		ReadCloser: resp.Body,
+		done: func(data []byte) {
+			r.save(name, recorded, Interaction{
+				Status:  resp.StatusCode,
+				Headers: keepHeaders(resp.Header),
+				Body:    r.scrub(string(data)),
+			})
+		},
+	}
+	return resp, nil
+}
+
+// replay answers from the cassette of the request
+func (r *Recorder) replay(req *http.Request, name string, recorded Request) (*http.Response, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cassette, ok := r.cassettes[name]
+	if !ok {
+		data, err := os.ReadFile(filepath.Join(r.dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("no cassette for %s %s in %s (record it with --record)", recorded.Method, recorded.Path, r.dir)
+		}
+		cassette = &Cassette{}
+		if err := json.Unmarshal(data, cassette); err != nil {
+			return nil, fmt.Errorf("failed to parse cassette %s: %w", name, err)
+		}
+		if len(cassette.Interactions) == 0 {
+			return nil, fmt.Errorf("cassette %s has no interactions", name)
+		}
+		r.cassettes[name] = cassette
+	}
+
+	i := min(r.played[name], len(cassette.Interactions)-1)
+	r.played[name]++
+	interaction := cassette.Interactions[i]
+
+	header := make(http.Header)
+	for k, v := range interaction.Headers {
+		header.Set(k, v)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", interaction.Status, http.StatusText(interaction.Status)),
+		StatusCode:    interaction.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(interaction.Body)),
+		ContentLength: int64(len(interaction.Body)),
+		Request:       req,
+	}, nil
+}
+
+// save appends an interaction to the request's cassette and writes it
+func (r *Recorder) save(name string, recorded Request, interaction Interaction) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cassette, ok := r.cassettes[name]
+	if !ok {
+		cassette = &Cassette{Request: recorded}
+		r.cassettes[name] = cassette
+	}
+	cassette.Interactions = append(cassette.Interactions, interaction)
+
+	data, err := json.MarshalIndent(cassette, "", "  ")
+	if err != nil {
+		return
+	}
+	// Errors surface as a missing cassette on replay; the recorded
+	// conversation itself must not fail because of them
+	_ = os.WriteFile(filepath.Join(r.dir, name), append(data, '\n'), 0o644)
+}
+
+// sanitizeRequest returns the request as it is matched and recorded:
+// without host, credentials or volatile headers
+func (r *Recorder) sanitizeRequest(req *http.Request, body []byte) Request {
+	query := req.URL.Query()
+	for param := range query {
+		if secretParam.MatchString(param) {
+			query.Set(param, redacted)
+		}
+	}
+	return Request{
+		Method:  req.Method,
+		Path:    req.URL.Path,
+		Query:   sortedQuery(query),
+		Headers: keepHeaders(req.Header),
+		Body:    r.scrub(string(body)),
+	}
+}
+
+// scrub replaces the secrets in text
+func (r *Recorder) scrub(text string) string {
+	for _, s := range r.secrets {
+		text = strings.ReplaceAll(text, s, redacted)
+	}
+	return text
+}
+
+// cassetteName names the cassette of a request after its path and a hash
+// of what identifies it, so the same request always maps to the same file
+func cassetteName(req Request) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n%s\n%s", req.Method, req.Path, req.Query, req.Body)
+	path := strings.Trim(unsafeName.ReplaceAllString(req.Path, "_"), "_")
+	if path == "" {
+		path = "root"
+	}
+	return fmt.Sprintf("%s_%s_%s.json", strings.ToLower(req.Method), path, hex.EncodeToString(h.Sum(nil))[:12])
+}
+
+// sortedQuery encodes a query with its parameters in order
+func sortedQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		for _, v := range query[k] {
+			parts = append(parts, url.QueryEscape(k)+"="+url.QueryEscape(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// keepHeaders returns the recorded headers present in h
+func keepHeaders(h http.Header) map[string]string {
+	kept := make(map[string]string)
+	for _, name := range recordedHeaders {
+		if v := h.Get(name); v != "" {
+			kept[name] = v
+		}
+	}
+	if len(kept) == 0 {
+		return nil
+	}
+	return kept
+}
+
+// recordingBody copies a response body as it is read and hands the copy
+// to done at the end, or on Close after reading the rest
+type recordingBody struct {
+	io.ReadCloser
+	buf  bytes.Buffer
+	done func([]byte)
+	once sync.Once
+}
+
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.buf.Write(p[:n])
+	if err == io.EOF {
+		b.once.Do(func() { b.done(b.buf.Bytes()) })
+	}
+	return n, err
+}
+
+func (b *recordingBody) Close() error {
+	b.once.Do(func() {
+		io.Copy(&b.buf, b.ReadCloser)
+		b.done(b.buf.Bytes())
+	})
+	return b.ReadCloser.Close()
+}
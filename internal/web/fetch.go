@@ -0,0 +1,161 @@
+// Package web downloads pages for the chat context and reduces them to
+// their readable text
+package web
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"ExtraChat/internal/extract"
+)
+
+// fetchTimeout bounds a whole download, redirects included
+const fetchTimeout = 30 * time.Second
+
+// maxRedirects is how many redirects a fetch follows
+const maxRedirects = 5
+
+// ErrNotAllowed is returned for URLs whose host is not on the allowlist
+var ErrNotAllowed = errors.New("domain is not on the fetch allowlist")
+
+// Limits restricts what a fetch may download
+type Limits struct {
+	AllowedDomains []string // Hosts that may be fetched, with their subdomains; empty allows all
+	MaxBytes       int64    // Larger responses are cut at this size
+	AllowPrivate   bool     // Loopback, private and link-local addresses may be fetched
+}
+
+// Allows reports whether host is on the allowlist
+func (l Limits) Allows(host string) bool {
+	if len(l.AllowedDomains) == 0 {
+		return true
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, domain := range l.AllowedDomains {
+		domain = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(domain), "."))
+		if domain != "" && (host == domain || strings.HasSuffix(host, "."+domain)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Page is a downloaded page reduced to text
+type Page struct {
+	URL         string // Final URL, after redirects
+	Status      int
+	ContentType string
+	Title       string
+	Text        string
+	Truncated   bool // The body was cut at Limits.MaxBytes
+}
+
+// Fetch downloads rawURL with GET and returns its text: HTML without the
+// navigation, scripts and other boilerplate, PDF text, or text bodies as
+// they are. Every redirect target must pass the allowlist too. Unless
+// limits allow private addresses, client's transport should dial with
+// DialContext, which keeps the fetch to public ones.
+func Fetch(ctx context.Context, client *http.Client, rawURL string, limits Limits) (*Page, error) {
+	target, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL: %w", err)
+	}
+	if err := checkURL(target, limits); err != nil {
+		return nil, err
+	}
+
+	// A copy of the client, so the redirect policy stays with this fetch
+	c := *client
+	c.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= maxRedirects {
+			return fmt.Errorf("stopped after %d redirects", maxRedirects)
+		}
+		return checkURL(req.URL, limits)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+	if !limits.AllowPrivate {
+		ctx = context.WithValue(ctx, publicOnlyKey{}, true)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", target.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,text/plain;q=0.9,application/pdf;q=0.8,*/*;q=0.5")
+	req.Header.Set("User-Agent", "extrachat")
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch URL: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, limits.MaxBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	page := &Page{
+		URL:         resp.Request.URL.String(),
+		Status:      resp.StatusCode,
+		ContentType: resp.Header.Get("Content-Type"),
+	}
+	if int64(len(body)) > limits.MaxBytes {
+		body = body[:limits.MaxBytes]
+		page.Truncated = true
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(page.ContentType)
+	switch {
+	case mediaType == "text/html" || mediaType == "application/xhtml+xml":
+		page.Title, page.Text = Readable(body)
+	case mediaType == "application/pdf":
+		if page.Truncated {
+			return nil, fmt.Errorf("PDF is larger than the fetch limit of %d KB", limits.MaxBytes>>10)
+		}
+		if page.Text, err = extract.Text("page.pdf", body); err != nil {
+			return nil, err
+		}
+	case isText(mediaType) || (mediaType == "" && utf8.Valid(body)):
+		page.Text = string(body)
+	default:
+		return nil, fmt.Errorf("unsupported content type %q", page.ContentType)
+	}
+	return page, nil
+}
+
+// checkURL accepts http and https URLs to allowed hosts. A literal private
+// address is refused here, since with a proxy nothing else sees it.
+func checkURL(u *url.URL, limits Limits) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("only http and https URLs can be fetched")
+	}
+	if u.Hostname() == "" {
+		return fmt.Errorf("URL %s has no host", u)
+	}
+	if !limits.Allows(u.Hostname()) {
+		return fmt.Errorf("%s: %w", u.Hostname(), ErrNotAllowed)
+	}
+	if addr, err := netip.ParseAddr(u.Hostname()); err == nil && !limits.AllowPrivate && isPrivate(addr) {
+		return fmt.Errorf("%s: %w", u.Hostname(), ErrPrivateAddress)
+	}
+	return nil
+}
+
+// isText reports whether a media type is text a model can read
+func isText(mediaType string) bool {
+	return strings.HasPrefix(mediaType, "text/") ||
+		mediaType == "application/json" || strings.HasSuffix(mediaType, "+json") ||
+		mediaType == "application/xml" || strings.HasSuffix(mediaType, "+xml")
+}
@@ -0,0 +1,94 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"os"
+	"syscall"
+)
+
+// ErrPrivateAddress is returned for fetches of loopback, private and
+// link-local addresses
+var ErrPrivateAddress = errors.New("loopback, private and link-local addresses can't be fetched")
+
+// publicOnlyKey marks the context of a fetch that may not reach private
+// addresses
+type publicOnlyKey struct{}
+
+// sharedAddressSpace is the carrier-grade NAT range of RFC 6598, which
+// some clouds and VPNs use for internal services
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// isPrivate reports whether addr is this machine or on its networks:
+// loopback, RFC 1918 and IPv6 unique local, shared address space,
+// link-local (which holds cloud metadata endpoints such as 169.254.169.254)
+// or unspecified
+func isPrivate(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsLoopback() || addr.IsPrivate() || sharedAddressSpace.Contains(addr) ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsUnspecified()
+}
+
+// DialContext returns the DialContext of transports that send fetches. In a
+// fetch that doesn't allow private addresses it refuses to connect to one.
+// The address connected to is checked, after DNS resolution, so a public
+// name can't lead to a private address. Proxies from the environment are
+// connected to as they are; the URL check covers literal addresses sent
+// through them.
+func DialContext(dialer *net.Dialer) func(ctx context.Context, network, address string) (net.Conn, error) {
+	public := *dialer
+	public.Control = func(network, address string, _ syscall.RawConn) error {
+		addr, err := netip.ParseAddrPort(address)
+		if err != nil {
+			return fmt.Errorf("unexpected address %s: %w", address, err)
+		}
+		if isPrivate(addr.Addr()) {
+			return fmt.Errorf("%s: %w", addr.Addr(), ErrPrivateAddress)
+		}
+		return nil
+	}
+	proxies := proxyAddresses()
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		if ctx.Value(publicOnlyKey{}) == nil || proxies[address] {
+			return dialer.DialContext(ctx, network, address)
+		}
+		return public.DialContext(ctx, network, address)
+	}
+}
+
+// proxyAddresses returns the host:port of the proxies in the environment,
+// which http.ProxyFromEnvironment also reads once
+func proxyAddresses() map[string]bool {
+	addrs := make(map[string]bool)
+	for _, name := range []string{"HTTP_PROXY", "http_proxy", "HTTPS_PROXY", "https_proxy"} {
+		raw := os.Getenv(name)
+		if raw == "" {
+			continue
+		}
+		u, err := url.Parse(raw)
+		if err != nil || u.Host == "" {
+			// A bare host:port, as ProxyFromEnvironment accepts
+			u, err = url.Parse("http://" + raw)
+		}
+		if err != nil || u.Hostname() == "" {
+			continue
+		}
+		port := u.Port()
+		switch {
+		case port != "":
+		case u.Scheme == "https":
+			port = "443"
+		case u.Scheme == "socks5":
+			port = "1080"
+		default:
+			port = "80"
+		}
+		addrs[net.JoinHostPort(u.Hostname(), port)] = true
+	}
+	return addrs
+}
@@ -0,0 +1,124 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func TestIsPrivate(t *testing.T) {
+	tests := []struct {
+		addr    string
+		private bool
+	}{
+		{"127.0.0.1", true},
+		{"::1", true},
+		{"10.1.2.3", true},
+		{"172.16.0.1", true},
+		{"192.168.1.1", true},
+		{"fd00::1", true},
+		{"100.64.0.1", true},
+		{"100.127.255.255", true},
+		{"169.254.169.254", true},
+		{"fe80::1", true},
+		{"0.0.0.0", true},
+		{"::", true},
+		{"::ffff:127.0.0.1", true},
+		{"::ffff:169.254.169.254", true},
+		{"::ffff:10.0.0.1", true},
+		{"8.8.8.8", false},
+		{"100.63.255.255", false},
+		{"100.128.0.1", false},
+		{"172.32.0.1", false},
+		{"2606:4700::1111", false},
+		{"::ffff:8.8.8.8", false},
+	}
+	for _, tt := range tests {
+		if got := isPrivate(netip.MustParseAddr(tt.addr)); got != tt.private {
+			t.Errorf("isPrivate(%s) = %v, want %v", tt.addr, got, tt.private)
+		}
+	}
+}
+
+// listen accepts connections on loopback until the test ends
+func listen(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestDialContext(t *testing.T) {
+	addr := listen(t)
+	proxy := listen(t)
+	for _, name := range []string{"HTTP_PROXY", "http_proxy", "HTTPS_PROXY", "https_proxy"} {
+		t.Setenv(name, "")
+	}
+	t.Setenv("HTTPS_PROXY", "http://"+proxy)
+	dial := DialContext(&net.Dialer{})
+	publicOnly := context.WithValue(context.Background(), publicOnlyKey{}, true)
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		address string
+		refused bool
+	}{
+		{"private address", publicOnly, addr, true},
+		{"private address when allowed", context.Background(), addr, false},
+		{"proxy from the environment", publicOnly, proxy, false},
+	}
+	for _, tt := range tests {
+		conn, err := dial(tt.ctx, "tcp", tt.address)
+		if err == nil {
+			conn.Close()
+		}
+		if refused := errors.Is(err, ErrPrivateAddress); refused != tt.refused || (!tt.refused && err != nil) {
+			t.Errorf("%s: dial %s = %v, want refused %v", tt.name, tt.address, err, tt.refused)
+		}
+	}
+}
+
+// roundTripFunc is an http.RoundTripper answering with a function
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestFetchRefusesPrivateLiterals(t *testing.T) {
+	var requested []string
+	client := &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		requested = append(requested, req.URL.String())
+		header := http.Header{"Location": []string{"http://169.254.169.254/latest/meta-data/"}}
+		return &http.Response{StatusCode: http.StatusFound, Header: header, Body: io.NopCloser(strings.NewReader("")), Request: req}, nil
+	})}
+	limits := Limits{MaxBytes: 1 << 20}
+
+	for _, url := range []string{"http://[::ffff:127.0.0.1]/", "http://100.100.100.200/", "http://example.com/"} {
+		if _, err := Fetch(context.Background(), client, url, limits); !errors.Is(err, ErrPrivateAddress) {
+			t.Errorf("Fetch(%s) = %v, want a private address error", url, err)
+		}
+	}
+	// Only the public URL was requested; its redirect was not followed
+	if len(requested) != 1 || requested[0] != "http://example.com/" {
+		t.Errorf("requested %q, want only http://example.com/", requested)
+	}
+}
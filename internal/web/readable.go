@@ -0,0 +1,288 @@
+package web
+
+import (
+	"bytes"
+	"html"
+	"regexp"
+	"strings"
+)
+
+// skipElements hold no readable text; their content is dropped
+var skipElements = map[string]bool{
+	"script": true, "style": true, "noscript": true, "template": true,
+	"svg": true, "canvas": true, "iframe": true, "object": true,
+	"nav": true, "header": true, "footer": true, "aside": true,
+	"form": true, "button": true, "select": true, "dialog": true,
+}
+
+// voidElements have no end tag
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true,
+	"hr": true, "img": true, "input": true, "link": true, "meta": true,
+	"param": true, "source": true, "track": true, "wbr": true,
+}
+
+// blockElements start a new line
+var blockElements = map[string]bool{
+	"p": true, "div": true, "section": true, "article": true, "main": true,
+	"br": true, "hr": true, "li": true, "tr": true, "table": true,
+	"ul": true, "ol": true, "dl": true, "dt": true, "dd": true,
+	"blockquote": true, "pre": true, "figure": true, "figcaption": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+}
+
+// boilerplate matches class and id values of navigation, ads and the like
+var boilerplate = regexp.MustCompile(`(?i)(^|[\s_-])(nav|navbar|menu|footer|sidebar|comments?|cookies?|consent|banner|ads?|advert\w*|share|sharing|related|social|promo|breadcrumbs?|popup|modal|newsletter|subscribe)($|[\s_-])`)
+
+var (
+	tagPattern    = regexp.MustCompile(`^<(/?)([a-zA-Z][a-zA-Z0-9-]*)([^>]*?)(/?)>`)
+	attrPattern   = regexp.MustCompile(`(?i)\b(class|id|role|hidden|aria-hidden)\b(?:\s*=\s*("[^"]*"|'[^']*'|[^\s>]+))?`)
+	blankLines    = regexp.MustCompile(`\n{3,}`)
+	trailingSpace = regexp.MustCompile(`[ \t]+\n`)
+	spaceRun      = regexp.MustCompile(`[ \t\r\f\v]+`)
+)
+
+// node is an element of a parsed page; text children are kept in order
+// with the elements
+type node struct {
+	tag      string
+	attrs    string
+	children []*node
+	text     string // Set for text nodes, which have no tag
+}
+
+// Readable returns the title and main text of an HTML page. Scripts,
+// navigation, footers, forms and elements whose class or id marks them as
+// boilerplate are dropped, and the text is taken from <article> or <main>
+// when the page has one. Blocks are separated by newlines and headings and
+// list items keep a Markdown marker.
+func Readable(page []byte) (title, text string) {
+	root := parseHTML(page)
+	if t := find(root, "title"); t != nil {
+		title = strings.Join(strings.Fields(html.UnescapeString(textOf(t))), " ")
+	}
+
+	content := find(root, "article")
+	if content == nil {
+		content = find(root, "main")
+	}
+	if content == nil {
+		if content = find(root, "body"); content == nil {
+			content = root
+		}
+	}
+
+	// Inside an article a <header> holds its title, not the site's banner
+	w := &textWriter{keepHeader: content.tag == "article" || content.tag == "main"}
+	w.render(content, false)
+	text = trailingSpace.ReplaceAllString(w.b.String(), "\n")
+	text = blankLines.ReplaceAllString(text, "\n\n")
+	return title, strings.TrimSpace(text)
+}
+
+// parseHTML builds a loose tree from page. Unclosed elements are closed by
+// the nearest matching end tag, and stray end tags are ignored; that is
+// enough for extracting text from real pages.
+func parseHTML(page []byte) *node {
+	root := &node{tag: "#root"}
+	stack := []*node{root}
+	top := func() *node { return stack[len(stack)-1] }
+
+	for len(page) > 0 {
+		i := bytes.IndexByte(page, '<')
+		if i < 0 {
+			i = len(page)
+		}
+		if i > 0 {
+			top().children = append(top().children, &node{text: string(page[:i])})
+			page = page[i:]
+			continue
+		}
+
+		switch {
+		case bytes.HasPrefix(page, []byte("<!--")):
+			end := bytes.Index(page[4:], []byte("-->"))
+			if end < 0 {
+				return root
+			}
+			page = page[4+end+3:]
+			continue
+		case bytes.HasPrefix(page, []byte("<!")) || bytes.HasPrefix(page, []byte("<?")):
+			end := bytes.IndexByte(page, '>')
+			if end < 0 {
+				return root
+			}
+			page = page[end+1:]
+			continue
+		}
+
+		m := tagPattern.FindSubmatch(page)
+		if m == nil {
+			// A lone "<" is text
+			top().children = append(top().children, &node{text: "<"})
+			page = page[1:]
+			continue
+		}
+		page = page[len(m[0]):]
+		name := strings.ToLower(string(m[2]))
+
+		if len(m[1]) > 0 {
+			for j := len(stack) - 1; j > 0; j-- {
+				if stack[j].tag == name {
+					stack = stack[:j]
+					break
+				}
+			}
+			continue
+		}
+
+		n := &node{tag: name, attrs: string(m[3])}
+		top().children = append(top().children, n)
+		if voidElements[name] || len(m[4]) > 0 {
+			continue
+		}
+		if name == "script" || name == "style" || name == "textarea" || name == "title" {
+			// Raw text up to the end tag
+			end := bytes.Index(bytes.ToLower(page), []byte("</"+name))
+			if end < 0 {
+				end = len(page)
+			}
+			n.children = []*node{{text: string(page[:end])}}
+			page = page[end:]
+			if close := bytes.IndexByte(page, '>'); close >= 0 {
+				page = page[close+1:]
+			}
+			continue
+		}
+		stack = append(stack, n)
+	}
+	return root
+}
+
+// find returns the first element named tag, depth first
+func find(n *node, tag string) *node {
+	if n.tag == tag {
+		return n
+	}
+	for _, c := range n.children {
+		if found := find(c, tag); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// textOf returns the raw text inside n
+func textOf(n *node) string {
+	if n.tag == "" {
+		return n.text
+	}
+	var b strings.Builder
+	for _, c := range n.children {
+		b.WriteString(textOf(c))
+	}
+	return b.String()
+}
+
+// textWriter collects the readable text of a page
+type textWriter struct {
+	b          strings.Builder
+	keepHeader bool
+}
+
+// isBoilerplate reports whether an element should be left out
+func (w *textWriter) isBoilerplate(n *node) bool {
+	if skipElements[n.tag] && !(n.tag == "header" && w.keepHeader) {
+		return true
+	}
+	for _, m := range attrPattern.FindAllStringSubmatch(n.attrs, -1) {
+		name := strings.ToLower(m[1])
+		value := strings.Trim(m[2], `"'`)
+		switch name {
+		case "hidden":
+			return true
+		case "aria-hidden":
+			if value == "true" {
+				return true
+			}
+		case "role":
+			if value == "navigation" || value == "banner" || value == "contentinfo" || value == "complementary" {
+				return true
+			}
+		default:
+			if boilerplate.MatchString(value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// render writes the readable text of n; pre keeps whitespace
+func (w *textWriter) render(n *node, pre bool) {
+	b := &w.b
+	if n.tag == "" {
+		text := html.UnescapeString(n.text)
+		if !pre {
+			text = spaceRun.ReplaceAllString(strings.ReplaceAll(text, "\n", " "), " ")
+			// Avoid leading spaces on a new line and doubled spaces
+			if s := b.String(); s == "" || strings.HasSuffix(s, "\n") || strings.HasSuffix(s, " ") {
+				text = strings.TrimLeft(text, " ")
+			}
+		}
+		b.WriteString(text)
+		return
+	}
+	if n.tag != "#root" && w.isBoilerplate(n) {
+		return
+	}
+
+	block := blockElements[n.tag]
+	if block {
+		newline(b)
+	}
+	switch {
+	case isHeading(n.tag):
+		b.WriteString("\n" + strings.Repeat("#", int(n.tag[1]-'0')) + " ")
+	case n.tag == "li":
+		b.WriteString("- ")
+	case spaced(n.tag) && !atListMarker(b.String()):
+		b.WriteString("\n")
+	case n.tag == "td" || n.tag == "th":
+		b.WriteString(" ")
+	}
+	for _, c := range n.children {
+		w.render(c, pre || n.tag == "pre")
+	}
+	if block {
+		newline(b)
+	}
+	if spaced(n.tag) || isHeading(n.tag) {
+		b.WriteString("\n")
+	}
+}
+
+// spaced reports whether a blank line surrounds elements named tag
+func spaced(tag string) bool {
+	return tag == "p" || tag == "pre" || tag == "blockquote" || tag == "table"
+}
+
+// atListMarker reports whether s ends with a list item marker that has no
+// text yet
+func atListMarker(s string) bool {
+	return s == "- " || strings.HasSuffix(s, "\n- ")
+}
+
+// isHeading reports whether tag is h1 to h6
+func isHeading(tag string) bool {
+	return len(tag) == 2 && tag[0] == 'h' && tag[1] >= '1' && tag[1] <= '6'
+}
+
+// newline ends the current line unless it is already empty
+func newline(b *strings.Builder) {
+	s := b.String()
+	if s == "" || strings.HasSuffix(s, "\n") || atListMarker(s) {
+		return
+	}
+	b.WriteString("\n")
+}